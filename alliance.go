@@ -0,0 +1,92 @@
+package main
+
+import (
+	"sync/atomic"
+)
+
+// --- Alliances ---
+// Federated peers (Relation 1) share vision and defend each other.
+//
+// Vision: heartbeats to allies carry the sectors this node's players can see from (colony
+// systems and orbiting fleets, at most MaxSharedVision). Every local player's fog of war is
+// lifted around the anchors its allies last sent, as if they were their own.
+//
+// Mutual defense: when an ally reports a grievance, we file one of our own against the attacker
+// and broadcast it on the ally's behalf (GrievanceReport.Defending), so the attacker's infamy
+// comes from every alliance member. Reports made in defense are not defended again. With the
+// mutual_defense_war feature on, the attacker is also declared hostile on the spot.
+
+const MaxSharedVision = 500
+
+// Our sensor anchors as shared with allies
+func nodeVision() [][]int {
+	vision := [][]int{}
+	rows, err := db.Query(`SELECT DISTINCT s.x, s.y, s.z FROM solar_systems s WHERE s.id IN (
+	                           SELECT system_id FROM colonies
+	                           UNION SELECT origin_system FROM fleets WHERE status != 'TRANSIT') LIMIT ?`, MaxSharedVision)
+	if err != nil {
+		return vision
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var x, y, z int
+		rows.Scan(&x, &y, &z)
+		vision = append(vision, []int{x, y, z})
+	}
+	return vision
+}
+
+// Anchors allies have shared with us
+func alliedVision() [][]int {
+	peerLock.RLock()
+	defer peerLock.RUnlock()
+	var anchors [][]int
+	for _, p := range Peers {
+		if p.Relation == 1 {
+			anchors = append(anchors, p.Vision...)
+		}
+	}
+	return anchors
+}
+
+// Keeps an ally's vision from a heartbeat; non-allies' is dropped. Caller holds peerLock.
+func acceptVision(p *Peer, vision [][]int) {
+	if p.Relation != 1 || len(vision) > MaxSharedVision {
+		p.Vision = nil
+		return
+	}
+	for _, a := range vision {
+		if len(a) != 3 {
+			p.Vision = nil
+			return
+		}
+	}
+	p.Vision = vision
+}
+
+// Answers an ally's grievance with our own; caller holds peerLock. Returns the report to
+// broadcast, or nil when no defense is owed.
+func mutualDefense(g *GrievanceReport, reporter *Peer) []byte {
+	if reporter.Relation != 1 || g.Defending != "" || g.OffenderUUID == ServerUUID {
+		return nil
+	}
+	offender, known := Peers[g.OffenderUUID]
+	if known && offender.Relation == 1 {
+		InfoLog.Printf("🤝 Ally %s was attacked by ally %s; staying out of it", reporter.UUID, g.OffenderUUID)
+		return nil
+	}
+
+	if known && featureEnabled(FeatureMutualDefenseWar) && offender.Relation != 2 {
+		offender.Relation = 2
+		savePeer(offender)
+		InfoLog.Printf("⚔️ War declared on %s in defense of ally %s", offender.UUID, reporter.UUID)
+	}
+
+	report, err := fileGrievance(g.OffenderUUID, g.Damage, g.Proof, reporter.UUID)
+	if err != nil {
+		return nil
+	}
+	db.Exec("INSERT INTO transaction_log (tick, action_type, payload_blob) VALUES (?, 'MUTUAL_DEFENSE', ?)", atomic.LoadInt64(&CurrentTick), report)
+	InfoLog.Printf("🛡️ Filing grievance against %s in defense of ally %s", g.OffenderUUID, reporter.UUID)
+	return report
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// --- Combat Arbitration ---
+// Battles are deterministic: the same fleets in the same system on the same tick always play
+// out the same way (see battleRNG). Every battle we fight keeps its inputs next to its report,
+// and GET /federation/battle serves them as a claim signed by this node. When a peer's account
+// of a battle differs from ours, the operator opens a dispute (POST /admin/arbitration): both
+// claims go to up to ArbiterCount neutral peers, the best-reputed nodes that are party to
+// neither claim. Each arbiter checks the signatures, replays both battles from their own
+// inputs and broadcasts a verdict. A claim whose report doesn't follow from its inputs is a
+// lie, and every node that trusts the arbiter docks the liar ArbitrationPenalty/ArbiterCount
+// reputation per verdict. When both claims replay cleanly from different inputs the verdict
+// is inconclusive: each node signed its own view and nobody can tell which one was true.
+
+const (
+	ArbiterCount         = 3
+	ArbiterMinReputation = 20.0
+	ArbitrationPenalty   = 30.0 // reputation a liar loses when the whole panel agrees
+	MaxArbitrationFleets = 200
+	ArbitrationTimeout   = 5 * time.Second
+
+	VerdictAgree        = "agree"        // both claims describe the same battle
+	VerdictLied         = "lied"         // at least one report doesn't follow from its inputs
+	VerdictInconclusive = "inconclusive" // both replay cleanly from different inputs
+)
+
+type BattleClaim struct {
+	NodeUUID  string       `json:"node_uuid"`
+	SystemID  string       `json:"system_id"`
+	Tick      int64        `json:"tick"`
+	Inputs    []Fleet      `json:"inputs"` // fleets as they entered the battle
+	Report    BattleReport `json:"report"`
+	Signature string       `json:"signature"` // ed25519 by NodeUUID's key over signingString
+}
+
+type ArbitrationVerdict struct {
+	Arbiter   string   `json:"arbiter"`
+	SystemID  string   `json:"system_id"`
+	Tick      int64    `json:"tick"`
+	Claimants []string `json:"claimants"`
+	Liars     []string `json:"liars"`
+	Outcome   string   `json:"outcome"`
+}
+
+// FED_TX payload an arbiter broadcasts
+type ArbitrationAnnouncement struct {
+	Verdict *ArbitrationVerdict `json:"arbitration_verdict"`
+}
+
+func hashJSON(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return hashBLAKE3(data)
+}
+
+func (c *BattleClaim) signingString() []byte {
+	return []byte(fmt.Sprintf("ownworld-battle:%s:%s:%d:%s:%s",
+		c.NodeUUID, c.SystemID, c.Tick, hashJSON(c.Inputs), hashJSON(c.Report)))
+}
+
+// Signs our record of the battle fought in a system on a tick
+func buildBattleClaim(sysID string, tick int64) (*BattleClaim, error) {
+	var rJson, iJson string
+	if err := db.QueryRow("SELECT report_json, COALESCE(inputs_json, '') FROM battle_reports WHERE system_id=? AND tick=? ORDER BY id DESC LIMIT 1",
+		sysID, tick).Scan(&rJson, &iJson); err != nil {
+		return nil, fmt.Errorf("no battle in %s at tick %d", sysID, tick)
+	}
+	if iJson == "" {
+		return nil, fmt.Errorf("battle predates recorded inputs")
+	}
+	c := &BattleClaim{NodeUUID: ServerUUID, SystemID: sysID, Tick: tick}
+	json.Unmarshal([]byte(iJson), &c.Inputs)
+	json.Unmarshal([]byte(rJson), &c.Report)
+	c.Report.ID = 0
+	c.Signature = hex.EncodeToString(SignMessage(PrivateKey, c.signingString()))
+	return c, nil
+}
+
+func verifyBattleClaim(c *BattleClaim) bool {
+	sig, err := hex.DecodeString(c.Signature)
+	if err != nil {
+		return false
+	}
+	key := PublicKey
+	if c.NodeUUID != ServerUUID {
+		peerLock.RLock()
+		peer, known := Peers[c.NodeUUID]
+		if known {
+			key = peer.PublicKey
+		}
+		peerLock.RUnlock()
+		if !known {
+			return false
+		}
+	}
+	return VerifySignature(key, c.signingString(), sig)
+}
+
+// Whether the claimed report is what its inputs produce
+func replayMatches(c *BattleClaim) bool {
+	replay := resolveBattle(c.SystemID, append([]Fleet(nil), c.Inputs...), c.Tick)
+	return hashJSON(replay) == hashJSON(c.Report)
+}
+
+// Replays both claims; caller has checked they are signed and name the same battle
+func judgeClaims(a, b *BattleClaim) ArbitrationVerdict {
+	v := ArbitrationVerdict{Arbiter: ServerUUID, SystemID: a.SystemID, Tick: a.Tick,
+		Claimants: []string{a.NodeUUID, b.NodeUUID}, Liars: []string{}}
+	for _, c := range []*BattleClaim{a, b} {
+		if !replayMatches(c) {
+			v.Liars = append(v.Liars, c.NodeUUID)
+		}
+	}
+	switch {
+	case len(v.Liars) > 0:
+		v.Outcome = VerdictLied
+	case hashJSON(a.Report) == hashJSON(b.Report):
+		v.Outcome = VerdictAgree
+	default:
+		v.Outcome = VerdictInconclusive
+	}
+	return v
+}
+
+func checkClaims(claims []BattleClaim) error {
+	if len(claims) != 2 {
+		return fmt.Errorf("A dispute needs exactly two claims")
+	}
+	a, b := claims[0], claims[1]
+	if a.SystemID != b.SystemID || a.Tick != b.Tick {
+		return fmt.Errorf("Claims describe different battles")
+	}
+	if a.NodeUUID == b.NodeUUID {
+		return fmt.Errorf("Claims come from the same node")
+	}
+	if len(a.Inputs) > MaxArbitrationFleets || len(b.Inputs) > MaxArbitrationFleets {
+		return fmt.Errorf("Too many fleets (max %d)", MaxArbitrationFleets)
+	}
+	return nil
+}
+
+// Best-reputed non-hostile peers that are party to none of the claims
+func chooseArbiters(parties []string) []*Peer {
+	party := make(map[string]bool)
+	for _, p := range parties {
+		party[p] = true
+	}
+	peerLock.RLock()
+	defer peerLock.RUnlock()
+	var panel []*Peer
+	for _, p := range Peers {
+		if !party[p.UUID] && p.Relation != 2 && p.Reputation >= ArbiterMinReputation {
+			panel = append(panel, p)
+		}
+	}
+	sort.Slice(panel, func(i, j int) bool {
+		if panel[i].Reputation != panel[j].Reputation {
+			return panel[i].Reputation > panel[j].Reputation
+		}
+		return panel[i].UUID < panel[j].UUID
+	})
+	if len(panel) > ArbiterCount {
+		panel = panel[:ArbiterCount]
+	}
+	arbiters := make([]*Peer, len(panel))
+	for i, p := range panel {
+		cp := *p
+		arbiters[i] = &cp
+	}
+	return arbiters
+}
+
+// Records a verdict and docks the liars. Verdicts count only from the arbiter that reached
+// them, and only if we would trust it to arbitrate ourselves; each arbiter counts once per battle.
+func applyVerdict(v *ArbitrationVerdict, senderID string) {
+	if v.Arbiter != senderID || len(v.Claimants) != 2 || v.Claimants[0] == v.Claimants[1] {
+		return
+	}
+	for _, c := range v.Claimants {
+		if c == v.Arbiter {
+			return
+		}
+	}
+	for _, liar := range v.Liars {
+		if liar != v.Claimants[0] && liar != v.Claimants[1] {
+			return
+		}
+	}
+
+	peerLock.Lock()
+	defer peerLock.Unlock()
+	if v.Arbiter != ServerUUID {
+		arbiter, known := Peers[v.Arbiter]
+		if !known || arbiter.Relation == 2 || arbiter.Reputation < ArbiterMinReputation {
+			InfoLog.Printf("Ignoring arbitration verdict from untrusted peer %s", v.Arbiter)
+			return
+		}
+	}
+
+	claimants, _ := json.Marshal(v.Claimants)
+	liars, _ := json.Marshal(v.Liars)
+	res, err := db.Exec(`INSERT OR IGNORE INTO arbitration_verdicts (arbiter_uuid, system_id, tick, claimants_json, liars_json, outcome, received_at)
+	                     VALUES (?, ?, ?, ?, ?, ?, ?)`, v.Arbiter, v.SystemID, v.Tick, string(claimants), string(liars), v.Outcome, time.Now().Unix())
+	if err != nil {
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return
+	}
+
+	InfoLog.Printf("⚖️ Arbiter %s ruled %s on the battle in %s at tick %d", v.Arbiter, v.Outcome, v.SystemID, v.Tick)
+	for _, liar := range v.Liars {
+		if liar == ServerUUID {
+			ErrorLog.Printf("⚖️ Arbiter %s found our report of the battle in %s at tick %d false", v.Arbiter, v.SystemID, v.Tick)
+			continue
+		}
+		p, known := Peers[liar]
+		if !known {
+			continue
+		}
+		if penalizePeer(p, ArbitrationPenalty/ArbiterCount, "arbitration") {
+			p.Relation = 2
+			savePeer(p)
+			InfoLog.Printf("⚔️ Peer %s declared HOSTILE after arbitration (Rep: %.2f).", p.UUID, p.Reputation)
+		}
+	}
+}
+
+func arbitrationVerdicts(limit int) []ArbitrationVerdict {
+	list := []ArbitrationVerdict{}
+	rows, err := db.Query("SELECT arbiter_uuid, system_id, tick, claimants_json, liars_json, outcome FROM arbitration_verdicts ORDER BY id DESC LIMIT ?", limit)
+	if err != nil {
+		return list
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v ArbitrationVerdict
+		var cJson, lJson string
+		rows.Scan(&v.Arbiter, &v.SystemID, &v.Tick, &cJson, &lJson, &v.Outcome)
+		json.Unmarshal([]byte(cJson), &v.Claimants)
+		json.Unmarshal([]byte(lJson), &v.Liars)
+		list = append(list, v)
+	}
+	return list
+}
+
+// Asks a peer for its signed claim; nil if it can't or won't give a valid one
+func fetchBattleClaim(nodeUUID, sysID string, tick int64) *BattleClaim {
+	peerLock.RLock()
+	peer, known := Peers[nodeUUID]
+	var addr string
+	if known {
+		addr = peer.Url
+	}
+	peerLock.RUnlock()
+	if !known {
+		return nil
+	}
+
+	req, err := newFederationRequest("GET", fmt.Sprintf("%s/federation/battle?system_id=%s&tick=%d", addr, url.QueryEscape(sysID), tick), nil)
+	if err != nil {
+		return nil
+	}
+	resp, err := (&http.Client{Timeout: ArbitrationTimeout}).Do(req)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	var c BattleClaim
+	if resp.StatusCode != 200 || json.NewDecoder(resp.Body).Decode(&c) != nil ||
+		c.NodeUUID != nodeUUID || c.SystemID != sysID || c.Tick != tick || !verifyBattleClaim(&c) {
+		return nil
+	}
+	return &c
+}
+
+// GET ?system_id=&tick=: our signed claim for a battle we fought
+func handleFederationBattle(w http.ResponseWriter, r *http.Request) {
+	tick, _ := strconv.ParseInt(r.URL.Query().Get("tick"), 10, 64)
+	c, err := buildBattleClaim(r.URL.Query().Get("system_id"), tick)
+	if err != nil {
+		http.Error(w, err.Error(), 404)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
+}
+
+// POST {"claims": [a, b]} from one of the parties: replay both and broadcast the verdict
+func handleFederationArbitrate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Claims []BattleClaim `json:"claims"`
+	}
+	body, _ := io.ReadAll(io.LimitReader(r.Body, FedMaxBody))
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, "Bad Payload", 400)
+		return
+	}
+	if err := checkClaims(req.Claims); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	a, b := &req.Claims[0], &req.Claims[1]
+	sender := r.Header.Get(HeaderFedNode)
+	if sender != a.NodeUUID && sender != b.NodeUUID {
+		http.Error(w, "Not A Party", 403)
+		return
+	}
+	if a.NodeUUID == ServerUUID || b.NodeUUID == ServerUUID {
+		http.Error(w, "Party To Dispute", 409)
+		return
+	}
+	if !verifyBattleClaim(a) || !verifyBattleClaim(b) {
+		http.Error(w, "Bad Claim Signature", 400)
+		return
+	}
+
+	v := judgeClaims(a, b)
+	applyVerdict(&v, ServerUUID)
+	payload, _ := json.Marshal(ArbitrationAnnouncement{Verdict: &v})
+	broadcastTransaction(payload)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// GET: verdicts we have recorded, newest first.
+// POST {"peer_uuid", "system_id", "tick"}: dispute a peer's report of a battle we also fought.
+func handleAdminArbitration(w http.ResponseWriter, r *http.Request) {
+	if !authenticateAdmin(r) {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(arbitrationVerdicts(50))
+		return
+	}
+
+	var req struct {
+		PeerUUID string `json:"peer_uuid"`
+		SystemID string `json:"system_id"`
+		Tick     int64  `json:"tick"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	ours, err := buildBattleClaim(req.SystemID, req.Tick)
+	if err != nil {
+		http.Error(w, err.Error(), 404)
+		return
+	}
+	theirs := fetchBattleClaim(req.PeerUUID, req.SystemID, req.Tick)
+	if theirs == nil {
+		http.Error(w, "Peer Claim Unavailable", 502)
+		return
+	}
+	if hashJSON(ours.Report) == hashJSON(theirs.Report) {
+		http.Error(w, "Reports Agree", 400)
+		return
+	}
+	arbiters := chooseArbiters([]string{ServerUUID, req.PeerUUID})
+	if len(arbiters) == 0 {
+		http.Error(w, "No Neutral Arbiters", 503)
+		return
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{"claims": []*BattleClaim{ours, theirs}})
+	client := &http.Client{Timeout: ArbitrationTimeout}
+	verdicts := []ArbitrationVerdict{}
+	for _, a := range arbiters {
+		resp, err := postFederation(client, a.Url+"/federation/arbitrate", body)
+		if err != nil {
+			InfoLog.Printf("⚖️ Arbiter %s unreachable: %v", a.UUID, err)
+			continue
+		}
+		var v ArbitrationVerdict
+		if resp.StatusCode == 200 && json.NewDecoder(resp.Body).Decode(&v) == nil {
+			verdicts = append(verdicts, v)
+		}
+		resp.Body.Close()
+	}
+	InfoLog.Printf("⚖️ Disputed the battle in %s at tick %d with %s: %d of %d arbiters answered",
+		req.SystemID, req.Tick, req.PeerUUID, len(verdicts), len(arbiters))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"arbiters": len(arbiters), "verdicts": verdicts})
+}
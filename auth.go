@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Request Authentication ---
+// middlewareAuth resolves the caller once per request and stores the result in the request
+// context; authenticate(r) just reads it back. Lookups are cached for SessionCacheTTL so a
+// burst of requests costs one DB hit. Credentials come from resolvers tried in order, so a
+// new scheme (API keys) only has to add one.
+//
+// A session token lasts SessionTTL from when it was issued (users.expires_at). Clients renew
+// before then with POST /api/session/refresh, which swaps the token for a fresh one without
+// the password; once it has lapsed only a login will do.
+
+const (
+	SessionCacheTTL  = 30 * time.Second
+	SessionCacheSize = 10000
+	SessionTTL       = 7 * 24 * time.Hour
+)
+
+type Principal struct {
+	UserID string
+	Method string // "session", later "api_key"
+}
+
+type authResult struct {
+	Principal Principal
+	Err       error
+}
+
+type ctxKey int
+
+const ctxAuthKey ctxKey = 0
+
+var errNoCredentials = fmt.Errorf("Missing Auth Headers")
+
+// A resolver returns errNoCredentials when the request carries nothing it understands
+type credentialResolver func(r *http.Request) (Principal, error)
+
+var credentialResolvers = []credentialResolver{resolveSession}
+
+type sessionEntry struct {
+	UserID  string
+	Expires time.Time
+}
+
+var (
+	sessionCache = make(map[string]sessionEntry)
+	sessionLock  sync.Mutex
+)
+
+func resolveSession(r *http.Request) (Principal, error) {
+	userUUID := r.Header.Get("X-User-UUID")
+	token := r.Header.Get("X-Session-Token")
+	if userUUID == "" || token == "" {
+		return Principal{}, errNoCredentials
+	}
+
+	key := userUUID + "|" + token
+	now := time.Now()
+	sessionLock.Lock()
+	entry, ok := sessionCache[key]
+	sessionLock.Unlock()
+	if ok && now.Before(entry.Expires) {
+		return Principal{UserID: entry.UserID, Method: "session"}, nil
+	}
+
+	var expires int64
+	err := db.QueryRow("SELECT COALESCE(expires_at, 0) FROM users WHERE global_uuid=? AND session_token=?", userUUID, token).Scan(&expires)
+	if err != nil {
+		return Principal{}, fmt.Errorf("Access Denied")
+	}
+	if expires <= now.Unix() {
+		return Principal{}, fmt.Errorf("Session Expired")
+	}
+	cacheUntil := now.Add(SessionCacheTTL)
+	if end := time.Unix(expires, 0); end.Before(cacheUntil) {
+		cacheUntil = end
+	}
+
+	sessionLock.Lock()
+	if len(sessionCache) >= SessionCacheSize {
+		for k, v := range sessionCache {
+			if now.After(v.Expires) {
+				delete(sessionCache, k)
+			}
+		}
+	}
+	sessionCache[key] = sessionEntry{UserID: userUUID, Expires: cacheUntil}
+	sessionLock.Unlock()
+	return Principal{UserID: userUUID, Method: "session"}, nil
+}
+
+// Drops cached sessions for a user, e.g. after a login rotates the token
+func invalidateSessions(userUUID string) {
+	sessionLock.Lock()
+	defer sessionLock.Unlock()
+	for k := range sessionCache {
+		if strings.HasPrefix(k, userUUID+"|") {
+			delete(sessionCache, k)
+		}
+	}
+}
+
+// Issues a fresh token for the user, replacing the old one
+func newSession(userUUID string) (token string, expires int64) {
+	token = generateSessionToken()
+	expires = time.Now().Add(SessionTTL).Unix()
+	db.Exec("UPDATE users SET session_token=?, expires_at=? WHERE global_uuid=?", token, expires, userUUID)
+	invalidateSessions(userUUID)
+	return token, expires
+}
+
+// POST with a live session -> {"session_token", "expires_at"}; the old token stops working
+func handleSessionRefresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", 405)
+		return
+	}
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+	token, expires := newSession(userID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"session_token": token, "expires_at": expires})
+}
+
+func resolvePrincipal(r *http.Request) authResult {
+	for _, resolve := range credentialResolvers {
+		p, err := resolve(r)
+		if err == errNoCredentials {
+			continue
+		}
+		return authResult{Principal: p, Err: err}
+	}
+	return authResult{Err: errNoCredentials}
+}
+
+// Resolves credentials for /api/ routes. Rejection is left to the handlers so public
+// endpoints keep working for callers with stale headers.
+func middlewareAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		res := resolvePrincipal(r)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxAuthKey, res)))
+	})
+}
+
+// Auth runs outside idempotency, so a replayed answer is only ever served to a resolved caller
+func middlewareAPI(next http.Handler) http.Handler {
+	return middlewareAuth(middlewareIdempotency(next))
+}
+
+func principalFromContext(ctx context.Context) (Principal, bool) {
+	res, ok := ctx.Value(ctxAuthKey).(authResult)
+	if !ok || res.Err != nil {
+		return Principal{}, false
+	}
+	return res.Principal, true
+}
+
+// Returns the caller's user UUID, using the middleware's result when present
+func authenticate(r *http.Request) (string, error) {
+	res, ok := r.Context().Value(ctxAuthKey).(authResult)
+	if !ok {
+		res = resolvePrincipal(r)
+	}
+	if res.Err != nil {
+		return "", res.Err
+	}
+	return res.Principal.UserID, nil
+}
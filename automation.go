@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// --- Economic Automation ---
+// Besides its policies, a colony can carry standing orders for its cashflow, set with the
+// "automation" field of /api/colony/policy:
+//
+//	burn  {"iron": {"above": 50000, "max_per_tick": 2000}}   sell the surplus over "above" to
+//	                                                          the bank, at most max_per_tick a tick
+//	buy   {"food": {"below": 5000, "quantity": 1000, "max_price": 12}}   list a buy order in the
+//	                                                          colony's system when stock drops below
+//
+// The tick evaluates them after production, like a player making the same bank and market
+// calls: burns pay what /api/bank/burn would (and count towards financial centers), buy orders
+// need a trading post and pay the listing fee. Rate caps keep a misconfigured rule from
+// draining a colony or flooding the market: a burn never exceeds AutoBurnCap a tick, and a buy
+// rule places nothing while its previous order is still listed, nor within AutoBuyCooldown
+// ticks of placing one. The cooldown is kept in memory, so a restart forgets it; the open-order
+// check still holds. A resource can't be both burned above a level and bought below a higher
+// one, which would trade the colony's credits away in circles.
+
+const (
+	MaxAutomationRules = 10
+	AutoBurnCap        = 5000 // per rule per tick
+	AutoBuyCooldown    = 60   // ticks between orders from one rule
+)
+
+type AutoBurnRule struct {
+	Above      int `json:"above"`
+	MaxPerTick int `json:"max_per_tick,omitempty"` // 0 = AutoBurnCap
+}
+
+type AutoBuyRule struct {
+	Below    int `json:"below"`
+	Quantity int `json:"quantity"`
+	MaxPrice int `json:"max_price"`
+}
+
+type ColonyAutomation struct {
+	Burn map[string]AutoBurnRule `json:"burn,omitempty"`
+	Buy  map[string]AutoBuyRule  `json:"buy,omitempty"`
+}
+
+// Tick of each buy rule's last order, by colony and item
+var autoBuyPlaced = struct {
+	sync.Mutex
+	ticks map[string]int64
+}{ticks: make(map[string]int64)}
+
+func parseAutomation(s string) *ColonyAutomation {
+	if s == "" {
+		return nil
+	}
+	var a ColonyAutomation
+	if json.Unmarshal([]byte(s), &a) != nil || (len(a.Burn) == 0 && len(a.Buy) == 0) {
+		return nil
+	}
+	return &a
+}
+
+func (a *ColonyAutomation) validate() error {
+	if len(a.Burn)+len(a.Buy) > MaxAutomationRules {
+		return fmt.Errorf("at most %d automation rules per colony", MaxAutomationRules)
+	}
+	for item, rule := range a.Burn {
+		if !validResources[item] {
+			return fmt.Errorf("invalid resource %q", item)
+		}
+		if rule.Above < 0 || rule.MaxPerTick < 0 || rule.MaxPerTick > AutoBurnCap {
+			return fmt.Errorf("burn %s: above must be 0 or more and max_per_tick at most %d", item, AutoBurnCap)
+		}
+	}
+	for item, rule := range a.Buy {
+		if !validResources[item] {
+			return fmt.Errorf("invalid resource %q", item)
+		}
+		if rule.Below <= 0 || rule.Quantity <= 0 || rule.MaxPrice <= 0 {
+			return fmt.Errorf("buy %s: below, quantity and max_price must be positive", item)
+		}
+		if burn, ok := a.Burn[item]; ok && burn.Above < rule.Below {
+			return fmt.Errorf("%s would be burned above %d and bought below %d", item, burn.Above, rule.Below)
+		}
+	}
+	return nil
+}
+
+// Credits the bank pays for amount of item from a colony (see /api/bank/burn)
+func burnPayout(colonyID int, item string, amount int) int {
+	eff := GetEfficiency(colonyID, item)
+	if eff < 0.1 {
+		eff = 0.1
+	}
+	return int(float64(amount) * (1.0 / eff) * itemSupplyFactor(item) * currentEconomy().BurnRate)
+}
+
+// Evaluates every colony's standing orders; called by the tick after production
+func runColonyAutomation(tick int64) {
+	rows, err := db.Query("SELECT id, owner_uuid, system_id, automation_json FROM colonies WHERE COALESCE(automation_json, '') NOT IN ('', '{}')")
+	if err != nil {
+		return
+	}
+	type automated struct {
+		id           int
+		owner, sysID string
+		rules        *ColonyAutomation
+	}
+	var list []automated
+	for rows.Next() {
+		var c automated
+		var aJson string
+		rows.Scan(&c.id, &c.owner, &c.sysID, &aJson)
+		if c.rules = parseAutomation(aJson); c.rules != nil {
+			list = append(list, c)
+		}
+	}
+	rows.Close()
+
+	// The tick holds stateLock exclusively, so no player action runs alongside
+	for _, c := range list {
+		for item, rule := range c.rules.Burn {
+			autoBurn(c.id, c.owner, item, rule, tick)
+		}
+		for item, rule := range c.rules.Buy {
+			autoBuy(c.id, c.owner, c.sysID, item, rule, tick)
+		}
+	}
+}
+
+func colonyStock(colonyID int, item string) int {
+	var stock int
+	db.QueryRow(fmt.Sprintf("SELECT COALESCE(%s, 0) FROM colonies WHERE id=?", item), colonyID).Scan(&stock)
+	return stock
+}
+
+func autoBurn(colonyID int, owner, item string, rule AutoBurnRule, tick int64) {
+	amount := colonyStock(colonyID, item) - rule.Above
+	limit := rule.MaxPerTick
+	if limit <= 0 {
+		limit = AutoBurnCap
+	}
+	if amount > limit {
+		amount = limit
+	}
+	if amount <= 0 {
+		return
+	}
+	payout := burnPayout(colonyID, item, amount)
+	if payout < 0 {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+	res, err := tx.Exec(fmt.Sprintf("UPDATE colonies SET %s = %s - ? WHERE id=? AND %s >= ?", item, item, item), amount, colonyID, amount)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return
+	}
+	tx.Exec("UPDATE users SET credits = credits + ? WHERE global_uuid=?", payout, owner)
+	burnJson, _ := json.Marshal(BurnRecord{UserUUID: owner, Item: item, Amount: amount, Payout: payout, ColonyID: colonyID})
+	tx.Exec("INSERT INTO transaction_log (tick, action_type, payload_blob) VALUES (?, 'BANK_BURN', ?)", tick, burnJson)
+	tx.Commit()
+}
+
+func autoBuy(colonyID int, owner, sysID, item string, rule AutoBuyRule, tick int64) {
+	if colonyStock(colonyID, item) >= rule.Below {
+		return
+	}
+	key := fmt.Sprintf("%d|%s", colonyID, item)
+	autoBuyPlaced.Lock()
+	last, placed := autoBuyPlaced.ticks[key]
+	autoBuyPlaced.Unlock()
+	if placed && tick-last < AutoBuyCooldown {
+		return
+	}
+	prefix := fmt.Sprintf("auto-%d-%s-", colonyID, item)
+	var open int
+	db.QueryRow("SELECT count(*) FROM market_orders WHERE order_id LIKE ? AND expires_tick > ?", prefix+"%", tick).Scan(&open)
+	if open > 0 {
+		return
+	}
+
+	o := MarketOrder{
+		ID: fmt.Sprintf("%s%d", prefix, tick), SellerUUID: owner, Item: item, Quantity: rule.Quantity, Price: rule.MaxPrice,
+		IsBuy: true, OriginSystem: sysID, ExpiresTick: tick + OrderLifetimeTicks,
+	}
+	fee, status, msg := checkBulkOrder(owner, o, tick, map[string]int{})
+	if status != 0 {
+		DebugLog.Printf("Auto-buy for colony %d skipped: %s", colonyID, msg)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+	res, err := tx.Exec("UPDATE users SET credits = credits - ? WHERE global_uuid=? AND credits >= ?", fee, owner, fee)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return
+	}
+	_, err = tx.Exec("INSERT INTO market_orders (order_id, seller_uuid, item, quantity, price, is_buy, origin_system, expires_tick) VALUES (?,?,?,?,?,?,?,?)",
+		o.ID, o.SellerUUID, o.Item, o.Quantity, o.Price, o.IsBuy, o.OriginSystem, o.ExpiresTick)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	if tx.Commit() != nil {
+		return
+	}
+
+	autoBuyPlaced.Lock()
+	autoBuyPlaced.ticks[key] = tick
+	autoBuyPlaced.Unlock()
+}
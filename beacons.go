@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync/atomic"
+)
+
+// --- Beacons ---
+// Players drop named beacons at coordinates (POST /api/beacons) and launch fleets to them by
+// name ({"beacon": "Staging Area"} in place of target_system). A beacon is private unless
+// shared: shared beacons are seen by every player on this node and ride along with heartbeats
+// to allied nodes (at most MaxSharedBeacons), whose players see them too, so an alliance can
+// name its rally points without passing coordinates around. Region scans list the beacons in
+// range whether or not a sensor covers them.
+//
+// Names follow the star-name rules. A launch resolves a name to the player's own beacon
+// first, then to one shared on this node, then to an ally's.
+
+const (
+	MaxBeaconsPerPlayer = 50
+	MaxSharedBeacons    = 200
+)
+
+type Beacon struct {
+	ID        int    `json:"id,omitempty"`
+	Name      string `json:"name"`
+	X         int    `json:"x"`
+	Y         int    `json:"y"`
+	Z         int    `json:"z"`
+	Shared    bool   `json:"shared"`
+	OwnerUUID string `json:"owner_uuid"`
+	Node      string `json:"node,omitempty"` // the allied node that shared it
+}
+
+func (b Beacon) SystemID() string {
+	return fmt.Sprintf("sys-%d-%d-%d", b.X, b.Y, b.Z)
+}
+
+func queryBeacons(where string, args ...interface{}) []Beacon {
+	beacons := []Beacon{}
+	rows, err := db.Query("SELECT id, name, x, y, z, shared, owner_uuid FROM beacons WHERE "+where+" ORDER BY id", args...)
+	if err != nil {
+		return beacons
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var b Beacon
+		rows.Scan(&b.ID, &b.Name, &b.X, &b.Y, &b.Z, &b.Shared, &b.OwnerUUID)
+		beacons = append(beacons, b)
+	}
+	return beacons
+}
+
+// Shared beacons as sent to allies
+func nodeBeacons() []Beacon {
+	beacons := queryBeacons("shared=1")
+	if len(beacons) > MaxSharedBeacons {
+		beacons = beacons[:MaxSharedBeacons]
+	}
+	for i := range beacons {
+		beacons[i].ID = 0
+	}
+	return beacons
+}
+
+// Keeps an ally's beacons from a heartbeat; non-allies' are dropped. Caller holds peerLock.
+func acceptBeacons(p *Peer, beacons []Beacon) {
+	if p.Relation != 1 || len(beacons) > MaxSharedBeacons {
+		p.Beacons = nil
+		return
+	}
+	kept := make([]Beacon, 0, len(beacons))
+	for _, b := range beacons {
+		if validStarName(b.Name) != nil || !inUniverse(b.X, b.Y, b.Z) {
+			continue
+		}
+		b.ID, b.Shared, b.Node = 0, true, p.UUID
+		kept = append(kept, b)
+	}
+	p.Beacons = kept
+}
+
+// The user's own beacons, then those shared on this node, then allies', in resolution order
+func visibleBeacons(userID string) []Beacon {
+	beacons := queryBeacons("owner_uuid=?", userID)
+	beacons = append(beacons, queryBeacons("shared=1 AND owner_uuid!=?", userID)...)
+
+	peerLock.RLock()
+	var nodes []string
+	for uuid, p := range Peers {
+		if p.Relation == 1 && len(p.Beacons) > 0 {
+			nodes = append(nodes, uuid)
+		}
+	}
+	sort.Strings(nodes)
+	for _, uuid := range nodes {
+		beacons = append(beacons, Peers[uuid].Beacons...)
+	}
+	peerLock.RUnlock()
+	return beacons
+}
+
+func findBeacon(userID, name string) (Beacon, bool) {
+	for _, b := range visibleBeacons(userID) {
+		if b.Name == name {
+			return b, true
+		}
+	}
+	return Beacon{}, false
+}
+
+// GET lists the beacons you can see; POST {"name", "x", "y", "z", "shared"} places (or moves)
+// one of yours, and {"name", "remove": true} takes it down
+func handleBeacons(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var req struct {
+			Name   string `json:"name" validate:"required"`
+			X      int    `json:"x"`
+			Y      int    `json:"y"`
+			Z      int    `json:"z"`
+			Shared bool   `json:"shared"`
+			Remove bool   `json:"remove"`
+		}
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+
+		defer lockRows(userRow(userID))()
+
+		if req.Remove {
+			res, _ := db.Exec("DELETE FROM beacons WHERE owner_uuid=? AND name=?", userID, req.Name)
+			if n, _ := res.RowsAffected(); n == 0 {
+				http.Error(w, "Beacon Not Found", 404)
+				return
+			}
+		} else {
+			if err := validStarName(req.Name); err != nil {
+				http.Error(w, "Invalid name: "+err.Error(), 400)
+				return
+			}
+			if !inUniverse(req.X, req.Y, req.Z) {
+				http.Error(w, "Coordinates outside the universe", 400)
+				return
+			}
+			var others int
+			db.QueryRow("SELECT count(*) FROM beacons WHERE owner_uuid=? AND name!=?", userID, req.Name).Scan(&others)
+			if others >= MaxBeaconsPerPlayer {
+				http.Error(w, fmt.Sprintf("Beacon limit reached (%d)", MaxBeaconsPerPlayer), 400)
+				return
+			}
+			_, err := db.Exec(`INSERT INTO beacons (owner_uuid, name, x, y, z, shared, placed_tick) VALUES (?, ?, ?, ?, ?, ?, ?)
+			                   ON CONFLICT(owner_uuid, name) DO UPDATE SET x=excluded.x, y=excluded.y, z=excluded.z,
+			                   shared=excluded.shared, placed_tick=excluded.placed_tick`,
+				userID, req.Name, req.X, req.Y, req.Z, req.Shared, atomic.LoadInt64(&CurrentTick))
+			if err != nil {
+				http.Error(w, "DB Error", 500)
+				return
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(visibleBeacons(userID))
+}
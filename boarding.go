@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	mrand "math/rand"
+)
+
+// --- Boarding & Capture ---
+// A fleet fitted with boarding pods (they take weapon slots) can take a crippled enemy ship
+// instead of destroying it. Its specialists fight as marines, up to MarinesPerPod per pod. When
+// its chosen target is down to BoardableShare of its structure, the fleet sends them across
+// instead of firing. The attempt succeeds with chance marines / (marines + defense). Defense is
+// the target's crew (BoardingDefenseCrew plus its specialists), scaled by 0.5 plus the share of
+// structure it has left, so the more battered the ship, the easier it falls. Marines are lost
+// either way: MarineLossOnFailure of the party when repelled, MarineLossOnSuccess when they win.
+//
+// A captured ship changes hands in orbit where it was taken. Its crew and passengers are lost,
+// but its cargo comes with it. Before they give up, the defenders sabotage each module with
+// chance SabotageChance. The prize has no experience and no orders. Taking a ship is piracy
+// in the eyes of the federation: the captor is charged CaptureInfamy in grievances, more than
+// for destroying it. The battle report records each attempt, the modules sabotaged and the
+// marines lost.
+
+const (
+	MarinesPerPod       = 20
+	BoardableShare      = 0.5
+	BoardingDefenseCrew = 50
+	MarineLossOnFailure = 0.5
+	MarineLossOnSuccess = 0.2
+	SabotageChance      = 0.5
+	CaptureInfamy       = 250
+)
+
+// Marines the attacker can send this round
+func boardingParty(c *combatant) int {
+	pods := countModule(c.Fleet.Modules, "boarding_pod")
+	party := pods * MarinesPerPod
+	if c.Marines < party {
+		party = c.Marines
+	}
+	return party
+}
+
+func boardable(c *combatant) bool {
+	return !c.Out && float64(c.HP) <= float64(c.MaxHP)*BoardableShare
+}
+
+// Sends attacker's marines against target; on success the target is out, captured
+func attemptBoarding(rng *mrand.Rand, round int, attacker, target *combatant, party int, report *BattleReport) {
+	defense := float64(BoardingDefenseCrew+target.Fleet.Payload.PopSpecialists) * (0.5 + float64(target.HP)/float64(target.MaxHP))
+	chance := float64(party) / (float64(party) + defense)
+
+	if rng.Float64() < chance {
+		lost := int(float64(party) * MarineLossOnSuccess)
+		attacker.Marines -= lost
+		attacker.Report.MarinesLost += lost
+
+		target.Out = true
+		target.Report.Outcome = "captured"
+		target.Report.CapturedBy = attacker.Fleet.OwnerUUID
+		for _, m := range target.Fleet.Modules {
+			if rng.Float64() < SabotageChance {
+				target.Report.Sabotaged = append(target.Report.Sabotaged, m)
+			}
+		}
+		attacker.Kills++
+		report.Events = append(report.Events, fmt.Sprintf("R%d: Fleet %d boarded and captured Fleet %d (%d marines lost, %d modules sabotaged)",
+			round, attacker.Fleet.ID, target.Fleet.ID, lost, len(target.Report.Sabotaged)))
+		return
+	}
+
+	lost := int(float64(party) * MarineLossOnFailure)
+	if lost < 1 {
+		lost = 1
+	}
+	attacker.Marines -= lost
+	attacker.Report.MarinesLost += lost
+	report.Events = append(report.Events, fmt.Sprintf("R%d: Fleet %d's boarding party was repelled from Fleet %d (%d marines lost)",
+		round, attacker.Fleet.ID, target.Fleet.ID, lost))
+}
+
+// Modules left after sabotage, each sabotaged entry taking out one fitted module
+func withoutModules(modules, removed []string) []string {
+	gone := make(map[string]int)
+	for _, m := range removed {
+		gone[m]++
+	}
+	kept := []string{}
+	for _, m := range modules {
+		if gone[m] > 0 {
+			gone[m]--
+			continue
+		}
+		kept = append(kept, m)
+	}
+	return kept
+}
+
+// Hands a captured fleet to its captor, in orbit where it was taken
+func captureFleet(f Fleet, p BattleParticipant, sysID string) {
+	kept := withoutModules(f.Modules, p.Sabotaged)
+	modJson, _ := json.Marshal(kept)
+	cJson, _ := json.Marshal(wornCondition(withoutConditions(f.Modules, f.Condition, p.Sabotaged), len(kept), battleWear(p)))
+	f.Payload.PopLaborers, f.Payload.PopSpecialists = 0, 0
+	plJson, _ := json.Marshal(f.Payload)
+	db.Exec(`UPDATE fleets SET owner_uuid=?, modules_json=?, module_condition_json=?, payload_json=?, status='ORBIT', origin_system=?, dest_system=?,
+	         experience=0, hull_damage=?, auto_return=0, home_system=NULL, target_order_id=NULL, patrol_json='' WHERE id=?`,
+		p.CapturedBy, string(modJson), string(cJson), string(plJson), sysID, sysID, hullIntegrity(f.HullClass)-p.EndHP, p.FleetID)
+
+	reportGrievance(p.CapturedBy, p.OwnerUUID, CaptureInfamy)
+	emitEvent(p.OwnerUUID, EventFleetLost, map[string]interface{}{
+		"fleet_id": p.FleetID, "system_id": sysID, "cause": "captured", "captured_by": p.CapturedBy,
+	})
+	InfoLog.Printf("🏴‍☠️ Fleet %d captured by %s in %s (%d modules sabotaged)", p.FleetID, p.CapturedBy, sysID, len(p.Sabotaged))
+}
+
+// The marines a boarding fleet lost come out of its specialists
+func spendMarines(f Fleet, lost int) {
+	f.Payload.PopSpecialists -= lost
+	if f.Payload.PopSpecialists < 0 {
+		f.Payload.PopSpecialists = 0
+	}
+	plJson, _ := json.Marshal(f.Payload)
+	db.Exec("UPDATE fleets SET payload_json=? WHERE id=?", string(plJson), f.ID)
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	mrand "math/rand"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// --- Orbital Bombardment ---
+// Bombers in orbit over a foreign colony strike the category their owner picked. Defense
+// batteries spoil the aim; stray bombs land anywhere. Hitting housing kills civilians, which
+// weighs far heavier in the grievance (infamy) record than hitting military targets.
+
+const (
+	TargetIndustry = "industry"
+	TargetDefenses = "defenses"
+	TargetHousing  = "housing"
+
+	BombsPerBay            = 5
+	BombBaseAccuracy       = 0.9
+	BatteryAccuracyPenalty = 0.1
+	MinBombAccuracy        = 0.3
+	CasualtiesPerHousing   = 100
+)
+
+// Grievance damage per structure destroyed, by category
+var BombInfamy = map[string]int{TargetDefenses: 5, TargetIndustry: 10, TargetHousing: 30}
+
+func buildingCategory(name string) string {
+	switch name {
+	case "urban_housing":
+		return TargetHousing
+	case "defense_battery":
+		return TargetDefenses
+	}
+	return TargetIndustry
+}
+
+func validBombTarget(t string) bool {
+	return t == TargetIndustry || t == TargetDefenses || t == TargetHousing
+}
+
+type StrikeReport struct {
+	ID         int            `json:"id"`
+	Tick       int64          `json:"tick"`
+	SystemID   string         `json:"system_id"`
+	ColonyID   int            `json:"colony_id"`
+	Attacker   string         `json:"attacker_uuid"`
+	Defender   string         `json:"defender_uuid"`
+	FleetID    int            `json:"fleet_id"`
+	Target     string         `json:"target"`
+	Accuracy   float64        `json:"accuracy"`
+	Destroyed  map[string]int `json:"destroyed"`
+	OnTarget   int            `json:"on_target"`
+	Collateral int            `json:"collateral"`
+	Casualties int            `json:"casualties"`
+	Infamy     int            `json:"infamy"`
+	Refugees   int            `json:"refugees"` // laborers who fled (see refugees.go)
+}
+
+func bombAccuracy(batteries int) float64 {
+	acc := BombBaseAccuracy - BatteryAccuracyPenalty*float64(batteries)
+	if acc < MinBombAccuracy {
+		acc = MinBombAccuracy
+	}
+	return acc
+}
+
+// Picks a standing building, weighted by count; only from category unless it is empty
+func pickBuilding(buildings map[string]int, category string, rng *mrand.Rand) string {
+	names := make([]string, 0, len(buildings))
+	total := 0
+	for name, n := range buildings {
+		if n > 0 && (category == "" || buildingCategory(name) == category) {
+			names = append(names, name)
+			total += n
+		}
+	}
+	if total == 0 {
+		return ""
+	}
+	sort.Strings(names) // map order must not leak into a replayable result
+	roll := rng.Intn(total)
+	for _, name := range names {
+		roll -= buildings[name]
+		if roll < 0 {
+			return name
+		}
+	}
+	return names[len(names)-1]
+}
+
+// Resolves one strike against buildings (mutated in place) and returns what was lost
+func planBombardment(buildings map[string]int, target string, shots int, pop int, rng *mrand.Rand) StrikeReport {
+	rep := StrikeReport{Target: target, Accuracy: bombAccuracy(buildings["defense_battery"]), Destroyed: make(map[string]int)}
+	for i := 0; i < shots; i++ {
+		hit := ""
+		if rng.Float64() < rep.Accuracy {
+			hit = pickBuilding(buildings, target, rng)
+		}
+		if hit == "" {
+			hit = pickBuilding(buildings, "", rng)
+		}
+		if hit == "" {
+			break
+		}
+		buildings[hit]--
+		rep.Destroyed[hit]++
+		cat := buildingCategory(hit)
+		if cat == target {
+			rep.OnTarget++
+		} else {
+			rep.Collateral++
+		}
+		rep.Infamy += BombInfamy[cat]
+		if cat == TargetHousing {
+			rep.Casualties += CasualtiesPerHousing
+		}
+	}
+	if rep.Casualties > pop {
+		rep.Casualties = pop
+	}
+	rep.Infamy += rep.Casualties / 10
+	return rep
+}
+
+func resolveBombardment(currentTick int64) {
+	bRows, _ := db.Query(`SELECT f.id, f.owner_uuid, f.origin_system, f.modules_json, COALESCE(f.bombard_target, '')
+	                      FROM fleets f 
+	                      WHERE f.status='ORBIT' AND f.modules_json LIKE '%bomb_bay%'`)
+	var bombers []Fleet
+	var targets []string
+	for bRows.Next() {
+		var f Fleet
+		var modJson, target string
+		bRows.Scan(&f.ID, &f.OwnerUUID, &f.OriginSystem, &modJson, &target)
+		json.Unmarshal([]byte(modJson), &f.Modules)
+		bombers = append(bombers, f)
+		targets = append(targets, target)
+	}
+	bRows.Close()
+
+	for i, f := range bombers {
+		var colID, pop int
+		var colOwner, bJson string
+		err := db.QueryRow("SELECT id, owner_uuid, buildings_json, pop_laborers FROM colonies WHERE system_id=? AND COALESCE(site_type, 'planet')='planet'", f.OriginSystem).Scan(&colID, &colOwner, &bJson, &pop)
+		if err != nil || colOwner == f.OwnerUUID {
+			continue
+		}
+
+		bays := 0
+		for _, m := range f.Modules {
+			if m == "bomb_bay" {
+				bays++
+			}
+		}
+		target := targets[i]
+		if !validBombTarget(target) {
+			target = TargetIndustry
+		}
+
+		buildings := make(map[string]int)
+		json.Unmarshal([]byte(bJson), &buildings)
+		rng := battleRNG(fmt.Sprintf("%s:bomb:%d", f.OriginSystem, f.ID), currentTick)
+		rep := planBombardment(buildings, target, bays*BombsPerBay, pop, rng)
+		destroyed := rep.OnTarget + rep.Collateral
+		if destroyed == 0 {
+			continue
+		}
+
+		rep.Tick, rep.SystemID, rep.ColonyID = currentTick, f.OriginSystem, colID
+		rep.Attacker, rep.Defender, rep.FleetID = f.OwnerUUID, colOwner, f.ID
+
+		newBJson, _ := json.Marshal(buildings)
+		db.Exec("UPDATE colonies SET buildings_json=?, pop_laborers=pop_laborers-? WHERE id=?", string(newBJson), rep.Casualties, colID)
+		shock := BombardmentShock
+		if rep.Casualties > 0 {
+			shock += CasualtyShock
+		}
+		rep.Refugees = warShock(colID, shock, BombardmentRefugeeShare, "bombardment", currentTick)
+		InfoLog.Printf("🔥 Colony %d bombarded by Fleet %d (%s). %d structures lost, %d casualties.", colID, f.ID, target, destroyed, rep.Casualties)
+
+		if rep.Destroyed["trading_post"] > 0 && buildings["trading_post"] == 0 {
+			voidSystemListings(f.OriginSystem)
+		}
+
+		repJson, _ := json.Marshal(rep)
+		db.Exec("INSERT INTO bombardment_reports (tick, colony_id, attacker_uuid, defender_uuid, report_json) VALUES (?, ?, ?, ?, ?)",
+			currentTick, colID, f.OwnerUUID, colOwner, string(repJson))
+
+		reportGrievance(f.OwnerUUID, colOwner, rep.Infamy)
+		emitEvent(colOwner, EventColonyAttacked, map[string]interface{}{
+			"colony_id": colID, "system_id": f.OriginSystem, "attacker": f.OwnerUUID,
+			"fleet_id": f.ID, "target": target, "structures_lost": destroyed, "casualties": rep.Casualties,
+		})
+	}
+}
+
+// POST {"fleet_id", "target"}: what the fleet's bombers aim for (industry, defenses, housing)
+func handleBombardTarget(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	var req struct {
+		FleetID int    `json:"fleet_id" validate:"required"`
+		Target  string `json:"target" validate:"required"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+	req.Target = strings.ToLower(req.Target)
+	if !validBombTarget(req.Target) {
+		http.Error(w, "Invalid Target (industry, defenses, housing)", 400)
+		return
+	}
+
+	defer lockRows(userRow(userID))()
+
+	var owner string
+	if err := db.QueryRow("SELECT owner_uuid FROM fleets WHERE id=?", req.FleetID).Scan(&owner); err != nil {
+		http.Error(w, "Fleet Not Found", 404)
+		return
+	}
+	if owner != userID {
+		http.Error(w, "Not your fleet", 403)
+		return
+	}
+
+	db.Exec("UPDATE fleets SET bombard_target=? WHERE id=?", req.Target, req.FleetID)
+	w.Write([]byte("Bombardment Target Set"))
+}
+
+// Strike reports where the user was attacker or defender, newest first
+func handleBombardmentReports(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	rows, err := db.Query(`SELECT id, report_json FROM bombardment_reports
+	                       WHERE attacker_uuid=? OR defender_uuid=? ORDER BY id DESC LIMIT 50`, userID, userID)
+	if err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+	defer rows.Close()
+
+	reports := []StrikeReport{}
+	for rows.Next() {
+		var id int
+		var rJson string
+		rows.Scan(&id, &rJson)
+		var sr StrikeReport
+		json.Unmarshal([]byte(rJson), &sr)
+		sr.ID = id
+		reports = append(reports, sr)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reports)
+}
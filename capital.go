@@ -0,0 +1,118 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sync/atomic"
+)
+
+// --- Capitals & Corruption ---
+// Each empire rules from a capital: the colony its owner designated, or its oldest colony.
+// Inside CommandRadius of the capital administration is free. Beyond it, corruption grows
+// with 3D distance and skims that share off the colony's extraction, industry and taxes.
+// Admin offices and a specialist workforce cut how much of it actually bites.
+
+const (
+	CommandRadius       = 20.0
+	CorruptionPerUnit   = 0.01 // per unit of distance beyond the radius
+	MaxCorruption       = 0.6
+	AdminOfficeRelief   = 0.1 // share of corruption removed per admin_office
+	SpecialistRelief    = 1.0 // share removed per unit of specialist population share
+	MaxCorruptionRelief = 0.8
+	CapitalMoveCooldown = 500 // ticks between capital moves
+)
+
+type ColonyCorruption struct {
+	ColonyID   int     `json:"colony_id"`
+	Name       string  `json:"name"`
+	Distance   float64 `json:"distance"`
+	Corruption float64 `json:"corruption"`
+}
+
+// Share of a colony's output lost to distance from its capital
+func corruption(c *Colony, pos []int, capital capitalInfo, hasCapital bool) float64 {
+	if !hasCapital || c.ID == capital.ColonyID || isFreeFaction(c.OwnerUUID) || c.OwnerUUID == PirateOwnerUUID {
+		return 0
+	}
+	beyond := distance3(pos, capital.Pos) - CommandRadius
+	if beyond <= 0 {
+		return 0
+	}
+	raw := math.Min(MaxCorruption, beyond*CorruptionPerUnit)
+
+	relief := AdminOfficeRelief * float64(c.Buildings["admin_office"])
+	if pop := c.PopLaborers + c.PopSpecialists + c.PopElites; pop > 0 {
+		relief += SpecialistRelief * float64(c.PopSpecialists) / float64(pop)
+	}
+	return raw * (1 - math.Min(MaxCorruptionRelief, relief))
+}
+
+// GET: your capital and every colony's corruption. POST {"colony_id"}: move the capital there.
+func handleCapital(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var req struct {
+			ColonyID int `json:"colony_id" validate:"required"`
+		}
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+
+		defer lockRows(userRow(userID))()
+
+		var owner, name string
+		err = db.QueryRow("SELECT owner_uuid, name FROM colonies WHERE id=?", req.ColonyID).Scan(&owner, &name)
+		if err != nil || owner != userID {
+			http.Error(w, "Colony Not Found", 404)
+			return
+		}
+		var moved sql.NullInt64
+		db.QueryRow("SELECT capital_moved_tick FROM users WHERE global_uuid=?", userID).Scan(&moved)
+		now := atomic.LoadInt64(&CurrentTick)
+		if moved.Valid && now-moved.Int64 < CapitalMoveCooldown {
+			http.Error(w, fmt.Sprintf("Capital moved recently; wait %d ticks", CapitalMoveCooldown-(now-moved.Int64)), 429)
+			return
+		}
+		db.Exec("UPDATE users SET capital_colony_id=?, capital_moved_tick=? WHERE global_uuid=?", req.ColonyID, now, userID)
+		InfoLog.Printf("🏛️ %s moved their capital to colony %d", userID, req.ColonyID)
+	}
+
+	capital, hasCapital := loadCapitals()[userID]
+	rows, err := db.Query(`SELECT c.id, c.name, c.buildings_json, c.pop_laborers, c.pop_specialists, c.pop_elites,
+	                       COALESCE(s.x, 0), COALESCE(s.y, 0), COALESCE(s.z, 0)
+	                       FROM colonies c LEFT JOIN solar_systems s ON s.id = c.system_id WHERE c.owner_uuid=?`, userID)
+	if err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+	defer rows.Close()
+	list := []ColonyCorruption{}
+	for rows.Next() {
+		c := Colony{OwnerUUID: userID}
+		var bJson string
+		var x, y, z int
+		rows.Scan(&c.ID, &c.Name, &bJson, &c.PopLaborers, &c.PopSpecialists, &c.PopElites, &x, &y, &z)
+		json.Unmarshal([]byte(bJson), &c.Buildings)
+		pos := []int{x, y, z}
+		cc := ColonyCorruption{ColonyID: c.ID, Name: c.Name, Corruption: corruption(&c, pos, capital, hasCapital)}
+		if hasCapital {
+			cc.Distance = distance3(pos, capital.Pos)
+		}
+		list = append(list, cc)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"capital_colony_id": capital.ColonyID,
+		"colonies":          list,
+	})
+}
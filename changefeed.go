@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// --- Federation Change Feed ---
+// Daily snapshots (/federation/sync) are how mirrors catch up; the change feed keeps them
+// current in between. At the end of every tick the node diffs its public state against the
+// previous tick and appends a compact record per thing that changed:
+//
+//	colony  a colony's owner, name, system, buildings or population ("removed" when it's gone)
+//	system  a charted system's owner or name (claims, independence, naming)
+//	order   a market order listed, changed, filled or expired
+//
+// Diffing the tables rather than hooking every write means nothing that changes public state
+// can forget to report it. GET /federation/changes?since_tick=N returns the records after tick
+// N, whole ticks at a time, for signed peers (not hostile ones) or the operator's admin key.
+// Records are kept for ChangeFeedRetention ticks; a mirror further behind gets 410 and goes
+// back to the snapshots. The diff baseline lives in memory, so after a restart the first record
+// is a "resync": changes made while the node was down can't be reconstructed.
+
+const (
+	ChangeFeedRetention = 2 * TicksPerDay
+	ChangeFeedPageSize  = 1000
+)
+
+const (
+	ChangeColony = "colony"
+	ChangeSystem = "system"
+	ChangeOrder  = "order"
+	ChangeResync = "resync"
+)
+
+type ChangeRecord struct {
+	Tick    int64           `json:"tick"`
+	Kind    string          `json:"kind"`
+	ID      string          `json:"id,omitempty"`
+	Removed bool            `json:"removed,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// What a mirror sees of a colony; stockpiles stay in the daily snapshots
+type PublicColony struct {
+	ID             int            `json:"id"`
+	SystemID       string         `json:"system_id"`
+	OwnerUUID      string         `json:"owner_uuid"`
+	Name           string         `json:"name"`
+	Buildings      map[string]int `json:"buildings"`
+	PopLaborers    int            `json:"pop_laborers"`
+	PopSpecialists int            `json:"pop_specialists"`
+	PopElites      int            `json:"pop_elites"`
+}
+
+// Last tick's public state, encoded, by kind then ID
+var changeFeed struct {
+	sync.Mutex
+	state map[string]map[string]string
+}
+
+func publicState() (map[string]map[string]string, error) {
+	state := map[string]map[string]string{ChangeColony: {}, ChangeSystem: {}, ChangeOrder: {}}
+
+	rows, err := db.Query("SELECT id, system_id, owner_uuid, COALESCE(name, ''), buildings_json, pop_laborers, pop_specialists, pop_elites FROM colonies")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var c PublicColony
+		var bJson string
+		rows.Scan(&c.ID, &c.SystemID, &c.OwnerUUID, &c.Name, &bJson, &c.PopLaborers, &c.PopSpecialists, &c.PopElites)
+		json.Unmarshal([]byte(bJson), &c.Buildings)
+		enc, _ := json.Marshal(c)
+		state[ChangeColony][strconv.Itoa(c.ID)] = string(enc)
+	}
+	rows.Close()
+
+	for _, s := range allSystems() {
+		enc, _ := json.Marshal(MapSystem{ID: s.ID, X: s.X, Y: s.Y, Z: s.Z, Type: s.Type, Owner: s.Owner, Name: s.Name})
+		state[ChangeSystem][s.ID] = string(enc)
+	}
+
+	rows, err = db.Query(`SELECT order_id, seller_uuid, item, quantity, price, is_buy, origin_system, expires_tick, COALESCE(NULLIF(origin_node, ''), ?)
+	                      FROM market_orders`, ServerUUID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var o MarketOrder
+		rows.Scan(&o.ID, &o.SellerUUID, &o.Item, &o.Quantity, &o.Price, &o.IsBuy, &o.OriginSystem, &o.ExpiresTick, &o.Node)
+		enc, _ := json.Marshal(o)
+		state[ChangeOrder][o.ID] = string(enc)
+	}
+	rows.Close()
+	return state, nil
+}
+
+// Records diffed against the previous state, colonies then systems then orders, by ID
+func diffPublicState(tick int64, prev, curr map[string]map[string]string) []ChangeRecord {
+	var out []ChangeRecord
+	for _, kind := range []string{ChangeColony, ChangeSystem, ChangeOrder} {
+		var changed []ChangeRecord
+		for id, enc := range curr[kind] {
+			if prev[kind][id] != enc {
+				changed = append(changed, ChangeRecord{Tick: tick, Kind: kind, ID: id, Data: json.RawMessage(enc)})
+			}
+		}
+		for id := range prev[kind] {
+			if _, ok := curr[kind][id]; !ok {
+				changed = append(changed, ChangeRecord{Tick: tick, Kind: kind, ID: id, Removed: true})
+			}
+		}
+		sortChanges(changed)
+		out = append(out, changed...)
+	}
+	return out
+}
+
+// Numeric IDs (colonies) in numeric order, the rest lexically
+func sortChanges(list []ChangeRecord) {
+	sort.Slice(list, func(i, j int) bool {
+		a, errA := strconv.Atoi(list[i].ID)
+		b, errB := strconv.Atoi(list[j].ID)
+		if errA == nil && errB == nil {
+			return a < b
+		}
+		return list[i].ID < list[j].ID
+	})
+}
+
+// Called at the end of the tick; the first call after boot only sets the baseline
+func recordChanges(tick int64) {
+	curr, err := publicState()
+	if err != nil {
+		ErrorLog.Printf("Change feed: %v", err)
+		return
+	}
+
+	changeFeed.Lock()
+	prev := changeFeed.state
+	changeFeed.state = curr
+	changeFeed.Unlock()
+
+	var changes []ChangeRecord
+	if prev == nil {
+		changes = []ChangeRecord{{Tick: tick, Kind: ChangeResync}}
+	} else {
+		changes = diffPublicState(tick, prev, curr)
+	}
+	if len(changes) == 0 {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+	stmt, _ := tx.Prepare("INSERT INTO federation_changes (tick, kind, subject, removed, data_json) VALUES (?, ?, ?, ?, ?)")
+	for _, c := range changes {
+		stmt.Exec(c.Tick, c.Kind, c.ID, c.Removed, string(c.Data))
+	}
+	stmt.Close()
+	tx.Commit()
+}
+
+func pruneChanges(tick int64) {
+	db.Exec("DELETE FROM federation_changes WHERE tick <= ?", tick-ChangeFeedRetention)
+}
+
+// Records after sinceTick: whole ticks, up to about limit records
+func loadChanges(sinceTick int64, limit int) ([]ChangeRecord, error) {
+	list, err := queryChanges("WHERE tick > ? ORDER BY id LIMIT ?", sinceTick, limit+1)
+	if err != nil || len(list) <= limit {
+		return list, err
+	}
+
+	// Don't split the last tick: drop it, unless it is the only one, then send all of it
+	last := list[len(list)-1].Tick
+	if list[0].Tick != last {
+		for len(list) > 0 && list[len(list)-1].Tick == last {
+			list = list[:len(list)-1]
+		}
+		return list, nil
+	}
+	return queryChanges("WHERE tick = ? ORDER BY id", last)
+}
+
+func queryChanges(where string, args ...interface{}) ([]ChangeRecord, error) {
+	rows, err := db.Query("SELECT tick, kind, subject, removed, data_json FROM federation_changes "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []ChangeRecord
+	for rows.Next() {
+		var c ChangeRecord
+		var data string
+		rows.Scan(&c.Tick, &c.Kind, &c.ID, &c.Removed, &data)
+		if data != "" {
+			c.Data = json.RawMessage(data)
+		}
+		list = append(list, c)
+	}
+	return list, nil
+}
+
+// GET ?since_tick=N[&limit=] returns {"changes", "next_since_tick", "tick", "more"}
+func handleFederationChanges(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	if sender := r.Header.Get(HeaderFedNode); sender != "" {
+		peerLock.RLock()
+		peer, known := Peers[sender]
+		hostile := known && peer.Relation == 2
+		peerLock.RUnlock()
+		if hostile {
+			http.Error(w, "Forbidden", 403)
+			return
+		}
+	}
+
+	sinceTick, err := strconv.ParseInt(r.URL.Query().Get("since_tick"), 10, 64)
+	if err != nil || sinceTick < 0 {
+		http.Error(w, "Bad Request: since_tick", 400)
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 || limit > ChangeFeedPageSize {
+		limit = ChangeFeedPageSize
+	}
+
+	tick := atomic.LoadInt64(&CurrentTick)
+	if sinceTick < tick-ChangeFeedRetention {
+		http.Error(w, fmt.Sprintf("Changes before tick %d are gone; resync from /federation/sync", tick-ChangeFeedRetention), 410)
+		return
+	}
+
+	changes, err := loadChanges(sinceTick, limit)
+	if err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+	next := sinceTick
+	if len(changes) > 0 {
+		next = changes[len(changes)-1].Tick
+	}
+	var more int
+	db.QueryRow("SELECT count(*) FROM federation_changes WHERE tick > ?", next).Scan(&more)
+	if changes == nil {
+		changes = []ChangeRecord{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"changes": changes, "next_since_tick": next, "tick": tick, "more": more > 0,
+	})
+}
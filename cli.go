@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// --- Operator Commands ---
+// The server binary doubles as the operator's tool. `ownworld serve` (or no command at all)
+// runs the node; the other commands work on its database and exit. They open the same file
+// through the same schema code the server uses (createSchema brings an older database up to
+// date first), so there is no second copy of the schema to fall behind. --universe picks the
+// database as it does for serve. They are safe next to a running node: WAL lets them read
+// alongside it, and backup copies a consistent snapshot with VACUUM INTO.
+//
+//	ownworld users list       accounts on this node
+//	ownworld peers            the stored peer registry
+//	ownworld backup FILE      snapshot the database to FILE
+
+type operatorCommand struct {
+	usage string
+	run   func(args []string, out io.Writer) error
+}
+
+var operatorCommands = map[string]operatorCommand{
+	"users":  {"users list", cmdUsers},
+	"peers":  {"peers", cmdPeers},
+	"backup": {"backup FILE", cmdBackup},
+}
+
+func operatorUsage() string {
+	names := make([]string, 0, len(operatorCommands))
+	for name := range operatorCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lines := []string{"usage: ownworld [--universe NAME] [serve [--port P]]"}
+	for _, name := range names {
+		lines = append(lines, "       ownworld [--universe NAME] "+operatorCommands[name].usage)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Runs a command other than serve against this universe's database
+func runOperatorCommand(args []string, out io.Writer) error {
+	cmd, ok := operatorCommands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q\n%s", args[0], operatorUsage())
+	}
+	if db == nil {
+		if err := openOperatorDB(); err != nil {
+			return err
+		}
+		defer db.Close()
+	}
+	return cmd.run(args[1:], out)
+}
+
+// Opens the node's existing database; a command never creates one (or an identity)
+func openOperatorDB() error {
+	if _, err := os.Stat(DBPath); err != nil {
+		return fmt.Errorf("no database at %s (start the node once, or pick a universe with --universe)", DBPath)
+	}
+	InfoLog = log.New(io.Discard, "", 0)
+	ErrorLog = log.New(os.Stderr, "ERROR: ", 0)
+	DebugLog = log.New(io.Discard, "", 0)
+
+	var err error
+	db, err = openDB("sqlite3", DBPath+"?_journal_mode=WAL&_busy_timeout=1000&_txlock=immediate", 1)
+	if err != nil {
+		return err
+	}
+	if err := createSchema(); err != nil {
+		db.Close()
+		return fmt.Errorf("schema: %v", err)
+	}
+	return nil
+}
+
+func cmdUsers(args []string, out io.Writer) error {
+	if len(args) != 1 || args[0] != "list" {
+		return fmt.Errorf("usage: ownworld users list")
+	}
+	rows, err := db.Query(`SELECT u.username, u.global_uuid, u.credits, u.is_local, COALESCE(u.created_at, 0),
+	                           (SELECT count(*) FROM colonies c WHERE c.owner_uuid = u.global_uuid)
+	                       FROM users u ORDER BY u.id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "USERNAME\tUUID\tCREDITS\tCOLONIES\tLOCAL\tCREATED")
+	for rows.Next() {
+		var name, uuid string
+		var credits, colonies int
+		var local bool
+		var created int64
+		if err := rows.Scan(&name, &uuid, &credits, &local, &created, &colonies); err != nil {
+			return err
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%v\t%s\n", name, uuid, credits, colonies, local, formatUnix(created))
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return tw.Flush()
+}
+
+func cmdPeers(args []string, out io.Writer) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: ownworld peers")
+	}
+	rows, err := db.Query("SELECT " + peerColumns + " FROM peers ORDER BY last_seen DESC")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "UUID\tURL\tRELATION\tREPUTATION\tLAST SEEN")
+	for rows.Next() {
+		p, err := scanPeer(rows.Scan)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%.1f\t%s\n", p.UUID, p.Url, relationLabels[p.Relation], p.Reputation, formatUnix(p.LastSeen.Unix()))
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return tw.Flush()
+}
+
+func cmdBackup(args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: ownworld backup FILE")
+	}
+	dest := args[0]
+	if _, err := os.Stat(dest); err == nil {
+		return fmt.Errorf("%s already exists", dest)
+	}
+	if _, err := db.Exec("VACUUM INTO ?", dest); err != nil {
+		return fmt.Errorf("backup: %v", err)
+	}
+	info, err := os.Stat(dest)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Backed up %s to %s (%d bytes)\n", DBPath, dest, info.Size())
+	return nil
+}
+
+var relationLabels = map[int]string{0: "neutral", 1: "federated", 2: "hostile"}
+
+func formatUnix(ts int64) string {
+	if ts <= 0 {
+		return "-"
+	}
+	return time.Unix(ts, 0).UTC().Format("2006-01-02 15:04")
+}
@@ -0,0 +1,421 @@
+// Command loadtest drives a node (or several nodes of one federation) with synthetic players
+// and reports how it held up: latency percentiles per action and tick slippage per node.
+//
+// Each bot registers its own account on one of the nodes (round robin), reads its state once
+// to learn its colony, fleet and position, then loops over a weighted mix of what players do:
+// polling state, scanning nearby sectors, building, estimating routes, browsing and placing
+// market orders. Bots start spread over -ramp and pause -think (±50%) between actions.
+//
+// Tick slippage is how much later than its nominal length (tick_duration_ms from /api/status)
+// each observed tick arrived; a node whose tick can't keep up with the load shows it here
+// first. Ticks are minutes long, so run long enough to see several.
+//
+//	go run ./cmd/loadtest -url http://localhost:8080 -players 200 -duration 5m
+//
+// -max-p99, -max-slip and -max-errors turn the report into a gate: the command exits 1 when
+// any is exceeded, so a release check can run it against a staging node.
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	mrand "math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"ownworld/pkg/client"
+)
+
+const defaultMix = "state=35,scan=15,status=10,build=10,estimate=10,market=10,order=5,events=5"
+
+type options struct {
+	urls      []string
+	players   int
+	duration  time.Duration
+	ramp      time.Duration
+	think     time.Duration
+	mix       []weighted
+	maxP99    time.Duration
+	maxSlip   time.Duration
+	maxErrors float64
+}
+
+type weighted struct {
+	action string
+	weight int
+}
+
+// One synthetic player
+type bot struct {
+	api      *client.Client
+	rng      *mrand.Rand
+	colonyID int
+	fleetID  int
+	systemID string
+	location []int
+}
+
+type action func(b *bot) error
+
+var actions = map[string]action{
+	"state": func(b *bot) error {
+		_, err := b.api.State()
+		return err
+	},
+	"status": func(b *bot) error {
+		_, err := b.api.Status()
+		return err
+	},
+	"events": func(b *bot) error {
+		_, err := b.api.Events()
+		return err
+	},
+	"scan": func(b *bot) error {
+		x, y, z := b.near(20)
+		_, err := b.api.Scan(x, y, z)
+		return err
+	},
+	"build": func(b *bot) error {
+		_, err := b.api.Build(b.colonyID, "farm", 1)
+		return err
+	},
+	"estimate": func(b *bot) error {
+		if b.fleetID == 0 {
+			return nil
+		}
+		x, y, z := b.near(10)
+		_, err := b.api.EstimateRoute(b.fleetID, fmt.Sprintf("sys-%d-%d-%d", x, y, z))
+		return err
+	},
+	"market": func(b *bot) error {
+		_, err := b.api.ListOrders()
+		return err
+	},
+	"order": func(b *bot) error {
+		_, err := b.api.PlaceOrder(client.Order{Item: "food", Quantity: 10, Price: 5 + b.rng.Intn(10), OriginSystem: b.systemID})
+		return err
+	},
+}
+
+// Refusals the game gives in normal play (not enough resources, no route) count as answers
+func gameRefusal(err error) bool {
+	var apiErr *client.APIError
+	return errors.As(err, &apiErr) && apiErr.Status >= 400 && apiErr.Status < 500 && apiErr.Status != 401 && apiErr.Status != 429
+}
+
+func (b *bot) near(radius int) (int, int, int) {
+	off := func() int { return b.rng.Intn(2*radius+1) - radius }
+	if len(b.location) != 3 {
+		return off(), off(), off()
+	}
+	return b.location[0] + off(), b.location[1] + off(), b.location[2] + off()
+}
+
+func (b *bot) pick(mix []weighted, total int) string {
+	n := b.rng.Intn(total)
+	for _, w := range mix {
+		if n < w.weight {
+			return w.action
+		}
+		n -= w.weight
+	}
+	return mix[len(mix)-1].action
+}
+
+type sample struct {
+	latency time.Duration
+	failed  bool
+	refused bool
+}
+
+type recorder struct {
+	sync.Mutex
+	samples map[string][]sample
+}
+
+func (r *recorder) add(name string, s sample) {
+	r.Lock()
+	r.samples[name] = append(r.samples[name], s)
+	r.Unlock()
+}
+
+// Per node: when each tick was first seen and the nominal tick length
+type tickWatch struct {
+	url     string
+	seen    map[int64]time.Time
+	nominal time.Duration
+}
+
+func watchTicks(api *client.Client, w *tickWatch, stop <-chan struct{}) {
+	t := time.NewTicker(250 * time.Millisecond)
+	defer t.Stop()
+	for {
+		if s, err := api.Status(); err == nil {
+			if _, ok := w.seen[s.Tick]; !ok {
+				w.seen[s.Tick] = time.Now()
+			}
+			if s.TickDurationMS > 0 {
+				w.nominal = time.Duration(s.TickDurationMS) * time.Millisecond
+			}
+		}
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// How late each fully observed tick was against the nominal length (the first sighting only
+// bounds the start, so the first interval is skipped)
+func (w *tickWatch) slippage() []time.Duration {
+	ticks := make([]int64, 0, len(w.seen))
+	for t := range w.seen {
+		ticks = append(ticks, t)
+	}
+	sort.Slice(ticks, func(i, j int) bool { return ticks[i] < ticks[j] })
+	var out []time.Duration
+	for i := 2; i < len(ticks); i++ {
+		gap := w.seen[ticks[i]].Sub(w.seen[ticks[i-1]])
+		steps := ticks[i] - ticks[i-1]
+		late := gap - time.Duration(steps)*w.nominal
+		if late < 0 {
+			late = 0
+		}
+		out = append(out, late)
+	}
+	return out
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted)-1) * p)
+	return sorted[i]
+}
+
+func parseMix(spec string) ([]weighted, error) {
+	var mix []weighted
+	for _, part := range strings.Split(spec, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("mix: %q is not action=weight", part)
+		}
+		if _, ok := actions[kv[0]]; !ok {
+			return nil, fmt.Errorf("mix: unknown action %q", kv[0])
+		}
+		n, err := strconv.Atoi(kv[1])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("mix: bad weight for %s", kv[0])
+		}
+		if n > 0 {
+			mix = append(mix, weighted{kv[0], n})
+		}
+	}
+	if len(mix) == 0 {
+		return nil, fmt.Errorf("mix: no actions")
+	}
+	return mix, nil
+}
+
+func parseOptions(args []string) (options, error) {
+	fs := flag.NewFlagSet("loadtest", flag.ContinueOnError)
+	urls := fs.String("url", "http://localhost:8080", "Node URL; comma-separate several nodes of one federation")
+	o := options{}
+	fs.IntVar(&o.players, "players", 100, "Synthetic players")
+	fs.DurationVar(&o.duration, "duration", 5*time.Minute, "How long to run after the ramp")
+	fs.DurationVar(&o.ramp, "ramp", 30*time.Second, "Spread bot start-up over this long")
+	fs.DurationVar(&o.think, "think", time.Second, "Mean pause between a bot's actions")
+	mix := fs.String("mix", defaultMix, "Action weights")
+	fs.DurationVar(&o.maxP99, "max-p99", 0, "Fail if any action's p99 latency exceeds this (0 = off)")
+	fs.DurationVar(&o.maxSlip, "max-slip", 0, "Fail if any tick arrives later than this (0 = off)")
+	fs.Float64Var(&o.maxErrors, "max-errors", 0, "Fail if more than this share of actions error (0 = off)")
+	if err := fs.Parse(args); err != nil {
+		return o, err
+	}
+	for _, u := range strings.Split(*urls, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			o.urls = append(o.urls, u)
+		}
+	}
+	if len(o.urls) == 0 || o.players <= 0 {
+		return o, fmt.Errorf("need at least one -url and one player")
+	}
+	var err error
+	o.mix, err = parseMix(*mix)
+	return o, err
+}
+
+func main() {
+	o, err := parseOptions(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if !run(o, os.Stdout) {
+		os.Exit(1)
+	}
+}
+
+func newClient(url string, transport http.RoundTripper) *client.Client {
+	api := client.New(url)
+	api.HTTP = &http.Client{Timeout: 30 * time.Second, Transport: transport}
+	api.MaxRetries = 0 // a retry would hide the latency we're measuring
+	return api
+}
+
+// Runs the test and writes the report; false if a threshold was exceeded
+func run(o options, out io.Writer) bool {
+	transport := &http.Transport{MaxIdleConns: o.players * 2, MaxIdleConnsPerHost: o.players * 2, IdleConnTimeout: time.Minute}
+	runID := make([]byte, 3)
+	rand.Read(runID)
+
+	stop := make(chan struct{})
+	watches := make([]*tickWatch, len(o.urls))
+	var watchers sync.WaitGroup
+	for i, u := range o.urls {
+		watches[i] = &tickWatch{url: u, seen: make(map[int64]time.Time), nominal: time.Minute}
+		watchers.Add(1)
+		go func(api *client.Client, w *tickWatch) {
+			defer watchers.Done()
+			watchTicks(api, w, stop)
+		}(newClient(u, transport), watches[i])
+	}
+
+	rec := &recorder{samples: make(map[string][]sample)}
+	total := 0
+	for _, w := range o.mix {
+		total += w.weight
+	}
+	deadline := time.Now().Add(o.ramp + o.duration)
+	fmt.Fprintf(out, "Starting %d players against %s for %s (+%s ramp)\n", o.players, strings.Join(o.urls, ", "), o.duration, o.ramp)
+
+	var bots sync.WaitGroup
+	for i := 0; i < o.players; i++ {
+		bots.Add(1)
+		go func(i int) {
+			defer bots.Done()
+			rng := mrand.New(mrand.NewSource(time.Now().UnixNano() + int64(i)))
+			time.Sleep(time.Duration(float64(o.ramp) * float64(i) / float64(o.players)))
+
+			b := &bot{api: newClient(o.urls[i%len(o.urls)], transport), rng: rng}
+			name := fmt.Sprintf("lt%s_%d", hex.EncodeToString(runID), i)
+			start := time.Now()
+			s, err := b.api.Register(name, hex.EncodeToString(runID)+name)
+			rec.add("register", sample{latency: time.Since(start), failed: err != nil})
+			if err != nil {
+				return
+			}
+			b.systemID, b.location = s.SystemID, s.Location
+			if st, err := b.api.State(); err == nil {
+				if len(st.Colonies) > 0 {
+					b.colonyID = st.Colonies[0].ID
+				}
+				if len(st.Fleets) > 0 {
+					b.fleetID = st.Fleets[0].ID
+				}
+			}
+
+			for time.Now().Before(deadline) {
+				name := b.pick(o.mix, total)
+				start := time.Now()
+				err := actions[name](b)
+				rec.add(name, sample{latency: time.Since(start), failed: err != nil && !gameRefusal(err), refused: gameRefusal(err)})
+				time.Sleep(time.Duration(float64(o.think) * (0.5 + rng.Float64())))
+			}
+		}(i)
+	}
+	bots.Wait()
+	close(stop)
+	watchers.Wait()
+
+	return report(o, rec, watches, out)
+}
+
+func report(o options, rec *recorder, watches []*tickWatch, out io.Writer) bool {
+	ok := true
+	names := make([]string, 0, len(rec.samples))
+	for name := range rec.samples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "\nACTION\tCOUNT\tERRORS\tREFUSED\tP50\tP90\tP99\tMAX")
+	var all, failed int
+	for _, name := range names {
+		list := rec.samples[name]
+		lat := make([]time.Duration, len(list))
+		errs, refused := 0, 0
+		for i, s := range list {
+			lat[i] = s.latency
+			if s.failed {
+				errs++
+			}
+			if s.refused {
+				refused++
+			}
+		}
+		sort.Slice(lat, func(i, j int) bool { return lat[i] < lat[j] })
+		p99 := percentile(lat, 0.99)
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\t%s\t%s\t%s\n", name, len(list), errs, refused,
+			round(percentile(lat, 0.5)), round(percentile(lat, 0.9)), round(p99), round(lat[len(lat)-1]))
+		all += len(list)
+		failed += errs
+		if o.maxP99 > 0 && p99 > o.maxP99 {
+			ok = false
+		}
+	}
+	tw.Flush()
+	if all > 0 {
+		fmt.Fprintf(out, "%d actions, %.1f/s, %.2f%% errors\n", all, float64(all)/(o.ramp+o.duration).Seconds(), 100*float64(failed)/float64(all))
+		if o.maxErrors > 0 && float64(failed)/float64(all) > o.maxErrors {
+			ok = false
+		}
+	}
+
+	tw = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "\nNODE\tTICKS\tNOMINAL\tMEAN SLIP\tMAX SLIP")
+	for _, w := range watches {
+		slip := w.slippage()
+		var sum, max time.Duration
+		for _, s := range slip {
+			sum += s
+			if s > max {
+				max = s
+			}
+		}
+		mean := time.Duration(0)
+		if len(slip) > 0 {
+			mean = sum / time.Duration(len(slip))
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\n", w.url, len(slip), w.nominal, round(mean), round(max))
+		if o.maxSlip > 0 && max > o.maxSlip {
+			ok = false
+		}
+	}
+	tw.Flush()
+
+	if !ok {
+		fmt.Fprintln(out, "\nFAIL: thresholds exceeded")
+	}
+	return ok
+}
+
+func round(d time.Duration) time.Duration {
+	if d > time.Second {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(10 * time.Microsecond)
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	mrand "math/rand"
+	"net/http"
+	"sort"
+)
+
+// --- Round-Based Combat ---
+// A fleet goes into battle with the structure it has left: hull damage is kept in hull_damage
+// between fights until the fleet is repaired (see damage.go). A fleet that withdraws heads home
+// whether or not it was set to auto-return, and stays in the fight only if it has no way home.
+
+const (
+	MaxCombatRounds = 5
+	// Fleets below this share of their starting structure break off
+	WithdrawThreshold = 0.3
+)
+
+// Veteran crews: survivors earn experience, each level adds a little accuracy and evasion
+const (
+	XPPerBattle          = 10
+	XPPerKill            = 15
+	VeteranAccuracyBonus = 0.03 // per level, added to the attacker's hit chance
+	VeteranEvasionBonus  = 0.02 // per level, subtracted from shots at this fleet
+	RefitXPRetention     = 0.5
+)
+
+// Experience needed for each veterancy level (index = level)
+var VeteranLevels = []int{0, 20, 50, 100, 200}
+
+func veterancy(xp int) int {
+	level := 0
+	for i, need := range VeteranLevels {
+		if xp >= need {
+			level = i
+		}
+	}
+	return level
+}
+
+// Per-weapon hit chance and damage
+var WeaponStats = map[string]struct {
+	Accuracy float64
+	Damage   int
+}{
+	"laser":   {Accuracy: 0.7, Damage: 15},
+	"railgun": {Accuracy: 0.5, Damage: 35},
+}
+
+type combatant struct {
+	Fleet      Fleet
+	HP, MaxHP  int
+	Initiative float64
+	Level      int
+	Kills      int
+	Armed      bool
+	Marines    int  // boarding fleets only (see boarding.go)
+	Out        bool // destroyed, withdrawn or captured
+	Report     *BattleParticipant
+}
+
+// Seeded from system + tick so any node holding the same inputs replays the same battle.
+func battleRNG(sysID string, tick int64) *mrand.Rand {
+	sum, _ := hex.DecodeString(hashBLAKE3([]byte(fmt.Sprintf("%s:%d", sysID, tick))))
+	return mrand.New(mrand.NewSource(int64(binary.BigEndian.Uint64(sum[:8]))))
+}
+
+func resolveBattle(sysID string, fleets []Fleet, tick int64) BattleReport {
+	rng := battleRNG(sysID, tick)
+	report := BattleReport{SystemID: sysID, Tick: tick, Events: []string{}}
+
+	// Stable order keeps the replay deterministic regardless of query order
+	sort.Slice(fleets, func(i, j int) bool { return fleets[i].ID < fleets[j].ID })
+
+	side := make([]*combatant, 0, len(fleets))
+	report.Participants = make([]BattleParticipant, len(fleets))
+	for i, f := range fleets {
+		maxHP := hullIntegrity(f.HullClass)
+		hp := maxHP - f.HullDamage
+		if hp < 1 {
+			hp = 1
+		}
+		c := &combatant{Fleet: f, HP: hp, MaxHP: maxHP, Level: veterancy(f.Experience)}
+		for _, m := range f.Modules {
+			switch m {
+			case "warp_drive":
+				c.Initiative += 2
+			case "booster", "propeller":
+				c.Initiative += 1
+			}
+			if _, ok := WeaponStats[m]; ok || m == "boarding_pod" {
+				c.Armed = true
+			}
+		}
+		if hasModule(f.Modules, "boarding_pod") {
+			c.Marines = f.Payload.PopSpecialists
+		}
+		c.Initiative += rng.Float64() // tie-break
+		report.Participants[i] = BattleParticipant{FleetID: f.ID, OwnerUUID: f.OwnerUUID, HullClass: f.HullClass, StartHP: hp}
+		c.Report = &report.Participants[i]
+		side = append(side, c)
+	}
+
+	sort.SliceStable(side, func(i, j int) bool { return side[i].Initiative > side[j].Initiative })
+
+	for round := 1; round <= MaxCombatRounds; round++ {
+		fired := false
+		for _, attacker := range side {
+			if attacker.Out || !attacker.Armed {
+				continue
+			}
+			target := pickTarget(attacker, side)
+			if target == nil {
+				continue
+			}
+			fired = true
+
+			// Crippled ships are worth more taken than sunk
+			if party := boardingParty(attacker); party > 0 && boardable(target) {
+				attemptBoarding(rng, round, attacker, target, party, &report)
+				continue
+			}
+
+			hitBonus := float64(attacker.Level)*VeteranAccuracyBonus - float64(target.Level)*VeteranEvasionBonus
+			for i, m := range attacker.Fleet.Modules {
+				w, ok := WeaponStats[m]
+				if !ok || target.Out {
+					continue
+				}
+				// Worn weapons miss more (see damage.go)
+				if rng.Float64() < w.Accuracy*conditionAt(attacker.Fleet.Condition, i)+hitBonus {
+					target.HP -= w.Damage
+				}
+			}
+
+			if target.HP <= 0 {
+				target.HP = 0
+				target.Out = true
+				target.Report.Outcome = "destroyed"
+				target.Report.KilledBy = attacker.Fleet.OwnerUUID
+				attacker.Kills++
+				report.Events = append(report.Events, fmt.Sprintf("R%d: Fleet %d destroyed Fleet %d", round, attacker.Fleet.ID, target.Fleet.ID))
+			}
+		}
+
+		// Damaged fleets break off at the end of the round
+		for _, c := range side {
+			if !c.Out && float64(c.HP) < float64(c.MaxHP)*WithdrawThreshold {
+				c.Out = true
+				c.Report.Outcome = "withdrew"
+				report.Events = append(report.Events, fmt.Sprintf("R%d: Fleet %d withdrew (%d/%d)", round, c.Fleet.ID, c.HP, c.MaxHP))
+			}
+		}
+
+		report.Rounds = round
+		if !fired {
+			break
+		}
+	}
+
+	for _, c := range side {
+		c.Report.EndHP = c.HP
+		if c.Report.Outcome == "" {
+			c.Report.Outcome = "held"
+		}
+		if c.Report.Outcome != "destroyed" && c.Report.Outcome != "captured" {
+			c.Report.XPGained = XPPerBattle + c.Kills*XPPerKill
+		}
+	}
+	return report
+}
+
+// Full structure of a hull class
+func hullIntegrity(class string) int {
+	if hp := HullIntegrity[class]; hp > 0 {
+		return hp
+	}
+	return 100
+}
+
+// Escorts protect haulers: unarmed fleets can only be targeted once their side has no armed fleet left.
+func pickTarget(attacker *combatant, side []*combatant) *combatant {
+	var armed, unarmed []*combatant
+	for _, c := range side {
+		if c.Out || c.Fleet.OwnerUUID == attacker.Fleet.OwnerUUID {
+			continue
+		}
+		if c.Armed {
+			armed = append(armed, c)
+		} else {
+			unarmed = append(unarmed, c)
+		}
+	}
+
+	pool := armed
+	if len(pool) == 0 {
+		pool = unarmed
+	}
+	if len(pool) == 0 {
+		return nil
+	}
+
+	// Focus fire on the weakest
+	best := pool[0]
+	for _, c := range pool[1:] {
+		if c.HP < best.HP {
+			best = c
+		}
+	}
+	return best
+}
+
+// Persists the outcome: destroyed fleets left as wrecks, captured ones handed over, grievances filed,
+// survivors keep their damage, those that withdrew or were set to auto-return head home, report stored.
+func applyBattleReport(report BattleReport, fleets []Fleet) {
+	byID := make(map[int]Fleet, len(fleets))
+	for _, f := range fleets {
+		byID[f.ID] = f
+	}
+
+	for _, p := range report.Participants {
+		switch p.Outcome {
+		case "destroyed":
+			InfoLog.Printf("💥 Fleet %d destroyed in %s", p.FleetID, report.SystemID)
+			if f, ok := byID[p.FleetID]; ok {
+				leaveWreck(f, report.SystemID, report.Tick)
+			}
+			db.Exec("DELETE FROM fleets WHERE id=?", p.FleetID)
+			reportGrievance(p.KilledBy, p.OwnerUUID, 100)
+		case "captured":
+			captureFleet(byID[p.FleetID], p, report.SystemID)
+		default:
+			if p.MarinesLost > 0 {
+				spendMarines(byID[p.FleetID], p.MarinesLost)
+			}
+
+			// Experience dies with the ship, so only survivors bank it
+			f := byID[p.FleetID]
+			db.Exec("UPDATE fleets SET experience = COALESCE(experience, 0) + ?, hull_damage=? WHERE id=?",
+				p.XPGained, hullIntegrity(f.HullClass)-p.EndHP, p.FleetID)
+			if wear := battleWear(p); wear > 0 {
+				f.Condition = wornCondition(f.Condition, len(f.Modules), wear)
+				cJson, _ := json.Marshal(f.Condition)
+				db.Exec("UPDATE fleets SET module_condition_json=? WHERE id=?", string(cJson), p.FleetID)
+			}
+
+			// Survivors flagged for auto-return leave the hostile orbit, and so do those that broke off
+			if f.AutoReturn || p.Outcome == "withdrew" {
+				if !sendFleetHome(f, report.SystemID) && p.Outcome == "withdrew" {
+					InfoLog.Printf("🏳️ Fleet %d withdrew but has no way home from %s", p.FleetID, report.SystemID)
+				}
+			}
+		}
+	}
+
+	// Inputs are kept so the battle can be replayed in arbitration (see arbitration.go)
+	reportJson, _ := json.Marshal(report)
+	inputsJson, _ := json.Marshal(fleets)
+	res, err := db.Exec("INSERT INTO battle_reports (system_id, tick, report_json, inputs_json) VALUES (?, ?, ?, ?)",
+		report.SystemID, report.Tick, string(reportJson), string(inputsJson))
+	if err != nil {
+		return
+	}
+	battleID, _ := res.LastInsertId()
+	sides := make(map[string][]BattleParticipant)
+	var owners []string
+	for _, p := range report.Participants {
+		db.Exec("INSERT OR IGNORE INTO battle_participants (battle_id, owner_uuid) VALUES (?, ?)", battleID, p.OwnerUUID)
+		if _, seen := sides[p.OwnerUUID]; !seen {
+			owners = append(owners, p.OwnerUUID)
+		}
+		sides[p.OwnerUUID] = append(sides[p.OwnerUUID], p)
+	}
+	for _, owner := range owners {
+		emitEvent(owner, EventBattle, map[string]interface{}{"battle_id": battleID, "system_id": report.SystemID, "fleets": sides[owner]})
+	}
+}
+
+// Battle reports the user took part in, newest first
+func handleBattleReports(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	rows, err := db.Query(`SELECT b.id, b.report_json FROM battle_reports b
+	                       JOIN battle_participants p ON p.battle_id = b.id
+	                       WHERE p.owner_uuid=? ORDER BY b.id DESC LIMIT 50`, userID)
+	if err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+	defer rows.Close()
+
+	reports := []BattleReport{}
+	for rows.Next() {
+		var id int
+		var rJson string
+		rows.Scan(&id, &rJson)
+		var br BattleReport
+		json.Unmarshal([]byte(rJson), &br)
+		br.ID = id
+		reports = append(reports, br)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reports)
+}
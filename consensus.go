@@ -1,13 +1,14 @@
 package main
 
 import (
-	"bytes"
+	"database/sql"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
 	"sort"
-	"strings" 
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -16,10 +17,21 @@ import (
 // --- Heartbeat Loop ---
 
 func startHeartbeatLoop() {
-	ticker := time.NewTicker(10 * time.Second)
+	ticker := time.NewTicker(HeartbeatInterval)
+	rounds := 0
 	for range ticker.C {
+		probeUnreachablePeers()
 		broadcastHeartbeat()
 		pruneDeadPeers()
+		forgiveGrievances()
+		rounds++
+		if rounds%SnapshotProbeEvery == 1 {
+			go probePeerSnapshots()
+		}
+		if rounds%PeerPersistEvery == 0 {
+			sampleReputation()
+			persistPeers()
+		}
 		// New: Periodically enforce infamy bans
 		if atomic.LoadInt64(&CurrentTick)%100 == 0 {
 			enforceInfamy()
@@ -37,51 +49,86 @@ func broadcastHeartbeat() {
 
 	myTick := atomic.LoadInt64(&CurrentTick)
 
-    // Gather Market Orders to Gossip (Last 5 created locally or new ones)
-    // Simple logic: Fetch active orders
-    var orders []MarketOrder
-    rows, _ := db.Query("SELECT order_id, seller_uuid, item, quantity, price, is_buy, origin_system, expires_tick FROM market_orders WHERE expires_tick > ? ORDER BY rowid DESC LIMIT 5", myTick)
-    if rows != nil {
-        defer rows.Close()
-        for rows.Next() {
-            var o MarketOrder
-            rows.Scan(&o.ID, &o.SellerUUID, &o.Item, &o.Quantity, &o.Price, &o.IsBuy, &o.OriginSystem, &o.ExpiresTick)
-            orders = append(orders, o)
-        }
-    }
+	// Gather Market Orders to Gossip (Last 5 created locally or new ones)
+	// Simple logic: Fetch active orders
+	var orders []MarketOrder
+	var cancels []OrderCancellation
+	var rows *sql.Rows
+	if featureEnabled(FeatureMarketMatching) {
+		cancels = recentCancellations(myTick)
+		rows, _ = db.Query("SELECT order_id, seller_uuid, item, quantity, price, is_buy, origin_system, expires_tick, COALESCE(NULLIF(origin_node, ''), ?) FROM market_orders WHERE expires_tick > ? ORDER BY rowid DESC LIMIT 5", ServerUUID, myTick)
+	}
+	if rows != nil {
+		defer rows.Close()
+		for rows.Next() {
+			var o MarketOrder
+			rows.Scan(&o.ID, &o.SellerUUID, &o.Item, &o.Quantity, &o.Price, &o.IsBuy, &o.OriginSystem, &o.ExpiresTick, &o.Node)
+			orders = append(orders, o)
+		}
+	}
 
+	econ := currentEconomy()
 	payload := HeartbeatRequest{
-		UUID:      ServerUUID,
-		Tick:      myTick,
-		PeerCount: len(peersList),
-		GenHash:   GenesisHash,
-        MarketOrders: orders, // Attach Market Gossip
+		UUID:            ServerUUID,
+		Tick:            myTick,
+		PeerCount:       len(peersList),
+		GenHash:         GenesisHash,
+		MarketOrders:    orders, // Attach Market Gossip
+		CancelledOrders: cancels,
+		Neighbors:       gossipNeighbors(peersList),
+		SystemNames:     recentSystemNames(myTick),
+		Tolls:           currentTolls(),
+		Economy:         &econ,
+		Supply:          localSupply(),
 	}
 
 	msg := fmt.Sprintf("%s:%d", payload.UUID, payload.Tick)
 	sig := SignMessage(PrivateKey, []byte(msg))
 	payload.Signature = hex.EncodeToString(sig)
 
-	data, _ := json.Marshal(payload)
-	compressed := compressLZ4(data)
+	// Peers that don't advertise market matching get the heartbeat without gossip, allies also
+	// get our vision (see alliance.go), and each variant goes out as protobuf or JSON (wire.go)
+	type variant struct{ allied, gossip, proto bool }
+	type encoded struct {
+		body        []byte
+		contentType string
+	}
+	variants := make(map[variant]encoded)
+	vision, beacons := nodeVision(), nodeBeacons()
+	for _, allied := range []bool{false, true} {
+		for _, gossip := range []bool{false, true} {
+			hb := payload
+			if !gossip {
+				hb.MarketOrders = nil
+			}
+			if allied {
+				hb.Vision, hb.Beacons = vision, beacons
+			}
+			for _, asProto := range []bool{false, true} {
+				body, ct := encodeFederation(hb, asProto)
+				variants[variant{allied, gossip, asProto}] = encoded{body, ct}
+			}
+		}
+	}
 
 	var wg sync.WaitGroup
 	for _, p := range peersList {
-		if p.Relation == 2 {
+		if p.Relation == 2 || !p.Reachable {
 			continue
-		} // Don't broadcast to enemies
+		} // Don't broadcast to enemies, or to addresses that haven't answered
 		wg.Add(1)
 		go func(target Peer) {
 			defer wg.Done()
-			sendHeartbeat(target.Url, compressed)
+			v := variants[variant{target.Relation == 1, target.Supports(FeatureMarketMatching), speaksProto(target)}]
+			sendHeartbeat(target.Url, v.contentType, v.body)
 		}(p)
 	}
 	wg.Wait()
 }
 
-func sendHeartbeat(url string, data []byte) {
+func sendHeartbeat(url, contentType string, data []byte) {
 	client := &http.Client{Timeout: 2 * time.Second}
-	resp, err := client.Post(url+"/federation/heartbeat", "application/x-ownworld-fed", bytes.NewBuffer(data))
+	resp, err := postFederationAs(client, url+"/federation/heartbeat", contentType, data)
 	if err == nil {
 		resp.Body.Close()
 	}
@@ -96,11 +143,109 @@ func pruneDeadPeers() {
 		if now.Sub(p.LastSeen) > 5*time.Minute {
 			InfoLog.Printf("🍂 Pruning dead peer: %s", id)
 			delete(Peers, id)
+			recordMembership(id, MembershipEvent{Event: MembershipPruned, Detail: "silent since " + p.LastSeen.UTC().Format(time.RFC3339)})
 			go recalculateLeader()
 		}
 	}
 }
 
+// Asks every peer for its first week of snapshots in delta mode and replays them against the
+// hash chain. Peers that can't serve their history are poor leader candidates for mirrors
+// trying to catch up.
+func probePeerSnapshots() {
+	peerLock.RLock()
+	targets := make(map[string]string, len(Peers))
+	for id, p := range Peers {
+		targets[id] = p.Url
+	}
+	peerLock.RUnlock()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	for id, url := range targets {
+		_, _, err := pullSnapshotChain(client, url, SnapshotCheckpointInterval)
+		ok := err == nil
+
+		peerLock.Lock()
+		if p, exists := Peers[id]; exists {
+			p.SnapshotOK = ok
+			p.SnapshotChecked = time.Now()
+		}
+		peerLock.Unlock()
+	}
+}
+
+// Fetches a peer's snapshots from the start with mode=delta: a full blob for the first day and at
+// checkpoints, deltas in between. The first day is the base; every later one is rebuilt from the
+// day before (applySnapshotDelta) and must hash onto the chain as the peer published it. Returns
+// the last day fetched and its colonies.
+func pullSnapshotChain(client *http.Client, url string, limit int) (int, []Colony, error) {
+	req, err := newFederationRequest("GET", fmt.Sprintf("%s/federation/sync?since_day=0&limit=%d&mode=delta", url, limit), nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("X-Fed-Key", os.Getenv("FEDERATION_KEY"))
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return 0, nil, fmt.Errorf("sync answered %d", resp.StatusCode)
+	}
+	var items []struct {
+		DayID int    `json:"day_id"`
+		Blob  []byte `json:"blob"`
+		Delta []byte `json:"delta"`
+		Hash  string `json:"hash"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&items); err != nil {
+		return 0, nil, err
+	}
+	if len(items) == 0 {
+		return 0, nil, fmt.Errorf("no snapshots")
+	}
+
+	day, prevHash := 0, ""
+	var colonies []Colony
+	for i, it := range items {
+		blob := it.Blob
+		if len(blob) == 0 {
+			var delta SnapshotDelta
+			if i == 0 || json.Unmarshal(decompressLZ4(it.Delta), &delta) != nil || delta.BaseDay != day {
+				return 0, nil, fmt.Errorf("day %d: delta without its base", it.DayID)
+			}
+			if colonies = applySnapshotDelta(colonies, delta); len(colonies) == 0 {
+				colonies = nil // snapshotWorld writes an empty day as null
+			}
+			raw, _ := json.Marshal(colonies)
+			blob = compressLZ4(raw)
+		} else {
+			colonies = nil
+			if json.Unmarshal(decompressLZ4(blob), &colonies) != nil {
+				return 0, nil, fmt.Errorf("day %d: unreadable snapshot", it.DayID)
+			}
+		}
+		if it.Hash == "" || (i > 0 && hashBLAKE3(append(append([]byte(nil), blob...), prevHash...)) != it.Hash) {
+			return 0, nil, fmt.Errorf("day %d: hash mismatch", it.DayID)
+		}
+		day, prevHash = it.DayID, it.Hash
+	}
+	return day, colonies, nil
+}
+
+// 2 = reliable, 1 = flaky, 0 = unreliable. Compared before tick height in elections.
+func reliabilityTier(p *Peer) int64 {
+	up := p.Uptime()
+	snapshotOK := p.SnapshotOK || p.SnapshotChecked.IsZero()
+	switch {
+	case up >= 0.9 && snapshotOK:
+		return 2
+	case up >= 0.5:
+		return 1
+	}
+	return 0
+}
+
 // --- EigenTrust Implementation ---
 
 // REPLACED: Real Implementation (Network Call)
@@ -115,7 +260,11 @@ func queryPeerOpinion(peer *Peer, targetUUID string) float64 {
 	// 2. Make Request (Short Timeout)
 	// We use a short timeout (1s) because we query many peers; we can't hang on one.
 	client := &http.Client{Timeout: 1 * time.Second}
-	resp, err := client.Get(targetURL)
+	req, err := newFederationRequest("GET", targetURL, nil)
+	if err != nil {
+		return 0.0
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		// If peer is unreachable, we assume Neutral (0.0) to avoid biasing the score.
 		return 0.0
@@ -179,8 +328,9 @@ func enforceInfamy() {
 
 		trustScore := p.Reputation // Using simplified local rep until full matrix is ready
 
-		if trustScore < -50.0 {
+		if trustScore < RepModel.HostileBelow {
 			p.Relation = 2 // Hostile/Ignored
+			savePeer(p)
 			InfoLog.Printf("🛡️  Peer %s ostracized by EigenTrust consensus.", id)
 		}
 	}
@@ -190,6 +340,13 @@ func enforceInfamy() {
 
 // Handles Grievance Reports from Federation
 func processGrievance(g *GrievanceReport, reporterID string) {
+	// Deferred first so it runs after the unlock below: broadcasting takes peerLock itself
+	var report []byte
+	defer func() {
+		if report != nil {
+			broadcastTransaction(report)
+		}
+	}()
 	peerLock.Lock()
 	defer peerLock.Unlock()
 
@@ -198,6 +355,12 @@ func processGrievance(g *GrievanceReport, reporterID string) {
 		return
 	}
 
+	// Filed against us: remember what we owe (see reparations.go)
+	if g.OffenderUUID == ServerUUID {
+		recordOwedGrievance(g, reporterID)
+		return
+	}
+
 	// 1. RELATIVE TRUST CHECK
 	if reporter.Relation == 2 {
 		InfoLog.Printf("Ignoring grievance from hostile peer %s", reporterID)
@@ -211,15 +374,99 @@ func processGrievance(g *GrievanceReport, reporterID string) {
 			impact = 1.0
 		}
 
-		offender.Reputation -= impact
+		// Numbered reports are remembered so reparations can be checked against them, and count once
+		if g.ID > 0 {
+			res, err := db.Exec(`INSERT OR IGNORE INTO peer_grievances (reporter_uuid, grievance_id, offender_uuid, damage, impact, tick)
+			                     VALUES (?, ?, ?, ?, ?, ?)`, reporterID, g.ID, g.OffenderUUID, g.Damage, impact, atomic.LoadInt64(&CurrentTick))
+			if err != nil {
+				return
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				return
+			}
+		}
 
-		if offender.Reputation < -50 {
+		if penalizePeer(offender, impact, "grievance") {
 			offender.Relation = 2
+			savePeer(offender)
 			InfoLog.Printf("⚔️ Peer %s declared HOSTILE due to grievance (Rep: %.2f).", offender.UUID, offender.Reputation)
 		} else {
 			InfoLog.Printf("📉 Peer %s reputation dropped to %.2f (Reported by %s)", offender.UUID, offender.Reputation, reporterID)
 		}
 	}
+
+	// 3. ALLIES STAND TOGETHER
+	report = mutualDefense(g, reporter)
+}
+
+func (rc ReparationReceipt) signingString() []byte {
+	return []byte(fmt.Sprintf("REPARATION:%s:%d:%s:%d", rc.VictimNode, rc.GrievanceID, rc.OffenderNode, rc.Paid))
+}
+
+// Handles reparation receipts: a receipt signed by both nodes restores the offender's standing by
+// the share of a grievance we recorded that it newly covers, up to the penalty that grievance cost.
+// A receipt for one of our own grievances is countersigned and passed on (see reparations.go).
+func processReparation(rc *ReparationReceipt, reporterID string) {
+	if rc.VictimNode == "" || rc.VictimNode == rc.OffenderNode || rc.Paid <= 0 || rc.OffenderNode == ServerUUID {
+		return
+	}
+	if rc.VictimNode == ServerUUID {
+		if signed := countersignReparation(rc, reporterID); signed != nil {
+			payload, _ := json.Marshal(signed)
+			broadcastTransaction(payload)
+		}
+		return
+	}
+	if !offenderSignatureValid(rc) || !nodeSignatureValid(rc.VictimNode, rc.signingString(), rc.VictimSig) {
+		InfoLog.Printf("Ignoring unsigned reparation receipt from %s", reporterID)
+		return
+	}
+
+	peerLock.Lock()
+	defer peerLock.Unlock()
+
+	reporter, known := Peers[reporterID]
+	if !known || reporter.Relation == 2 {
+		return
+	}
+	offender, exists := Peers[rc.OffenderNode]
+	if !exists {
+		return
+	}
+
+	var damage, paid int
+	var impact float64
+	err := db.QueryRow("SELECT damage, impact, paid FROM peer_grievances WHERE reporter_uuid=? AND grievance_id=? AND offender_uuid=?",
+		rc.VictimNode, rc.GrievanceID, rc.OffenderNode).Scan(&damage, &impact, &paid)
+	if err != nil {
+		return
+	}
+	owed := damage * ReparationCreditsPerDamage
+	total := rc.Paid
+	if total > owed {
+		total = owed
+	}
+	if owed <= 0 || total <= paid {
+		return // already applied
+	}
+	res, err := db.Exec("UPDATE peer_grievances SET paid=? WHERE reporter_uuid=? AND grievance_id=? AND paid=?", total, rc.VictimNode, rc.GrievanceID, paid)
+	if err != nil {
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return
+	}
+
+	restorePeer(offender, impact*float64(total-paid)/float64(owed), "reparation")
+	InfoLog.Printf("🤝 Peer %s reputation restored to %.2f (Reparations acknowledged by %s)", offender.UUID, offender.Reputation, rc.VictimNode)
+}
+
+// Queues a payload for every non-hostile peer's /federation/transaction and wakes the outbox
+// worker to send it; the worker signs, delivers and retries. Callers must not hold peerLock.
+func broadcastTransaction(payload []byte) {
+	if enqueueTransaction(payload) > 0 {
+		kickOutbox()
+	}
 }
 
 // Restored: Logic to determine leader based on score
@@ -229,15 +476,15 @@ func recalculateLeader() {
 		Score int64
 	}
 
-	// My score
-	myScore := (atomic.LoadInt64(&CurrentTick) << 16) | int64(100*1000)
+	// My score (we always consider ourselves reliable; peers are measured)
+	myScore := (2 << 56) | (atomic.LoadInt64(&CurrentTick) << 16) | int64(100*1000)
 	candidates := []Candidate{{UUID: ServerUUID, Score: myScore}}
 
 	// We need to read Peers. If caller held lock, we can't RLock.
 	// Let's assume callers DO NOT hold lock when calling this.
 	peerLock.RLock()
 	for _, p := range Peers {
-		if p.Reputation < -50 {
+		if p.Reputation < RepModel.HostileBelow {
 			continue
 		} // Skip Hostile/Banned nodes
 
@@ -247,7 +494,7 @@ func recalculateLeader() {
 			trustScore = 0
 		}
 
-		pScore := (p.LastTick << 16) | (trustScore * 1000)
+		pScore := (reliabilityTier(p) << 56) | (p.LastTick << 16) | (trustScore * 1000)
 		candidates = append(candidates, Candidate{UUID: p.UUID, Score: pScore})
 	}
 	peerLock.RUnlock()
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Startup Consistency Checker ---
+// Several write paths ignore errors, so a crash mid-handler can leave rows in impossible
+// states. On boot we repair what has an obvious fix and quarantine what doesn't.
+//
+// Market escrow is checked too: a prepared settlement whose peer is no longer known can never be
+// decided by it, so it is aborted here, which refunds the fleet's hold (coordinator) or the
+// order owner's goods or credits (participant). Local orders whose seller is gone are dropped,
+// and fleets still headed for an order that no longer exists lose the reservation; their hold
+// was never taken and travels with them. Repairs that drop or refund rows list their ids.
+
+type ConsistencyIssue struct {
+	Check   string   `json:"check"`
+	Action  string   `json:"action"` // "repaired" or "quarantined"
+	Count   int64    `json:"count"`
+	Dropped []string `json:"dropped,omitempty"` // ids of the rows removed or refunded
+}
+
+type ConsistencyReport struct {
+	CheckedAt time.Time          `json:"checked_at"`
+	Issues    []ConsistencyIssue `json:"issues"`
+	Clean     bool               `json:"clean"`
+}
+
+var (
+	lastConsistencyReport ConsistencyReport
+	consistencyLock       sync.RWMutex
+)
+
+// Numeric colony columns that can never legitimately go below zero
+var colonyStockColumns = []string{
+	"pop_laborers", "pop_specialists", "pop_elites",
+	"food", "water", "iron", "carbon", "gold",
+	"platinum", "platinum_ore", "uranium", "uranium_ore", "diamond", "diamond_ore", "plutonium",
+	"vegetation", "oxygen", "fuel", "steel", "wine",
+}
+
+func runConsistencyCheck() ConsistencyReport {
+	report := ConsistencyReport{CheckedAt: time.Now(), Issues: []ConsistencyIssue{}}
+
+	record := func(check, action, query string, args ...interface{}) {
+		res, err := db.Exec(query, args...)
+		if err != nil {
+			ErrorLog.Printf("Consistency check '%s' failed: %v", check, err)
+			return
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			report.Issues = append(report.Issues, ConsistencyIssue{Check: check, Action: action, Count: n})
+		}
+	}
+
+	// 1. Negative stockpiles and populations
+	for _, col := range colonyStockColumns {
+		record("negative_"+col, "repaired", fmt.Sprintf("UPDATE colonies SET %s = 0 WHERE %s < 0", col, col))
+	}
+	record("negative_credits", "repaired", "UPDATE users SET credits = 0 WHERE credits < 0")
+	record("negative_fleet_fuel", "repaired", "UPDATE fleets SET fuel = 0 WHERE fuel < 0")
+
+	// 2. Colonies the tick can't parse
+	record("null_buildings_json", "repaired", "UPDATE colonies SET buildings_json = '{}' WHERE buildings_json IS NULL OR buildings_json = ''")
+	record("null_policies_json", "repaired", "UPDATE colonies SET policies_json = '{}' WHERE policies_json IS NULL OR policies_json = ''")
+
+	// 3. Fleets pointing nowhere (no location, or a non-coordinate destination that doesn't exist)
+	record("fleet_without_location", "quarantined", "UPDATE fleets SET status = 'QUARANTINED' WHERE status != 'QUARANTINED' AND (origin_system IS NULL OR origin_system = '')")
+	record("fleet_dest_missing", "quarantined", `UPDATE fleets SET status = 'QUARANTINED'
+		WHERE status = 'TRANSIT' AND dest_system NOT LIKE 'sys-%'
+		AND dest_system NOT IN (SELECT id FROM solar_systems)`)
+
+	// Runs repair on each id the query finds and records the ones it went through for
+	repairEach := func(check, query string, repair func(id string) bool) {
+		rows, err := db.Query(query)
+		if err != nil {
+			ErrorLog.Printf("Consistency check '%s' failed: %v", check, err)
+			return
+		}
+		var ids []string
+		for rows.Next() {
+			var id string
+			rows.Scan(&id)
+			ids = append(ids, id)
+		}
+		rows.Close()
+		var dropped []string
+		for _, id := range ids {
+			if repair(id) {
+				dropped = append(dropped, id)
+			}
+		}
+		if len(dropped) > 0 {
+			report.Issues = append(report.Issues, ConsistencyIssue{Check: check, Action: "repaired", Count: int64(len(dropped)), Dropped: dropped})
+		}
+	}
+	deleteOrder := func(id string) bool {
+		res, err := db.Exec("DELETE FROM market_orders WHERE order_id=?", id)
+		if err != nil {
+			return false
+		}
+		n, _ := res.RowsAffected()
+		return n > 0
+	}
+
+	// 4. Market orders that can never be fulfilled
+	repairEach("invalid_market_orders", "SELECT order_id FROM market_orders WHERE quantity <= 0 OR price < 0 OR item IS NULL OR item = ''", deleteOrder)
+
+	// 5. Orphan market escrow. Settlements with a peer we no longer know are aborted and refunded
+	// first, since a participant's abort puts its order back on the market.
+	repairEach("orphan_settlements", `SELECT id FROM settlements WHERE status = 'prepared'
+		AND peer_uuid NOT IN (SELECT uuid FROM peers)`, func(id string) bool {
+		s, err := loadSettlement(id)
+		if err != nil {
+			return false
+		}
+		if s.Role == RoleCoordinator {
+			return decideCoordinator(s, SettlementAborted, true)
+		}
+		return decideParticipant(s.ID, s.PeerUUID, SettlementAborted) == SettlementAborted
+	})
+	repairEach("orphan_market_orders", `SELECT order_id FROM market_orders WHERE COALESCE(origin_node, '') = ''
+		AND NOT EXISTS (SELECT 1 FROM users WHERE users.global_uuid = market_orders.seller_uuid)`, deleteOrder)
+	repairEach("orphan_order_targets", `SELECT id FROM fleets WHERE status = 'TRANSIT' AND COALESCE(target_order_id, '') != ''
+		AND target_order_id NOT IN (SELECT order_id FROM market_orders)`, func(id string) bool {
+		res, err := db.Exec("UPDATE fleets SET target_order_id=NULL WHERE id=?", id)
+		if err != nil {
+			return false
+		}
+		n, _ := res.RowsAffected()
+		return n > 0
+	})
+
+	report.Clean = len(report.Issues) == 0
+
+	consistencyLock.Lock()
+	lastConsistencyReport = report
+	consistencyLock.Unlock()
+
+	if report.Clean {
+		InfoLog.Println("🩺 Consistency check passed.")
+	} else {
+		for _, issue := range report.Issues {
+			if len(issue.Dropped) > 0 {
+				InfoLog.Printf("🩺 Consistency: %s -> %s %d row(s): %s", issue.Check, issue.Action, issue.Count, strings.Join(issue.Dropped, ", "))
+				continue
+			}
+			InfoLog.Printf("🩺 Consistency: %s -> %s %d row(s)", issue.Check, issue.Action, issue.Count)
+		}
+	}
+	return report
+}
+
+func handleConsistencyReport(w http.ResponseWriter, r *http.Request) {
+	if !authenticateAdmin(r) {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	// POST re-runs the checker on demand
+	if r.Method == "POST" {
+		stateLock.Lock()
+		runConsistencyCheck()
+		stateLock.Unlock()
+	}
+
+	consistencyLock.RLock()
+	report := lastConsistencyReport
+	consistencyLock.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
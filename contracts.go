@@ -0,0 +1,421 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// --- Delivery Contracts ---
+// An issuer posts "deliver these goods to my colony in system X within N ticks for R credits".
+// The reward is escrowed on creation; a contractor accepting it escrows collateral. Deliveries
+// can arrive in several fleets and are tracked per item. Fulfilment pays reward + collateral
+// back to the contractor. Missing the deadline pays the contractor a pro-rated share of the
+// reward for what was delivered, and the issuer gets the rest plus the collateral.
+
+const (
+	MaxContractTicks   = 5000
+	MaxContractItems   = 8
+	MaxOpenContracts   = 20 // per issuer
+	ContractSweepEvery = 10 // ticks
+	ContractOpen       = "open"
+	ContractAccepted   = "accepted"
+	ContractFulfilled  = "fulfilled"
+	ContractFailed     = "failed"
+	ContractExpired    = "expired"
+	ContractCancelled  = "cancelled"
+)
+
+// Goods a contract can ask for (colony column names)
+var ContractItems = map[string]bool{
+	"food": true, "water": true, "iron": true, "carbon": true, "steel": true, "fuel": true,
+	"gold": true, "wine": true, "platinum": true, "uranium": true, "diamond": true,
+}
+
+type Contract struct {
+	ID           string         `json:"id"`
+	IssuerUUID   string         `json:"issuer_uuid"`
+	Contractor   string         `json:"contractor_uuid,omitempty"`
+	DestSystem   string         `json:"dest_system"`
+	Items        map[string]int `json:"items"`
+	Delivered    map[string]int `json:"delivered"`
+	Reward       int            `json:"reward"`
+	Collateral   int            `json:"collateral"`
+	Status       string         `json:"status"`
+	CreatedTick  int64          `json:"created_tick"`
+	DeadlineTick int64          `json:"deadline_tick"`
+}
+
+// Moves what the contract still needs out of cargo; returns what moved
+func applyDelivery(required, delivered, cargo map[string]int) map[string]int {
+	moved := make(map[string]int)
+	for item, want := range required {
+		need := want - delivered[item]
+		have := cargo[item]
+		if need <= 0 || have <= 0 {
+			continue
+		}
+		n := have
+		if n > need {
+			n = need
+		}
+		cargo[item] -= n
+		delivered[item] += n
+		moved[item] = n
+	}
+	return moved
+}
+
+func contractComplete(required, delivered map[string]int) bool {
+	for item, want := range required {
+		if delivered[item] < want {
+			return false
+		}
+	}
+	return true
+}
+
+// Splits escrow when an accepted contract misses its deadline
+func failedContractPayout(reward, collateral int, required, delivered map[string]int) (contractor, issuer int) {
+	total, done := 0, 0
+	for item, want := range required {
+		total += want
+		d := delivered[item]
+		if d > want {
+			d = want
+		}
+		done += d
+	}
+	if total > 0 {
+		contractor = reward * done / total
+	}
+	return contractor, reward - contractor + collateral
+}
+
+func scanContract(row interface{ Scan(...interface{}) error }) (Contract, error) {
+	var c Contract
+	var contractor sql.NullString
+	var itemsJson, deliveredJson string
+	err := row.Scan(&c.ID, &c.IssuerUUID, &contractor, &c.DestSystem, &itemsJson, &deliveredJson,
+		&c.Reward, &c.Collateral, &c.Status, &c.CreatedTick, &c.DeadlineTick)
+	c.Contractor = contractor.String
+	c.Items = make(map[string]int)
+	c.Delivered = make(map[string]int)
+	json.Unmarshal([]byte(itemsJson), &c.Items)
+	json.Unmarshal([]byte(deliveredJson), &c.Delivered)
+	return c, err
+}
+
+const contractColumns = `id, issuer_uuid, contractor_uuid, dest_system, items_json, delivered_json,
+	reward, collateral, status, created_tick, deadline_tick`
+
+func loadContract(id string) (Contract, error) {
+	return scanContract(db.QueryRow("SELECT "+contractColumns+" FROM contracts WHERE id=?", id))
+}
+
+// Settles accepted contracts past their deadline and expires untaken ones
+func processContracts(current int64) {
+	if current%ContractSweepEvery != 0 {
+		return
+	}
+	rows, err := db.Query("SELECT "+contractColumns+" FROM contracts WHERE status IN (?, ?) AND deadline_tick < ?",
+		ContractOpen, ContractAccepted, current)
+	if err != nil {
+		return
+	}
+	var due []Contract
+	for rows.Next() {
+		if c, err := scanContract(rows); err == nil {
+			due = append(due, c)
+		}
+	}
+	rows.Close()
+
+	for _, c := range due {
+		tx, _ := db.Begin()
+		if c.Status == ContractOpen {
+			tx.Exec("UPDATE users SET credits = credits + ? WHERE global_uuid=?", c.Reward, c.IssuerUUID)
+			tx.Exec("UPDATE contracts SET status=? WHERE id=?", ContractExpired, c.ID)
+		} else {
+			toContractor, toIssuer := failedContractPayout(c.Reward, c.Collateral, c.Items, c.Delivered)
+			tx.Exec("UPDATE users SET credits = credits + ? WHERE global_uuid=?", toContractor, c.Contractor)
+			tx.Exec("UPDATE users SET credits = credits + ? WHERE global_uuid=?", toIssuer, c.IssuerUUID)
+			tx.Exec("UPDATE contracts SET status=? WHERE id=?", ContractFailed, c.ID)
+			InfoLog.Printf("📜 Contract %s failed: %d to contractor, %d to issuer", c.ID, toContractor, toIssuer)
+		}
+		tx.Commit()
+	}
+}
+
+// Escrows credits inside tx; false if the user can't cover them
+func escrowCredits(tx *sql.Tx, userID string, amount int) bool {
+	if amount <= 0 {
+		return true
+	}
+	res, err := tx.Exec("UPDATE users SET credits = credits - ? WHERE global_uuid=? AND credits >= ?", amount, userID, amount)
+	if err != nil {
+		return false
+	}
+	n, _ := res.RowsAffected()
+	return n > 0
+}
+
+// GET: open contracts plus your own. POST: create one.
+func handleContracts(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		rows, err := db.Query("SELECT "+contractColumns+` FROM contracts
+		                      WHERE status=? OR issuer_uuid=? OR contractor_uuid=?
+		                      ORDER BY created_tick DESC LIMIT 100`, ContractOpen, userID, userID)
+		if err != nil {
+			http.Error(w, "DB Error", 500)
+			return
+		}
+		defer rows.Close()
+		list := []Contract{}
+		for rows.Next() {
+			if c, err := scanContract(rows); err == nil {
+				list = append(list, c)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+		return
+	}
+
+	var req struct {
+		DestSystem string         `json:"dest_system" validate:"required"`
+		Items      map[string]int `json:"items" validate:"required"`
+		Reward     int            `json:"reward" validate:"required"`
+		Collateral int            `json:"collateral"`
+		Ticks      int            `json:"ticks" validate:"required"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if len(req.Items) > MaxContractItems {
+		http.Error(w, "Too Many Items", 400)
+		return
+	}
+	for item, qty := range req.Items {
+		if !ContractItems[item] || qty <= 0 {
+			http.Error(w, "Invalid Item: "+item, 400)
+			return
+		}
+	}
+	if req.Reward <= 0 || req.Collateral < 0 || req.Ticks <= 0 || req.Ticks > MaxContractTicks {
+		http.Error(w, fmt.Sprintf("Invalid Terms (reward > 0, collateral >= 0, 1-%d ticks)", MaxContractTicks), 400)
+		return
+	}
+
+	defer lockRows(userRow(userID))()
+
+	var colCount, open int
+	db.QueryRow("SELECT count(*) FROM colonies WHERE system_id=? AND owner_uuid=?", req.DestSystem, userID).Scan(&colCount)
+	if colCount == 0 {
+		http.Error(w, "Destination must be one of your colonies", 400)
+		return
+	}
+	db.QueryRow("SELECT count(*) FROM contracts WHERE issuer_uuid=? AND status IN (?, ?)", userID, ContractOpen, ContractAccepted).Scan(&open)
+	if open >= MaxOpenContracts {
+		http.Error(w, "Too Many Open Contracts", 429)
+		return
+	}
+
+	now := atomic.LoadInt64(&CurrentTick)
+	c := Contract{
+		ID: fmt.Sprintf("ctr-%s-%d", userID[:8], time.Now().UnixNano()), IssuerUUID: userID,
+		DestSystem: req.DestSystem, Items: req.Items, Delivered: map[string]int{},
+		Reward: req.Reward, Collateral: req.Collateral, Status: ContractOpen,
+		CreatedTick: now, DeadlineTick: now + int64(req.Ticks),
+	}
+	itemsJson, _ := json.Marshal(c.Items)
+
+	tx, _ := db.Begin()
+	if !escrowCredits(tx, userID, c.Reward) {
+		tx.Rollback()
+		http.Error(w, "Insufficient Credits for Reward Escrow", 402)
+		return
+	}
+	_, err = tx.Exec(`INSERT INTO contracts (id, issuer_uuid, dest_system, items_json, delivered_json, reward, collateral, status, created_tick, deadline_tick)
+	                  VALUES (?, ?, ?, ?, '{}', ?, ?, ?, ?, ?)`,
+		c.ID, userID, c.DestSystem, string(itemsJson), c.Reward, c.Collateral, c.Status, c.CreatedTick, c.DeadlineTick)
+	if err != nil {
+		tx.Rollback()
+		http.Error(w, "DB Error", 500)
+		return
+	}
+	tx.Commit()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
+}
+
+// POST {"id"}: take an open contract, escrowing its collateral
+func handleAcceptContract(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	var req struct {
+		ID string `json:"id" validate:"required"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	defer lockRows(userRow(userID), "contract:"+req.ID)()
+
+	c, err := loadContract(req.ID)
+	if err != nil {
+		http.Error(w, "Contract Not Found", 404)
+		return
+	}
+	if c.Status != ContractOpen || c.DeadlineTick < atomic.LoadInt64(&CurrentTick) {
+		http.Error(w, "Contract Not Open", 409)
+		return
+	}
+	if c.IssuerUUID == userID {
+		http.Error(w, "Cannot accept your own contract", 400)
+		return
+	}
+
+	tx, _ := db.Begin()
+	if !escrowCredits(tx, userID, c.Collateral) {
+		tx.Rollback()
+		http.Error(w, "Insufficient Credits for Collateral", 402)
+		return
+	}
+	tx.Exec("UPDATE contracts SET status=?, contractor_uuid=? WHERE id=?", ContractAccepted, userID, c.ID)
+	tx.Commit()
+	w.Write([]byte("Contract Accepted"))
+}
+
+// POST {"id", "fleet_id"}: unload what the contract still needs from a fleet in orbit
+func handleDeliverContract(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	var req struct {
+		ID      string `json:"id" validate:"required"`
+		FleetID int    `json:"fleet_id" validate:"required"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	defer lockRows(userRow(userID), "contract:"+req.ID)()
+
+	c, err := loadContract(req.ID)
+	if err != nil {
+		http.Error(w, "Contract Not Found", 404)
+		return
+	}
+	if c.Status != ContractAccepted || c.Contractor != userID {
+		http.Error(w, "Not your active contract", 403)
+		return
+	}
+
+	var owner, system, status, plJson string
+	err = db.QueryRow("SELECT owner_uuid, origin_system, status, COALESCE(payload_json, '') FROM fleets WHERE id=?", req.FleetID).
+		Scan(&owner, &system, &status, &plJson)
+	if err != nil || owner != userID {
+		http.Error(w, "Fleet Not Found", 404)
+		return
+	}
+	if status != "ORBIT" || system != c.DestSystem {
+		http.Error(w, "Fleet must be in orbit at "+c.DestSystem, 400)
+		return
+	}
+
+	var colID int
+	if db.QueryRow("SELECT id FROM colonies WHERE system_id=? AND owner_uuid=? AND COALESCE(site_type, 'planet')='planet'", c.DestSystem, c.IssuerUUID).Scan(&colID) != nil {
+		http.Error(w, "Destination colony is gone", 410)
+		return
+	}
+	if err := checkEmbargo(c.IssuerUUID, colID, userID, c.DestSystem); err != nil {
+		http.Error(w, err.Error(), 403)
+		return
+	}
+
+	var payload FleetPayload
+	json.Unmarshal([]byte(plJson), &payload)
+	if payload.Resources == nil {
+		payload.Resources = make(map[string]int)
+	}
+	moved := applyDelivery(c.Items, c.Delivered, payload.Resources)
+	if len(moved) == 0 {
+		http.Error(w, "Fleet carries nothing this contract needs", 400)
+		return
+	}
+
+	tx, _ := db.Begin()
+	for item, n := range moved {
+		if !ContractItems[item] {
+			continue
+		}
+		tx.Exec(fmt.Sprintf("UPDATE colonies SET %s = %s + ? WHERE id=?", item, item), n, colID)
+	}
+	newPl, _ := json.Marshal(payload)
+	tx.Exec("UPDATE fleets SET payload_json=? WHERE id=?", string(newPl), req.FleetID)
+	deliveredJson, _ := json.Marshal(c.Delivered)
+
+	msg := "Partial Delivery Recorded"
+	if contractComplete(c.Items, c.Delivered) {
+		tx.Exec("UPDATE contracts SET delivered_json=?, status=? WHERE id=?", string(deliveredJson), ContractFulfilled, c.ID)
+		tx.Exec("UPDATE users SET credits = credits + ? WHERE global_uuid=?", c.Reward+c.Collateral, userID)
+		msg = fmt.Sprintf("Contract Fulfilled: %d credits paid", c.Reward+c.Collateral)
+	} else {
+		tx.Exec("UPDATE contracts SET delivered_json=? WHERE id=?", string(deliveredJson), c.ID)
+	}
+	tx.Commit()
+	w.Write([]byte(msg))
+}
+
+// POST {"id"}: the issuer withdraws a contract nobody has taken yet
+func handleCancelContract(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	var req struct {
+		ID string `json:"id" validate:"required"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	defer lockRows(userRow(userID), "contract:"+req.ID)()
+
+	c, err := loadContract(req.ID)
+	if err != nil || c.IssuerUUID != userID {
+		http.Error(w, "Contract Not Found", 404)
+		return
+	}
+	if c.Status != ContractOpen {
+		http.Error(w, "Only open contracts can be cancelled", 409)
+		return
+	}
+
+	tx, _ := db.Begin()
+	tx.Exec("UPDATE contracts SET status=? WHERE id=?", ContractCancelled, c.ID)
+	tx.Exec("UPDATE users SET credits = credits + ? WHERE global_uuid=?", c.Reward, userID)
+	tx.Commit()
+	w.Write([]byte("Contract Cancelled"))
+}
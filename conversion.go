@@ -0,0 +1,392 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// --- Conversion Contracts ---
+// Refinery-as-a-service. A colony owner with idle refinery buildings offers some of them as
+// "lines" at a fee per unit of ore. A customer ships ore there, unloads it into the contract's
+// hopper (escrowing the fee) and the lines work it off at the building's base recipe rate, one
+// batch per line per tick. Lines busy on a contract are taken out of the colony's own industry
+// that tick. The fee is paid to the refiner as ore is processed; refined goods wait until the
+// customer collects them with a fleet in orbit. At the deadline the contract stops, unprocessed
+// fees are refunded and whatever is left (refined or not) stays collectable.
+
+const ConversionClosed = "closed" // expired and fully collected
+
+type ConversionContract struct {
+	ID           string `json:"id"`
+	RefinerUUID  string `json:"refiner_uuid"`
+	Customer     string `json:"customer_uuid,omitempty"`
+	ColonyID     int    `json:"colony_id"`
+	SystemID     string `json:"system_id"`
+	Building     string `json:"building"`
+	Input        string `json:"input"`
+	Output       string `json:"output"`
+	Lines        int    `json:"lines"`
+	Fee          int    `json:"fee"`     // credits per unit of input
+	Hopper       int    `json:"hopper"`  // input waiting to be processed
+	Refined      int    `json:"refined"` // output waiting to be collected
+	Status       string `json:"status"`
+	CreatedTick  int64  `json:"created_tick"`
+	DeadlineTick int64  `json:"deadline_tick"`
+}
+
+// Input units per tick once the hopper is full enough
+func (c ConversionContract) throughput() int {
+	r, _ := refineryRecipe(c.Building)
+	return c.Lines * r.InputAmt
+}
+
+func scanConversion(row interface{ Scan(...interface{}) error }) (ConversionContract, error) {
+	var c ConversionContract
+	err := row.Scan(&c.ID, &c.RefinerUUID, &c.Customer, &c.ColonyID, &c.SystemID, &c.Building,
+		&c.Lines, &c.Fee, &c.Hopper, &c.Refined, &c.Status, &c.CreatedTick, &c.DeadlineTick)
+	r, _ := refineryRecipe(c.Building)
+	c.Input, c.Output = r.Input, r.Output
+	return c, err
+}
+
+const conversionColumns = `id, refiner_uuid, COALESCE(customer_uuid, ''), colony_id, system_id, building,
+	lines, fee, hopper, refined, status, created_tick, deadline_tick`
+
+func loadConversion(id string) (ConversionContract, error) {
+	return scanConversion(db.QueryRow("SELECT "+conversionColumns+" FROM conversion_contracts WHERE id=?", id))
+}
+
+// Lines of building at colonyID already promised to live conversion contracts
+func reservedLines(colonyID int, building string) int {
+	var n int
+	db.QueryRow("SELECT COALESCE(SUM(lines), 0) FROM conversion_contracts WHERE colony_id=? AND building=? AND status IN (?, ?)",
+		colonyID, building, ContractOpen, ContractAccepted).Scan(&n)
+	return n
+}
+
+// Runs one tick of every active conversion contract and settles expired ones. Returns the
+// refinery lines that worked for customers, per colony and building, for processIndustry.
+func processConversions(current int64) map[int]map[string]int {
+	busy := make(map[int]map[string]int)
+
+	rows, err := db.Query("SELECT "+conversionColumns+" FROM conversion_contracts WHERE status IN (?, ?)",
+		ContractOpen, ContractAccepted)
+	if err != nil {
+		return busy
+	}
+	var live []ConversionContract
+	for rows.Next() {
+		if c, err := scanConversion(rows); err == nil {
+			live = append(live, c)
+		}
+	}
+	rows.Close()
+
+	for _, c := range live {
+		if c.DeadlineTick < current {
+			tx, _ := db.Begin()
+			if c.Status == ContractAccepted {
+				tx.Exec("UPDATE users SET credits = credits + ? WHERE global_uuid=?", c.Fee*c.Hopper, c.Customer)
+			}
+			tx.Exec("UPDATE conversion_contracts SET status=? WHERE id=?", ContractExpired, c.ID)
+			tx.Commit()
+			continue
+		}
+
+		r, _ := refineryRecipe(c.Building)
+		if c.Status != ContractAccepted || c.Hopper < r.InputAmt {
+			continue
+		}
+
+		// The refiner has to still own the colony and the buildings
+		var owner, bJson string
+		if db.QueryRow("SELECT owner_uuid, buildings_json FROM colonies WHERE id=?", c.ColonyID).Scan(&owner, &bJson) != nil || owner != c.RefinerUUID {
+			continue
+		}
+		buildings := make(map[string]int)
+		json.Unmarshal([]byte(bJson), &buildings)
+		if busy[c.ColonyID] == nil {
+			busy[c.ColonyID] = make(map[string]int)
+		}
+
+		batches := c.Lines
+		if free := buildings[c.Building] - busy[c.ColonyID][c.Building]; free < batches {
+			batches = free
+		}
+		if n := c.Hopper / r.InputAmt; n < batches {
+			batches = n
+		}
+		if batches <= 0 {
+			continue
+		}
+		busy[c.ColonyID][c.Building] += batches
+
+		used := batches * r.InputAmt
+		tx, _ := db.Begin()
+		tx.Exec("UPDATE conversion_contracts SET hopper = hopper - ?, refined = refined + ? WHERE id=?",
+			used, batches*r.OutputAmt, c.ID)
+		tx.Exec("UPDATE users SET credits = credits + ? WHERE global_uuid=?", used*c.Fee, c.RefinerUUID)
+		tx.Commit()
+	}
+	return busy
+}
+
+// GET: open conversion offers plus your own. POST: offer refinery lines at one of your colonies.
+func handleConversions(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		rows, err := db.Query("SELECT "+conversionColumns+` FROM conversion_contracts
+		                      WHERE status=? OR refiner_uuid=? OR customer_uuid=?
+		                      ORDER BY created_tick DESC LIMIT 100`, ContractOpen, userID, userID)
+		if err != nil {
+			http.Error(w, "DB Error", 500)
+			return
+		}
+		defer rows.Close()
+		list := []ConversionContract{}
+		for rows.Next() {
+			if c, err := scanConversion(rows); err == nil {
+				list = append(list, c)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+		return
+	}
+
+	var req struct {
+		ColonyID int    `json:"colony_id" validate:"required"`
+		Building string `json:"building" validate:"required"`
+		Lines    int    `json:"lines" validate:"required"`
+		Fee      int    `json:"fee"`
+		Ticks    int    `json:"ticks" validate:"required"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	recipe, ok := refineryRecipe(req.Building)
+	if !ok {
+		http.Error(w, "Not a refinery: "+req.Building, 400)
+		return
+	}
+	if req.Lines <= 0 || req.Fee < 0 || req.Ticks <= 0 || req.Ticks > MaxContractTicks {
+		http.Error(w, fmt.Sprintf("Invalid Terms (lines > 0, fee >= 0, 1-%d ticks)", MaxContractTicks), 400)
+		return
+	}
+
+	defer lockRows(userRow(userID))()
+
+	var owner, sysID, bJson string
+	err = db.QueryRow("SELECT owner_uuid, system_id, buildings_json FROM colonies WHERE id=?", req.ColonyID).Scan(&owner, &sysID, &bJson)
+	if err != nil || owner != userID {
+		http.Error(w, "Colony Not Found", 404)
+		return
+	}
+	buildings := make(map[string]int)
+	json.Unmarshal([]byte(bJson), &buildings)
+	if free := buildings[req.Building] - reservedLines(req.ColonyID, req.Building); req.Lines > free {
+		if free < 0 {
+			free = 0
+		}
+		http.Error(w, fmt.Sprintf("Only %d %s lines free", free, req.Building), 409)
+		return
+	}
+
+	var open int
+	db.QueryRow("SELECT count(*) FROM conversion_contracts WHERE refiner_uuid=? AND status IN (?, ?)", userID, ContractOpen, ContractAccepted).Scan(&open)
+	if open >= MaxOpenContracts {
+		http.Error(w, "Too Many Open Contracts", 429)
+		return
+	}
+
+	now := atomic.LoadInt64(&CurrentTick)
+	c := ConversionContract{
+		ID: fmt.Sprintf("cnv-%s-%d", userID[:8], time.Now().UnixNano()), RefinerUUID: userID,
+		ColonyID: req.ColonyID, SystemID: sysID, Building: req.Building,
+		Input: recipe.Input, Output: recipe.Output, Lines: req.Lines, Fee: req.Fee,
+		Status: ContractOpen, CreatedTick: now, DeadlineTick: now + int64(req.Ticks),
+	}
+	_, err = db.Exec(`INSERT INTO conversion_contracts (id, refiner_uuid, colony_id, system_id, building, lines, fee, status, created_tick, deadline_tick)
+	                  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.ID, userID, c.ColonyID, c.SystemID, c.Building, c.Lines, c.Fee, c.Status, c.CreatedTick, c.DeadlineTick)
+	if err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
+}
+
+// Loads the customer's fleet for a conversion contract; it must be in orbit at the refinery
+func conversionFleet(w http.ResponseWriter, c ConversionContract, fleetID int, userID string) (FleetPayload, bool) {
+	var payload FleetPayload
+	var owner, system, status, plJson string
+	err := db.QueryRow("SELECT owner_uuid, origin_system, status, COALESCE(payload_json, '') FROM fleets WHERE id=?", fleetID).
+		Scan(&owner, &system, &status, &plJson)
+	if err != nil || owner != userID {
+		http.Error(w, "Fleet Not Found", 404)
+		return payload, false
+	}
+	if status != "ORBIT" || system != c.SystemID {
+		http.Error(w, "Fleet must be in orbit at "+c.SystemID, 400)
+		return payload, false
+	}
+	json.Unmarshal([]byte(plJson), &payload)
+	if payload.Resources == nil {
+		payload.Resources = make(map[string]int)
+	}
+	return payload, true
+}
+
+// POST {"id", "fleet_id", "quantity"}: unload ore into the hopper and escrow its fee. The first
+// delivery to an open offer makes you its customer. Quantity 0 unloads everything carried.
+func handleDeliverConversion(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	var req struct {
+		ID       string `json:"id" validate:"required"`
+		FleetID  int    `json:"fleet_id" validate:"required"`
+		Quantity int    `json:"quantity"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	defer lockRows(userRow(userID), "conversion:"+req.ID)()
+
+	c, err := loadConversion(req.ID)
+	if err != nil {
+		http.Error(w, "Contract Not Found", 404)
+		return
+	}
+	if c.RefinerUUID == userID {
+		http.Error(w, "Cannot use your own refinery contract", 400)
+		return
+	}
+	if c.DeadlineTick < atomic.LoadInt64(&CurrentTick) ||
+		!(c.Status == ContractOpen || (c.Status == ContractAccepted && c.Customer == userID)) {
+		http.Error(w, "Contract Not Open", 409)
+		return
+	}
+
+	if err := checkEmbargo(c.RefinerUUID, c.ColonyID, userID, c.SystemID); err != nil {
+		http.Error(w, err.Error(), 403)
+		return
+	}
+	payload, ok := conversionFleet(w, c, req.FleetID, userID)
+	if !ok {
+		return
+	}
+	n := payload.Resources[c.Input]
+	if req.Quantity > 0 && req.Quantity < n {
+		n = req.Quantity
+	}
+	if n <= 0 {
+		http.Error(w, "Fleet carries no "+c.Input, 400)
+		return
+	}
+	payload.Resources[c.Input] -= n
+	if payload.Resources[c.Input] == 0 {
+		delete(payload.Resources, c.Input)
+	}
+
+	fee := n * c.Fee
+	tx, _ := db.Begin()
+	if !escrowCredits(tx, userID, fee) {
+		tx.Rollback()
+		http.Error(w, "Insufficient Credits for Fee Escrow", 402)
+		return
+	}
+	newPl, _ := json.Marshal(payload)
+	tx.Exec("UPDATE fleets SET payload_json=? WHERE id=?", string(newPl), req.FleetID)
+	tx.Exec("UPDATE conversion_contracts SET hopper = hopper + ?, customer_uuid=?, status=? WHERE id=?",
+		n, userID, ContractAccepted, c.ID)
+	tx.Commit()
+
+	c.Hopper += n
+	c.Customer, c.Status = userID, ContractAccepted
+	eta := (c.Hopper + c.throughput() - 1) / c.throughput()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"contract":  c,
+		"delivered": n,
+		"fee":       fee,
+		"eta_ticks": eta,
+	})
+}
+
+// POST {"id", "fleet_id"}: load refined goods (and, once the contract has expired, leftover ore)
+func handleCollectConversion(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	var req struct {
+		ID      string `json:"id" validate:"required"`
+		FleetID int    `json:"fleet_id" validate:"required"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	defer lockRows(userRow(userID), "conversion:"+req.ID)()
+
+	c, err := loadConversion(req.ID)
+	if err != nil || c.Customer != userID {
+		http.Error(w, "Contract Not Found", 404)
+		return
+	}
+	if c.Status != ContractAccepted && c.Status != ContractExpired {
+		http.Error(w, "Nothing to collect", 409)
+		return
+	}
+
+	payload, ok := conversionFleet(w, c, req.FleetID, userID)
+	if !ok {
+		return
+	}
+	moved := make(map[string]int)
+	if c.Refined > 0 {
+		moved[c.Output] = c.Refined
+	}
+	if c.Status == ContractExpired && c.Hopper > 0 {
+		moved[c.Input] += c.Hopper
+	}
+	if len(moved) == 0 {
+		http.Error(w, "Nothing to collect yet", 409)
+		return
+	}
+	for item, n := range moved {
+		payload.Resources[item] = safeAdd(payload.Resources[item], n)
+	}
+
+	tx, _ := db.Begin()
+	newPl, _ := json.Marshal(payload)
+	tx.Exec("UPDATE fleets SET payload_json=? WHERE id=?", string(newPl), req.FleetID)
+	if c.Status == ContractExpired {
+		tx.Exec("UPDATE conversion_contracts SET refined=0, hopper=0, status=? WHERE id=?", ConversionClosed, c.ID)
+	} else {
+		tx.Exec("UPDATE conversion_contracts SET refined=0 WHERE id=?", c.ID)
+	}
+	tx.Commit()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(moved)
+}
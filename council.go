@@ -0,0 +1,418 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// --- Galactic Council ---
+// The elected leader puts federation-wide questions to a vote: a cap on every node's tolls
+// (toll_cap), switching a feature flag on or off everywhere (rule) or banning a rogue node
+// (ban_node). Its operator proposes from /admin/council; the proposal is signed by the leader's
+// key and broadcast as a federation transaction. Each node's operator answers with a signed
+// ballot (POST /admin/council/vote), broadcast the same way, and every node tallies the ballots
+// it holds itself: a ballot weighs 1 plus the voter's reputation as we see it, and our own
+// weighs the average of our non-hostile peers'. Once the ballots cast reach CouncilQuorum of the
+// whole electorate's weight the proposal is decided by weighted majority and, if it passed,
+// enacted on the spot. Proposals nobody decides by their deadline expire. GET /api/council
+// shows players what their federation is voting on.
+
+const (
+	CouncilToll = "toll_cap"
+	CouncilRule = "rule"
+	CouncilBan  = "ban_node"
+
+	CouncilQuorum      = 0.5  // share of the electorate's weight that must vote
+	CouncilVoteTicks   = 1000 // from proposal to deadline
+	MaxCouncilTitleLen = 120
+	CouncilListLimit   = 50
+
+	CouncilOpen     = "open"
+	CouncilEnacted  = "enacted"
+	CouncilRejected = "rejected"
+	CouncilExpired  = "expired"
+)
+
+type CouncilProposal struct {
+	ID           string  `json:"id"`
+	Proposer     string  `json:"proposer"` // the leader that put it to the vote
+	Kind         string  `json:"kind"`
+	Title        string  `json:"title"`
+	Transit      int     `json:"transit,omitempty"`   // toll_cap
+	TradePct     float64 `json:"trade_pct,omitempty"` // toll_cap
+	Feature      string  `json:"feature,omitempty"`   // rule
+	Enabled      bool    `json:"enabled,omitempty"`   // rule
+	Node         string  `json:"node,omitempty"`      // ban_node
+	CreatedTick  int64   `json:"created_tick"`
+	DeadlineTick int64   `json:"deadline_tick"`
+	Signature    string  `json:"signature"`
+
+	// Our view of the vote; not part of what the leader signed
+	Status string        `json:"status,omitempty"`
+	Tally  *CouncilTally `json:"tally,omitempty"`
+}
+
+type CouncilBallot struct {
+	ProposalID string `json:"proposal_id"`
+	Voter      string `json:"voter"`
+	Approve    bool   `json:"approve"`
+	Signature  string `json:"signature"` // ed25519 by Voter's key over signingString
+}
+
+type CouncilTally struct {
+	For        float64 `json:"for"`
+	Against    float64 `json:"against"`
+	Electorate float64 `json:"electorate"`
+	Ballots    int     `json:"ballots"`
+}
+
+// FED_TX payload carrying a proposal or a ballot
+type CouncilAnnouncement struct {
+	Proposal *CouncilProposal `json:"council_proposal,omitempty"`
+	Ballot   *CouncilBallot   `json:"council_ballot,omitempty"`
+}
+
+// The signed terms: everything but the signature and our local view
+func (p CouncilProposal) terms() CouncilProposal {
+	p.ID, p.Signature, p.Status, p.Tally = "", "", "", nil
+	return p
+}
+
+func (p *CouncilProposal) signingString() []byte {
+	return []byte(fmt.Sprintf("ownworld-council:%s:%s", p.ID, hashJSON(p.terms())))
+}
+
+func (b *CouncilBallot) signingString() []byte {
+	return []byte(fmt.Sprintf("ownworld-ballot:%s:%s:%t", b.ProposalID, b.Voter, b.Approve))
+}
+
+func councilProposalID(p *CouncilProposal) string {
+	return hashJSON(p.terms())[:16]
+}
+
+func checkCouncilProposal(p *CouncilProposal) error {
+	if len(p.Title) > MaxCouncilTitleLen {
+		return fmt.Errorf("Title Too Long")
+	}
+	switch p.Kind {
+	case CouncilToll:
+		if p.Transit < 0 || p.Transit > MaxTransitToll || p.TradePct < 0 || p.TradePct > MaxTradeTollPct {
+			return fmt.Errorf("Toll cap out of range (transit 0-10000, trade_pct 0-0.25)")
+		}
+	case CouncilRule:
+		if _, known := FeatureDefaults[p.Feature]; !known {
+			return fmt.Errorf("Unknown Feature")
+		}
+	case CouncilBan:
+		if p.Node == "" || p.Node == p.Proposer {
+			return fmt.Errorf("Invalid Node")
+		}
+	default:
+		return fmt.Errorf("Unknown Kind")
+	}
+	return nil
+}
+
+// Key to check a node's signature with: ours, or a non-hostile peer's
+func nodeKey(node string) (ed25519.PublicKey, bool) {
+	if node == ServerUUID {
+		return PublicKey, true
+	}
+	peerLock.RLock()
+	defer peerLock.RUnlock()
+	p, known := Peers[node]
+	if !known || p.Relation == 2 {
+		return nil, false
+	}
+	return p.PublicKey, true
+}
+
+func nodeSignatureValid(node string, msg []byte, sigHex string) bool {
+	key, ok := nodeKey(node)
+	sig, err := hex.DecodeString(sigHex)
+	return ok && err == nil && VerifySignature(key, msg, sig)
+}
+
+// Stores a proposal if it comes from the leader and is signed by it
+func recordCouncilProposal(p *CouncilProposal, senderID string) bool {
+	if p.Proposer != senderID || (senderID == ServerUUID && !IsLeader) || (senderID != ServerUUID && senderID != LeaderUUID) {
+		InfoLog.Printf("Ignoring council proposal from %s, which is not the leader", senderID)
+		return false
+	}
+	if p.ID != councilProposalID(p) || checkCouncilProposal(p) != nil || !nodeSignatureValid(p.Proposer, p.signingString(), p.Signature) {
+		return false
+	}
+	pJson, _ := json.Marshal(p.terms())
+	res, err := db.Exec(`INSERT OR IGNORE INTO council_proposals (id, proposer, proposal_json, signature, deadline_tick, status, received_at)
+	                     VALUES (?, ?, ?, ?, ?, ?, ?)`, p.ID, p.Proposer, string(pJson), p.Signature, p.DeadlineTick, CouncilOpen, time.Now().Unix())
+	if err != nil {
+		return false
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		InfoLog.Printf("🏛️ Council proposal %s from %s: %s", p.ID, p.Proposer, p.Title)
+	}
+	return true
+}
+
+// Stores a ballot from its voter on an open proposal, then counts the votes
+func recordCouncilBallot(b *CouncilBallot, senderID string) bool {
+	if b.Voter != senderID || !nodeSignatureValid(b.Voter, b.signingString(), b.Signature) {
+		return false
+	}
+	var status string
+	if db.QueryRow("SELECT status FROM council_proposals WHERE id=?", b.ProposalID).Scan(&status) != nil || status != CouncilOpen {
+		return false
+	}
+	res, err := db.Exec("INSERT OR IGNORE INTO council_ballots (proposal_id, voter_uuid, approve, signature) VALUES (?, ?, ?, ?)",
+		b.ProposalID, b.Voter, b.Approve, b.Signature)
+	if err != nil {
+		return false
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false // one ballot per node
+	}
+	tallyCouncil(b.ProposalID)
+	return true
+}
+
+func processCouncilAnnouncement(a *CouncilAnnouncement, senderID string) {
+	if a.Proposal != nil {
+		recordCouncilProposal(a.Proposal, senderID)
+	}
+	if a.Ballot != nil {
+		recordCouncilBallot(a.Ballot, senderID)
+	}
+}
+
+// Voting weight of every node in the electorate, ours included
+func councilWeights() map[string]float64 {
+	weights := make(map[string]float64)
+	peerLock.RLock()
+	sum := 0.0
+	for id, p := range Peers {
+		if p.Relation == 2 || p.Reputation < RepModel.HostileBelow {
+			continue
+		}
+		w := 1.0
+		if p.Reputation > 0 {
+			w += p.Reputation
+		}
+		weights[id] = w
+		sum += w
+	}
+	peerLock.RUnlock()
+	weights[ServerUUID] = 1
+	if n := len(weights) - 1; n > 0 {
+		weights[ServerUUID] = sum / float64(n)
+	}
+	return weights
+}
+
+func councilTally(id string) CouncilTally {
+	weights := councilWeights()
+	var t CouncilTally
+	for _, w := range weights {
+		t.Electorate += w
+	}
+	rows, err := db.Query("SELECT voter_uuid, approve FROM council_ballots WHERE proposal_id=?", id)
+	if err != nil {
+		return t
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var voter string
+		var approve bool
+		rows.Scan(&voter, &approve)
+		w, counted := weights[voter]
+		if !counted {
+			continue // since banned or turned hostile
+		}
+		t.Ballots++
+		if approve {
+			t.For += w
+		} else {
+			t.Against += w
+		}
+	}
+	return t
+}
+
+// Decides an open proposal once quorum is reached, enacting it if it passed
+func tallyCouncil(id string) {
+	t := councilTally(id)
+	if t.Electorate == 0 || t.For+t.Against < CouncilQuorum*t.Electorate {
+		return
+	}
+	status := CouncilRejected
+	if t.For > t.Against {
+		status = CouncilEnacted
+	}
+	res, err := db.Exec("UPDATE council_proposals SET status=?, decided_tick=? WHERE id=? AND status=?",
+		status, atomic.LoadInt64(&CurrentTick), id, CouncilOpen)
+	if err != nil {
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return
+	}
+	InfoLog.Printf("🏛️ Council proposal %s %s (%.1f for, %.1f against of %.1f)", id, status, t.For, t.Against, t.Electorate)
+	if status == CouncilEnacted {
+		if p, ok := loadCouncilProposal(id); ok {
+			enactCouncilProposal(p)
+		}
+	}
+}
+
+func enactCouncilProposal(p CouncilProposal) {
+	switch p.Kind {
+	case CouncilToll:
+		setTollCap(&TollSchedule{Transit: p.Transit, TradePct: p.TradePct})
+		InfoLog.Printf("🏛️ Council capped tolls at transit %d, trade %.1f%%", p.Transit, p.TradePct*100)
+	case CouncilRule:
+		setFeatureFlag(p.Feature, p.Enabled)
+		InfoLog.Printf("🏛️ Council set feature %s to %v", p.Feature, p.Enabled)
+	case CouncilBan:
+		if p.Node == ServerUUID {
+			ErrorLog.Printf("🏛️ The council voted to ban this node")
+			return
+		}
+		peerLock.Lock()
+		if peer, known := Peers[p.Node]; known {
+			peer.Relation = 2
+			savePeer(peer)
+		}
+		peerLock.Unlock()
+		InfoLog.Printf("🏛️ Council banned node %s", p.Node)
+	}
+}
+
+// Open proposals past their deadline expire undecided
+func expireCouncilProposals(current int64) {
+	db.Exec("UPDATE council_proposals SET status=?, decided_tick=? WHERE status=? AND deadline_tick < ?",
+		CouncilExpired, current, CouncilOpen, current)
+}
+
+func scanCouncilProposals(query string, args ...interface{}) []CouncilProposal {
+	list := []CouncilProposal{}
+	rows, err := db.Query("SELECT id, proposal_json, signature, status FROM council_proposals "+query, args...)
+	if err != nil {
+		return list
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p CouncilProposal
+		var id, pJson, sig, status string
+		rows.Scan(&id, &pJson, &sig, &status)
+		json.Unmarshal([]byte(pJson), &p)
+		p.ID, p.Signature, p.Status = id, sig, status
+		list = append(list, p)
+	}
+	for i := range list {
+		t := councilTally(list[i].ID)
+		list[i].Tally = &t
+	}
+	return list
+}
+
+func loadCouncilProposal(id string) (CouncilProposal, bool) {
+	list := scanCouncilProposals("WHERE id=?", id)
+	if len(list) == 0 {
+		return CouncilProposal{}, false
+	}
+	return list[0], true
+}
+
+// GET: proposals before the federation, newest first
+func handleCouncil(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(scanCouncilProposals("ORDER BY received_at DESC, id LIMIT ?", CouncilListLimit))
+}
+
+// GET: proposals, newest first. POST {"kind", "title", "transit", "trade_pct", "feature",
+// "enabled", "node"}: puts a question to the federation; only the leader may.
+func handleAdminCouncil(w http.ResponseWriter, r *http.Request) {
+	if !authenticateAdmin(r) {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var req CouncilProposal
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		if !IsLeader {
+			http.Error(w, "Only the leader may propose (leader: "+LeaderUUID+")", 409)
+			return
+		}
+		p := req.terms()
+		p.Proposer = ServerUUID
+		p.CreatedTick = atomic.LoadInt64(&CurrentTick)
+		p.DeadlineTick = p.CreatedTick + CouncilVoteTicks
+		if p.Title == "" {
+			p.Title = p.Kind
+		}
+		if err := checkCouncilProposal(&p); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		p.ID = councilProposalID(&p)
+		p.Signature = hex.EncodeToString(SignMessage(PrivateKey, p.signingString()))
+		if !recordCouncilProposal(&p, ServerUUID) {
+			http.Error(w, "Proposal Rejected", 500)
+			return
+		}
+		payload, _ := json.Marshal(CouncilAnnouncement{Proposal: &p})
+		broadcastTransaction(payload)
+
+		p, _ = loadCouncilProposal(p.ID)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(p)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(scanCouncilProposals("ORDER BY received_at DESC, id LIMIT ?", CouncilListLimit))
+}
+
+// POST {"proposal_id", "approve"}: casts this node's ballot and broadcasts it
+func handleAdminCouncilVote(w http.ResponseWriter, r *http.Request) {
+	if !authenticateAdmin(r) {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+	var req struct {
+		ProposalID string `json:"proposal_id" validate:"required"`
+		Approve    *bool  `json:"approve" validate:"required"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	p, ok := loadCouncilProposal(req.ProposalID)
+	if !ok {
+		http.Error(w, "Proposal Not Found", 404)
+		return
+	}
+	if p.Status != CouncilOpen {
+		http.Error(w, "Voting Closed ("+p.Status+")", 409)
+		return
+	}
+	b := CouncilBallot{ProposalID: p.ID, Voter: ServerUUID, Approve: *req.Approve}
+	b.Signature = hex.EncodeToString(SignMessage(PrivateKey, b.signingString()))
+	if !recordCouncilBallot(&b, ServerUUID) {
+		http.Error(w, "Already Voted", 409)
+		return
+	}
+	payload, _ := json.Marshal(CouncilAnnouncement{Ballot: &b})
+	broadcastTransaction(payload)
+
+	p, _ = loadCouncilProposal(p.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
@@ -0,0 +1,68 @@
+package main
+
+// --- Culture & Heritage ---
+// Each colony accumulates culture from stability and elite wine consumption. Children
+// inherit part of their parent's culture at founding and keep drifting toward it.
+// The owner's summed culture unlocks empire-wide bonuses at fixed thresholds.
+
+const (
+	BasePolicySlots = 2
+	// Share of the parent's culture a new colony is founded with
+	CultureInheritance = 0.5
+	// Per-tick pull of a child's culture toward a more cultured parent
+	CultureDrift = 0.01
+)
+
+type CultureTier struct {
+	Threshold      float64 `json:"threshold"`
+	PolicySlots    int     `json:"policy_slots"`    // extra slots on top of BasePolicySlots
+	PromotionBonus int     `json:"promotion_bonus"` // extra laborers promoted per academy tick
+}
+
+var CultureTiers = []CultureTier{
+	{Threshold: 100, PolicySlots: 1},
+	{Threshold: 500, PromotionBonus: 5},
+	{Threshold: 1000, PolicySlots: 1},
+	{Threshold: 5000, PolicySlots: 1, PromotionBonus: 5},
+}
+
+type EmpireCulture struct {
+	Total         float64 `json:"total"`
+	PolicySlots   int     `json:"policy_slots"`
+	PromotionRate int     `json:"promotion_rate"`
+	NextThreshold float64 `json:"next_threshold"`
+}
+
+func cultureBonuses(total float64) EmpireCulture {
+	ec := EmpireCulture{Total: total, PolicySlots: BasePolicySlots, PromotionRate: 5}
+	for _, t := range CultureTiers {
+		if total < t.Threshold {
+			ec.NextThreshold = t.Threshold
+			break
+		}
+		ec.PolicySlots += t.PolicySlots
+		ec.PromotionRate += t.PromotionBonus
+	}
+	return ec
+}
+
+func empireCulture(owner string) EmpireCulture {
+	var total float64
+	db.QueryRow("SELECT COALESCE(SUM(culture), 0) FROM colonies WHERE owner_uuid=?", owner).Scan(&total)
+	return cultureBonuses(total)
+}
+
+// Culture change for one tick, given last tick's parent culture (0 if none)
+func cultureGrowth(c *Colony, parentCulture float64, wineConsumed int) float64 {
+	growth := 0.0
+	if c.StabilityCurrent >= 80.0 {
+		growth += 0.1
+	} else if c.StabilityCurrent < 30.0 {
+		growth -= 0.05
+	}
+	growth += float64(wineConsumed) * 0.01
+	if parentCulture > c.Culture {
+		growth += (parentCulture - c.Culture) * CultureDrift
+	}
+	return growth
+}
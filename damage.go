@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+)
+
+// --- Module Damage & Repair ---
+// Every fitted module has a condition from 1 (fully operational) down to 0 (wrecked), stored in
+// module_condition_json alongside modules_json, entry for entry; a missing entry is a module in
+// full condition. A fleet that survives a battle comes out with every module worn by CombatWear
+// times the share of its structure it lost. Stars wear modules too: an O-type star scorches a
+// fleet without a heat_shield (OTypeWear) and black hole dilation strains one without a
+// gravity_dampener (DilationWear). A worn weapon hits in proportion to its condition, and a worn
+// engine gives that share of its speedup (it burns fuel all the same). POST /api/fleet/repair
+// restores a fleet in orbit over one of its owner's colonies with a shipyard, for RepairSteel
+// steel per whole module's worth of condition and HullRepairSteel per point of hull damage
+// carried over from battle (see combat.go). Refits keep modules that stay fitted in the
+// condition they were in; a worn module taken off is scrapped rather than returned to stock.
+
+const (
+	CombatWear   = 1.0
+	OTypeWear    = 0.2
+	DilationWear = 0.3
+	RepairSteel  = 20
+
+	HullRepairSteel = 0.2
+)
+
+func parseCondition(s string) []float64 {
+	var cond []float64
+	json.Unmarshal([]byte(s), &cond)
+	return cond
+}
+
+// Condition of the i-th fitted module
+func conditionAt(cond []float64, i int) float64 {
+	if i < len(cond) {
+		return cond[i]
+	}
+	return 1
+}
+
+// Condition for n modules after wear, floored at 0
+func wornCondition(cond []float64, n int, wear float64) []float64 {
+	out := make([]float64, n)
+	for i := range out {
+		out[i] = math.Max(0, conditionAt(cond, i)-wear)
+	}
+	return out
+}
+
+func isDamaged(cond []float64) bool {
+	for _, c := range cond {
+		if c < 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// Wears every module on a fleet; used for hazards, where the arrival holds no condition
+func wearModules(fleetID int, wear float64) {
+	var modJson, condJson string
+	if db.QueryRow("SELECT COALESCE(modules_json, '[]'), COALESCE(module_condition_json, '') FROM fleets WHERE id=?", fleetID).
+		Scan(&modJson, &condJson) != nil {
+		return
+	}
+	var modules []string
+	json.Unmarshal([]byte(modJson), &modules)
+	if len(modules) == 0 {
+		return
+	}
+	cJson, _ := json.Marshal(wornCondition(parseCondition(condJson), len(modules), wear))
+	db.Exec("UPDATE fleets SET module_condition_json=? WHERE id=?", string(cJson), fleetID)
+}
+
+// Wear from a battle: CombatWear times the share of structure lost
+func battleWear(p BattleParticipant) float64 {
+	if p.StartHP <= 0 || p.EndHP >= p.StartHP {
+		return 0
+	}
+	return CombatWear * float64(p.StartHP-p.EndHP) / float64(p.StartHP)
+}
+
+// Conditions left after sabotage, matching withoutModules entry for entry
+func withoutConditions(modules []string, cond []float64, removed []string) []float64 {
+	gone := make(map[string]int)
+	for _, m := range removed {
+		gone[m]++
+	}
+	kept := []float64{}
+	for i, m := range modules {
+		if gone[m] > 0 {
+			gone[m]--
+			continue
+		}
+		kept = append(kept, conditionAt(cond, i))
+	}
+	return kept
+}
+
+// Matches a refit's modules to those already fitted: a module that stays keeps its condition and
+// new ones come in at full condition. Returns the new conditions and the modules taken off in
+// full condition, the only ones that can go back to stock.
+func refitCondition(old []string, oldCond []float64, fitted []string) (cond []float64, returned []string) {
+	used := make([]bool, len(old))
+	cond = make([]float64, len(fitted))
+	for i, m := range fitted {
+		cond[i] = 1
+		// Keep the worst of a kind fitted, so a refit can't be used to repair
+		best := -1
+		for j, o := range old {
+			if !used[j] && o == m && (best < 0 || conditionAt(oldCond, j) < conditionAt(oldCond, best)) {
+				best = j
+			}
+		}
+		if best >= 0 {
+			used[best] = true
+			cond[i] = conditionAt(oldCond, best)
+		}
+	}
+	for j, o := range old {
+		if !used[j] && conditionAt(oldCond, j) >= 1 {
+			returned = append(returned, o)
+		}
+	}
+	return cond, returned
+}
+
+// Steel to bring every module back to full condition
+func repairCost(cond []float64) int {
+	missing := 0.0
+	for _, c := range cond {
+		missing += 1 - c
+	}
+	return int(math.Ceil(missing*RepairSteel - 1e-9))
+}
+
+func hullRepairCost(damage int) int {
+	if damage <= 0 {
+		return 0
+	}
+	return int(math.Ceil(float64(damage)*HullRepairSteel - 1e-9))
+}
+
+// POST {"fleet_id"}: repairs the hull and every module on a fleet orbiting one of your colonies with a shipyard
+func handleFleetRepair(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	var req struct {
+		FleetID int `json:"fleet_id" validate:"required"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	defer lockRows(userRow(userID))()
+
+	var owner, status, sysID, modJson, condJson string
+	var hullDamage int
+	err = db.QueryRow("SELECT owner_uuid, status, origin_system, COALESCE(modules_json, '[]'), COALESCE(module_condition_json, ''), COALESCE(hull_damage, 0) FROM fleets WHERE id=?", req.FleetID).
+		Scan(&owner, &status, &sysID, &modJson, &condJson, &hullDamage)
+	if err != nil {
+		http.Error(w, "Fleet Not Found", 404)
+		return
+	}
+	if owner != userID {
+		http.Error(w, "Access Denied", 403)
+		return
+	}
+	if status != "ORBIT" {
+		http.Error(w, "Fleet must be in orbit", 400)
+		return
+	}
+
+	var colID int
+	var bJson string
+	err = db.QueryRow("SELECT id, buildings_json FROM colonies WHERE system_id=? AND owner_uuid=? AND COALESCE(site_type, 'planet')='planet'", sysID, userID).Scan(&colID, &bJson)
+	if err != nil {
+		http.Error(w, "No Friendly Colony in System", 400)
+		return
+	}
+	buildings := make(map[string]int)
+	json.Unmarshal([]byte(bJson), &buildings)
+	if buildings["shipyard"] < 1 {
+		http.Error(w, "Shipyard Required", 400)
+		return
+	}
+
+	var modules []string
+	json.Unmarshal([]byte(modJson), &modules)
+	cond := wornCondition(parseCondition(condJson), len(modules), 0)
+	cost := repairCost(cond) + hullRepairCost(hullDamage)
+	if cost == 0 {
+		w.Write([]byte("Fleet Needs No Repair"))
+		return
+	}
+	res, err := db.Exec("UPDATE colonies SET steel = steel - ? WHERE id=? AND steel >= ?", cost, colID, cost)
+	if err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, fmt.Sprintf("Insufficient Steel (need %d)", cost), 402)
+		return
+	}
+	db.Exec("UPDATE fleets SET module_condition_json='', hull_damage=0 WHERE id=?", req.FleetID)
+
+	w.Write([]byte(fmt.Sprintf("Fleet Repaired (%d steel)", cost)))
+}
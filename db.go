@@ -5,23 +5,113 @@ import (
 	"crypto/rand"
 	"database/sql"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"os"
 	"time"
 
-	"lukechampine.com/blake3"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 func initDB() {
-	os.MkdirAll("./data", 0755)
+	os.MkdirAll(DataDir, 0755)
 
 	var err error
-	db, err = sql.Open("sqlite3", DBPath+"?_journal_mode=WAL&_busy_timeout=5000")
-	if err != nil { panic(err) }
+	db, err = openDB("sqlite3", DBPath+"?_journal_mode=WAL&_busy_timeout=1000&_txlock=immediate", DBMaxOpenConns)
+	if err != nil {
+		panic(err)
+	}
 
 	db.Exec("PRAGMA journal_mode=WAL;")
 
+	if err := createSchema(); err != nil {
+		panic(err)
+	}
+	initIdentity()
+}
+
+// Columns added to tables after they first shipped, in order. A database from before any of
+// them is brought up to date by applying them all; the schema tests check that this ends up
+// identical to a fresh database.
+var schemaMigrations = []string{
+	"ALTER TABLE colonies ADD COLUMN parent_colony_id INTEGER DEFAULT 0",
+	"ALTER TABLE colonies ADD COLUMN steel INTEGER DEFAULT 0",
+	"ALTER TABLE colonies ADD COLUMN wine INTEGER DEFAULT 0",
+	"ALTER TABLE colonies ADD COLUMN policies_json TEXT DEFAULT '{}'",
+	"ALTER TABLE fleets ADD COLUMN payload_json TEXT",
+	"ALTER TABLE fleets ADD COLUMN target_order_id TEXT", // New migration
+	"ALTER TABLE fleets ADD COLUMN home_system TEXT",
+	"ALTER TABLE fleets ADD COLUMN auto_return BOOLEAN DEFAULT 0",
+
+	// New Materials Migrations
+	"ALTER TABLE colonies ADD COLUMN platinum_ore INTEGER DEFAULT 0",
+	"ALTER TABLE colonies ADD COLUMN uranium_ore INTEGER DEFAULT 0",
+	"ALTER TABLE colonies ADD COLUMN diamond_ore INTEGER DEFAULT 0",
+	"ALTER TABLE colonies ADD COLUMN plutonium INTEGER DEFAULT 0",
+	"ALTER TABLE colonies ADD COLUMN stability_json TEXT DEFAULT '{}'",
+
+	"ALTER TABLE grievances ADD COLUMN reparations_paid INTEGER DEFAULT 0",
+	"ALTER TABLE colonies ADD COLUMN collapse_ticks INTEGER DEFAULT 0",
+	"ALTER TABLE colonies ADD COLUMN culture REAL DEFAULT 0",
+	"ALTER TABLE colonies ADD COLUMN terraform REAL DEFAULT 0",
+	"ALTER TABLE fleets ADD COLUMN experience INTEGER DEFAULT 0",
+	"ALTER TABLE colonies ADD COLUMN module_stock_json TEXT DEFAULT '{}'",
+	"ALTER TABLE colonies ADD COLUMN module_queue_json TEXT DEFAULT '[]'",
+	"ALTER TABLE colonies ADD COLUMN unrest_ticks INTEGER DEFAULT 0",
+	"ALTER TABLE colonies ADD COLUMN airless_ticks INTEGER DEFAULT 0",
+	"ALTER TABLE fleets ADD COLUMN bombard_target TEXT DEFAULT 'industry'",
+	"ALTER TABLE fleets ADD COLUMN build_remaining INTEGER DEFAULT 0",
+	"ALTER TABLE fleets ADD COLUMN route_fuel INTEGER DEFAULT 0",
+	"ALTER TABLE solar_systems ADD COLUMN name TEXT",
+	"ALTER TABLE solar_systems ADD COLUMN discoverer_uuid TEXT",
+	"ALTER TABLE solar_systems ADD COLUMN named_tick INTEGER DEFAULT 0",
+	"ALTER TABLE peers ADD COLUMN grudge REAL DEFAULT 0",
+	"ALTER TABLE users ADD COLUMN capital_colony_id INTEGER",
+	"ALTER TABLE users ADD COLUMN capital_moved_tick INTEGER",
+
+	// Delta Snapshots
+	"ALTER TABLE daily_snapshots ADD COLUMN delta_blob BLOB",
+	"ALTER TABLE daily_snapshots ADD COLUMN is_checkpoint BOOLEAN DEFAULT 1",
+
+	// Patrols
+	"ALTER TABLE fleets ADD COLUMN patrol_json TEXT DEFAULT ''",
+
+	// Arbitration
+	"ALTER TABLE battle_reports ADD COLUMN inputs_json TEXT DEFAULT ''",
+
+	// Public profiles
+	"ALTER TABLE users ADD COLUMN created_at INTEGER DEFAULT 0",
+
+	// Workforce
+	"ALTER TABLE colonies ADD COLUMN workforce_json TEXT DEFAULT ''",
+
+	// Cross-node settlement
+	"ALTER TABLE market_orders ADD COLUMN origin_node TEXT DEFAULT ''",
+
+	// Session expiry
+	"ALTER TABLE users ADD COLUMN expires_at INTEGER DEFAULT 0",
+
+	// Economic automation
+	"ALTER TABLE colonies ADD COLUMN automation_json TEXT DEFAULT ''",
+
+	// Module damage
+	"ALTER TABLE fleets ADD COLUMN module_condition_json TEXT DEFAULT ''",
+
+	// Research
+	"ALTER TABLE users ADD COLUMN research_points INTEGER DEFAULT 0",
+
+	// Outposts
+	"ALTER TABLE colonies ADD COLUMN site_type TEXT DEFAULT 'planet'",
+
+	// Derived node locations
+	"ALTER TABLE peers ADD COLUMN location_salt INTEGER",
+
+	// Hull damage
+	"ALTER TABLE fleets ADD COLUMN hull_damage INTEGER DEFAULT 0",
+}
+
+// Tables, indexes and column migrations. Idempotent; tests run it against :memory: too.
+func createSchema() error {
 	schema := `
 	CREATE TABLE IF NOT EXISTS system_meta (key TEXT PRIMARY KEY, value TEXT);
 
@@ -34,7 +124,10 @@ func initDB() {
 		is_local BOOLEAN DEFAULT 1,
 		ed25519_pubkey TEXT,
 		ed25519_priv_enc TEXT,
-		session_token TEXT
+		session_token TEXT,
+		created_at INTEGER DEFAULT 0,
+		expires_at INTEGER DEFAULT 0,
+		research_points INTEGER DEFAULT 0
 	);
 
 	CREATE TABLE IF NOT EXISTS solar_systems (
@@ -74,7 +167,18 @@ func initDB() {
 		stability_target REAL DEFAULT 100.0,
 		martial_law BOOLEAN DEFAULT 0,
 		buildings_json TEXT,
-		policies_json TEXT DEFAULT '{}'
+		policies_json TEXT DEFAULT '{}',
+		automation_json TEXT DEFAULT '',
+		stability_json TEXT DEFAULT '{}',
+		collapse_ticks INTEGER DEFAULT 0,
+		culture REAL DEFAULT 0,
+		terraform REAL DEFAULT 0,
+		airless_ticks INTEGER DEFAULT 0,
+		module_stock_json TEXT DEFAULT '{}',
+		module_queue_json TEXT DEFAULT '[]',
+		unrest_ticks INTEGER DEFAULT 0,
+		workforce_json TEXT DEFAULT '',
+		site_type TEXT DEFAULT 'planet'
 	);
 
 	CREATE TABLE IF NOT EXISTS fleets (
@@ -89,8 +193,13 @@ func initDB() {
 		
 		hull_class TEXT,
 		modules_json TEXT,
+		module_condition_json TEXT DEFAULT '',
 		payload_json TEXT, 
         target_order_id TEXT,
+		home_system TEXT,
+		auto_return BOOLEAN DEFAULT 0,
+		experience INTEGER DEFAULT 0,
+		hull_damage INTEGER DEFAULT 0,
 		
 		ark_ship INTEGER DEFAULT 0, 
 		fighters INTEGER DEFAULT 0,
@@ -109,14 +218,39 @@ func initDB() {
         is_buy BOOLEAN,
         origin_system TEXT,
         expires_tick INTEGER,
-        signature TEXT
+        signature TEXT,
+        origin_node TEXT DEFAULT ''
     );
 
 	CREATE TABLE IF NOT EXISTS transaction_log (
 		id INTEGER PRIMARY KEY AUTOINCREMENT, tick INTEGER, action_type TEXT, payload_blob BLOB
 	);
 	CREATE TABLE IF NOT EXISTS daily_snapshots (
-		day_id INTEGER PRIMARY KEY, state_blob BLOB, final_hash TEXT
+		day_id INTEGER PRIMARY KEY, state_blob BLOB, final_hash TEXT,
+		delta_blob BLOB, is_checkpoint BOOLEAN DEFAULT 1
+	);
+
+	CREATE TABLE IF NOT EXISTS battle_reports (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		system_id TEXT,
+		tick INTEGER,
+		report_json TEXT,
+		inputs_json TEXT DEFAULT ''
+	);
+
+	CREATE TABLE IF NOT EXISTS bombardment_reports (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		tick INTEGER,
+		colony_id INTEGER,
+		attacker_uuid TEXT,
+		defender_uuid TEXT,
+		report_json TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS battle_participants (
+		battle_id INTEGER,
+		owner_uuid TEXT,
+		PRIMARY KEY (battle_id, owner_uuid)
 	);
 
 	CREATE TABLE IF NOT EXISTS grievances (
@@ -125,26 +259,423 @@ func initDB() {
 		victim_uuid TEXT,
 		damage_amount INTEGER,
 		tick INTEGER,
-		signature TEXT
+		signature TEXT,
+		reparations_paid INTEGER DEFAULT 0
+	);
+
+	CREATE TABLE IF NOT EXISTS colony_governors (
+		colony_id INTEGER,
+		governor_uuid TEXT,
+		granted_by TEXT,
+		PRIMARY KEY (colony_id, governor_uuid)
+	);
+
+	CREATE TABLE IF NOT EXISTS immigration_queue (
+		uuid TEXT PRIMARY KEY,
+		request_json TEXT,
+		priority INTEGER DEFAULT 0,
+		status TEXT DEFAULT 'pending',
+		attempts INTEGER DEFAULT 0,
+		next_attempt INTEGER DEFAULT 0,
+		last_error TEXT,
+		received_at INTEGER
+	);
+
+	CREATE TABLE IF NOT EXISTS factions (
+		uuid TEXT PRIMARY KEY,
+		name TEXT,
+		origin_colony_id INTEGER,
+		former_owner TEXT,
+		founded_tick INTEGER,
+		playable BOOLEAN DEFAULT 0
+	);
+
+	CREATE TABLE IF NOT EXISTS faction_relations (
+		faction_uuid TEXT,
+		other_uuid TEXT,
+		stance TEXT DEFAULT 'neutral',
+		PRIMARY KEY (faction_uuid, other_uuid)
+	);
+
+	CREATE TABLE IF NOT EXISTS contracts (
+		id TEXT PRIMARY KEY,
+		issuer_uuid TEXT,
+		contractor_uuid TEXT,
+		dest_system TEXT,
+		items_json TEXT,
+		delivered_json TEXT DEFAULT '{}',
+		reward INTEGER,
+		collateral INTEGER DEFAULT 0,
+		status TEXT,
+		created_tick INTEGER,
+		deadline_tick INTEGER
+	);
+
+	CREATE TABLE IF NOT EXISTS conversion_contracts (
+		id TEXT PRIMARY KEY,
+		refiner_uuid TEXT,
+		customer_uuid TEXT,
+		colony_id INTEGER,
+		system_id TEXT,
+		building TEXT,
+		lines INTEGER,
+		fee INTEGER,
+		hopper INTEGER DEFAULT 0,
+		refined INTEGER DEFAULT 0,
+		status TEXT,
+		created_tick INTEGER,
+		deadline_tick INTEGER
+	);
+
+	CREATE TABLE IF NOT EXISTS login_failures (
+		username TEXT PRIMARY KEY,
+		failures INTEGER DEFAULT 0,
+		locked_until INTEGER DEFAULT 0,
+		last_failure INTEGER DEFAULT 0
+	);
+
+	CREATE TABLE IF NOT EXISTS webhooks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		owner_uuid TEXT,
+		url TEXT,
+		events TEXT,
+		secret TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		webhook_id INTEGER,
+		event TEXT,
+		payload BLOB,
+		attempts INTEGER DEFAULT 0,
+		next_attempt INTEGER,
+		status TEXT DEFAULT 'pending',
+		last_error TEXT,
+		created_at INTEGER
+	);
+
+	CREATE TABLE IF NOT EXISTS world_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		origin_uuid TEXT,
+		remote_id INTEGER DEFAULT 0,
+		kind TEXT,
+		title TEXT,
+		multiplier REAL DEFAULT 0,
+		x INTEGER DEFAULT 0,
+		y INTEGER DEFAULT 0,
+		z INTEGER DEFAULT 0,
+		radius INTEGER DEFAULT 0,
+		system_id TEXT DEFAULT '',
+		fleets INTEGER DEFAULT 0,
+		start_tick INTEGER,
+		end_tick INTEGER,
+		status TEXT,
+		fleet_ids_json TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS embargoes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		owner_uuid TEXT,
+		colony_id INTEGER DEFAULT 0,
+		target_uuid TEXT,
+		reason TEXT,
+		created_tick INTEGER,
+		UNIQUE (owner_uuid, colony_id, target_uuid)
+	);
+
+	CREATE TABLE IF NOT EXISTS patrol_sightings (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		owner_uuid TEXT,
+		fleet_id INTEGER,
+		system_id TEXT,
+		tick INTEGER,
+		hostile_owner TEXT,
+		hostile_fleets INTEGER
+	);
+
+	CREATE TABLE IF NOT EXISTS arbitration_verdicts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		arbiter_uuid TEXT,
+		system_id TEXT,
+		tick INTEGER,
+		claimants_json TEXT,
+		liars_json TEXT,
+		outcome TEXT,
+		received_at INTEGER,
+		UNIQUE(arbiter_uuid, system_id, tick)
+	);
+
+	CREATE TABLE IF NOT EXISTS surveys (
+		user_uuid TEXT,
+		system_id TEXT,
+		tick INTEGER,
+		PRIMARY KEY (user_uuid, system_id)
+	);
+
+	CREATE TABLE IF NOT EXISTS beacons (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		owner_uuid TEXT,
+		name TEXT,
+		x INTEGER,
+		y INTEGER,
+		z INTEGER,
+		shared BOOLEAN DEFAULT 0,
+		placed_tick INTEGER,
+		UNIQUE(owner_uuid, name)
+	);
+
+	CREATE TABLE IF NOT EXISTS settlements (
+		id TEXT PRIMARY KEY,
+		role TEXT,
+		peer_uuid TEXT,
+		order_id TEXT,
+		item TEXT,
+		quantity INTEGER,
+		price INTEGER,
+		is_buy BOOLEAN,
+		system_id TEXT,
+		order_expires INTEGER,
+		fleet_id INTEGER DEFAULT 0,
+		fleet_owner TEXT,
+		colony_id INTEGER DEFAULT 0,
+		order_owner TEXT,
+		status TEXT,
+		acked BOOLEAN DEFAULT 0,
+		deadline_tick INTEGER,
+		receipt_json TEXT DEFAULT '',
+		created_tick INTEGER
+	);
+	CREATE INDEX IF NOT EXISTS idx_settlements_status ON settlements(status, role);
+
+	CREATE TABLE IF NOT EXISTS wrecks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		system_id TEXT,
+		fleet_id INTEGER,
+		owner_uuid TEXT,
+		hull_class TEXT,
+		resources_json TEXT,
+		created_tick INTEGER,
+		expires_tick INTEGER
+	);
+	CREATE INDEX IF NOT EXISTS idx_wrecks_system ON wrecks(system_id);
+
+	CREATE TABLE IF NOT EXISTS passkeys (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_uuid TEXT,
+		credential_id TEXT UNIQUE,
+		public_key BLOB,
+		algorithm INTEGER,
+		sign_count INTEGER DEFAULT 0,
+		name TEXT,
+		created_at INTEGER,
+		last_used INTEGER DEFAULT 0
+	);
+	CREATE INDEX IF NOT EXISTS idx_passkeys_user ON passkeys(user_uuid);
+
+	CREATE TABLE IF NOT EXISTS user_preferences (
+		user_uuid TEXT,
+		namespace TEXT,
+		value_json TEXT,
+		version INTEGER DEFAULT 1,
+		updated_at INTEGER,
+		PRIMARY KEY (user_uuid, namespace)
+	);
+
+	CREATE TABLE IF NOT EXISTS council_proposals (
+		id TEXT PRIMARY KEY,
+		proposer TEXT,
+		proposal_json TEXT,
+		signature TEXT,
+		deadline_tick INTEGER,
+		status TEXT DEFAULT 'open',
+		decided_tick INTEGER DEFAULT 0,
+		received_at INTEGER
+	);
+
+	CREATE TABLE IF NOT EXISTS council_ballots (
+		proposal_id TEXT,
+		voter_uuid TEXT,
+		approve BOOLEAN,
+		signature TEXT,
+		PRIMARY KEY (proposal_id, voter_uuid)
+	);
+
+	CREATE TABLE IF NOT EXISTS technologies (
+		user_uuid TEXT,
+		tech TEXT,
+		researched_tick INTEGER,
+		PRIMARY KEY (user_uuid, tech)
+	);
+
+	CREATE TABLE IF NOT EXISTS registration_codes (
+		code TEXT PRIMARY KEY,
+		uses_left INTEGER,
+		expires_at INTEGER,
+		created_at INTEGER
+	);
+
+	CREATE TABLE IF NOT EXISTS registrations (
+		ip TEXT,
+		created_at INTEGER
+	);
+	CREATE INDEX IF NOT EXISTS idx_registrations_ip ON registrations(ip, created_at);
+
+	CREATE TABLE IF NOT EXISTS cancelled_orders (
+		order_id TEXT PRIMARY KEY,
+		origin_node TEXT,
+		signature TEXT,
+		cancelled_tick INTEGER
+	);
+
+	CREATE TABLE IF NOT EXISTS federation_changes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		tick INTEGER,
+		kind TEXT,
+		subject TEXT,
+		removed BOOLEAN DEFAULT 0,
+		data_json TEXT DEFAULT ''
+	);
+	CREATE INDEX IF NOT EXISTS idx_federation_changes_tick ON federation_changes(tick);
+
+	CREATE TABLE IF NOT EXISTS account_recovery (
+		user_uuid TEXT PRIMARY KEY,
+		email TEXT,
+		email_verified BOOLEAN DEFAULT 0,
+		key_escrow TEXT,
+		code_hash TEXT,
+		key_by_code TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS account_tokens (
+		token_hash TEXT PRIMARY KEY,
+		user_uuid TEXT,
+		purpose TEXT,
+		email TEXT,
+		created_at INTEGER,
+		expires_at INTEGER
+	);
+	CREATE INDEX IF NOT EXISTS idx_account_tokens_user ON account_tokens(user_uuid, purpose);
+
+	CREATE TABLE IF NOT EXISTS refugee_flows (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		owner_uuid TEXT,
+		from_colony INTEGER,
+		to_colony INTEGER,
+		remaining INTEGER,
+		per_tick INTEGER,
+		cause TEXT,
+		started_tick INTEGER
+	);
+
+	CREATE TABLE IF NOT EXISTS federation_outbox (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		peer_uuid TEXT,
+		peer_url TEXT,
+		payload BLOB,
+		attempts INTEGER DEFAULT 0,
+		next_attempt INTEGER,
+		status TEXT DEFAULT 'pending',
+		last_error TEXT,
+		created_at INTEGER
+	);
+
+	CREATE TABLE IF NOT EXISTS peers (
+		uuid TEXT PRIMARY KEY,
+		url TEXT,
+		public_key TEXT,
+		genesis_hash TEXT,
+		location_json TEXT,
+		location_salt INTEGER,
+		features_json TEXT,
+		relation INTEGER DEFAULT 0,
+		reputation REAL DEFAULT 10,
+		grudge REAL DEFAULT 0,
+		first_seen INTEGER,
+		last_seen INTEGER
+	);
+
+	CREATE TABLE IF NOT EXISTS peer_reputation (
+		peer_uuid TEXT,
+		at INTEGER,
+		reputation REAL,
+		grudge REAL,
+		reason TEXT
+	);
+	CREATE INDEX IF NOT EXISTS idx_peer_reputation ON peer_reputation (peer_uuid);
+
+	CREATE TABLE IF NOT EXISTS peer_grievances (
+		reporter_uuid TEXT,
+		grievance_id INTEGER,
+		offender_uuid TEXT,
+		damage INTEGER,
+		impact REAL,
+		paid INTEGER DEFAULT 0,
+		tick INTEGER,
+		PRIMARY KEY (reporter_uuid, grievance_id)
+	);
+
+	CREATE TABLE IF NOT EXISTS filed_grievances (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		offender_node TEXT,
+		damage INTEGER,
+		paid INTEGER DEFAULT 0,
+		defending TEXT DEFAULT '',
+		tick INTEGER
+	);
+
+	CREATE TABLE IF NOT EXISTS owed_grievances (
+		victim_node TEXT,
+		grievance_id INTEGER,
+		damage INTEGER,
+		paid INTEGER DEFAULT 0,
+		tick INTEGER,
+		PRIMARY KEY (victim_node, grievance_id)
+	);
+
+	CREATE TABLE IF NOT EXISTS economy_changes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		tick INTEGER,
+		control TEXT,
+		old_value REAL,
+		new_value REAL,
+		reason TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS peer_membership (
+		peer_uuid TEXT,
+		at INTEGER,
+		event TEXT,
+		detail TEXT DEFAULT '',
+		via TEXT DEFAULT '',
+		vouched_by TEXT DEFAULT ''
+	);
+	CREATE INDEX IF NOT EXISTS idx_peer_membership ON peer_membership (peer_uuid);
+
+	CREATE TABLE IF NOT EXISTS federation_invites (
+		id TEXT PRIMARY KEY,
+		expires_at INTEGER,
+		used_by TEXT,
+		used_at INTEGER
 	);
 	`
-	if _, err := db.Exec(schema); err != nil { panic(err) }
-
-    // Migrations
-	db.Exec("ALTER TABLE colonies ADD COLUMN parent_colony_id INTEGER DEFAULT 0")
-	db.Exec("ALTER TABLE colonies ADD COLUMN steel INTEGER DEFAULT 0")
-	db.Exec("ALTER TABLE colonies ADD COLUMN wine INTEGER DEFAULT 0")
-	db.Exec("ALTER TABLE colonies ADD COLUMN policies_json TEXT DEFAULT '{}'")
-	db.Exec("ALTER TABLE fleets ADD COLUMN payload_json TEXT")
-    db.Exec("ALTER TABLE fleets ADD COLUMN target_order_id TEXT") // New migration
-
-    // New Materials Migrations
-    db.Exec("ALTER TABLE colonies ADD COLUMN platinum_ore INTEGER DEFAULT 0")
-    db.Exec("ALTER TABLE colonies ADD COLUMN uranium_ore INTEGER DEFAULT 0")
-    db.Exec("ALTER TABLE colonies ADD COLUMN diamond_ore INTEGER DEFAULT 0")
-    db.Exec("ALTER TABLE colonies ADD COLUMN plutonium INTEGER DEFAULT 0")
+	if _, err := db.Exec(schema); err != nil {
+		return err
+	}
 
-	initIdentity()
+	// Spatial lookups (region scans) range over x, then y, then z
+	db.Exec("CREATE INDEX IF NOT EXISTS idx_systems_xyz ON solar_systems (x, y, z)")
+
+	// Migrations: columns added since a table was first created. Old databases gain them here;
+	// on a fresh one they already exist and the ALTER fails harmlessly.
+	for _, m := range schemaMigrations {
+		db.Exec(m)
+	}
+	db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_systems_name ON solar_systems (name COLLATE NOCASE) WHERE name IS NOT NULL")
+
+	// Sessions from before expiry existed get a full lifetime from the upgrade, not a logout
+	db.Exec("UPDATE users SET expires_at=? WHERE COALESCE(expires_at, 0)=0 AND COALESCE(session_token, '') != ''",
+		time.Now().Add(SessionTTL).Unix())
+	return nil
 }
 
 func initIdentity() {
@@ -155,17 +686,24 @@ func initIdentity() {
 		InfoLog.Println("🚀 FIRST BOOT: Generating Identity...")
 		pub, priv, _ := ed25519.GenerateKey(rand.Reader)
 
+		var params *GenesisParams
 		if TargetGenesisHash != "" {
 			GenesisHash = TargetGenesisHash
+			params = TargetGenesisParams
 			InfoLog.Printf("🔗 Binding to Federation Genesis: %s", GenesisHash)
 		} else {
-			rndBytes := make([]byte, 8); rand.Read(rndBytes)
-			genesisData := fmt.Sprintf("GENESIS-%d-%x", time.Now().UnixNano(), rndBytes)
-			hash := blake3.Sum256([]byte(genesisData))
-			GenesisHash = hex.EncodeToString(hash[:])
-			InfoLog.Printf("✨ Created NEW Genesis: %s", GenesisHash)
+			p, err := foundingParams()
+			if err != nil {
+				ErrorLog.Fatalf("Invalid genesis parameters: %v", err)
+			}
+			rndBytes := make([]byte, 8)
+			rand.Read(rndBytes)
+			p.Nonce = fmt.Sprintf("%d-%x", time.Now().UnixNano(), rndBytes)
+			GenesisHash = p.hash()
+			params = &p
+			InfoLog.Printf("✨ Created NEW Genesis: %s (universe %d, density %d/256)", GenesisHash, p.UniverseSize, p.SystemDensity)
 		}
-		
+
 		uuid = hashBLAKE3(pub)
 
 		tx, _ := db.Begin()
@@ -173,6 +711,10 @@ func initIdentity() {
 		tx.Exec("INSERT INTO system_meta (key, value) VALUES ('genesis_hash', ?)", GenesisHash)
 		tx.Exec("INSERT INTO system_meta (key, value) VALUES ('priv_key', ?)", hex.EncodeToString(priv))
 		tx.Exec("INSERT INTO system_meta (key, value) VALUES ('pub_key', ?)", hex.EncodeToString(pub))
+		if params != nil {
+			paramsJson, _ := json.Marshal(params)
+			tx.Exec("INSERT INTO system_meta (key, value) VALUES ('genesis_params', ?)", string(paramsJson))
+		}
 		tx.Commit()
 
 		PrivateKey = priv
@@ -187,6 +729,7 @@ func initIdentity() {
 		PublicKey = ed25519.PublicKey(pubBytes)
 		db.QueryRow("SELECT value FROM system_meta WHERE key='genesis_hash'").Scan(&GenesisHash)
 	}
+	loadGenesisParams()
 	ServerUUID = uuid
 	LeaderUUID = ServerUUID
 }
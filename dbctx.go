@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	mrand "math/rand"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// --- Database Access ---
+// Every statement runs under a context with a deadline, so a slow disk or a held SQLite lock
+// fails the call instead of hanging a handler past the HTTP write timeout. DB wraps *sql.DB and
+// overrides the context-less methods. Handlers shadow the global with db.WithContext(r.Context()),
+// so their reads also stop when the client goes away; everything else runs under Background.
+// Writes (Exec, Begin) keep their own deadlines but ignore the request being cancelled: a client
+// hanging up between two statements of a handler must not leave half of its change applied.
+//
+// A write that finds the database locked comes back SQLITE_BUSY once the driver's busy timeout
+// (1s, see db.go) runs out. SQLite refuses such a statement before it does anything, so Exec
+// and Begin retry it with jittered backoff (up to DBBusyRetries times, and never past
+// DBBusyBudget). Nothing else is retried: a deadline error may have hit a statement that
+// already ran. Transactions begin IMMEDIATE (see db.go), taking the write lock up front, so
+// contention shows up at Begin, where nothing has happened yet, rather than part-way through.
+
+const (
+	DBQueryTimeout = 5 * time.Second // below the server's 10s WriteTimeout
+	DBExecTimeout  = 5 * time.Second
+	DBTxTimeout    = 30 * time.Second // a transaction held longer is rolled back
+	DBSlowOp       = time.Second
+
+	// SQLite allows one writer; WAL lets readers proceed alongside it
+	DBMaxOpenConns = 8
+	DBMaxIdleConns = 8
+	DBConnMaxIdle  = 5 * time.Minute
+
+	DBBusyRetries    = 6
+	DBBusyBackoff    = 10 * time.Millisecond // first retry; doubles each time
+	DBBusyMaxBackoff = 250 * time.Millisecond
+	DBBusyBudget     = 5 * time.Second // no retry starts later than this after the first try
+)
+
+type DB struct {
+	*sql.DB
+	ctx context.Context // parent of every statement's deadline; nil = Background
+}
+
+// The same pool, with statements bounded by ctx as well as their own deadlines
+func (d *DB) WithContext(ctx context.Context) *DB {
+	return &DB{DB: d.DB, ctx: ctx}
+}
+
+func (d *DB) parent() context.Context {
+	if d.ctx != nil {
+		return d.ctx
+	}
+	return context.Background()
+}
+
+// The parent for writes: the request's values without its cancellation
+func (d *DB) writeParent() context.Context {
+	return context.WithoutCancel(d.parent())
+}
+
+type DBMetrics struct {
+	QueryTimeouts int64 `json:"query_timeouts"`
+	ExecTimeouts  int64 `json:"exec_timeouts"`
+	TxTimeouts    int64 `json:"tx_timeouts"` // BEGIN itself timing out (lock contention)
+	SlowOps       int64 `json:"slow_ops"`
+	BusyRetries   int64 `json:"busy_retries"`
+	BusyFailures  int64 `json:"busy_failures"` // gave up still locked
+}
+
+var dbMetrics DBMetrics
+
+func openDB(driver, dsn string, maxOpen int) (*DB, error) {
+	raw, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	raw.SetMaxOpenConns(maxOpen)
+	raw.SetMaxIdleConns(maxOpen)
+	raw.SetConnMaxIdleTime(DBConnMaxIdle)
+	return &DB{DB: raw}, nil
+}
+
+// Results that outlive the call (Rows, Row, Tx) can't have their context cancelled on return;
+// those callers drop the cancel func and the context's own timer releases it at the deadline.
+func deadlineCtx(parent context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(parent, d)
+}
+
+func noteDBResult(start time.Time, err error, timeouts *int64, query string) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		atomic.AddInt64(timeouts, 1)
+		if ErrorLog != nil {
+			ErrorLog.Printf("DB timeout: %.80s", query)
+		}
+	}
+	if time.Since(start) > DBSlowOp {
+		atomic.AddInt64(&dbMetrics.SlowOps, 1)
+		if DebugLog != nil {
+			DebugLog.Printf("Slow DB op (%v): %.80s", time.Since(start), query)
+		}
+	}
+}
+
+func isBusy(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "database is locked") || strings.Contains(msg, "database table is locked") ||
+		strings.Contains(msg, "sqlite_busy") || strings.Contains(msg, "sqlite_locked")
+}
+
+// Half the doubled backoff plus up to as much again at random, so waiting writers spread out
+func busyBackoff(attempt int) time.Duration {
+	d := DBBusyBackoff << uint(attempt)
+	if d > DBBusyMaxBackoff || d <= 0 {
+		d = DBBusyMaxBackoff
+	}
+	return d/2 + time.Duration(mrand.Int63n(int64(d/2)+1))
+}
+
+// Runs op until it succeeds, fails with anything but a busy database, or runs out of retries
+func retryBusy(query string, op func() error) error {
+	first := time.Now()
+	for attempt := 0; ; attempt++ {
+		err := op()
+		if !isBusy(err) {
+			return err
+		}
+		wait := busyBackoff(attempt)
+		if attempt == DBBusyRetries || time.Since(first)+wait > DBBusyBudget {
+			atomic.AddInt64(&dbMetrics.BusyFailures, 1)
+			if ErrorLog != nil {
+				ErrorLog.Printf("DB still locked after %d retries: %.80s", attempt, query)
+			}
+			return err
+		}
+		atomic.AddInt64(&dbMetrics.BusyRetries, 1)
+		time.Sleep(wait)
+	}
+}
+
+func (d *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	var res sql.Result
+	err := retryBusy(query, func() error {
+		ctx, cancel := deadlineCtx(d.writeParent(), DBExecTimeout)
+		defer cancel()
+		start := time.Now()
+		var err error
+		res, err = d.DB.ExecContext(ctx, query, args...)
+		noteDBResult(start, err, &dbMetrics.ExecTimeouts, query)
+		return err
+	})
+	return res, err
+}
+
+func (d *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	start := time.Now()
+	ctx, _ := deadlineCtx(d.parent(), DBQueryTimeout)
+	rows, err := d.DB.QueryContext(ctx, query, args...)
+	noteDBResult(start, err, &dbMetrics.QueryTimeouts, query)
+	return rows, err
+}
+
+func (d *DB) QueryRow(query string, args ...interface{}) *sql.Row {
+	start := time.Now()
+	ctx, _ := deadlineCtx(d.parent(), DBQueryTimeout)
+	row := d.DB.QueryRowContext(ctx, query, args...)
+	noteDBResult(start, row.Err(), &dbMetrics.QueryTimeouts, query)
+	return row
+}
+
+// The transaction is rolled back by database/sql if it is still open at the deadline
+func (d *DB) Begin() (*sql.Tx, error) {
+	var tx *sql.Tx
+	err := retryBusy("BEGIN", func() error {
+		start := time.Now()
+		var err error
+		ctx, _ := deadlineCtx(d.writeParent(), DBTxTimeout)
+		tx, err = d.DB.BeginTx(ctx, nil)
+		noteDBResult(start, err, &dbMetrics.TxTimeouts, "BEGIN")
+		return err
+	})
+	return tx, err
+}
+
+// Pool and timeout counters for operators
+func handleAdminDB(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	if !authenticateAdmin(r) {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+	s := db.Stats()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"open_connections": s.OpenConnections,
+		"in_use":           s.InUse,
+		"idle":             s.Idle,
+		"wait_count":       s.WaitCount,
+		"wait_duration_ms": s.WaitDuration.Milliseconds(),
+		"query_timeouts":   atomic.LoadInt64(&dbMetrics.QueryTimeouts),
+		"exec_timeouts":    atomic.LoadInt64(&dbMetrics.ExecTimeouts),
+		"tx_timeouts":      atomic.LoadInt64(&dbMetrics.TxTimeouts),
+		"slow_ops":         atomic.LoadInt64(&dbMetrics.SlowOps),
+		"busy_retries":     atomic.LoadInt64(&dbMetrics.BusyRetries),
+		"busy_failures":    atomic.LoadInt64(&dbMetrics.BusyFailures),
+	})
+}
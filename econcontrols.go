@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// --- Economy Controls ---
+// Operators tune their node's faucet and sinks live: the bank burn payout, market listing fees
+// and per-tick credit upkeep are each scaled by a multiplier. Every node in a federation runs
+// with the same bounds (EconomyMin-EconomyMax) so no node can mint or drain credits wildly
+// beyond its neighbours; a single change moves a multiplier at most EconomyMaxStep and changes
+// are spaced EconomyCooldownTicks apart. Changes are logged in economy_changes and the current
+// multipliers ride along in heartbeats, where peers ignore values outside the bounds.
+
+const (
+	EconomyMin           = 0.5
+	EconomyMax           = 2.0
+	EconomyMaxStep       = 0.1
+	EconomyCooldownTicks = 60
+	EconomyHistory       = 50 // changes shown by GET /admin/economy
+)
+
+type EconomyControls struct {
+	BurnRate  float64 `json:"burn_rate"`  // bank burn payout
+	MarketFee float64 `json:"market_fee"` // market listing fees
+	Upkeep    float64 `json:"upkeep"`     // per-tick credit upkeep (subsidized housing)
+}
+
+type EconomyChange struct {
+	Tick     int64   `json:"tick"`
+	Control  string  `json:"control"`
+	OldValue float64 `json:"old_value"`
+	NewValue float64 `json:"new_value"`
+	Reason   string  `json:"reason"`
+}
+
+var (
+	economy     = defaultEconomy()
+	economyLock sync.RWMutex
+)
+
+func defaultEconomy() EconomyControls {
+	return EconomyControls{BurnRate: 1, MarketFee: 1, Upkeep: 1}
+}
+
+// Multipliers by name, in a fixed order for logging
+func (e *EconomyControls) knobs() []struct {
+	Name string
+	Val  *float64
+} {
+	return []struct {
+		Name string
+		Val  *float64
+	}{{"burn_rate", &e.BurnRate}, {"market_fee", &e.MarketFee}, {"upkeep", &e.Upkeep}}
+}
+
+func (e EconomyControls) inBounds() bool {
+	for _, k := range e.knobs() {
+		if *k.Val < EconomyMin || *k.Val > EconomyMax {
+			return false
+		}
+	}
+	return true
+}
+
+func loadEconomy() {
+	e := defaultEconomy()
+	for _, k := range e.knobs() {
+		var v string
+		if db.QueryRow("SELECT value FROM system_meta WHERE key=?", "econ_"+k.Name).Scan(&v) == nil {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				*k.Val = f
+			}
+		}
+	}
+	if !e.inBounds() {
+		e = defaultEconomy()
+	}
+	economyLock.Lock()
+	economy = e
+	economyLock.Unlock()
+}
+
+func currentEconomy() EconomyControls {
+	economyLock.RLock()
+	defer economyLock.RUnlock()
+	return economy
+}
+
+// Checks a requested change against the bounds, the step limit and the cooldown
+func checkEconomyChange(old, req EconomyControls, lastTick, now int64) (int, error) {
+	if !req.inBounds() {
+		return 400, fmt.Errorf("Multipliers must be within %.2f-%.2f", EconomyMin, EconomyMax)
+	}
+	oldKnobs := old.knobs()
+	changed := false
+	for i, k := range req.knobs() {
+		delta := *k.Val - *oldKnobs[i].Val
+		if delta > EconomyMaxStep+1e-9 || delta < -EconomyMaxStep-1e-9 {
+			return 400, fmt.Errorf("%s may move at most %.2f per change", k.Name, EconomyMaxStep)
+		}
+		changed = changed || delta != 0
+	}
+	if changed && lastTick > 0 && now-lastTick < EconomyCooldownTicks {
+		return 429, fmt.Errorf("Economy changed recently; wait %d ticks", EconomyCooldownTicks-(now-lastTick))
+	}
+	return 0, nil
+}
+
+// Stores and logs the multipliers that differ from the current ones
+func setEconomy(req EconomyControls, reason string, now int64) {
+	old := currentEconomy()
+	oldKnobs := old.knobs()
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+	for i, k := range req.knobs() {
+		if *k.Val == *oldKnobs[i].Val {
+			continue
+		}
+		tx.Exec("INSERT OR REPLACE INTO system_meta (key, value) VALUES (?, ?)", "econ_"+k.Name, strconv.FormatFloat(*k.Val, 'f', -1, 64))
+		tx.Exec("INSERT INTO economy_changes (tick, control, old_value, new_value, reason) VALUES (?, ?, ?, ?, ?)",
+			now, k.Name, *oldKnobs[i].Val, *k.Val, reason)
+	}
+	tx.Exec("INSERT OR REPLACE INTO system_meta (key, value) VALUES ('econ_changed_tick', ?)", strconv.FormatInt(now, 10))
+	tx.Commit()
+
+	economyLock.Lock()
+	economy = req
+	economyLock.Unlock()
+}
+
+func economyChangedTick() int64 {
+	var v string
+	db.QueryRow("SELECT value FROM system_meta WHERE key='econ_changed_tick'").Scan(&v)
+	t, _ := strconv.ParseInt(v, 10, 64)
+	return t
+}
+
+func economyChanges(limit int) []EconomyChange {
+	list := []EconomyChange{}
+	rows, err := db.Query("SELECT tick, control, old_value, new_value, COALESCE(reason, '') FROM economy_changes ORDER BY id DESC LIMIT ?", limit)
+	if err != nil {
+		return list
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c EconomyChange
+		rows.Scan(&c.Tick, &c.Control, &c.OldValue, &c.NewValue, &c.Reason)
+		list = append(list, c)
+	}
+	return list
+}
+
+// Scales a credit amount by a multiplier, keeping a non-zero amount non-zero
+func scaleCredits(amount int, mult float64) int {
+	if amount == 0 {
+		return 0
+	}
+	scaled := int(float64(amount) * mult)
+	if scaled == 0 {
+		if amount > 0 {
+			return 1
+		}
+		return -1
+	}
+	return scaled
+}
+
+// GET: multipliers, bounds, macro indicators and recent changes.
+// POST {"burn_rate", "market_fee", "upkeep", "reason"}: set the multipliers.
+func handleAdminEconomy(w http.ResponseWriter, r *http.Request) {
+	if !authenticateAdmin(r) {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var req struct {
+			EconomyControls
+			Reason string `json:"reason"`
+		}
+		req.EconomyControls = currentEconomy() // omitted multipliers stay as they are
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+
+		stateLock.Lock()
+		now := atomic.LoadInt64(&CurrentTick)
+		if status, err := checkEconomyChange(currentEconomy(), req.EconomyControls, economyChangedTick(), now); err != nil {
+			stateLock.Unlock()
+			http.Error(w, err.Error(), status)
+			return
+		}
+		if req.EconomyControls == currentEconomy() {
+			stateLock.Unlock()
+			http.Error(w, "No Change", 400)
+			return
+		}
+		setEconomy(req.EconomyControls, req.Reason, now)
+		stateLock.Unlock()
+		InfoLog.Printf("📈 Economy set: burn x%.2f, market fee x%.2f, upkeep x%.2f (%s)",
+			req.BurnRate, req.MarketFee, req.Upkeep, req.Reason)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"controls": currentEconomy(),
+		"bounds":   map[string]float64{"min": EconomyMin, "max": EconomyMax, "max_step": EconomyMaxStep},
+		"report":   computeEconomy(),
+		"changes":  economyChanges(EconomyHistory),
+	})
+}
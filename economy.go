@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync/atomic"
+)
+
+// --- Macro Economy Indicators ---
+// The bank burn is the only credit faucet, so these numbers show whether it is inflating the galaxy.
+
+type EconomyReport struct {
+	Tick          int64              `json:"tick"`
+	MoneySupply   int64              `json:"money_supply"`
+	Accounts      int                `json:"accounts"`
+	BurnVolume24h int64              `json:"burn_volume_24h"` // credits minted by burns in the last day
+	BurnCount24h  int                `json:"burn_count_24h"`
+	AvgPrices     map[string]float64 `json:"avg_prices"` // quantity-weighted, open sell orders
+	CreditGini    float64            `json:"credit_gini"`
+	Controls      EconomyControls    `json:"controls"`     // operator multipliers (see econcontrols.go)
+	SupplyIndex   map[string]float64 `json:"supply_index"` // burn payout multipliers (see supplyindex.go)
+}
+
+// Gini coefficient of a set of balances: 0 = perfectly equal, 1 = one holder owns everything
+func giniCoefficient(values []int64) float64 {
+	n := len(values)
+	if n == 0 {
+		return 0
+	}
+	sorted := append([]int64(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total, weighted float64
+	for i, v := range sorted {
+		if v < 0 {
+			v = 0
+		}
+		total += float64(v)
+		weighted += float64(i+1) * float64(v)
+	}
+	if total == 0 {
+		return 0
+	}
+	return (2*weighted)/(float64(n)*total) - float64(n+1)/float64(n)
+}
+
+func computeEconomy() EconomyReport {
+	tick := atomic.LoadInt64(&CurrentTick)
+	report := EconomyReport{Tick: tick, AvgPrices: make(map[string]float64), Controls: currentEconomy(), SupplyIndex: supplyIndex()}
+
+	var balances []int64
+	if rows, err := db.Query("SELECT credits FROM users"); err == nil {
+		for rows.Next() {
+			var credits int64
+			rows.Scan(&credits)
+			balances = append(balances, credits)
+			report.MoneySupply += credits
+		}
+		rows.Close()
+	}
+	report.Accounts = len(balances)
+	report.CreditGini = giniCoefficient(balances)
+
+	if rows, err := db.Query("SELECT payload_blob FROM transaction_log WHERE action_type='BANK_BURN' AND tick > ?", tick-TicksPerDay); err == nil {
+		for rows.Next() {
+			var blob []byte
+			var burn BurnRecord
+			rows.Scan(&blob)
+			if json.Unmarshal(blob, &burn) == nil {
+				report.BurnVolume24h += int64(burn.Payout)
+				report.BurnCount24h++
+			}
+		}
+		rows.Close()
+	}
+
+	if rows, err := db.Query("SELECT item, SUM(price * quantity) * 1.0 / SUM(quantity) FROM market_orders WHERE is_buy=0 AND quantity > 0 GROUP BY item"); err == nil {
+		for rows.Next() {
+			var item string
+			var avg float64
+			rows.Scan(&item, &avg)
+			report.AvgPrices[item] = avg
+		}
+		rows.Close()
+	}
+
+	return report
+}
+
+func handleEconomy(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(computeEconomy())
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// --- Embargoes ---
+// Colony owners embargo other empires, for one colony or all of them (colony_id 0), and node
+// operators embargo empires node-wide. The target is a user UUID or a node UUID; a node target
+// covers every exchange in the systems that node holds. An embargo works both ways: it blocks
+// market fills at the colony, cargo transfers, contract deliveries and refinery deliveries
+// between the two parties. Empires see the embargoes placed against them in GET /api/embargoes.
+
+const MaxEmbargoes = 100 // per owner
+
+type Embargo struct {
+	ID         int    `json:"id"`
+	OwnerUUID  string `json:"owner_uuid"` // empire, or this node for an operator embargo
+	OwnerName  string `json:"owner_name,omitempty"`
+	ColonyID   int    `json:"colony_id"` // 0 = all of the owner's colonies
+	TargetUUID string `json:"target_uuid"`
+	Reason     string `json:"reason,omitempty"`
+	Tick       int64  `json:"tick"`
+}
+
+func scanEmbargoes(where string, args ...interface{}) []Embargo {
+	list := []Embargo{}
+	rows, err := db.Query(`SELECT e.id, e.owner_uuid, COALESCE(u.username, ''), e.colony_id, e.target_uuid, COALESCE(e.reason, ''), e.created_tick
+	                       FROM embargoes e LEFT JOIN users u ON u.global_uuid = e.owner_uuid `+where+" ORDER BY e.id", args...)
+	if err != nil {
+		return list
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e Embargo
+		rows.Scan(&e.ID, &e.OwnerUUID, &e.OwnerName, &e.ColonyID, &e.TargetUUID, &e.Reason, &e.Tick)
+		list = append(list, e)
+	}
+	return list
+}
+
+// Why an exchange between a colony's owner and a visiting empire in sysID is blocked, or nil
+func checkEmbargo(colonyOwner string, colonyID int, visitor, sysID string) error {
+	if colonyOwner == visitor {
+		return nil
+	}
+	var sysOwner string
+	db.QueryRow("SELECT COALESCE(owner_uuid, '') FROM solar_systems WHERE id=?", sysID).Scan(&sysOwner)
+
+	var id int
+	var owner string
+	err := db.QueryRow(`SELECT id, owner_uuid FROM embargoes WHERE
+	                        (owner_uuid=? AND colony_id IN (0, ?) AND target_uuid IN (?, ?))
+	                     OR (owner_uuid=? AND colony_id=0 AND target_uuid IN (?, ?))
+	                     OR (owner_uuid=? AND target_uuid IN (?, ?, ?))
+	                    LIMIT 1`,
+		colonyOwner, colonyID, visitor, sysOwner,
+		visitor, colonyOwner, sysOwner,
+		ServerUUID, colonyOwner, visitor, sysOwner).Scan(&id, &owner)
+	if err != nil {
+		return nil
+	}
+	switch owner {
+	case ServerUUID:
+		return fmt.Errorf("Embargoed by the node operator")
+	case visitor:
+		return fmt.Errorf("You embargo this empire")
+	}
+	return fmt.Errorf("This empire embargoes you")
+}
+
+// Adds or lifts an embargo owned by owner
+func setEmbargo(owner string, colonyID int, target, reason string, lift bool) (int, error) {
+	if lift {
+		res, _ := db.Exec("DELETE FROM embargoes WHERE owner_uuid=? AND colony_id=? AND target_uuid=?", owner, colonyID, target)
+		if n, _ := res.RowsAffected(); n == 0 {
+			return 404, fmt.Errorf("Embargo Not Found")
+		}
+		return 0, nil
+	}
+	if target == "" || target == owner || len(reason) > 200 {
+		return 400, fmt.Errorf("Invalid Embargo")
+	}
+	var count int
+	db.QueryRow("SELECT count(*) FROM embargoes WHERE owner_uuid=?", owner).Scan(&count)
+	if count >= MaxEmbargoes {
+		return 400, fmt.Errorf("Embargo Limit Reached")
+	}
+	if _, err := db.Exec("INSERT OR IGNORE INTO embargoes (owner_uuid, colony_id, target_uuid, reason, created_tick) VALUES (?, ?, ?, ?, ?)",
+		owner, colonyID, target, reason, atomic.LoadInt64(&CurrentTick)); err != nil {
+		return 500, fmt.Errorf("DB Error")
+	}
+	return 0, nil
+}
+
+type embargoRequest struct {
+	TargetUUID string `json:"target_uuid" validate:"required"`
+	ColonyID   int    `json:"colony_id"`
+	Reason     string `json:"reason"`
+	Lift       bool   `json:"lift"`
+}
+
+// GET: your embargoes and those placed against you (by empires or this node's operator).
+// POST {"target_uuid", "colony_id" (0 = all your colonies), "reason"} places one; "lift": true removes it.
+func handleEmbargoes(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var req embargoRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		if req.ColonyID != 0 {
+			var owner string
+			if db.QueryRow("SELECT owner_uuid FROM colonies WHERE id=?", req.ColonyID).Scan(&owner) != nil || owner != userID {
+				http.Error(w, "Colony Not Found", 404)
+				return
+			}
+		}
+		defer lockRows(userRow(userID))()
+		if status, err := setEmbargo(userID, req.ColonyID, req.TargetUUID, req.Reason, req.Lift); err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]Embargo{
+		"placed":      scanEmbargoes("WHERE e.owner_uuid=?", userID),
+		"against_you": scanEmbargoes("WHERE e.target_uuid=?", userID),
+	})
+}
+
+// GET: the operator's node-wide embargoes. POST {"target_uuid", "reason"} places one; "lift": true removes it.
+func handleAdminEmbargoes(w http.ResponseWriter, r *http.Request) {
+	if !authenticateAdmin(r) {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var req embargoRequest
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		if status, err := setEmbargo(ServerUUID, 0, req.TargetUUID, req.Reason, req.Lift); err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		InfoLog.Printf("⛔ Node embargo on %s: lifted=%v", req.TargetUUID, req.Lift)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(scanEmbargoes("WHERE e.owner_uuid=?", ServerUUID))
+}
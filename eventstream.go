@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// --- Live Event Stream ---
+// GET /api/events with a WebSocket upgrade pushes the user's game events as they happen, so
+// clients don't have to poll /api/state; a plain GET still lists world events (worldevents.go). Every message is a WebhookEnvelope: the same events a
+// webhook can subscribe to, sent whether or not one is registered, plus a "tick" message to
+// every stream when a tick completes. Browsers can't set headers on a WebSocket handshake, so
+// the session may also come as ?user_uuid=&token=. A user may hold MaxEventStreams at once.
+//
+// Pushing never waits on a client: each stream has a buffer of EventStreamBuffer messages, and
+// a client that lets it fill up is disconnected (close code 1008) rather than holding up the
+// tick. The server pings every EventStreamPing; a client that stops reading is dropped once a
+// write times out. Messages sent while a client is disconnected are not replayed; reconnecting
+// clients should fetch /api/state once to catch up.
+
+const (
+	EventTick      = "tick"
+	EventBattle    = "battle"
+	EventGrievance = "grievance"
+
+	MaxEventStreams   = 5
+	EventStreamBuffer = 64
+	EventStreamPing   = 30 * time.Second
+	EventStreamWrite  = 10 * time.Second
+)
+
+type eventStream struct {
+	owner   string
+	out     chan []byte
+	dropped bool // set when the buffer overflowed; out is closed
+}
+
+var eventStreams = struct {
+	sync.Mutex
+	byOwner map[string]map[*eventStream]bool
+}{byOwner: make(map[string]map[*eventStream]bool)}
+
+func subscribeEvents(owner string) (*eventStream, bool) {
+	eventStreams.Lock()
+	defer eventStreams.Unlock()
+	if len(eventStreams.byOwner[owner]) >= MaxEventStreams {
+		return nil, false
+	}
+	s := &eventStream{owner: owner, out: make(chan []byte, EventStreamBuffer)}
+	if eventStreams.byOwner[owner] == nil {
+		eventStreams.byOwner[owner] = make(map[*eventStream]bool)
+	}
+	eventStreams.byOwner[owner][s] = true
+	return s, true
+}
+
+func unsubscribeEvents(s *eventStream) {
+	eventStreams.Lock()
+	defer eventStreams.Unlock()
+	delete(eventStreams.byOwner[s.owner], s)
+	if len(eventStreams.byOwner[s.owner]) == 0 {
+		delete(eventStreams.byOwner, s.owner)
+	}
+	if !s.dropped {
+		s.dropped = true
+		close(s.out)
+	}
+}
+
+// Hands msg to a stream without blocking; a full buffer drops the stream. Caller holds eventStreams.
+func offerEvent(s *eventStream, msg []byte) {
+	if s.dropped {
+		return
+	}
+	select {
+	case s.out <- msg:
+	default:
+		s.dropped = true
+		close(s.out)
+	}
+}
+
+// Sends an event envelope to the owner's open streams
+func pushEvent(owner string, body []byte) {
+	eventStreams.Lock()
+	defer eventStreams.Unlock()
+	for s := range eventStreams.byOwner[owner] {
+		offerEvent(s, body)
+	}
+}
+
+// Tells every open stream a tick completed; called at the end of tickWorld
+func broadcastTick(tick int64) {
+	eventStreams.Lock()
+	defer eventStreams.Unlock()
+	for owner, streams := range eventStreams.byOwner {
+		body, _ := json.Marshal(WebhookEnvelope{Event: EventTick, Tick: tick, Owner: owner, Data: map[string]interface{}{}})
+		for s := range streams {
+			offerEvent(s, body)
+		}
+	}
+}
+
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	if !isWebSocketUpgrade(r) {
+		handleWorldEvents(w, r)
+		return
+	}
+	userID, err := authenticate(r)
+	if err == errNoCredentials {
+		q := r.URL.Query()
+		r.Header.Set("X-User-UUID", q.Get("user_uuid"))
+		r.Header.Set("X-Session-Token", q.Get("token"))
+		var p Principal
+		p, err = resolveSession(r)
+		userID = p.UserID
+	}
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+	s, ok := subscribeEvents(userID)
+	if !ok {
+		http.Error(w, "Too Many Event Streams", 429)
+		return
+	}
+	conn, brw, err := wsAccept(w, r)
+	if err != nil {
+		unsubscribeEvents(s)
+		return
+	}
+	serveEventStream(s, conn, brw)
+}
+
+// Writes the stream's messages and pings until the client goes away or falls behind
+func serveEventStream(s *eventStream, conn net.Conn, brw *bufio.ReadWriter) {
+	defer conn.Close()
+	defer unsubscribeEvents(s)
+	conn.SetDeadline(time.Time{}) // the server's read/write timeouts don't apply past the upgrade
+
+	// The reader only answers the protocol; everything it wants sent goes through the writer
+	control := make(chan []byte, 4) // a pong payload, or nil for a close from the client
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			op, payload, err := wsReadFrame(brw.Reader)
+			if err != nil {
+				return
+			}
+			switch op {
+			case wsOpPing:
+				select {
+				case control <- payload:
+				default:
+				}
+			case wsOpClose:
+				select {
+				case control <- nil:
+				default:
+				}
+				return
+			}
+		}
+	}()
+
+	write := func(op byte, payload []byte) error {
+		conn.SetWriteDeadline(time.Now().Add(EventStreamWrite))
+		return wsWriteFrame(brw.Writer, op, payload)
+	}
+	ping := time.NewTicker(EventStreamPing)
+	defer ping.Stop()
+	for {
+		select {
+		case msg, ok := <-s.out:
+			if !ok {
+				write(wsOpClose, wsCloseBody(1008, "too slow"))
+				return
+			}
+			if write(wsOpText, msg) != nil {
+				return
+			}
+		case payload := <-control:
+			if payload == nil {
+				write(wsOpClose, wsCloseBody(1000, ""))
+				return
+			}
+			if write(wsOpPong, payload) != nil {
+				return
+			}
+		case <-ping.C:
+			if write(wsOpPing, nil) != nil {
+				return
+			}
+		case <-gone:
+			return
+		}
+	}
+}
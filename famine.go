@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+)
+
+// --- Famine Relief ---
+// Opt-in colony policy "famine_relief". When a colony starts a tick with no food, the bank
+// sells it FamineReliefTicks of its laborers' rations at FamineMarkup times what burning that
+// food would pay, charged to the owner's credits (as much as they can afford). It keeps an
+// offline player's colony out of the starvation death spiral, at a price that makes it a
+// last resort rather than a supply line. The credits leave the economy, like burns enter it.
+
+const (
+	FaminePolicy      = "famine_relief"
+	FamineReliefTicks = 5
+	FamineMarkup      = 5.0
+)
+
+// Logged per purchase (transaction_log FAMINE_RELIEF)
+type FamineReliefRecord struct {
+	UserUUID string `json:"user_uuid"`
+	ColonyID int    `json:"colony_id"`
+	Food     int    `json:"food"`
+	Cost     int    `json:"cost"`
+}
+
+// Credits per unit of emergency food for a colony: the burn price, marked up
+func famineUnitPrice(colonyID int) int {
+	eff := GetEfficiency(colonyID, "food")
+	if eff < 0.1 {
+		eff = 0.1
+	}
+	return int(math.Ceil(FamineMarkup / eff))
+}
+
+// Food a relief delivery aims for: FamineReliefTicks of laborer rations
+func famineRations(laborers int, policies map[string]bool) int {
+	need := laborers / 10
+	if policies["strict_rationing"] {
+		need /= 2
+	}
+	return need * FamineReliefTicks
+}
+
+// Runs before the colony tick so the purchase is in stock when rations are drawn
+func processFamineRelief(current int64) {
+	rows, err := db.Query("SELECT id, owner_uuid, pop_laborers, COALESCE(policies_json, '{}') FROM colonies WHERE food <= 0 AND policies_json LIKE ?",
+		"%"+FaminePolicy+"%")
+	if err != nil {
+		return
+	}
+	type starving struct {
+		ID, Laborers int
+		Owner        string
+		Policies     map[string]bool
+	}
+	var list []starving
+	for rows.Next() {
+		var s starving
+		var pJson string
+		rows.Scan(&s.ID, &s.Owner, &s.Laborers, &pJson)
+		json.Unmarshal([]byte(pJson), &s.Policies)
+		if s.Policies[FaminePolicy] {
+			list = append(list, s)
+		}
+	}
+	rows.Close()
+
+	for _, s := range list {
+		want := famineRations(s.Laborers, s.Policies)
+		if want <= 0 {
+			continue
+		}
+		price := famineUnitPrice(s.ID)
+
+		tx, err := db.Begin()
+		if err != nil {
+			return
+		}
+		var credits int
+		tx.QueryRow("SELECT credits FROM users WHERE global_uuid=?", s.Owner).Scan(&credits)
+		food := want
+		if credits/price < food {
+			food = credits / price
+		}
+		if food <= 0 {
+			tx.Rollback()
+			continue
+		}
+		cost := food * price
+		tx.Exec("UPDATE users SET credits = credits - ? WHERE global_uuid=?", cost, s.Owner)
+		tx.Exec("UPDATE colonies SET food = food + ? WHERE id=?", food, s.ID)
+		rec, _ := json.Marshal(FamineReliefRecord{UserUUID: s.Owner, ColonyID: s.ID, Food: food, Cost: cost})
+		tx.Exec("INSERT INTO transaction_log (tick, action_type, payload_blob) VALUES (?, 'FAMINE_RELIEF', ?)", current, rec)
+		tx.Commit()
+
+		InfoLog.Printf("🌾 Famine relief: colony %d bought %d food for %d credits", s.ID, food, cost)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// --- Feature Flags ---
+// Experimental subsystems can be switched off per node without a rebuild. Flags persist in
+// system_meta as "feature:<name>" and are advertised in the handshake so peers know which
+// cross-node features this node will take part in.
+
+const (
+	FeatureMarketMatching = "market_matching" // order-targeted trade fleets and market gossip
+	FeatureInvasions      = "invasions"       // orbital bombardment of foreign colonies
+	FeatureNPCPirates     = "npc_pirates"     // rebel fleets from collapsed colonies
+
+	FeatureMutualDefenseWar = "mutual_defense_war" // declare war on whoever attacks an ally
+
+	FeatureProtobufWire = "protobuf_wire" // protobuf federation bodies; off means JSON only
+)
+
+// Defaults preserve current behaviour; operators opt out
+var FeatureDefaults = map[string]bool{
+	FeatureMarketMatching: true,
+	FeatureInvasions:      true,
+	FeatureNPCPirates:     true,
+
+	FeatureMutualDefenseWar: false,
+
+	FeatureProtobufWire: true,
+}
+
+var (
+	featureFlags = make(map[string]bool)
+	featureLock  sync.RWMutex
+)
+
+func loadFeatureFlags() {
+	featureLock.Lock()
+	defer featureLock.Unlock()
+
+	for name, on := range FeatureDefaults {
+		featureFlags[name] = on
+	}
+	rows, err := db.Query("SELECT key, value FROM system_meta WHERE key LIKE 'feature:%'")
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key, val string
+		rows.Scan(&key, &val)
+		name := strings.TrimPrefix(key, "feature:")
+		if _, known := FeatureDefaults[name]; known {
+			featureFlags[name] = val == "1"
+		}
+	}
+}
+
+func featureEnabled(name string) bool {
+	featureLock.RLock()
+	defer featureLock.RUnlock()
+	return featureFlags[name]
+}
+
+func setFeatureFlag(name string, on bool) {
+	val := "0"
+	if on {
+		val = "1"
+	}
+	db.Exec("INSERT OR REPLACE INTO system_meta (key, value) VALUES (?, ?)", "feature:"+name, val)
+
+	featureLock.Lock()
+	featureFlags[name] = on
+	featureLock.Unlock()
+}
+
+// Sorted names of enabled flags, as advertised to peers
+func enabledFeatures() []string {
+	featureLock.RLock()
+	defer featureLock.RUnlock()
+
+	list := []string{}
+	for name, on := range featureFlags {
+		if on {
+			list = append(list, name)
+		}
+	}
+	sort.Strings(list)
+	return list
+}
+
+func (p *Peer) Supports(feature string) bool {
+	for _, f := range p.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// GET lists flags, POST {"name": ..., "enabled": bool} toggles one
+func handleAdminFeatures(w http.ResponseWriter, r *http.Request) {
+	if !authenticateAdmin(r) {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var req struct {
+			Name    string `json:"name" validate:"required"`
+			Enabled *bool  `json:"enabled" validate:"required"`
+		}
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		if _, known := FeatureDefaults[req.Name]; !known {
+			http.Error(w, "Unknown Feature", 400)
+			return
+		}
+		setFeatureFlag(req.Name, *req.Enabled)
+		InfoLog.Printf("🚩 Feature %s set to %v", req.Name, *req.Enabled)
+	}
+
+	featureLock.RLock()
+	flags := make(map[string]bool, len(featureFlags))
+	for k, v := range featureFlags {
+		flags[k] = v
+	}
+	featureLock.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(flags)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Signed Federation Envelope ---
+// Every /federation/* request carries the sender's UUID, a timestamp and an ed25519 signature
+// over method, path+query, body hash and timestamp. Receivers verify against the cached peer
+// key; the handshake is the one exception, since the key travels in its body.
+
+const (
+	FedClockSkew    = 30 * time.Second
+	FedMaxBody      = 1024 * 1024
+	HeaderFedNode   = "X-Fed-Node"
+	HeaderFedTime   = "X-Fed-Timestamp"
+	HeaderFedSig    = "X-Fed-Signature"
+	fedHandshakeURI = "/federation/handshake"
+)
+
+func fedSigningString(method, uri string, body []byte, ts string) []byte {
+	return []byte(method + "\n" + uri + "\n" + hashBLAKE3(body) + "\n" + ts)
+}
+
+// Builds an outbound federation request with the signed envelope attached
+func newFederationRequest(method, url string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	sig := SignMessage(PrivateKey, fedSigningString(method, req.URL.RequestURI(), body, ts))
+
+	req.Header.Set(HeaderFedNode, ServerUUID)
+	req.Header.Set(HeaderFedTime, ts)
+	req.Header.Set(HeaderFedSig, hex.EncodeToString(sig))
+	if body != nil {
+		req.Header.Set("Content-Type", FedContentJSON)
+	}
+	return req, nil
+}
+
+func postFederation(client *http.Client, url string, body []byte) (*http.Response, error) {
+	return postFederationAs(client, url, FedContentJSON, body)
+}
+
+// Posts a body already encoded as contentType (see wire.go)
+func postFederationAs(client *http.Client, url, contentType string, body []byte) (*http.Response, error) {
+	req, err := newFederationRequest("POST", url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return client.Do(req)
+}
+
+// Key a signed request must verify against: the cached peer key, or for handshakes the key being presented
+func fedSenderKey(r *http.Request, nodeID string, body []byte) (ed25519.PublicKey, error) {
+	if r.URL.Path == fedHandshakeURI {
+		var hs HandshakeRequest
+		if err := decodeFederation(r, body, &hs); err != nil || hs.UUID != nodeID {
+			return nil, fmt.Errorf("handshake does not match sender")
+		}
+		key, err := hex.DecodeString(hs.PublicKey)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid public key")
+		}
+		return ed25519.PublicKey(key), nil
+	}
+
+	peerLock.RLock()
+	peer, known := Peers[nodeID]
+	peerLock.RUnlock()
+	if !known {
+		return nil, fmt.Errorf("unknown peer")
+	}
+	return peer.PublicKey, nil
+}
+
+func verifyFederationRequest(r *http.Request, body []byte) error {
+	nodeID := r.Header.Get(HeaderFedNode)
+	ts := r.Header.Get(HeaderFedTime)
+	sig, err := hex.DecodeString(r.Header.Get(HeaderFedSig))
+	if nodeID == "" || ts == "" || err != nil || len(sig) == 0 {
+		return fmt.Errorf("missing signature")
+	}
+
+	sent, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("bad timestamp")
+	}
+	if skew := time.Since(time.Unix(sent, 0)); skew > FedClockSkew || skew < -FedClockSkew {
+		return fmt.Errorf("timestamp outside tolerance")
+	}
+
+	key, err := fedSenderKey(r, nodeID, body)
+	if err != nil {
+		return err
+	}
+	if !VerifySignature(key, fedSigningString(r.Method, r.URL.RequestURI(), body, ts), sig) {
+		return fmt.Errorf("bad signature")
+	}
+	return nil
+}
+
+func middlewareFederationAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/federation/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// Operators may read federation views (map, graph) with the admin key
+		if r.Method == "GET" && authenticateAdmin(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, FedMaxBody+1))
+		if err != nil || len(body) > FedMaxBody {
+			http.Error(w, "Payload Too Large", 413)
+			return
+		}
+		if err := verifyFederationRequest(r, body); err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), 401)
+			return
+		}
+
+		// Handlers read the body again
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+)
+
+// --- Financial Centers ---
+// A financial_center earns its owner a cut of the money moving through its colony: bank burns
+// made there and market fills against its orders over the last day (transaction_log BANK_BURN
+// and TRADE_FILL records carrying the colony), its credits velocity V. Every FinanceInterval
+// ticks the colony pays out FinanceInterval × FinanceYield × sqrt(V) × (1 − FinanceFalloff^n)
+// for n centers. Both halves have diminishing returns: ten times the volume earns about three
+// times as much, and each further center adds a quarter less than the one before, so a trade
+// hub pays and a colony of nothing but banks doesn't.
+
+const (
+	FinanceInterval = 100 // ticks between payouts
+	FinanceYield    = 0.02
+	FinanceFalloff  = 0.75
+)
+
+// Income per tick for a colony with the given centers and credits velocity
+func financeIncome(centers int, velocity int64) float64 {
+	if centers <= 0 || velocity <= 0 {
+		return 0
+	}
+	return FinanceYield * math.Sqrt(float64(velocity)) * (1 - math.Pow(FinanceFalloff, float64(centers)))
+}
+
+// Credits burned at or traded through each colony over the last day
+func colonyVelocity(tick int64) map[int]int64 {
+	velocity := make(map[int]int64)
+	rows, err := db.Query(`SELECT action_type, payload_blob FROM transaction_log
+	                       WHERE action_type IN ('BANK_BURN', 'TRADE_FILL') AND tick > ?`, tick-TicksPerDay)
+	if err != nil {
+		return velocity
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var kind string
+		var blob []byte
+		rows.Scan(&kind, &blob)
+		if kind == "BANK_BURN" {
+			var b BurnRecord
+			if json.Unmarshal(blob, &b) == nil && b.ColonyID != 0 && b.Payout > 0 {
+				velocity[b.ColonyID] += int64(b.Payout)
+			}
+		} else {
+			var tr TradeRecord
+			if json.Unmarshal(blob, &tr) == nil && tr.ColonyID != 0 && tr.Quantity > 0 && tr.Price > 0 {
+				velocity[tr.ColonyID] += int64(tr.Quantity) * int64(tr.Price)
+			}
+		}
+	}
+	return velocity
+}
+
+// Pays every colony with a financial_center for the last FinanceInterval ticks
+func payFinancialCenters(tick int64) {
+	rows, err := db.Query(`SELECT id, owner_uuid, buildings_json FROM colonies WHERE buildings_json LIKE '%"financial_center"%'`)
+	if err != nil {
+		return
+	}
+	type center struct {
+		colony  int
+		owner   string
+		centers int
+	}
+	var centers []center
+	for rows.Next() {
+		var c center
+		var bJson string
+		rows.Scan(&c.colony, &c.owner, &bJson)
+		var buildings map[string]int
+		json.Unmarshal([]byte(bJson), &buildings)
+		if c.centers = buildings["financial_center"]; c.centers > 0 {
+			centers = append(centers, c)
+		}
+	}
+	rows.Close()
+	if len(centers) == 0 {
+		return
+	}
+
+	velocity := colonyVelocity(tick)
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+	paid := 0
+	for _, c := range centers {
+		income := int(financeIncome(c.centers, velocity[c.colony]) * FinanceInterval)
+		if income <= 0 {
+			continue
+		}
+		tx.Exec("UPDATE users SET credits = credits + ? WHERE global_uuid=?", income, c.owner)
+		paid += income
+	}
+	if err := tx.Commit(); err != nil {
+		ErrorLog.Printf("Financial center payout failed: %v", err)
+		return
+	}
+	if paid > 0 {
+		DebugLog.Printf("🏦 Financial centers paid %d credits", paid)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// --- Fleet Manifest ---
+// GET /api/fleet/{id}: one fleet's cargo, route, ETA, fuel use and module condition, for its
+// owner only.
+// Launches record the fuel charged for the leg (route_fuel); the burn is reported pro rata
+// over the flight even though the whole cost is debited at departure.
+
+type FleetRoute struct {
+	Origin        string  `json:"origin"`
+	OriginName    string  `json:"origin_name,omitempty"`
+	Destination   string  `json:"destination,omitempty"`
+	DestName      string  `json:"destination_name,omitempty"`
+	DepartureTick int64   `json:"departure_tick,omitempty"`
+	ArrivalTick   int64   `json:"arrival_tick,omitempty"`
+	ETATicks      int64   `json:"eta_ticks"`
+	ETASeconds    int64   `json:"eta_seconds"`
+	Progress      float64 `json:"progress"` // 0..1 along the current leg
+}
+
+type ModuleCondition struct {
+	Module    string  `json:"module"`
+	Slot      string  `json:"slot"`      // engine, weapon or special
+	Condition float64 `json:"condition"` // 1 = fully operational
+}
+
+type FleetManifest struct {
+	ID            int               `json:"id"`
+	Status        string            `json:"status"`
+	HullClass     string            `json:"hull_class"`
+	Integrity     int               `json:"integrity"`
+	Payload       FleetPayload      `json:"payload"`
+	Route         FleetRoute        `json:"route"`
+	Fuel          int               `json:"fuel"`
+	FuelBurned    int               `json:"fuel_burned"` // on the current (or last) leg
+	Modules       []ModuleCondition `json:"modules"`
+	RepairCost    int               `json:"repair_cost"` // steel to restore the hull and every module
+	Experience    int               `json:"experience"`
+	Veterancy     int               `json:"veterancy"`
+	TargetOrderID string            `json:"target_order_id,omitempty"`
+	HomeSystem    string            `json:"home_system,omitempty"`
+}
+
+func moduleSlot(m string) string {
+	switch {
+	case m == "booster" || m == "propeller" || m == "warp_drive":
+		return "engine"
+	case WeaponStats[m].Damage > 0:
+		return "weapon"
+	}
+	return "special"
+}
+
+// Share of the leg flown at tick now
+func legProgress(departure, arrival, now int64) float64 {
+	if arrival <= departure || now >= arrival {
+		return 1
+	}
+	if now <= departure {
+		return 0
+	}
+	return float64(now-departure) / float64(arrival-departure)
+}
+
+func handleFleetManifest(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	if r.Method != "GET" {
+		http.Error(w, "Method Not Allowed", 405)
+		return
+	}
+	fleetID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/fleet/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	var m FleetManifest
+	var owner, modJson, condJson, payloadJson, originName, destName string
+	var routeFuel, hullDamage int
+	err = db.QueryRow(`SELECT f.id, f.owner_uuid, f.status, f.hull_class, COALESCE(f.modules_json, '[]'), COALESCE(f.module_condition_json, ''), COALESCE(f.payload_json, '{}'),
+	                          f.origin_system, COALESCE(f.dest_system, ''), COALESCE(f.departure_tick, 0), COALESCE(f.arrival_tick, 0),
+	                          f.fuel, COALESCE(f.route_fuel, 0), COALESCE(f.experience, 0), COALESCE(f.target_order_id, ''), COALESCE(f.home_system, ''),
+	                          COALESCE(f.hull_damage, 0), COALESCE(o.name, ''), COALESCE(d.name, '')
+	                   FROM fleets f
+	                   LEFT JOIN solar_systems o ON o.id = f.origin_system
+	                   LEFT JOIN solar_systems d ON d.id = f.dest_system
+	                   WHERE f.id=?`, fleetID).Scan(
+		&m.ID, &owner, &m.Status, &m.HullClass, &modJson, &condJson, &payloadJson,
+		&m.Route.Origin, &m.Route.Destination, &m.Route.DepartureTick, &m.Route.ArrivalTick,
+		&m.Fuel, &routeFuel, &m.Experience, &m.TargetOrderID, &m.HomeSystem,
+		&hullDamage, &originName, &destName)
+	if err != nil {
+		http.Error(w, "Fleet Not Found", 404)
+		return
+	}
+	if owner != userID {
+		http.Error(w, "Not your fleet", 403)
+		return
+	}
+
+	var modules []string
+	json.Unmarshal([]byte(modJson), &modules)
+	json.Unmarshal([]byte(payloadJson), &m.Payload)
+	m.Veterancy = veterancy(m.Experience)
+	m.Route.OriginName, m.Route.DestName = originName, destName
+
+	// Hull damage and module wear both carry between fights until repaired (see damage.go)
+	m.Integrity = hullIntegrity(m.HullClass) - hullDamage
+	condition := parseCondition(condJson)
+	m.Modules = make([]ModuleCondition, 0, len(modules))
+	for i, mod := range modules {
+		m.Modules = append(m.Modules, ModuleCondition{Module: mod, Slot: moduleSlot(mod), Condition: conditionAt(condition, i)})
+	}
+	m.RepairCost = repairCost(wornCondition(condition, len(modules), 0)) + hullRepairCost(hullDamage)
+
+	now := atomic.LoadInt64(&CurrentTick)
+	m.Route.Progress = 1
+	m.FuelBurned = routeFuel
+	if m.Status == "TRANSIT" {
+		m.Route.Progress = legProgress(m.Route.DepartureTick, m.Route.ArrivalTick, now)
+		m.FuelBurned = int(float64(routeFuel) * m.Route.Progress)
+		if m.Route.ArrivalTick > now {
+			m.Route.ETATicks = m.Route.ArrivalTick - now
+			m.Route.ETASeconds = m.Route.ETATicks * atomic.LoadInt64(&TickDuration) / 1000
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m)
+}
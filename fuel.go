@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// --- Fuel & Engines ---
+// A hop burns distance × mass × the destination's relation multiplier (see CalculateFuelCost),
+// scaled by the hull and its engines. Mass is the hull's HullMass plus ModuleMass per module.
+// Some hulls are built to haul (HullFuelEfficiency below 1) and some to sprint. Engines trade
+// fuel for speed: each booster or propeller cuts the trip by 5% and each warp drive by 20%, but
+// they burn EngineThirst and WarpThirst more fuel respectively. POST /api/fleet/estimate prices
+// a route for a fleet or for a design on paper, with and without its engines.
+
+const (
+	DefaultHullMass = 1000
+	ModuleMass      = 100
+
+	EngineSpeedup = 0.05 // booster, propeller
+	WarpSpeedup   = 0.20
+	EngineThirst  = 0.10
+	WarpThirst    = 0.25
+)
+
+var HullMass = map[string]int{
+	"Fighter":       800,
+	"SpeedyFighter": 600,
+	"Bomber":        1200,
+	"Frigate":       1000,
+	"Colonizer":     1500,
+}
+
+// Fuel burned per unit of mass, relative to a plain hull
+var HullFuelEfficiency = map[string]float64{
+	"SpeedyFighter": 1.2,
+	"Bomber":        1.1,
+	"Frigate":       0.7,
+	"Colonizer":     0.9,
+}
+
+func fleetMass(hullClass string, modules []string) int {
+	mass, ok := HullMass[hullClass]
+	if !ok {
+		mass = DefaultHullMass
+	}
+	return mass + ModuleMass*len(modules)
+}
+
+func countEngines(modules []string) (engines, warps int) {
+	for _, m := range modules {
+		switch m {
+		case "booster", "propeller":
+			engines++
+		case "warp_drive":
+			warps++
+		}
+	}
+	return
+}
+
+// Multiplier on a hop's fuel for the hull's efficiency and its engines' thirst
+func fuelBurnFactor(hullClass string, modules []string) float64 {
+	eff, ok := HullFuelEfficiency[hullClass]
+	if !ok {
+		eff = 1.0
+	}
+	engines, warps := countEngines(modules)
+	return eff * (1 + EngineThirst*float64(engines) + WarpThirst*float64(warps))
+}
+
+// Travel ticks over a distance with the given engines, each giving its condition's share of
+// its speedup; at least one
+func travelTicks(distance float64, modules []string, condition []float64) int64 {
+	var engines, warps float64
+	for i, m := range modules {
+		switch m {
+		case "booster", "propeller":
+			engines += conditionAt(condition, i)
+		case "warp_drive":
+			warps += conditionAt(condition, i)
+		}
+	}
+	ticks := int64(distance)
+	reduction := float64(ticks) * (WarpSpeedup*warps + EngineSpeedup*engines)
+	ticks -= int64(reduction)
+	if ticks < 1 {
+		ticks = 1
+	}
+	return ticks
+}
+
+type RouteEstimate struct {
+	Origin      string  `json:"origin"`
+	Target      string  `json:"target"`
+	HullClass   string  `json:"hull_class"`
+	Mass        int     `json:"mass"`
+	BurnFactor  float64 `json:"burn_factor"` // hull efficiency × engine thirst
+	FuelCost    int     `json:"fuel_cost"`
+	TravelTicks int64   `json:"travel_ticks"`
+
+	// The same hull and cargo modules with every engine stripped out
+	UnpoweredFuel  int   `json:"unpowered_fuel"`
+	UnpoweredTicks int64 `json:"unpowered_ticks"`
+
+	// Fleets only
+	FuelOnBoard int   `json:"fuel_on_board,omitempty"`
+	Affordable  *bool `json:"affordable,omitempty"`
+}
+
+func estimateRoute(origin, target, hullClass string, modules []string, condition []float64) RouteEstimate {
+	est := RouteEstimate{Origin: origin, Target: target, HullClass: hullClass,
+		Mass: fleetMass(hullClass, modules), BurnFactor: fuelBurnFactor(hullClass, modules)}
+	est.FuelCost, est.TravelTicks = computeWornRoute(origin, target, hullClass, modules, condition)
+
+	var unpowered []string
+	for _, m := range modules {
+		if e, w := countEngines([]string{m}); e+w == 0 {
+			unpowered = append(unpowered, m)
+		}
+	}
+	est.UnpoweredFuel, est.UnpoweredTicks = computeRoute(origin, target, hullClass, unpowered)
+	return est
+}
+
+// POST {"fleet_id", "target_system" | "beacon"} prices a trip for one of your fleets;
+// {"hull_class", "modules", "origin_system", "target_system" | "beacon"} prices a design
+func handleFleetEstimate(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	var req struct {
+		FleetID      int      `json:"fleet_id"`
+		HullClass    string   `json:"hull_class"`
+		Modules      []string `json:"modules"`
+		OriginSystem string   `json:"origin_system"`
+		TargetSystem string   `json:"target_system"`
+		Beacon       string   `json:"beacon"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	if req.TargetSystem == "" {
+		if req.Beacon == "" {
+			http.Error(w, "Bad Request: missing field 'target_system'", 400)
+			return
+		}
+		b, ok := findBeacon(userID, req.Beacon)
+		if !ok {
+			http.Error(w, "Beacon Not Found", 404)
+			return
+		}
+		req.TargetSystem = b.SystemID()
+	}
+
+	fuel := 0
+	var condition []float64
+	if req.FleetID != 0 {
+		var owner, modJson, condJson string
+		err := db.QueryRow("SELECT owner_uuid, origin_system, hull_class, modules_json, COALESCE(module_condition_json, ''), fuel FROM fleets WHERE id=?", req.FleetID).
+			Scan(&owner, &req.OriginSystem, &req.HullClass, &modJson, &condJson, &fuel)
+		if err != nil {
+			http.Error(w, "Fleet Not Found", 404)
+			return
+		}
+		if owner != userID {
+			http.Error(w, "Not your fleet", 403)
+			return
+		}
+		req.Modules = nil
+		json.Unmarshal([]byte(modJson), &req.Modules)
+		condition = parseCondition(condJson)
+	} else {
+		if req.OriginSystem == "" {
+			http.Error(w, "Bad Request: missing field 'origin_system'", 400)
+			return
+		}
+		if !validateModules(req.HullClass, req.Modules) {
+			http.Error(w, fmt.Sprintf("Invalid design for hull %q", req.HullClass), 400)
+			return
+		}
+	}
+
+	est := estimateRoute(req.OriginSystem, req.TargetSystem, req.HullClass, req.Modules, condition)
+	if est.FuelCost < 0 {
+		http.Error(w, "Cost Overflow", 400)
+		return
+	}
+	if req.FleetID != 0 {
+		affordable := fuel >= est.FuelCost
+		est.FuelOnBoard, est.Affordable = fuel, &affordable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(est)
+}
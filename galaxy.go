@@ -0,0 +1,169 @@
+package main
+
+import (
+	"database/sql"
+	"sort"
+	"sync"
+)
+
+// --- Galaxy Index ---
+// Every charted system (a row in solar_systems) is mirrored in memory, by ID and by position,
+// so the per-fleet lookups of the tick (route costs, arrivals, pirate roaming) and the scans and
+// map don't each go to SQLite. A coarse grid of GalaxyCellSize-wide cells answers box queries
+// without walking the whole galaxy.
+//
+// The table stays the source of truth. The index is loaded once after the schema is up and
+// every statement that inserts a system or changes its owner or name re-reads that row with
+// reindexSystem afterwards, so an INSERT OR IGNORE that lost a race leaves the winner in place.
+
+const GalaxyCellSize = 32
+
+type IndexedSystem struct {
+	ID    string
+	X     int
+	Y     int
+	Z     int
+	Type  string
+	Owner string
+	Name  string
+}
+
+type galaxyIndex struct {
+	sync.RWMutex
+	byID    map[string]*IndexedSystem
+	byCoord map[[3]int]*IndexedSystem
+	grid    map[[3]int][]*IndexedSystem
+}
+
+var galaxy = &galaxyIndex{}
+
+const indexedColumns = "id, x, y, z, COALESCE(star_type, type, ''), COALESCE(owner_uuid, ''), COALESCE(name, '')"
+
+func scanIndexedSystem(scan func(...interface{}) error) (*IndexedSystem, error) {
+	var s IndexedSystem
+	err := scan(&s.ID, &s.X, &s.Y, &s.Z, &s.Type, &s.Owner, &s.Name)
+	return &s, err
+}
+
+func gridCell(x, y, z int) [3]int {
+	cell := func(v int) int {
+		if v < 0 {
+			return (v+1)/GalaxyCellSize - 1
+		}
+		return v / GalaxyCellSize
+	}
+	return [3]int{cell(x), cell(y), cell(z)}
+}
+
+// Rebuilds the index from the table; called once the schema is up
+func loadGalaxyIndex() {
+	g := &galaxyIndex{
+		byID:    make(map[string]*IndexedSystem),
+		byCoord: make(map[[3]int]*IndexedSystem),
+		grid:    make(map[[3]int][]*IndexedSystem),
+	}
+	rows, err := db.Query("SELECT " + indexedColumns + " FROM solar_systems ORDER BY id")
+	if err == nil {
+		for rows.Next() {
+			if s, err := scanIndexedSystem(rows.Scan); err == nil {
+				g.put(s)
+			}
+		}
+		rows.Close()
+	}
+
+	galaxy.Lock()
+	galaxy.byID, galaxy.byCoord, galaxy.grid = g.byID, g.byCoord, g.grid
+	galaxy.Unlock()
+}
+
+// Caller holds the write lock (or owns g exclusively)
+func (g *galaxyIndex) put(s *IndexedSystem) {
+	if old, ok := g.byID[s.ID]; ok {
+		*old = *s // coordinates never change, so the grid entry stays valid
+		return
+	}
+	g.byID[s.ID] = s
+	pos := [3]int{s.X, s.Y, s.Z}
+	if _, taken := g.byCoord[pos]; !taken {
+		g.byCoord[pos] = s
+	}
+	cell := gridCell(s.X, s.Y, s.Z)
+	g.grid[cell] = append(g.grid[cell], s)
+}
+
+// Re-reads one system after a write to its row
+func reindexSystem(id string) {
+	s, err := scanIndexedSystem(db.QueryRow("SELECT "+indexedColumns+" FROM solar_systems WHERE id=?", id).Scan)
+	if err == sql.ErrNoRows {
+		return
+	}
+	if err != nil {
+		ErrorLog.Printf("Galaxy index: reloading %s: %v", id, err)
+		return
+	}
+	galaxy.Lock()
+	if galaxy.byID == nil {
+		galaxy.byID = make(map[string]*IndexedSystem)
+		galaxy.byCoord = make(map[[3]int]*IndexedSystem)
+		galaxy.grid = make(map[[3]int][]*IndexedSystem)
+	}
+	galaxy.put(s)
+	galaxy.Unlock()
+}
+
+func lookupSystem(id string) (IndexedSystem, bool) {
+	galaxy.RLock()
+	defer galaxy.RUnlock()
+	s, ok := galaxy.byID[id]
+	if !ok {
+		return IndexedSystem{}, false
+	}
+	return *s, true
+}
+
+func systemAt(x, y, z int) (IndexedSystem, bool) {
+	galaxy.RLock()
+	defer galaxy.RUnlock()
+	s, ok := galaxy.byCoord[[3]int{x, y, z}]
+	if !ok {
+		return IndexedSystem{}, false
+	}
+	return *s, true
+}
+
+// Charted systems with min <= position <= max on every axis, by ID
+func systemsInBox(min, max [3]int) []IndexedSystem {
+	lo, hi := gridCell(min[0], min[1], min[2]), gridCell(max[0], max[1], max[2])
+	var out []IndexedSystem
+
+	galaxy.RLock()
+	for cx := lo[0]; cx <= hi[0]; cx++ {
+		for cy := lo[1]; cy <= hi[1]; cy++ {
+			for cz := lo[2]; cz <= hi[2]; cz++ {
+				for _, s := range galaxy.grid[[3]int{cx, cy, cz}] {
+					if s.X >= min[0] && s.X <= max[0] && s.Y >= min[1] && s.Y <= max[1] && s.Z >= min[2] && s.Z <= max[2] {
+						out = append(out, *s)
+					}
+				}
+			}
+		}
+	}
+	galaxy.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// Every charted system, by ID
+func allSystems() []IndexedSystem {
+	galaxy.RLock()
+	out := make([]IndexedSystem, 0, len(galaxy.byID))
+	for _, s := range galaxy.byID {
+		out = append(out, *s)
+	}
+	galaxy.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"lukechampine.com/blake3"
+)
+
+// --- Genesis Parameters ---
+// The shape of the universe is fixed when its federation is founded: the half-width of the cube
+// systems live in (UniverseSize) and how many sectors in 256 hold one (SystemDensity). A founding
+// node takes them from OWNWORLD_UNIVERSE_SIZE and OWNWORLD_SYSTEM_DENSITY and hashes them into
+// the genesis, GenesisHash = BLAKE3("GENESIS-<nonce>|universe=<size>|density=<density>"), so
+// every node sharing the hash shares the parameters. Joiners fetch the nonce and parameters from
+// their seed's /api/status and refuse a seed whose parameters don't hash to its genesis.
+//
+// Universes founded before the parameters existed keep the old hard-coded shape.
+
+const (
+	DefaultUniverseSize  = 1000000
+	DefaultSystemDensity = 13
+
+	MinUniverseSize = 100
+	MaxUniverseSize = 100000000
+)
+
+type GenesisParams struct {
+	UniverseSize  int    `json:"universe_size"`
+	SystemDensity int    `json:"system_density"` // sectors in 256 holding a system
+	Nonce         string `json:"nonce,omitempty"`
+}
+
+var (
+	UniverseSize  = DefaultUniverseSize
+	SystemDensity = DefaultSystemDensity
+
+	// Parameters of the genesis this node holds; zero for a legacy genesis
+	genesisParams GenesisParams
+
+	// What the seed told us, for a first boot that joins a federation
+	TargetGenesisParams *GenesisParams
+)
+
+func (p GenesisParams) valid() error {
+	if p.UniverseSize < MinUniverseSize || p.UniverseSize > MaxUniverseSize {
+		return fmt.Errorf("universe size must be %d-%d", MinUniverseSize, MaxUniverseSize)
+	}
+	if p.SystemDensity < 1 || p.SystemDensity > 255 {
+		return fmt.Errorf("system density must be 1-255 (in 256 sectors)")
+	}
+	return nil
+}
+
+func (p GenesisParams) hash() string {
+	data := fmt.Sprintf("GENESIS-%s|universe=%d|density=%d", p.Nonce, p.UniverseSize, p.SystemDensity)
+	sum := blake3.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// Parameters for a new federation, from the environment
+func foundingParams() (GenesisParams, error) {
+	p := GenesisParams{UniverseSize: DefaultUniverseSize, SystemDensity: DefaultSystemDensity}
+	if v := os.Getenv("OWNWORLD_UNIVERSE_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return p, fmt.Errorf("OWNWORLD_UNIVERSE_SIZE: %v", err)
+		}
+		p.UniverseSize = n
+	}
+	if v := os.Getenv("OWNWORLD_SYSTEM_DENSITY"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return p, fmt.Errorf("OWNWORLD_SYSTEM_DENSITY: %v", err)
+		}
+		p.SystemDensity = n
+	}
+	return p, p.valid()
+}
+
+// Checks parameters a seed sent against its genesis hash
+func verifyGenesisParams(hash string, p GenesisParams) error {
+	if err := p.valid(); err != nil {
+		return err
+	}
+	if p.Nonce == "" || p.hash() != hash {
+		return fmt.Errorf("parameters don't match genesis %s", hash)
+	}
+	return nil
+}
+
+// Makes p the running universe's shape
+func applyGenesisParams(p GenesisParams) {
+	genesisParams = p
+	UniverseSize, SystemDensity = p.UniverseSize, p.SystemDensity
+}
+
+// Loads the stored parameters; a legacy genesis has none and keeps the defaults
+func loadGenesisParams() {
+	var raw string
+	p := GenesisParams{UniverseSize: DefaultUniverseSize, SystemDensity: DefaultSystemDensity}
+	if db.QueryRow("SELECT value FROM system_meta WHERE key='genesis_params'").Scan(&raw) == nil {
+		var stored GenesisParams
+		if json.Unmarshal([]byte(raw), &stored) == nil && stored.valid() == nil {
+			p = stored
+		}
+	}
+	applyGenesisParams(p)
+}
+
+func inUniverse(x, y, z int) bool {
+	return x >= -UniverseSize && x <= UniverseSize && y >= -UniverseSize && y <= UniverseSize && z >= -UniverseSize && z <= UniverseSize
+}
+
+// Parameters as published in /api/status; nil for a legacy genesis
+func publishedGenesisParams() *GenesisParams {
+	if genesisParams.Nonce == "" {
+		return nil
+	}
+	p := genesisParams
+	return &p
+}
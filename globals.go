@@ -3,7 +3,6 @@ package main
 import (
 	"bytes"
 	"crypto/ed25519"
-	"database/sql"
 	"log"
 	"sync"
 	"sync/atomic"
@@ -14,65 +13,88 @@ import (
 
 // --- Configuration ---
 const (
-	DBPath          = "./data/ownworld.db"
-    // Slowed down ticks to 1 minute
-	MinTickDuration = 60000 
-	MaxTickDuration = 65000 
+	// Slowed down ticks to 1 minute
+	MinTickDuration = 60000
+	MaxTickDuration = 65000
+
+	HeartbeatInterval = 10 * time.Second
+	// Snapshot availability is probed every Nth heartbeat round
+	SnapshotProbeEvery = 30
+
+	// Every Nth daily snapshot is a full checkpoint; the rest also carry a delta
+	SnapshotCheckpointInterval = 7
+
+	// Ticks in one snapshot "day"
+	TicksPerDay = 17280
 )
 
 var (
+	// Storage Layout (overridden per universe by --universe)
+	DataDir      = "./data"
+	DBPath       = "./data/ownworld.db"
+	LogDir       = "./logs"
+	ListenAddr   = ":8080"
+	UniverseName string
+
 	// Infrastructure
-	db       *sql.DB
+	db       *DB
 	InfoLog  *log.Logger
 	ErrorLog *log.Logger
 	DebugLog *log.Logger
 
 	// Identity
-	ServerUUID  string
-	ServerLoc   []int // [x, y, z]
-	GenesisHash string
-	TargetGenesisHash string 
+	ServerUUID        string
+	ServerLoc         []int // [x, y, z]
+	GenesisHash       string
+	TargetGenesisHash string
 
-	PrivateKey  ed25519.PrivateKey
-	PublicKey   ed25519.PublicKey
+	PrivateKey ed25519.PrivateKey
+	PublicKey  ed25519.PublicKey
 
 	// Config
 	Config struct {
-		CommandControl bool
-		PeeringMode    string
+		CommandControl     bool
+		PeeringMode        string
+		RegistrationClosed bool    // logins still work (see /api/login)
+		RegistrationInvite bool    // new accounts need an invite code (see registration.go)
+		RegistrationsPerIP int     // daily cap per address, 0 = none
+		RecallCutoff       float64 // share of a leg after which fleets can't be recalled (see recall.go)
 	}
 
 	// Consensus State
-	Peers         = make(map[string]*Peer)
-	peerLock      sync.RWMutex
-	CurrentTick   int64 = 0
-	PreviousHash  string = "GENESIS"
-    // Default tick duration
-	TickDuration  int64 = 60000 
-	MyRank        int   = 0
-	TotalPeers    int   = 1
-	PhaseOffset   time.Duration = 0
-	
+	Peers        = make(map[string]*Peer)
+	peerLock     sync.RWMutex
+	CurrentTick  int64  = 0
+	PreviousHash string = "GENESIS"
+	// Default tick duration
+	TickDuration int64         = 60000
+	MyRank       int           = 0
+	TotalPeers   int           = 1
+	PhaseOffset  time.Duration = 0
+
 	// Leader
 	IsLeader   bool = true
 	LeaderUUID string
 
 	// Caches & Queues
-	mapSnapshot      atomic.Value 
-	immigrationQueue = make(chan HandshakeRequest, 50)
-	
+	mapSnapshot atomic.Value
+
 	// Locking
-	stateLock sync.Mutex
-	
+	stateLock sync.RWMutex // exclusive for the tick; player actions share it (see locks.go)
+
 	// Buffers
 	bufferPool = sync.Pool{
 		New: func() interface{} { return new(bytes.Buffer) },
 	}
-	
+
 	// Rate Limiting
 	ipLimiters = make(map[string]*rate.Limiter)
 	ipLock     sync.Mutex
 
+	// Idempotency-Key replay cache (see middlewareIdempotency)
+	idempotencyCache = make(map[string]*idempotentResponse)
+	idempotencyLock  sync.Mutex
+
 	// Replay Protection
 	SeenCurrent  = make(map[string]bool)
 	SeenPrevious = make(map[string]bool)
@@ -93,49 +115,66 @@ var UnitCosts = map[string]map[string]int{
 }
 
 var BuildingCosts = map[string]map[string]int{
-    // Basics
-	"farm":            {"iron": 10},
-	"well":            {"iron": 10},
-	"urban_housing":   {"iron": 50},
-    
-    // Mines (Raw Material Extraction)
-	"iron_mine":       {"food": 500},
-    "carbon_extractor": {"iron": 100, "food": 200},
-    "platinum_mine":   {"iron": 1000, "food": 1000},
-    "uranium_mine":    {"iron": 2000, "steel": 500},
-    "diamond_mine":    {"iron": 1500, "food": 1000},
-
-    // Processing & Refining (The Scaffolding)
-	"shipyard":           {"iron": 2000, "carbon": 500},
-    "steel_mill":         {"iron": 500, "carbon": 500},
-    "fuel_synthesizer":   {"iron": 1000, "steel": 200}, // Refines Carbon -> Fuel
-    "platinum_refinery":  {"steel": 1000, "carbon": 1000},
-    "uranium_enricher":   {"steel": 2000, "platinum": 100},
-    "diamond_cutter":     {"steel": 500, "iron": 500},
-    "breeder_reactor":    {"steel": 5000, "uranium": 500, "platinum": 200}, // Creates Plutonium
-
-    // Advanced
-    "winery":             {"iron": 100, "gold": 50},
-	"pilot_academy":      {"iron": 1000, "gold": 100},
-	"financial_center":   {"iron": 5000, "gold": 1000},
+	// Basics
+	"farm":          {"iron": 10},
+	"well":          {"iron": 10},
+	"urban_housing": {"iron": 50},
+
+	// Mines (Raw Material Extraction)
+	"iron_mine":        {"food": 500},
+	"carbon_extractor": {"iron": 100, "food": 200},
+	"platinum_mine":    {"iron": 1000, "food": 1000},
+	"uranium_mine":     {"iron": 2000, "steel": 500},
+	"diamond_mine":     {"iron": 1500, "food": 1000},
+
+	// Processing & Refining (The Scaffolding)
+	"shipyard":          {"iron": 2000, "carbon": 500},
+	"steel_mill":        {"iron": 500, "carbon": 500},
+	"fuel_synthesizer":  {"iron": 1000, "steel": 200}, // Refines Carbon -> Fuel
+	"platinum_refinery": {"steel": 1000, "carbon": 1000},
+	"uranium_enricher":  {"steel": 2000, "platinum": 100},
+	"diamond_cutter":    {"steel": 500, "iron": 500},
+	"breeder_reactor":   {"steel": 5000, "uranium": 500, "platinum": 200}, // Creates Plutonium
+
+	// Advanced
+	"winery": {"iron": 100, "gold": 50},
+
+	// Life Support & Terraforming
+	"greenhouse":       {"iron": 200, "water": 200},
+	"oxygen_plant":     {"iron": 500, "steel": 100},
+	"terraformer":      {"steel": 3000, "platinum": 100, "gold": 500},
+	"pilot_academy":    {"iron": 1000, "gold": 100},
+	"module_factory":   {"iron": 2000, "steel": 500}, // Builds ship modules (see ModuleRecipes)
+	"financial_center": {"iron": 5000, "gold": 1000},
+	"defense_battery":  {"iron": 1000, "steel": 300}, // Each one throws off bombers' aim
+	"trading_post":     {"iron": 1500, "steel": 200}, // Anchors market listings (see tradingpost.go)
+	"warehouse":        {"iron": 300},                // Shelters perishables from decay
+	"cold_storage":     {"iron": 500, "steel": 100},
+	"admin_office":     {"iron": 1500, "gold": 200},                   // Cuts corruption far from the capital (see capital.go)
+	"solar_plant":      {"iron": 800, "steel": 100},                   // Powers industry (see power.go)
+	"fission_reactor":  {"steel": 3000, "platinum": 200, "gold": 200}, // Burns plutonium or uranium for power
+	"rd_lab":           {"iron": 1500, "carbon": 500},                 // Research points (see research.go)
 }
 
 // HARD-CODED CLASSES (The "Physics" of the Hull)
 var HullRegistry = map[string]ShipHull{
-    "Fighter":        {Class: "Fighter", EngineSlots: 1, WeaponSlots: 4, SpecialSlots: 0},
-    "SpeedyFighter":  {Class: "SpeedyFighter", EngineSlots: 2, WeaponSlots: 2, SpecialSlots: 0},
-    "Bomber":         {Class: "Bomber", EngineSlots: 1, WeaponSlots: 0, SpecialSlots: 1}, // Special = BombBay
-    "Frigate":        {Class: "Frigate", EngineSlots: 4, WeaponSlots: 0, SpecialSlots: 0}, // Pure Mover
-    "Colonizer":      {Class: "Colonizer", EngineSlots: 2, WeaponSlots: 0, SpecialSlots: 1}, // Special = Ark
+	"Fighter":       {Class: "Fighter", EngineSlots: 1, WeaponSlots: 4, SpecialSlots: 0},
+	"SpeedyFighter": {Class: "SpeedyFighter", EngineSlots: 2, WeaponSlots: 2, SpecialSlots: 0},
+	"Bomber":        {Class: "Bomber", EngineSlots: 1, WeaponSlots: 0, SpecialSlots: 1},    // Special = BombBay
+	"Frigate":       {Class: "Frigate", EngineSlots: 4, WeaponSlots: 0, SpecialSlots: 0},   // Pure Mover
+	"Colonizer":     {Class: "Colonizer", EngineSlots: 2, WeaponSlots: 0, SpecialSlots: 1}, // Special = Ark
 }
 
-// New: Module Costs
-var ModuleCosts = map[string]int{
-    "booster":       100,
-    "propeller":     50,
-    "warp_drive":    1000,
-    "laser":         200,
-    "railgun":       300,
-    "bomb_bay":      500,
-    "colony_kit":    5000,
+// Credits owed per point of grievance damage to settle it
+const ReparationCreditsPerDamage = 10
+
+// Structure points per hull in round-based combat
+var HullIntegrity = map[string]int{
+	"Fighter":       100,
+	"SpeedyFighter": 80,
+	"Bomber":        120,
+	"Frigate":       200,
+	"Colonizer":     150,
 }
+
+// New: Module Costs
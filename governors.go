@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// --- Colony Governors ---
+// An owner can delegate a colony to another user. Governors may build and move cargo in and
+// out with their own fleets; launching, constructing ships, burning, policy and deployment stay
+// with the owner.
+
+func isGovernor(userID string, colonyID int) bool {
+	var count int
+	db.QueryRow("SELECT count(*) FROM colony_governors WHERE colony_id=? AND governor_uuid=?", colonyID, userID).Scan(&count)
+	return count > 0
+}
+
+// Owner or delegated governor
+func canManageColony(userID string, colonyID int, owner string) bool {
+	return owner == userID || isGovernor(userID, colonyID)
+}
+
+type GovernorGrant struct {
+	ColonyID     int    `json:"colony_id"`
+	GovernorUUID string `json:"governor_uuid"`
+	OwnerUUID    string `json:"owner_uuid"`
+}
+
+// GET lists grants on colonies you own or govern. POST grants (or revokes) a governor.
+func handleColonyGovernors(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		rows, err := db.Query(`SELECT g.colony_id, g.governor_uuid, c.owner_uuid FROM colony_governors g
+		                       JOIN colonies c ON c.id = g.colony_id
+		                       WHERE c.owner_uuid=? OR g.governor_uuid=?`, userID, userID)
+		if err != nil {
+			http.Error(w, "DB Error", 500)
+			return
+		}
+		defer rows.Close()
+
+		grants := []GovernorGrant{}
+		for rows.Next() {
+			var g GovernorGrant
+			rows.Scan(&g.ColonyID, &g.GovernorUUID, &g.OwnerUUID)
+			grants = append(grants, g)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(grants)
+		return
+	}
+
+	var req struct {
+		ColonyID     int    `json:"colony_id" validate:"required"`
+		GovernorUUID string `json:"governor_uuid" validate:"required"`
+		Revoke       bool   `json:"revoke"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	defer lockRows(userRow(userID))()
+
+	var owner string
+	err = db.QueryRow("SELECT owner_uuid FROM colonies WHERE id=?", req.ColonyID).Scan(&owner)
+	if err != nil {
+		http.Error(w, "Colony Not Found", 404)
+		return
+	}
+	// Only the owner delegates; governors can't appoint further governors
+	if owner != userID {
+		http.Error(w, "Access Denied", 403)
+		return
+	}
+
+	if req.Revoke {
+		db.Exec("DELETE FROM colony_governors WHERE colony_id=? AND governor_uuid=?", req.ColonyID, req.GovernorUUID)
+		w.Write([]byte("Governor Revoked"))
+		return
+	}
+
+	if req.GovernorUUID == userID {
+		http.Error(w, "Owner is already in charge", 400)
+		return
+	}
+	var exists int
+	db.QueryRow("SELECT count(*) FROM users WHERE global_uuid=?", req.GovernorUUID).Scan(&exists)
+	if exists == 0 {
+		http.Error(w, "User Not Found", 404)
+		return
+	}
+
+	db.Exec("INSERT OR IGNORE INTO colony_governors (colony_id, governor_uuid, granted_by) VALUES (?, ?, ?)", req.ColonyID, req.GovernorUUID, userID)
+	w.Write([]byte("Governor Appointed"))
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync/atomic"
+)
+
+// --- Federation Topology ---
+// Every heartbeat carries the sender's peer list (peer exchange), so a node knows its own edges
+// plus those of each neighbour. /federation/graph exposes that as nodes + edges and counts the
+// connected components, which is what an operator needs to spot a partition.
+
+const MaxGossipNeighbors = 256
+
+type GraphNode struct {
+	UUID       string  `json:"uuid"`
+	Location   []int   `json:"location,omitempty"`
+	Relation   int     `json:"relation"` // -1 when only seen second-hand
+	Reputation float64 `json:"reputation"`
+	Tick       int64   `json:"tick"`
+	Self       bool    `json:"self,omitempty"`
+}
+
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type FederationGraph struct {
+	Nodes      []GraphNode `json:"nodes"`
+	Edges      []GraphEdge `json:"edges"`
+	Components int         `json:"components"`
+}
+
+// Our neighbours as advertised in heartbeats (hostile peers are left out)
+func gossipNeighbors(peers []Peer) []string {
+	out := make([]string, 0, len(peers))
+	for _, p := range peers {
+		if p.Relation != 2 && len(out) < MaxGossipNeighbors {
+			out = append(out, p.UUID)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func buildFederationGraph(peers []Peer) FederationGraph {
+	g := FederationGraph{Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	known := map[string]bool{ServerUUID: true}
+	g.Nodes = append(g.Nodes, GraphNode{UUID: ServerUUID, Location: ServerLoc, Relation: 1, Reputation: 100, Tick: atomic.LoadInt64(&CurrentTick), Self: true})
+
+	sort.Slice(peers, func(i, j int) bool { return peers[i].UUID < peers[j].UUID })
+	for _, p := range peers {
+		known[p.UUID] = true
+		g.Nodes = append(g.Nodes, GraphNode{UUID: p.UUID, Location: p.Location, Relation: p.Relation, Reputation: p.Reputation, Tick: p.LastTick})
+	}
+
+	seen := make(map[[2]string]bool)
+	addEdge := func(a, b string) {
+		if a == b {
+			return
+		}
+		key := [2]string{a, b}
+		if b < a {
+			key = [2]string{b, a}
+		}
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		g.Edges = append(g.Edges, GraphEdge{From: key[0], To: key[1]})
+		for _, id := range key {
+			if !known[id] {
+				known[id] = true
+				g.Nodes = append(g.Nodes, GraphNode{UUID: id, Relation: -1})
+			}
+		}
+	}
+	for _, p := range peers {
+		addEdge(ServerUUID, p.UUID)
+		for _, n := range p.Neighbors {
+			addEdge(p.UUID, n)
+		}
+	}
+
+	g.Components = countComponents(g.Nodes, g.Edges)
+	return g
+}
+
+func countComponents(nodes []GraphNode, edges []GraphEdge) int {
+	parent := make(map[string]string, len(nodes))
+	var find func(string) string
+	find = func(x string) string {
+		for parent[x] != x {
+			parent[x] = parent[parent[x]]
+			x = parent[x]
+		}
+		return x
+	}
+	for _, n := range nodes {
+		parent[n.UUID] = n.UUID
+	}
+	components := len(nodes)
+	for _, e := range edges {
+		a, b := find(e.From), find(e.To)
+		if a != b {
+			parent[a] = b
+			components--
+		}
+	}
+	return components
+}
+
+func handleFederationGraph(w http.ResponseWriter, r *http.Request) {
+	peerLock.RLock()
+	peers := make([]Peer, 0, len(Peers))
+	for _, p := range Peers {
+		peers = append(peers, *p)
+	}
+	peerLock.RUnlock()
+
+	// Topology only moves on heartbeats, so tick + peer count is a good enough key
+	key := strconv.FormatInt(atomic.LoadInt64(&CurrentTick), 10) + "|" + strconv.Itoa(len(peers))
+	cb := graphCache.get(key, func() []byte {
+		data, _ := json.Marshal(buildFederationGraph(peers))
+		return data
+	})
+	serveCachedBody(w, r, cb)
+}
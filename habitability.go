@@ -0,0 +1,96 @@
+package main
+
+// --- Habitability & Life Support ---
+// A world's hazard roll decides how breathable it is. Breathable worlds need no life
+// support; hostile ones burn oxygen per colonist, which vegetation and oxygen plants
+// replace. Terraformers slowly push a colony towards breathable.
+
+const (
+	BreathableHabitability = 0.7
+	// Colonists one unit of oxygen sustains per tick on a fully hostile world
+	OxygenPerPop = 50
+	MaxOxygen    = 10000
+	// Habitability gained per terraformer per tick, paid in water and carbon
+	TerraformRate     = 0.0005
+	TerraformerWater  = 20
+	TerraformerCarbon = 20
+	// Share of every stratum lost per consecutive tick without air (compounds into a spiral)
+	AirlessLossRate = 0.02
+	AirlessLossCap  = 0.5
+)
+
+// Natural habitability of the sector a system sits in, 0 (lethal) .. 1 (garden world)
+func baseHabitability(x, y, z int) float64 {
+	sector := GetSectorData(x, y, z)
+	if !sector.HasSystem {
+		return 1.0
+	}
+	return 1.0 - sector.Hazards
+}
+
+func effectiveHabitability(base, terraform float64) float64 {
+	h := base + terraform
+	if h > 1.0 {
+		h = 1.0
+	}
+	return h
+}
+
+// Oxygen the whole population breathes this tick. Zero once the world is breathable.
+func oxygenDemand(c *Colony, habitability float64) int {
+	if habitability >= BreathableHabitability {
+		return 0
+	}
+	pop := c.PopLaborers + c.PopSpecialists + c.PopElites
+	need := int(float64(pop) / OxygenPerPop * (1.0 - habitability))
+	if need < 1 && pop > 0 {
+		need = 1
+	}
+	return need
+}
+
+// Vegetation breathes out oxygen; greenhouses grow more of it on worlds that can't.
+func produceOxygen(c *Colony, effMult float64) {
+	if n := c.Buildings["greenhouse"]; n > 0 {
+		c.Vegetation = safeAdd(c.Vegetation, int(float64(n*5)*GetEfficiency(c.ID, "vegetation")*effMult))
+	}
+	c.Oxygen = safeAdd(c.Oxygen, c.Vegetation*10)
+}
+
+// Terraformers consume water and carbon to permanently raise habitability
+func runTerraformers(c *Colony) {
+	n := c.Buildings["terraformer"]
+	if n == 0 || c.Terraform >= 1.0 {
+		return
+	}
+	if c.Water < TerraformerWater*n || c.Carbon < TerraformerCarbon*n {
+		return
+	}
+	c.Water -= TerraformerWater * n
+	c.Carbon -= TerraformerCarbon * n
+	c.Terraform += TerraformRate * float64(n)
+	if c.Terraform > 1.0 {
+		c.Terraform = 1.0
+	}
+}
+
+// Each consecutive airless tick kills a larger share of the colony.
+func applyLifeSupportFailure(c *Colony) {
+	loss := AirlessLossRate * float64(c.AirlessTicks)
+	if loss > AirlessLossCap {
+		loss = AirlessLossCap
+	}
+	kill := func(pop int) int {
+		if pop <= 0 {
+			return 0
+		}
+		dead := int(float64(pop)*loss) + 1
+		if dead > pop {
+			dead = pop
+		}
+		return pop - dead
+	}
+	c.PopLaborers = kill(c.PopLaborers)
+	c.PopSpecialists = kill(c.PopSpecialists)
+	c.PopElites = kill(c.PopElites)
+}
@@ -8,7 +8,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"math"
 	"net/http"
 	"os"
 	"regexp"
@@ -17,68 +16,68 @@ import (
 	"time"
 )
 
-// --- Helper: Auth ---
-func authenticate(r *http.Request) (string, error) {
-	userUUID := r.Header.Get("X-User-UUID")
-	token := r.Header.Get("X-Session-Token")
-
-	if userUUID == "" || token == "" {
-		return "", fmt.Errorf("Missing Auth Headers")
-	}
-
-	var count int
-	err := db.QueryRow("SELECT count(*) FROM users WHERE global_uuid=? AND session_token=?", userUUID, token).Scan(&count)
-	if err != nil || count == 0 {
-		return "", fmt.Errorf("Access Denied")
-	}
-	return userUUID, nil
+// --- Helper: Operator Auth ---
+// Admin endpoints require OWNWORLD_ADMIN_KEY to be set and echoed in X-Admin-Key.
+func authenticateAdmin(r *http.Request) bool {
+	key := os.Getenv("OWNWORLD_ADMIN_KEY")
+	return key != "" && r.Header.Get("X-Admin-Key") == key
 }
 
 // --- Federation Handlers ---
 
-func processImmigration() {
-	for req := range immigrationQueue {
-		time.Sleep(2 * time.Second)
-		if Config.PeeringMode == "strict" {
-			continue
-		}
-
-		peerLock.RLock()
-		_, exists := Peers[req.UUID]
-		peerLock.RUnlock()
-		if exists {
-			continue
-		}
+// Checks a handshake is admissible: not already a peer, same genesis, valid key
+func vetImmigrant(req HandshakeRequest) (ed25519.PublicKey, error) {
+	peerLock.RLock()
+	_, exists := Peers[req.UUID]
+	peerLock.RUnlock()
+	if exists {
+		return nil, fmt.Errorf("already a peer")
+	}
 
-		var myGenHash string
-		db.QueryRow("SELECT value FROM system_meta WHERE key='genesis_hash'").Scan(&myGenHash)
-		if req.GenesisHash != myGenHash {
-			continue
-		}
+	var myGenHash string
+	db.QueryRow("SELECT value FROM system_meta WHERE key='genesis_hash'").Scan(&myGenHash)
+	if req.GenesisHash != myGenHash {
+		return nil, fmt.Errorf("genesis mismatch")
+	}
 
-		InfoLog.Printf("IMMIGRATION: Peer %s joined.", req.UUID)
+	pubKeyBytes, err := hex.DecodeString(req.PublicKey)
+	if err != nil || len(pubKeyBytes) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key")
+	}
+	if err := checkStoredPeer(req.UUID, pubKeyBytes); err != nil {
+		return nil, err
+	}
+	return ed25519.PublicKey(pubKeyBytes), nil
+}
 
-		pubKeyBytes, err := hex.DecodeString(req.PublicKey)
-		if err != nil || len(pubKeyBytes) != ed25519.PublicKeySize {
-			continue
-		}
+func admitPeer(req HandshakeRequest, pubKey ed25519.PublicKey) {
+	InfoLog.Printf("IMMIGRATION: Peer %s joined.", req.UUID)
+
+	newPeer := &Peer{
+		UUID:         req.UUID,
+		Url:          req.Address,
+		PublicKey:    pubKey,
+		GenesisHash:  req.GenesisHash,
+		LastSeen:     time.Now(),
+		FirstSeen:    time.Now(),
+		Relation:     0,
+		Reputation:   10.0,
+		Features:     req.Features,
+		Location:     req.Location,
+		LocationSalt: saltOrLegacy(req.LocationSalt),
+		Tolls:        req.Tolls,
+	}
+	recordAdmission(req)
+	restoreStanding(newPeer)
+	savePeer(newPeer)
 
-		newPeer := &Peer{
-			UUID:        req.UUID,
-			Url:         req.Address,
-			PublicKey:   ed25519.PublicKey(pubKeyBytes),
-			GenesisHash: req.GenesisHash,
-			LastSeen:    time.Now(),
-			Relation:    0,
-			Reputation:  10.0,
-		}
+	peerLock.Lock()
+	Peers[req.UUID] = newPeer
+	peerLock.Unlock()
+	go probePeer(newPeer.UUID, newPeer.Url)
 
-		peerLock.Lock()
-		Peers[req.UUID] = newPeer
-		peerLock.Unlock()
-		
-		go recalculateLeader()
-	}
+	settleLocation()
+	go recalculateLeader()
 }
 
 func handleHandshake(w http.ResponseWriter, r *http.Request) {
@@ -89,27 +88,81 @@ func handleHandshake(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	decompressed := decompressLZ4(body)
 	var req HandshakeRequest
-	json.Unmarshal(decompressed, &req)
+	decodeFederation(r, body, &req)
+	observed := observedHost(r)
+	req.Address = peerAddress(req.Address, observed)
 
 	resp := HandshakeResponse{
-		Status:   "Queued",
-		UUID:     ServerUUID,
-		Location: ServerLoc,
-	}
-
-	select {
-	case immigrationQueue <- req:
-		w.WriteHeader(http.StatusAccepted)
+		UUID:         ServerUUID,
+		Location:     ServerLoc,
+		LocationSalt: advertisedLocationSalt(),
+		Features:     enabledFeatures(),
+		Tolls:        currentTolls(),
+		ObservedAddr: observed,
+	}
+	answer := func(code int, status, reason string) {
+		resp.Status, resp.Reason = status, reason
+		if reason != "" {
+			InfoLog.Printf("IMMIGRATION: Handshake from %s: %s (%s)", req.UUID, status, reason)
+		} else {
+			InfoLog.Printf("IMMIGRATION: Handshake from %s: %s", req.UUID, status)
+		}
 		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
 		json.NewEncoder(w).Encode(resp)
-	default:
-		http.Error(w, "Full", 503)
 	}
+
+	if req.UUID == "" {
+		answer(400, HandshakeRejected, "bad handshake")
+		return
+	}
+	if req.GenesisHash != GenesisHash {
+		answer(403, HandshakeGenesis, "this node belongs to genesis "+GenesisHash)
+		return
+	}
+	if err := verifyLocation(req.UUID, req.Location, req.LocationSalt); err != nil {
+		answer(403, HandshakeRejected, err.Error())
+		return
+	}
+
+	// Invited nodes skip the queue (and work even in strict mode)
+	if req.InviteToken != "" {
+		pubKey, err := vetImmigrant(req)
+		if err != nil {
+			answer(400, HandshakeRejected, err.Error())
+			return
+		}
+		if err := redeemInvite(req.InviteToken, req.UUID); err == errInviteUnavailable {
+			// Couldn't record the redemption right now; the queue retries it at top priority
+			if !enqueueImmigrant(req, ImmigrationInvited) {
+				answer(503, HandshakeQueueFull, "")
+				return
+			}
+			answer(http.StatusAccepted, HandshakeQueued, "")
+			return
+		} else if err != nil {
+			answer(403, HandshakeRejected, "invite: "+err.Error())
+			return
+		}
+		admitPeer(req, pubKey)
+		answer(200, HandshakeAccepted, "")
+		return
+	}
+
+	if !enqueueImmigrant(req, immigrationPriority(req)) {
+		answer(503, HandshakeQueueFull, "")
+		return
+	}
+	if Config.PeeringMode == "strict" {
+		answer(http.StatusAccepted, HandshakeStrictPending, "an operator must approve this node")
+		return
+	}
+	answer(http.StatusAccepted, HandshakeQueued, "")
 }
 
 func handleFederationTransaction(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
 	lr := io.LimitReader(r.Body, 1024*1024)
 	body, err := io.ReadAll(lr)
 	if err != nil {
@@ -117,9 +170,8 @@ func handleFederationTransaction(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	decompressed := decompressLZ4(body)
 	var req TransactionRequest
-	json.Unmarshal(decompressed, &req)
+	decodeFederation(r, body, &req)
 
 	peerLock.RLock()
 	peer, known := Peers[req.UUID]
@@ -146,20 +198,45 @@ func handleFederationTransaction(w http.ResponseWriter, r *http.Request) {
 	SeenCurrent[sigHex] = true
 	SeenTxLock.Unlock()
 
-	stateLock.Lock()
 	tickDiff := req.Tick - atomic.LoadInt64(&CurrentTick)
-	stateLock.Unlock()
 
 	if tickDiff < -2 {
 		http.Error(w, "Transaction Expired", 408)
 		return
 	}
 
+	// Settlement messages are answered with a signed receipt (see settlement.go)
+	var settle SettlementEnvelope
+	if err := json.Unmarshal(req.Payload, &settle); err == nil && settle.Settlement != nil {
+		handleSettlementMessage(w, settle.Settlement, req.UUID)
+		return
+	}
+
 	var grievance GrievanceReport
 	if err := json.Unmarshal(req.Payload, &grievance); err == nil && grievance.OffenderUUID != "" {
 		processGrievance(&grievance, req.UUID)
 	}
 
+	var receipt ReparationReceipt
+	if err := json.Unmarshal(req.Payload, &receipt); err == nil && receipt.OffenderNode != "" {
+		processReparation(&receipt, req.UUID)
+	}
+
+	var announcement WorldEventAnnouncement
+	if err := json.Unmarshal(req.Payload, &announcement); err == nil && announcement.Event != nil {
+		processWorldEventAnnouncement(announcement.Event, req.UUID)
+	}
+
+	var ruling ArbitrationAnnouncement
+	if err := json.Unmarshal(req.Payload, &ruling); err == nil && ruling.Verdict != nil {
+		applyVerdict(ruling.Verdict, req.UUID)
+	}
+
+	var council CouncilAnnouncement
+	if err := json.Unmarshal(req.Payload, &council); err == nil && (council.Proposal != nil || council.Ballot != nil) {
+		processCouncilAnnouncement(&council, req.UUID)
+	}
+
 	_, err = db.Exec("INSERT INTO transaction_log (tick, action_type, payload_blob) VALUES (?, 'FED_TX', ?)", req.Tick, req.Payload)
 	if err != nil {
 		http.Error(w, "Internal Error", 500)
@@ -170,14 +247,15 @@ func handleFederationTransaction(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleHeartbeat(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
 	lr := io.LimitReader(r.Body, 1024*1024)
 	body, err := io.ReadAll(lr)
-	if err != nil { return }
-
-	decompressed := decompressLZ4(body)
+	if err != nil {
+		return
+	}
 
 	var req HeartbeatRequest
-	if err := json.Unmarshal(decompressed, &req); err != nil {
+	if err := decodeFederation(r, body, &req); err != nil {
 		http.Error(w, "Bad Payload", 400)
 		return
 	}
@@ -186,7 +264,9 @@ func handleHeartbeat(w http.ResponseWriter, r *http.Request) {
 	peer, known := Peers[req.UUID]
 	peerLock.RUnlock()
 
-	if !known { return }
+	if !known {
+		return
+	}
 
 	msg := fmt.Sprintf("%s:%d", req.UUID, req.Tick)
 	sigBytes, _ := hex.DecodeString(req.Signature)
@@ -198,41 +278,102 @@ func handleHeartbeat(w http.ResponseWriter, r *http.Request) {
 	if p, ok := Peers[req.UUID]; ok {
 		p.LastSeen = time.Now()
 		p.LastTick = req.Tick
+		p.HeartbeatCount++
 		p.PeerCount = req.PeerCount
-		if p.Reputation < 100 { p.Reputation += 0.1 }
+		if len(req.Neighbors) <= MaxGossipNeighbors {
+			p.Neighbors = req.Neighbors
+		}
+		p.Tolls = req.Tolls
+		acceptVision(p, req.Vision)
+		acceptBeacons(p, req.Beacons)
+		acceptSupply(p, req.Supply)
+		if req.Economy != nil && req.Economy.inBounds() {
+			p.Economy = *req.Economy
+		}
+		creditHeartbeat(p)
 	}
 	peerLock.Unlock()
 
-    // GOSSIP: Merge Market Orders
-    if len(req.MarketOrders) > 0 {
-        // Simple merge: insert if not exists (ignore signatures for MVP speed, ideally verify)
-        tx, _ := db.Begin()
-        stmt, _ := tx.Prepare("INSERT OR IGNORE INTO market_orders (order_id, seller_uuid, item, quantity, price, is_buy, origin_system, expires_tick) VALUES (?,?,?,?,?,?,?,?)")
-        for _, mo := range req.MarketOrders {
-            stmt.Exec(mo.ID, mo.SellerUUID, mo.Item, mo.Quantity, mo.Price, mo.IsBuy, mo.OriginSystem, mo.ExpiresTick)
-        }
-        stmt.Close()
-        tx.Commit()
-    }
+	// GOSSIP: Cancellations first, so a withdrawn order in the same heartbeat isn't re-listed
+	if len(req.CancelledOrders) > 0 && featureEnabled(FeatureMarketMatching) {
+		acceptCancellations(req.CancelledOrders)
+	}
+
+	// GOSSIP: Merge Market Orders
+	if len(req.MarketOrders) > 0 && featureEnabled(FeatureMarketMatching) {
+		// Simple merge: insert if not exists (ignore signatures for MVP speed, ideally verify)
+		tx, _ := db.Begin()
+		stmt, _ := tx.Prepare(`INSERT OR IGNORE INTO market_orders (order_id, seller_uuid, item, quantity, price, is_buy, origin_system, expires_tick, origin_node)
+                               SELECT ?,?,?,?,?,?,?,?,? WHERE NOT EXISTS (SELECT 1 FROM cancelled_orders WHERE order_id=?)`)
+		for _, mo := range req.MarketOrders {
+			// Remember which node holds the order so a fill can settle with it; our own orders
+			// echoed back are not re-listed
+			node := mo.Node
+			if node == "" {
+				node = req.UUID
+			}
+			if node == ServerUUID {
+				continue
+			}
+			stmt.Exec(mo.ID, mo.SellerUUID, mo.Item, mo.Quantity, mo.Price, mo.IsBuy, mo.OriginSystem, mo.ExpiresTick, node, mo.ID)
+		}
+		stmt.Close()
+		tx.Commit()
+	}
 
-	if req.UUID == LeaderUUID {
-		syncClock(req.Tick)
+	for _, n := range req.SystemNames {
+		applyGossipedName(n)
 	}
 
+	syncFromPeers(req.UUID, req.Tick)
+
 	w.Write([]byte("OK"))
 }
 
+type MapSystem struct {
+	ID    string `json:"id"`
+	X     int    `json:"x"`
+	Y     int    `json:"y"`
+	Z     int    `json:"z"`
+	Type  string `json:"type"`
+	Owner string `json:"owner,omitempty"`
+	Name  string `json:"name,omitempty"`
+}
+
+// Known systems, rebuilt at most once per tick
 func handleMap(w http.ResponseWriter, r *http.Request) {
-	data := mapSnapshot.Load()
-	if data == nil {
-		w.Write([]byte("[]"))
-		return
-	}
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(data.([]byte))
+	tick := atomic.LoadInt64(&CurrentTick)
+	cb := mapCache.get(strconv.FormatInt(tick, 10), func() []byte {
+		systems := []MapSystem{}
+		for _, s := range allSystems() {
+			systems = append(systems, MapSystem{ID: s.ID, X: s.X, Y: s.Y, Z: s.Z, Type: s.Type, Owner: s.Owner, Name: s.Name})
+		}
+		data, _ := json.Marshal(systems)
+		mapSnapshot.Store(data)
+		return data
+	})
+	serveCachedBody(w, r, cb)
+}
+
+func handleStatus(w http.ResponseWriter, r *http.Request) {
+	tick := atomic.LoadInt64(&CurrentTick)
+	n, noticeVer := currentNotice()
+	tickMS := atomic.LoadInt64(&TickDuration)
+	key := fmt.Sprintf("%d|%d|%s|%v|%d|%d", tick, tickMS, LeaderUUID, ServerLoc, ServerLocSalt, noticeVer)
+	cb := statusCache.get(key, func() []byte {
+		data, _ := json.Marshal(map[string]interface{}{
+			"uuid": ServerUUID, "tick": tick, "tick_duration_ms": tickMS, "leader": LeaderUUID,
+			"location": ServerLoc, "location_salt": advertisedLocationSalt(), "genesis": GenesisHash, "genesis_params": publishedGenesisParams(),
+			"api_versions": APIVersions,
+			"motd":         n.MOTD, "rules": n.Rules, "contact": n.Contact,
+		})
+		return data
+	})
+	serveCachedBody(w, r, cb)
 }
 
 func handleSyncLedger(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
 	if r.Header.Get("X-Fed-Key") != os.Getenv("FEDERATION_KEY") {
 		http.Error(w, "Unauthorized", 401)
 		return
@@ -240,10 +381,17 @@ func handleSyncLedger(w http.ResponseWriter, r *http.Request) {
 
 	sinceDay, _ := strconv.Atoi(r.URL.Query().Get("since_day"))
 	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
-	if limit <= 0 { limit = 50 }
-	if limit > 100 { limit = 100 }
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > 100 {
+		limit = 100
+	}
 
-	rows, err := db.Query(`SELECT day_id, state_blob, final_hash FROM daily_snapshots WHERE day_id > ? ORDER BY day_id ASC LIMIT ?`, sinceDay, limit)
+	// mode=delta: mirror holds since_day already, send deltas between checkpoints
+	deltaMode := r.URL.Query().Get("mode") == "delta"
+
+	rows, err := db.Query(`SELECT day_id, state_blob, final_hash, delta_blob, COALESCE(is_checkpoint, 1) FROM daily_snapshots WHERE day_id > ? ORDER BY day_id ASC LIMIT ?`, sinceDay, limit)
 	if err != nil {
 		http.Error(w, "DB Error", 500)
 		return
@@ -251,15 +399,27 @@ func handleSyncLedger(w http.ResponseWriter, r *http.Request) {
 	defer rows.Close()
 
 	type SnapshotItem struct {
-		DayID     int    `json:"day_id"`
-		Blob      []byte `json:"blob"`
-		FinalHash string `json:"hash"`
+		DayID      int    `json:"day_id"`
+		Blob       []byte `json:"blob,omitempty"`
+		Delta      []byte `json:"delta,omitempty"`
+		Checkpoint bool   `json:"checkpoint"`
+		FinalHash  string `json:"hash"`
 	}
 
 	var history []SnapshotItem
 	for rows.Next() {
 		var h SnapshotItem
-		if err := rows.Scan(&h.DayID, &h.Blob, &h.FinalHash); err != nil { continue }
+		var delta []byte
+		if err := rows.Scan(&h.DayID, &h.Blob, &h.FinalHash, &delta, &h.Checkpoint); err != nil {
+			continue
+		}
+
+		// The first item needs a base unless the mirror claims one (since_day > 0)
+		needsBase := len(history) == 0 && sinceDay == 0
+		if deltaMode && !h.Checkpoint && !needsBase && len(delta) > 0 {
+			h.Delta = delta
+			h.Blob = nil
+		}
 		history = append(history, h)
 	}
 
@@ -279,7 +439,9 @@ func handleReputationQuery(w http.ResponseWriter, r *http.Request) {
 	peerLock.RUnlock()
 
 	score := 0.0
-	if known { score = peer.Reputation }
+	if known {
+		score = peer.Reputation
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]float64{"score": score})
@@ -293,11 +455,40 @@ func generateSessionToken() string {
 	return hex.EncodeToString(b)
 }
 
+// Rotates the user's session token and answers a successful login
+func startLoginSession(w http.ResponseWriter, globalUUID string, failed int) {
+	var sysID string
+	var sysX, sysY, sysZ int
+	token, expires := newSession(globalUUID)
+	db.QueryRow("SELECT id, x, y, z FROM solar_systems WHERE owner_uuid=?", globalUUID).Scan(&sysID, &sysX, &sysY, &sysZ)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":        "logged_in",
+		"user_uuid":     globalUUID,
+		"session_token": token,
+		"system_id":     sysID,
+		"location":      []int{sysX, sysY, sysZ},
+		"message":       "Welcome back, Commander.",
+		"failed_logins": failed,
+		"expires_at":    expires,
+	})
+}
+
 var usernameRegex = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
 
 func handleRegister(w http.ResponseWriter, r *http.Request) {
-	var req struct{ Username, Password string }
-	json.NewDecoder(r.Body).Decode(&req)
+	db := db.WithContext(r.Context())
+	var req struct {
+		Username     string `json:"username" validate:"required"`
+		Password     string `json:"password" validate:"required"`
+		Email        string `json:"email"`         // optional, see recovery.go
+		RecoveryCode bool   `json:"recovery_code"` // optional, see recovery.go
+		InviteCode   string `json:"invite_code"`   // see registration.go
+		Captcha      string `json:"captcha"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
 
 	if len(req.Username) < 3 || len(req.Username) > 20 || !usernameRegex.MatchString(req.Username) {
 		http.Error(w, "Invalid Username (Alphanumeric only, 3-20 chars)", 400)
@@ -305,52 +496,67 @@ func handleRegister(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var storedHash, globalUUID, sysID string
-	var sysX, sysY, sysZ int
 
 	err := db.QueryRow("SELECT password_hash, global_uuid FROM users WHERE username=?", req.Username).Scan(&storedHash, &globalUUID)
 
 	if err == nil {
+		if rejectThrottledLogin(w, req.Username) {
+			return
+		}
 		passHash := hashBLAKE3([]byte(req.Password))
 		if storedHash == passHash {
-			token := generateSessionToken()
-			db.Exec("UPDATE users SET session_token=? WHERE global_uuid=?", token, globalUUID)
-			errLoc := db.QueryRow("SELECT id, x, y, z FROM solar_systems WHERE owner_uuid=?", globalUUID).Scan(&sysID, &sysX, &sysY, &sysZ)
-			if errLoc != nil {} 
-
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"status":        "logged_in",
-				"user_uuid":     globalUUID,
-				"session_token": token,
-				"system_id":     sysID,
-				"location":      []int{sysX, sysY, sysZ},
-				"message":       "Welcome back, Commander.",
-			})
+			startLoginSession(w, globalUUID, clearLoginFailures(req.Username))
 			return
 		} else {
+			recordLoginFailure(req.Username, globalUUID)
 			http.Error(w, "Invalid Credentials", 401)
 			return
 		}
 	}
 
+	if Config.RegistrationClosed {
+		http.Error(w, "Registration Closed on this Node", 403)
+		return
+	}
+	if req.Email != "" && !validEmail(req.Email) {
+		http.Error(w, "Invalid Email", 400)
+		return
+	}
+	if req.Email != "" && mailer == nil {
+		http.Error(w, "Email Not Configured on this Node", 503)
+		return
+	}
+	code, ok := checkRegistration(w, r, req.InviteCode, req.Captcha)
+	if !ok {
+		return
+	}
+
 	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
 	userUUID := hashBLAKE3(pub)
 	pubHex := hex.EncodeToString(pub)
 	privEnc := encryptKey(priv, req.Password)
 	passHash := hashBLAKE3([]byte(req.Password))
 	token := generateSessionToken()
+	expires := time.Now().Add(SessionTTL).Unix()
 
-	_, err = db.Exec(`INSERT INTO users (global_uuid, username, password_hash, is_local, ed25519_pubkey, ed25519_priv_enc, session_token) 
-	                   VALUES (?, ?, ?, 1, ?, ?, ?)`, userUUID, req.Username, passHash, pubHex, privEnc, token)
+	_, err = db.Exec(`INSERT INTO users (global_uuid, username, password_hash, is_local, ed25519_pubkey, ed25519_priv_enc, session_token, created_at, expires_at) 
+	                   VALUES (?, ?, ?, 1, ?, ?, ?, ?, ?)`, userUUID, req.Username, passHash, pubHex, privEnc, token, time.Now().Unix(), expires)
 
 	if err != nil {
+		if code != "" {
+			refundRegistrationCode(code)
+		}
 		http.Error(w, "Taken", 400)
 		return
 	}
+	recordRegistration(observedHost(r))
 
 	found := false
 	var sysXNew, sysYNew, sysZNew int
-	
-	if ServerLoc == nil { ServerLoc = []int{0, 0, 0} }
+
+	if ServerLoc == nil {
+		ServerLoc = []int{0, 0, 0}
+	}
 
 	for i := 0; i < 50; i++ {
 		uuidBytes, _ := hex.DecodeString(userUUID)
@@ -375,31 +581,51 @@ func handleRegister(w http.ResponseWriter, r *http.Request) {
 		sysXNew, sysYNew, sysZNew = ServerLoc[0], ServerLoc[1], ServerLoc[2]
 	}
 
-	_, errSys := db.Exec("INSERT OR IGNORE INTO solar_systems (id, x, y, z, star_type, owner_uuid) VALUES (?, ?, ?, ?, 'G2V', ?)",
-		sysID, sysXNew, sysYNew, sysZNew, ServerUUID) 
-	if errSys != nil {}
+	_, errSys := db.Exec("INSERT OR IGNORE INTO solar_systems (id, x, y, z, star_type, owner_uuid, discoverer_uuid) VALUES (?, ?, ?, ?, 'G2V', ?, ?)",
+		sysID, sysXNew, sysYNew, sysZNew, ServerUUID, userUUID)
+	if errSys != nil {
+	}
+	reindexSystem(sysID)
 
 	startBuilds := `{"farm": 5, "iron_mine": 5, "urban_housing": 10}`
 	// FIX: Start with 1000 pop
 	_, errCol := db.Exec(`INSERT INTO colonies (system_id, owner_uuid, name, pop_laborers, food, iron, buildings_json) 
 	         VALUES (?, ?, ?, 1000, 2000, 1000, ?)`, sysID, userUUID, req.Username+" Prime", startBuilds)
-	
-	if errCol != nil {}
+
+	if errCol != nil {
+	}
 
 	modules := `["warp_drive", "warp_drive", "colony_kit"]`
-	_, errFleet := db.Exec(`INSERT INTO fleets (owner_uuid, status, origin_system, hull_class, modules_json, fuel) 
-			 VALUES (?, 'ORBIT', ?, 'Colonizer', ?, 2000)`, userUUID, sysID, modules)
-	
-	if errFleet != nil {}
+	_, errFleet := db.Exec(`INSERT INTO fleets (owner_uuid, status, origin_system, hull_class, modules_json, fuel, home_system) 
+			 VALUES (?, 'ORBIT', ?, 'Colonizer', ?, 2000, ?)`, userUUID, sysID, modules, sysID)
 
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	if errFleet != nil {
+	}
+
+	resp := map[string]interface{}{
 		"status":        "registered",
 		"user_uuid":     userUUID,
 		"session_token": token,
 		"system_id":     sysID,
 		"location":      []int{sysXNew, sysYNew, sysZNew},
 		"message":       "Identity Secured. Colony Founded. Ark Ship Ready.",
-	})
+		"expires_at":    expires,
+	}
+	// Recovery is best-effort here: the account exists either way and both can be set up later
+	if req.Email != "" {
+		if err := setRecoveryEmail(userUUID, req.Email, priv); err != nil {
+			ErrorLog.Printf("Recovery mail to %s failed: %v", req.Email, err)
+		} else {
+			resp["email"] = "verification sent"
+		}
+	}
+	if req.RecoveryCode {
+		if code, err := setRecoveryCode(userUUID, priv); err == nil {
+			resp["recovery_code"] = code
+		}
+	}
+
+	json.NewEncoder(w).Encode(resp)
 }
 
 func handleScan(w http.ResponseWriter, r *http.Request) {
@@ -408,40 +634,55 @@ func handleScan(w http.ResponseWriter, r *http.Request) {
 		TargetY int `json:"y"`
 		TargetZ int `json:"z"`
 	}
-	json.NewDecoder(r.Body).Decode(&req)
+	if !decodeJSON(w, r, &req) {
+		return
+	}
 
-	_, err := authenticate(r)
+	userID, err := authenticate(r)
 	if err != nil {
 		http.Error(w, "Unauthorized", 401)
 		return
 	}
 
-    // Fix B: Backend "Real" Scanner
-    var dbExists int
-    db.QueryRow("SELECT count(*) FROM solar_systems WHERE x=? AND y=? AND z=?", req.TargetX, req.TargetY, req.TargetZ).Scan(&dbExists)
-
-	data := GetSectorData(req.TargetX, req.TargetY, req.TargetZ)
+	// Fix B: Backend "Real" Scanner (cached per tick, see survey.go)
+	data, charted, proof := scanSector(req.TargetX, req.TargetY, req.TargetZ)
 
-	if !data.HasSystem && dbExists == 0 {
+	if !data.HasSystem && !charted {
 		w.Write([]byte(`{"result": "void", "message": "No significant gravity well detected."}`))
 		return
 	}
-    
-    // If DB exists but procedural math said false (rare, but possible with manual overrides), force true
-    if dbExists > 0 {
-        data.HasSystem = true
-    }
 
-	json.NewEncoder(w).Encode(data)
+	// If DB exists but procedural math said false (rare, but possible with manual overrides), force true
+	if charted {
+		data.HasSystem = true
+	}
+
+	// Exact potentials only for systems this player has surveyed
+	survey := SurveyDetailed
+	if !hasSurveyed(userID, fmt.Sprintf("sys-%d-%d-%d", req.TargetX, req.TargetY, req.TargetZ)) {
+		survey = SurveyBasic
+		data.Resources = basicResources(data.Resources)
+	}
+
+	// Node-held systems come with the owner's signed snapshot proof (see scanproof.go)
+	json.NewEncoder(w).Encode(struct {
+		SectorPotential
+		Survey string     `json:"survey"`
+		Proof  *ScanProof `json:"proof,omitempty"`
+	}{data, survey, proof})
 }
 
 func handleFleetLaunch(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
 	var req struct {
-		FleetID      int    `json:"fleet_id"`
-		TargetSystem string `json:"target_system"`
-        TargetOrderID string `json:"target_order_id"` 
+		FleetID       int    `json:"fleet_id" validate:"required"`
+		TargetSystem  string `json:"target_system"`
+		Beacon        string `json:"beacon"` // in place of target_system (see beacons.go)
+		TargetOrderID string `json:"target_order_id"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
 	}
-	json.NewDecoder(r.Body).Decode(&req)
 
 	userID, err := authenticate(r)
 	if err != nil {
@@ -449,51 +690,45 @@ func handleFleetLaunch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	stateLock.Lock()
-	defer stateLock.Unlock()
+	if req.TargetSystem == "" {
+		if req.Beacon == "" {
+			http.Error(w, "Bad Request: missing field 'target_system'", 400)
+			return
+		}
+		b, ok := findBeacon(userID, req.Beacon)
+		if !ok {
+			http.Error(w, "Beacon Not Found", 404)
+			return
+		}
+		req.TargetSystem = b.SystemID()
+	}
+
+	defer lockRows(userRow(userID))()
 
 	var f Fleet
 	var currentSys string
-	var modJson string
-	err = db.QueryRow("SELECT owner_uuid, origin_system, fuel, status, hull_class, modules_json FROM fleets WHERE id=?", req.FleetID).Scan(&f.OwnerUUID, &currentSys, &f.Fuel, &f.Status, &f.HullClass, &modJson)
+	var modJson, condJson string
+	err = db.QueryRow("SELECT owner_uuid, origin_system, fuel, status, hull_class, modules_json, COALESCE(module_condition_json, '') FROM fleets WHERE id=?", req.FleetID).Scan(&f.OwnerUUID, &currentSys, &f.Fuel, &f.Status, &f.HullClass, &modJson, &condJson)
 
 	if err != nil {
 		http.Error(w, "Fleet Not Found", 404)
 		return
 	}
-	
+
 	if f.OwnerUUID != userID {
 		http.Error(w, "Not your fleet", 403)
 		return
 	}
 
 	json.Unmarshal([]byte(modJson), &f.Modules)
+	f.Condition = parseCondition(condJson)
 
 	if f.Status != "ORBIT" {
 		http.Error(w, "Fleet in transit", 400)
 		return
 	}
 
-	originCoords := GetSystemCoords(currentSys)
-	targetCoords := []int{0, 0, 0}
-	if len(req.TargetSystem) > 4 && req.TargetSystem[:4] == "sys-" {
-		targetCoords = GetSystemCoords(req.TargetSystem)
-		if targetCoords[0] == 0 && targetCoords[1] == 0 && targetCoords[2] == 0 {
-			fmt.Sscanf(req.TargetSystem, "sys-%d-%d-%d", &targetCoords[0], &targetCoords[1], &targetCoords[2])
-		}
-	} else {
-		targetCoords = originCoords
-	}
-
-	mass := 1000
-	for range f.Modules {
-		mass += 100
-	}
-
-	var targetOwner string
-	db.QueryRow("SELECT owner_uuid FROM solar_systems WHERE id=?", req.TargetSystem).Scan(&targetOwner)
-
-	cost := CalculateFuelCost(originCoords, targetCoords, mass, targetOwner)
+	cost, travelTime := computeWornRoute(currentSys, req.TargetSystem, f.HullClass, f.Modules, f.Condition)
 
 	if cost < 0 {
 		http.Error(w, "Cost Overflow", 400)
@@ -505,40 +740,21 @@ func handleFleetLaunch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dist := 0.0
-	for i := 0; i < 3; i++ {
-		dist += math.Pow(float64(originCoords[i]-targetCoords[i]), 2)
-	}
-	distance := math.Sqrt(dist)
+	arrivalTick := atomic.LoadInt64(&CurrentTick) + travelTime
 
-    // FIX 1: Engine Logic (Count boosters and propellers)
-	warpCount := 0
-    engineCount := 0
-	for _, m := range f.Modules {
-		if m == "warp_drive" { warpCount++ }
-        if m == "booster" || m == "propeller" { engineCount++ }
+	targetOrderVal := sql.NullString{}
+	if req.TargetOrderID != "" && !featureEnabled(FeatureMarketMatching) {
+		http.Error(w, "Market matching is disabled on this node", 403)
+		return
 	}
-
-	travelTime := int64(distance)
-	reduction := float64(travelTime) * (0.2 * float64(warpCount))
-    reduction += float64(travelTime) * (0.05 * float64(engineCount)) // Standard engines add 5% speed each
-	travelTime -= int64(reduction)
-    
-	if travelTime < 1 {
-		travelTime = 1
+	if req.TargetOrderID != "" {
+		targetOrderVal.String = req.TargetOrderID
+		targetOrderVal.Valid = true
 	}
 
-	arrivalTick := atomic.LoadInt64(&CurrentTick) + travelTime
-
-    targetOrderVal := sql.NullString{}
-    if req.TargetOrderID != "" {
-        targetOrderVal.String = req.TargetOrderID
-        targetOrderVal.Valid = true
-    }
-
-	db.Exec(`UPDATE fleets SET status='TRANSIT', fuel=fuel-?, dest_system=?, 
+	db.Exec(`UPDATE fleets SET status='TRANSIT', fuel=fuel-?, route_fuel=?, dest_system=?, 
 	         departure_tick=?, arrival_tick=?, target_order_id=? WHERE id=?`,
-		cost, req.TargetSystem, atomic.LoadInt64(&CurrentTick), arrivalTick, targetOrderVal, req.FleetID)
+		cost, cost, req.TargetSystem, atomic.LoadInt64(&CurrentTick), arrivalTick, targetOrderVal, req.FleetID)
 
 	w.Write([]byte(fmt.Sprintf("Fleet Launched. Cost: %d. Arrival Tick: %d", cost, arrivalTick)))
 }
@@ -550,13 +766,62 @@ var validResources = map[string]bool{
 	"steel": true, "wine": true,
 }
 
+// Assigns a fleet's home base and toggles auto-return (applied by the tick on arrival/after combat)
+func handleFleetHome(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	var req struct {
+		FleetID    int    `json:"fleet_id" validate:"required"`
+		HomeSystem string `json:"home_system"`
+		AutoReturn bool   `json:"auto_return"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	defer lockRows(userRow(userID))()
+
+	var owner string
+	err = db.QueryRow("SELECT owner_uuid FROM fleets WHERE id=?", req.FleetID).Scan(&owner)
+	if err != nil {
+		http.Error(w, "Fleet Not Found", 404)
+		return
+	}
+	if owner != userID {
+		http.Error(w, "Not your fleet", 403)
+		return
+	}
+
+	// Home must be one of the owner's colonies
+	if req.HomeSystem != "" {
+		var count int
+		db.QueryRow("SELECT count(*) FROM colonies WHERE system_id=? AND owner_uuid=?", req.HomeSystem, userID).Scan(&count)
+		if count == 0 {
+			http.Error(w, "Home must be one of your colonies", 400)
+			return
+		}
+		db.Exec("UPDATE fleets SET home_system=? WHERE id=?", req.HomeSystem, req.FleetID)
+	}
+
+	db.Exec("UPDATE fleets SET auto_return=? WHERE id=?", req.AutoReturn, req.FleetID)
+	w.Write([]byte("Fleet Home Updated"))
+}
+
 func handleBankBurn(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
 	var req struct {
-		ColonyID int    `json:"colony_id"`
-		Item     string `json:"item"`
-		Amount   int    `json:"amount"`
+		ColonyID int    `json:"colony_id" validate:"required"`
+		Item     string `json:"item" validate:"required"`
+		Amount   int    `json:"amount" validate:"required"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
 	}
-	json.NewDecoder(r.Body).Decode(&req)
 
 	userID, err := authenticate(r)
 	if err != nil {
@@ -574,8 +839,7 @@ func handleBankBurn(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	stateLock.Lock()
-	defer stateLock.Unlock()
+	defer lockRows(userRow(userID))()
 
 	var owner string
 	err = db.QueryRow("SELECT owner_uuid FROM colonies WHERE id=?", req.ColonyID).Scan(&owner)
@@ -584,14 +848,7 @@ func handleBankBurn(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	eff := GetEfficiency(req.ColonyID, req.Item)
-	if eff < 0.1 {
-		eff = 0.1
-	}
-
-	multiplier := 1.0 / eff
-	basePrice := 1.0
-	payout := int(float64(req.Amount) * basePrice * multiplier)
+	payout := burnPayout(req.ColonyID, req.Item, req.Amount)
 
 	if payout < 0 {
 		http.Error(w, "Payout Calculation Overflow", 500)
@@ -608,6 +865,8 @@ func handleBankBurn(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	tx.Exec("UPDATE users SET credits = credits + ? WHERE global_uuid=?", payout, userID)
+	burnJson, _ := json.Marshal(BurnRecord{UserUUID: userID, Item: req.Item, Amount: req.Amount, Payout: payout, ColonyID: req.ColonyID})
+	tx.Exec("INSERT INTO transaction_log (tick, action_type, payload_blob) VALUES (?, 'BANK_BURN', ?)", atomic.LoadInt64(&CurrentTick), burnJson)
 	tx.Commit()
 
 	w.Write([]byte(fmt.Sprintf("Burned %d for %d credits", req.Amount, payout)))
@@ -625,7 +884,7 @@ func validateModules(hullClass string, modules []string) bool {
 		switch mod {
 		case "booster", "propeller", "warp_drive":
 			engines++
-		case "laser", "railgun":
+		case "laser", "railgun", "boarding_pod":
 			weapons++
 		case "bomb_bay", "colony_kit":
 			specials++
@@ -650,13 +909,16 @@ func validateModules(hullClass string, modules []string) bool {
 }
 
 func handleConstruct(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
 	var req struct {
-		ColonyID  int          `json:"colony_id"`
-		HullClass string       `json:"hull_class"`
+		ColonyID  int          `json:"colony_id" validate:"required"`
+		HullClass string       `json:"hull_class" validate:"required"`
 		Modules   []string     `json:"modules"`
 		Payload   FleetPayload `json:"payload"`
 	}
-	json.NewDecoder(r.Body).Decode(&req)
+	if !decodeJSON(w, r, &req) {
+		return
+	}
 
 	userID, err := authenticate(r)
 	if err != nil {
@@ -669,27 +931,20 @@ func handleConstruct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The hull is raw iron; modules come out of the colony's module stock
 	totalIron := 1000
-	totalGold := 0
-	for _, mod := range req.Modules {
-		totalIron += ModuleCosts[mod]
-		if mod == "warp_drive" {
-			totalGold += 100
-		}
-	}
 
-	stateLock.Lock()
-	defer stateLock.Unlock()
+	defer lockRows(userRow(userID))()
 
 	var c Colony
-	var bJson string
-	err = db.QueryRow("SELECT buildings_json, system_id, owner_uuid, iron, gold, food, pop_laborers FROM colonies WHERE id=?", req.ColonyID).Scan(&bJson, &c.SystemID, &c.OwnerUUID, &c.Iron, &c.Gold, &c.Food, &c.PopLaborers)
+	var bJson, msJson string
+	err = db.QueryRow("SELECT buildings_json, system_id, owner_uuid, iron, food, pop_laborers, COALESCE(module_stock_json, '{}') FROM colonies WHERE id=?", req.ColonyID).Scan(&bJson, &c.SystemID, &c.OwnerUUID, &c.Iron, &c.Food, &c.PopLaborers, &msJson)
 
 	if err != nil {
 		http.Error(w, "Colony Not Found", 404)
 		return
 	}
-	
+
 	if c.OwnerUUID != userID {
 		http.Error(w, "Access Denied", 403)
 		return
@@ -701,6 +956,10 @@ func handleConstruct(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Shipyard Required", 400)
 		return
 	}
+	if err := checkUnlocks(req.HullClass, req.Modules, c.Buildings, userTechs(userID)); err != nil {
+		http.Error(w, "Locked: "+err.Error(), 400)
+		return
+	}
 
 	neededCrew := 50
 
@@ -712,7 +971,7 @@ func handleConstruct(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Negative Payload", 400)
 		return
 	}
-	
+
 	for _, v := range req.Payload.Resources {
 		if v < 0 {
 			http.Error(w, "Negative Payload Resource", 400)
@@ -720,34 +979,133 @@ func handleConstruct(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	c.ModuleStock = make(map[string]int)
+	json.Unmarshal([]byte(msJson), &c.ModuleStock)
+	if err := takeModules(c.ModuleStock, req.Modules); err != nil {
+		http.Error(w, err.Error(), 402)
+		return
+	}
+
 	if c.Iron < (totalIron+payloadIron) ||
-		c.Gold < totalGold ||
 		c.Food < payloadFood ||
 		c.PopLaborers < (neededCrew+payloadLabs) {
 		http.Error(w, "Insufficient Resources for Hull + Payload", 402)
 		return
 	}
 
-	db.Exec("UPDATE colonies SET iron=iron-?, gold=gold-?, food=food-?, pop_laborers=pop_laborers-? WHERE id=?",
-		totalIron+payloadIron, totalGold, payloadFood, neededCrew+payloadLabs, req.ColonyID)
+	stockJson, _ := json.Marshal(c.ModuleStock)
+	db.Exec("UPDATE colonies SET iron=iron-?, food=food-?, pop_laborers=pop_laborers-?, module_stock_json=? WHERE id=?",
+		totalIron+payloadIron, payloadFood, neededCrew+payloadLabs, string(stockJson), req.ColonyID)
 
 	modJson, _ := json.Marshal(req.Modules)
 	payloadJson, _ := json.Marshal(req.Payload)
+	tons := shipTonnage(req.HullClass, req.Modules)
 
-	db.Exec(`INSERT INTO fleets (owner_uuid, status, fuel, origin_system, dest_system, hull_class, modules_json, payload_json) 
-			 VALUES (?, 'ORBIT', ?, ?, ?, ?, ?, ?)`,
-		c.OwnerUUID, 1000, c.SystemID, c.SystemID, req.HullClass, string(modJson), string(payloadJson))
+	db.Exec(`INSERT INTO fleets (owner_uuid, status, fuel, origin_system, dest_system, hull_class, modules_json, payload_json, home_system, build_remaining) 
+			 VALUES (?, 'CONSTRUCTING', ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.OwnerUUID, 1000, c.SystemID, c.SystemID, req.HullClass, string(modJson), string(payloadJson), c.SystemID, tons)
 
-	w.Write([]byte("Ship Constructed with Payload"))
+	// ETA assumes a free slot; queued hulls wait for one
+	var queued int
+	db.QueryRow("SELECT count(*) FROM fleets WHERE status='CONSTRUCTING' AND origin_system=? AND owner_uuid=?", c.SystemID, c.OwnerUUID).Scan(&queued)
+	w.Write([]byte(fmt.Sprintf("Hull Laid Down: %d tons, %d ticks per slot (%d in queue, %d slots)", tons, buildTicks(tons), queued, c.Buildings["shipyard"])))
+}
+
+// Swaps the modules of an orbiting fleet at a friendly shipyard. Part of the crew moves on,
+// so only RefitXPRetention of the experience survives.
+func handleFleetRefit(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	var req struct {
+		FleetID int      `json:"fleet_id" validate:"required"`
+		Modules []string `json:"modules"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	defer lockRows(userRow(userID))()
+
+	var f Fleet
+	var oldModJson, condJson string
+	err = db.QueryRow("SELECT owner_uuid, status, origin_system, hull_class, COALESCE(experience, 0), modules_json, COALESCE(module_condition_json, '') FROM fleets WHERE id=?", req.FleetID).
+		Scan(&f.OwnerUUID, &f.Status, &f.OriginSystem, &f.HullClass, &f.Experience, &oldModJson, &condJson)
+	if err != nil {
+		http.Error(w, "Fleet Not Found", 404)
+		return
+	}
+	if f.OwnerUUID != userID {
+		http.Error(w, "Access Denied", 403)
+		return
+	}
+	if f.Status != "ORBIT" {
+		http.Error(w, "Fleet must be in orbit", 400)
+		return
+	}
+	if !validateModules(f.HullClass, req.Modules) {
+		http.Error(w, "Invalid Configuration", 400)
+		return
+	}
+
+	var colID int
+	var bJson, msJson string
+	err = db.QueryRow("SELECT id, buildings_json, COALESCE(module_stock_json, '{}') FROM colonies WHERE system_id=? AND owner_uuid=? AND COALESCE(site_type, 'planet')='planet'", f.OriginSystem, userID).Scan(&colID, &bJson, &msJson)
+	if err != nil {
+		http.Error(w, "No Friendly Colony in System", 400)
+		return
+	}
+	buildings := make(map[string]int)
+	json.Unmarshal([]byte(bJson), &buildings)
+	if buildings["shipyard"] < 1 {
+		http.Error(w, "Shipyard Required", 400)
+		return
+	}
+	if err := checkUnlocks("", req.Modules, buildings, userTechs(userID)); err != nil {
+		http.Error(w, "Locked: "+err.Error(), 400)
+		return
+	}
+
+	// Modules that stay fitted keep their wear; stripped ones go back into the colony's stock
+	// unless worn (those are scrapped), and new ones come out of it
+	stock := make(map[string]int)
+	json.Unmarshal([]byte(msJson), &stock)
+	json.Unmarshal([]byte(oldModJson), &f.Modules)
+	condition, returned := refitCondition(f.Modules, parseCondition(condJson), req.Modules)
+	kept := withoutModules(f.Modules, returned)
+	for _, m := range returned {
+		stock[m]++
+	}
+	if err := takeModules(stock, withoutModules(req.Modules, kept)); err != nil {
+		http.Error(w, err.Error(), 402)
+		return
+	}
+
+	keptXP := int(float64(f.Experience) * RefitXPRetention)
+	modJson, _ := json.Marshal(req.Modules)
+	cJson, _ := json.Marshal(condition)
+	stockJson, _ := json.Marshal(stock)
+
+	db.Exec("UPDATE colonies SET module_stock_json=? WHERE id=?", string(stockJson), colID)
+	db.Exec("UPDATE fleets SET modules_json=?, module_condition_json=?, experience=? WHERE id=?", string(modJson), string(cJson), keptXP, req.FleetID)
+
+	w.Write([]byte(fmt.Sprintf("Fleet Refitted (Veterancy %d -> %d)", veterancy(f.Experience), veterancy(keptXP))))
 }
 
 func handleBuild(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
 	var req struct {
-		ColonyID  int    `json:"colony_id"`
-		Structure string `json:"structure"`
-		Amount    int    `json:"amount"`
+		ColonyID  int    `json:"colony_id" validate:"required"`
+		Structure string `json:"structure" validate:"required"`
+		Amount    int    `json:"amount" validate:"required"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
 	}
-	json.NewDecoder(r.Body).Decode(&req)
 
 	userID, err := authenticate(r)
 	if err != nil {
@@ -766,21 +1124,28 @@ func handleBuild(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	stateLock.Lock()
-	defer stateLock.Unlock()
+	defer lockRows(userRow(userID), colonyOwnerRow(req.ColonyID))()
 
 	var c Colony
 	var bJson string
-	err = db.QueryRow("SELECT buildings_json, iron, carbon, owner_uuid FROM colonies WHERE id=?", req.ColonyID).Scan(&bJson, &c.Iron, &c.Carbon, &c.OwnerUUID)
+	err = db.QueryRow("SELECT buildings_json, iron, carbon, owner_uuid, COALESCE(site_type, 'planet') FROM colonies WHERE id=?", req.ColonyID).Scan(&bJson, &c.Iron, &c.Carbon, &c.OwnerUUID, &c.SiteType)
 	if err != nil {
 		http.Error(w, "Colony Not Found", 404)
 		return
 	}
 
-	if c.OwnerUUID != userID {
+	if !canManageColony(userID, req.ColonyID, c.OwnerUUID) {
 		http.Error(w, "Access Denied", 403)
 		return
 	}
+	if !siteAllows(c.SiteType, req.Structure) {
+		http.Error(w, fmt.Sprintf("%s cannot be built at an outpost (%s)", req.Structure, c.SiteType), 400)
+		return
+	}
+	if tech, ok := BuildingTechs[req.Structure]; ok && !userTechs(c.OwnerUUID)[tech] {
+		http.Error(w, "Locked: "+req.Structure+" requires "+techName(tech), 400)
+		return
+	}
 
 	neededIron := cost["iron"] * req.Amount
 	neededCarbon := cost["carbon"] * req.Amount
@@ -808,11 +1173,22 @@ func handleBuild(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleDeploy(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
 	var req struct {
-		FleetID int    `json:"fleet_id"`
-		Name    string `json:"name"`
+		FleetID  int    `json:"fleet_id" validate:"required"`
+		Name     string `json:"name" validate:"required"`
+		SiteType string `json:"site_type"` // default planet; an outpost needs your colony on the planet
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.SiteType == "" {
+		req.SiteType = SitePlanet
+	}
+	if !validSite(req.SiteType) {
+		http.Error(w, "Unknown Site Type", 400)
+		return
 	}
-	json.NewDecoder(r.Body).Decode(&req)
 
 	userID, err := authenticate(r)
 	if err != nil {
@@ -820,14 +1196,17 @@ func handleDeploy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	stateLock.Lock()
-	defer stateLock.Unlock()
+	// The site check below must exclude other players settling the same system, so the system is
+	// locked too; the fleet is looked up again under the lock in case it moved meanwhile
+	var lockedSys string
+	db.QueryRow("SELECT origin_system FROM fleets WHERE id=?", req.FleetID).Scan(&lockedSys)
+	defer lockRows(userRow(userID), systemRow(lockedSys))()
 
 	var sysID, owner string
 	var modJson, payloadJson string
 	err = db.QueryRow("SELECT origin_system, owner_uuid, modules_json, payload_json FROM fleets WHERE id=? AND status='ORBIT'", req.FleetID).Scan(&sysID, &owner, &modJson, &payloadJson)
 
-	if err != nil {
+	if err != nil || sysID != lockedSys {
 		http.Error(w, "Fleet Not Available", 400)
 		return
 	}
@@ -854,12 +1233,28 @@ func handleDeploy(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var colonyCount int
-	db.QueryRow("SELECT count(*) FROM colonies WHERE system_id=?", sysID).Scan(&colonyCount)
+	db.QueryRow("SELECT count(*) FROM colonies WHERE system_id=? AND COALESCE(site_type, 'planet')=?", sysID, req.SiteType).Scan(&colonyCount)
 	if colonyCount > 0 {
-		http.Error(w, "System Already Colonized", 409)
+		if req.SiteType == SitePlanet {
+			http.Error(w, "System Already Colonized", 409)
+		} else {
+			http.Error(w, "Site Already Settled", 409)
+		}
 		return
 	}
 
+	// Outposts hang off the planet colony, which must be ours
+	var planetID int
+	var planetCulture float64
+	if req.SiteType != SitePlanet {
+		err := db.QueryRow("SELECT id, COALESCE(culture, 0) FROM colonies WHERE system_id=? AND owner_uuid=? AND COALESCE(site_type, 'planet')=?",
+			sysID, userID, SitePlanet).Scan(&planetID, &planetCulture)
+		if err != nil {
+			http.Error(w, "Outposts need your colony on the planet", 400)
+			return
+		}
+	}
+
 	var payload FleetPayload
 	startFood := 100
 	startPop := 100 // Default base population (crew)
@@ -870,8 +1265,8 @@ func handleDeploy(w http.ResponseWriter, r *http.Request) {
 		if err := json.Unmarshal([]byte(payloadJson), &payload); err == nil {
 			startFood = payload.Resources["food"]
 			startIron = payload.Resources["iron"]
-            // Fix C: Patch Glitch (Base Crew + Passengers)
-			startPop = 50 + payload.PopLaborers 
+			// Fix C: Patch Glitch (Base Crew + Passengers)
+			startPop = 50 + payload.PopLaborers
 			bonusCulture = payload.CultureBonus
 		}
 	}
@@ -879,17 +1274,27 @@ func handleDeploy(w http.ResponseWriter, r *http.Request) {
 	bJson, _ := json.Marshal(map[string]int{"urban_housing": 10})
 
 	var parentID int
-	db.QueryRow("SELECT id FROM colonies WHERE owner_uuid=? LIMIT 1", owner).Scan(&parentID)
+	var parentCulture float64
+	if planetID != 0 {
+		parentID, parentCulture = planetID, planetCulture
+	} else {
+		db.QueryRow("SELECT id, COALESCE(culture, 0) FROM colonies WHERE owner_uuid=? LIMIT 1", owner).Scan(&parentID, &parentCulture)
+	}
 
 	_, err = db.Exec(`INSERT INTO colonies (
 		system_id, owner_uuid, name, buildings_json, 
-		pop_laborers, food, iron, parent_colony_id, stability_target
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		pop_laborers, food, iron, parent_colony_id, stability_target, culture, site_type
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		sysID, owner, req.Name, string(bJson),
-		startPop, startFood, startIron, parentID, 50.0+bonusCulture)
+		startPop, startFood, startIron, parentID, 50.0+bonusCulture,
+		parentCulture*CultureInheritance+bonusCulture, req.SiteType)
 
 	if err == nil {
 		db.Exec("DELETE FROM fleets WHERE id=?", req.FleetID)
+		if req.SiteType != SitePlanet {
+			w.Write([]byte("Outpost Established"))
+			return
+		}
 		w.Write([]byte("Colony Established"))
 	} else {
 		http.Error(w, "Deployment Failed", 500)
@@ -897,6 +1302,7 @@ func handleDeploy(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleState(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
 	userID, err := authenticate(r)
 	if err != nil {
 		if DebugLog != nil {
@@ -911,16 +1317,24 @@ func handleState(w http.ResponseWriter, r *http.Request) {
 	}
 
 	type Resp struct {
-		Colonies []Colony `json:"colonies"`
-		Fleets   []Fleet  `json:"fleets"`
-		Credits  int      `json:"credits"`
+		Colonies []Colony      `json:"colonies"`
+		Fleets   []Fleet       `json:"fleets"`
+		Credits  int           `json:"credits"`
+		Culture  EmpireCulture `json:"culture"`
+		Refugees []RefugeeFlow `json:"refugees,omitempty"`
 	}
 	var resp Resp
 
 	resp.Colonies = []Colony{}
 	resp.Fleets = []Fleet{}
 
-	rows, err := db.Query(`SELECT id, name, system_id, parent_colony_id, pop_laborers, pop_specialists, pop_elites, food, water, iron, carbon, gold, steel, wine, buildings_json, stability_current FROM colonies WHERE owner_uuid=?`, userID)
+	// Governed colonies are listed too; owner_uuid tells them apart
+	rows, err := db.Query(`SELECT c.id, c.owner_uuid, c.name, c.system_id, c.parent_colony_id, c.pop_laborers, c.pop_specialists, c.pop_elites, c.food, c.water, c.iron, c.carbon, c.gold, c.steel, c.wine, c.buildings_json, c.stability_current, c.stability_target, COALESCE(c.stability_json, '{}'), COALESCE(c.culture, 0),
+	                       c.vegetation, c.oxygen, COALESCE(c.terraform, 0), COALESCE(c.airless_ticks, 0), COALESCE(s.x, 0), COALESCE(s.y, 0), COALESCE(s.z, 0),
+	                       COALESCE(c.module_stock_json, '{}'), COALESCE(c.module_queue_json, '[]'),
+	                       COALESCE(c.uranium, 0), COALESCE(c.plutonium, 0), COALESCE(c.workforce_json, ''), COALESCE(c.automation_json, ''), COALESCE(c.site_type, 'planet')
+	                       FROM colonies c LEFT JOIN solar_systems s ON c.system_id = s.id
+	                       WHERE c.owner_uuid=? OR c.id IN (SELECT colony_id FROM colony_governors WHERE governor_uuid=?)`, userID, userID)
 	if err != nil {
 		if DebugLog != nil {
 			DebugLog.Printf("❌ DB Query Error (Colonies): %v", err)
@@ -929,8 +1343,13 @@ func handleState(w http.ResponseWriter, r *http.Request) {
 		defer rows.Close()
 		for rows.Next() {
 			var c Colony
-			var bJson string
-			err := rows.Scan(&c.ID, &c.Name, &c.SystemID, &c.ParentID, &c.PopLaborers, &c.PopSpecialists, &c.PopElites, &c.Food, &c.Water, &c.Iron, &c.Carbon, &c.Gold, &c.Steel, &c.Wine, &bJson, &c.StabilityCurrent)
+			var bJson, sJson string
+			var sx, sy, sz int
+			var msJson, mqJson, wfJson string
+			var autoJson string
+			err := rows.Scan(&c.ID, &c.OwnerUUID, &c.Name, &c.SystemID, &c.ParentID, &c.PopLaborers, &c.PopSpecialists, &c.PopElites, &c.Food, &c.Water, &c.Iron, &c.Carbon, &c.Gold, &c.Steel, &c.Wine, &bJson, &c.StabilityCurrent, &c.StabilityTarget, &sJson, &c.Culture,
+				&c.Vegetation, &c.Oxygen, &c.Terraform, &c.AirlessTicks, &sx, &sy, &sz, &msJson, &mqJson,
+				&c.Uranium, &c.Plutonium, &wfJson, &autoJson, &c.SiteType)
 			if err != nil {
 				if DebugLog != nil {
 					DebugLog.Printf("❌ DB Scan Error (Colony ID %d): %v", c.ID, err)
@@ -938,11 +1357,27 @@ func handleState(w http.ResponseWriter, r *http.Request) {
 				continue
 			}
 			json.Unmarshal([]byte(bJson), &c.Buildings)
+			c.StabilityFactors = &StabilityBreakdown{Labor: 1.0, Specialists: 1.0, Elites: 1.0, Shortages: []string{}}
+			json.Unmarshal([]byte(sJson), c.StabilityFactors)
+			c.Habitability = effectiveHabitability(baseHabitability(sx, sy, sz), c.Terraform)
+			c.ModuleStock = make(map[string]int)
+			c.ModuleQueue = []ModuleOrder{}
+			json.Unmarshal([]byte(msJson), &c.ModuleStock)
+			json.Unmarshal([]byte(mqJson), &c.ModuleQueue)
+			c.Workforce = parseWorkforce(wfJson)
+			c.Automation = parseAutomation(autoJson)
 			resp.Colonies = append(resp.Colonies, c)
 		}
+		rows.Close()
+
+		// Star lookups need the connection the colony rows held
+		for i := range resp.Colonies {
+			grid := colonyPower(&resp.Colonies[i], systemStarType(resp.Colonies[i].SystemID), false)
+			resp.Colonies[i].Power = &grid
+		}
 	}
-	
-	fRows, err := db.Query(`SELECT id, status, origin_system, dest_system, arrival_tick, fuel, hull_class, modules_json, payload_json, target_order_id FROM fleets WHERE owner_uuid=?`, userID)
+
+	fRows, err := db.Query(`SELECT id, status, origin_system, dest_system, arrival_tick, fuel, hull_class, modules_json, COALESCE(module_condition_json, ''), payload_json, target_order_id, COALESCE(home_system, ''), COALESCE(auto_return, 0), COALESCE(experience, 0), COALESCE(bombard_target, 'industry'), COALESCE(build_remaining, 0) FROM fleets WHERE owner_uuid=?`, userID)
 	if err != nil {
 		if DebugLog != nil {
 			DebugLog.Printf("❌ DB Query Error (Fleets): %v", err)
@@ -951,31 +1386,40 @@ func handleState(w http.ResponseWriter, r *http.Request) {
 		defer fRows.Close()
 		for fRows.Next() {
 			var f Fleet
-			var modJson, plJson string
-            var tOrder sql.NullString
-			fRows.Scan(&f.ID, &f.Status, &f.OriginSystem, &f.DestSystem, &f.ArrivalTick, &f.Fuel, &f.HullClass, &modJson, &plJson, &tOrder)
+			var modJson, condJson, plJson string
+			var tOrder sql.NullString
+			fRows.Scan(&f.ID, &f.Status, &f.OriginSystem, &f.DestSystem, &f.ArrivalTick, &f.Fuel, &f.HullClass, &modJson, &condJson, &plJson, &tOrder, &f.HomeSystem, &f.AutoReturn, &f.Experience, &f.BombardTarget, &f.BuildRemaining)
+			f.Veterancy = veterancy(f.Experience)
 			json.Unmarshal([]byte(modJson), &f.Modules)
+			f.Condition = parseCondition(condJson)
 			if plJson != "" {
 				json.Unmarshal([]byte(plJson), &f.Payload)
 			}
-            if tOrder.Valid { f.TargetOrderID = tOrder.String }
+			if tOrder.Valid {
+				f.TargetOrderID = tOrder.String
+			}
 			resp.Fleets = append(resp.Fleets, f)
 		}
 	}
-	
+
 	db.QueryRow("SELECT credits FROM users WHERE global_uuid=?", userID).Scan(&resp.Credits)
+	resp.Culture = empireCulture(userID)
+	resp.Refugees = refugeeFlows(userID)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
 
 func handleCargoTransfer(w http.ResponseWriter, r *http.Request) {
-    var req struct {
-        FleetID   int            `json:"fleet_id"`
-        ColonyID  int            `json:"colony_id"`
-        Transfers map[string]int `json:"transfers"` 
-    }
-    json.NewDecoder(r.Body).Decode(&req)
+	db := db.WithContext(r.Context())
+	var req struct {
+		FleetID   int            `json:"fleet_id" validate:"required"`
+		ColonyID  int            `json:"colony_id" validate:"required"`
+		Transfers map[string]int `json:"transfers" validate:"required"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
 
 	userID, err := authenticate(r)
 	if err != nil {
@@ -983,114 +1427,136 @@ func handleCargoTransfer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-    stateLock.Lock()
-    defer stateLock.Unlock()
+	defer lockRows(userRow(userID), colonyOwnerRow(req.ColonyID))()
+
+	var f Fleet
+	var fPayloadJson string
+	errF := db.QueryRow("SELECT owner_uuid, origin_system, status, payload_json FROM fleets WHERE id=?", req.FleetID).Scan(&f.OwnerUUID, &f.OriginSystem, &f.Status, &fPayloadJson)
 
-    var f Fleet
-    var fPayloadJson string
-    errF := db.QueryRow("SELECT owner_uuid, origin_system, status, payload_json FROM fleets WHERE id=?", req.FleetID).Scan(&f.OwnerUUID, &f.OriginSystem, &f.Status, &fPayloadJson)
-    
-    var c Colony
-    errC := db.QueryRow("SELECT owner_uuid, system_id, food, iron, steel, wine, pop_laborers FROM colonies WHERE id=?", req.ColonyID).Scan(&c.OwnerUUID, &c.SystemID, &c.Food, &c.Iron, &c.Steel, &c.Wine, &c.PopLaborers)
+	var c Colony
+	errC := db.QueryRow("SELECT owner_uuid, system_id, food, iron, steel, wine, pop_laborers FROM colonies WHERE id=?", req.ColonyID).Scan(&c.OwnerUUID, &c.SystemID, &c.Food, &c.Iron, &c.Steel, &c.Wine, &c.PopLaborers)
 
-    if errF != nil || errC != nil {
-        http.Error(w, "Invalid Fleet or Colony ID", 404)
-        return
-    }
+	if errF != nil || errC != nil {
+		http.Error(w, "Invalid Fleet or Colony ID", 404)
+		return
+	}
 
-	if f.OwnerUUID != userID || c.OwnerUUID != userID {
+	// Governors ferry cargo with their own fleets
+	if f.OwnerUUID != userID || !canManageColony(userID, req.ColonyID, c.OwnerUUID) {
 		http.Error(w, "Access Denied", 403)
 		return
 	}
 
-    if f.OwnerUUID != c.OwnerUUID || f.Status != "ORBIT" || f.OriginSystem != c.SystemID {
-        http.Error(w, "Transfer Rejected: Invalid Location or Ownership", 403)
-        return
-    }
-
-    if fPayloadJson != "" {
-        json.Unmarshal([]byte(fPayloadJson), &f.Payload)
-    }
-    if f.Payload.Resources == nil {
-        f.Payload.Resources = make(map[string]int)
-    }
-
-    for item, amount := range req.Transfers {
-        if amount == 0 { continue }
-        
-        colonyVal := 0
-        switch item {
-        case "food": colonyVal = c.Food
-        case "iron": colonyVal = c.Iron
-        case "steel": colonyVal = c.Steel
-        case "wine": colonyVal = c.Wine
-        // Fix B: Ferrying People
-        case "laborers": colonyVal = c.PopLaborers
-        default: continue
-        }
-
-        fleetVal := 0
-        if item == "laborers" {
-            fleetVal = f.Payload.PopLaborers
-        } else {
-            fleetVal = f.Payload.Resources[item]
-        }
-
-        if amount > 0 { // Colony -> Fleet
-            if colonyVal < amount {
-                http.Error(w, fmt.Sprintf("Insufficient %s in Colony", item), 400)
-                return 
-            }
-        } else { // Fleet -> Colony
-            qtyToUnload := -amount
-            if fleetVal < qtyToUnload {
-                http.Error(w, fmt.Sprintf("Insufficient %s in Fleet", item), 400)
-                return
-            }
-        }
-    }
-
-    tx, _ := db.Begin()
-    
-    for item, amount := range req.Transfers {
-        if item == "laborers" {
-            f.Payload.PopLaborers += amount
-            if f.Payload.PopLaborers < 0 { tx.Rollback(); http.Error(w, "Population Overflow", 500); return }
-            
-            if _, err := tx.Exec("UPDATE colonies SET pop_laborers = pop_laborers - ? WHERE id=?", amount, req.ColonyID); err != nil {
-                tx.Rollback(); http.Error(w, "Database Error during pop transfer", 500); return
-            }
-        } else {
-            f.Payload.Resources[item] += amount
-            
-            if f.Payload.Resources[item] < 0 {
-                tx.Rollback()
-                http.Error(w, "Cargo Overflow", 500)
-                return
-            }
-
-            query := fmt.Sprintf("UPDATE colonies SET %s = %s - ? WHERE id=?", item, item)
-            if _, err := tx.Exec(query, amount, req.ColonyID); err != nil {
-                tx.Rollback()
-                http.Error(w, "Database Error during transfer", 500)
-                return
-            }
-        }
-    }
-
-    newPayloadJson, _ := json.Marshal(f.Payload)
-    tx.Exec("UPDATE fleets SET payload_json = ? WHERE id=?", string(newPayloadJson), req.FleetID)
-    
-    tx.Commit()
-    w.Write([]byte("Cargo Transfer Complete"))
+	if f.Status != "ORBIT" || f.OriginSystem != c.SystemID {
+		http.Error(w, "Transfer Rejected: Invalid Location or Ownership", 403)
+		return
+	}
+	if err := checkEmbargo(c.OwnerUUID, req.ColonyID, f.OwnerUUID, c.SystemID); err != nil {
+		http.Error(w, "Transfer Rejected: "+err.Error(), 403)
+		return
+	}
+
+	if fPayloadJson != "" {
+		json.Unmarshal([]byte(fPayloadJson), &f.Payload)
+	}
+	if f.Payload.Resources == nil {
+		f.Payload.Resources = make(map[string]int)
+	}
+
+	for item, amount := range req.Transfers {
+		if amount == 0 {
+			continue
+		}
+
+		colonyVal := 0
+		switch item {
+		case "food":
+			colonyVal = c.Food
+		case "iron":
+			colonyVal = c.Iron
+		case "steel":
+			colonyVal = c.Steel
+		case "wine":
+			colonyVal = c.Wine
+		// Fix B: Ferrying People
+		case "laborers":
+			colonyVal = c.PopLaborers
+		default:
+			continue
+		}
+
+		fleetVal := 0
+		if item == "laborers" {
+			fleetVal = f.Payload.PopLaborers
+		} else {
+			fleetVal = f.Payload.Resources[item]
+		}
+
+		if amount > 0 { // Colony -> Fleet
+			if colonyVal < amount {
+				http.Error(w, fmt.Sprintf("Insufficient %s in Colony", item), 400)
+				return
+			}
+		} else { // Fleet -> Colony
+			qtyToUnload := -amount
+			if fleetVal < qtyToUnload {
+				http.Error(w, fmt.Sprintf("Insufficient %s in Fleet", item), 400)
+				return
+			}
+		}
+	}
+
+	tx, _ := db.Begin()
+
+	for item, amount := range req.Transfers {
+		if item == "laborers" {
+			f.Payload.PopLaborers += amount
+			if f.Payload.PopLaborers < 0 {
+				tx.Rollback()
+				http.Error(w, "Population Overflow", 500)
+				return
+			}
+
+			if _, err := tx.Exec("UPDATE colonies SET pop_laborers = pop_laborers - ? WHERE id=?", amount, req.ColonyID); err != nil {
+				tx.Rollback()
+				http.Error(w, "Database Error during pop transfer", 500)
+				return
+			}
+		} else {
+			f.Payload.Resources[item] += amount
+
+			if f.Payload.Resources[item] < 0 {
+				tx.Rollback()
+				http.Error(w, "Cargo Overflow", 500)
+				return
+			}
+
+			query := fmt.Sprintf("UPDATE colonies SET %s = %s - ? WHERE id=?", item, item)
+			if _, err := tx.Exec(query, amount, req.ColonyID); err != nil {
+				tx.Rollback()
+				http.Error(w, "Database Error during transfer", 500)
+				return
+			}
+		}
+	}
+
+	newPayloadJson, _ := json.Marshal(f.Payload)
+	tx.Exec("UPDATE fleets SET payload_json = ? WHERE id=?", string(newPayloadJson), req.FleetID)
+
+	tx.Commit()
+	w.Write([]byte("Cargo Transfer Complete"))
 }
 
 func handleSetPolicy(w http.ResponseWriter, r *http.Request) {
-    var req struct {
-        ColonyID int             `json:"colony_id"`
-        Policies map[string]bool `json:"policies"`
-    }
-    json.NewDecoder(r.Body).Decode(&req)
+	db := db.WithContext(r.Context())
+	var req struct {
+		ColonyID   int               `json:"colony_id" validate:"required"`
+		Policies   map[string]bool   `json:"policies"`
+		Automation *ColonyAutomation `json:"automation"` // optional, see automation.go
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
 
 	userID, err := authenticate(r)
 	if err != nil {
@@ -1098,126 +1564,330 @@ func handleSetPolicy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-    stateLock.Lock()
-    defer stateLock.Unlock()
+	defer lockRows(userRow(userID))()
 
-    var owner string
-    err = db.QueryRow("SELECT owner_uuid FROM colonies WHERE id=?", req.ColonyID).Scan(&owner)
-    if err != nil { 
-        http.Error(w, "Colony Not Found", 404)
-        return
-    }
+	var owner string
+	err = db.QueryRow("SELECT owner_uuid FROM colonies WHERE id=?", req.ColonyID).Scan(&owner)
+	if err != nil {
+		http.Error(w, "Colony Not Found", 404)
+		return
+	}
 
 	if owner != userID {
 		http.Error(w, "Access Denied", 403)
 		return
 	}
 
-    policyJson, _ := json.Marshal(req.Policies)
-    _, err = db.Exec("UPDATE colonies SET policies_json=? WHERE id=?", string(policyJson), req.ColonyID)
-    
-    if err != nil {
-        http.Error(w, "Failed to set policies", 500)
-        return
-    }
-    w.Write([]byte("Policies Updated"))
+	active := 0
+	for _, on := range req.Policies {
+		if on {
+			active++
+		}
+	}
+	if slots := empireCulture(userID).PolicySlots; active > slots {
+		http.Error(w, fmt.Sprintf("Too many policies. Your culture allows %d", slots), 400)
+		return
+	}
+	if req.Automation != nil {
+		if err := req.Automation.validate(); err != nil {
+			http.Error(w, "Invalid Automation: "+err.Error(), 400)
+			return
+		}
+	}
+
+	// A request with only automation leaves the policies as they are
+	if req.Policies != nil || req.Automation == nil {
+		policyJson, _ := json.Marshal(req.Policies)
+		if _, err = db.Exec("UPDATE colonies SET policies_json=? WHERE id=?", string(policyJson), req.ColonyID); err != nil {
+			http.Error(w, "Failed to set policies", 500)
+			return
+		}
+	}
+	if req.Automation != nil {
+		autoJson, _ := json.Marshal(req.Automation)
+		if _, err = db.Exec("UPDATE colonies SET automation_json=? WHERE id=?", string(autoJson), req.ColonyID); err != nil {
+			http.Error(w, "Failed to set automation", 500)
+			return
+		}
+	}
+	w.Write([]byte("Policies Updated"))
+}
+
+// --- Grievances & Reparations ---
+
+func handleListGrievances(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	type GrievanceItem struct {
+		ID       int    `json:"id"`
+		Offender string `json:"offender"`
+		Victim   string `json:"victim"`
+		Damage   int    `json:"damage"`
+		Tick     int64  `json:"tick"`
+		Owed     int    `json:"owed"`
+		Paid     int    `json:"paid"`
+	}
+
+	rows, err := db.Query(`SELECT id, offender_uuid, victim_uuid, damage_amount, tick, COALESCE(reparations_paid, 0)
+	                       FROM grievances WHERE offender_uuid=? OR victim_uuid=? ORDER BY id DESC`, userID, userID)
+	if err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+	defer rows.Close()
+
+	list := []GrievanceItem{}
+	for rows.Next() {
+		var g GrievanceItem
+		rows.Scan(&g.ID, &g.Offender, &g.Victim, &g.Damage, &g.Tick, &g.Paid)
+		g.Owed = g.Damage * ReparationCreditsPerDamage
+		list = append(list, g)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// Offender pays credits to the victim, a player on this node. Full payment clears the grievance.
+// Both parties live here, so no other node holds it against us and there is nothing to broadcast;
+// receipts for grievances reported between nodes are handled by processReparation.
+func handleSettleGrievance(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	var req struct {
+		GrievanceID int `json:"grievance_id" validate:"required"`
+		Amount      int `json:"amount" validate:"required"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	if req.Amount <= 0 {
+		http.Error(w, "Invalid Amount", 400)
+		return
+	}
+
+	defer lockRows(userRow(userID))()
+
+	var offender, victim string
+	var damage, paid int
+	err = db.QueryRow("SELECT offender_uuid, victim_uuid, damage_amount, COALESCE(reparations_paid, 0) FROM grievances WHERE id=?", req.GrievanceID).Scan(&offender, &victim, &damage, &paid)
+	if err != nil {
+		http.Error(w, "Grievance Not Found", 404)
+		return
+	}
+	if offender != userID {
+		http.Error(w, "Access Denied", 403)
+		return
+	}
+
+	owed := damage * ReparationCreditsPerDamage
+	if owed-paid <= 0 {
+		http.Error(w, "Grievance Already Settled", 409)
+		return
+	}
+	amount := req.Amount
+	if amount > owed-paid {
+		amount = owed - paid
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec("UPDATE users SET credits = credits - ? WHERE global_uuid=? AND credits >= ?", amount, userID, amount)
+	if err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Insufficient Credits", 402)
+		return
+	}
+	res, err = tx.Exec("UPDATE users SET credits = credits + ? WHERE global_uuid=? AND is_local=1", amount, victim)
+	if err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Victim is not a player on this node", 409)
+		return
+	}
+
+	settled := paid+amount >= owed
+	if settled {
+		_, err = tx.Exec("DELETE FROM grievances WHERE id=?", req.GrievanceID)
+	} else {
+		_, err = tx.Exec("UPDATE grievances SET reparations_paid = reparations_paid + ? WHERE id=?", amount, req.GrievanceID)
+	}
+	if err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+	record, _ := json.Marshal(map[string]interface{}{"grievance_id": req.GrievanceID, "offender": offender, "victim": victim, "amount": amount, "owed": owed})
+	tx.Exec("INSERT INTO transaction_log (tick, action_type, payload_blob) VALUES (?, 'REPARATION', ?)", atomic.LoadInt64(&CurrentTick), record)
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"paid":      paid + amount,
+		"remaining": owed - paid - amount,
+		"settled":   settled,
+	})
 }
 
 // --- Market API ---
 
 func handlePlaceOrder(w http.ResponseWriter, r *http.Request) {
-    var req MarketOrder
-    json.NewDecoder(r.Body).Decode(&req)
-    
-    userID, err := authenticate(r)
+	db := db.WithContext(r.Context())
+	var req MarketOrder
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	userID, err := authenticate(r)
 	if err != nil {
 		http.Error(w, "Unauthorized", 401)
 		return
 	}
-    
-    req.SellerUUID = userID
-    req.ID = fmt.Sprintf("ord-%s-%d", userID[:8], time.Now().UnixNano())
-    req.ExpiresTick = atomic.LoadInt64(&CurrentTick) + 1440 // 1 Day (approx)
-    
-    // Validate assets (if Sell Order)
-    if !req.IsBuy {
-        // Logic to check colony inventory? 
-        // For MVP, we don't lock assets, we check on swap (Trustless/Optimistic UI)
-        // But we should at least check they own the system they claim
-    }
-    
-    tx, _ := db.Begin()
-    _, err = tx.Exec("INSERT INTO market_orders (order_id, seller_uuid, item, quantity, price, is_buy, origin_system, expires_tick) VALUES (?,?,?,?,?,?,?,?)",
-        req.ID, req.SellerUUID, req.Item, req.Quantity, req.Price, req.IsBuy, req.OriginSystem, req.ExpiresTick)
-    
-    if err != nil {
-        tx.Rollback()
-        http.Error(w, "Failed to place order", 500)
-        return
-    }
-    tx.Commit()
-    w.Write([]byte("Order Placed: " + req.ID))
+
+	if req.Quantity <= 0 || req.Price <= 0 {
+		http.Error(w, "Invalid Quantity or Price", 400)
+		return
+	}
+
+	req.SellerUUID = userID
+	req.ID = fmt.Sprintf("ord-%s-%d", userID[:8], time.Now().UnixNano())
+	now := atomic.LoadInt64(&CurrentTick)
+	req.ExpiresTick = now + OrderLifetimeTicks
+
+	defer lockRows(userRow(userID), marketRow(req.OriginSystem))()
+
+	// Orders are listed through a trading post the seller owns in the origin system
+	var bJson string
+	if err := db.QueryRow("SELECT buildings_json FROM colonies WHERE system_id=? AND owner_uuid=? AND COALESCE(site_type, 'planet')='planet'", req.OriginSystem, userID).Scan(&bJson); err != nil {
+		http.Error(w, "No Colony in Origin System", 403)
+		return
+	}
+	buildings := make(map[string]int)
+	json.Unmarshal([]byte(bJson), &buildings)
+	level := buildings["trading_post"]
+	if level < 1 {
+		http.Error(w, "Trading Post Required", 400)
+		return
+	}
+
+	var active int
+	db.QueryRow("SELECT count(*) FROM market_orders WHERE origin_system=? AND expires_tick > ?", req.OriginSystem, now).Scan(&active)
+	if active >= orderLimit(level) {
+		http.Error(w, fmt.Sprintf("Order Limit Reached (%d for trading post level %d)", orderLimit(level), level), 429)
+		return
+	}
+
+	fee := listingFee(level, req.Quantity*req.Price)
+
+	tx, _ := db.Begin()
+	res, err := tx.Exec("UPDATE users SET credits = credits - ? WHERE global_uuid=? AND credits >= ?", fee, userID, fee)
+	if err != nil {
+		tx.Rollback()
+		http.Error(w, "DB Error", 500)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		http.Error(w, fmt.Sprintf("Insufficient Credits for Listing Fee (%d)", fee), 402)
+		return
+	}
+	_, err = tx.Exec("INSERT INTO market_orders (order_id, seller_uuid, item, quantity, price, is_buy, origin_system, expires_tick) VALUES (?,?,?,?,?,?,?,?)",
+		req.ID, req.SellerUUID, req.Item, req.Quantity, req.Price, req.IsBuy, req.OriginSystem, req.ExpiresTick)
+
+	if err != nil {
+		tx.Rollback()
+		http.Error(w, "Failed to place order", 500)
+		return
+	}
+	tx.Commit()
+	w.Write([]byte(fmt.Sprintf("Order Placed: %s (fee %d)", req.ID, fee)))
 }
 
 func handleListOrders(w http.ResponseWriter, r *http.Request) {
-    rows, err := db.Query("SELECT order_id, seller_uuid, item, quantity, price, is_buy, origin_system, expires_tick FROM market_orders ORDER BY expires_tick DESC LIMIT 50")
-    if err != nil {
-        http.Error(w, "DB Error", 500)
-        return
-    }
-    defer rows.Close()
-    
-    var orders []MarketOrder
-    for rows.Next() {
-        var o MarketOrder
-        rows.Scan(&o.ID, &o.SellerUUID, &o.Item, &o.Quantity, &o.Price, &o.IsBuy, &o.OriginSystem, &o.ExpiresTick)
-        orders = append(orders, o)
-    }
-    
-    json.NewEncoder(w).Encode(orders)
+	db := db.WithContext(r.Context())
+	rows, err := db.Query("SELECT order_id, seller_uuid, item, quantity, price, is_buy, origin_system, expires_tick FROM market_orders ORDER BY expires_tick DESC LIMIT 50")
+	if err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+	defer rows.Close()
+
+	var orders []MarketOrder
+	for rows.Next() {
+		var o MarketOrder
+		rows.Scan(&o.ID, &o.SellerUUID, &o.Item, &o.Quantity, &o.Price, &o.IsBuy, &o.OriginSystem, &o.ExpiresTick)
+		orders = append(orders, o)
+	}
+
+	json.NewEncoder(w).Encode(orders)
 }
 
 // Feature 4: Alliance API (Update Peer Relation)
 func handleAlly(w http.ResponseWriter, r *http.Request) {
-    var req struct {
-        TargetUUID string `json:"target_uuid"`
-    }
-    json.NewDecoder(r.Body).Decode(&req)
-    
-    _, err := authenticate(r)
+	var req struct {
+		TargetUUID string `json:"target_uuid" validate:"required"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	_, err := authenticate(r)
 	if err != nil {
 		http.Error(w, "Unauthorized", 401)
 		return
 	}
-    
-    peerLock.Lock()
-    defer peerLock.Unlock()
-    
-    peer, exists := Peers[req.TargetUUID]
-    if !exists {
-        http.Error(w, "Peer Unknown", 404)
-        return
-    }
-    
-    // Promote to Federated (Ally)
-    // In a real implementation, this should be a handshake, but for MVP it's unilateral.
-    peer.Relation = 1
-    
-    w.Write([]byte("Alliance Formed (Federated Status Granted)"))
+
+	peerLock.Lock()
+	defer peerLock.Unlock()
+
+	peer, exists := Peers[req.TargetUUID]
+	if !exists {
+		http.Error(w, "Peer Unknown", 404)
+		return
+	}
+
+	// Promote to Federated (Ally)
+	// In a real implementation, this should be a handshake, but for MVP it's unilateral.
+	peer.Relation = 1
+	savePeer(peer)
+
+	w.Write([]byte("Alliance Formed (Federated Status Granted)"))
 }
 
 // Helper: List Peers for UI
 func handleListPeers(w http.ResponseWriter, r *http.Request) {
-    // No auth strict check needed for simple list, but good practice
-    
-    peerLock.RLock()
-    defer peerLock.RUnlock()
-    
-    // Convert map to slice
-    list := make([]Peer, 0, len(Peers))
-    for _, p := range Peers {
-        list = append(list, *p)
-    }
-    
-    json.NewEncoder(w).Encode(list)
+	// No auth strict check needed for simple list, but good practice
+
+	peerLock.RLock()
+	defer peerLock.RUnlock()
+
+	// Convert map to slice
+	list := make([]Peer, 0, len(Peers))
+	for _, p := range Peers {
+		list = append(list, *p)
+	}
+
+	json.NewEncoder(w).Encode(list)
 }
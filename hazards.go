@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// --- Stellar Hazards ---
+// Star types matter. A fleet arriving at a black hole without a gravity_dampener is either
+// torn apart or caught in time dilation, stuck (status DILATED) for BlackHoleDilationTicks
+// before it settles into orbit; whatever it came to trade is left undone. O-type stars scorch fleets without a heat_shield: a share of the crew
+// and of organic cargo is lost. Either wears the fleet's modules (see damage.go). M-dwarfs are
+// dim, so farms and greenhouses there yield less.
+// Hazard plating fits any hull and takes no slot, like the probe scanner.
+
+const (
+	StarBlackHole = "BlackHole"
+	StarOType     = "O-Type"
+	StarMDwarf    = "M-Dwarf"
+
+	BlackHoleLossChance    = 0.5
+	BlackHoleDilationTicks = 50
+	OTypeBurn              = 0.25 // share of crew and organic cargo lost
+	MDwarfSolar            = 0.6  // farm and greenhouse output around a red dwarf
+
+	FleetDilated = "DILATED"
+)
+
+var organicCargo = []string{"food", "water", "vegetation", "wine"}
+
+func hasModule(modules []string, want string) bool {
+	for _, m := range modules {
+		if m == want {
+			return true
+		}
+	}
+	return false
+}
+
+// Star type of a charted system, falling back to the procedural one
+func systemStarType(sysID string) string {
+	s, _ := lookupSystem(sysID)
+	star := s.Type
+	if star == "" {
+		var x, y, z int
+		if n, _ := fmt.Sscanf(sysID, "sys-%d-%d-%d", &x, &y, &z); n == 3 {
+			star = GetSectorData(x, y, z).SystemType
+		}
+	}
+	return star
+}
+
+// Multiplier on sunlight-driven production (farms, greenhouses)
+func solarFactor(star string) float64 {
+	if star == StarMDwarf {
+		return MDwarfSolar
+	}
+	return 1.0
+}
+
+type hazardOutcome struct {
+	Destroyed bool
+	Dilated   bool
+	Burned    bool
+}
+
+// Applies the destination star's hazard to an arriving fleet; payload changes are made on f
+// and left for the caller to persist along with the rest of the arrival.
+func stellarHazard(f *Fleet, star string, tick int64) hazardOutcome {
+	var out hazardOutcome
+	switch star {
+	case StarBlackHole:
+		if hasModule(f.Modules, "gravity_dampener") {
+			return out
+		}
+		rng := battleRNG(fmt.Sprintf("%s:hazard:%d", f.DestSystem, f.ID), tick)
+		if rng.Float64() < BlackHoleLossChance {
+			out.Destroyed = true
+		} else {
+			out.Dilated = true
+		}
+	case StarOType:
+		if hasModule(f.Modules, "heat_shield") {
+			return out
+		}
+		out.Burned = true
+		f.Payload.PopLaborers -= int(float64(f.Payload.PopLaborers) * OTypeBurn)
+		f.Payload.PopSpecialists -= int(float64(f.Payload.PopSpecialists) * OTypeBurn)
+		for _, item := range organicCargo {
+			if n := f.Payload.Resources[item]; n > 0 {
+				f.Payload.Resources[item] = n - int(float64(n)*OTypeBurn)
+			}
+		}
+	}
+	return out
+}
+
+func destroyFleet(f Fleet, cause string) {
+	db.Exec("DELETE FROM fleets WHERE id=?", f.ID)
+	emitEvent(f.OwnerUUID, EventFleetLost, map[string]interface{}{"fleet_id": f.ID, "system_id": f.DestSystem, "cause": cause})
+	InfoLog.Printf("🕳️ Fleet %d lost at %s (%s)", f.ID, f.DestSystem, strings.ToLower(cause))
+}
+
+// Runs at the top of an arrival; false when the fleet was lost or dilated and the arrival ends here
+func applyStellarHazards(f *Fleet) bool {
+	star := systemStarType(f.DestSystem)
+	current := atomic.LoadInt64(&CurrentTick)
+	out := stellarHazard(f, star, current)
+	switch {
+	case out.Destroyed:
+		destroyFleet(*f, "Black hole")
+		return false
+	case out.Dilated:
+		db.Exec("UPDATE fleets SET status=?, origin_system=?, arrival_tick=? WHERE id=?",
+			FleetDilated, f.DestSystem, current+BlackHoleDilationTicks, f.ID)
+		wearModules(f.ID, DilationWear)
+		InfoLog.Printf("🕳️ Fleet %d caught in time dilation at %s", f.ID, f.DestSystem)
+		return false
+	case out.Burned:
+		pJson, _ := json.Marshal(f.Payload)
+		db.Exec("UPDATE fleets SET payload_json=? WHERE id=?", string(pJson), f.ID)
+		wearModules(f.ID, OTypeWear)
+		InfoLog.Printf("🔥 Fleet %d scorched by the O-type star at %s", f.ID, f.DestSystem)
+	}
+	return true
+}
+
+// Dilated fleets come back to normal time once their extra ticks have passed
+func releaseDilatedFleets(current int64) {
+	db.Exec("UPDATE fleets SET status='ORBIT' WHERE status=? AND arrival_tick <= ?", FleetDilated, current)
+}
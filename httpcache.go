@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Tick-Keyed Response Cache ---
+// /federation/map and /api/status only change when the tick (or leader) does, so the encoded
+// body is built once per key and served with ETag/Last-Modified and optional gzip. Pollers
+// that send If-None-Match get a 304 without the DB being touched.
+
+type cachedBody struct {
+	Key      string
+	Body     []byte
+	Gzipped  []byte
+	ETag     string
+	Modified time.Time
+}
+
+type tickCache struct {
+	mu    sync.Mutex
+	entry *cachedBody
+}
+
+// Returns the cached body for key, rebuilding it if the key moved on
+func (c *tickCache) get(key string, build func() []byte) *cachedBody {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entry != nil && c.entry.Key == key {
+		return c.entry
+	}
+
+	body := build()
+	etag := `"` + hashBLAKE3(body)[:16] + `"`
+	if c.entry != nil && c.entry.ETag == etag {
+		// Same content under a new key: keep the original modification time
+		c.entry.Key = key
+		return c.entry
+	}
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(body)
+	zw.Close()
+
+	c.entry = &cachedBody{Key: key, Body: body, Gzipped: gz.Bytes(), ETag: etag, Modified: time.Now().UTC().Truncate(time.Second)}
+	return c.entry
+}
+
+func serveCachedBody(w http.ResponseWriter, r *http.Request, cb *cachedBody) {
+	serveCachedBodyWith(w, r, cb, "no-cache") // revalidate every time; the 304 is cheap
+}
+
+func serveCachedBodyWith(w http.ResponseWriter, r *http.Request, cb *cachedBody, cacheControl string) {
+	h := w.Header()
+	h.Set("ETag", cb.ETag)
+	h.Set("Last-Modified", cb.Modified.Format(http.TimeFormat))
+	h.Set("Cache-Control", cacheControl)
+	h.Set("Vary", "Accept-Encoding")
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if inm == cb.ETag || inm == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	} else if ims, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !cb.Modified.After(ims) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	h.Set("Content-Type", "application/json")
+	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		h.Set("Content-Encoding", "gzip")
+		w.Write(cb.Gzipped)
+		return
+	}
+	w.Write(cb.Body)
+}
+
+var (
+	mapCache    tickCache
+	statusCache tickCache
+	graphCache  tickCache
+)
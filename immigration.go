@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// --- Immigration Queue ---
+// Pending handshakes live in the immigration_queue table so joiners survive restarts. The worker
+// takes the highest-priority due entry, checks the joiner is reachable, and admits it or retries
+// with exponential backoff.
+
+const (
+	ImmigrationUnknown      = 0 // genesis doesn't match ours; rejected when reached
+	ImmigrationKnownGenesis = 1
+	ImmigrationInvited      = 2 // carries an invite, or an operator approved it (processed even in strict mode)
+
+	// Handshake answers (HandshakeResponse.Status); only the first two mean the joiner may
+	// expect to become a peer without operator action
+	HandshakeAccepted      = "Accepted"
+	HandshakeQueued        = "Queued"
+	HandshakeStrictPending = "StrictModePendingApproval" // queued, but only an operator can admit it
+	HandshakeGenesis       = "GenesisMismatch"
+	HandshakeQueueFull     = "QueueFull"
+	HandshakeRejected      = "Rejected" // bad handshake or invite; see Reason
+
+	MaxImmigrationPending  = 500
+	MaxImmigrationAttempts = 5
+	ImmigrationBackoffBase = 5 * time.Second
+	ImmigrationPollEvery   = 2 * time.Second
+	ImmigrationRetention   = 24 * time.Hour
+)
+
+type ImmigrationEntry struct {
+	UUID        string `json:"uuid"`
+	Address     string `json:"address"`
+	Priority    int    `json:"priority"`
+	Status      string `json:"status"` // pending, admitted, rejected, failed
+	Attempts    int    `json:"attempts"`
+	NextAttempt int64  `json:"next_attempt"`
+	LastError   string `json:"last_error,omitempty"`
+	ReceivedAt  int64  `json:"received_at"`
+}
+
+func immigrationPriority(req HandshakeRequest) int {
+	if req.InviteToken != "" {
+		if _, err := parseInvite(req.InviteToken); err == nil {
+			return ImmigrationInvited
+		}
+	}
+	if req.GenesisHash == GenesisHash {
+		return ImmigrationKnownGenesis
+	}
+	return ImmigrationUnknown
+}
+
+// Persists a handshake. Returns false when the queue is full. A repeat handshake refreshes the entry.
+func enqueueImmigrant(req HandshakeRequest, priority int) bool {
+	var pending int
+	db.QueryRow("SELECT count(*) FROM immigration_queue WHERE status='pending'").Scan(&pending)
+	if pending >= MaxImmigrationPending {
+		return false
+	}
+
+	reqJson, _ := json.Marshal(req)
+	now := time.Now().Unix()
+	db.Exec(`INSERT INTO immigration_queue (uuid, request_json, priority, status, attempts, next_attempt, last_error, received_at)
+	         VALUES (?, ?, ?, 'pending', 0, ?, '', ?)
+	         ON CONFLICT(uuid) DO UPDATE SET request_json=excluded.request_json, priority=MAX(priority, excluded.priority),
+	         status='pending', attempts=0, next_attempt=excluded.next_attempt`,
+		req.UUID, string(reqJson), priority, now, now)
+	return true
+}
+
+func immigrationBackoff(attempts int) time.Duration {
+	return ImmigrationBackoffBase * time.Duration(1<<uint(attempts))
+}
+
+// Joiners must answer on the address they advertised before we start heartbeating them
+func probeImmigrant(req HandshakeRequest) error {
+	url := req.Address + "/api/status"
+	if !strings.HasPrefix(req.Address, "http") {
+		url = "http://" + url
+	}
+	client := &http.Client{Timeout: 3 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var status struct {
+		UUID string `json:"uuid"`
+	}
+	json.NewDecoder(resp.Body).Decode(&status)
+	if status.UUID != req.UUID {
+		return fmt.Errorf("address answered as %q", status.UUID)
+	}
+	return nil
+}
+
+func processImmigration() {
+	ticker := time.NewTicker(ImmigrationPollEvery)
+	defer ticker.Stop()
+	for range ticker.C {
+		processNextImmigrant()
+	}
+}
+
+func processNextImmigrant() {
+	now := time.Now()
+	db.Exec("DELETE FROM immigration_queue WHERE status != 'pending' AND received_at < ?", now.Add(-ImmigrationRetention).Unix())
+
+	// Strict mode only admits invited or operator-approved joiners
+	minPriority := ImmigrationUnknown
+	if Config.PeeringMode == "strict" {
+		minPriority = ImmigrationInvited
+	}
+
+	var reqJson string
+	var priority, attempts int
+	err := db.QueryRow(`SELECT request_json, priority, attempts FROM immigration_queue
+	                    WHERE status='pending' AND next_attempt <= ? AND priority >= ?
+	                    ORDER BY priority DESC, received_at ASC LIMIT 1`, now.Unix(), minPriority).Scan(&reqJson, &priority, &attempts)
+	if err != nil {
+		return
+	}
+	var req HandshakeRequest
+	json.Unmarshal([]byte(reqJson), &req)
+
+	finish := func(status, reason string) {
+		db.Exec("UPDATE immigration_queue SET status=?, last_error=? WHERE uuid=?", status, reason, req.UUID)
+	}
+
+	pubKey, err := vetImmigrant(req)
+	if err != nil {
+		finish("rejected", err.Error())
+		return
+	}
+	if req.InviteToken != "" {
+		if err := redeemInvite(req.InviteToken, req.UUID); err != nil && err != errInviteUnavailable {
+			finish("rejected", err.Error())
+			return
+		} else if err == errInviteUnavailable {
+			retryImmigrant(req.UUID, attempts, err)
+			return
+		}
+	}
+	if err := probeImmigrant(req); err != nil {
+		retryImmigrant(req.UUID, attempts, err)
+		return
+	}
+
+	admitPeer(req, pubKey)
+	finish("admitted", "")
+}
+
+func retryImmigrant(uuid string, attempts int, cause error) {
+	attempts++
+	if attempts >= MaxImmigrationAttempts {
+		db.Exec("UPDATE immigration_queue SET status='failed', attempts=?, last_error=? WHERE uuid=?", attempts, cause.Error(), uuid)
+		return
+	}
+	next := time.Now().Add(immigrationBackoff(attempts)).Unix()
+	db.Exec("UPDATE immigration_queue SET attempts=?, next_attempt=?, last_error=? WHERE uuid=?", attempts, next, cause.Error(), uuid)
+}
+
+// GET lists the queue. POST {"uuid", "action"}: approve (promote to invited tier), reject, retry.
+func handleAdminImmigration(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	if !authenticateAdmin(r) {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var req struct {
+			UUID   string `json:"uuid" validate:"required"`
+			Action string `json:"action" validate:"required"`
+		}
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+
+		var q string
+		switch req.Action {
+		case "approve":
+			q = "UPDATE immigration_queue SET priority=2, status='pending', next_attempt=0 WHERE uuid=?"
+		case "reject":
+			q = "UPDATE immigration_queue SET status='rejected', last_error='rejected by operator' WHERE uuid=?"
+		case "retry":
+			q = "UPDATE immigration_queue SET status='pending', attempts=0, next_attempt=0 WHERE uuid=?"
+		default:
+			http.Error(w, "Unknown Action", 400)
+			return
+		}
+		res, _ := db.Exec(q, req.UUID)
+		if n, _ := res.RowsAffected(); n == 0 {
+			http.Error(w, "Not Queued", 404)
+			return
+		}
+	}
+
+	rows, err := db.Query(`SELECT uuid, request_json, priority, status, attempts, next_attempt, COALESCE(last_error, ''), received_at
+	                       FROM immigration_queue ORDER BY status='pending' DESC, priority DESC, received_at ASC LIMIT 200`)
+	if err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+	defer rows.Close()
+
+	entries := []ImmigrationEntry{}
+	for rows.Next() {
+		var e ImmigrationEntry
+		var reqJson string
+		rows.Scan(&e.UUID, &reqJson, &e.Priority, &e.Status, &e.Attempts, &e.NextAttempt, &e.LastError, &e.ReceivedAt)
+		var hs HandshakeRequest
+		json.Unmarshal([]byte(reqJson), &hs)
+		e.Address = hs.Address
+		entries = append(entries, e)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
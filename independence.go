@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// --- Independence Movements ---
+// A colony that stays miserable far from its empire's capital eventually secedes. It becomes
+// a free faction (owner "NPC-FREE-<colony id>") that keeps producing under its own banner and
+// keeps its own stance towards every player. An operator can hand a free faction to a player.
+
+const (
+	FreeFactionPrefix     = "NPC-FREE-"
+	IndependenceStability = 15.0
+	IndependenceTicks     = 50
+	// Minimum distance from the capital; core worlds don't secede
+	IndependenceDistance = 20.0
+	// Stability a newly free colony starts over with
+	IndependenceFreshStart = 50.0
+	// Credits a player pays a hostile faction to return to neutral
+	PeaceTribute = 1000
+
+	StanceNeutral = "neutral"
+	StanceHostile = "hostile"
+)
+
+type FactionInfo struct {
+	UUID         string `json:"uuid"`
+	Name         string `json:"name"`
+	OriginColony int    `json:"origin_colony_id"`
+	FormerOwner  string `json:"former_owner"`
+	FoundedTick  int64  `json:"founded_tick"`
+	Playable     bool   `json:"playable"`
+	StanceToward string `json:"stance"` // towards the caller
+}
+
+func isFreeFaction(uuid string) bool {
+	return strings.HasPrefix(uuid, FreeFactionPrefix)
+}
+
+type capitalInfo struct {
+	ColonyID int
+	Pos      []int
+}
+
+// An empire's capital is the colony its owner designated (see capital.go), else its oldest
+func loadCapitals() map[string]capitalInfo {
+	caps := make(map[string]capitalInfo)
+	rows, err := db.Query(`SELECT c.owner_uuid, c.id, COALESCE(s.x, 0), COALESCE(s.y, 0), COALESCE(s.z, 0)
+	                       FROM colonies c LEFT JOIN solar_systems s ON s.id = c.system_id
+	                       WHERE c.id IN (SELECT COALESCE(
+	                           (SELECT u.capital_colony_id FROM users u JOIN colonies d ON d.id = u.capital_colony_id AND d.owner_uuid = u.global_uuid
+	                            WHERE u.global_uuid = o.owner_uuid), MIN(o.id))
+	                       FROM colonies o GROUP BY o.owner_uuid)`)
+	if err != nil {
+		return caps
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var owner string
+		var ci capitalInfo
+		var x, y, z int
+		rows.Scan(&owner, &ci.ColonyID, &x, &y, &z)
+		ci.Pos = []int{x, y, z}
+		caps[owner] = ci
+	}
+	return caps
+}
+
+// True while this colony is unhappy and remote enough to be building towards secession
+func independenceUnrest(c *Colony, pos []int, capital capitalInfo, hasCapital bool) bool {
+	if !hasCapital || isFreeFaction(c.OwnerUUID) || c.OwnerUUID == PirateOwnerUUID || c.ID == capital.ColonyID {
+		return false
+	}
+	return c.StabilityCurrent < IndependenceStability && distance3(pos, capital.Pos) >= IndependenceDistance
+}
+
+func declareIndependence(c Colony) {
+	faction := fmt.Sprintf("%s%d", FreeFactionPrefix, c.ID)
+	tick := atomic.LoadInt64(&CurrentTick)
+
+	tx, _ := db.Begin()
+	tx.Exec(`INSERT OR IGNORE INTO factions (uuid, name, origin_colony_id, former_owner, founded_tick)
+	         SELECT ?, 'Free ' || name, id, owner_uuid, ? FROM colonies WHERE id=?`, faction, tick, c.ID)
+	tx.Exec(`UPDATE colonies SET owner_uuid=?, stability_current=?, stability_target=?, martial_law=0,
+	         policies_json='{}', unrest_ticks=0, collapse_ticks=0 WHERE id=?`,
+		faction, IndependenceFreshStart, IndependenceFreshStart, c.ID)
+	tx.Exec("UPDATE solar_systems SET owner_uuid=? WHERE id=? AND owner_uuid=?", faction, c.SystemID, c.OwnerUUID)
+	tx.Exec("DELETE FROM colony_governors WHERE colony_id=?", c.ID)
+	tx.Commit()
+	reindexSystem(c.SystemID)
+
+	InfoLog.Printf("🗽 Colony %d declared independence from %s as %s", c.ID, c.OwnerUUID, faction)
+}
+
+func factionStance(faction, other string) string {
+	stance := StanceNeutral
+	db.QueryRow("SELECT stance FROM faction_relations WHERE faction_uuid=? AND other_uuid=?", faction, other).Scan(&stance)
+	return stance
+}
+
+func setFactionStance(faction, other, stance string) {
+	db.Exec("INSERT OR REPLACE INTO faction_relations (faction_uuid, other_uuid, stance) VALUES (?, ?, ?)", faction, other, stance)
+}
+
+// GET: every free faction and its stance towards you
+func handleListFactions(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	rows, err := db.Query(`SELECT f.uuid, f.name, f.origin_colony_id, f.former_owner, f.founded_tick, f.playable,
+	                       COALESCE(r.stance, 'neutral')
+	                       FROM factions f LEFT JOIN faction_relations r ON r.faction_uuid = f.uuid AND r.other_uuid = ?
+	                       ORDER BY f.founded_tick DESC`, userID)
+	if err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+	defer rows.Close()
+
+	list := []FactionInfo{}
+	for rows.Next() {
+		var f FactionInfo
+		rows.Scan(&f.UUID, &f.Name, &f.OriginColony, &f.FormerOwner, &f.FoundedTick, &f.Playable, &f.StanceToward)
+		list = append(list, f)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// POST: buy peace with a hostile free faction
+func handleFactionTribute(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	var req struct {
+		FactionUUID string `json:"faction_uuid" validate:"required"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+	if !isFreeFaction(req.FactionUUID) {
+		http.Error(w, "Unknown Faction", 404)
+		return
+	}
+
+	defer lockRows(userRow(userID), "faction:"+req.FactionUUID)()
+
+	if factionStance(req.FactionUUID, userID) != StanceHostile {
+		w.Write([]byte("Already at peace"))
+		return
+	}
+	res, _ := db.Exec("UPDATE users SET credits = credits - ? WHERE global_uuid=? AND credits >= ?", PeaceTribute, userID, PeaceTribute)
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, fmt.Sprintf("Tribute of %d credits required", PeaceTribute), 402)
+		return
+	}
+	setFactionStance(req.FactionUUID, userID, StanceNeutral)
+	w.Write([]byte("Tribute accepted. Relations restored to neutral."))
+}
+
+// POST: hand a free faction to a player as a new account
+func handleAdminClaimFaction(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	if !authenticateAdmin(r) {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	var req struct {
+		FactionUUID string `json:"faction_uuid" validate:"required"`
+		Username    string `json:"username" validate:"required"`
+		Password    string `json:"password" validate:"required"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if len(req.Username) < 3 || len(req.Username) > 20 || !usernameRegex.MatchString(req.Username) {
+		http.Error(w, "Invalid Username (Alphanumeric only, 3-20 chars)", 400)
+		return
+	}
+
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	var playable bool
+	if err := db.QueryRow("SELECT playable FROM factions WHERE uuid=?", req.FactionUUID).Scan(&playable); err != nil {
+		http.Error(w, "Unknown Faction", 404)
+		return
+	}
+	if playable {
+		http.Error(w, "Faction already claimed", 409)
+		return
+	}
+
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	_, err := db.Exec(`INSERT INTO users (global_uuid, username, password_hash, is_local, ed25519_pubkey, ed25519_priv_enc, session_token, created_at, expires_at)
+	                   VALUES (?, ?, ?, 1, ?, ?, ?, ?, ?)`,
+		req.FactionUUID, req.Username, hashBLAKE3([]byte(req.Password)), hex.EncodeToString(pub), encryptKey(priv, req.Password), generateSessionToken(), time.Now().Unix(),
+		time.Now().Add(SessionTTL).Unix())
+	if err != nil {
+		http.Error(w, "Taken", 400)
+		return
+	}
+	db.Exec("UPDATE factions SET playable=1 WHERE uuid=?", req.FactionUUID)
+
+	w.Write([]byte(fmt.Sprintf("Faction %s is now played by %s", req.FactionUUID, req.Username)))
+}
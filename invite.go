@@ -0,0 +1,152 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// --- Federation Invitations ---
+// In strict peering mode the immigration queue admits nobody. An operator can mint a
+// signed, expiring, single-use invite; a node presenting it in its handshake joins directly.
+
+const DefaultInviteTTL = 24 * time.Hour
+
+// Redemption hit a storage error; the invite itself may still be good
+var errInviteUnavailable = errors.New("invite store unavailable")
+
+type InviteClaims struct {
+	ID        string `json:"id"`
+	Issuer    string `json:"issuer"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// Token format: base64url(claims JSON) "." base64url(ed25519 signature over the claims)
+func mintInvite(ttl time.Duration) (string, InviteClaims, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", InviteClaims{}, err
+	}
+	claims := InviteClaims{
+		ID:        hex.EncodeToString(nonce),
+		Issuer:    ServerUUID,
+		ExpiresAt: time.Now().Add(ttl).Unix(),
+	}
+	body, _ := json.Marshal(claims)
+	sig := ed25519.Sign(PrivateKey, body)
+
+	if _, err := db.Exec("INSERT INTO federation_invites (id, expires_at) VALUES (?, ?)", claims.ID, claims.ExpiresAt); err != nil {
+		return "", InviteClaims{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(body) + "." + base64.RawURLEncoding.EncodeToString(sig)
+	return token, claims, nil
+}
+
+// Checks signature and expiry without consuming the invite
+func parseInvite(token string) (InviteClaims, error) {
+	var claims InviteClaims
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return claims, fmt.Errorf("malformed invite")
+	}
+	body, err1 := base64.RawURLEncoding.DecodeString(parts[0])
+	sig, err2 := base64.RawURLEncoding.DecodeString(parts[1])
+	if err1 != nil || err2 != nil {
+		return claims, fmt.Errorf("malformed invite")
+	}
+	if !ed25519.Verify(PublicKey, body, sig) {
+		return claims, fmt.Errorf("bad invite signature")
+	}
+	if err := json.Unmarshal(body, &claims); err != nil || claims.Issuer != ServerUUID {
+		return claims, fmt.Errorf("invite not issued by this node")
+	}
+	if time.Now().Unix() > claims.ExpiresAt {
+		return claims, fmt.Errorf("invite expired")
+	}
+	return claims, nil
+}
+
+// Marks the invite used by peerUUID. The conditional UPDATE makes redemption one-time even under concurrent handshakes.
+func redeemInvite(token, peerUUID string) error {
+	claims, err := parseInvite(token)
+	if err != nil {
+		return err
+	}
+	res, err := db.Exec("UPDATE federation_invites SET used_by=?, used_at=? WHERE id=? AND used_by IS NULL AND expires_at >= ?",
+		peerUUID, time.Now().Unix(), claims.ID, time.Now().Unix())
+	if err != nil {
+		return errInviteUnavailable
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return fmt.Errorf("invite already used or revoked")
+	}
+	return nil
+}
+
+// POST mints a new invite (optional ttl_hours), GET lists outstanding and used invites
+func handleAdminInvite(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	if !authenticateAdmin(r) {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		var req struct {
+			TTLHours int `json:"ttl_hours"`
+		}
+		if r.ContentLength != 0 && !decodeJSON(w, r, &req) {
+			return
+		}
+		ttl := DefaultInviteTTL
+		if req.TTLHours > 0 {
+			ttl = time.Duration(req.TTLHours) * time.Hour
+		}
+
+		token, claims, err := mintInvite(ttl)
+		if err != nil {
+			http.Error(w, "DB Error", 500)
+			return
+		}
+		InfoLog.Printf("🎟️ Invite %s minted, expires %s", claims.ID, time.Unix(claims.ExpiresAt, 0).Format(time.RFC3339))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"token": token, "id": claims.ID, "expires_at": claims.ExpiresAt,
+		})
+
+	case http.MethodGet:
+		rows, err := db.Query("SELECT id, expires_at, COALESCE(used_by, ''), COALESCE(used_at, 0) FROM federation_invites ORDER BY expires_at DESC LIMIT 100")
+		if err != nil {
+			http.Error(w, "DB Error", 500)
+			return
+		}
+		defer rows.Close()
+
+		type inviteRow struct {
+			ID        string `json:"id"`
+			ExpiresAt int64  `json:"expires_at"`
+			UsedBy    string `json:"used_by,omitempty"`
+			UsedAt    int64  `json:"used_at,omitempty"`
+		}
+		invites := []inviteRow{}
+		for rows.Next() {
+			var i inviteRow
+			rows.Scan(&i.ID, &i.ExpiresAt, &i.UsedBy, &i.UsedAt)
+			invites = append(invites, i)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(invites)
+
+	default:
+		http.Error(w, "Method Not Allowed", 405)
+	}
+}
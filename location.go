@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+
+	"lukechampine.com/blake3"
+)
+
+// --- Node Locations ---
+// A node's cluster location (ServerLoc, around which its players' homeworlds spawn) is derived
+// from its UUID and the federation genesis rather than copied from a seed with random jitter,
+// so it can be recomputed after data loss and checked by anyone:
+//
+//	candidate(salt) = BLAKE3("LOCATION|<genesis>|<uuid>|<salt>") mapped into the core region
+//
+// A node takes the first salt whose candidate doesn't collide (fall within NodeSpacing on any
+// axis, which would overlap the spawn areas) with a known node holding a stronger claim. Lower
+// salts beat higher ones and the lower UUID breaks ties, so both sides of a collision agree
+// which one moves on to its next salt. Nodes advertise their salt in handshakes and /api/status;
+// a handshake whose location doesn't match its salt is refused. Nodes placed before derivation
+// send no salt and keep their location, which always wins a collision.
+//
+// A node settles once it has colonies: from then on it never moves, and a late collision is
+// only logged.
+
+const (
+	SpawnReach      = 20             // homeworlds spawn within this many sectors of ServerLoc
+	NodeSpacing     = 2 * SpawnReach // closer than this on every axis and spawn areas overlap
+	NodeRegion      = 200            // half-width of the core region nodes are placed in
+	MaxLocationSalt = 256
+)
+
+// -1 while the node holds a location from before derivation
+var ServerLocSalt = -1
+
+type locationClaim struct {
+	UUID     string
+	Location []int
+	Salt     int // -1 = not derived
+}
+
+// Whether claim a keeps its place over b
+func (a locationClaim) beats(b locationClaim) bool {
+	if (a.Salt < 0) != (b.Salt < 0) {
+		return a.Salt < 0
+	}
+	if a.Salt != b.Salt {
+		return a.Salt < b.Salt
+	}
+	return a.UUID < b.UUID
+}
+
+func deriveLocation(uuid, genesis string, salt int) []int {
+	region := NodeRegion
+	if region > UniverseSize-SpawnReach {
+		region = UniverseSize - SpawnReach
+	}
+	if region < 0 {
+		region = 0
+	}
+	sum := blake3.Sum256([]byte(fmt.Sprintf("LOCATION|%s|%s|%d", genesis, uuid, salt)))
+	loc := make([]int, 3)
+	for i := range loc {
+		v := binary.BigEndian.Uint32(sum[4*i:])
+		loc[i] = int(v%uint32(2*region+1)) - region
+	}
+	return loc
+}
+
+func locationsCollide(a, b []int) bool {
+	if len(a) != 3 || len(b) != 3 {
+		return false
+	}
+	for i := range a {
+		d := a[i] - b[i]
+		if d >= NodeSpacing || d <= -NodeSpacing {
+			return false
+		}
+	}
+	return true
+}
+
+// First salt whose candidate no stronger claim collides with
+func resolveLocation(uuid, genesis string, others []locationClaim) ([]int, int) {
+	for salt := 0; salt < MaxLocationSalt; salt++ {
+		me := locationClaim{UUID: uuid, Location: deriveLocation(uuid, genesis, salt), Salt: salt}
+		free := true
+		for _, o := range others {
+			if o.UUID != uuid && locationsCollide(me.Location, o.Location) && o.beats(me) {
+				free = false
+				break
+			}
+		}
+		if free {
+			return me.Location, salt
+		}
+	}
+	ErrorLog.Printf("No free location for %s in %d salts; taking the first", uuid, MaxLocationSalt)
+	return deriveLocation(uuid, genesis, 0), 0
+}
+
+// Checks an advertised location against its salt; nil salt = a node placed before derivation
+func verifyLocation(uuid string, loc []int, salt *int) error {
+	if salt == nil {
+		return nil
+	}
+	if *salt < 0 || *salt >= MaxLocationSalt || !sameLocation(loc, deriveLocation(uuid, GenesisHash, *salt)) {
+		return fmt.Errorf("location %v does not derive from salt %d", loc, *salt)
+	}
+	return nil
+}
+
+func sameLocation(a, b []int) bool {
+	return len(a) == 3 && len(b) == 3 && a[0] == b[0] && a[1] == b[1] && a[2] == b[2]
+}
+
+// Our salt as advertised, nil for a legacy location
+func advertisedLocationSalt() *int {
+	if ServerLocSalt < 0 {
+		return nil
+	}
+	s := ServerLocSalt
+	return &s
+}
+
+// A peer's advertised salt as stored on its Peer
+func saltOrLegacy(salt *int) int {
+	if salt == nil {
+		return -1
+	}
+	return *salt
+}
+
+func knownLocationClaims() []locationClaim {
+	peerLock.RLock()
+	defer peerLock.RUnlock()
+	claims := make([]locationClaim, 0, len(Peers))
+	for _, p := range Peers {
+		if len(p.Location) == 3 {
+			claims = append(claims, locationClaim{UUID: p.UUID, Location: p.Location, Salt: p.LocationSalt})
+		}
+	}
+	return claims
+}
+
+func storedLocation() ([]int, int, bool) {
+	loc := make([]int, 3)
+	for i, key := range []string{"loc_x", "loc_y", "loc_z"} {
+		var v string
+		if db.QueryRow("SELECT value FROM system_meta WHERE key=?", key).Scan(&v) != nil {
+			return nil, -1, false
+		}
+		loc[i], _ = strconv.Atoi(v)
+	}
+	salt := -1
+	var v string
+	if db.QueryRow("SELECT value FROM system_meta WHERE key='loc_salt'").Scan(&v) == nil {
+		salt, _ = strconv.Atoi(v)
+	}
+	return loc, salt, true
+}
+
+func storeLocation(loc []int, salt int) {
+	for i, key := range []string{"loc_x", "loc_y", "loc_z"} {
+		db.Exec("INSERT OR REPLACE INTO system_meta (key, value) VALUES (?, ?)", key, fmt.Sprint(loc[i]))
+	}
+	db.Exec("INSERT OR REPLACE INTO system_meta (key, value) VALUES ('loc_salt', ?)", fmt.Sprint(salt))
+}
+
+func locationSettled() bool {
+	var n int
+	db.QueryRow("SELECT count(*) FROM colonies").Scan(&n)
+	return n > 0
+}
+
+// Places the node at boot, and again whenever it learns of other nodes (extra carries claims
+// not yet in the peer list, like a seed's). A settled node keeps its stored location, or the
+// origin that nodes without one used to spawn around.
+func settleLocation(extra ...locationClaim) {
+	others := append(knownLocationClaims(), extra...)
+	loc, salt, ok := storedLocation()
+	if !ok && locationSettled() {
+		loc, salt, ok = []int{0, 0, 0}, -1, true
+		storeLocation(loc, salt)
+	}
+	if ok && locationSettled() {
+		ServerLoc, ServerLocSalt = loc, salt
+		me := locationClaim{UUID: ServerUUID, Location: loc, Salt: salt}
+		for _, o := range others {
+			if o.UUID != ServerUUID && locationsCollide(loc, o.Location) && o.beats(me) {
+				ErrorLog.Printf("📍 Location %v overlaps node %s at %v; settled nodes don't move", loc, o.UUID, o.Location)
+			}
+		}
+		return
+	}
+
+	loc, salt = resolveLocation(ServerUUID, GenesisHash, others)
+	if salt == ServerLocSalt && sameLocation(loc, ServerLoc) {
+		return
+	}
+	ServerLoc, ServerLocSalt = loc, salt
+	storeLocation(loc, salt)
+	InfoLog.Printf("📍 Server Cluster Location Set: %v (salt %d)", loc, salt)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"sort"
+	"sync"
+)
+
+// --- Row Locks ---
+// stateLock is a read/write lock over the whole world. The tick and whole-world operations
+// (seeding, consistency repair, economy retuning, claiming a faction) hold it exclusively.
+// Player actions share it and serialize only on the rows they touch, so unrelated players'
+// actions run side by side between ticks instead of queueing behind one another. Credit
+// movements stay safe across players because they are single conditional UPDATEs.
+//
+// Keys name a row ("user:<uuid>", "contract:<id>", "conversion:<id>", "wreck:<id>") or a
+// shared resource ("market:<system>", "system:<system>" for settling its sites, "faction:<uuid>",
+// "names"); an empire's colonies and
+// fleets are covered by its owner's key. lockRows takes them in sorted order, so two actions
+// needing overlapping rows can't deadlock; never call it while already holding row locks.
+
+type rowLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+var (
+	rowLocks   = make(map[string]*rowLock)
+	rowLocksMu sync.Mutex
+)
+
+func userRow(uuid string) string    { return "user:" + uuid }
+func marketRow(sysID string) string { return "market:" + sysID }
+func systemRow(sysID string) string { return "system:" + sysID }
+
+// Colonies are locked through their owner, since governors act on colonies they don't own
+func colonyOwnerRow(colonyID int) string {
+	var owner string
+	db.QueryRow("SELECT owner_uuid FROM colonies WHERE id=?", colonyID).Scan(&owner)
+	return userRow(owner)
+}
+
+// Shares the world and locks the given rows; call the returned func to release them all
+func lockRows(keys ...string) (unlock func()) {
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+	uniq := sorted[:0]
+	for _, k := range sorted {
+		if len(uniq) == 0 || k != uniq[len(uniq)-1] {
+			uniq = append(uniq, k)
+		}
+	}
+
+	stateLock.RLock()
+	held := make([]*rowLock, 0, len(uniq))
+	for _, k := range uniq {
+		rowLocksMu.Lock()
+		l := rowLocks[k]
+		if l == nil {
+			l = &rowLock{}
+			rowLocks[k] = l
+		}
+		l.refs++
+		rowLocksMu.Unlock()
+
+		l.mu.Lock()
+		held = append(held, l)
+	}
+
+	return func() {
+		for i := len(held) - 1; i >= 0; i-- {
+			held[i].mu.Unlock()
+			rowLocksMu.Lock()
+			if held[i].refs--; held[i].refs == 0 {
+				delete(rowLocks, uniq[i])
+			}
+			rowLocksMu.Unlock()
+		}
+		stateLock.RUnlock()
+	}
+}
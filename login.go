@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// --- Login Throttling ---
+// Failed logins are counted per account. After LoginFreeAttempts each further attempt has to
+// wait an exponentially growing delay, and LoginLockoutAttempts failures lock the account for
+// LoginLockoutDuration. The owner is told about failures on their next login (and through an
+// account_locked webhook); operators can clear a lock via /admin/accounts/unlock.
+//
+// POST /api/login is the login on its own: unlike /api/register (which still logs into an
+// existing account, for older clients) it never creates one, stays open when an operator
+// closes registration, and says what went wrong with a code a client can act on:
+// {"error": {"status", "code", "message"}} with code user_not_found, wrong_password,
+// account_throttled (with Retry-After) or rate_limited. Besides the per-account throttle,
+// each address gets LoginIPBurst attempts, refilled one per LoginIPInterval, so one client
+// can't walk through many accounts.
+
+const (
+	LoginFreeAttempts    = 3
+	LoginBackoffBase     = 2 * time.Second
+	LoginBackoffMax      = 5 * time.Minute
+	LoginLockoutAttempts = 10
+	LoginLockoutDuration = 15 * time.Minute
+	LoginIPBurst         = 10
+	LoginIPInterval      = 6 * time.Second
+
+	EventAccountLocked = "account_locked"
+)
+
+var (
+	loginLimiters = make(map[string]*rate.Limiter)
+	loginIPLock   sync.Mutex
+)
+
+type LoginStatus struct {
+	Username    string `json:"username"`
+	Failures    int    `json:"failures"`
+	LockedUntil int64  `json:"locked_until"`
+	LastFailure int64  `json:"last_failure"`
+}
+
+// Delay required after the given number of consecutive failures
+func loginBackoff(failures int) time.Duration {
+	if failures < LoginFreeAttempts {
+		return 0
+	}
+	d := LoginBackoffBase << uint(failures-LoginFreeAttempts)
+	if d > LoginBackoffMax || d <= 0 {
+		d = LoginBackoffMax
+	}
+	return d
+}
+
+func loadLoginStatus(username string) LoginStatus {
+	s := LoginStatus{Username: username}
+	db.QueryRow("SELECT failures, locked_until, last_failure FROM login_failures WHERE username=?", username).
+		Scan(&s.Failures, &s.LockedUntil, &s.LastFailure)
+	return s
+}
+
+// How long the caller must wait before trying this account again (0 = go ahead)
+func loginWait(s LoginStatus, now time.Time) time.Duration {
+	if s.LockedUntil > now.Unix() {
+		return time.Unix(s.LockedUntil, 0).Sub(now)
+	}
+	next := time.Unix(s.LastFailure, 0).Add(loginBackoff(s.Failures))
+	if next.After(now) {
+		return next.Sub(now)
+	}
+	return 0
+}
+
+func recordLoginFailure(username, userUUID string) {
+	s := loadLoginStatus(username)
+	now := time.Now()
+	s.Failures++
+	s.LastFailure = now.Unix()
+	if s.Failures >= LoginLockoutAttempts && s.LockedUntil <= now.Unix() {
+		s.LockedUntil = now.Add(LoginLockoutDuration).Unix()
+		InfoLog.Printf("🔒 Account %s locked after %d failed logins", username, s.Failures)
+		emitEvent(userUUID, EventAccountLocked, map[string]interface{}{
+			"failures": s.Failures, "locked_until": s.LockedUntil,
+		})
+	}
+	db.Exec(`INSERT INTO login_failures (username, failures, locked_until, last_failure) VALUES (?, ?, ?, ?)
+	         ON CONFLICT(username) DO UPDATE SET failures=excluded.failures, locked_until=excluded.locked_until, last_failure=excluded.last_failure`,
+		username, s.Failures, s.LockedUntil, s.LastFailure)
+}
+
+// Clears the counter and returns how many failures happened since the last good login
+func clearLoginFailures(username string) int {
+	s := loadLoginStatus(username)
+	if s.Failures > 0 || s.LockedUntil > 0 {
+		db.Exec("DELETE FROM login_failures WHERE username=?", username)
+	}
+	return s.Failures
+}
+
+// Writes a 429 with Retry-After if the account may not try yet
+func rejectThrottledLogin(w http.ResponseWriter, username string) bool {
+	wait := loginWait(loadLoginStatus(username), time.Now())
+	if wait <= 0 {
+		return false
+	}
+	secs := int(wait.Seconds()) + 1
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	http.Error(w, fmt.Sprintf("Too Many Failed Logins: retry in %ds", secs), 429)
+	return true
+}
+
+// Loopback and in-process callers aren't limited, as in middlewareSecurity
+func allowLoginFrom(remoteAddr string) bool {
+	ip, _, _ := net.SplitHostPort(remoteAddr)
+	if ip == "" || ip == "::1" || ip == "127.0.0.1" {
+		return true
+	}
+	loginIPLock.Lock()
+	defer loginIPLock.Unlock()
+	limiter, ok := loginLimiters[ip]
+	if !ok {
+		if len(loginLimiters) >= SessionCacheSize {
+			loginLimiters = make(map[string]*rate.Limiter)
+		}
+		limiter = rate.NewLimiter(rate.Every(LoginIPInterval), LoginIPBurst)
+		loginLimiters[ip] = limiter
+	}
+	return limiter.Allow()
+}
+
+func loginError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]V2Error{"error": {Status: status, Code: code, Message: message}})
+}
+
+// POST {"username", "password"} -> a session, answered like a login through /api/register
+func handleLogin(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	var req struct {
+		Username string `json:"username" validate:"required"`
+		Password string `json:"password" validate:"required"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if !allowLoginFrom(r.RemoteAddr) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(LoginIPInterval.Seconds())))
+		loginError(w, 429, "rate_limited", "Too many login attempts from this address")
+		return
+	}
+	if wait := loginWait(loadLoginStatus(req.Username), time.Now()); wait > 0 {
+		secs := int(wait.Seconds()) + 1
+		w.Header().Set("Retry-After", strconv.Itoa(secs))
+		loginError(w, 429, "account_throttled", fmt.Sprintf("Too many failed logins: retry in %ds", secs))
+		return
+	}
+
+	var storedHash, globalUUID string
+	err := db.QueryRow("SELECT COALESCE(password_hash, ''), global_uuid FROM users WHERE username=? AND is_local=1", req.Username).
+		Scan(&storedHash, &globalUUID)
+	if err != nil {
+		loginError(w, 404, "user_not_found", "No account by that name on this node")
+		return
+	}
+	if storedHash == "" || hashBLAKE3([]byte(req.Password)) != storedHash {
+		recordLoginFailure(req.Username, globalUUID)
+		loginError(w, 401, "wrong_password", "Wrong password")
+		return
+	}
+	startLoginSession(w, globalUUID, clearLoginFailures(req.Username))
+}
+
+// GET lists throttled accounts; POST {"username"} clears one
+func handleAdminUnlockAccount(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	if !authenticateAdmin(r) {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var req struct {
+			Username string `json:"username" validate:"required"`
+		}
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		clearLoginFailures(req.Username)
+		InfoLog.Printf("🔓 Account %s unlocked by operator", req.Username)
+		w.Write([]byte("Account Unlocked"))
+		return
+	}
+
+	rows, err := db.Query("SELECT username, failures, locked_until, last_failure FROM login_failures ORDER BY last_failure DESC LIMIT 200")
+	if err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+	defer rows.Close()
+	list := []LoginStatus{}
+	for rows.Next() {
+		var s LoginStatus
+		rows.Scan(&s.Username, &s.Failures, &s.LockedUntil, &s.LastFailure)
+		list = append(list, s)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
@@ -1,30 +1,81 @@
 package main
 
 import (
-	"bytes"
 	crand "crypto/rand"
 	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
+	"flag"
 	"fmt"
 	mrand "math/rand"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// Routes contributed by build-tagged files (e.g. /test/seed with -tags testseed)
+var extraRoutes []func(mux *http.ServeMux)
+
+// Selects the universe (data dir, logs, identity) and listen port for this process.
+// Returns the supervisor spec if --supervise was given, and the operator command (see cli.go)
+// if one other than serve was.
+func parseFlags() (string, []string) {
+	universe := flag.String("universe", os.Getenv("OWNWORLD_UNIVERSE"), "Named universe; keeps its own data dir, logs and identity")
+	port := flag.String("port", os.Getenv("OWNWORLD_PORT"), "Listen port (default 8080)")
+	supervise := flag.String("supervise", "", "Run several universes as child processes: name:port,name:port")
+	flag.Parse()
+
+	// Flags may follow serve as well as precede it
+	command := flag.Args()
+	if len(command) > 0 && command[0] == "serve" {
+		flag.CommandLine.Parse(command[1:])
+		command = flag.Args()
+		if len(command) > 0 {
+			fmt.Fprintln(os.Stderr, operatorUsage())
+			os.Exit(2)
+		}
+	}
+
+	if *universe != "" {
+		if !usernameRegex.MatchString(*universe) {
+			fmt.Fprintln(os.Stderr, "Invalid universe name (Alphanumeric and _ only)")
+			os.Exit(2)
+		}
+		UniverseName = *universe
+		DataDir = filepath.Join("./data", "universes", UniverseName)
+		DBPath = filepath.Join(DataDir, "ownworld.db")
+		LogDir = filepath.Join(DataDir, "logs")
+	}
+	if *port != "" {
+		ListenAddr = ":" + strings.TrimPrefix(*port, ":")
+	}
+	return *supervise, command
+}
+
 func initConfig() {
-    // Default to FALSE for safety (Requires OWNWORLD_COMMAND_CONTROL=true env var to enable registration)
-	Config.CommandControl = false 
+	// Default to FALSE for safety (Requires OWNWORLD_COMMAND_CONTROL=true env var to enable registration)
+	Config.CommandControl = false
 	if os.Getenv("OWNWORLD_COMMAND_CONTROL") == "true" {
 		Config.CommandControl = true
 	}
 
+	Config.RegistrationClosed = os.Getenv("OWNWORLD_REGISTRATION") == "closed"
+	Config.RegistrationInvite = os.Getenv("OWNWORLD_REGISTRATION") == "invite"
+	if n, err := strconv.Atoi(os.Getenv("OWNWORLD_REGISTRATIONS_PER_IP")); err == nil && n > 0 {
+		Config.RegistrationsPerIP = n
+	}
+
 	Config.PeeringMode = "promiscuous"
 	if mode := os.Getenv("OWNWORLD_PEERING_MODE"); mode == "strict" {
 		Config.PeeringMode = "strict"
 	}
+	if v, err := strconv.ParseFloat(os.Getenv("OWNWORLD_RECALL_CUTOFF"), 64); err == nil && v > 0 && v <= 1 {
+		Config.RecallCutoff = v
+	}
+	initAdvertisedAddr()
 }
 
 // FIX F: Bootstrapping - Fetch Genesis BEFORE DB Init
@@ -45,13 +96,22 @@ func fetchGenesisFromSeed(seeds string) string {
 		resp, err := client.Get(statusURL)
 		if err == nil && resp.StatusCode == 200 {
 			var status struct {
-				UUID    string `json:"uuid"`
-				Genesis string `json:"genesis"`
+				UUID    string         `json:"uuid"`
+				Genesis string         `json:"genesis"`
+				Params  *GenesisParams `json:"genesis_params"`
 			}
 			json.NewDecoder(resp.Body).Decode(&status)
 			resp.Body.Close()
 
 			if status.Genesis != "" {
+				// A seed without parameters holds a legacy genesis with the default shape
+				if status.Params != nil {
+					if err := verifyGenesisParams(status.Genesis, *status.Params); err != nil {
+						ErrorLog.Printf("Seed %s refused: %v", seed, err)
+						continue
+					}
+				}
+				TargetGenesisParams = status.Params
 				InfoLog.Printf("🌍 Found Universe Genesis via Seed: %s", status.Genesis)
 				return status.Genesis
 			}
@@ -61,10 +121,6 @@ func fetchGenesisFromSeed(seeds string) string {
 }
 
 func bootstrapFederation() {
-	publicAddr := os.Getenv("OWNWORLD_PUBLIC_URL")
-	if publicAddr == "" {
-		publicAddr = "http://localhost:8080"
-	}	
 	seeds := os.Getenv("SEED_NODES")
 	if seeds == "" {
 		InfoLog.Println("No SEED_NODES found. Starting as Lonely/Genesis Node.")
@@ -87,22 +143,23 @@ func bootstrapFederation() {
 		}
 
 		req := HandshakeRequest{
-			UUID:        ServerUUID,
-			GenesisHash: myGenHash,
-			PublicKey:   hex.EncodeToString(PublicKey),
-			Address:     publicAddr,
-			Location:    ServerLoc,
+			UUID:         ServerUUID,
+			GenesisHash:  myGenHash,
+			PublicKey:    hex.EncodeToString(PublicKey),
+			Address:      AdvertisedAddr(),
+			Location:     ServerLoc,
+			LocationSalt: advertisedLocationSalt(),
+			InviteToken:  os.Getenv("OWNWORLD_INVITE_TOKEN"),
+			Features:     enabledFeatures(),
+			Tolls:        currentTolls(),
 		}
-		payload, _ := json.Marshal(req)
-		compressed := compressLZ4(payload)
-
 		targetURL := seed + "/federation/handshake"
 		if !strings.HasPrefix(seed, "http") {
 			targetURL = "http://" + seed + "/federation/handshake"
 		}
 
 		client := &http.Client{Timeout: 5 * time.Second}
-		resp, err := client.Post(targetURL, "application/x-ownworld-fed", bytes.NewBuffer(compressed))
+		resp, err := postHandshake(client, targetURL, req)
 		if err != nil {
 			ErrorLog.Printf("Seed %s unreachable: %v", seed, err)
 			continue
@@ -111,30 +168,25 @@ func bootstrapFederation() {
 		var respData HandshakeResponse
 		json.NewDecoder(resp.Body).Decode(&respData)
 		resp.Body.Close()
+		learnObservedAddr(respData.ObservedAddr)
+
+		switch respData.Status {
+		case HandshakeQueued, HandshakeAccepted:
+			InfoLog.Printf("✅ Connected to Galaxy via Seed %s (%s, features: %v)", seed, respData.Status, respData.Features)
+		case HandshakeStrictPending:
+			InfoLog.Printf("⏳ Seed %s queued us for operator approval (strict mode)", seed)
+		default:
+			ErrorLog.Printf("Seed %s refused handshake: %s (%s)", seed, respData.Status, respData.Reason)
+			continue
+		}
 
-		if respData.Status == "Queued" || respData.Status == "Accepted" {
-			InfoLog.Printf("✅ Connected to Galaxy via Seed %s", seed)
-
-			if len(respData.Location) == 3 {
-				if ServerLoc[0] == 0 && ServerLoc[1] == 0 && ServerLoc[2] == 0 {
-					jitterX := mrand.Intn(10) - 5
-					jitterY := mrand.Intn(10) - 5
-					jitterZ := mrand.Intn(10) - 5
-
-					ServerLoc = []int{
-						respData.Location[0] + jitterX,
-						respData.Location[1] + jitterY,
-						respData.Location[2] + jitterZ,
-					}
-
-					db.Exec("INSERT OR REPLACE INTO system_meta (key, value) VALUES ('loc_x', ?)", fmt.Sprint(ServerLoc[0]))
-					db.Exec("INSERT OR REPLACE INTO system_meta (key, value) VALUES ('loc_y', ?)", fmt.Sprint(ServerLoc[1]))
-					db.Exec("INSERT OR REPLACE INTO system_meta (key, value) VALUES ('loc_z', ?)", fmt.Sprint(ServerLoc[2]))
-					InfoLog.Printf("📍 Server Cluster Location Set: %v", ServerLoc)
-				}
-			}
-			break
+		// The seed's location counts against ours even before it shows up as a peer
+		if err := verifyLocation(respData.UUID, respData.Location, respData.LocationSalt); err != nil {
+			ErrorLog.Printf("Seed %s advertises a bad location: %v", seed, err)
+		} else if len(respData.Location) == 3 {
+			settleLocation(locationClaim{UUID: respData.UUID, Location: respData.Location, Salt: saltOrLegacy(respData.LocationSalt)})
 		}
+		break
 	}
 }
 
@@ -143,29 +195,54 @@ func main() {
 	crand.Read(b[:])
 	mrand.Seed(int64(binary.LittleEndian.Uint64(b[:])))
 
+	spec, command := parseFlags()
+	if len(command) > 0 {
+		if err := runOperatorCommand(command, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if spec != "" {
+		runSupervisor(spec)
+		return
+	}
+
 	setupLogging()
 	initConfig()
+	loadDecayRates()
+	loadReputationModel()
 
 	TargetGenesisHash = fetchGenesisFromSeed(os.Getenv("SEED_NODES"))
 
 	initDB()
-
-	// --- RACE CONDITION FIX START ---
-	// We explicitly initialize ServerLoc here, synchronously.
-	// This ensures that even if bootstrapFederation() runs slowly in the background,
-	// HTTP handlers (like /register) will never see a nil ServerLoc.
-	if ServerLoc == nil {
-		ServerLoc = []int{0, 0, 0}
-	}
-	// --- RACE CONDITION FIX END ---
+	loadGalaxyIndex()
+	loadFeatureFlags()
+	loadTolls()
+	loadEconomy()
+	loadNotice()
+	loadPeers()
+	mailer = mailerFromEnv()
+	captcha = captchaFromEnv()
+	runConsistencyCheck()
+
+	// ServerLoc is placed synchronously (see location.go), so even if bootstrapFederation()
+	// runs slowly in the background, HTTP handlers (like /register) never see a nil ServerLoc.
+	settleLocation()
 
 	InfoLog.Println("OWNWORLD BOOT SEQUENCE (V3.1)")
+	if UniverseName != "" {
+		InfoLog.Printf("Universe: %s (%s)", UniverseName, DataDir)
+	}
 	InfoLog.Printf("Mode: %v | Control: %v", Config.PeeringMode, Config.CommandControl)
 
 	go processImmigration()
 	go startHeartbeatLoop()
 	go bootstrapFederation()
 	go runGameLoop()
+	go runWebhookWorker()
+	go runOutboxWorker()
+	go runSettlementWorker()
 
 	mux := http.NewServeMux()
 
@@ -175,50 +252,144 @@ func main() {
 	mux.HandleFunc("/federation/transaction", handleFederationTransaction)
 	mux.HandleFunc("/federation/heartbeat", handleHeartbeat)
 	mux.HandleFunc("/federation/reputation", handleReputationQuery)
-
-    // User endpoints (Should be gated in future if needed, but logic remains same)
+	mux.HandleFunc("/federation/graph", handleFederationGraph)
+	mux.HandleFunc("/federation/proof", handleFederationProof)
+	mux.HandleFunc("/federation/battle", handleFederationBattle)
+	mux.HandleFunc("/federation/arbitrate", handleFederationArbitrate)
+	mux.HandleFunc("/federation/changes", handleFederationChanges)
+	mux.HandleFunc("/federation/roster", handleFederationRoster)
+
+	// User endpoints (Should be gated in future if needed, but logic remains same)
 	mux.HandleFunc("/api/register", func(w http.ResponseWriter, r *http.Request) {
-        if !Config.CommandControl {
-            http.Error(w, "Registration Disabled on this Node", 403)
-            return
-        }
-        handleRegister(w, r)
-    })
+		if !Config.CommandControl {
+			http.Error(w, "Registration Disabled on this Node", 403)
+			return
+		}
+		handleRegister(w, r)
+	})
+	mux.HandleFunc("/api/login", commandControlOnly(handleLogin))
+	mux.HandleFunc("/api/session/refresh", handleSessionRefresh)
+	mux.HandleFunc("/api/account/recovery", handleAccountRecovery)
+	mux.HandleFunc("/api/account/email", handleAccountEmail)
+	mux.HandleFunc("/api/account/recovery-code", handleAccountRecoveryCode)
+	mux.HandleFunc("/api/account/verify", handleAccountVerify)
+	mux.HandleFunc("/api/account/reset/request", commandControlOnly(handleAccountResetRequest))
+	mux.HandleFunc("/api/account/reset", commandControlOnly(handleAccountReset))
+	mux.HandleFunc("/api/passkeys", handlePasskeys)
+	mux.HandleFunc("/api/preferences", handlePreferences)
+	mux.HandleFunc("/api/passkeys/register/begin", handlePasskeyRegisterBegin)
+	mux.HandleFunc("/api/passkeys/register/finish", handlePasskeyRegisterFinish)
+	mux.HandleFunc("/api/passkeys/login/begin", commandControlOnly(handlePasskeyLoginBegin))
+	mux.HandleFunc("/api/passkeys/login/finish", commandControlOnly(handlePasskeyLoginFinish))
 	mux.HandleFunc("/api/deploy", handleDeploy)
 	mux.HandleFunc("/api/build", handleBuild)
 	mux.HandleFunc("/api/construct", handleConstruct)
+	mux.HandleFunc("/api/catalog", handleCatalog)
+	mux.HandleFunc("/api/research", handleResearch)
+	mux.HandleFunc("/api/council", handleCouncil)
+	mux.HandleFunc("/api/embargoes", handleEmbargoes)
 	mux.HandleFunc("/api/bank/burn", handleBankBurn)
 	mux.HandleFunc("/api/fleet/launch", handleFleetLaunch)
+	mux.HandleFunc("/api/fleet/estimate", handleFleetEstimate)
+	mux.HandleFunc("/api/fleet/", handleFleetManifest)
+	mux.HandleFunc("/public/player/", handlePublicPlayer)
 	mux.HandleFunc("/api/state", handleState)
 	mux.HandleFunc("/api/scan", handleScan)
+	mux.HandleFunc("/api/scan/region", handleScanRegion)
+	mux.HandleFunc("/api/beacons", handleBeacons)
+	mux.HandleFunc("/api/systems/name", handleNameSystem)
 	mux.HandleFunc("/api/fleet/transfer", handleCargoTransfer)
+	mux.HandleFunc("/api/fleet/home", handleFleetHome)
+	mux.HandleFunc("/api/fleet/recall", handleFleetRecall)
+	mux.HandleFunc("/api/fleet/refit", handleFleetRefit)
+	mux.HandleFunc("/api/fleet/repair", handleFleetRepair)
+	mux.HandleFunc("/api/fleet/patrol", handlePatrol)
+	mux.HandleFunc("/api/fleet/survey", handleFleetSurvey)
+	mux.HandleFunc("/api/fleet/salvage", handleFleetSalvage)
+	mux.HandleFunc("/api/wrecks", handleWrecks)
+	mux.HandleFunc("/api/battles", handleBattleReports)
+	mux.HandleFunc("/api/fleet/bombard", handleBombardTarget)
+	mux.HandleFunc("/api/bombardments", handleBombardmentReports)
 	mux.HandleFunc("/api/colony/policy", handleSetPolicy)
-    
-    // Federation & Market
-    mux.HandleFunc("/api/federation/ally", handleAlly)
-    mux.HandleFunc("/api/federation/peers", handleListPeers)
-    mux.HandleFunc("/api/market/place", handlePlaceOrder)
-    mux.HandleFunc("/api/market/list", handleListOrders)
-
-	mux.HandleFunc("/api/status", func(w http.ResponseWriter, r *http.Request) {
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"uuid": ServerUUID, "tick": CurrentTick, "leader": LeaderUUID,
-			"location": ServerLoc, "genesis": GenesisHash,
-		})
-	})
+	mux.HandleFunc("/api/colony/workforce", handleColonyWorkforce)
+	mux.HandleFunc("/api/colony/governors", handleColonyGovernors)
+	mux.HandleFunc("/api/colony/modules", handleQueueModules)
+	mux.HandleFunc("/api/colony/capital", handleCapital)
+
+	// Federation & Market
+	mux.HandleFunc("/api/events", handleEvents)
+	mux.HandleFunc("/api/federation/ally", handleAlly)
+	mux.HandleFunc("/api/federation/peers", handleListPeers)
+	mux.HandleFunc("/api/federation/reputation", handlePeerReputation)
+	mux.HandleFunc("/api/market/place", handlePlaceOrder)
+	mux.HandleFunc("/api/market/list", handleListOrders)
+	mux.HandleFunc("/api/market/bulk", handleBulkOrders)
+	mux.HandleFunc("/api/market/cancel", handleCancelOrder)
+	mux.HandleFunc("/api/market/mine", handleMyOrders)
+	mux.HandleFunc("/api/contracts", handleContracts)
+	mux.HandleFunc("/api/contracts/accept", handleAcceptContract)
+	mux.HandleFunc("/api/contracts/deliver", handleDeliverContract)
+	mux.HandleFunc("/api/contracts/cancel", handleCancelContract)
+	mux.HandleFunc("/api/contracts/conversion", handleConversions)
+	mux.HandleFunc("/api/contracts/conversion/deliver", handleDeliverConversion)
+	mux.HandleFunc("/api/contracts/conversion/collect", handleCollectConversion)
+	mux.HandleFunc("/api/grievances", handleListGrievances)
+	mux.HandleFunc("/api/grievances/settle", handleSettleGrievance)
+	mux.HandleFunc("/api/keys/unlock", handleUnlockKey)
+	mux.HandleFunc("/api/keys/lock", handleLockKey)
+	mux.HandleFunc("/api/keys/sign", handleSignAction)
+	mux.HandleFunc("/api/webhooks", handleWebhooks)
+	mux.HandleFunc("/api/webhooks/delete", handleDeleteWebhook)
+	mux.HandleFunc("/api/factions", handleListFactions)
+	mux.HandleFunc("/api/factions/tribute", handleFactionTribute)
+
+	// Operator endpoints
+	mux.HandleFunc("/admin/consistency", handleConsistencyReport)
+	mux.HandleFunc("/admin/invite", handleAdminInvite)
+	mux.HandleFunc("/admin/registration-codes", handleAdminRegistrationCodes)
+	mux.HandleFunc("/admin/features", handleAdminFeatures)
+	mux.HandleFunc("/admin/immigration", handleAdminImmigration)
+	mux.HandleFunc("/admin/factions/claim", handleAdminClaimFaction)
+	mux.HandleFunc("/admin/accounts/unlock", handleAdminUnlockAccount)
+	mux.HandleFunc("/admin/db", handleAdminDB)
+	mux.HandleFunc("/admin/tolls", handleAdminTolls)
+	mux.HandleFunc("/admin/economy", handleAdminEconomy)
+	mux.HandleFunc("/admin/motd", handleAdminMOTD)
+	mux.HandleFunc("/admin/outbox", handleAdminOutbox)
+	mux.HandleFunc("/admin/grievances", handleAdminGrievances)
+	mux.HandleFunc("/admin/grievances/settle", handleAdminSettleGrievance)
+	mux.HandleFunc("/admin/events", handleAdminEvents)
+	mux.HandleFunc("/admin/events/cancel", handleAdminCancelEvent)
+	mux.HandleFunc("/admin/embargoes", handleAdminEmbargoes)
+	mux.HandleFunc("/admin/arbitration", handleAdminArbitration)
+	mux.HandleFunc("/admin/council", handleAdminCouncil)
+	mux.HandleFunc("/admin/council/vote", handleAdminCouncilVote)
+
+	mux.HandleFunc("/api/economy", handleEconomy)
+	mux.HandleFunc("/api/status", handleStatus)
+
+	// Versioned surfaces over the same routes (see versions.go)
+	mux.HandleFunc("/api/v1/", versionedAPI(mux, "v1"))
+	mux.HandleFunc("/api/v2/", versionedAPI(mux, "v2"))
+
+	for _, add := range extraRoutes {
+		add(mux)
+	}
 
-	handler := middlewareSecurity(mux)
+	handler := middlewareAPI(mux)
+	handler = middlewareFederationAuth(handler)
+	handler = middlewareSecurity(handler)
 	handler = middlewareCORS(handler)
 
 	server := &http.Server{
-		Addr:         ":8080",
+		Addr:         ListenAddr,
 		Handler:      handler,
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  120 * time.Second,
 	}
 
-	InfoLog.Printf("Node %s Listening on :8080", ServerUUID)
+	InfoLog.Printf("Node %s Listening on %s", ServerUUID, ListenAddr)
 	if err := server.ListenAndServe(); err != nil {
 		ErrorLog.Fatal(err)
 	}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// --- Bulk Order Placement ---
+// POST /api/market/bulk lists up to MaxBulkOrders orders in one call under the same rules as
+// /api/market/place, all or nothing: every order is checked (trading post, per-system order
+// limit counting the batch itself) before anything is charged, the listing fees are taken
+// in one debit, and a single failure rejects the whole batch naming the offending order.
+
+const MaxBulkOrders = 100
+
+type BulkOrderResult struct {
+	OrderIDs []string `json:"order_ids"`
+	Fee      int      `json:"fee"`
+}
+
+// Checks one order of a batch; pending counts the batch's earlier orders per system
+func checkBulkOrder(userID string, o MarketOrder, now int64, pending map[string]int) (fee, status int, msg string) {
+	if o.Item == "" || o.OriginSystem == "" || o.Quantity <= 0 || o.Price <= 0 {
+		return 0, 400, "Invalid Item, System, Quantity or Price"
+	}
+
+	var bJson string
+	if err := db.QueryRow("SELECT buildings_json FROM colonies WHERE system_id=? AND owner_uuid=? AND COALESCE(site_type, 'planet')='planet'", o.OriginSystem, userID).Scan(&bJson); err != nil {
+		return 0, 403, "No Colony in Origin System"
+	}
+	buildings := make(map[string]int)
+	json.Unmarshal([]byte(bJson), &buildings)
+	level := buildings["trading_post"]
+	if level < 1 {
+		return 0, 400, "Trading Post Required"
+	}
+
+	var active int
+	db.QueryRow("SELECT count(*) FROM market_orders WHERE origin_system=? AND expires_tick > ?", o.OriginSystem, now).Scan(&active)
+	if active+pending[o.OriginSystem] >= orderLimit(level) {
+		return 0, 429, fmt.Sprintf("Order Limit Reached (%d for trading post level %d)", orderLimit(level), level)
+	}
+	pending[o.OriginSystem]++
+
+	return listingFee(level, o.Quantity*o.Price), 0, ""
+}
+
+func handleBulkOrders(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	var req struct {
+		Orders []MarketOrder `json:"orders" validate:"required"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+	if len(req.Orders) > MaxBulkOrders {
+		http.Error(w, fmt.Sprintf("Too Many Orders (max %d)", MaxBulkOrders), 400)
+		return
+	}
+
+	keys := []string{userRow(userID)}
+	for _, o := range req.Orders {
+		keys = append(keys, marketRow(o.OriginSystem))
+	}
+	defer lockRows(keys...)()
+
+	now := atomic.LoadInt64(&CurrentTick)
+	pending := make(map[string]int)
+	res := BulkOrderResult{OrderIDs: make([]string, 0, len(req.Orders))}
+	for i := range req.Orders {
+		fee, status, msg := checkBulkOrder(userID, req.Orders[i], now, pending)
+		if status != 0 {
+			http.Error(w, fmt.Sprintf("Order %d: %s", i, msg), status)
+			return
+		}
+		res.Fee += fee
+	}
+
+	tx, _ := db.Begin()
+	if !escrowCredits(tx, userID, res.Fee) {
+		tx.Rollback()
+		http.Error(w, fmt.Sprintf("Insufficient Credits for Listing Fees (%d)", res.Fee), 402)
+		return
+	}
+	stamp := time.Now().UnixNano()
+	for i, o := range req.Orders {
+		o.ID = fmt.Sprintf("ord-%s-%d-%d", userID[:8], stamp, i)
+		o.SellerUUID = userID
+		o.ExpiresTick = now + OrderLifetimeTicks
+		_, err := tx.Exec("INSERT INTO market_orders (order_id, seller_uuid, item, quantity, price, is_buy, origin_system, expires_tick) VALUES (?,?,?,?,?,?,?,?)",
+			o.ID, o.SellerUUID, o.Item, o.Quantity, o.Price, o.IsBuy, o.OriginSystem, o.ExpiresTick)
+		if err != nil {
+			tx.Rollback()
+			http.Error(w, fmt.Sprintf("Order %d: Failed to place order", i), 500)
+			return
+		}
+		res.OrderIDs = append(res.OrderIDs, o.ID)
+	}
+	tx.Commit()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
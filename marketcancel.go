@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+)
+
+// --- Order Cancellation ---
+// Sellers withdraw their own orders with POST /api/market/cancel and list them with GET
+// /api/market/mine. Only the node holding an order can cancel it; the listing fee is not
+// refunded. Peers hold gossiped copies, so a cancellation leaves a tombstone signed by the
+// holding node that rides on heartbeats until the order would have expired anyway. Receivers
+// check the signature against the holder's key, drop their copy and refuse to re-list the
+// order when another peer gossips it again.
+
+const MaxGossipedCancels = 50
+
+type OrderCancellation struct {
+	OrderID   string `json:"order_id"`
+	Node      string `json:"node"` // node that held the order and signed the cancellation
+	Signature string `json:"signature"`
+}
+
+func (c OrderCancellation) signingString() []byte {
+	return []byte("CANCEL_ORDER:" + c.OrderID + ":" + c.Node)
+}
+
+func handleCancelOrder(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	var req struct {
+		OrderID string `json:"order_id" validate:"required"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	var seller, system, node string
+	if db.QueryRow("SELECT seller_uuid, origin_system, COALESCE(origin_node, '') FROM market_orders WHERE order_id=?", req.OrderID).
+		Scan(&seller, &system, &node) != nil {
+		http.Error(w, "Order Not Found", 404)
+		return
+	}
+	if seller != userID {
+		http.Error(w, "Not your order", 403)
+		return
+	}
+	if node != "" && node != ServerUUID {
+		http.Error(w, "Order is held by another node", 409)
+		return
+	}
+
+	defer lockRows(userRow(userID), marketRow(system))()
+
+	c := OrderCancellation{OrderID: req.OrderID, Node: ServerUUID}
+	c.Signature = hex.EncodeToString(SignMessage(PrivateKey, c.signingString()))
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec("DELETE FROM market_orders WHERE order_id=?", req.OrderID)
+	if err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Order Not Found", 404) // filled or cancelled meanwhile
+		return
+	}
+	// Without its tombstone the order would be relisted by the next peer to gossip it
+	if _, err := tx.Exec("INSERT OR REPLACE INTO cancelled_orders (order_id, origin_node, signature, cancelled_tick) VALUES (?, ?, ?, ?)",
+		c.OrderID, c.Node, c.Signature, atomic.LoadInt64(&CurrentTick)); err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+	w.Write([]byte("Order Cancelled: " + req.OrderID))
+}
+
+// GET: the caller's orders, newest expiry first
+func handleMyOrders(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+	rows, err := db.Query(`SELECT order_id, seller_uuid, item, quantity, price, is_buy, origin_system, expires_tick, COALESCE(NULLIF(origin_node, ''), ?)
+	                       FROM market_orders WHERE seller_uuid=? ORDER BY expires_tick DESC`, ServerUUID, userID)
+	if err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+	defer rows.Close()
+
+	orders := []MarketOrder{}
+	for rows.Next() {
+		var o MarketOrder
+		rows.Scan(&o.ID, &o.SellerUUID, &o.Item, &o.Quantity, &o.Price, &o.IsBuy, &o.OriginSystem, &o.ExpiresTick, &o.Node)
+		orders = append(orders, o)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orders)
+}
+
+// Cancellations still worth gossiping: orders they withdrew could not have expired yet
+func recentCancellations(tick int64) []OrderCancellation {
+	rows, err := db.Query("SELECT order_id, origin_node, signature FROM cancelled_orders WHERE cancelled_tick > ? ORDER BY cancelled_tick DESC LIMIT ?",
+		tick-OrderLifetimeTicks, MaxGossipedCancels)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var list []OrderCancellation
+	for rows.Next() {
+		var c OrderCancellation
+		rows.Scan(&c.OrderID, &c.Node, &c.Signature)
+		list = append(list, c)
+	}
+	return list
+}
+
+// Applies gossiped cancellations signed by the node that held each order
+func acceptCancellations(list []OrderCancellation) {
+	if len(list) > MaxGossipedCancels {
+		return
+	}
+	now := atomic.LoadInt64(&CurrentTick)
+	for _, c := range list {
+		if c.Node == ServerUUID || !nodeSignatureValid(c.Node, c.signingString(), c.Signature) {
+			continue
+		}
+		res, err := db.Exec("INSERT OR IGNORE INTO cancelled_orders (order_id, origin_node, signature, cancelled_tick) VALUES (?, ?, ?, ?)",
+			c.OrderID, c.Node, c.Signature, now)
+		if err != nil {
+			continue
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			db.Exec("DELETE FROM market_orders WHERE order_id=? AND origin_node=?", c.OrderID, c.Node)
+		}
+	}
+}
+
+func pruneCancellations(current int64) {
+	db.Exec("DELETE FROM cancelled_orders WHERE cancelled_tick < ?", current-OrderLifetimeTicks)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// --- Order Matching ---
+// Each tick, local buy and sell orders for the same item in the same system are crossed without
+// a freighter: the best-priced buy (earliest first among equals) takes from the cheapest sells
+// priced at or under it, at the price of whichever order was listed first. A fill is one
+// transaction that escrows both sides before paying out: goods come out of the seller's colony
+// in the system and credits out of the buyer's balance, and each lands on the other side only if
+// both were there. Fills can be partial; an order is removed once its quantity reaches zero.
+// Orders held by other nodes, orders a fleet is flying to fill, and orders between the same
+// player or embargoed parties are left alone. Fills are logged as TRADE_FILL like fleet fills.
+
+type bookOrder struct {
+	MarketOrder
+	Seq int64 // rowid: listing order
+}
+
+type orderBook struct {
+	Buys, Sells []*bookOrder
+}
+
+func loadOrderBooks(current int64) map[string]*orderBook {
+	rows, err := db.Query(`SELECT rowid, order_id, seller_uuid, item, quantity, price, is_buy, origin_system FROM market_orders
+	                       WHERE COALESCE(origin_node, '') IN ('', ?) AND expires_tick > ? AND quantity > 0
+	                         AND order_id NOT IN (SELECT target_order_id FROM fleets WHERE status='TRANSIT' AND target_order_id IS NOT NULL)
+	                       ORDER BY rowid`, ServerUUID, current)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	books := make(map[string]*orderBook)
+	for rows.Next() {
+		o := &bookOrder{}
+		rows.Scan(&o.Seq, &o.ID, &o.SellerUUID, &o.Item, &o.Quantity, &o.Price, &o.IsBuy, &o.OriginSystem)
+		if !validResources[o.Item] {
+			continue
+		}
+		key := o.OriginSystem + "|" + o.Item
+		b := books[key]
+		if b == nil {
+			b = &orderBook{}
+			books[key] = b
+		}
+		if o.IsBuy {
+			b.Buys = append(b.Buys, o)
+		} else {
+			b.Sells = append(b.Sells, o)
+		}
+	}
+	return books
+}
+
+// Crosses every book; returns the number of fills
+func matchOrders(current int64) int {
+	books := loadOrderBooks(current)
+	keys := make([]string, 0, len(books))
+	for k, b := range books {
+		if len(b.Buys) > 0 && len(b.Sells) > 0 {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	fills := 0
+	for _, k := range keys {
+		b := books[k]
+		sort.SliceStable(b.Buys, func(i, j int) bool { return b.Buys[i].Price > b.Buys[j].Price })
+		sort.SliceStable(b.Sells, func(i, j int) bool { return b.Sells[i].Price < b.Sells[j].Price })
+		for _, buy := range b.Buys {
+			for _, sell := range b.Sells {
+				if buy.Quantity == 0 || sell.Price > buy.Price {
+					break
+				}
+				if sell.Quantity == 0 || sell.SellerUUID == buy.SellerUUID {
+					continue
+				}
+				if fillOrders(buy, sell, current) {
+					fills++
+				}
+			}
+		}
+	}
+	return fills
+}
+
+// Fills as much of buy against sell as the seller's stock and the buyer's credits allow
+func fillOrders(buy, sell *bookOrder, current int64) bool {
+	sys, item := sell.OriginSystem, sell.Item
+	var sellerCol, buyerCol, stock int
+	if db.QueryRow(fmt.Sprintf("SELECT id, %s FROM colonies WHERE system_id=? AND owner_uuid=? AND COALESCE(site_type, 'planet')='planet' ORDER BY id LIMIT 1", item), sys, sell.SellerUUID).Scan(&sellerCol, &stock) != nil {
+		return false
+	}
+	if db.QueryRow("SELECT id FROM colonies WHERE system_id=? AND owner_uuid=? AND COALESCE(site_type, 'planet')='planet' ORDER BY id LIMIT 1", sys, buy.SellerUUID).Scan(&buyerCol) != nil {
+		return false
+	}
+	if checkEmbargo(sell.SellerUUID, sellerCol, buy.SellerUUID, sys) != nil {
+		return false
+	}
+
+	price := sell.Price
+	if buy.Seq < sell.Seq {
+		price = buy.Price
+	}
+	var credits int
+	db.QueryRow("SELECT credits FROM users WHERE global_uuid=?", buy.SellerUUID).Scan(&credits)
+	qty := buy.Quantity
+	if sell.Quantity < qty {
+		qty = sell.Quantity
+	}
+	if stock < qty {
+		qty = stock
+	}
+	if price > 0 && credits/price < qty {
+		qty = credits / price
+	}
+	if qty <= 0 {
+		return false
+	}
+	cost := qty * price
+
+	tx, err := db.Begin()
+	if err != nil {
+		return false
+	}
+	// Escrow both sides; either missing undoes the fill
+	escrow := func(query string, args ...interface{}) bool {
+		res, err := tx.Exec(query, args...)
+		if err != nil {
+			return false
+		}
+		n, _ := res.RowsAffected()
+		return n > 0
+	}
+	if !escrow(fmt.Sprintf("UPDATE colonies SET %s = %s - ? WHERE id=? AND %s >= ?", item, item, item), qty, sellerCol, qty) ||
+		!escrow("UPDATE users SET credits = credits - ? WHERE global_uuid=? AND credits >= ?", cost, buy.SellerUUID, cost) ||
+		!escrow("UPDATE market_orders SET quantity = quantity - ? WHERE order_id=? AND quantity >= ?", qty, buy.ID, qty) ||
+		!escrow("UPDATE market_orders SET quantity = quantity - ? WHERE order_id=? AND quantity >= ?", qty, sell.ID, qty) {
+		tx.Rollback()
+		return false
+	}
+	tx.Exec(fmt.Sprintf("UPDATE colonies SET %s = %s + ? WHERE id=?", item, item), qty, buyerCol)
+	tx.Exec("UPDATE users SET credits = credits + ? WHERE global_uuid=?", cost, sell.SellerUUID)
+	tx.Exec("DELETE FROM market_orders WHERE order_id IN (?, ?) AND quantity <= 0", buy.ID, sell.ID)
+	fillJson, _ := json.Marshal(TradeRecord{Item: item, Quantity: qty, Price: price, ColonyID: sellerCol})
+	tx.Exec("INSERT INTO transaction_log (tick, action_type, payload_blob) VALUES (?, 'TRADE_FILL', ?)", current, fillJson)
+	if tx.Commit() != nil {
+		return false
+	}
+	buy.Quantity -= qty
+	sell.Quantity -= qty
+
+	InfoLog.Printf("💱 Matched %d %s at %d in %s (%s -> %s)", qty, item, price, sys, sell.ID, buy.ID)
+	for _, o := range []*bookOrder{buy, sell} {
+		emitEvent(o.SellerUUID, EventOrderFilled, map[string]interface{}{
+			"order_id": o.ID, "item": item, "quantity": qty, "price": price, "is_buy": o.IsBuy,
+			"system_id": sys, "remaining": o.Quantity, "matched": true,
+		})
+	}
+	return true
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// --- Module Manufacturing ---
+// Ship modules are manufactured by module factories into the colony's module stock, one unit
+// per factory per tick from the head of the colony's build queue. Construction and refits draw
+// on that stock instead of paying raw iron.
+
+type ModuleOrder struct {
+	Module string `json:"module"`
+	Count  int    `json:"count"`
+}
+
+var ModuleRecipes = map[string]map[string]int{
+	"booster":    {"iron": 100, "steel": 10},
+	"propeller":  {"iron": 50, "steel": 5},
+	"warp_drive": {"iron": 1000, "steel": 100, "platinum": 20, "diamond": 5},
+	"laser":      {"iron": 200, "steel": 20, "diamond": 2},
+	"railgun":    {"iron": 300, "steel": 50, "platinum": 5},
+	"bomb_bay":   {"iron": 500, "steel": 80},
+	"colony_kit": {"iron": 5000, "steel": 200, "platinum": 10},
+
+	"gravity_dampener": {"iron": 800, "steel": 150, "platinum": 30},
+	"heat_shield":      {"iron": 400, "steel": 100, "diamond": 5},
+	"salvage_rig":      {"iron": 400, "steel": 60}, // Strips wrecks (see wrecks.go)
+	"boarding_pod":     {"iron": 300, "steel": 80}, // Carries marines (see boarding.go)
+}
+
+// Stock fields a recipe may draw on
+func recipeStock(c *Colony, res string) *int {
+	switch res {
+	case "iron":
+		return &c.Iron
+	case "steel":
+		return &c.Steel
+	case "platinum":
+		return &c.Platinum
+	case "diamond":
+		return &c.Diamond
+	case "gold":
+		return &c.Gold
+	}
+	return nil
+}
+
+func processModuleFactories(c *Colony, efficiencyMult float64) {
+	capacity := int(float64(c.Buildings["module_factory"])*efficiencyMult + 0.5)
+	if c.ModuleStock == nil {
+		c.ModuleStock = make(map[string]int)
+	}
+
+	for capacity > 0 && len(c.ModuleQueue) > 0 {
+		order := &c.ModuleQueue[0]
+		recipe := ModuleRecipes[order.Module]
+
+		for res, amt := range recipe {
+			if p := recipeStock(c, res); p == nil || *p < amt {
+				return // head of queue stalls until inputs arrive
+			}
+		}
+		for res, amt := range recipe {
+			*recipeStock(c, res) -= amt
+		}
+
+		c.ModuleStock[order.Module]++
+		order.Count--
+		if order.Count <= 0 {
+			c.ModuleQueue = c.ModuleQueue[1:]
+		}
+		capacity--
+	}
+}
+
+// Removes the listed modules from stock, or reports the first shortfall and leaves stock untouched
+func takeModules(stock map[string]int, modules []string) error {
+	need := make(map[string]int)
+	for _, m := range modules {
+		need[m]++
+	}
+	for m, n := range need {
+		if stock[m] < n {
+			return fmt.Errorf("Missing Modules: need %d %s, have %d", n, m, stock[m])
+		}
+	}
+	for m, n := range need {
+		stock[m] -= n
+		if stock[m] == 0 {
+			delete(stock, m)
+		}
+	}
+	return nil
+}
+
+func loadModuleStock(colonyID int) map[string]int {
+	var sJson string
+	db.QueryRow("SELECT COALESCE(module_stock_json, '{}') FROM colonies WHERE id=?", colonyID).Scan(&sJson)
+	stock := make(map[string]int)
+	json.Unmarshal([]byte(sJson), &stock)
+	return stock
+}
+
+// Appends modules to a colony's factory queue
+func handleQueueModules(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	var req struct {
+		ColonyID int    `json:"colony_id" validate:"required"`
+		Module   string `json:"module" validate:"required"`
+		Amount   int    `json:"amount" validate:"required"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	if _, ok := ModuleRecipes[req.Module]; !ok {
+		http.Error(w, "Unknown Module", 400)
+		return
+	}
+	if req.Amount <= 0 || req.Amount > 1000 {
+		http.Error(w, "Invalid Amount", 400)
+		return
+	}
+
+	defer lockRows(userRow(userID), colonyOwnerRow(req.ColonyID))()
+
+	var owner, bJson, qJson string
+	err = db.QueryRow("SELECT owner_uuid, buildings_json, COALESCE(module_queue_json, '[]') FROM colonies WHERE id=?", req.ColonyID).Scan(&owner, &bJson, &qJson)
+	if err != nil {
+		http.Error(w, "Colony Not Found", 404)
+		return
+	}
+	if !canManageColony(userID, req.ColonyID, owner) {
+		http.Error(w, "Access Denied", 403)
+		return
+	}
+
+	buildings := make(map[string]int)
+	json.Unmarshal([]byte(bJson), &buildings)
+	if buildings["module_factory"] < 1 {
+		http.Error(w, "Module Factory Required", 400)
+		return
+	}
+
+	var queue []ModuleOrder
+	json.Unmarshal([]byte(qJson), &queue)
+	if len(queue) >= 20 {
+		http.Error(w, "Queue Full", 400)
+		return
+	}
+	queue = append(queue, ModuleOrder{Module: req.Module, Count: req.Amount})
+	newQ, _ := json.Marshal(queue)
+	db.Exec("UPDATE colonies SET module_queue_json=? WHERE id=?", string(newQ), req.ColonyID)
+
+	w.Write([]byte(fmt.Sprintf("Queued %d %s", req.Amount, req.Module)))
+}
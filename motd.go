@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// --- Server Notice ---
+// Public nodes publish a message of the day, their rules (wipe schedule, conduct) and an
+// operator contact. Stored in system_meta, set with /admin/motd and served in /api/status so
+// clients can show it at login.
+
+const (
+	MaxMOTDLen    = 500
+	MaxRulesLen   = 4000
+	MaxContactLen = 200
+)
+
+type ServerNotice struct {
+	MOTD    string `json:"motd"`
+	Rules   string `json:"rules"`
+	Contact string `json:"contact"`
+}
+
+var (
+	notice        ServerNotice
+	noticeVersion int // bumped on every change; part of the /api/status cache key
+	noticeLock    sync.RWMutex
+)
+
+func loadNotice() {
+	var n ServerNotice
+	db.QueryRow("SELECT value FROM system_meta WHERE key='motd'").Scan(&n.MOTD)
+	db.QueryRow("SELECT value FROM system_meta WHERE key='rules'").Scan(&n.Rules)
+	db.QueryRow("SELECT value FROM system_meta WHERE key='contact'").Scan(&n.Contact)
+
+	noticeLock.Lock()
+	notice = n
+	noticeVersion++
+	noticeLock.Unlock()
+}
+
+func currentNotice() (ServerNotice, int) {
+	noticeLock.RLock()
+	defer noticeLock.RUnlock()
+	return notice, noticeVersion
+}
+
+func setNotice(n ServerNotice) {
+	db.Exec("INSERT OR REPLACE INTO system_meta (key, value) VALUES ('motd', ?)", n.MOTD)
+	db.Exec("INSERT OR REPLACE INTO system_meta (key, value) VALUES ('rules', ?)", n.Rules)
+	db.Exec("INSERT OR REPLACE INTO system_meta (key, value) VALUES ('contact', ?)", n.Contact)
+
+	noticeLock.Lock()
+	notice = n
+	noticeVersion++
+	noticeLock.Unlock()
+}
+
+// GET: the notice. POST {"motd", "rules", "contact"}: replace it.
+func handleAdminMOTD(w http.ResponseWriter, r *http.Request) {
+	if !authenticateAdmin(r) {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var req ServerNotice
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		if len(req.MOTD) > MaxMOTDLen || len(req.Rules) > MaxRulesLen || len(req.Contact) > MaxContactLen {
+			http.Error(w, fmt.Sprintf("Notice too long (motd %d, rules %d, contact %d bytes max)", MaxMOTDLen, MaxRulesLen, MaxContactLen), 400)
+			return
+		}
+		setNotice(req)
+		InfoLog.Printf("📢 Server notice updated")
+	}
+
+	n, _ := currentNotice()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(n)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// --- Star Names ---
+// Whoever first charts a system (the fleet that discovered it, or the settler whose homestead
+// created it) may name it once. Names are unique across the node, ride along with heartbeats
+// so peers pick them up, and are shown in scans and the map in place of sys-x-y-z.
+
+const (
+	MinStarNameLen = 3
+	MaxStarNameLen = 24
+
+	// Names given within this many ticks are re-gossiped on every heartbeat
+	NameGossipWindow = 1000
+	MaxGossipNames   = 20
+)
+
+// Letters, digits, spaces, hyphens and apostrophes; must start and end alphanumeric
+var starNameRegex = regexp.MustCompile(`^[A-Za-z0-9](?:[A-Za-z0-9 '\-]*[A-Za-z0-9])?$`)
+
+type SystemName struct {
+	SystemID   string `json:"system_id"`
+	Name       string `json:"name"`
+	Discoverer string `json:"discoverer"`
+	NamedTick  int64  `json:"named_tick"`
+}
+
+func validStarName(name string) error {
+	if len(name) < MinStarNameLen || len(name) > MaxStarNameLen {
+		return fmt.Errorf("name must be %d-%d characters", MinStarNameLen, MaxStarNameLen)
+	}
+	if !starNameRegex.MatchString(name) {
+		return fmt.Errorf("letters, digits, spaces, ' and - only")
+	}
+	if strings.Contains(name, "  ") {
+		return fmt.Errorf("no repeated spaces")
+	}
+	// Would be confused with raw identifiers
+	if strings.HasPrefix(strings.ToLower(name), "sys-") {
+		return fmt.Errorf("reserved prefix")
+	}
+	return nil
+}
+
+// Display label: the given name if any, otherwise the raw id
+func systemLabel(id, name string) string {
+	if name != "" {
+		return name
+	}
+	return id
+}
+
+// Records a peer's name for a system unless we already have one (first name wins)
+func applyGossipedName(n SystemName) bool {
+	if validStarName(n.Name) != nil {
+		return false
+	}
+	var x, y, z int
+	if c, _ := fmt.Sscanf(n.SystemID, "sys-%d-%d-%d", &x, &y, &z); c != 3 || !GetSectorData(x, y, z).HasSystem {
+		return false
+	}
+
+	db.Exec("INSERT OR IGNORE INTO solar_systems (id, type, x, y, z, owner_uuid, discoverer_uuid) VALUES (?, ?, ?, ?, ?, '', ?)",
+		n.SystemID, GetSectorData(x, y, z).SystemType, x, y, z, n.Discoverer)
+	res, err := db.Exec("UPDATE solar_systems SET name=?, named_tick=?, discoverer_uuid=COALESCE(NULLIF(discoverer_uuid, ''), ?) WHERE id=? AND (name IS NULL OR name='')",
+		n.Name, n.NamedTick, n.Discoverer, n.SystemID)
+	reindexSystem(n.SystemID)
+	if err != nil {
+		return false // name taken locally
+	}
+	changed, _ := res.RowsAffected()
+	return changed > 0
+}
+
+// Recently named systems to attach to the outgoing heartbeat
+func recentSystemNames(now int64) []SystemName {
+	var names []SystemName
+	rows, err := db.Query(`SELECT id, name, COALESCE(discoverer_uuid, ''), named_tick FROM solar_systems
+	                       WHERE name IS NOT NULL AND named_tick > ? ORDER BY named_tick DESC LIMIT ?`, now-NameGossipWindow, MaxGossipNames)
+	if err != nil {
+		return names
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var n SystemName
+		rows.Scan(&n.SystemID, &n.Name, &n.Discoverer, &n.NamedTick)
+		names = append(names, n)
+	}
+	return names
+}
+
+func handleNameSystem(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	var req struct {
+		SystemID string `json:"system_id" validate:"required"`
+		Name     string `json:"name" validate:"required"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if err := validStarName(req.Name); err != nil {
+		http.Error(w, "Invalid Name: "+err.Error(), 400)
+		return
+	}
+
+	defer lockRows(userRow(userID), "names")()
+
+	// Systems charted before discoverers were recorded fall back to their owner
+	var discoverer, current string
+	err = db.QueryRow("SELECT COALESCE(NULLIF(discoverer_uuid, ''), owner_uuid, ''), COALESCE(name, '') FROM solar_systems WHERE id=?", req.SystemID).Scan(&discoverer, &current)
+	if err != nil {
+		http.Error(w, "System Not Charted", 404)
+		return
+	}
+	if discoverer != userID {
+		http.Error(w, "Only the discoverer may name this system", 403)
+		return
+	}
+	if current != "" {
+		http.Error(w, "System already named "+current, 409)
+		return
+	}
+
+	tick := atomic.LoadInt64(&CurrentTick)
+	if _, err := db.Exec("UPDATE solar_systems SET name=?, named_tick=? WHERE id=?", req.Name, tick, req.SystemID); err != nil {
+		http.Error(w, "Name Taken", 409)
+		return
+	}
+	reindexSystem(req.SystemID)
+
+	InfoLog.Printf("✨ %s named %s", req.SystemID, req.Name)
+	w.Write([]byte(fmt.Sprintf("%s is now %s", req.SystemID, req.Name)))
+}
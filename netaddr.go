@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Peer Addresses ---
+// A node tells peers where to reach it in its handshake. That is OWNWORLD_PUBLIC_URL when the
+// operator sets it; otherwise the node can only claim localhost, which no peer can call back.
+// So handshake responses echo the host the request came from (observed_addr), and a node with
+// no configured address adopts the first routable echo as its advertised host, keeping its own
+// scheme and port. The receiving side does the same for the caller: a claimed address whose
+// host is loopback, unspecified or missing is rewritten to the host the handshake came from.
+//
+// An address is still only a claim until it answers. Admitted and restored peers start out
+// unreachable and are probed (their GET /api/status must return their UUID) before heartbeats
+// go to them; unreachable peers are probed again every PeerProbeInterval.
+
+const (
+	PeerProbeInterval = time.Minute
+	PeerProbeTimeout  = 5 * time.Second
+)
+
+var (
+	advertisedAddr  string
+	advertisedFixed bool // set by the operator; echoes don't override it
+	addrLock        sync.Mutex
+)
+
+func initAdvertisedAddr() {
+	addrLock.Lock()
+	defer addrLock.Unlock()
+	advertisedAddr = os.Getenv("OWNWORLD_PUBLIC_URL")
+	advertisedFixed = advertisedAddr != ""
+	if !advertisedFixed {
+		advertisedAddr = "http://localhost" + ListenAddr
+	}
+}
+
+// The address we give peers in handshakes
+func AdvertisedAddr() string {
+	addrLock.Lock()
+	defer addrLock.Unlock()
+	return advertisedAddr
+}
+
+// The host a request came from, as its sender can't be trusted to say
+func observedHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func unroutableHost(host string) bool {
+	if host == "" || strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && (ip.IsLoopback() || ip.IsUnspecified())
+}
+
+func parseAddr(addr string) (*url.URL, error) {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	return url.Parse(addr)
+}
+
+// addr with its host swapped for host, keeping scheme and port
+func withHost(addr, host string) string {
+	u, err := parseAddr(addr)
+	if err != nil || host == "" {
+		return addr
+	}
+	if port := u.Port(); port != "" {
+		u.Host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		u.Host = "[" + host + "]"
+	} else {
+		u.Host = host
+	}
+	return strings.TrimSuffix(u.String(), "/")
+}
+
+// Where to reach a peer that claims `claimed` and was seen at `observed`
+func peerAddress(claimed, observed string) string {
+	u, err := parseAddr(claimed)
+	if err == nil && !unroutableHost(u.Hostname()) {
+		return claimed
+	}
+	if unroutableHost(observed) {
+		return claimed
+	}
+	return withHost(claimed, observed)
+}
+
+// Adopts the host a peer saw us at, unless the operator configured an address or we already
+// advertise a routable one
+func learnObservedAddr(observed string) {
+	if unroutableHost(observed) {
+		return
+	}
+	addrLock.Lock()
+	defer addrLock.Unlock()
+	if advertisedFixed {
+		return
+	}
+	if u, err := parseAddr(advertisedAddr); err == nil && !unroutableHost(u.Hostname()) {
+		return
+	}
+	advertisedAddr = withHost(advertisedAddr, observed)
+	InfoLog.Printf("📡 Peers see us at %s; advertising %s (set OWNWORLD_PUBLIC_URL to override)", observed, advertisedAddr)
+}
+
+// Whether the node at addr answers as uuid
+func probeAddr(uuid, addr string) bool {
+	u, err := parseAddr(addr)
+	if err != nil {
+		return false
+	}
+	client := &http.Client{Timeout: PeerProbeTimeout}
+	resp, err := client.Get(strings.TrimSuffix(u.String(), "/") + "/api/status")
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	var status struct {
+		UUID string `json:"uuid"`
+	}
+	return resp.StatusCode == 200 && json.NewDecoder(resp.Body).Decode(&status) == nil && status.UUID == uuid
+}
+
+func probePeer(uuid, addr string) {
+	ok := probeAddr(uuid, addr)
+	peerLock.Lock()
+	defer peerLock.Unlock()
+	p, known := Peers[uuid]
+	if !known || p.Url != addr {
+		return
+	}
+	if ok != p.Reachable {
+		if ok {
+			InfoLog.Printf("📶 Peer %s answers at %s", uuid, addr)
+		} else {
+			InfoLog.Printf("📵 Peer %s doesn't answer at %s; holding gossip", uuid, addr)
+		}
+	}
+	p.Reachable, p.ProbedAt = ok, time.Now()
+}
+
+// Starts probes of the unreachable peers not probed within PeerProbeInterval
+func probeUnreachablePeers() {
+	now := time.Now()
+	peerLock.Lock()
+	defer peerLock.Unlock()
+	for _, p := range Peers {
+		if p.Reachable || now.Sub(p.ProbedAt) < PeerProbeInterval {
+			continue
+		}
+		p.ProbedAt = now // one probe in flight at a time
+		go probePeer(p.UUID, p.Url)
+	}
+}
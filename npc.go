@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	mrand "math/rand"
+	"sync/atomic"
+)
+
+// --- NPC Factions ---
+// NPC fleets are ordinary fleet rows owned by a reserved UUID, so the existing
+// combat and bombardment passes treat them like any other hostile owner.
+
+const (
+	PirateOwnerUUID = "NPC-PIRATE"
+
+	// Ticks at zero stability before the population revolts
+	RebellionCollapseTicks = 30
+	// How often idle pirate fleets move on to a new system
+	PirateRoamInterval = 10
+	// How far (per axis) pirates look for their next target
+	PirateRoamRadius = 50
+)
+
+// Splits a rebel fleet off a collapsed colony, taking a share of its people and stock.
+func spawnRebelFleet(c Colony) {
+	rebels := c.PopLaborers / 5
+	food := c.Food / 5
+	iron := c.Iron / 5
+	if rebels < 10 {
+		return
+	}
+
+	payload := FleetPayload{
+		PopLaborers: rebels,
+		Resources:   map[string]int{"food": food, "iron": iron},
+	}
+	payloadJson, _ := json.Marshal(payload)
+	modJson, _ := json.Marshal([]string{"laser", "laser", "booster"})
+
+	// No spawn this tick if the database won't take it; the colony is still collapsing next tick
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("UPDATE colonies SET pop_laborers=pop_laborers-?, food=food-?, iron=iron-? WHERE id=?", rebels, food, iron, c.ID); err != nil {
+		return
+	}
+	if _, err := tx.Exec(`INSERT INTO fleets (owner_uuid, status, fuel, origin_system, dest_system, hull_class, modules_json, payload_json, home_system)
+	         VALUES (?, 'ORBIT', 0, ?, ?, 'Fighter', ?, ?, '')`,
+		PirateOwnerUUID, c.SystemID, c.SystemID, string(modJson), string(payloadJson)); err != nil {
+		return
+	}
+	if tx.Commit() != nil {
+		return
+	}
+
+	InfoLog.Printf("🏴‍☠️ Colony %d collapsed. %d rebels seized ships and turned pirate in %s", c.ID, rebels, c.SystemID)
+}
+
+// Idle pirate fleets drift to a random known system nearby, carrying the hostility with them.
+func processPirateFleets() {
+	rows, err := db.Query("SELECT id, origin_system FROM fleets WHERE owner_uuid=? AND status='ORBIT'", PirateOwnerUUID)
+	if err != nil {
+		return
+	}
+
+	type pirate struct {
+		ID  int
+		Sys string
+	}
+	var pirates []pirate
+	for rows.Next() {
+		var p pirate
+		rows.Scan(&p.ID, &p.Sys)
+		pirates = append(pirates, p)
+	}
+	rows.Close()
+
+	for _, p := range pirates {
+		coords := GetSystemCoords(p.Sys)
+		var candidates []string
+		for _, s := range systemsInBox(
+			[3]int{coords[0] - PirateRoamRadius, coords[1] - PirateRoamRadius, coords[2] - PirateRoamRadius},
+			[3]int{coords[0] + PirateRoamRadius, coords[1] + PirateRoamRadius, coords[2] + PirateRoamRadius}) {
+			if s.ID != p.Sys {
+				candidates = append(candidates, s.ID)
+			}
+		}
+
+		if len(candidates) == 0 {
+			continue
+		}
+		target := candidates[mrand.Intn(len(candidates))]
+		_, travel := computeRoute(p.Sys, target, "", nil)
+		now := atomic.LoadInt64(&CurrentTick)
+		db.Exec(`UPDATE fleets SET status='TRANSIT', dest_system=?, departure_tick=?, arrival_tick=? WHERE id=?`,
+			target, now, now+travel, p.ID)
+		if DebugLog != nil {
+			DebugLog.Printf("Pirate fleet %d heading for %s", p.ID, target)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// --- Federation Outbox ---
+// Outbound transactions (grievances, reparation receipts, mutual defense reports) are queued
+// in federation_outbox, one row per peer, and delivered by a background worker with
+// exponential backoff until the peer acknowledges them. Each attempt is stamped with the tick
+// it is sent at, so a retry isn't refused as expired; the payload signature is unchanged, so a
+// peer that already applied it answers ACK_REPLAY and the row still counts as delivered.
+// Rows that run out of attempts become dead letters, listed by GET /admin/outbox, where an
+// operator can requeue them. A 4xx answer other than 408 or 429 won't change on retry (the peer
+// doesn't know us, or refuses the payload or signature), so it is dead-lettered at once. Heartbeats are not queued: each one supersedes the last.
+
+const (
+	MaxOutboxAttempts = 8
+	OutboxBackoffBase = 5 * time.Second
+	OutboxPollEvery   = 3 * time.Second
+	OutboxTimeout     = 2 * time.Second
+	OutboxRetention   = 24 * time.Hour // delivered rows are kept this long
+	OutboxDeadShown   = 50
+)
+
+type OutboxEntry struct {
+	ID          int    `json:"id"`
+	PeerUUID    string `json:"peer_uuid"`
+	Attempts    int    `json:"attempts"`
+	Status      string `json:"status"`
+	LastError   string `json:"last_error,omitempty"`
+	CreatedAt   int64  `json:"created_at"`
+	NextAttempt int64  `json:"next_attempt"`
+	Payload     string `json:"payload"`
+}
+
+// One delivery pass at a time
+var outboxLock sync.Mutex
+
+// Wakes the worker for a fresh broadcast instead of waiting out the poll
+var outboxWake = make(chan struct{}, 1)
+
+// Answers that retrying won't change; 408 (expired) and 429 (rate limited) may clear up
+func permanentOutboxFailure(status int) bool {
+	return status >= 400 && status < 500 && status != http.StatusRequestTimeout && status != http.StatusTooManyRequests
+}
+
+func kickOutbox() {
+	select {
+	case outboxWake <- struct{}{}:
+	default:
+	}
+}
+
+// Queues a signed payload for every peer we aren't at war with
+func enqueueTransaction(payload []byte) int {
+	peerLock.RLock()
+	type target struct{ UUID, URL string }
+	targets := make([]target, 0, len(Peers))
+	for _, p := range Peers {
+		if p.Relation != 2 {
+			targets = append(targets, target{p.UUID, p.Url})
+		}
+	}
+	peerLock.RUnlock()
+
+	now := time.Now().Unix()
+	for _, t := range targets {
+		db.Exec("INSERT INTO federation_outbox (peer_uuid, peer_url, payload, attempts, next_attempt, status, created_at) VALUES (?, ?, ?, 0, ?, 'pending', ?)",
+			t.UUID, t.URL, payload, now, now)
+	}
+	return len(targets)
+}
+
+// Queues a payload for one peer, whatever our relation (reparations go to nodes we may be at
+// war with) as part of tx, so it is only sent if the rest of tx commits
+func enqueueTransactionTo(tx *sql.Tx, peerUUID string, payload []byte) bool {
+	peerLock.RLock()
+	p, known := Peers[peerUUID]
+	url := ""
+	if known {
+		url = p.Url
+	}
+	peerLock.RUnlock()
+	if !known {
+		return false
+	}
+	now := time.Now().Unix()
+	_, err := tx.Exec("INSERT INTO federation_outbox (peer_uuid, peer_url, payload, attempts, next_attempt, status, created_at) VALUES (?, ?, ?, 0, ?, 'pending', ?)",
+		peerUUID, url, payload, now, now)
+	return err == nil
+}
+
+func runOutboxWorker() {
+	ticker := time.NewTicker(OutboxPollEvery)
+	defer ticker.Stop()
+	client := &http.Client{Timeout: OutboxTimeout}
+	for {
+		select {
+		case <-ticker.C:
+		case <-outboxWake:
+		}
+		deliverOutbox(client)
+	}
+}
+
+func deliverOutbox(client *http.Client) {
+	outboxLock.Lock()
+	defer outboxLock.Unlock()
+
+	now := time.Now()
+	db.Exec("DELETE FROM federation_outbox WHERE status='delivered' AND created_at < ?", now.Add(-OutboxRetention).Unix())
+
+	type delivery struct {
+		ID, Attempts int
+		Peer, URL    string
+		Payload      []byte
+	}
+	rows, err := db.Query("SELECT id, attempts, peer_uuid, peer_url, payload FROM federation_outbox WHERE status='pending' AND next_attempt <= ? ORDER BY id LIMIT 100", now.Unix())
+	if err != nil {
+		return
+	}
+	var batch []delivery
+	for rows.Next() {
+		var d delivery
+		rows.Scan(&d.ID, &d.Attempts, &d.Peer, &d.URL, &d.Payload)
+		batch = append(batch, d)
+	}
+	rows.Close()
+
+	for _, d := range batch {
+		peerLock.RLock()
+		p, known := Peers[d.Peer]
+		asProto := known && speaksProto(*p)
+		peerLock.RUnlock()
+		body, ct := encodeFederation(TransactionRequest{
+			UUID:      ServerUUID,
+			Tick:      atomic.LoadInt64(&CurrentTick),
+			Payload:   d.Payload,
+			Signature: SignMessage(PrivateKey, d.Payload),
+		}, asProto)
+		resp, err := postFederationAs(client, d.URL+"/federation/transaction", ct, body)
+		permanent := false
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode < 300 {
+				db.Exec("UPDATE federation_outbox SET status='delivered', attempts=attempts+1 WHERE id=?", d.ID)
+				continue
+			}
+			err = fmt.Errorf("HTTP %d", resp.StatusCode)
+			permanent = permanentOutboxFailure(resp.StatusCode)
+		}
+
+		attempts := d.Attempts + 1
+		if attempts >= MaxOutboxAttempts || permanent {
+			db.Exec("UPDATE federation_outbox SET status='dead', attempts=?, last_error=? WHERE id=?", attempts, err.Error(), d.ID)
+			ErrorLog.Printf("📭 Transaction %d to %s dead-lettered after %d attempts: %v", d.ID, d.URL, attempts, err)
+			continue
+		}
+		next := now.Add(OutboxBackoffBase * time.Duration(1<<uint(attempts-1))).Unix()
+		db.Exec("UPDATE federation_outbox SET attempts=?, next_attempt=?, last_error=? WHERE id=?", attempts, next, err.Error(), d.ID)
+	}
+}
+
+func outboxCounts() map[string]int {
+	counts := map[string]int{"pending": 0, "delivered": 0, "dead": 0}
+	rows, err := db.Query("SELECT status, count(*) FROM federation_outbox GROUP BY status")
+	if err != nil {
+		return counts
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var status string
+		var n int
+		rows.Scan(&status, &n)
+		counts[status] = n
+	}
+	return counts
+}
+
+func deadLetters(limit int) []OutboxEntry {
+	list := []OutboxEntry{}
+	rows, err := db.Query("SELECT id, peer_uuid, attempts, status, COALESCE(last_error, ''), created_at, next_attempt, payload FROM federation_outbox WHERE status='dead' ORDER BY id DESC LIMIT ?", limit)
+	if err != nil {
+		return list
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e OutboxEntry
+		var payload []byte
+		rows.Scan(&e.ID, &e.PeerUUID, &e.Attempts, &e.Status, &e.LastError, &e.CreatedAt, &e.NextAttempt, &payload)
+		e.Payload = string(payload)
+		list = append(list, e)
+	}
+	return list
+}
+
+// GET: queue counts and the latest dead letters.
+// POST {"id"} requeues one dead letter, or {"all": true} every one.
+func handleAdminOutbox(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	if !authenticateAdmin(r) {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var req struct {
+			ID  int  `json:"id"`
+			All bool `json:"all"`
+		}
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		now := time.Now().Unix()
+		var res sql.Result
+		var err error
+		if req.All {
+			res, err = db.Exec("UPDATE federation_outbox SET status='pending', attempts=0, next_attempt=? WHERE status='dead'", now)
+		} else {
+			res, err = db.Exec("UPDATE federation_outbox SET status='pending', attempts=0, next_attempt=? WHERE id=? AND status='dead'", now, req.ID)
+		}
+		if err != nil {
+			http.Error(w, "DB Error", 500)
+			return
+		}
+		n, _ := res.RowsAffected()
+		if n == 0 && !req.All {
+			http.Error(w, "Dead Letter Not Found", 404)
+			return
+		}
+		InfoLog.Printf("📬 Requeued %d dead-lettered transaction(s)", n)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"counts": outboxCounts(),
+		"dead":   deadLetters(OutboxDeadShown),
+	})
+}
@@ -0,0 +1,58 @@
+package main
+
+// --- Outposts ---
+// A colony sits on a system's planet, but a player who holds the planet can spread to the rest
+// of the system: a mining station on the asteroid belt, a base on a moon. Outposts are colonies
+// in their own right (same table, same colony API, same tick) marked by site_type and parented
+// to the planet colony. Each site takes one outpost per system and is founded like a colony, by
+// deploying a colony kit with "site_type". Outposts build only from their site's short list but
+// extract far more of what their site is rich in.
+
+const (
+	SitePlanet       = "planet"
+	SiteAsteroidBelt = "asteroid_belt"
+	SiteMoon         = "moon"
+)
+
+type OutpostSite struct {
+	Buildings []string           // the only structures an outpost here may build
+	Yield     map[string]float64 // extraction multiplier by resource
+}
+
+var OutpostSites = map[string]OutpostSite{
+	SiteAsteroidBelt: {
+		Buildings: []string{"iron_mine", "platinum_mine", "diamond_mine", "carbon_extractor", "urban_housing", "oxygen_plant", "solar_plant", "warehouse"},
+		Yield:     map[string]float64{"iron": 2.0, "platinum_ore": 3.0, "diamond_ore": 3.0, "carbon": 1.5},
+	},
+	SiteMoon: {
+		Buildings: []string{"iron_mine", "uranium_mine", "well", "greenhouse", "urban_housing", "oxygen_plant", "solar_plant", "warehouse", "defense_battery"},
+		Yield:     map[string]float64{"uranium_ore": 3.0, "iron": 1.5, "water": 2.0},
+	},
+}
+
+func validSite(site string) bool {
+	_, ok := OutpostSites[site]
+	return ok || site == SitePlanet
+}
+
+// Extraction multiplier for a resource at a colony's site; planets extract at the base rate
+func siteYield(site, resource string) float64 {
+	if m, ok := OutpostSites[site].Yield[resource]; ok {
+		return m
+	}
+	return 1.0
+}
+
+// Whether a structure may be built at the site
+func siteAllows(site, building string) bool {
+	s, ok := OutpostSites[site]
+	if !ok {
+		return true
+	}
+	for _, b := range s.Buildings {
+		if b == building {
+			return true
+		}
+	}
+	return false
+}
@@ -1,85 +1,96 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
-	"database/sql"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
-// setupTestEnv initializes an in-memory database and schema for isolated testing.
+// quietLogs discards log output for the duration of a test that reaches logging code paths.
+func quietLogs(t *testing.T) {
+	info, errs, debug := InfoLog, ErrorLog, DebugLog
+	discard := log.New(io.Discard, "", 0)
+	InfoLog, ErrorLog, DebugLog = discard, discard, discard
+	t.Cleanup(func() { InfoLog, ErrorLog, DebugLog = info, errs, debug })
+}
+
+// setupTestEnv opens an in-memory database with the real schema. Fixtures go through applySeed.
 func setupTestEnv(t *testing.T) {
+	quietLogs(t)
+	saved := db
 	var err error
-	// Use :memory: to avoid touching the real database on disk
-	db, err = sql.Open("sqlite", ":memory:")
+	// One connection: every new :memory: connection would be a separate, empty database
+	db, err = openDB("sqlite3", ":memory:", 1)
 	if err != nil {
 		t.Fatalf("Failed to open test database: %v", err)
 	}
-
-	// Manually apply schema here to avoid "undefined: createSchema" build errors
-	// if db.go is not picked up correctly by the test runner.
-	schema := `
-	CREATE TABLE IF NOT EXISTS system_meta (key TEXT PRIMARY KEY, value TEXT);
-	CREATE TABLE IF NOT EXISTS users (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		global_uuid TEXT UNIQUE,
-		username TEXT, password_hash TEXT,
-		credits INTEGER DEFAULT 0, is_local BOOLEAN DEFAULT 1,
-		ed25519_pubkey TEXT
-	);
-	CREATE TABLE IF NOT EXISTS solar_systems (
-		id TEXT PRIMARY KEY, x INTEGER, y INTEGER, z INTEGER,
-		star_type TEXT, owner_uuid TEXT, tax_rate REAL DEFAULT 0.0, is_federated BOOLEAN DEFAULT 0
-	);
-	CREATE TABLE IF NOT EXISTS planets (
-		id INTEGER PRIMARY KEY AUTOINCREMENT, system_id TEXT, efficiency_seed TEXT, type TEXT,
-		FOREIGN KEY(system_id) REFERENCES solar_systems(id)
-	);
-	CREATE TABLE IF NOT EXISTS colonies (
-		id INTEGER PRIMARY KEY AUTOINCREMENT, system_id TEXT, owner_uuid TEXT, name TEXT,
-		pop_laborers INTEGER DEFAULT 100, pop_specialists INTEGER DEFAULT 0, pop_elites INTEGER DEFAULT 0,
-		food INTEGER DEFAULT 1000, water INTEGER DEFAULT 1000, iron INTEGER DEFAULT 0,
-		carbon INTEGER DEFAULT 0, gold INTEGER DEFAULT 0, platinum INTEGER DEFAULT 0,
-		uranium INTEGER DEFAULT 0, diamond INTEGER DEFAULT 0, vegetation INTEGER DEFAULT 0,
-		oxygen INTEGER DEFAULT 1000, fuel INTEGER DEFAULT 0,
-		stability_current REAL DEFAULT 100.0, stability_target REAL DEFAULT 100.0,
-		martial_law BOOLEAN DEFAULT 0, buildings_json TEXT
-	);
-	CREATE TABLE IF NOT EXISTS fleets (
-		id INTEGER PRIMARY KEY AUTOINCREMENT, owner_uuid TEXT, status TEXT,
-		origin_system TEXT, dest_system TEXT, departure_tick INTEGER, arrival_tick INTEGER,
-		ark_ship INTEGER DEFAULT 0, fighters INTEGER DEFAULT 0, frigates INTEGER DEFAULT 0,
-		haulers INTEGER DEFAULT 0, fuel INTEGER DEFAULT 0, start_coords TEXT, dest_coords TEXT
-	);
-	CREATE TABLE IF NOT EXISTS transaction_log (
-		id INTEGER PRIMARY KEY AUTOINCREMENT, tick INTEGER, action_type TEXT, payload_blob BLOB
-	);
-	CREATE TABLE IF NOT EXISTS daily_snapshots (
-		day_id INTEGER PRIMARY KEY, state_blob BLOB, final_hash TEXT
-	);
-	`
-	if _, err := db.Exec(schema); err != nil {
+	if err := createSchema(); err != nil {
 		t.Fatalf("Failed to create schema: %v", err)
 	}
+	loadGalaxyIndex()
+	t.Cleanup(func() {
+		db.Close()
+		db = saved
+	})
 
 	// We can skip initIdentity for simple logic tests or mock it if needed
-	// initIdentity() 
 	ServerUUID = "test-server-uuid"
 }
 
+// seed applies fixtures or fails the test
+func seed(t *testing.T, s Seed) *SeedResult {
+	t.Helper()
+	res, err := applySeed(s)
+	if err != nil {
+		t.Fatalf("Seed failed: %v", err)
+	}
+	return res
+}
+
 // Helper to make JSON requests
 func executeRequest(handler http.HandlerFunc, method, path string, payload interface{}) *httptest.ResponseRecorder {
+	return executeAuthedRequest(handler, method, path, payload, SeedSession{})
+}
+
+// Same, signed in as a seeded user
+func executeAuthedRequest(handler http.HandlerFunc, method, path string, payload interface{}, as SeedSession) *httptest.ResponseRecorder {
 	var body []byte
 	if payload != nil {
 		body, _ = json.Marshal(payload)
 	}
 	req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
 	req.Header.Set("Content-Type", "application/json")
-	
+	if as.UserUUID != "" {
+		req.Header.Set("X-User-UUID", as.UserUUID)
+		req.Header.Set("X-Session-Token", as.Token)
+	}
+
 	rr := httptest.NewRecorder()
 	handler.ServeHTTP(rr, req)
 	return rr
@@ -97,20 +108,19 @@ func TestHomesteadStart(t *testing.T) {
 	rr := executeRequest(handleRegister, "POST", "/api/register", payload)
 
 	if rr.Code != 200 {
-		t.Errorf("Registration failed. Code: %d, Body: %s", rr.Code, rr.Body.String())
+		t.Fatalf("Registration failed. Code: %d, Body: %s", rr.Code, rr.Body.String())
 	}
 
 	// Verify User
-	var count int
-	db.QueryRow("SELECT count(*) FROM users WHERE username='CommanderShepard'").Scan(&count)
-	if count != 1 {
-		t.Errorf("User not created in DB")
+	var userUUID string
+	if err := db.QueryRow("SELECT global_uuid FROM users WHERE username='CommanderShepard'").Scan(&userUUID); err != nil {
+		t.Fatalf("User not created in DB: %v", err)
 	}
 
 	// Verify Colony
 	var colID int
 	var pop int
-	err := db.QueryRow("SELECT id, pop_laborers FROM colonies WHERE owner_uuid='CommanderShepard'").Scan(&colID, &pop)
+	err := db.QueryRow("SELECT id, pop_laborers FROM colonies WHERE owner_uuid=?", userUUID).Scan(&colID, &pop)
 	if err != nil {
 		t.Errorf("Homestead colony not created: %v", err)
 	}
@@ -118,68 +128,84 @@ func TestHomesteadStart(t *testing.T) {
 		t.Errorf("Wrong starting population. Expected 1000, got %d", pop)
 	}
 
-	// CRITICAL: Verify Starting Fleet is a SCOUT, not an Ark
-	var arkCount, fighters int
-	err = db.QueryRow("SELECT ark_ship, fighters FROM fleets WHERE owner_uuid='CommanderShepard'").Scan(&arkCount, &fighters)
+	// Starting fleet is a Colonizer hull carrying a colony kit, not a legacy Ark
+	var arkCount int
+	var hull, modules string
+	err = db.QueryRow("SELECT ark_ship, hull_class, modules_json FROM fleets WHERE owner_uuid=?", userUUID).Scan(&arkCount, &hull, &modules)
 	if err != nil {
-		t.Errorf("Starting fleet not created")
+		t.Fatalf("Starting fleet not created: %v", err)
 	}
 	if arkCount != 0 {
 		t.Errorf("Start Error: Player given free Ark Ship! (Expected 0)")
 	}
-	if fighters != 1 {
-		t.Errorf("Start Error: Player not given Scout (Fighter).")
+	if hull != "Colonizer" || !strings.Contains(modules, "colony_kit") {
+		t.Errorf("Start Error: Expected a Colonizer with a colony kit, got %s %s", hull, modules)
 	}
 }
 
-// Test 2: Infrastructure Gate (Building Shipyard & Constructing Ark)
+// Test 2: Infrastructure Gate (Building Shipyard & Laying Down a Hull)
 func TestShipyardConstruction(t *testing.T) {
 	setupTestEnv(t)
 
-	db.Exec("INSERT INTO users (username, credits) VALUES ('BuilderBob', 1000)")
-	db.Exec("INSERT INTO solar_systems (id, x, y, z) VALUES ('sys-1', 0, 0, 0)")
-	
-	res, _ := db.Exec(`INSERT INTO colonies (system_id, owner_uuid, name, iron, carbon, food, fuel, pop_laborers, buildings_json) 
-		VALUES ('sys-1', 'BuilderBob', 'BobPrime', 10000, 5000, 10000, 1000, 500, '{}')`)
-	colID, _ := res.LastInsertId()
+	fx := seed(t, Seed{
+		Users: []SeedUser{{Username: "BuilderBob", Credits: 1000, Techs: []string{"ftl_theory"}}},
+		Colonies: []SeedColony{{
+			SystemID: "sys-1-0-0", Owner: "BuilderBob", Name: "BobPrime", Laborers: 500,
+			Resources: map[string]int{"iron": 10000, "carbon": 5000, "food": 10000, "fuel": 1000},
+			Modules:   map[string]int{"warp_drive": 2, "colony_kit": 1},
+			Buildings: map[string]int{"pilot_academy": 1},
+		}},
+	})
+	bob := fx.Users["BuilderBob"]
+	colID := fx.Colonies[0]
 
 	reqConstruct := map[string]interface{}{
-		"colony_id": colID,
-		"unit":      "ark_ship",
-		"amount":    1,
+		"colony_id":  colID,
+		"hull_class": "Colonizer",
+		"modules":    []string{"warp_drive", "warp_drive", "colony_kit"},
 	}
-	rr := executeRequest(handleConstruct, "POST", "/api/construct", reqConstruct)
+	rr := executeAuthedRequest(handleConstruct, "POST", "/api/construct", reqConstruct, bob)
 	if rr.Code != 400 {
-		t.Errorf("Security Flaw: Allowed Ark construction without Shipyard! Code: %d", rr.Code)
+		t.Errorf("Security Flaw: Allowed construction without Shipyard! Code: %d", rr.Code)
 	}
 
 	reqBuild := map[string]interface{}{
-		"colony_id": int(colID),
+		"colony_id": colID,
 		"structure": "shipyard",
 		"amount":    1,
 	}
-	rr = executeRequest(handleBuild, "POST", "/api/build", reqBuild)
+	rr = executeAuthedRequest(handleBuild, "POST", "/api/build", reqBuild, bob)
 	if rr.Code != 200 {
 		t.Fatalf("Build Shipyard failed: %s", rr.Body.String())
 	}
 
-	rr = executeRequest(handleConstruct, "POST", "/api/construct", reqConstruct)
+	rr = executeAuthedRequest(handleConstruct, "POST", "/api/construct", reqConstruct, bob)
 	if rr.Code != 200 {
-		t.Errorf("Construction failed with valid resources and shipyard: %s", rr.Body.String())
+		t.Fatalf("Construction failed with valid resources and shipyard: %s", rr.Body.String())
 	}
 
-	var iron, food, fuel, pop int
-	db.QueryRow("SELECT iron, food, fuel, pop_laborers FROM colonies WHERE id=?", colID).Scan(&iron, &food, &fuel, &pop)
-	
-	if iron != 4000 { t.Errorf("Resource Iron incorrect. Got %d, Expected 4000", iron) }
-	if food != 5000 { t.Errorf("Resource Food incorrect. Got %d, Expected 5000", food) }
-	if fuel != 500 { t.Errorf("Resource Fuel incorrect. Got %d, Expected 500", fuel) }
-	if pop != 400 { t.Errorf("Crew deduction incorrect. Got %d, Expected 400", pop) }
+	// Shipyard: 2000 iron + 500 carbon. Hull: 1000 iron + 50 crew; modules come from stock.
+	var iron, carbon, pop int
+	var stock string
+	db.QueryRow("SELECT iron, carbon, pop_laborers, module_stock_json FROM colonies WHERE id=?", colID).Scan(&iron, &carbon, &pop, &stock)
 
-	var arkCount int
-	db.QueryRow("SELECT ark_ship FROM fleets WHERE owner_uuid='BuilderBob' AND status='ORBIT'").Scan(&arkCount)
-	if arkCount != 1 {
-		t.Errorf("Ark Fleet not found in DB.")
+	if iron != 7000 {
+		t.Errorf("Resource Iron incorrect. Got %d, Expected 7000", iron)
+	}
+	if carbon != 4500 {
+		t.Errorf("Resource Carbon incorrect. Got %d, Expected 4500", carbon)
+	}
+	if pop != 450 {
+		t.Errorf("Crew deduction incorrect. Got %d, Expected 450", pop)
+	}
+	if strings.Contains(stock, `"colony_kit":1`) {
+		t.Errorf("Modules not drawn from stock: %s", stock)
+	}
+
+	var building int
+	db.QueryRow("SELECT count(*) FROM fleets WHERE owner_uuid=? AND status='CONSTRUCTING'", bob.UserUUID).Scan(&building)
+	if building != 1 {
+		t.Errorf("Hull not laid down in DB.")
 	}
 }
 
@@ -187,25 +213,26 @@ func TestShipyardConstruction(t *testing.T) {
 func TestDeployment(t *testing.T) {
 	setupTestEnv(t)
 
-	db.Exec("INSERT INTO users (username) VALUES ('ExplorerAlice')")
-	db.Exec("INSERT INTO solar_systems (id) VALUES ('sys-new')")
-	
-	res, _ := db.Exec(`INSERT INTO fleets (owner_uuid, status, origin_system, dest_system, ark_ship) 
-		VALUES ('ExplorerAlice', 'ORBIT', 'sys-new', 'sys-new', 1)`)
-	fleetID, _ := res.LastInsertId()
+	fx := seed(t, Seed{
+		Users:   []SeedUser{{Username: "ExplorerAlice"}},
+		Systems: []SeedSystem{{ID: "sys-5-5-5"}},
+		Fleets:  []SeedFleet{{Owner: "ExplorerAlice", System: "sys-5-5-5", HullClass: "Colonizer", Modules: []string{"colony_kit"}}},
+	})
+	alice := fx.Users["ExplorerAlice"]
+	fleetID := fx.Fleets[0]
 
 	payload := map[string]interface{}{
-		"fleet_id": int(fleetID),
+		"fleet_id": fleetID,
 		"name":     "Alice New World",
 	}
-	rr := executeRequest(handleDeploy, "POST", "/api/deploy", payload)
+	rr := executeAuthedRequest(handleDeploy, "POST", "/api/deploy", payload, alice)
 
 	if rr.Code != 200 {
 		t.Fatalf("Deployment failed: %s", rr.Body.String())
 	}
 
 	var count int
-	db.QueryRow("SELECT count(*) FROM colonies WHERE system_id='sys-new' AND owner_uuid='ExplorerAlice'").Scan(&count)
+	db.QueryRow("SELECT count(*) FROM colonies WHERE system_id='sys-5-5-5' AND owner_uuid=?", alice.UserUUID).Scan(&count)
 	if count != 1 {
 		t.Errorf("New colony record not found.")
 	}
@@ -213,7 +240,7 @@ func TestDeployment(t *testing.T) {
 	var fleetCount int
 	db.QueryRow("SELECT count(*) FROM fleets WHERE id=?", fleetID).Scan(&fleetCount)
 	if fleetCount != 0 {
-		t.Errorf("Logic Error: Ark Ship fleet was NOT deleted after deployment.")
+		t.Errorf("Logic Error: Colonizer fleet was NOT deleted after deployment.")
 	}
 }
 
@@ -221,22 +248,4932 @@ func TestDeployment(t *testing.T) {
 func TestDeploymentConflict(t *testing.T) {
 	setupTestEnv(t)
 
-	db.Exec("INSERT INTO solar_systems (id) VALUES ('sys-taken')")
-	db.Exec("INSERT INTO users (username) VALUES ('Occupant')")
-	db.Exec("INSERT INTO colonies (system_id, owner_uuid) VALUES ('sys-taken', 'Occupant')")
-
-	db.Exec("INSERT INTO users (username) VALUES ('Invader')")
-	res, _ := db.Exec(`INSERT INTO fleets (owner_uuid, status, origin_system, ark_ship) 
-		VALUES ('Invader', 'ORBIT', 'sys-taken', 1)`)
-	fleetID, _ := res.LastInsertId()
+	fx := seed(t, Seed{
+		Users:    []SeedUser{{Username: "Occupant"}, {Username: "Invader"}},
+		Colonies: []SeedColony{{SystemID: "sys-6-6-6", Owner: "Occupant", Name: "Home"}},
+		Fleets:   []SeedFleet{{Owner: "Invader", System: "sys-6-6-6", HullClass: "Colonizer", Modules: []string{"colony_kit"}}},
+	})
 
 	payload := map[string]interface{}{
-		"fleet_id": int(fleetID),
+		"fleet_id": fx.Fleets[0],
 		"name":     "Invader Base",
 	}
-	rr := executeRequest(handleDeploy, "POST", "/api/deploy", payload)
+	rr := executeAuthedRequest(handleDeploy, "POST", "/api/deploy", payload, fx.Users["Invader"])
 
-	if rr.Code != 409 { 
+	if rr.Code != 409 {
 		t.Errorf("Security Fail: Allowed colonization of occupied system! Code: %d", rr.Code)
 	}
+
+	// Landings in a system are serialized on it, so two players can't both pass the site check
+	race := seed(t, Seed{
+		Users: []SeedUser{{Username: "RacerA"}, {Username: "RacerB"}},
+		Fleets: []SeedFleet{
+			{Owner: "RacerA", System: "sys-7-7-7", HullClass: "Colonizer", Modules: []string{"colony_kit"}},
+			{Owner: "RacerB", System: "sys-7-7-7", HullClass: "Colonizer", Modules: []string{"colony_kit"}},
+		},
+	})
+	unlock := lockRows(systemRow("sys-7-7-7"))
+	codes := make(chan int, 2)
+	for i, name := range []string{"RacerA", "RacerB"} {
+		go func(fleet int, as SeedSession) {
+			codes <- executeAuthedRequest(handleDeploy, "POST", "/api/deploy", map[string]interface{}{"fleet_id": fleet, "name": "Landfall"}, as).Code
+		}(race.Fleets[i], race.Users[name])
+	}
+	select {
+	case code := <-codes:
+		t.Fatalf("Expected landings to wait for the system, one finished with %d", code)
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	a, b := <-codes, <-codes
+	var settled int
+	db.QueryRow("SELECT count(*) FROM colonies WHERE system_id='sys-7-7-7'").Scan(&settled)
+	if settled != 1 || a+b != 200+409 {
+		t.Errorf("Expected exactly one colony from a simultaneous landing, got %d (%d, %d)", settled, a, b)
+	}
+}
+
+// Test 5: Delta Snapshots reconstruct the full state
+func TestSnapshotDeltaRoundTrip(t *testing.T) {
+	prev := []Colony{
+		{ID: 1, Name: "Alpha", Iron: 100},
+		{ID: 2, Name: "Beta", Iron: 200},
+		{ID: 3, Name: "Gamma", Iron: 300},
+	}
+	curr := []Colony{
+		{ID: 1, Name: "Alpha", Iron: 100},
+		{ID: 3, Name: "Gamma", Iron: 350},
+		{ID: 4, Name: "Delta", Iron: 10},
+	}
+
+	delta := buildSnapshotDelta(7, prev, curr)
+	if len(delta.Changed) != 2 || len(delta.Removed) != 1 || delta.Removed[0] != 2 {
+		t.Fatalf("Unexpected delta: %+v", delta)
+	}
+
+	rebuilt := applySnapshotDelta(prev, delta)
+	want, _ := json.Marshal(curr)
+	got, _ := json.Marshal(rebuilt)
+	if !bytes.Equal(want, got) {
+		t.Errorf("Delta did not reconstruct state.\nWant: %s\nGot:  %s", want, got)
+	}
+}
+
+// Test 6: Battles replay identically and escorts shield unarmed haulers
+func TestBattleDeterminismAndEscorts(t *testing.T) {
+	fleets := func() []Fleet {
+		return []Fleet{
+			{ID: 1, OwnerUUID: "raider", HullClass: "Fighter", Modules: []string{"railgun", "railgun", "laser", "laser"}},
+			{ID: 2, OwnerUUID: "trader", HullClass: "Frigate", Modules: []string{"booster"}},
+			{ID: 3, OwnerUUID: "trader", HullClass: "Frigate", Modules: []string{"laser"}},
+		}
+	}
+
+	a := resolveBattle("sys-1-2-3", fleets(), 42)
+	b := resolveBattle("sys-1-2-3", fleets(), 42)
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	if !bytes.Equal(ja, jb) {
+		t.Fatalf("Same inputs produced different battles:\n%s\n%s", ja, jb)
+	}
+
+	// The escort breaks off mid-battle and only then does the hauler take fire
+	if a.Participants[2].Outcome != "withdrew" || a.Participants[1].EndHP >= a.Participants[1].StartHP {
+		t.Errorf("Expected the escort to withdraw and the hauler to be hit after it, got %+v", a.Participants)
+	}
+
+	// An escort that holds keeps the hauler untouched for the whole battle
+	held := fleets()
+	held[0].Modules = []string{"laser"}
+	held[2].Modules = []string{"laser", "laser"}
+	h := resolveBattle("sys-1-2-3", held, 42)
+	if h.Participants[2].Outcome != "held" || h.Participants[1].EndHP != h.Participants[1].StartHP {
+		t.Errorf("Hauler took fire while its escort was still holding: %+v", h.Participants)
+	}
+}
+
+// Test 7: Hostile worlds breathe, breathable ones don't, and suffocation compounds
+func TestLifeSupportSpiral(t *testing.T) {
+	c := Colony{PopLaborers: 1000, PopSpecialists: 100}
+	if need := oxygenDemand(&c, 0.9); need != 0 {
+		t.Errorf("Breathable world should need no oxygen, got %d", need)
+	}
+	if need := oxygenDemand(&c, 0.0); need != 22 {
+		t.Errorf("Expected 22 oxygen on a lethal world, got %d", need)
+	}
+
+	lost := []int{}
+	for i := 1; i <= 3; i++ {
+		before := c.PopLaborers
+		c.AirlessTicks = i
+		applyLifeSupportFailure(&c)
+		lost = append(lost, before-c.PopLaborers)
+	}
+	if !(lost[0] < lost[1] && lost[1] < lost[2]) {
+		t.Errorf("Losses should accelerate each airless tick, got %v", lost)
+	}
+}
+
+// Test 8: Credit Gini is 0 for equal balances and approaches 1 for a single holder
+func TestGiniCoefficient(t *testing.T) {
+	if g := giniCoefficient([]int64{100, 100, 100, 100}); g != 0 {
+		t.Errorf("Equal balances should have Gini 0, got %f", g)
+	}
+	if g := giniCoefficient([]int64{0, 0, 0, 1000}); g < 0.74 || g > 0.76 {
+		t.Errorf("One holder of four should have Gini 0.75, got %f", g)
+	}
+	if g := giniCoefficient(nil); g != 0 {
+		t.Errorf("No accounts should have Gini 0, got %f", g)
+	}
+}
+
+// Test 9: Signed federation envelopes verify for known peers and reject tampering
+func TestFederationEnvelope(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	PrivateKey, PublicKey, ServerUUID = priv, pub, "node-a"
+	Peers["node-a"] = &Peer{UUID: "node-a", PublicKey: pub}
+	defer delete(Peers, "node-a")
+
+	body := []byte("payload")
+	req, _ := newFederationRequest("POST", "http://peer/federation/transaction", body)
+	if err := verifyFederationRequest(req, body); err != nil {
+		t.Fatalf("Valid envelope rejected: %v", err)
+	}
+	if err := verifyFederationRequest(req, []byte("tampered")); err == nil {
+		t.Error("Tampered body was accepted")
+	}
+
+	req.Header.Set(HeaderFedNode, "stranger")
+	if err := verifyFederationRequest(req, body); err == nil {
+		t.Error("Unknown peer was accepted")
+	}
+}
+
+// Test 10: Module factories work through the queue and stall without inputs
+func TestModuleFactoryQueue(t *testing.T) {
+	c := Colony{
+		Buildings: map[string]int{"module_factory": 2},
+		Iron:      1000, Steel: 100, Diamond: 10,
+		ModuleQueue: []ModuleOrder{{Module: "laser", Count: 3}, {Module: "booster", Count: 1}},
+	}
+
+	processModuleFactories(&c, 1.0)
+	if c.ModuleStock["laser"] != 2 || c.Iron != 600 || c.Steel != 60 {
+		t.Fatalf("Expected 2 lasers from 2 factories, got stock %v iron %d steel %d", c.ModuleStock, c.Iron, c.Steel)
+	}
+
+	c.Diamond = 0
+	processModuleFactories(&c, 1.0)
+	if c.ModuleStock["laser"] != 2 || c.ModuleStock["booster"] != 0 {
+		t.Errorf("Queue head should stall without diamonds, got %v", c.ModuleStock)
+	}
+
+	if err := takeModules(c.ModuleStock, []string{"laser", "laser", "laser"}); err == nil {
+		t.Error("Took 3 lasers from a stock of 2")
+	}
+	if err := takeModules(c.ModuleStock, []string{"laser", "laser"}); err != nil || len(c.ModuleStock) != 0 {
+		t.Errorf("Expected stock to empty, got %v (%v)", c.ModuleStock, err)
+	}
+}
+
+// Test 11: Status is cached per tick and answers conditional GETs with 304
+func TestStatusConditionalGet(t *testing.T) {
+	rr := httptest.NewRecorder()
+	handleStatus(rr, httptest.NewRequest("GET", "/api/status", nil))
+	etag := rr.Header().Get("ETag")
+	if rr.Code != 200 || etag == "" {
+		t.Fatalf("Expected 200 with ETag, got %d %q", rr.Code, etag)
+	}
+
+	req := httptest.NewRequest("GET", "/api/status", nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	handleStatus(rr, req)
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for matching ETag, got %d", rr.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/api/status", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr = httptest.NewRecorder()
+	handleStatus(rr, req)
+	if rr.Header().Get("Content-Encoding") != "gzip" {
+		t.Error("Expected a gzip body when the client accepts it")
+	}
+}
+
+// Test 12: Only remote, unhappy, non-capital colonies build towards independence
+func TestIndependenceUnrest(t *testing.T) {
+	capital := capitalInfo{ColonyID: 1, Pos: []int{0, 0, 0}}
+	far := []int{30, 0, 0}
+
+	c := Colony{ID: 2, OwnerUUID: "empire", StabilityCurrent: 5}
+	if !independenceUnrest(&c, far, capital, true) {
+		t.Error("Remote unhappy colony should be restless")
+	}
+	if independenceUnrest(&c, []int{5, 0, 0}, capital, true) {
+		t.Error("Core world should not secede")
+	}
+	c.StabilityCurrent = 60
+	if independenceUnrest(&c, far, capital, true) {
+		t.Error("Stable colony should not secede")
+	}
+	capitalCol := Colony{ID: 1, OwnerUUID: "empire", StabilityCurrent: 0}
+	if independenceUnrest(&capitalCol, far, capital, true) {
+		t.Error("The capital cannot secede from itself")
+	}
+}
+
+// Test 13: Webhook signatures are HMAC-SHA256 over the exact body
+func TestWebhookSignature(t *testing.T) {
+	body := []byte(`{"event":"fleet_arrival"}`)
+	sig := signWebhook("secret", body)
+	if !strings.HasPrefix(sig, "sha256=") || len(sig) != len("sha256=")+64 {
+		t.Fatalf("Unexpected signature format: %s", sig)
+	}
+	if sig != signWebhook("secret", body) {
+		t.Error("Signature should be deterministic")
+	}
+	if sig == signWebhook("other", body) || sig == signWebhook("secret", []byte(`{"event":"order_filled"}`)) {
+		t.Error("Signature must depend on both secret and body")
+	}
+}
+
+// Test 14: Stored keys decrypt only with the right password and sign verifiable actions
+func TestKeyCustody(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	enc := encryptKey(priv, "hunter2")
+
+	if _, err := decryptKey(enc, "wrong"); err == nil {
+		t.Fatal("Wrong password should not decrypt the key")
+	}
+	key, err := decryptKey(enc, "hunter2")
+	if err != nil || !bytes.Equal(key, priv) {
+		t.Fatalf("Round trip failed: %v", err)
+	}
+
+	userID := hashBLAKE3(pub)
+	sig := signAction(key, []byte(`{"action":"launch"}`))
+	if !verifyActionSignature(userID, pub, []byte(`{"action":"launch"}`), sig) {
+		t.Error("Valid action signature rejected")
+	}
+	if verifyActionSignature(userID, pub, []byte(`{"action":"burn"}`), sig) {
+		t.Error("Signature accepted for a different payload")
+	}
+	if VerifySignature(pub, []byte(`{"action":"launch"}`), sig) {
+		t.Error("Action signatures must be domain-separated from raw messages")
+	}
+}
+
+// Test 15: Bombers hit their chosen category, batteries spoil the aim, housing kills civilians
+func TestBombardmentTargeting(t *testing.T) {
+	base := map[string]int{"iron_mine": 10, "urban_housing": 10, "defense_battery": 2}
+	copyOf := func(m map[string]int) map[string]int {
+		out := make(map[string]int)
+		for k, v := range m {
+			out[k] = v
+		}
+		return out
+	}
+
+	a := planBombardment(copyOf(base), TargetIndustry, 10, 5000, battleRNG("sys", 1))
+	b := planBombardment(copyOf(base), TargetIndustry, 10, 5000, battleRNG("sys", 1))
+	if a.Destroyed["iron_mine"] != b.Destroyed["iron_mine"] || a.Casualties != b.Casualties {
+		t.Error("Strike should be deterministic for the same seed")
+	}
+	if a.OnTarget+a.Collateral != 10 {
+		t.Errorf("Expected 10 structures lost, got %d", a.OnTarget+a.Collateral)
+	}
+	if bombAccuracy(2) >= bombAccuracy(0) || bombAccuracy(100) != MinBombAccuracy {
+		t.Error("Batteries should lower accuracy down to the floor")
+	}
+
+	// Only housing left standing: every bomb is a civilian strike
+	buildings := map[string]int{"urban_housing": 3}
+	rep := planBombardment(buildings, TargetDefenses, 5, 150, battleRNG("sys", 2))
+	if rep.Collateral != 3 || buildings["urban_housing"] != 0 {
+		t.Errorf("Expected 3 collateral housing hits, got %+v", rep)
+	}
+	if rep.Casualties != 150 {
+		t.Errorf("Casualties should be capped by population, got %d", rep.Casualties)
+	}
+	military := planBombardment(map[string]int{"defense_battery": 3}, TargetDefenses, 3, 150, battleRNG("sys", 3))
+	if military.Infamy >= rep.Infamy {
+		t.Error("Civilian strikes should carry more infamy than military ones")
+	}
+}
+
+// Test 16: The federation graph merges peer-exchange edges and counts partitions
+func TestFederationGraph(t *testing.T) {
+	ServerUUID = "self"
+	peers := []Peer{
+		{UUID: "a", Relation: 1, Neighbors: []string{"self", "b"}},
+		{UUID: "c", Relation: 1, Neighbors: []string{"d"}},
+	}
+	g := buildFederationGraph(peers)
+	if len(g.Nodes) != 5 {
+		t.Errorf("Expected 5 nodes (self, a, c and second-hand b, d), got %d", len(g.Nodes))
+	}
+	if len(g.Edges) != 4 {
+		t.Errorf("Expected 4 distinct edges, got %d", len(g.Edges))
+	}
+	if g.Components != 1 {
+		t.Errorf("Everything is reachable through self, got %d components", g.Components)
+	}
+
+	nodes := []GraphNode{{UUID: "x"}, {UUID: "y"}, {UUID: "z"}}
+	if n := countComponents(nodes, []GraphEdge{{From: "x", To: "y"}}); n != 2 {
+		t.Errorf("Expected a partition into 2 components, got %d", n)
+	}
+}
+
+// Test 17: Each shipyard is a parallel slot working ShipyardThroughput tons per tick
+func TestShipyardSlots(t *testing.T) {
+	tons := shipTonnage("Fighter", []string{"laser", "laser"})
+	queue := []shipBuild{{1, tons}, {2, tons}, {3, tons}}
+
+	ticks := 0
+	finished := 0
+	for finished < 2 {
+		finished += len(advanceShipyard(queue, 2))
+		ticks++
+	}
+	if ticks != buildTicks(tons) {
+		t.Errorf("Two yards should finish two hulls in %d ticks, took %d", buildTicks(tons), ticks)
+	}
+	if queue[2].Remaining != tons {
+		t.Error("Third hull should still be waiting for a slot")
+	}
+	if len(advanceShipyard([]shipBuild{{4, tons}}, 0)) != 0 {
+		t.Error("No shipyard, no progress")
+	}
+}
+
+// Test 18: Trading post levels raise order limits and cut listing fees
+func TestTradingPostFees(t *testing.T) {
+	if listingFee(1, 10000) != 500 {
+		t.Errorf("Level 1 fee should be 5%%, got %d", listingFee(1, 10000))
+	}
+	if listingFee(3, 10000) >= listingFee(1, 10000) {
+		t.Error("Higher level should be cheaper")
+	}
+	if listingFee(50, 10000) != 100 {
+		t.Errorf("Fee should floor at 1%%, got %d", listingFee(50, 10000))
+	}
+	if listingFee(1, 3) != 1 {
+		t.Error("Tiny orders still pay a minimal fee")
+	}
+	if orderLimit(2) <= orderLimit(1) {
+		t.Error("Order limit should grow with level")
+	}
+}
+
+// Test 19: The parallel colony tick produces exactly what a serial one does, in order
+func TestParallelColonyTick(t *testing.T) {
+	var jobs []colonyJob
+	for i := 1; i <= 300; i++ {
+		c := Colony{
+			ID: i, OwnerUUID: fmt.Sprintf("owner-%d", i%7),
+			PopLaborers: 1000 + i, Food: 50 * i, Water: 500, Iron: 1000, StabilityCurrent: float64(i % 100),
+			Buildings: map[string]int{"farm": i % 5, "steel_mill": i % 3, "urban_housing": 10},
+			Policies:  map[string]bool{"subsidized_housing": i%4 == 0},
+		}
+		jobs = append(jobs, colonyJob{Colony: c, TaxRate: 0.01, Pos: []int{i, 0, 0}})
+	}
+	env := &tickEnv{CultureByID: map[int]float64{}, CultureByOwner: map[string]float64{}, Capitals: map[string]capitalInfo{}}
+
+	saved := TickWorkers
+	defer func() { TickWorkers = saved }()
+
+	TickWorkers = 1
+	serial := runColonyJobs(jobs, env)
+	TickWorkers = 8
+	parallel := runColonyJobs(jobs, env)
+
+	if len(serial) != len(jobs) || len(parallel) != len(jobs) {
+		t.Fatalf("Expected %d results, got %d / %d", len(jobs), len(serial), len(parallel))
+	}
+	for i := range serial {
+		if serial[i].Update != parallel[i].Update || len(serial[i].Credits) != len(parallel[i].Credits) {
+			t.Fatalf("Colony %d differs between serial and parallel runs", jobs[i].Colony.ID)
+		}
+		if parallel[i].Update.ID != jobs[i].Colony.ID {
+			t.Fatalf("Result %d out of order", i)
+		}
+	}
+}
+
+// Test 20: Failed logins back off exponentially and lock the account
+func TestLoginBackoff(t *testing.T) {
+	for i := 0; i < LoginFreeAttempts; i++ {
+		if loginBackoff(i) != 0 {
+			t.Errorf("Attempt %d should not be delayed", i)
+		}
+	}
+	if loginBackoff(LoginFreeAttempts+1) != 2*loginBackoff(LoginFreeAttempts) {
+		t.Error("Backoff should double per failure")
+	}
+	if loginBackoff(60) != LoginBackoffMax {
+		t.Error("Backoff should be capped")
+	}
+
+	now := time.Unix(1_000_000, 0)
+	s := LoginStatus{Failures: LoginFreeAttempts + 1, LastFailure: now.Unix()}
+	if w := loginWait(s, now); w != loginBackoff(LoginFreeAttempts+1) {
+		t.Errorf("Expected full backoff right after a failure, got %v", w)
+	}
+	if loginWait(s, now.Add(time.Hour)) != 0 {
+		t.Error("Backoff should expire")
+	}
+	s.LockedUntil = now.Add(LoginLockoutDuration).Unix()
+	if loginWait(s, now.Add(time.Minute)) != LoginLockoutDuration-time.Minute {
+		t.Error("Lockout should hold until it expires")
+	}
+}
+
+// Test 21: Perishables spoil unless warehoused, and cold storage slows it
+func TestSpoilage(t *testing.T) {
+	if spoilage(10000, 0.01, 0, 0) != 100 {
+		t.Errorf("Expected 100 lost, got %d", spoilage(10000, 0.01, 0, 0))
+	}
+	if spoilage(10000, 0.01, 1, 0) != 80 {
+		t.Errorf("A warehouse should shelter %d units", WarehouseShelter)
+	}
+	if spoilage(1500, 0.01, 1, 0) != 0 {
+		t.Error("Fully warehoused stock should not spoil")
+	}
+	if spoilage(10000, 0.01, 0, 2) != 60 {
+		t.Errorf("Two cold storages should cut decay by 40%%, got %d", spoilage(10000, 0.01, 0, 2))
+	}
+	if spoilage(10000, 0.01, 0, 50) != 20 {
+		t.Error("Cold storage cut should be capped")
+	}
+}
+
+// Test 22: The clock follows the peer median, not a single outlier
+func TestClockReference(t *testing.T) {
+	now := time.Unix(1_000_000, 0)
+	peers := []Peer{
+		{UUID: "a", Reputation: 20, LastTick: 100, LastSeen: now},
+		{UUID: "b", Reputation: 20, LastTick: 101, LastSeen: now},
+		{UUID: "c", Reputation: 20, LastTick: 99, LastSeen: now},
+		{UUID: "evil", Reputation: 20, LastTick: 1_000_000, LastSeen: now},
+		{UUID: "hostile", Reputation: 20, Relation: 2, LastTick: 5, LastSeen: now},
+		{UUID: "stale", Reputation: 20, LastTick: 1, LastSeen: now.Add(-time.Hour)},
+		{UUID: "untrusted", Reputation: 1, LastTick: 1, LastSeen: now},
+	}
+	ref, votes := clockReference(peers, now, 60000)
+	if votes != 4 {
+		t.Errorf("Expected 4 eligible voters, got %d", votes)
+	}
+	if ref != 100 {
+		t.Errorf("Median should ignore the outlier, got %d", ref)
+	}
+
+	// A heartbeat heard two ticks ago is projected forward
+	late := []Peer{{Reputation: 20, LastTick: 100, LastSeen: now.Add(-20 * time.Second)}}
+	if ref, _ := clockReference(late, now, 10000); ref != 102 {
+		t.Errorf("Expected projection to 102, got %d", ref)
+	}
+	if medianTick([]int64{4, 1, 3, 2}) != 2 {
+		t.Error("Even-sized median should average the middle pair")
+	}
+}
+
+// Test 23: Contracts track partial deliveries and split escrow on failure
+func TestContractDelivery(t *testing.T) {
+	required := map[string]int{"iron": 1000, "carbon": 500}
+	delivered := map[string]int{}
+
+	cargo := map[string]int{"iron": 600, "food": 100}
+	moved := applyDelivery(required, delivered, cargo)
+	if moved["iron"] != 600 || cargo["iron"] != 0 || cargo["food"] != 100 {
+		t.Errorf("Unexpected first delivery: moved %v, cargo %v", moved, cargo)
+	}
+	if contractComplete(required, delivered) {
+		t.Error("Contract should still be open")
+	}
+
+	cargo = map[string]int{"iron": 900, "carbon": 500}
+	applyDelivery(required, delivered, cargo)
+	if cargo["iron"] != 500 || !contractComplete(required, delivered) {
+		t.Errorf("Only the remaining 400 iron should be taken, cargo left %v", cargo)
+	}
+
+	// 750 of 1500 units delivered: half the reward to the contractor
+	toContractor, toIssuer := failedContractPayout(1000, 200, required, map[string]int{"iron": 750})
+	if toContractor != 500 || toIssuer != 700 {
+		t.Errorf("Expected 500/700 split, got %d/%d", toContractor, toIssuer)
+	}
+}
+
+// Test 24: Every statement runs under a deadline and timeouts are counted
+func TestDBTimeouts(t *testing.T) {
+	d, err := openDB("sqlite3", ":memory:", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if _, err := d.Exec("CREATE TABLE t (v INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	d.Exec("INSERT INTO t (v) VALUES (42)")
+	var v int
+	if err := d.QueryRow("SELECT v FROM t").Scan(&v); err != nil || v != 42 {
+		t.Fatalf("Round trip failed: %v %d", err, v)
+	}
+
+	ctx, cancel := deadlineCtx(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, ok := ctx.Deadline(); !ok {
+		t.Fatal("Expected a deadline")
+	}
+	<-ctx.Done()
+
+	// A handler's reads end with its request, its writes don't
+	gone, hangUp := context.WithCancel(context.Background())
+	hangUp()
+	if err := d.WithContext(gone).QueryRow("SELECT v FROM t").Scan(&v); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected a cancelled request's query to fail, got %v", err)
+	}
+	if _, err := d.WithContext(gone).Exec("INSERT INTO t (v) VALUES (1)"); err != nil {
+		t.Errorf("Expected a cancelled request's write to go through, got %v", err)
+	}
+	tx, err := d.WithContext(gone).Begin()
+	if err != nil {
+		t.Fatalf("Expected a cancelled request's transaction to begin, got %v", err)
+	}
+	tx.Exec("INSERT INTO t (v) VALUES (2)")
+	if err := tx.Commit(); err != nil {
+		t.Errorf("Expected a cancelled request's transaction to commit, got %v", err)
+	}
+
+	before := atomic.LoadInt64(&dbMetrics.QueryTimeouts)
+	noteDBResult(time.Now(), fmt.Errorf("wrapped: %w", ctx.Err()), &dbMetrics.QueryTimeouts, "SELECT 1")
+	if atomic.LoadInt64(&dbMetrics.QueryTimeouts) != before+1 {
+		t.Error("Timeout should be counted")
+	}
+}
+
+// Test 25: Star names are moderated and the first gossiped name wins
+func TestStarNames(t *testing.T) {
+	for _, bad := range []string{"ab", "Sys-1-2-3", "Nova  Prime", "-Nova", "Nova<script>", strings.Repeat("a", 25)} {
+		if validStarName(bad) == nil {
+			t.Errorf("%q should be rejected", bad)
+		}
+	}
+	if err := validStarName("Kepler's Rest-2"); err != nil {
+		t.Errorf("Valid name rejected: %v", err)
+	}
+
+	setupTestEnv(t)
+	savedGenesis := GenesisHash
+	defer func() { GenesisHash = savedGenesis }()
+	GenesisHash = "naming-test"
+	var ids []string
+	for x := 0; len(ids) < 2; x++ {
+		if GetSectorData(x, 0, 0).HasSystem {
+			ids = append(ids, fmt.Sprintf("sys-%d-0-0", x))
+		}
+	}
+
+	if !applyGossipedName(SystemName{SystemID: ids[0], Name: "Avalon", Discoverer: "u1", NamedTick: 5}) {
+		t.Fatal("First name should be recorded")
+	}
+	if applyGossipedName(SystemName{SystemID: ids[0], Name: "Camelot", Discoverer: "u2", NamedTick: 6}) {
+		t.Error("A named system must keep its first name")
+	}
+	if applyGossipedName(SystemName{SystemID: ids[1], Name: "AVALON", NamedTick: 7}) {
+		t.Error("Names must be unique regardless of case")
+	}
+	if applyGossipedName(SystemName{SystemID: "sys-9999-0-0", Name: "Nowhere"}) {
+		t.Error("Names for sectors without a star must be ignored")
+	}
+
+	names := recentSystemNames(10)
+	if len(names) != 1 || names[0].Name != "Avalon" || names[0].Discoverer != "u1" {
+		t.Errorf("Unexpected gossip payload: %+v", names)
+	}
+}
+
+// Test 26: Fleet manifests report leg progress and classify modules
+func TestFleetManifestHelpers(t *testing.T) {
+	cases := []struct {
+		dep, arr, now int64
+		want          float64
+	}{
+		{100, 200, 50, 0},
+		{100, 200, 150, 0.5},
+		{100, 200, 250, 1},
+		{100, 100, 100, 1},
+	}
+	for _, c := range cases {
+		if got := legProgress(c.dep, c.arr, c.now); got != c.want {
+			t.Errorf("legProgress(%d, %d, %d) = %v, want %v", c.dep, c.arr, c.now, got, c.want)
+		}
+	}
+
+	for mod, slot := range map[string]string{"warp_drive": "engine", "railgun": "weapon", "bomb_bay": "special", "probe_scanner": "special"} {
+		if got := moduleSlot(mod); got != slot {
+			t.Errorf("%s: got slot %s, want %s", mod, got, slot)
+		}
+	}
+}
+
+// Test 27: Peer standing and keys survive a restart
+func TestPeerRegistryPersistence(t *testing.T) {
+	setupTestEnv(t)
+	savedPeers := Peers
+	defer func() { Peers = savedPeers }()
+
+	allyPub, _, _ := ed25519.GenerateKey(nil)
+	foePub, _, _ := ed25519.GenerateKey(nil)
+	otherPub, _, _ := ed25519.GenerateKey(nil)
+	now := time.Now()
+	savePeer(&Peer{UUID: "ally", Url: "http://ally", PublicKey: allyPub, Relation: 1, Reputation: 42, Features: []string{"invasions"}, FirstSeen: now, LastSeen: now})
+	savePeer(&Peer{UUID: "foe", Url: "http://foe", PublicKey: foePub, Relation: 2, Reputation: -60, FirstSeen: now, LastSeen: now})
+
+	// "Restart": empty working set, reload from the table
+	Peers = make(map[string]*Peer)
+	loadPeers()
+	ally, ok := Peers["ally"]
+	if !ok || ally.Relation != 1 || ally.Reputation != 42 || !ally.PublicKey.Equal(allyPub) || len(ally.Features) != 1 {
+		t.Fatalf("Ally not restored: %+v", ally)
+	}
+
+	if err := checkStoredPeer("foe", foePub); err == nil {
+		t.Error("A banned node must not be readmitted")
+	}
+	if err := checkStoredPeer("ally", otherPub); err == nil {
+		t.Error("A known UUID presenting a new key must be refused")
+	}
+	if err := checkStoredPeer("stranger", otherPub); err != nil {
+		t.Errorf("Unknown nodes are vetted as before: %v", err)
+	}
+
+	returning := &Peer{UUID: "ally", Relation: 0, Reputation: 10}
+	restoreStanding(returning)
+	if returning.Relation != 1 || returning.Reputation != 42 {
+		t.Errorf("Alliance should carry over: %+v", returning)
+	}
+}
+
+// Test 28: Visitors pay tolls into the treasury, capped at what they hold
+func TestTolls(t *testing.T) {
+	setupTestEnv(t)
+	defer setTolls(TollSchedule{})
+	fx := seed(t, Seed{
+		Users:    []SeedUser{{Username: "settler", Credits: 1000}, {Username: "visitor", Credits: 30}},
+		Systems:  []SeedSystem{{ID: "sys-1-1-1", Owner: ServerUUID}, {ID: "sys-2-2-2", Owner: "peer"}},
+		Colonies: []SeedColony{{SystemID: "sys-1-1-1", Owner: "settler"}},
+	})
+	settler, visitor := fx.Users["settler"].UserUUID, fx.Users["visitor"].UserUUID
+
+	if tollable(settler, "sys-1-1-1") || !tollable(visitor, "sys-1-1-1") || tollable(visitor, "sys-2-2-2") {
+		t.Error("Only visitors without a colony in our own systems are tollable")
+	}
+
+	setTolls(TollSchedule{Transit: 50, TradePct: 0.1})
+	loadTolls()
+	if got := currentTolls(); got.Transit != 50 || got.TradePct != 0.1 {
+		t.Errorf("Schedule did not round-trip: %+v", got)
+	}
+
+	chargeTransitToll(Fleet{ID: 1, OwnerUUID: visitor}, "sys-1-1-1")
+	var left int
+	db.QueryRow("SELECT credits FROM users WHERE global_uuid=?", visitor).Scan(&left)
+	if left != 0 || treasuryBalance() != 30 {
+		t.Errorf("Expected the visitor's 30 credits in the treasury, got %d left and %d collected", left, treasuryBalance())
+	}
+
+	if fee := tradeToll(1234, 0.1); fee != 123 {
+		t.Errorf("Expected 123 credit trade toll, got %d", fee)
+	}
+}
+
+// Test 29: Conversion contracts refine a customer's ore on the refiner's lines
+func TestConversionContracts(t *testing.T) {
+	setupTestEnv(t)
+	fx := seed(t, Seed{
+		Users: []SeedUser{{Username: "refiner"}, {Username: "miner", Credits: 1000}},
+		Colonies: []SeedColony{{SystemID: "sys-3-3-3", Owner: "refiner", Name: "Forge",
+			Buildings: map[string]int{"platinum_refinery": 2}}},
+		Fleets: []SeedFleet{{Owner: "miner", System: "sys-3-3-3",
+			Payload: FleetPayload{Resources: map[string]int{"platinum_ore": 30}}}},
+	})
+	refiner, miner := fx.Users["refiner"], fx.Users["miner"]
+	colID, fleetID := fx.Colonies[0], fx.Fleets[0]
+
+	offer := map[string]interface{}{"colony_id": colID, "building": "platinum_refinery", "lines": 3, "fee": 5, "ticks": 100}
+	if rr := executeAuthedRequest(handleConversions, "POST", "/api/contracts/conversion", offer, refiner); rr.Code != 409 {
+		t.Errorf("Expected 409 offering more lines than buildings, got %d", rr.Code)
+	}
+	offer["lines"] = 1
+	rr := executeAuthedRequest(handleConversions, "POST", "/api/contracts/conversion", offer, refiner)
+	if rr.Code != 200 {
+		t.Fatalf("Offer failed: %d %s", rr.Code, rr.Body.String())
+	}
+	var c ConversionContract
+	json.Unmarshal(rr.Body.Bytes(), &c)
+
+	rr = executeAuthedRequest(handleDeliverConversion, "POST", "/api/contracts/conversion/deliver",
+		map[string]interface{}{"id": c.ID, "fleet_id": fleetID}, miner)
+	if rr.Code != 200 {
+		t.Fatalf("Delivery failed: %d %s", rr.Code, rr.Body.String())
+	}
+	var credits int
+	db.QueryRow("SELECT credits FROM users WHERE global_uuid=?", miner.UserUUID).Scan(&credits)
+	if credits != 850 {
+		t.Errorf("Expected 150 credits of fee escrowed, miner has %d", credits)
+	}
+
+	var busy map[int]map[string]int
+	for i := 0; i < 3; i++ {
+		busy = processConversions(c.CreatedTick + 1)
+	}
+	if busy[colID]["platinum_refinery"] != 1 {
+		t.Errorf("Expected one refinery line busy, got %v", busy)
+	}
+	c, _ = loadConversion(c.ID)
+	if c.Hopper != 21 || c.Refined != 3 {
+		t.Errorf("Expected 21 ore left and 3 platinum after 3 ticks, got %d/%d", c.Hopper, c.Refined)
+	}
+	db.QueryRow("SELECT credits FROM users WHERE global_uuid=?", refiner.UserUUID).Scan(&credits)
+	if credits != 45 {
+		t.Errorf("Expected the refiner paid 45 credits, got %d", credits)
+	}
+
+	// The busy line is taken out of the colony's own production
+	col := Colony{ID: colID, Buildings: map[string]int{"platinum_refinery": 2}, PlatinumOre: 6}
+	processIndustry(&col, 1.0, busy[colID])
+	if col.PlatinumOre != 3 {
+		t.Errorf("Expected the colony to refine on one line only, %d ore left", col.PlatinumOre)
+	}
+
+	// Expiry refunds the unprocessed fee and hands back the ore with the platinum
+	processConversions(c.DeadlineTick + 1)
+	db.QueryRow("SELECT credits FROM users WHERE global_uuid=?", miner.UserUUID).Scan(&credits)
+	if credits != 955 {
+		t.Errorf("Expected 105 credits refunded, miner has %d", credits)
+	}
+	rr = executeAuthedRequest(handleCollectConversion, "POST", "/api/contracts/conversion/collect",
+		map[string]interface{}{"id": c.ID, "fleet_id": fleetID}, miner)
+	var moved map[string]int
+	json.Unmarshal(rr.Body.Bytes(), &moved)
+	if moved["platinum"] != 3 || moved["platinum_ore"] != 21 {
+		t.Errorf("Expected 3 platinum and 21 ore collected, got %v", moved)
+	}
+	if c, _ = loadConversion(c.ID); c.Status != ConversionClosed {
+		t.Errorf("Expected a closed contract, got %s", c.Status)
+	}
+}
+
+// Test 30: Grudges fade, clean streaks earn faster and history is kept
+func TestReputationDynamics(t *testing.T) {
+	setupTestEnv(t)
+	savedPeers := Peers
+	defer func() { Peers = savedPeers }()
+
+	p := &Peer{UUID: "drifter", Reputation: 10}
+	Peers = map[string]*Peer{p.UUID: p}
+
+	if penalizePeer(p, 20, "grievance") || p.Reputation != -10 || p.Grudge != 20 {
+		t.Fatalf("Expected -10 reputation and a 20 point grudge, got %+v", p)
+	}
+	for i := 0; i < 100; i++ {
+		forgiveGrievances()
+	}
+	if p.Grudge >= 20*0.4 || p.Reputation+p.Grudge < 9.999 || p.Reputation+p.Grudge > 10.001 {
+		t.Errorf("Expected most of the grudge forgiven back into reputation, got %.2f rep / %.2f grudge", p.Reputation, p.Grudge)
+	}
+
+	if heartbeatGain(0) != RepModel.Gain || heartbeatGain(10*RepModel.StreakRounds) != RepModel.Gain*RepModel.MaxMult {
+		t.Error("Streak multiplier should start at 1 and cap at MaxMult")
+	}
+	creditHeartbeat(p)
+	if p.CleanStreak != 1 {
+		t.Errorf("Expected a 1 heartbeat streak, got %d", p.CleanStreak)
+	}
+	if penalizePeer(p, 100, "grievance"); p.CleanStreak != 0 {
+		t.Error("A grievance should reset the streak")
+	}
+
+	hostile := &Peer{UUID: "foe", Relation: 2, Reputation: -80, Grudge: 10}
+	Peers[hostile.UUID] = hostile
+	forgiveGrievances()
+	creditHeartbeat(hostile)
+	if hostile.Reputation != -80 || hostile.Grudge != 10 {
+		t.Errorf("Hostile peers neither heal nor earn: %+v", hostile)
+	}
+
+	rr := executeRequest(handlePeerReputation, "GET", "/api/federation/reputation?uuid=drifter", nil)
+	var out struct {
+		History []ReputationPoint `json:"history"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &out)
+	if rr.Code != 200 || len(out.History) != 2 || out.History[0].Reason != "grievance" {
+		t.Errorf("Expected two grievance rows, got %d %+v", rr.Code, out.History)
+	}
+}
+
+// Test 31: /api/v2 adapts v1 handlers; /api/v1 is an alias
+func TestAPIVersions(t *testing.T) {
+	setupTestEnv(t)
+	savedPeers := Peers
+	defer func() { Peers = savedPeers }()
+	Peers = map[string]*Peer{"a": {UUID: "a"}, "b": {UUID: "b"}, "c": {UUID: "c"}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/contracts", handleContracts)
+	mux.HandleFunc("/api/federation/peers", handleListPeers)
+	mux.HandleFunc("/api/ack", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("Done")) })
+	mux.HandleFunc("/api/v1/", versionedAPI(mux, "v1"))
+	mux.HandleFunc("/api/v2/", versionedAPI(mux, "v2"))
+
+	rr := executeRequest(mux.ServeHTTP, "GET", "/api/v2/contracts", nil)
+	var e struct {
+		Error V2Error `json:"error"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &e)
+	if rr.Code != 401 || e.Error.Code != "unauthorized" || e.Error.Message != "Unauthorized" {
+		t.Errorf("Expected a structured 401, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr = executeRequest(mux.ServeHTTP, "GET", "/api/v2/federation/peers?limit=2", nil)
+	var page V2Page
+	json.Unmarshal(rr.Body.Bytes(), &page)
+	if len(page.Items) != 2 || page.Total != 3 || page.NextOffset == nil || *page.NextOffset != 2 {
+		t.Errorf("Expected a 2 of 3 page, got %s", rr.Body.String())
+	}
+
+	rr = executeRequest(mux.ServeHTTP, "POST", "/api/v2/ack", nil)
+	if !strings.Contains(rr.Body.String(), `"message":"Done"`) {
+		t.Errorf("Expected a JSON acknowledgement, got %s", rr.Body.String())
+	}
+
+	// v1, with or without the prefix, is untouched
+	if rr := executeRequest(mux.ServeHTTP, "GET", "/api/v1/contracts", nil); rr.Code != 401 || strings.TrimSpace(rr.Body.String()) != "Unauthorized" {
+		t.Errorf("v1 errors must stay plain text, got %s", rr.Body.String())
+	}
+	if rr := executeRequest(mux.ServeHTTP, "GET", "/api/federation/peers", nil); !strings.HasPrefix(rr.Body.String(), "[") {
+		t.Errorf("v1 lists must stay bare arrays, got %s", rr.Body.String())
+	}
+}
+
+// Test 32: Famine relief buys rations at a markup, capped by the owner's credits
+func TestFamineRelief(t *testing.T) {
+	setupTestEnv(t)
+	fx := seed(t, Seed{
+		Users:    []SeedUser{{Username: "farmer"}},
+		Colonies: []SeedColony{{SystemID: "sys-4-4-4", Owner: "farmer"}, {SystemID: "sys-5-5-5", Owner: "farmer"}},
+	})
+	relief, plain := fx.Colonies[0], fx.Colonies[1]
+	price := famineUnitPrice(relief)
+	if price < 1 {
+		t.Fatalf("Relief food must cost something, got %d", price)
+	}
+	db.Exec("UPDATE users SET credits=? WHERE global_uuid=?", price*200, fx.Users["farmer"].UserUUID)
+	db.Exec("UPDATE colonies SET food=0, policies_json=? WHERE id=?", `{"famine_relief": true}`, relief)
+	db.Exec("UPDATE colonies SET food=0 WHERE id=?", plain)
+
+	processFamineRelief(1)
+
+	var food, credits int
+	db.QueryRow("SELECT food FROM colonies WHERE id=?", relief).Scan(&food)
+	db.QueryRow("SELECT credits FROM users WHERE global_uuid=?", fx.Users["farmer"].UserUUID).Scan(&credits)
+	if food != 200 || credits != 0 {
+		t.Errorf("Expected 200 food bought with every credit (rations want %d), got %d food and %d credits left", famineRations(1000, nil), food, credits)
+	}
+	db.QueryRow("SELECT food FROM colonies WHERE id=?", plain).Scan(&food)
+	if food != 0 {
+		t.Errorf("Colonies without the policy must not be supplied, got %d food", food)
+	}
+}
+
+// Test 33: Distance from a designated capital costs corruption; admin offices relieve it
+func TestCapitalCorruption(t *testing.T) {
+	setupTestEnv(t)
+	fx := seed(t, Seed{
+		Users: []SeedUser{{Username: "emperor"}},
+		Colonies: []SeedColony{
+			{SystemID: "sys-0-0-0", Owner: "emperor", Name: "Core"},
+			{SystemID: "sys-60-0-0", Owner: "emperor", Name: "Rim", Buildings: map[string]int{"admin_office": 2}},
+		},
+	})
+	emperor := fx.Users["emperor"]
+	core, rim := fx.Colonies[0], fx.Colonies[1]
+
+	capital, ok := loadCapitals()[emperor.UserUUID]
+	if !ok || capital.ColonyID != core {
+		t.Fatalf("Expected the oldest colony as the default capital, got %+v", capital)
+	}
+	far := Colony{ID: rim, OwnerUUID: emperor.UserUUID, PopLaborers: 1000, Buildings: map[string]int{}}
+	if got := corruption(&far, []int{60, 0, 0}, capital, true); math.Abs(got-0.4) > 1e-9 {
+		t.Errorf("Expected 40%% corruption 40 units beyond the radius, got %.3f", got)
+	}
+	far.Buildings["admin_office"] = 2
+	if got := corruption(&far, []int{60, 0, 0}, capital, true); math.Abs(got-0.32) > 1e-9 {
+		t.Errorf("Expected two admin offices to cut it to 32%%, got %.3f", got)
+	}
+	if got := corruption(&far, []int{10, 0, 0}, capital, true); got != 0 {
+		t.Errorf("Expected no corruption inside the command radius, got %.3f", got)
+	}
+
+	rr := executeAuthedRequest(handleCapital, "POST", "/api/colony/capital", map[string]int{"colony_id": rim}, emperor)
+	if rr.Code != 200 || loadCapitals()[emperor.UserUUID].ColonyID != rim {
+		t.Fatalf("Capital move failed: %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := executeAuthedRequest(handleCapital, "POST", "/api/colony/capital", map[string]int{"colony_id": core}, emperor); rr.Code != 429 {
+		t.Errorf("Expected a cooldown on moving again, got %d", rr.Code)
+	}
+}
+
+// Test 34: Bulk orders are placed all or nothing
+func TestBulkOrders(t *testing.T) {
+	setupTestEnv(t)
+	fx := seed(t, Seed{
+		Users:    []SeedUser{{Username: "trader", Credits: 1000}},
+		Colonies: []SeedColony{{SystemID: "sys-6-6-6", Owner: "trader", Buildings: map[string]int{"trading_post": 1}}},
+	})
+	trader := fx.Users["trader"]
+	order := func(qty int) MarketOrder {
+		return MarketOrder{Item: "iron", Quantity: qty, Price: 10, OriginSystem: "sys-6-6-6"}
+	}
+	count := func() (n int) {
+		db.QueryRow("SELECT count(*) FROM market_orders WHERE seller_uuid=?", trader.UserUUID).Scan(&n)
+		return n
+	}
+
+	rr := executeAuthedRequest(handleBulkOrders, "POST", "/api/market/bulk",
+		map[string][]MarketOrder{"orders": {order(100), order(200), order(300)}}, trader)
+	var res BulkOrderResult
+	json.Unmarshal(rr.Body.Bytes(), &res)
+	if rr.Code != 200 || len(res.OrderIDs) != 3 || res.Fee != 300 || count() != 3 {
+		t.Fatalf("Expected 3 orders for a 300 credit fee, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	// A level 1 post carries 5 orders; the third of this batch breaks the limit
+	rr = executeAuthedRequest(handleBulkOrders, "POST", "/api/market/bulk",
+		map[string][]MarketOrder{"orders": {order(1), order(1), order(1)}}, trader)
+	if rr.Code != 429 || !strings.HasPrefix(rr.Body.String(), "Order 2:") || count() != 3 {
+		t.Errorf("Expected the whole batch refused at order 2, got %d %s (%d orders)", rr.Code, rr.Body.String(), count())
+	}
+
+	rr = executeAuthedRequest(handleBulkOrders, "POST", "/api/market/bulk",
+		map[string][]MarketOrder{"orders": {order(1), order(0)}}, trader)
+	var credits int
+	db.QueryRow("SELECT credits FROM users WHERE global_uuid=?", trader.UserUUID).Scan(&credits)
+	if rr.Code != 400 || count() != 3 || credits != 700 {
+		t.Errorf("Expected an invalid order to reject the batch without charging, got %d, %d orders, %d credits", rr.Code, count(), credits)
+	}
+}
+
+// Test 35: Black holes and O-type stars punish fleets without hazard modules
+func TestStellarHazards(t *testing.T) {
+	setupTestEnv(t)
+	fx := seed(t, Seed{
+		Users:   []SeedUser{{Username: "pilot"}},
+		Systems: []SeedSystem{{ID: "sys-1-1-1", StarType: StarBlackHole}, {ID: "sys-2-2-2", StarType: StarOType}},
+		Fleets: []SeedFleet{
+			{Owner: "pilot", Status: "TRANSIT", Dest: "sys-1-1-1", HullClass: "Frigate"},
+			{Owner: "pilot", Status: "TRANSIT", Dest: "sys-1-1-1", HullClass: "Frigate"},
+			{Owner: "pilot", Status: "TRANSIT", Dest: "sys-1-1-1", HullClass: "Frigate"},
+			{Owner: "pilot", Status: "TRANSIT", Dest: "sys-1-1-1", HullClass: "Frigate", Modules: []string{"gravity_dampener"}},
+			{Owner: "pilot", Status: "TRANSIT", Dest: "sys-2-2-2", HullClass: "Frigate",
+				Payload: FleetPayload{PopLaborers: 100, Resources: map[string]int{"food": 40, "iron": 40}}},
+			{Owner: "pilot", Status: "TRANSIT", Dest: "sys-2-2-2", HullClass: "Frigate", Modules: []string{"heat_shield"},
+				Payload: FleetPayload{PopLaborers: 100}},
+		},
+	})
+	arrive := func(i int) Fleet {
+		var f Fleet
+		var modJson, plJson string
+		db.QueryRow("SELECT id, dest_system, owner_uuid, modules_json, payload_json FROM fleets WHERE id=?", fx.Fleets[i]).
+			Scan(&f.ID, &f.DestSystem, &f.OwnerUUID, &modJson, &plJson)
+		json.Unmarshal([]byte(modJson), &f.Modules)
+		json.Unmarshal([]byte(plJson), &f.Payload)
+		resolveDeepSpaceArrival(f)
+		return f
+	}
+	status := func(i int) (s string, arrival int64) {
+		db.QueryRow("SELECT status, arrival_tick FROM fleets WHERE id=?", fx.Fleets[i]).Scan(&s, &arrival)
+		return
+	}
+
+	for i := 0; i < 3; i++ {
+		arrive(i)
+		if s, arrival := status(i); s != "" && (s != FleetDilated || arrival != BlackHoleDilationTicks) {
+			t.Errorf("Fleet %d at a black hole should be lost or dilated, got %q (arrival %d)", i, s, arrival)
+		}
+	}
+	arrive(3)
+	if s, _ := status(3); s != "ORBIT" {
+		t.Errorf("A gravity dampener should carry the fleet through, got %q", s)
+	}
+
+	arrive(4)
+	var plJson string
+	var p FleetPayload
+	db.QueryRow("SELECT payload_json FROM fleets WHERE id=?", fx.Fleets[4]).Scan(&plJson)
+	json.Unmarshal([]byte(plJson), &p)
+	if p.PopLaborers != 75 || p.Resources["food"] != 30 || p.Resources["iron"] != 40 {
+		t.Errorf("Expected the O-type star to burn a quarter of crew and food only, got %+v", p)
+	}
+	arrive(5)
+	db.QueryRow("SELECT payload_json FROM fleets WHERE id=?", fx.Fleets[5]).Scan(&plJson)
+	json.Unmarshal([]byte(plJson), &p)
+	if p.PopLaborers != 100 {
+		t.Errorf("A heat shield should protect the crew, got %d", p.PopLaborers)
+	}
+
+	releaseDilatedFleets(BlackHoleDilationTicks)
+	var dilated int
+	db.QueryRow("SELECT count(*) FROM fleets WHERE status=?", FleetDilated).Scan(&dilated)
+	if dilated != 0 {
+		t.Errorf("Expected dilated fleets released after %d ticks, %d still stuck", BlackHoleDilationTicks, dilated)
+	}
+	if solarFactor(StarMDwarf) != MDwarfSolar || solarFactor("G2V") != 1 {
+		t.Error("Expected M-dwarfs alone to dim solar production")
+	}
+}
+
+// Test 36: Economy controls move in small, spaced, logged steps within the bounds
+func TestEconomyControls(t *testing.T) {
+	setupTestEnv(t)
+	defer func() { economy = defaultEconomy() }()
+	fx := seed(t, Seed{
+		Users:    []SeedUser{{Username: "miner"}},
+		Colonies: []SeedColony{{SystemID: "sys-4-4-4", Owner: "miner", Resources: map[string]int{"iron": 1000}}},
+	})
+
+	base := defaultEconomy()
+	step := base
+	step.BurnRate = 0.9
+	if status, err := checkEconomyChange(base, step, 0, 10); err != nil {
+		t.Fatalf("A 0.1 step should be allowed, got %d %v", status, err)
+	}
+	jump := base
+	jump.MarketFee = 1.5
+	if status, _ := checkEconomyChange(base, jump, 0, 10); status != 400 {
+		t.Errorf("Expected a 0.5 jump refused, got %d", status)
+	}
+	low := EconomyControls{BurnRate: 0.45, MarketFee: 0.5, Upkeep: 0.5}
+	if status, _ := checkEconomyChange(EconomyControls{BurnRate: 0.5, MarketFee: 0.5, Upkeep: 0.5}, low, 0, 10); status != 400 {
+		t.Errorf("Expected a multiplier below the federation bounds refused, got %d", status)
+	}
+
+	setEconomy(step, "inflation", 10)
+	if status, _ := checkEconomyChange(step, base, economyChangedTick(), 20); status != 429 {
+		t.Errorf("Expected a second change inside the cooldown refused, got %d", status)
+	}
+	economy = defaultEconomy()
+	loadEconomy()
+	if got := currentEconomy(); got != step {
+		t.Errorf("Controls did not round-trip: %+v", got)
+	}
+	if changes := economyChanges(10); len(changes) != 1 || changes[0].Control != "burn_rate" || changes[0].NewValue != 0.9 {
+		t.Errorf("Expected one logged burn_rate change, got %+v", changes)
+	}
+
+	// Burns pay out at the new rate
+	eff := GetEfficiency(fx.Colonies[0], "iron")
+	if eff < 0.1 {
+		eff = 0.1
+	}
+	rr := executeAuthedRequest(handleBankBurn, "POST", "/api/bank/burn",
+		map[string]interface{}{"colony_id": fx.Colonies[0], "item": "iron", "amount": 100}, fx.Users["miner"])
+	want := int(100 * (1 / eff) * 0.9)
+	if rr.Code != 200 || !strings.HasSuffix(rr.Body.String(), fmt.Sprintf("for %d credits", want)) {
+		t.Errorf("Expected a burn paying %d, got %d %s", want, rr.Code, rr.Body.String())
+	}
+}
+
+// Test 37: Scans of node-held systems carry a signed proof checkable against the snapshot
+func TestScanProofs(t *testing.T) {
+	setupTestEnv(t)
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	PrivateKey, PublicKey = priv, pub
+	savedPeers := Peers
+	defer func() { Peers = savedPeers }()
+	Peers = map[string]*Peer{ServerUUID: {UUID: ServerUUID, PublicKey: pub}}
+
+	fx := seed(t, Seed{
+		Users:    []SeedUser{{Username: "scout"}},
+		Systems:  []SeedSystem{{ID: "sys-5-5-5", Owner: ServerUUID}, {ID: "sys-6-6-6", Owner: "node-b"}},
+		Colonies: []SeedColony{{SystemID: "sys-5-5-5", Owner: "scout", Laborers: 500}},
+	})
+	snapshotWorld()
+
+	rr := executeAuthedRequest(handleScan, "POST", "/api/scan", map[string]int{"x": 5, "y": 5, "z": 5}, fx.Users["scout"])
+	var res struct {
+		Proof *ScanProof `json:"proof"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &res)
+	p := res.Proof
+	if p == nil || p.SystemID != "sys-5-5-5" || len(p.ColonyIDs) != 1 || p.ColonyIDs[0] != fx.Colonies[0] {
+		t.Fatalf("Expected a proof covering the colony, got %s", rr.Body.String())
+	}
+	if !verifyScanProof(p, ServerUUID, "sys-5-5-5") {
+		t.Error("Our own proof did not verify")
+	}
+
+	// The state hash is recomputable from the published snapshot
+	var blob []byte
+	var hash string
+	db.QueryRow("SELECT state_blob, final_hash FROM daily_snapshots WHERE day_id=?", p.SnapshotDay).Scan(&blob, &hash)
+	var colonies []Colony
+	json.Unmarshal(decompressLZ4(blob), &colonies)
+	if hash != p.SnapshotHash || snapshotStateHash(colonies) != p.StateHash {
+		t.Error("Proof does not match the published snapshot")
+	}
+
+	p.StateHash = hashBLAKE3([]byte("forged"))
+	if verifyScanProof(p, ServerUUID, "sys-5-5-5") {
+		t.Error("A tampered proof verified")
+	}
+
+	// A peer's proof is fetched and checked against its key; a bad signature is dropped
+	peerPub, peerPriv, _ := ed25519.GenerateKey(nil)
+	forge := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pp := ScanProof{SystemID: r.URL.Query().Get("system_id"), NodeUUID: "node-b", SnapshotDay: 3, ColonyIDs: []int{}}
+		pp.Signature = hex.EncodeToString(ed25519.Sign(peerPriv, pp.signingString()))
+		if forge {
+			pp.SnapshotDay = 4
+		}
+		json.NewEncoder(w).Encode(pp)
+	}))
+	defer srv.Close()
+	Peers["node-b"] = &Peer{UUID: "node-b", Url: srv.URL, PublicKey: peerPub}
+
+	if pp := scanProofAt(6, 6, 6); pp == nil || pp.NodeUUID != "node-b" || pp.SnapshotDay != 3 {
+		t.Errorf("Expected node-b's proof, got %+v", pp)
+	}
+	forge = true
+	if pp := scanProofAt(6, 6, 6); pp != nil {
+		t.Errorf("Expected a forged proof dropped, got %+v", pp)
+	}
+}
+
+// Test 38: Row locks let different players act at once but serialize the same player
+func TestRowLocks(t *testing.T) {
+	acquired := func(keys ...string) chan func() {
+		ch := make(chan func(), 1)
+		go func() { ch <- lockRows(keys...) }()
+		return ch
+	}
+	within := func(ch chan func()) func() {
+		select {
+		case unlock := <-ch:
+			return unlock
+		case <-time.After(100 * time.Millisecond):
+			return nil
+		}
+	}
+
+	unlockA := lockRows(userRow("alice"), marketRow("sys-1-1-1"))
+	unlockB := within(acquired(userRow("bob"), marketRow("sys-2-2-2")))
+	if unlockB == nil {
+		t.Fatal("An unrelated player was blocked")
+	}
+	unlockB()
+
+	again := acquired(marketRow("sys-1-1-1"), userRow("bob"))
+	if within(again) != nil {
+		t.Fatal("A shared market row was locked twice")
+	}
+	unlockA()
+	if unlock := within(again); unlock == nil {
+		t.Fatal("The waiting action never got the row")
+	} else {
+		unlock()
+	}
+
+	// The tick excludes every player action
+	stateLock.Lock()
+	waiting := acquired(userRow("carol"))
+	if within(waiting) != nil {
+		t.Error("A player action ran during the tick")
+	}
+	stateLock.Unlock()
+	if unlock := within(waiting); unlock != nil {
+		unlock()
+	} else {
+		t.Error("Player action never resumed after the tick")
+	}
+	if len(rowLocks) != 0 {
+		t.Errorf("Expected released rows forgotten, %d left", len(rowLocks))
+	}
+}
+
+// Test 39: Allies share vision and answer grievances against one of them
+func TestAllianceDefense(t *testing.T) {
+	setupTestEnv(t)
+	savedPeers := Peers
+	defer func() { Peers = savedPeers }()
+	defer setFeatureFlag(FeatureMutualDefenseWar, false)
+	Peers = map[string]*Peer{
+		"ally":     {UUID: "ally", Relation: 1, Reputation: 50},
+		"stranger": {UUID: "stranger", Relation: 0, Reputation: 50},
+		"raider":   {UUID: "raider", Relation: 0, Reputation: 10},
+	}
+	fx := seed(t, Seed{Users: []SeedUser{{Username: "lookout"}}})
+
+	acceptVision(Peers["ally"], [][]int{{50, 0, 0}})
+	acceptVision(Peers["stranger"], [][]int{{-50, 0, 0}})
+	if Peers["ally"].Vision == nil || Peers["stranger"].Vision != nil {
+		t.Fatal("Only allies' vision should be kept")
+	}
+	anchors := sensorAnchors(fx.Users["lookout"].UserUUID)
+	if len(anchors) != 1 || !inSensorRange([]int{60, 0, 0}, anchors) {
+		t.Errorf("Expected the ally's anchor in our sensors, got %v", anchors)
+	}
+
+	defended := func() (n int) {
+		db.QueryRow("SELECT count(*) FROM transaction_log WHERE action_type='MUTUAL_DEFENSE'").Scan(&n)
+		return n
+	}
+	g := &GrievanceReport{OffenderUUID: "raider", Damage: 100}
+	if mutualDefense(g, Peers["stranger"]) != nil || defended() != 0 {
+		t.Error("A non-ally's grievance should not call for defense")
+	}
+	if mutualDefense(&GrievanceReport{OffenderUUID: "raider", Damage: 100, Defending: "x"}, Peers["ally"]) != nil {
+		t.Error("A report filed in defense must not be defended again")
+	}
+
+	setFeatureFlag(FeatureMutualDefenseWar, true)
+	report := mutualDefense(g, Peers["ally"])
+	var out GrievanceReport
+	json.Unmarshal(report, &out)
+	if out.OffenderUUID != "raider" || out.Defending != "ally" || defended() != 1 {
+		t.Errorf("Expected our own grievance against the raider on the ally's behalf, got %s", report)
+	}
+	if Peers["raider"].Relation != 2 {
+		t.Error("Expected war declared on the raider")
+	}
+}
+
+// Test 40: The operator's notice is persisted and served in /api/status
+func TestServerNotice(t *testing.T) {
+	setupTestEnv(t)
+	defer func() { notice = ServerNotice{} }()
+	status := func() map[string]interface{} {
+		var s map[string]interface{}
+		json.Unmarshal(executeRequest(handleStatus, "GET", "/api/status", nil).Body.Bytes(), &s)
+		return s
+	}
+	if s := status(); s["motd"] != "" {
+		t.Errorf("Expected no notice by default, got %v", s["motd"])
+	}
+
+	t.Setenv("OWNWORLD_ADMIN_KEY", "k")
+	req := httptest.NewRequest("POST", "/admin/motd", strings.NewReader(`{"motd":"Wipe on Friday","rules":"No griefing","contact":"ops@example.org"}`))
+	req.Header.Set("X-Admin-Key", "k")
+	rr := httptest.NewRecorder()
+	handleAdminMOTD(rr, req)
+	if rr.Code != 200 {
+		t.Fatalf("Setting the notice failed: %d %s", rr.Code, rr.Body.String())
+	}
+
+	// Same tick, but the cached status must pick up the change
+	if s := status(); s["motd"] != "Wipe on Friday" || s["rules"] != "No griefing" || s["contact"] != "ops@example.org" {
+		t.Errorf("Status did not carry the notice: %v", s)
+	}
+	notice = ServerNotice{}
+	loadNotice()
+	if n, _ := currentNotice(); n.MOTD != "Wipe on Friday" {
+		t.Errorf("Notice did not persist: %+v", n)
+	}
+
+	long := httptest.NewRequest("POST", "/admin/motd", strings.NewReader(`{"motd":"`+strings.Repeat("x", MaxMOTDLen+1)+`"}`))
+	long.Header.Set("X-Admin-Key", "k")
+	rr = httptest.NewRecorder()
+	handleAdminMOTD(rr, long)
+	if rr.Code != 400 {
+		t.Errorf("Expected an overlong MOTD refused, got %d", rr.Code)
+	}
+}
+
+// Test 41: Advanced hulls and modules need their buildings; the catalog says which are unlocked
+func TestUnlocks(t *testing.T) {
+	setupTestEnv(t)
+	fx := seed(t, Seed{
+		Users: []SeedUser{{Username: "Wright", Credits: 1000}},
+		Colonies: []SeedColony{{
+			SystemID: "sys-1-0-0", Owner: "Wright", Name: "Yard", Laborers: 500,
+			Resources: map[string]int{"iron": 10000, "food": 10000},
+			Modules:   map[string]int{"railgun": 1, "laser": 1},
+			Buildings: map[string]int{"shipyard": 2},
+		}},
+	})
+	wright := fx.Users["Wright"]
+	colID := fx.Colonies[0]
+
+	build := func(hull string, modules ...string) int {
+		return executeAuthedRequest(handleConstruct, "POST", "/api/construct",
+			map[string]interface{}{"colony_id": colID, "hull_class": hull, "modules": modules}, wright).Code
+	}
+	if code := build("Fighter", "railgun"); code != 400 {
+		t.Errorf("Expected a railgun refused without a uranium_enricher, got %d", code)
+	}
+	if code := build("Bomber"); code != 400 {
+		t.Errorf("Expected a Bomber refused below shipyard level 3, got %d", code)
+	}
+	if code := build("Fighter", "laser"); code != 200 {
+		t.Errorf("Expected a Fighter with a laser allowed, got %d", code)
+	}
+	if code := build("Frigate"); code != 200 {
+		t.Errorf("Expected a Frigate allowed at shipyard level 2, got %d", code)
+	}
+
+	rr := executeAuthedRequest(handleCatalog, "GET", fmt.Sprintf("/api/catalog?colony_id=%d", colID), nil, wright)
+	var cat map[string][]CatalogEntry
+	json.Unmarshal(rr.Body.Bytes(), &cat)
+	unlocked := make(map[string]bool)
+	for _, e := range append(cat["hulls"], cat["modules"]...) {
+		if e.Unlocked == nil {
+			t.Fatalf("Expected unlock flags for a colony, got none on %s", e.Name)
+		}
+		unlocked[e.Name] = *e.Unlocked
+	}
+	if !unlocked["Frigate"] || unlocked["Bomber"] || !unlocked["laser"] || unlocked["railgun"] || unlocked["warp_drive"] {
+		t.Errorf("Unexpected unlocks: %v", unlocked)
+	}
+	if len(cat["hulls"]) != len(HullRegistry) {
+		t.Errorf("Expected every hull in the catalog, got %d", len(cat["hulls"]))
+	}
+}
+
+// Test 42: Federation transactions are retried until the peer acknowledges them, then dead-lettered
+func TestFederationOutbox(t *testing.T) {
+	setupTestEnv(t)
+	savedPeers := Peers
+	defer func(priv ed25519.PrivateKey, pub ed25519.PublicKey) {
+		Peers, PrivateKey, PublicKey = savedPeers, priv, pub
+	}(PrivateKey, PublicKey)
+	PublicKey, PrivateKey, _ = ed25519.GenerateKey(nil)
+
+	var calls int32
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			http.Error(w, "Busy", 503)
+			return
+		}
+		w.Write([]byte("ACK"))
+	}))
+	defer peer.Close()
+	refuser := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Unknown Peer", 403)
+	}))
+	defer refuser.Close()
+	Peers = map[string]*Peer{
+		"flaky":   {UUID: "flaky", Url: peer.URL, Relation: 0},
+		"gone":    {UUID: "gone", Url: "http://127.0.0.1:1", Relation: 0},
+		"refuser": {UUID: "refuser", Url: refuser.URL, Relation: 0},
+		"enemy":   {UUID: "enemy", Url: peer.URL, Relation: 2},
+	}
+
+	if n := enqueueTransaction([]byte(`{"offender_uuid":"x"}`)); n != 3 {
+		t.Fatalf("Expected the transaction queued for 3 peers, got %d", n)
+	}
+	client := &http.Client{Timeout: time.Second}
+	status := func(peerUUID string) (s string, attempts int) {
+		db.QueryRow("SELECT status, attempts FROM federation_outbox WHERE peer_uuid=?", peerUUID).Scan(&s, &attempts)
+		return
+	}
+
+	deliverOutbox(client)
+	if s, a := status("flaky"); s != "pending" || a != 1 {
+		t.Fatalf("Expected a failed delivery to stay pending, got %s after %d", s, a)
+	}
+	if s, a := status("refuser"); s != "dead" || a != 1 {
+		t.Errorf("Expected a refused delivery dead-lettered at once, got %s after %d", s, a)
+	}
+	deliverOutbox(client)
+	if _, a := status("flaky"); a != 1 {
+		t.Error("Retried before the backoff elapsed")
+	}
+	db.Exec("UPDATE federation_outbox SET next_attempt=0")
+	db.Exec("UPDATE federation_outbox SET attempts=? WHERE peer_uuid='gone'", MaxOutboxAttempts-1)
+	deliverOutbox(client)
+	if s, _ := status("flaky"); s != "delivered" {
+		t.Errorf("Expected the retry delivered, got %s", s)
+	}
+	if s, _ := status("gone"); s != "dead" {
+		t.Errorf("Expected the unreachable peer's copy dead-lettered, got %s", s)
+	}
+
+	t.Setenv("OWNWORLD_ADMIN_KEY", "k")
+	req := httptest.NewRequest("POST", "/admin/outbox", strings.NewReader(`{"all":true}`))
+	req.Header.Set("X-Admin-Key", "k")
+	rr := httptest.NewRecorder()
+	handleAdminOutbox(rr, req)
+	var out struct {
+		Counts map[string]int `json:"counts"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &out)
+	if rr.Code != 200 || out.Counts["pending"] != 2 || out.Counts["dead"] != 0 {
+		t.Errorf("Expected the dead letters requeued, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+// Test 43: World events start and end on their ticks, apply their effects and clean up
+func TestWorldEvents(t *testing.T) {
+	setupTestEnv(t)
+	savedPeers, savedTick := Peers, atomic.LoadInt64(&CurrentTick)
+	defer func() { Peers = savedPeers; atomic.StoreInt64(&CurrentTick, savedTick) }()
+	Peers = map[string]*Peer{}
+	atomic.StoreInt64(&CurrentTick, 100)
+	seed(t, Seed{Systems: []SeedSystem{{ID: "sys-5-5-5"}}})
+
+	t.Setenv("OWNWORLD_ADMIN_KEY", "k")
+	schedule := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/admin/events", strings.NewReader(body))
+		req.Header.Set("X-Admin-Key", "k")
+		rr := httptest.NewRecorder()
+		handleAdminEvents(rr, req)
+		return rr
+	}
+	if rr := schedule(`{"kind":"resource_rush","multiplier":2,"duration":50}`); rr.Code != 400 {
+		t.Errorf("Expected a rush without a region refused, got %d", rr.Code)
+	}
+	if rr := schedule(`{"kind":"armada","system_id":"sys-5-5-5","fleets":3,"start_tick":110,"duration":20}`); rr.Code != 200 {
+		t.Fatalf("Scheduling the armada failed: %s", rr.Body.String())
+	}
+	if rr := schedule(`{"kind":"double_production","title":"Double weekend","multiplier":2,"start_tick":110,"duration":40}`); rr.Code != 200 {
+		t.Fatalf("Scheduling double production failed: %s", rr.Body.String())
+	}
+
+	pirates := func() (n int) {
+		db.QueryRow("SELECT count(*) FROM fleets WHERE owner_uuid=? AND origin_system='sys-5-5-5'", PirateOwnerUUID).Scan(&n)
+		return
+	}
+	if active := processWorldEvents(105); len(active) != 0 {
+		t.Errorf("Events started early: %v", active)
+	}
+	active := processWorldEvents(110)
+	if len(active) != 2 || pirates() != 3 {
+		t.Fatalf("Expected both events running and 3 armada fleets, got %d events, %d fleets", len(active), pirates())
+	}
+	if m := eventProduction(active, []int{0, 0, 0}, true); m != 2 {
+		t.Errorf("Expected double industry, got x%.1f", m)
+	}
+
+	active = processWorldEvents(130)
+	if len(active) != 1 || pirates() != 0 {
+		t.Errorf("Expected the armada ended and withdrawn, got %d events, %d fleets", len(active), pirates())
+	}
+
+	// A peer's announcement shows up for our players but changes nothing here
+	processWorldEventAnnouncement(&WorldEvent{ID: 7, Kind: WorldEventRush, Title: "Gold rush", Multiplier: 3, Radius: 10, StartTick: 120, EndTick: 500, Status: "active"}, "peer-1")
+	var listed []WorldEvent
+	json.Unmarshal(executeRequest(handleWorldEvents, "GET", "/api/events", nil).Body.Bytes(), &listed)
+	if len(listed) != 2 {
+		t.Errorf("Expected our running event and the peer's, got %v", listed)
+	}
+	if active = processWorldEvents(131); len(active) != 1 {
+		t.Errorf("A peer's event must not run here, got %d running", len(active))
+	}
+}
+
+// Test 44: Embargoes block exchanges both ways and are visible to their target
+func TestEmbargoes(t *testing.T) {
+	setupTestEnv(t)
+	fx := seed(t, Seed{
+		Users:   []SeedUser{{Username: "Hermit"}, {Username: "Trader"}, {Username: "Other"}},
+		Systems: []SeedSystem{{ID: "sys-2-0-0", Owner: "peer-node"}},
+		Colonies: []SeedColony{
+			{SystemID: "sys-1-0-0", Owner: "Hermit", Name: "Walled"},
+			{SystemID: "sys-1-0-0", Owner: "Hermit", Name: "Open"},
+			{SystemID: "sys-2-0-0", Owner: "Other", Name: "Abroad"},
+		},
+	})
+	hermit, trader, other := fx.Users["Hermit"], fx.Users["Trader"], fx.Users["Other"]
+	walled, open, abroad := fx.Colonies[0], fx.Colonies[1], fx.Colonies[2]
+
+	embargo := func(body map[string]interface{}) int {
+		return executeAuthedRequest(handleEmbargoes, "POST", "/api/embargoes", body, hermit).Code
+	}
+	if code := embargo(map[string]interface{}{"target_uuid": trader.UserUUID, "colony_id": abroad}); code != 404 {
+		t.Errorf("Expected an embargo on someone else's colony refused, got %d", code)
+	}
+	if code := embargo(map[string]interface{}{"target_uuid": trader.UserUUID, "colony_id": walled, "reason": "pirates"}); code != 200 {
+		t.Fatalf("Placing the embargo failed: %d", code)
+	}
+
+	if checkEmbargo(hermit.UserUUID, walled, trader.UserUUID, "sys-1-0-0") == nil {
+		t.Error("Expected the embargoed colony closed to the trader")
+	}
+	if checkEmbargo(hermit.UserUUID, open, trader.UserUUID, "sys-1-0-0") != nil {
+		t.Error("A colony embargo must not close the owner's other colonies")
+	}
+
+	var seen map[string][]Embargo
+	json.Unmarshal(executeAuthedRequest(handleEmbargoes, "GET", "/api/embargoes", nil, trader).Body.Bytes(), &seen)
+	if len(seen["against_you"]) != 1 || seen["against_you"][0].OwnerName != "Hermit" || seen["against_you"][0].Reason != "pirates" {
+		t.Errorf("Expected the trader to see Hermit's embargo, got %+v", seen)
+	}
+
+	// An empire-wide embargo by the trader on a node closes that node's systems to it
+	executeAuthedRequest(handleEmbargoes, "POST", "/api/embargoes", map[string]interface{}{"target_uuid": "peer-node"}, trader)
+	if checkEmbargo(other.UserUUID, abroad, trader.UserUUID, "sys-2-0-0") == nil {
+		t.Error("Expected the trader's node embargo to block trade in the node's systems")
+	}
+
+	t.Setenv("OWNWORLD_ADMIN_KEY", "k")
+	req := httptest.NewRequest("POST", "/admin/embargoes", strings.NewReader(`{"target_uuid":"`+other.UserUUID+`"}`))
+	req.Header.Set("X-Admin-Key", "k")
+	rr := httptest.NewRecorder()
+	handleAdminEmbargoes(rr, req)
+	if rr.Code != 200 || checkEmbargo(hermit.UserUUID, open, other.UserUUID, "sys-1-0-0") == nil {
+		t.Errorf("Expected the operator's embargo to apply node-wide, got %d", rr.Code)
+	}
+
+	if code := embargo(map[string]interface{}{"target_uuid": trader.UserUUID, "colony_id": walled, "lift": true}); code != 200 ||
+		checkEmbargo(hermit.UserUUID, walled, trader.UserUUID, "sys-1-0-0") != nil {
+		t.Errorf("Expected the embargo lifted, got %d", code)
+	}
+}
+
+// Test 45: Handshakes say why a node was or wasn't queued
+func TestHandshakeStatuses(t *testing.T) {
+	setupTestEnv(t)
+	savedGenesis, savedMode := GenesisHash, Config.PeeringMode
+	defer func() { GenesisHash, Config.PeeringMode = savedGenesis, savedMode }()
+	GenesisHash = "handshake-test"
+
+	shake := func(req HandshakeRequest) (int, HandshakeResponse) {
+		body, _ := json.Marshal(req)
+		rr := httptest.NewRecorder()
+		handleHandshake(rr, httptest.NewRequest("POST", "/federation/handshake", bytes.NewReader(compressLZ4(body))))
+		var resp HandshakeResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr.Code, resp
+	}
+
+	if code, resp := shake(HandshakeRequest{UUID: "stranger", GenesisHash: "other-galaxy"}); code != 403 || resp.Status != HandshakeGenesis {
+		t.Errorf("Expected GenesisMismatch, got %d %s", code, resp.Status)
+	}
+	Config.PeeringMode = "open"
+	if code, resp := shake(HandshakeRequest{UUID: "joiner", GenesisHash: "handshake-test"}); code != 202 || resp.Status != HandshakeQueued {
+		t.Errorf("Expected Queued, got %d %s", code, resp.Status)
+	}
+	Config.PeeringMode = "strict"
+	if code, resp := shake(HandshakeRequest{UUID: "joiner-2", GenesisHash: "handshake-test"}); code != 202 || resp.Status != HandshakeStrictPending || resp.Reason == "" {
+		t.Errorf("Expected StrictModePendingApproval, got %d %s", code, resp.Status)
+	}
+
+	for i := 0; i < MaxImmigrationPending; i++ {
+		db.Exec("INSERT INTO immigration_queue (uuid, request_json, priority, status, attempts, next_attempt, received_at) VALUES (?, '{}', 0, 'pending', 0, 0, 0)", fmt.Sprintf("filler-%d", i))
+	}
+	if code, resp := shake(HandshakeRequest{UUID: "late", GenesisHash: "handshake-test"}); code != 503 || resp.Status != HandshakeQueueFull {
+		t.Errorf("Expected QueueFull, got %d %s", code, resp.Status)
+	}
+}
+
+// schemaShape lists every table's columns (name, type and default) and every named index
+func schemaShape(t *testing.T) map[string][]string {
+	t.Helper()
+	shape := make(map[string][]string)
+	rows, err := db.Query("SELECT type, name, tbl_name FROM sqlite_master WHERE type IN ('table', 'index') AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		t.Fatalf("Reading sqlite_master failed: %v", err)
+	}
+	var tables []string
+	for rows.Next() {
+		var kind, name, table string
+		rows.Scan(&kind, &name, &table)
+		if kind == "index" {
+			shape["indexes"] = append(shape["indexes"], name+" on "+table)
+		} else {
+			tables = append(tables, name)
+		}
+	}
+	rows.Close()
+
+	for _, table := range tables {
+		cols, err := db.Query("SELECT name, type, COALESCE(dflt_value, '') FROM pragma_table_info(?) ORDER BY name", table)
+		if err != nil {
+			t.Fatalf("Reading columns of %s failed: %v", table, err)
+		}
+		for cols.Next() {
+			var name, typ, def string
+			cols.Scan(&name, &typ, &def)
+			shape[table] = append(shape[table], strings.TrimSpace(name+" "+typ+" "+def))
+		}
+		cols.Close()
+	}
+	return shape
+}
+
+// Test 46: A database from before every migration upgrades to exactly the fresh schema
+func TestSchemaMigrations(t *testing.T) {
+	setupTestEnv(t)
+	fresh := schemaShape(t)
+	if err := createSchema(); err != nil {
+		t.Fatalf("createSchema is not idempotent: %v", err)
+	}
+
+	// Roll the fresh database back to the oldest schema by undoing each migration
+	migration := regexp.MustCompile(`^ALTER TABLE (\w+) ADD COLUMN (\w+)`)
+	for _, m := range schemaMigrations {
+		parts := migration.FindStringSubmatch(m)
+		if parts == nil {
+			t.Fatalf("Migration is not an ADD COLUMN: %s", m)
+		}
+		table, col := parts[1], parts[2]
+		found := false
+		for _, c := range fresh[table] {
+			found = found || strings.HasPrefix(c, col+" ")
+		}
+		if !found {
+			t.Errorf("Migration adds %s.%s, which the fresh schema lacks", table, col)
+			continue
+		}
+
+		idx, _ := db.Query("SELECT name FROM sqlite_master WHERE type='index' AND tbl_name=? AND sql LIKE ?", table, "%"+col+"%")
+		var drop []string
+		for idx.Next() {
+			var name string
+			idx.Scan(&name)
+			drop = append(drop, name)
+		}
+		idx.Close()
+		for _, name := range drop {
+			db.Exec("DROP INDEX " + name)
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, col)); err != nil {
+			t.Fatalf("Could not undo %s: %v", m, err)
+		}
+	}
+
+	if err := createSchema(); err != nil {
+		t.Fatalf("Upgrading the oldest schema failed: %v", err)
+	}
+	upgraded := schemaShape(t)
+	for table, cols := range fresh {
+		if strings.Join(upgraded[table], ", ") != strings.Join(cols, ", ") {
+			t.Errorf("%s differs after upgrade:\n fresh:    %v\n upgraded: %v", table, cols, upgraded[table])
+		}
+	}
+	if len(upgraded) != len(fresh) {
+		t.Errorf("Upgraded schema has %d tables and index sets, fresh has %d", len(upgraded), len(fresh))
+	}
+}
+
+// Test 47: Patrols cycle their waypoints, report sightings and hold station in combat
+func TestPatrol(t *testing.T) {
+	setupTestEnv(t)
+	savedTick := atomic.LoadInt64(&CurrentTick)
+	defer atomic.StoreInt64(&CurrentTick, savedTick)
+	atomic.StoreInt64(&CurrentTick, 1000)
+
+	fx := seed(t, Seed{
+		Users: []SeedUser{{Username: "Warden"}, {Username: "Raider"}},
+		Colonies: []SeedColony{
+			{SystemID: "sys-1-0-0", Owner: "Warden", Name: "Gate"},
+			{SystemID: "sys-3-0-0", Owner: "Warden", Name: "Keep"},
+		},
+		Fleets: []SeedFleet{
+			{Owner: "Warden", System: "sys-1-0-0", HullClass: "Fighter", Modules: []string{"laser"}, Fuel: 100000},
+			{Owner: "Raider", System: "sys-3-0-0", HullClass: "Fighter", Modules: []string{"laser"}},
+		},
+	})
+	warden := fx.Users["Warden"]
+	patrolID := fx.Fleets[0]
+
+	patrol := func(waypoints ...string) int {
+		return executeAuthedRequest(handlePatrol, "POST", "/api/fleet/patrol",
+			map[string]interface{}{"fleet_id": patrolID, "waypoints": waypoints, "dwell": 5}, warden).Code
+	}
+	if code := patrol("sys-9-9-9"); code != 400 {
+		t.Errorf("Expected a waypoint without a colony refused, got %d", code)
+	}
+	if code := patrol("sys-3-0-0", "sys-1-0-0"); code != 200 {
+		t.Fatalf("Starting the patrol failed: %d", code)
+	}
+
+	var status, origin, dest string
+	var arrival int64
+	load := func() {
+		db.QueryRow("SELECT status, origin_system, dest_system, arrival_tick FROM fleets WHERE id=?", patrolID).Scan(&status, &origin, &dest, &arrival)
+	}
+	load()
+	if status != FleetPatrol || dest != "sys-3-0-0" || origin != "sys-1-0-0" {
+		t.Fatalf("Expected the patrol heading for its first waypoint, got %s %s->%s", status, origin, dest)
+	}
+
+	processPatrols(arrival)
+	load()
+	if origin != "sys-3-0-0" {
+		t.Fatalf("Expected the patrol on station at sys-3-0-0, got %s", origin)
+	}
+	intel := patrolIntel(warden.UserUUID, 10)
+	if len(intel) != 1 || intel[0].HostileOwner != fx.Users["Raider"].UserUUID || intel[0].SystemID != "sys-3-0-0" {
+		t.Errorf("Expected the raider sighted, got %+v", intel)
+	}
+
+	// On station the patrol counts as in orbit, so the raider gets engaged
+	resolveSectorConflict(arrival)
+	var battles int
+	db.QueryRow("SELECT count(*) FROM battle_reports WHERE system_id='sys-3-0-0'").Scan(&battles)
+	if battles != 1 {
+		t.Errorf("Expected the patrol to engage the raider, got %d battles", battles)
+	}
+
+	processPatrols(arrival + 4)
+	if load(); dest != "sys-3-0-0" {
+		t.Error("Left station before the dwell was up")
+	}
+	processPatrols(arrival + 5)
+	if load(); dest != "sys-1-0-0" || origin != "sys-3-0-0" {
+		t.Errorf("Expected the patrol to move on to the next waypoint, got %s->%s", origin, dest)
+	}
+}
+
+// Test 48: Reactors burn fuel only as demand needs them and a short grid throttles industry
+func TestPowerGrid(t *testing.T) {
+	c := Colony{Buildings: map[string]int{"steel_mill": 3}}
+	if g := colonyPower(&c, "G-Type", true); g.Demand != 6 || g.Factor != 1 {
+		t.Errorf("Expected the base supply to run 3 steel mills, got %+v", g)
+	}
+
+	c = Colony{Buildings: map[string]int{"breeder_reactor": 10, "fission_reactor": 2}, Uranium: 5, Plutonium: 1}
+	g := colonyPower(&c, "G-Type", false)
+	if g.Supply != GridBasePower+ReactorPlutoniumPower+ReactorUraniumPower || g.Factor != 1 || c.Plutonium != 1 {
+		t.Errorf("Expected both reactors reported without burning fuel, got %+v (plutonium %d)", g, c.Plutonium)
+	}
+	colonyPower(&c, "G-Type", true)
+	if c.Plutonium != 0 || c.Uranium != 4 {
+		t.Errorf("Expected one plutonium and one uranium burned, got %d/%d", c.Plutonium, c.Uranium)
+	}
+	if g := colonyPower(&c, "G-Type", true); g.Factor != 0.7 || c.Uranium != 2 {
+		t.Errorf("Expected two uranium reactors to run 70%% of the grid, got %+v (uranium %d)", g, c.Uranium)
+	}
+
+	c = Colony{Buildings: map[string]int{"module_factory": 4, "solar_plant": 1}}
+	if g := colonyPower(&c, StarMDwarf, true); g.Supply != GridBasePower+4 || g.Factor >= 1 {
+		t.Errorf("Expected a dim solar plant to leave the factories short, got %+v", g)
+	}
+}
+
+// Test 49: Arbiters replay disputed battles from signed inputs and dock the node that lied
+func TestArbitration(t *testing.T) {
+	setupTestEnv(t)
+	savedPeers := Peers
+	defer func(priv ed25519.PrivateKey, pub ed25519.PublicKey) {
+		Peers, PrivateKey, PublicKey = savedPeers, priv, pub
+	}(PrivateKey, PublicKey)
+	PublicKey, PrivateKey, _ = ed25519.GenerateKey(nil)
+	pubA, privA, _ := ed25519.GenerateKey(nil)
+	pubB, privB, _ := ed25519.GenerateKey(nil)
+	Peers = map[string]*Peer{
+		"node-a": {UUID: "node-a", PublicKey: pubA, Reputation: 50},
+		"node-b": {UUID: "node-b", PublicKey: pubB, Reputation: 50},
+		"node-c": {UUID: "node-c", Reputation: 5},
+	}
+
+	fleets := []Fleet{
+		{ID: 1, OwnerUUID: "alice", HullClass: "Fighter", Modules: []string{"laser", "laser"}},
+		{ID: 2, OwnerUUID: "bob", HullClass: "Fighter", Modules: []string{"railgun"}},
+	}
+	report := resolveBattle("sys-9-9-9", append([]Fleet(nil), fleets...), 50)
+
+	// Our own battles are served as claims that replay to their report
+	applyBattleReport(report, append([]Fleet(nil), fleets...))
+	if c, err := buildBattleClaim("sys-9-9-9", 50); err != nil || !verifyBattleClaim(c) || !replayMatches(c) {
+		t.Fatalf("Expected our claim signed and replayable, got %v", err)
+	}
+
+	claim := func(node string, key ed25519.PrivateKey, r BattleReport) BattleClaim {
+		c := BattleClaim{NodeUUID: node, SystemID: "sys-9-9-9", Tick: 50, Inputs: fleets, Report: r}
+		c.Signature = hex.EncodeToString(ed25519.Sign(key, c.signingString()))
+		return c
+	}
+	forged := report
+	forged.Participants = append([]BattleParticipant(nil), report.Participants...)
+	for i := range forged.Participants {
+		forged.Participants[i].Outcome, forged.Participants[i].EndHP = "held", forged.Participants[i].StartHP
+	}
+	body, _ := json.Marshal(map[string]interface{}{"claims": []BattleClaim{claim("node-a", privA, report), claim("node-b", privB, forged)}})
+
+	arbitrate := func(sender string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/federation/arbitrate", bytes.NewReader(body))
+		req.Header.Set(HeaderFedNode, sender)
+		rr := httptest.NewRecorder()
+		handleFederationArbitrate(rr, req)
+		return rr
+	}
+	if rr := arbitrate("node-c"); rr.Code != 403 {
+		t.Errorf("Expected a bystander's dispute refused, got %d", rr.Code)
+	}
+	rr := arbitrate("node-a")
+	var v ArbitrationVerdict
+	json.Unmarshal(rr.Body.Bytes(), &v)
+	if rr.Code != 200 || v.Outcome != VerdictLied || len(v.Liars) != 1 || v.Liars[0] != "node-b" {
+		t.Fatalf("Expected node-b found lying, got %d %s", rr.Code, rr.Body.String())
+	}
+	if rep := Peers["node-b"].Reputation; rep != 50-ArbitrationPenalty/ArbiterCount {
+		t.Errorf("Expected node-b docked once, got %.2f", rep)
+	}
+	if Peers["node-a"].Reputation != 50 {
+		t.Errorf("The honest node lost reputation: %.2f", Peers["node-a"].Reputation)
+	}
+
+	// The same verdict counts once, and untrusted arbiters count not at all
+	applyVerdict(&v, ServerUUID)
+	untrusted := ArbitrationVerdict{Arbiter: "node-c", SystemID: "sys-9-9-9", Tick: 50, Claimants: []string{"node-a", "node-b"}, Liars: []string{"node-a"}, Outcome: VerdictLied}
+	applyVerdict(&untrusted, "node-c")
+	if Peers["node-b"].Reputation != 50-ArbitrationPenalty/ArbiterCount || Peers["node-a"].Reputation != 50 {
+		t.Errorf("Expected no further penalties, got a=%.2f b=%.2f", Peers["node-a"].Reputation, Peers["node-b"].Reputation)
+	}
+
+	// Our panel leaves out the parties and peers below the reputation line
+	if panel := chooseArbiters([]string{ServerUUID, "node-a"}); len(panel) != 1 || panel[0].UUID != "node-b" {
+		t.Errorf("Expected node-b as the only arbiter, got %d", len(panel))
+	}
+}
+
+// Test 50: Writes that find the database locked are retried until the lock is released
+func TestDBBusyRetry(t *testing.T) {
+	d, err := openDB("sqlite3", filepath.Join(t.TempDir(), "busy.db")+"?_journal_mode=WAL&_busy_timeout=0&_txlock=immediate", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	d.Exec("CREATE TABLE t (v INTEGER)")
+
+	if !isBusy(fmt.Errorf("database is locked")) || isBusy(context.DeadlineExceeded) || isBusy(nil) {
+		t.Error("Only locked-database errors should count as busy")
+	}
+
+	holder, err := d.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	holder.Exec("INSERT INTO t (v) VALUES (1)")
+	time.AfterFunc(50*time.Millisecond, func() { holder.Commit() })
+
+	before := atomic.LoadInt64(&dbMetrics.BusyRetries)
+	if _, err := d.Exec("INSERT INTO t (v) VALUES (2)"); err != nil {
+		t.Fatalf("Expected the write to wait out the lock, got %v", err)
+	}
+	if atomic.LoadInt64(&dbMetrics.BusyRetries) == before {
+		t.Error("Expected the retries counted")
+	}
+	var n int
+	d.QueryRow("SELECT count(*) FROM t").Scan(&n)
+	if n != 2 {
+		t.Errorf("Expected both rows written once, got %d", n)
+	}
+}
+
+// Test 51: Public profiles summarize an empire without its stockpiles and can be cached
+func TestPublicProfile(t *testing.T) {
+	setupTestEnv(t)
+	fx := seed(t, Seed{
+		Users:   []SeedUser{{Username: "alice", Credits: 12345}},
+		Systems: []SeedSystem{{ID: "sys-1-0-0"}, {ID: "sys-2-0-0"}},
+		Colonies: []SeedColony{
+			{SystemID: "sys-1-0-0", Owner: "alice", Name: "Home", Laborers: 100, Resources: map[string]int{"iron": 777}, Buildings: map[string]int{"farm": 2}},
+			{SystemID: "sys-2-0-0", Owner: "alice", Name: "Outpost", Laborers: 50},
+		},
+	})
+	alice := fx.Users["alice"].UserUUID
+	applyBattleReport(BattleReport{SystemID: "sys-1-0-0", Tick: 5, Participants: []BattleParticipant{
+		{FleetID: 90, OwnerUUID: alice, Outcome: "held"},
+		{FleetID: 91, OwnerUUID: "raider", Outcome: "destroyed", KilledBy: alice},
+	}}, nil)
+
+	rr := executeRequest(handlePublicPlayer, "GET", "/public/player/"+alice, nil)
+	if rr.Code != 200 {
+		t.Fatalf("Expected the profile, got %d", rr.Code)
+	}
+	var p PlayerProfile
+	json.Unmarshal(rr.Body.Bytes(), &p)
+	if p.Name != "alice" || p.Colonies != 2 || p.Systems != 2 || p.Score != 150+2*ScorePerBuilding+2*ScorePerSystem {
+		t.Errorf("Unexpected profile: %+v", p)
+	}
+	if p.War.Battles != 1 || p.War.FleetsDestroyed != 1 || p.War.FleetsLost != 0 {
+		t.Errorf("Unexpected war record: %+v", p.War)
+	}
+	if body := rr.Body.String(); strings.Contains(body, "12345") || strings.Contains(body, "777") || strings.Contains(body, "sys-1-0-0") {
+		t.Errorf("Profile leaks private data: %s", body)
+	}
+	if cc := rr.Header().Get("Cache-Control"); !strings.HasPrefix(cc, "public") {
+		t.Errorf("Expected a public cache policy, got %q", cc)
+	}
+
+	req := httptest.NewRequest("GET", "/public/player/"+alice, nil)
+	req.Header.Set("If-None-Match", rr.Header().Get("ETag"))
+	again := httptest.NewRecorder()
+	handlePublicPlayer(again, req)
+	if again.Code != 304 {
+		t.Errorf("Expected 304 for a cached profile, got %d", again.Code)
+	}
+
+	if rr := executeRequest(handlePublicPlayer, "GET", "/public/player/nobody", nil); rr.Code != 404 {
+		t.Errorf("Expected 404 for an unknown player, got %d", rr.Code)
+	}
+}
+
+// Test 52: Basic scans are coarse; a probe fleet's paid survey reveals exact figures from then on
+func TestSurvey(t *testing.T) {
+	setupTestEnv(t)
+	fx := seed(t, Seed{
+		Users:    []SeedUser{{Username: "scout", Credits: 1000}},
+		Systems:  []SeedSystem{{ID: "sys-33-0-0"}},
+		Colonies: []SeedColony{{SystemID: "sys-33-0-0", Owner: "scout", Name: "Base", Laborers: 10}},
+		Fleets: []SeedFleet{
+			{Owner: "scout", System: "sys-33-0-0", HullClass: "Scout", Modules: []string{"probe_scanner"}, Fuel: 800},
+			{Owner: "scout", System: "sys-33-0-0", HullClass: "Scout", Fuel: 800},
+		},
+	})
+	scout := fx.Users["scout"]
+	exact := GetSectorData(33, 0, 0)
+	if !exact.HasSystem {
+		t.Fatal("Expected a procedural system at 33,0,0")
+	}
+	if cached := cachedSectorData(33, 0, 0); hashJSON(cached) != hashJSON(exact) {
+		t.Fatalf("Cached sector data differs: %+v vs %+v", cached, exact)
+	}
+
+	scan := func() (res struct {
+		Survey    string             `json:"survey"`
+		Resources map[string]float64 `json:"resources"`
+	}) {
+		rr := executeAuthedRequest(handleScan, "POST", "/api/scan", map[string]int{"x": 33, "y": 0, "z": 0}, scout)
+		json.Unmarshal(rr.Body.Bytes(), &res)
+		return
+	}
+	basic := scan()
+	if basic.Survey != SurveyBasic {
+		t.Fatalf("Expected a basic scan, got %q", basic.Survey)
+	}
+	for res, v := range basic.Resources {
+		if math.Abs(v-exact.Resources[res]) > BasicScanStep/2+1e-9 || math.Mod(v, BasicScanStep) != 0 {
+			t.Errorf("Basic %s should be %.2f to the nearest %.1f, got %.3f", res, exact.Resources[res], BasicScanStep, v)
+		}
+	}
+
+	if rr := executeAuthedRequest(handleFleetSurvey, "POST", "/api/fleet/survey", map[string]int{"fleet_id": fx.Fleets[1]}, scout); rr.Code != 400 {
+		t.Errorf("Expected a fleet without a probe refused, got %d", rr.Code)
+	}
+	rr := executeAuthedRequest(handleFleetSurvey, "POST", "/api/fleet/survey", map[string]int{"fleet_id": fx.Fleets[0]}, scout)
+	if rr.Code != 200 {
+		t.Fatalf("Survey failed: %d %s", rr.Code, rr.Body.String())
+	}
+	var report SurveyReport
+	json.Unmarshal(rr.Body.Bytes(), &report)
+	col := fx.Colonies[0]
+	if report.Efficiencies[col]["iron"] != GetEfficiency(col, "iron") || report.FuelLeft != 800-SurveyFuel {
+		t.Errorf("Unexpected survey: %s", rr.Body.String())
+	}
+	var credits, fuel int
+	db.QueryRow("SELECT credits FROM users WHERE global_uuid=?", scout.UserUUID).Scan(&credits)
+	db.QueryRow("SELECT fuel FROM fleets WHERE id=?", fx.Fleets[0]).Scan(&fuel)
+	if credits != 1000-SurveyCredits || fuel != 800-SurveyFuel {
+		t.Errorf("Expected the survey paid for, got %d credits and %d fuel", credits, fuel)
+	}
+
+	if detailed := scan(); detailed.Survey != SurveyDetailed || detailed.Resources["iron"] != exact.Resources["iron"] {
+		t.Errorf("Expected exact figures after the survey, got %+v", detailed)
+	}
+	if rr := executeAuthedRequest(handleFleetSurvey, "POST", "/api/fleet/survey", map[string]int{"fleet_id": fx.Fleets[0]}, scout); rr.Code != 402 {
+		t.Errorf("Expected a survey without the fuel refused, got %d", rr.Code)
+	}
+}
+
+// Test 53: Workforce allocation staffs each sector, scales its output and idles the rest
+func TestWorkforce(t *testing.T) {
+	setupTestEnv(t)
+	fx := seed(t, Seed{
+		Users:    []SeedUser{{Username: "boss"}, {Username: "nosy"}},
+		Systems:  []SeedSystem{{ID: "sys-4-0-0"}},
+		Colonies: []SeedColony{{SystemID: "sys-4-0-0", Owner: "boss", Name: "Works", Laborers: 100, Buildings: map[string]int{"farm": 5, "iron_mine": 5, "shipyard": 1}}},
+	})
+	boss, col := fx.Users["boss"], fx.Colonies[0]
+
+	set := func(body map[string]interface{}, s SeedSession) (*httptest.ResponseRecorder, WorkforceReport) {
+		var rep WorkforceReport
+		rr := executeAuthedRequest(handleColonyWorkforce, "POST", "/api/colony/workforce", body, s)
+		json.Unmarshal(rr.Body.Bytes(), &rep)
+		return rr, rep
+	}
+	if rr, _ := set(map[string]interface{}{"colony_id": col, "mining": 60, "farming": 50}, boss); rr.Code != 400 {
+		t.Errorf("Expected shares over 100%% refused, got %d", rr.Code)
+	}
+	if rr, _ := set(map[string]interface{}{"colony_id": col, "mining": 50}, fx.Users["nosy"]); rr.Code != 403 {
+		t.Errorf("Expected a stranger refused, got %d", rr.Code)
+	}
+	rr, rep := set(map[string]interface{}{"colony_id": col, "mining": 50, "farming": 25}, boss)
+	if rr.Code != 200 {
+		t.Fatalf("Allocation failed: %d %s", rr.Code, rr.Body.String())
+	}
+	if rep.Staffing[SectorMining] != 0.5 || rep.Staffing[SectorFarming] != 0.5 || rep.Staffing[SectorConstruction] != 0 || rep.Idle != 25 {
+		t.Errorf("Unexpected workforce: %s", rr.Body.String())
+	}
+
+	// Half-staffed mines dig half as much, and the idle quarter unsettles the colony
+	env := &tickEnv{CultureByID: map[int]float64{}, CultureByOwner: map[string]float64{}, Capitals: map[string]capitalInfo{}}
+	c := Colony{ID: col, PopLaborers: 100, Food: 1000, Water: 1000, Oxygen: 1000, StabilityCurrent: 70,
+		Buildings: map[string]int{"farm": 5, "iron_mine": 5, "shipyard": 1}, Policies: map[string]bool{}}
+	legacy := simulateColony(c, 0, []int{4, 0, 0}, "", env)
+	c.Workforce = &Workforce{Mining: 50, Farming: 25}
+	staffed := simulateColony(c, 0, []int{4, 0, 0}, "", env)
+	if staffed.Update.Iron >= legacy.Update.Iron || staffed.Update.Iron == 0 {
+		t.Errorf("Expected half the iron of a fully staffed colony, got %d vs %d", staffed.Update.Iron, legacy.Update.Iron)
+	}
+	if legacy.Update.Target-staffed.Update.Target < IdleStabilityPenalty/4-0.01 {
+		t.Errorf("Expected idle laborers to cost stability, got %.1f vs %.1f", staffed.Update.Target, legacy.Update.Target)
+	}
+
+	var state struct {
+		Colonies []Colony `json:"colonies"`
+	}
+	json.Unmarshal(executeAuthedRequest(handleState, "GET", "/api/state", nil, boss).Body.Bytes(), &state)
+	if len(state.Colonies) != 1 || state.Colonies[0].Workforce == nil || state.Colonies[0].Workforce.Mining != 50 {
+		t.Errorf("Expected the allocation in the colony state, got %+v", state.Colonies)
+	}
+	if _, rep := set(map[string]interface{}{"colony_id": col, "reset": true}, boss); rep.Allocation != nil || rep.Staffing[SectorMining] != 1 || rep.Idle != 0 {
+		t.Errorf("Expected a reset to staff every building, got %+v", rep)
+	}
+}
+
+// Test 54: Beacons are private unless shared, reach allies by heartbeat and can be launched to
+func TestBeacons(t *testing.T) {
+	setupTestEnv(t)
+	savedPeers := Peers
+	defer func() { Peers = savedPeers }()
+	Peers = map[string]*Peer{"node-ally": {UUID: "node-ally", Relation: 1}, "node-other": {UUID: "node-other"}}
+
+	fx := seed(t, Seed{
+		Users:    []SeedUser{{Username: "lead"}, {Username: "wing"}},
+		Systems:  []SeedSystem{{ID: "sys-1-0-0"}},
+		Colonies: []SeedColony{{SystemID: "sys-1-0-0", Owner: "lead", Name: "Home", Laborers: 10}},
+		Fleets:   []SeedFleet{{Owner: "lead", System: "sys-1-0-0", HullClass: "Fighter", Modules: []string{"warp_drive"}, Fuel: 500000}},
+	})
+	lead, wing := fx.Users["lead"], fx.Users["wing"]
+
+	place := func(body map[string]interface{}, s SeedSession) int {
+		return executeAuthedRequest(handleBeacons, "POST", "/api/beacons", body, s).Code
+	}
+	if code := place(map[string]interface{}{"name": "sys-9", "x": 3}, lead); code != 400 {
+		t.Errorf("Expected a raw-id name refused, got %d", code)
+	}
+	if code := place(map[string]interface{}{"name": "Staging Area", "x": 3}, lead); code != 200 {
+		t.Fatalf("Placing a beacon failed: %d", code)
+	}
+	place(map[string]interface{}{"name": "Rally", "x": 5, "shared": true}, lead)
+	acceptBeacons(Peers["node-ally"], []Beacon{{Name: "Forward Base", X: 4, OwnerUUID: "ally-player"}})
+	acceptBeacons(Peers["node-other"], []Beacon{{Name: "Trap", X: 4}})
+
+	names := func(s SeedSession) []string {
+		var bs []Beacon
+		json.Unmarshal(executeAuthedRequest(handleBeacons, "GET", "/api/beacons", nil, s).Body.Bytes(), &bs)
+		var out []string
+		for _, b := range bs {
+			out = append(out, b.Name)
+		}
+		return out
+	}
+	if got := strings.Join(names(wing), ","); got != "Rally,Forward Base" {
+		t.Errorf("Expected another player to see shared and allied beacons only, got %q", got)
+	}
+	if got := nodeBeacons(); len(got) != 1 || got[0].Name != "Rally" {
+		t.Errorf("Expected only the shared beacon sent to allies, got %+v", got)
+	}
+
+	launch := func(beacon string, s SeedSession) *httptest.ResponseRecorder {
+		return executeAuthedRequest(handleFleetLaunch, "POST", "/api/fleet/launch", map[string]interface{}{"fleet_id": fx.Fleets[0], "beacon": beacon}, s)
+	}
+	if rr := launch("Staging Area", wing); rr.Code != 404 {
+		t.Errorf("Expected someone else's private beacon unknown, got %d", rr.Code)
+	}
+	if rr := launch("Staging Area", lead); rr.Code != 200 {
+		t.Fatalf("Launch to beacon failed: %d %s", rr.Code, rr.Body.String())
+	}
+	var dest string
+	db.QueryRow("SELECT dest_system FROM fleets WHERE id=?", fx.Fleets[0]).Scan(&dest)
+	if dest != "sys-3-0-0" {
+		t.Errorf("Expected the fleet bound for the beacon, got %q", dest)
+	}
+
+	var region []RegionSystem
+	rr := executeAuthedRequest(handleScanRegion, "POST", "/api/scan/region", map[string]int{"x": 1, "y": 0, "z": 0, "radius": 3}, lead)
+	json.Unmarshal(rr.Body.Bytes(), &region)
+	marked := map[string]bool{}
+	for _, s := range region {
+		for _, b := range s.Beacons {
+			marked[b] = true
+		}
+	}
+	if !marked["Staging Area"] || !marked["Forward Base"] || marked["Rally"] || marked["Trap"] {
+		t.Errorf("Expected the beacons within 3 units on the map, got %s", rr.Body.String())
+	}
+}
+
+// Test 55: Handshakes echo the caller's host, fix localhost claims, and gossip waits on a probe
+func TestPeerAddresses(t *testing.T) {
+	setupTestEnv(t)
+	savedGenesis, savedMode := GenesisHash, Config.PeeringMode
+	savedPeers, savedAddr, savedFixed := Peers, advertisedAddr, advertisedFixed
+	defer func() {
+		GenesisHash, Config.PeeringMode = savedGenesis, savedMode
+		Peers, advertisedAddr, advertisedFixed = savedPeers, savedAddr, savedFixed
+	}()
+	GenesisHash, Config.PeeringMode = "addr-test", "open"
+
+	body, _ := json.Marshal(HandshakeRequest{UUID: "behind-nat", GenesisHash: "addr-test", Address: "http://localhost:9090"})
+	req := httptest.NewRequest("POST", "/federation/handshake", bytes.NewReader(compressLZ4(body)))
+	req.RemoteAddr = "198.51.100.4:53211"
+	rr := httptest.NewRecorder()
+	handleHandshake(rr, req)
+	var resp HandshakeResponse
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if resp.ObservedAddr != "198.51.100.4" {
+		t.Errorf("Expected the caller's host echoed, got %q", resp.ObservedAddr)
+	}
+	var queued string
+	db.QueryRow("SELECT request_json FROM immigration_queue WHERE uuid='behind-nat'").Scan(&queued)
+	if !strings.Contains(queued, `"address":"http://198.51.100.4:9090"`) {
+		t.Errorf("Expected the localhost claim rewritten, got %s", queued)
+	}
+	if got := peerAddress("https://node.example:8443", "198.51.100.4"); got != "https://node.example:8443" {
+		t.Errorf("Expected a routable claim kept, got %s", got)
+	}
+
+	advertisedAddr, advertisedFixed = "http://localhost:8080", false
+	learnObservedAddr("127.0.0.1")
+	learnObservedAddr("203.0.113.9")
+	learnObservedAddr("203.0.113.10")
+	if AdvertisedAddr() != "http://203.0.113.9:8080" {
+		t.Errorf("Expected the first routable echo adopted, got %s", AdvertisedAddr())
+	}
+	advertisedAddr, advertisedFixed = "http://localhost:8080", true
+	if learnObservedAddr("203.0.113.9"); AdvertisedAddr() != "http://localhost:8080" {
+		t.Errorf("Expected a configured address left alone, got %s", AdvertisedAddr())
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(handleStatus))
+	defer srv.Close()
+	Peers = map[string]*Peer{
+		ServerUUID: {UUID: ServerUUID, Url: srv.URL},
+		"impostor": {UUID: "impostor", Url: srv.URL},
+	}
+	probePeer(ServerUUID, srv.URL)
+	probePeer("impostor", srv.URL)
+	if !Peers[ServerUUID].Reachable || Peers["impostor"].Reachable || Peers["impostor"].ProbedAt.IsZero() {
+		t.Errorf("Expected only the node that answers as itself reachable, got %+v / %+v", Peers[ServerUUID], Peers["impostor"])
+	}
+}
+
+// Test 56: Burn payouts follow galaxy-wide supply gossiped by non-hostile peers
+func TestSupplyIndex(t *testing.T) {
+	setupTestEnv(t)
+	savedPeers, savedTick := Peers, atomic.LoadInt64(&CurrentTick)
+	defer func() {
+		Peers = savedPeers
+		atomic.StoreInt64(&CurrentTick, savedTick)
+		supplyCacheTick = -1
+	}()
+	now := int64(10 * TicksPerDay)
+	atomic.StoreInt64(&CurrentTick, now)
+	supplyCacheTick = -1
+	Peers = map[string]*Peer{}
+
+	burn := func(tick int64, amount int) {
+		blob, _ := json.Marshal(BurnRecord{UserUUID: "someone", Item: "iron", Amount: amount})
+		db.Exec("INSERT INTO transaction_log (tick, action_type, payload_blob) VALUES (?, 'BANK_BURN', ?)", tick, blob)
+	}
+	for d := int64(1); d < SupplyBaselineDays; d++ {
+		burn(now-d*TicksPerDay-10, 100)
+	}
+	burn(now-5, 60)
+	fill, _ := json.Marshal(TradeRecord{Item: "iron", Quantity: 40, Price: 3})
+	db.Exec("INSERT INTO transaction_log (tick, action_type, payload_blob) VALUES (?, 'TRADE_FILL', ?)", now-3, fill)
+	if got := localSupply()["iron"]; got != (SupplyVolume{Recent: 100, Baseline: 100}) {
+		t.Fatalf("Expected 100 iron a day, recently and on average, got %+v", got)
+	}
+	if f := itemSupplyFactor("iron"); f != 1 {
+		t.Errorf("Expected steady supply priced at 1, got %.2f", f)
+	}
+
+	glut, hostile := &Peer{UUID: "glut"}, &Peer{UUID: "hostile", Relation: 2}
+	acceptSupply(glut, map[string]SupplyVolume{"iron": {Recent: 2500, Baseline: 100}})
+	acceptSupply(hostile, map[string]SupplyVolume{"iron": {Recent: 0, Baseline: 1000000}})
+	Peers = map[string]*Peer{"glut": glut, "hostile": hostile}
+	if f := itemSupplyFactor("iron"); f != MinSupplyFactor {
+		t.Errorf("Expected a galaxy-wide glut to floor the price, got %.2f", f)
+	}
+	bogus := &Peer{UUID: "bogus"}
+	if acceptSupply(bogus, map[string]SupplyVolume{"unobtanium": {Recent: 1}}); bogus.Supply != nil {
+		t.Error("Expected a report with unknown items dropped")
+	}
+	if f := supplyFactor(SupplyVolume{Baseline: 100}); f != MaxSupplyFactor {
+		t.Errorf("Expected a dried-up item priced at the cap, got %.2f", f)
+	}
+
+	fx := seed(t, Seed{
+		Users:    []SeedUser{{Username: "seller"}},
+		Systems:  []SeedSystem{{ID: "sys-6-0-0"}},
+		Colonies: []SeedColony{{SystemID: "sys-6-0-0", Owner: "seller", Name: "Pit", Resources: map[string]int{"iron": 1000}}},
+	})
+	eff := math.Max(GetEfficiency(fx.Colonies[0], "iron"), 0.1)
+	rr := executeAuthedRequest(handleBankBurn, "POST", "/api/bank/burn",
+		map[string]interface{}{"colony_id": fx.Colonies[0], "item": "iron", "amount": 100}, fx.Users["seller"])
+	want := int(100 * (1 / eff) * MinSupplyFactor * currentEconomy().BurnRate)
+	if rr.Code != 200 || !strings.HasSuffix(rr.Body.String(), fmt.Sprintf("for %d credits", want)) {
+		t.Errorf("Expected a burn paying %d in a glut, got %d %s", want, rr.Code, rr.Body.String())
+	}
+}
+
+// Test 57: Hulls and engines set a trip's fuel; the estimate shows what the engines cost and save
+func TestFuelEfficiency(t *testing.T) {
+	setupTestEnv(t)
+	fx := seed(t, Seed{
+		Users:   []SeedUser{{Username: "pilot"}},
+		Systems: []SeedSystem{{ID: "sys-0-0-1"}, {ID: "sys-0-0-201"}},
+		Fleets:  []SeedFleet{{Owner: "pilot", System: "sys-0-0-1", HullClass: "Frigate", Modules: []string{"booster", "booster"}, Fuel: 100}},
+	})
+	pilot := fx.Users["pilot"]
+
+	bare, _ := computeRoute("sys-0-0-1", "sys-0-0-201", "Frigate", nil)
+	fast, fastTicks := computeRoute("sys-0-0-1", "sys-0-0-201", "Frigate", []string{"booster", "booster"})
+	_, slowTicks := computeRoute("sys-0-0-1", "sys-0-0-201", "Frigate", nil)
+	if fast <= bare || fastTicks >= slowTicks {
+		t.Errorf("Expected boosters faster but thirstier: %d fuel/%d ticks vs %d/%d", fast, fastTicks, bare, slowTicks)
+	}
+	frigate, _ := computeRoute("sys-0-0-1", "sys-0-0-201", "Frigate", []string{"warp_drive"})
+	speedy, _ := computeRoute("sys-0-0-1", "sys-0-0-201", "SpeedyFighter", []string{"warp_drive"})
+	if float64(frigate)/float64(fleetMass("Frigate", []string{"warp_drive"})) >= float64(speedy)/float64(fleetMass("SpeedyFighter", []string{"warp_drive"})) {
+		t.Errorf("Expected the frigate cheaper per ton than the speedy fighter: %d vs %d", frigate, speedy)
+	}
+
+	rr := executeAuthedRequest(handleFleetEstimate, "POST", "/api/fleet/estimate", map[string]interface{}{"fleet_id": fx.Fleets[0], "target_system": "sys-0-0-201"}, pilot)
+	var est RouteEstimate
+	json.Unmarshal(rr.Body.Bytes(), &est)
+	if rr.Code != 200 || est.FuelCost != fast || est.TravelTicks != fastTicks || est.UnpoweredFuel != bare || est.UnpoweredTicks != slowTicks {
+		t.Errorf("Unexpected estimate: %d %s", rr.Code, rr.Body.String())
+	}
+	if est.Affordable == nil || *est.Affordable {
+		t.Errorf("Expected a fleet with 100 fuel unable to afford %d", est.FuelCost)
+	}
+	if rr := executeAuthedRequest(handleFleetEstimate, "POST", "/api/fleet/estimate", map[string]interface{}{
+		"hull_class": "Fighter", "modules": []string{"laser", "laser", "laser", "laser", "laser"}, "origin_system": "sys-0-0-1", "target_system": "sys-0-0-201"}, pilot); rr.Code != 400 {
+		t.Errorf("Expected an illegal design refused, got %d", rr.Code)
+	}
+}
+
+// Test 58: Genesis parameters are bound to the hash and shape the universe
+func TestGenesisParams(t *testing.T) {
+	setupTestEnv(t)
+	defer applyGenesisParams(GenesisParams{UniverseSize: DefaultUniverseSize, SystemDensity: DefaultSystemDensity})
+
+	p := GenesisParams{UniverseSize: 5000, SystemDensity: 128, Nonce: "1-abcd"}
+	if err := verifyGenesisParams(p.hash(), p); err != nil {
+		t.Errorf("Expected matching parameters accepted: %v", err)
+	}
+	tampered := p
+	tampered.SystemDensity = 255
+	if err := verifyGenesisParams(p.hash(), tampered); err == nil {
+		t.Errorf("Expected tampered parameters refused")
+	}
+	if err := verifyGenesisParams(p.hash(), GenesisParams{UniverseSize: 5, SystemDensity: 128, Nonce: "1-abcd"}); err == nil {
+		t.Errorf("Expected an undersized universe refused")
+	}
+
+	count := func() int {
+		n := 0
+		for x := 0; x < 40; x++ {
+			for y := 0; y < 40; y++ {
+				if GetSectorData(x, y, 0).HasSystem {
+					n++
+				}
+			}
+		}
+		return n
+	}
+	sparse := count()
+	applyGenesisParams(p)
+	dense := count()
+	if dense <= sparse*4 {
+		t.Errorf("Expected density 128 to hold far more systems than 13: %d vs %d", dense, sparse)
+	}
+	if inUniverse(5001, 0, 0) || !inUniverse(-5000, 5000, 0) || GetSectorData(6000, 0, 0).HasSystem {
+		t.Errorf("Expected the universe bounded at 5000")
+	}
+
+	if got := publishedGenesisParams(); got == nil || *got != p {
+		t.Errorf("Expected the parameters published, got %v", got)
+	}
+}
+
+// Test 59: A registered passkey logs in without the password; replays and stale counters fail
+func TestPasskeyLogin(t *testing.T) {
+	setupTestEnv(t)
+	t.Setenv("OWNWORLD_PASSKEY_RP_ID", "localhost")
+	fx := seed(t, Seed{Users: []SeedUser{{Username: "pilot", Password: "hunter2"}}})
+	pilot := fx.Users["pilot"]
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	credID := []byte("test-credential")
+	rpHash := sha256.Sum256([]byte("localhost"))
+	clientData := func(ceremony, challenge, origin string) []byte {
+		cd, _ := json.Marshal(map[string]string{"type": ceremony, "challenge": challenge, "origin": origin})
+		return cd
+	}
+
+	rr := executeAuthedRequest(handlePasskeyRegisterBegin, "POST", "/api/passkeys/register/begin", nil, pilot)
+	var reg PasskeyChallenge
+	json.Unmarshal(rr.Body.Bytes(), &reg)
+	if rr.Code != 200 || reg.RPID != "localhost" || reg.Challenge == "" {
+		t.Fatalf("Unexpected registration challenge: %d %s", rr.Code, rr.Body.String())
+	}
+	authData := append(append([]byte{}, rpHash[:]...), 0x41, 0, 0, 0, 0)
+	authData = append(authData, make([]byte, 16)...)
+	authData = append(authData, 0, byte(len(credID)))
+	authData = append(authData, credID...)
+	rr = executeAuthedRequest(handlePasskeyRegisterFinish, "POST", "/api/passkeys/register/finish", map[string]interface{}{
+		"credential_id": b64url(credID), "client_data_json": b64url(clientData("webauthn.create", reg.Challenge, "http://localhost:8080")),
+		"authenticator_data": b64url(authData), "public_key": b64url(der), "algorithm": PasskeyAlgES256, "name": "Laptop",
+	}, pilot)
+	if rr.Code != 200 || !strings.Contains(rr.Body.String(), "Laptop") {
+		t.Fatalf("Expected the passkey registered, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	login := func(counter byte, origin string) *httptest.ResponseRecorder {
+		rr := executeRequest(handlePasskeyLoginBegin, "POST", "/api/passkeys/login/begin", map[string]string{"username": "pilot"})
+		var ch PasskeyChallenge
+		json.Unmarshal(rr.Body.Bytes(), &ch)
+		if len(ch.Credentials) != 1 || ch.Credentials[0] != b64url(credID) {
+			t.Errorf("Expected the passkey offered, got %s", rr.Body.String())
+		}
+		ad := append(append([]byte{}, rpHash[:]...), 0x01, 0, 0, 0, counter)
+		cd := clientData("webauthn.get", ch.Challenge, origin)
+		cdHash := sha256.Sum256(cd)
+		digest := sha256.Sum256(append(append([]byte{}, ad...), cdHash[:]...))
+		sig, _ := ecdsa.SignASN1(rand.Reader, key, digest[:])
+		return executeRequest(handlePasskeyLoginFinish, "POST", "/api/passkeys/login/finish", map[string]string{
+			"credential_id": b64url(credID), "client_data_json": b64url(cd), "authenticator_data": b64url(ad),
+			"signature": b64url(sig), "user_handle": b64url([]byte(pilot.UserUUID)),
+		})
+	}
+
+	rr = login(1, "http://localhost:8080")
+	var session struct {
+		UserUUID string `json:"user_uuid"`
+		Token    string `json:"session_token"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &session)
+	if rr.Code != 200 || session.UserUUID != pilot.UserUUID || session.Token == "" {
+		t.Fatalf("Expected a passkey login, got %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := login(1, "http://localhost:8080"); rr.Code != 401 {
+		t.Errorf("Expected a stale counter refused, got %d", rr.Code)
+	}
+	if rr := login(2, "https://evil.example"); rr.Code != 401 {
+		t.Errorf("Expected a foreign origin refused, got %d", rr.Code)
+	}
+	if rr := login(2, "http://localhost:8080"); rr.Code != 200 {
+		t.Errorf("Expected the next counter accepted, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+// Test 60: A destroyed fleet leaves a wreck that salvage rigs strip into their hold
+func TestWreckSalvage(t *testing.T) {
+	setupTestEnv(t)
+	fx := seed(t, Seed{
+		Users:   []SeedUser{{Username: "victim"}, {Username: "scav"}},
+		Systems: []SeedSystem{{ID: "sys-3-0-0"}},
+		Fleets: []SeedFleet{
+			{Owner: "victim", System: "sys-3-0-0", HullClass: "Fighter", Modules: []string{"laser", "laser"},
+				Payload: FleetPayload{PopLaborers: 50, Resources: map[string]int{"iron": 1000}, Credits: 900}},
+			{Owner: "scav", System: "sys-3-0-0", HullClass: "Frigate", Modules: []string{"salvage_rig"}, Fuel: 500},
+			{Owner: "scav", System: "sys-3-0-0", HullClass: "Frigate", Fuel: 500},
+		},
+	})
+	scav := fx.Users["scav"]
+	victim := Fleet{ID: fx.Fleets[0], OwnerUUID: fx.Users["victim"].UserUUID, HullClass: "Fighter", Modules: []string{"laser", "laser"}}
+	applyBattleReport(BattleReport{SystemID: "sys-3-0-0", Tick: 10, Participants: []BattleParticipant{
+		{FleetID: victim.ID, OwnerUUID: victim.OwnerUUID, Outcome: "destroyed", KilledBy: scav.UserUUID},
+	}}, []Fleet{victim})
+
+	rr := executeAuthedRequest(handleWrecks, "GET", "/api/wrecks", nil, scav)
+	var wrecks []Wreck
+	json.Unmarshal(rr.Body.Bytes(), &wrecks)
+	if len(wrecks) != 1 {
+		t.Fatalf("Expected one wreck, got %s", rr.Body.String())
+	}
+	// 300 scrap + half of two lasers' materials + half the iron in the hold
+	want := map[string]int{"iron": 300 + 200 + 500, "steel": 20, "diamond": 2}
+	if fmt.Sprint(wrecks[0].Resources) != fmt.Sprint(want) || wrecks[0].ExpiresTick != 10+WreckLifetime {
+		t.Errorf("Unexpected wreck: %+v", wrecks[0])
+	}
+
+	salvage := func(fleetID int) *httptest.ResponseRecorder {
+		return executeAuthedRequest(handleFleetSalvage, "POST", "/api/fleet/salvage", map[string]int{"fleet_id": fleetID, "wreck_id": wrecks[0].ID}, scav)
+	}
+	if rr := salvage(fx.Fleets[2]); rr.Code != 400 {
+		t.Errorf("Expected a fleet without a rig refused, got %d", rr.Code)
+	}
+	rr = salvage(fx.Fleets[1])
+	var res struct {
+		Salvaged map[string]int `json:"salvaged"`
+		Wreck    Wreck          `json:"wreck"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &res)
+	if rr.Code != 200 || res.Salvaged["diamond"] != 2 || res.Salvaged["steel"] != 20 || res.Salvaged["iron"] != 478 || res.Wreck.Resources["iron"] != 522 {
+		t.Errorf("Expected the scarcest materials first: %d %s", rr.Code, rr.Body.String())
+	}
+	var plJson string
+	var fuel int
+	db.QueryRow("SELECT payload_json, fuel FROM fleets WHERE id=?", fx.Fleets[1]).Scan(&plJson, &fuel)
+	var pl FleetPayload
+	json.Unmarshal([]byte(plJson), &pl)
+	if pl.Resources["iron"] != 478 || fuel != 500-SalvageFuel {
+		t.Errorf("Expected the salvage in the hold: %s, fuel %d", plJson, fuel)
+	}
+
+	salvage(fx.Fleets[1])
+	salvage(fx.Fleets[1])
+	if _, err := loadWreck(wrecks[0].ID); err == nil {
+		t.Errorf("Expected a stripped wreck removed")
+	}
+
+	applyBattleReport(BattleReport{SystemID: "sys-3-0-0", Tick: 20, Participants: []BattleParticipant{
+		{FleetID: fx.Fleets[2], OwnerUUID: scav.UserUUID, Outcome: "destroyed"},
+	}}, []Fleet{{ID: fx.Fleets[2], OwnerUUID: scav.UserUUID, HullClass: "Frigate"}})
+	expireWrecks(20 + WreckLifetime)
+	var left int
+	db.QueryRow("SELECT count(*) FROM wrecks").Scan(&left)
+	if left != 0 {
+		t.Errorf("Expected the wreck to expire, %d left", left)
+	}
+}
+
+// Test 61: Cross-node fills settle in two phases: both sides pay out on commit, refund on abort
+func TestCrossNodeSettlement(t *testing.T) {
+	setupTestEnv(t)
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	PrivateKey, PublicKey = priv, pub
+	peerPub, peerPriv, _ := ed25519.GenerateKey(nil)
+	savedPeers := Peers
+	defer func() { Peers = savedPeers }()
+	Peers = map[string]*Peer{"node-b": {UUID: "node-b", PublicKey: peerPub}}
+
+	fx := seed(t, Seed{
+		Users:    []SeedUser{{Username: "merchant", Credits: 100}, {Username: "hauler"}},
+		Systems:  []SeedSystem{{ID: "sys-4-0-0"}},
+		Colonies: []SeedColony{{SystemID: "sys-4-0-0", Owner: "merchant", Laborers: 100, Resources: map[string]int{"iron": 500}}},
+		Fleets:   []SeedFleet{{Owner: "hauler", System: "sys-4-0-0", HullClass: "Frigate", Payload: FleetPayload{Credits: 1000}}},
+	})
+	merchant := fx.Users["merchant"].UserUUID
+	listOrder := func(id, node string) {
+		db.Exec("INSERT INTO market_orders (order_id, seller_uuid, item, quantity, price, is_buy, origin_system, expires_tick, origin_node) VALUES (?, ?, 'iron', 100, 5, 0, 'sys-4-0-0', 1000, ?)",
+			id, merchant, node)
+	}
+	colonyIron := func() (iron int) {
+		db.QueryRow("SELECT iron FROM colonies WHERE id=?", fx.Colonies[0]).Scan(&iron)
+		return
+	}
+
+	// Participant: node-b's fleet fills our merchant's order
+	send := func(m SettlementMessage) SettlementReceipt {
+		m.Sent = time.Now().UnixNano()
+		payload, _ := json.Marshal(SettlementEnvelope{Settlement: &m})
+		body, _ := json.Marshal(TransactionRequest{UUID: "node-b", Tick: atomic.LoadInt64(&CurrentTick), Payload: payload, Signature: ed25519.Sign(peerPriv, payload)})
+		rr := httptest.NewRecorder()
+		handleFederationTransaction(rr, httptest.NewRequest("POST", "/federation/transaction", bytes.NewReader(compressLZ4(body))))
+		var r SettlementReceipt
+		json.Unmarshal(rr.Body.Bytes(), &r)
+		sig, _ := hex.DecodeString(r.Signature)
+		if !VerifySignature(pub, r.signingString(), sig) {
+			t.Errorf("Unsigned receipt for %s: %s", m.Phase, rr.Body.String())
+		}
+		return r
+	}
+	prepare := func(id, order string) SettlementMessage {
+		return SettlementMessage{ID: id, Phase: SettlePrepare, OrderID: order, Item: "iron", Quantity: 100, Price: 5,
+			SystemID: "sys-4-0-0", FleetOwner: "remote-buyer", Deadline: atomic.LoadInt64(&CurrentTick) + SettlementTimeout}
+	}
+
+	listOrder("o-1", "")
+	if r := send(prepare("s-1", "o-1")); r.Outcome != SettleYes || colonyIron() != 400 {
+		t.Fatalf("Expected the goods reserved, got %+v and %d iron", r, colonyIron())
+	}
+	if r := send(prepare("s-1", "o-1")); r.Outcome != SettleYes || colonyIron() != 400 {
+		t.Errorf("Expected a repeated prepare to be idempotent, got %+v", r)
+	}
+	if r := send(SettlementMessage{ID: "s-1", Phase: SettleCommit}); r.Outcome != SettlementCommitted {
+		t.Errorf("Expected a commit, got %+v", r)
+	}
+	var credits int
+	db.QueryRow("SELECT credits FROM users WHERE global_uuid=?", merchant).Scan(&credits)
+	if credits != 600 {
+		t.Errorf("Expected the seller paid 500, has %d", credits)
+	}
+	if r := send(SettlementMessage{ID: "s-1", Phase: SettleAbort}); r.Outcome != SettlementCommitted {
+		t.Errorf("Expected a late abort to find the settlement committed, got %+v", r)
+	}
+
+	listOrder("o-2", "")
+	bad := prepare("s-2", "o-2")
+	bad.Price = 1
+	if r := send(bad); r.Outcome != SettleNo {
+		t.Errorf("Expected changed terms refused, got %+v", r)
+	}
+	send(prepare("s-3", "o-2"))
+	if r := send(SettlementMessage{ID: "s-3", Phase: SettleAbort}); r.Outcome != SettlementAborted || colonyIron() != 400 {
+		t.Errorf("Expected the reservation returned on abort, got %+v and %d iron", r, colonyIron())
+	}
+	var relisted int
+	db.QueryRow("SELECT count(*) FROM market_orders WHERE order_id='o-2'").Scan(&relisted)
+	if relisted != 1 {
+		t.Error("Expected the aborted order back on the market")
+	}
+
+	// Coordinator: our fleet fills node-b's order
+	vote := SettleYes
+	var phases []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var req TransactionRequest
+		json.Unmarshal(decompressLZ4(body), &req)
+		var env SettlementEnvelope
+		json.Unmarshal(req.Payload, &env)
+		phases = append(phases, env.Settlement.Phase)
+		rc := SettlementReceipt{ID: env.Settlement.ID, Phase: env.Settlement.Phase, Node: "node-b", Outcome: vote}
+		if rc.Phase == SettleCommit {
+			rc.Outcome = SettlementCommitted
+		}
+		rc.Signature = hex.EncodeToString(ed25519.Sign(peerPriv, rc.signingString()))
+		json.NewEncoder(w).Encode(rc)
+	}))
+	defer srv.Close()
+	Peers["node-b"].Url = srv.URL
+
+	fleetPayload := func() (pl FleetPayload) {
+		var plJson string
+		db.QueryRow("SELECT payload_json FROM fleets WHERE id=?", fx.Fleets[0]).Scan(&plJson)
+		json.Unmarshal([]byte(plJson), &pl)
+		return
+	}
+	arrive := func(order string) {
+		listOrder(order, "node-b")
+		f := Fleet{ID: fx.Fleets[0], OwnerUUID: fx.Users["hauler"].UserUUID, DestSystem: "sys-4-0-0", Payload: fleetPayload()}
+		prepareSettlement(&f, MarketOrder{ID: order, SellerUUID: merchant, Item: "iron", Quantity: 100, Price: 5, ExpiresTick: 1000}, "node-b")
+	}
+
+	arrive("o-3")
+	if pl := fleetPayload(); pl.Credits != 500 {
+		t.Fatalf("Expected 500 credits in escrow, fleet has %d", pl.Credits)
+	}
+	advanceSettlements(srv.Client())
+	if pl := fleetPayload(); pl.Credits != 500 || pl.Resources["iron"] != 100 || fmt.Sprint(phases) != "[prepare commit]" {
+		t.Errorf("Expected the goods delivered after prepare and commit: %+v %v", pl, phases)
+	}
+
+	vote, phases = SettleNo, nil
+	arrive("o-4")
+	advanceSettlements(srv.Client())
+	if pl := fleetPayload(); pl.Credits != 500 || pl.Resources["iron"] != 100 || fmt.Sprint(phases) != "[prepare]" {
+		t.Errorf("Expected the escrow refunded on a no vote: %+v %v", pl, phases)
+	}
+
+	// A second escrow for the same order in the same tick can't be written; the hold is left as it was
+	listOrder("o-4", "node-b")
+	f := Fleet{ID: fx.Fleets[0], OwnerUUID: fx.Users["hauler"].UserUUID, DestSystem: "sys-4-0-0", Payload: fleetPayload()}
+	prepareSettlement(&f, MarketOrder{ID: "o-4", SellerUUID: merchant, Item: "iron", Quantity: 100, Price: 5, ExpiresTick: 1000}, "node-b")
+	var listed int
+	db.QueryRow("SELECT COUNT(*) FROM market_orders WHERE order_id='o-4'").Scan(&listed)
+	if pl := fleetPayload(); f.Payload.Credits != 500 || pl.Credits != 500 || listed != 1 {
+		t.Errorf("Expected a failed escrow to leave the fleet and order alone, got %d/%d credits and %d orders", f.Payload.Credits, pl.Credits, listed)
+	}
+}
+
+// Test 62: Operator commands read the live schema and back it up
+func TestOperatorCommands(t *testing.T) {
+	setupTestEnv(t)
+	seed(t, Seed{
+		Users:    []SeedUser{{Username: "admiral", Credits: 750}},
+		Systems:  []SeedSystem{{ID: "sys-5-0-0"}},
+		Colonies: []SeedColony{{SystemID: "sys-5-0-0", Owner: "admiral"}},
+	})
+	savePeer(&Peer{UUID: "node-b", Url: "http://b:8080", Relation: 2, Reputation: 12.5, FirstSeen: time.Now(), LastSeen: time.Now()})
+
+	var out bytes.Buffer
+	if err := runOperatorCommand([]string{"users", "list"}, &out); err != nil {
+		t.Fatalf("users list: %v", err)
+	}
+	if !strings.Contains(out.String(), "admiral") || !strings.Contains(out.String(), "750") {
+		t.Errorf("Expected the seeded user listed:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := runOperatorCommand([]string{"peers"}, &out); err != nil {
+		t.Fatalf("peers: %v", err)
+	}
+	if !strings.Contains(out.String(), "node-b") || !strings.Contains(out.String(), "hostile") {
+		t.Errorf("Expected the stored peer listed:\n%s", out.String())
+	}
+
+	dest := filepath.Join(t.TempDir(), "backup.db")
+	if err := runOperatorCommand([]string{"backup", dest}, &out); err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	copyDB, err := openDB("sqlite3", dest, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer copyDB.Close()
+	var n int
+	copyDB.QueryRow("SELECT count(*) FROM users WHERE username='admiral'").Scan(&n)
+	if n != 1 {
+		t.Error("Expected the backup to hold the user")
+	}
+	if err := runOperatorCommand([]string{"backup", dest}, &out); err == nil {
+		t.Error("Expected backup to refuse to overwrite a file")
+	}
+
+	if err := runOperatorCommand([]string{"users", "delete"}, &out); err == nil {
+		t.Error("Expected an unknown users subcommand refused")
+	}
+	if err := runOperatorCommand([]string{"nuke"}, &out); err == nil || !strings.Contains(err.Error(), "usage") {
+		t.Errorf("Expected usage for an unknown command, got %v", err)
+	}
+}
+
+// Test 63: The galaxy index follows inserts, names and owner changes, across cell boundaries
+func TestGalaxyIndex(t *testing.T) {
+	setupTestEnv(t)
+	fx := seed(t, Seed{
+		Users:    []SeedUser{{Username: "cartographer"}},
+		Systems:  []SeedSystem{{ID: "sys--1-0-0", Owner: "cartographer"}, {ID: "sys-0-0-0"}, {ID: "sys-40-0-0"}, {ID: "sys--33-5-5"}},
+		Colonies: []SeedColony{{SystemID: "sys--1-0-0", Owner: "cartographer"}},
+	})
+
+	if c := GetSystemCoords("sys--33-5-5"); fmt.Sprint(c) != "[-33 5 5]" {
+		t.Errorf("Expected indexed coordinates, got %v", c)
+	}
+	if s, ok := systemAt(-1, 0, 0); !ok || s.ID != "sys--1-0-0" || s.Owner != fx.Users["cartographer"].UserUUID {
+		t.Errorf("Expected the seeded system at -1,0,0, got %+v", s)
+	}
+	if _, ok := systemAt(1, 0, 0); ok {
+		t.Error("Expected nothing at 1,0,0")
+	}
+
+	var ids []string
+	for _, s := range systemsInBox([3]int{-33, -1, -1}, [3]int{0, 5, 5}) {
+		ids = append(ids, s.ID)
+	}
+	if fmt.Sprint(ids) != "[sys--1-0-0 sys--33-5-5 sys-0-0-0]" {
+		t.Errorf("Expected the three systems straddling cells, got %v", ids)
+	}
+	if len(allSystems()) != 4 {
+		t.Errorf("Expected 4 systems indexed, got %d", len(allSystems()))
+	}
+
+	// Discovery on arrival charts the system in both the table and the index
+	var x int
+	for x = 100; x < 5000 && !GetSectorData(x, 0, 0).HasSystem; x++ {
+	}
+	resolveDeepSpaceArrival(Fleet{ID: 99, OwnerUUID: fx.Users["cartographer"].UserUUID, DestSystem: fmt.Sprintf("sys-%d-0-0", x)})
+	discovered := fmt.Sprintf("sys-%d-0-0", x)
+	if _, ok := lookupSystem(discovered); !ok {
+		t.Error("Expected the discovered system indexed")
+	}
+
+	applyGossipedName(SystemName{SystemID: discovered, Name: "Lantern", Discoverer: "u1", NamedTick: 5})
+	if s, _ := lookupSystem(discovered); s.Name != "Lantern" {
+		t.Errorf("Expected the gossiped name indexed, got %q", s.Name)
+	}
+
+	declareIndependence(Colony{ID: fx.Colonies[0], SystemID: "sys--1-0-0", OwnerUUID: fx.Users["cartographer"].UserUUID})
+	if s, _ := lookupSystem("sys--1-0-0"); !strings.HasPrefix(s.Owner, FreeFactionPrefix) {
+		t.Errorf("Expected the free faction to own the system in the index, got %q", s.Owner)
+	}
+
+	// A reload from the table sees the same galaxy
+	before := fmt.Sprint(allSystems())
+	loadGalaxyIndex()
+	if after := fmt.Sprint(allSystems()); after != before {
+		t.Errorf("Index drifted from the table:\n%s\n%s", before, after)
+	}
+}
+
+// Test 64: Financial centers earn from the last day's burns and fills at their colony, with diminishing returns
+func TestFinancialCenters(t *testing.T) {
+	setupTestEnv(t)
+	fx := seed(t, Seed{
+		Users:   []SeedUser{{Username: "banker"}, {Username: "miner"}},
+		Systems: []SeedSystem{{ID: "sys-6-0-0"}, {ID: "sys-6-1-0"}},
+		Colonies: []SeedColony{
+			{SystemID: "sys-6-0-0", Owner: "banker", Buildings: map[string]int{"financial_center": 2}},
+			{SystemID: "sys-6-1-0", Owner: "miner"},
+		},
+	})
+	hub, mine := fx.Colonies[0], fx.Colonies[1]
+
+	savedTick := atomic.LoadInt64(&CurrentTick)
+	defer atomic.StoreInt64(&CurrentTick, savedTick)
+	atomic.StoreInt64(&CurrentTick, 2*TicksPerDay)
+	logged := func(tick int64, kind string, rec interface{}) {
+		blob, _ := json.Marshal(rec)
+		db.Exec("INSERT INTO transaction_log (tick, action_type, payload_blob) VALUES (?, ?, ?)", tick, kind, blob)
+	}
+	now := atomic.LoadInt64(&CurrentTick)
+	logged(now-10, "BANK_BURN", BurnRecord{Item: "iron", Amount: 1000, Payout: 4000, ColonyID: hub})
+	logged(now-20, "TRADE_FILL", TradeRecord{Item: "iron", Quantity: 100, Price: 50, ColonyID: hub})
+	logged(now-TicksPerDay-1, "TRADE_FILL", TradeRecord{Item: "iron", Quantity: 1000, Price: 1000, ColonyID: hub}) // too old
+	logged(now-5, "TRADE_FILL", TradeRecord{Item: "iron", Quantity: 1000, Price: 1000, ColonyID: mine})
+
+	if v := colonyVelocity(now); v[hub] != 9000 || v[mine] != 1000000 {
+		t.Fatalf("Expected velocities 9000 and 1000000, got %v", v)
+	}
+
+	payFinancialCenters(now)
+	var banker, miner int
+	db.QueryRow("SELECT credits FROM users WHERE global_uuid=?", fx.Users["banker"].UserUUID).Scan(&banker)
+	db.QueryRow("SELECT credits FROM users WHERE global_uuid=?", fx.Users["miner"].UserUUID).Scan(&miner)
+	if want := int(financeIncome(2, 9000) * FinanceInterval); banker != want || want == 0 {
+		t.Errorf("Expected the banker paid %d, got %d", want, banker)
+	}
+	if miner != 0 {
+		t.Errorf("Expected no income without a financial center, got %d", miner)
+	}
+
+	if one, two := financeIncome(1, 9000), financeIncome(2, 9000); two <= one || two >= 2*one {
+		t.Errorf("Expected a second center to add less than the first: %.3f, %.3f", one, two)
+	}
+	if low, high := financeIncome(1, 10000), financeIncome(1, 1000000); math.Abs(high/low-10) > 0.01 {
+		t.Errorf("Expected 100x the volume to pay 10x, got %.2fx", high/low)
+	}
+}
+
+// Test 65: The change feed records colony, system and order changes per tick and pages by whole ticks
+func TestFederationChangeFeed(t *testing.T) {
+	setupTestEnv(t)
+	savedPeers := Peers
+	savedTick := atomic.LoadInt64(&CurrentTick)
+	defer func() { Peers = savedPeers; atomic.StoreInt64(&CurrentTick, savedTick) }()
+	changeFeed.state = nil
+
+	fx := seed(t, Seed{
+		Users:    []SeedUser{{Username: "builder"}},
+		Systems:  []SeedSystem{{ID: "sys-7-0-0"}},
+		Colonies: []SeedColony{{SystemID: "sys-7-0-0", Owner: "builder", Laborers: 100}},
+	})
+	col := fx.Colonies[0]
+
+	recordChanges(10)
+	db.Exec("UPDATE colonies SET buildings_json='{\"farm\": 2}' WHERE id=?", col)
+	db.Exec("UPDATE solar_systems SET owner_uuid='claimant' WHERE id='sys-7-0-0'")
+	reindexSystem("sys-7-0-0")
+	db.Exec("INSERT INTO market_orders (order_id, seller_uuid, item, quantity, price, is_buy, origin_system, expires_tick) VALUES ('o-1', ?, 'iron', 10, 5, 0, 'sys-7-0-0', 500)",
+		fx.Users["builder"].UserUUID)
+	recordChanges(11)
+	recordChanges(12) // nothing moved
+	db.Exec("DELETE FROM market_orders WHERE order_id='o-1'")
+	recordChanges(13)
+
+	atomic.StoreInt64(&CurrentTick, 13)
+	feed := func(query string) (int, []ChangeRecord, int64, bool) {
+		rr := executeRequest(handleFederationChanges, "GET", "/federation/changes?"+query, nil)
+		var body struct {
+			Changes []ChangeRecord `json:"changes"`
+			Next    int64          `json:"next_since_tick"`
+			More    bool           `json:"more"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &body)
+		return rr.Code, body.Changes, body.Next, body.More
+	}
+
+	_, all, next, more := feed("since_tick=0")
+	var got []string
+	for _, c := range all {
+		got = append(got, fmt.Sprintf("%d:%s:%s:%v", c.Tick, c.Kind, c.ID, c.Removed))
+	}
+	want := fmt.Sprintf("[10:resync::false 11:colony:%d:false 11:system:sys-7-0-0:false 11:order:o-1:false 13:order:o-1:true]", col)
+	if fmt.Sprint(got) != want || next != 13 || more {
+		t.Fatalf("Unexpected feed %v (next %d, more %v)", got, next, more)
+	}
+	var pc PublicColony
+	json.Unmarshal(all[1].Data, &pc)
+	if pc.Buildings["farm"] != 2 || pc.PopLaborers != 100 {
+		t.Errorf("Expected the colony's public state, got %+v", pc)
+	}
+
+	// A page never splits a tick
+	if _, page, next, more := feed("since_tick=10&limit=2"); len(page) != 3 || next != 11 || !more {
+		t.Errorf("Expected all of tick 11 in one page, got %d records (next %d, more %v)", len(page), next, more)
+	}
+	if _, page, _, _ := feed("since_tick=0&limit=3"); len(page) != 1 || page[0].Kind != ChangeResync {
+		t.Errorf("Expected the page to stop before the split tick, got %+v", page)
+	}
+
+	Peers = map[string]*Peer{"enemy": {UUID: "enemy", Relation: 2}}
+	req := httptest.NewRequest("GET", "/federation/changes?since_tick=0", nil)
+	req.Header.Set(HeaderFedNode, "enemy")
+	rr := httptest.NewRecorder()
+	handleFederationChanges(rr, req)
+	if rr.Code != 403 {
+		t.Errorf("Expected a hostile peer refused, got %d", rr.Code)
+	}
+
+	atomic.StoreInt64(&CurrentTick, 13+ChangeFeedRetention+1)
+	if code, _, _, _ := feed("since_tick=0"); code != 410 {
+		t.Errorf("Expected 410 past retention, got %d", code)
+	}
+}
+
+// Test 66: Boarding pods take crippled ships; the prize changes hands stripped of crew and sabotaged modules
+func TestFleetBoarding(t *testing.T) {
+	setupTestEnv(t)
+	if validateModules("Fighter", []string{"laser", "laser", "laser", "laser", "boarding_pod"}) {
+		t.Errorf("Expected a boarding pod to take a weapon slot")
+	}
+
+	fleets := func() []Fleet {
+		return []Fleet{
+			{ID: 1, OwnerUUID: "pirate", HullClass: "Fighter", Modules: []string{"laser", "laser", "boarding_pod"},
+				Payload: FleetPayload{PopSpecialists: 200}},
+			{ID: 2, OwnerUUID: "trader", HullClass: "Frigate", Modules: []string{"booster"}},
+		}
+	}
+	captures := 0
+	for tick := int64(1); tick <= 40; tick++ {
+		report := resolveBattle("sys-4-0-0", fleets(), tick)
+		for _, p := range report.Participants {
+			if p.FleetID == 2 && p.Outcome == "captured" {
+				captures++
+				if p.CapturedBy != "pirate" || p.EndHP > p.StartHP/2 || len(p.Sabotaged) > 1 {
+					t.Errorf("Unexpected capture: %+v", p)
+				}
+			}
+			if p.FleetID == 1 && p.Outcome == "captured" {
+				t.Errorf("The unarmed trader can't board: %+v", report)
+			}
+		}
+	}
+	if captures == 0 {
+		t.Errorf("Expected some battles to end in a capture")
+	}
+
+	fx := seed(t, Seed{
+		Users:   []SeedUser{{Username: "pirate"}, {Username: "trader"}},
+		Systems: []SeedSystem{{ID: "sys-4-0-0"}},
+		Fleets: []SeedFleet{
+			{Owner: "pirate", System: "sys-4-0-0", HullClass: "Fighter", Modules: []string{"laser", "laser", "boarding_pod"},
+				Payload: FleetPayload{PopSpecialists: 40}},
+			{Owner: "trader", System: "sys-4-0-0", HullClass: "Frigate", Modules: []string{"booster", "laser", "laser"},
+				Payload: FleetPayload{PopLaborers: 500, Resources: map[string]int{"iron": 800}}},
+		},
+	})
+	pirate, trader := fx.Users["pirate"].UserUUID, fx.Users["trader"].UserUUID
+	boarder := Fleet{ID: fx.Fleets[0], OwnerUUID: pirate, HullClass: "Fighter", Modules: []string{"laser", "laser", "boarding_pod"},
+		Payload: FleetPayload{PopSpecialists: 40}}
+	prize := Fleet{ID: fx.Fleets[1], OwnerUUID: trader, HullClass: "Frigate", Modules: []string{"booster", "laser", "laser"},
+		Payload: FleetPayload{PopLaborers: 500, Resources: map[string]int{"iron": 800}}}
+	applyBattleReport(BattleReport{SystemID: "sys-4-0-0", Tick: 10, Participants: []BattleParticipant{
+		{FleetID: boarder.ID, OwnerUUID: pirate, Outcome: "held", MarinesLost: 8},
+		{FleetID: prize.ID, OwnerUUID: trader, Outcome: "captured", CapturedBy: pirate, Sabotaged: []string{"laser"}},
+	}}, []Fleet{boarder, prize})
+
+	var owner, status, modJson, plJson string
+	db.QueryRow("SELECT owner_uuid, status, modules_json, payload_json FROM fleets WHERE id=?", prize.ID).Scan(&owner, &status, &modJson, &plJson)
+	var pl FleetPayload
+	json.Unmarshal([]byte(plJson), &pl)
+	if owner != pirate || status != "ORBIT" || modJson != `["booster","laser"]` || pl.PopLaborers != 0 || pl.Resources["iron"] != 800 {
+		t.Errorf("Unexpected prize: owner %s, %s, %s, %s", owner, status, modJson, plJson)
+	}
+
+	db.QueryRow("SELECT payload_json FROM fleets WHERE id=?", boarder.ID).Scan(&plJson)
+	json.Unmarshal([]byte(plJson), &pl)
+	if pl.PopSpecialists != 32 {
+		t.Errorf("Expected the marines lost to come out of the specialists, got %s", plJson)
+	}
+
+	var damage int
+	db.QueryRow("SELECT COALESCE(SUM(damage_amount), 0) FROM grievances WHERE offender_uuid=? AND victim_uuid=?", pirate, trader).Scan(&damage)
+	if damage != CaptureInfamy {
+		t.Errorf("Expected a capture to cost %d infamy, got %d", CaptureInfamy, damage)
+	}
+}
+
+type testMailer struct{ sent []string }
+
+func (m *testMailer) Send(to, subject, body string) error {
+	m.sent = append(m.sent, to+"|"+body)
+	return nil
+}
+
+// Test 67: A verified email or a recovery code resets a forgotten password and re-encrypts the key
+func TestAccountRecovery(t *testing.T) {
+	setupTestEnv(t)
+	savedMailer := mailer
+	defer func() { mailer = savedMailer }()
+
+	mailer = nil
+	rr := executeRequest(handleRegister, "POST", "/api/register", map[string]string{"username": "nomail", "password": "pw", "email": "a@example.com"})
+	if rr.Code != 503 {
+		t.Errorf("Expected email refused without a mailer, got %d", rr.Code)
+	}
+
+	mail := &testMailer{}
+	mailer = mail
+	rr = executeRequest(handleRegister, "POST", "/api/register", map[string]interface{}{
+		"username": "alice", "password": "old-password", "email": "alice@example.com", "recovery_code": true,
+	})
+	var reg struct {
+		UserUUID     string `json:"user_uuid"`
+		SessionToken string `json:"session_token"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &reg)
+	if rr.Code != 200 || reg.RecoveryCode == "" || len(mail.sent) != 1 {
+		t.Fatalf("Expected a code and a verification mail: %d %s", rr.Code, rr.Body.String())
+	}
+	alice := SeedSession{UserUUID: reg.UserUUID, Token: reg.SessionToken}
+	tokenIn := func(msg string) string { return regexp.MustCompile(`[0-9a-f]{64}`).FindString(msg) }
+	reset := func(body map[string]string) *httptest.ResponseRecorder {
+		body["username"] = "alice"
+		return executeRequest(handleAccountReset, "POST", "/api/account/reset", body)
+	}
+	original, _ := unlockUserKey(alice.UserUUID, "old-password")
+
+	// Unverified addresses get no reset mail
+	executeRequest(handleAccountResetRequest, "POST", "/api/account/reset/request", map[string]string{"username": "alice"})
+	if len(mail.sent) != 1 {
+		t.Errorf("Expected no reset mail before verification")
+	}
+	if rr := executeRequest(handleAccountVerify, "POST", "/api/account/verify", map[string]string{"token": tokenIn(mail.sent[0])}); rr.Code != 200 {
+		t.Fatalf("Verification failed: %d %s", rr.Code, rr.Body.String())
+	}
+	rr = executeAuthedRequest(handleAccountRecovery, "GET", "/api/account/recovery", nil, alice)
+	var status RecoveryStatus
+	json.Unmarshal(rr.Body.Bytes(), &status)
+	if !status.EmailVerified || !status.RecoveryCode || status.Email != "alice@example.com" {
+		t.Errorf("Unexpected recovery status: %s", rr.Body.String())
+	}
+
+	for i := 0; i < 2; i++ {
+		if rr := executeRequest(handleAccountResetRequest, "POST", "/api/account/reset/request", map[string]string{"username": "alice"}); rr.Code != 202 {
+			t.Errorf("Expected 202, got %d", rr.Code)
+		}
+	}
+	if len(mail.sent) != 2 {
+		t.Fatalf("Expected one reset mail per interval, got %d mails", len(mail.sent))
+	}
+	token := tokenIn(mail.sent[1])
+	if rr := reset(map[string]string{"token": token, "new_password": "new-password"}); rr.Code != 200 {
+		t.Fatalf("Reset failed: %d %s", rr.Code, rr.Body.String())
+	}
+	if _, err := unlockUserKey(alice.UserUUID, "old-password"); err == nil {
+		t.Errorf("Expected the old password to stop working")
+	}
+	key, err := unlockUserKey(alice.UserUUID, "new-password")
+	if err != nil || !bytes.Equal(key, original) {
+		t.Errorf("Expected the same key under the new password: %v", err)
+	}
+	if rr := reset(map[string]string{"token": token, "new_password": "again"}); rr.Code != 403 {
+		t.Errorf("Expected a used token refused, got %d", rr.Code)
+	}
+
+	// Codes work without dashes or case, once
+	code := strings.ToLower(strings.ReplaceAll(reg.RecoveryCode, "-", ""))
+	if rr := reset(map[string]string{"recovery_code": code, "new_password": "third-password"}); rr.Code != 200 {
+		t.Fatalf("Code reset failed: %d %s", rr.Code, rr.Body.String())
+	}
+	if key, err := unlockUserKey(alice.UserUUID, "third-password"); err != nil || !bytes.Equal(key, original) {
+		t.Errorf("Expected the key under the code's new password: %v", err)
+	}
+	if rr := reset(map[string]string{"recovery_code": code, "new_password": "fourth"}); rr.Code != 403 {
+		t.Errorf("Expected a used code refused, got %d", rr.Code)
+	}
+	if rr := reset(map[string]string{"recovery_code": "WRONG", "new_password": "fifth"}); rr.Code != 403 && rr.Code != 429 {
+		t.Errorf("Expected a bad code refused, got %d", rr.Code)
+	}
+}
+
+// Test 68: Session tokens lapse after SessionTTL and can be swapped for a fresh one before then
+func TestSessionExpiryAndRefresh(t *testing.T) {
+	setupTestEnv(t)
+	fx := seed(t, Seed{Users: []SeedUser{{Username: "sleeper"}}})
+	old := fx.Users["sleeper"]
+
+	rr := executeAuthedRequest(handleSessionRefresh, "POST", "/api/session/refresh", nil, old)
+	var fresh struct {
+		Token     string `json:"session_token"`
+		ExpiresAt int64  `json:"expires_at"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &fresh)
+	if rr.Code != 200 || fresh.Token == "" || fresh.Token == old.Token || fresh.ExpiresAt < time.Now().Add(SessionTTL-time.Minute).Unix() {
+		t.Fatalf("Unexpected refresh: %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := executeAuthedRequest(handleState, "GET", "/api/state", nil, old); rr.Code != 401 {
+		t.Errorf("Expected the old token retired, got %d", rr.Code)
+	}
+	renewed := SeedSession{UserUUID: old.UserUUID, Token: fresh.Token}
+	if rr := executeAuthedRequest(handleState, "GET", "/api/state", nil, renewed); rr.Code != 200 {
+		t.Errorf("Expected the new token to work, got %d", rr.Code)
+	}
+
+	db.Exec("UPDATE users SET expires_at=? WHERE global_uuid=?", time.Now().Add(-time.Second).Unix(), old.UserUUID)
+	invalidateSessions(old.UserUUID)
+	if rr := executeAuthedRequest(handleState, "GET", "/api/state", nil, renewed); rr.Code != 401 {
+		t.Errorf("Expected a lapsed token refused, got %d", rr.Code)
+	}
+	if rr := executeAuthedRequest(handleSessionRefresh, "POST", "/api/session/refresh", nil, renewed); rr.Code != 401 {
+		t.Errorf("Expected a lapsed token not to refresh, got %d", rr.Code)
+	}
+
+	// Tokens from before expiry existed get a lifetime on upgrade
+	db.Exec("UPDATE users SET expires_at=0 WHERE global_uuid=?", old.UserUUID)
+	createSchema()
+	if rr := executeAuthedRequest(handleState, "GET", "/api/state", nil, renewed); rr.Code != 200 {
+		t.Errorf("Expected a legacy session kept through the upgrade, got %d", rr.Code)
+	}
+}
+
+// Test 69: /api/login tells a missing account from a wrong password, outlives closed registration and limits per address
+func TestDedicatedLogin(t *testing.T) {
+	setupTestEnv(t)
+	defer func() { Config.RegistrationClosed = false }()
+	executeRequest(handleRegister, "POST", "/api/register", map[string]string{"username": "pilot", "password": "hunter2"})
+
+	code := func(rr *httptest.ResponseRecorder) string {
+		var e struct {
+			Error V2Error `json:"error"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &e)
+		return e.Error.Code
+	}
+	login := func(user, pass string) *httptest.ResponseRecorder {
+		return executeRequest(handleLogin, "POST", "/api/login", map[string]string{"username": user, "password": pass})
+	}
+
+	if rr := login("nobody", "x"); rr.Code != 404 || code(rr) != "user_not_found" {
+		t.Errorf("Expected user_not_found, got %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := login("pilot", "wrong"); rr.Code != 401 || code(rr) != "wrong_password" {
+		t.Errorf("Expected wrong_password, got %d %s", rr.Code, rr.Body.String())
+	}
+	var n int
+	db.QueryRow("SELECT count(*) FROM users WHERE username='nobody'").Scan(&n)
+	if n != 0 {
+		t.Errorf("Login must never create an account")
+	}
+
+	Config.RegistrationClosed = true
+	rr := login("pilot", "hunter2")
+	var s struct {
+		Status       string `json:"status"`
+		FailedLogins int    `json:"failed_logins"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &s)
+	if rr.Code != 200 || s.Status != "logged_in" || s.FailedLogins != 1 {
+		t.Errorf("Expected a login with registration closed: %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := executeRequest(handleRegister, "POST", "/api/register", map[string]string{"username": "latecomer", "password": "pw"}); rr.Code != 403 {
+		t.Errorf("Expected closed registration refused, got %d", rr.Code)
+	}
+
+	for i := 0; i < LoginFreeAttempts; i++ {
+		login("pilot", "wrong")
+	}
+	if rr := login("pilot", "hunter2"); rr.Code != 429 || code(rr) != "account_throttled" || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected account_throttled, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	defer delete(loginLimiters, "203.0.113.9")
+	last := 0
+	for i := 0; i <= LoginIPBurst; i++ {
+		body, _ := json.Marshal(map[string]string{"username": "nobody", "password": "x"})
+		req, _ := http.NewRequest("POST", "/api/login", bytes.NewBuffer(body))
+		req.RemoteAddr = "203.0.113.9:5555"
+		rr := httptest.NewRecorder()
+		handleLogin(rr, req)
+		last = rr.Code
+	}
+	if last != 429 {
+		t.Errorf("Expected the address limited after %d attempts, got %d", LoginIPBurst, last)
+	}
+}
+
+// Test 70: Colony automation burns surpluses down to the threshold and lists one buy order per shortfall
+func TestColonyAutomation(t *testing.T) {
+	setupTestEnv(t)
+	defer func() { autoBuyPlaced.ticks = make(map[string]int64) }()
+	fx := seed(t, Seed{
+		Users: []SeedUser{{Username: "miner"}, {Username: "trader", Credits: 1000}},
+		Colonies: []SeedColony{
+			{SystemID: "sys-1-1-1", Owner: "miner", Resources: map[string]int{"iron": 60000}},
+			{SystemID: "sys-6-6-6", Owner: "trader", Resources: map[string]int{"food": 100}, Buildings: map[string]int{"trading_post": 1}},
+		},
+	})
+	miner, trader := fx.Users["miner"], fx.Users["trader"]
+	mine, post := fx.Colonies[0], fx.Colonies[1]
+
+	set := func(colonyID int, a ColonyAutomation, as SeedSession) *httptest.ResponseRecorder {
+		return executeAuthedRequest(handleSetPolicy, "POST", "/api/colony/policy", map[string]interface{}{"colony_id": colonyID, "automation": a}, as)
+	}
+	circular := ColonyAutomation{
+		Burn: map[string]AutoBurnRule{"food": {Above: 1000}},
+		Buy:  map[string]AutoBuyRule{"food": {Below: 5000, Quantity: 100, MaxPrice: 10}},
+	}
+	if rr := set(post, circular, trader); rr.Code != 400 {
+		t.Errorf("Expected burning above a buy threshold refused, got %d", rr.Code)
+	}
+	if rr := set(mine, ColonyAutomation{Burn: map[string]AutoBurnRule{"unobtainium": {Above: 1}}}, miner); rr.Code != 400 {
+		t.Errorf("Expected an unknown resource refused, got %d", rr.Code)
+	}
+	if rr := set(mine, ColonyAutomation{Burn: map[string]AutoBurnRule{"iron": {Above: 50000, MaxPerTick: 2000}}}, miner); rr.Code != 200 {
+		t.Fatalf("Set burn rule failed: %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := set(post, ColonyAutomation{Buy: map[string]AutoBuyRule{"food": {Below: 5000, Quantity: 1000, MaxPrice: 12}}}, trader); rr.Code != 200 {
+		t.Fatalf("Set buy rule failed: %d %s", rr.Code, rr.Body.String())
+	}
+
+	runColonyAutomation(10)
+	var iron, credits, burns int
+	db.QueryRow("SELECT iron FROM colonies WHERE id=?", mine).Scan(&iron)
+	db.QueryRow("SELECT credits FROM users WHERE global_uuid=?", miner.UserUUID).Scan(&credits)
+	db.QueryRow("SELECT count(*) FROM transaction_log WHERE action_type='BANK_BURN'").Scan(&burns)
+	if iron != 58000 || credits <= 0 || burns != 1 {
+		t.Errorf("Expected 2000 iron burned for credits, got %d iron, %d credits, %d burns", iron, credits, burns)
+	}
+
+	var orders, price int
+	db.QueryRow("SELECT count(*), COALESCE(MAX(price), 0) FROM market_orders WHERE seller_uuid=? AND is_buy=1 AND order_id LIKE 'auto-%'", trader.UserUUID).Scan(&orders, &price)
+	db.QueryRow("SELECT credits FROM users WHERE global_uuid=?", trader.UserUUID).Scan(&credits)
+	if orders != 1 || price != 12 || credits >= 1000 {
+		t.Errorf("Expected one auto buy order with the fee charged, got %d orders at %d, %d credits", orders, price, credits)
+	}
+
+	autoBuyPlaced.ticks = make(map[string]int64)
+	runColonyAutomation(11)
+	db.QueryRow("SELECT count(*) FROM market_orders WHERE seller_uuid=?", trader.UserUUID).Scan(&orders)
+	if orders != 1 {
+		t.Errorf("Expected no second order while the first is listed, got %d", orders)
+	}
+}
+
+// Test 71: The federation roster shows who vouched for each member and how its standing changed
+func TestFederationRoster(t *testing.T) {
+	setupTestEnv(t)
+	defer func(old map[string]*Peer) { Peers = old }(Peers)
+	Peers = map[string]*Peer{}
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	PrivateKey, PublicKey = priv, pub
+	admit := func(uuid, invite string) {
+		pub, _, _ := ed25519.GenerateKey(nil)
+		admitPeer(HandshakeRequest{UUID: uuid, Address: "http://127.0.0.1:1", GenesisHash: GenesisHash, InviteToken: invite}, pub)
+	}
+
+	token, claims, err := mintInvite(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	admit("node-invited", token)
+	db.Exec("INSERT INTO immigration_queue (uuid, request_json, priority, status) VALUES ('node-approved', '{}', ?, 'pending')", ImmigrationInvited)
+	admit("node-approved", "")
+	admit("node-open", "")
+
+	peerLock.Lock()
+	Peers["node-approved"].Relation = 2
+	savePeer(Peers["node-approved"])
+	Peers["node-open"].LastSeen = time.Now().Add(-time.Hour)
+	peerLock.Unlock()
+	pruneDeadPeers()
+	admit("node-open", "")
+	peerLock.Lock()
+	delete(Peers, "node-open")
+	peerLock.Unlock()
+
+	rr := executeRequest(handleFederationRoster, "GET", "/federation/roster", nil)
+	var out struct {
+		Members []RosterEntry `json:"members"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &out)
+	members := map[string]RosterEntry{}
+	for _, m := range out.Members {
+		members[m.UUID] = m
+	}
+	if rr.Code != 200 || len(members) != 3 {
+		t.Fatalf("Expected 3 members, got %d %s", rr.Code, rr.Body.String())
+	}
+	if m := members["node-invited"]; m.Via != VouchInvite || m.VouchedBy != ServerUUID || m.Status != "online" || !strings.Contains(m.History[0].Detail, claims.ID) {
+		t.Errorf("Expected the invite and its issuer on record, got %+v", m)
+	}
+	if m := members["node-approved"]; m.Via != VouchOperator || m.Relation != "hostile" || len(m.History) != 2 || m.History[1].Detail != "neutral -> hostile" {
+		t.Errorf("Expected an operator admission then a relation change, got %+v", m)
+	}
+	m := members["node-open"]
+	var events []string
+	for _, h := range m.History {
+		events = append(events, h.Event)
+	}
+	if m.Via != VouchOpen || m.VouchedBy != "" || m.Status != "offline" || strings.Join(events, ",") != "joined,pruned,rejoined" {
+		t.Errorf("Expected an open admission, a prune and a return, got %+v", m)
+	}
+
+	req, _ := http.NewRequest("GET", "/federation/roster", nil)
+	req.Header.Set(HeaderFedNode, "node-approved")
+	rr = httptest.NewRecorder()
+	handleFederationRoster(rr, req)
+	if rr.Code != 403 {
+		t.Errorf("Expected a hostile peer refused, got %d", rr.Code)
+	}
+}
+
+// Test 72: War shocks a colony's stability and sends refugees to the owner's nearest stable colony
+func TestWarRefugees(t *testing.T) {
+	setupTestEnv(t)
+	fx := seed(t, Seed{
+		Users:   []SeedUser{{Username: "lord"}, {Username: "hermit"}},
+		Systems: []SeedSystem{{ID: "sys-0-0-0"}, {ID: "sys-1-0-0"}, {ID: "sys-5-0-0"}, {ID: "sys-50-0-0"}, {ID: "sys-90-0-0"}},
+		Colonies: []SeedColony{
+			{SystemID: "sys-0-0-0", Owner: "lord", Laborers: 1000},
+			{SystemID: "sys-1-0-0", Owner: "lord", Laborers: 100, Resources: map[string]int{"food": 1000}},
+			{SystemID: "sys-5-0-0", Owner: "lord", Laborers: 100, Resources: map[string]int{"food": 1000}},
+			{SystemID: "sys-50-0-0", Owner: "lord", Laborers: 100},
+			{SystemID: "sys-90-0-0", Owner: "hermit", Laborers: 1000},
+		},
+	})
+	front, restless, haven := fx.Colonies[0], fx.Colonies[1], fx.Colonies[2]
+	db.Exec("UPDATE colonies SET stability_current=30 WHERE id=?", restless)
+
+	shockSystem("sys-0-0-0", 10)
+	var stability float64
+	var laborers int
+	db.QueryRow("SELECT stability_current, pop_laborers FROM colonies WHERE id=?", front).Scan(&stability, &laborers)
+	flows := refugeeFlows(fx.Users["lord"].UserUUID)
+	if stability != 100-BattleShock || laborers != 980 || len(flows) != 1 || flows[0].To != haven || flows[0].Remaining != 20 {
+		t.Fatalf("Expected a shock and 20 refugees bound for the nearest stable colony, got %.0f stability, %d laborers, %+v", stability, laborers, flows)
+	}
+
+	for i := 0; i < RefugeeWaveTicks; i++ {
+		moveRefugees()
+	}
+	var food int
+	db.QueryRow("SELECT pop_laborers, food FROM colonies WHERE id=?", haven).Scan(&laborers, &food)
+	if laborers != 120 || food != 1000-20*RefugeeRations || len(refugeeFlows(fx.Users["lord"].UserUUID)) != 0 {
+		t.Errorf("Expected all 20 taken in and fed, got %d laborers, %d food", laborers, food)
+	}
+
+	// Nowhere to go: the hermit's people stay home
+	if fled := warShock(fx.Colonies[4], BombardmentShock, BombardmentRefugeeShare, "bombardment", 10); fled != 0 {
+		t.Errorf("Expected no refugees without a haven, got %d", fled)
+	}
+	db.QueryRow("SELECT stability_current, pop_laborers FROM colonies WHERE id=?", fx.Colonies[4]).Scan(&stability, &laborers)
+	if stability != 100-BombardmentShock || laborers != 1000 {
+		t.Errorf("Expected the shock without an exodus, got %.0f stability, %d laborers", stability, laborers)
+	}
+}
+
+// Test 73: /api/events pushes the user's events and ticks over a WebSocket
+func TestEventStream(t *testing.T) {
+	setupTestEnv(t)
+	fx := seed(t, Seed{Users: []SeedUser{{Username: "watcher"}, {Username: "other"}}})
+	watcher := fx.Users["watcher"]
+	srv := httptest.NewServer(middlewareAuth(http.HandlerFunc(handleEvents)))
+	defer srv.Close()
+
+	rr := executeAuthedRequest(handleEvents, "GET", "/api/events", nil, watcher)
+	var world []WorldEvent
+	if rr.Code != 200 || json.Unmarshal(rr.Body.Bytes(), &world) != nil {
+		t.Errorf("Expected a plain GET to list world events, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	fmt.Fprintf(conn, "GET /api/events?user_uuid=%s&token=%s HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n", watcher.UserUUID, watcher.Token)
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil || resp.StatusCode != 101 || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Expected the upgrade accepted, got %v %v", resp, err)
+	}
+
+	// Server frames are unmasked and short here
+	readMsg := func() (byte, WebhookEnvelope) {
+		var head [2]byte
+		io.ReadFull(br, head[:])
+		payload := make([]byte, head[1]&0x7F)
+		if head[1]&0x7F == 126 {
+			var ext [2]byte
+			io.ReadFull(br, ext[:])
+			payload = make([]byte, int(ext[0])<<8|int(ext[1]))
+		}
+		io.ReadFull(br, payload)
+		var env WebhookEnvelope
+		json.Unmarshal(payload, &env)
+		return head[0] & 0x0F, env
+	}
+
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(5 * time.Millisecond) {
+		eventStreams.Lock()
+		n := len(eventStreams.byOwner[watcher.UserUUID])
+		eventStreams.Unlock()
+		if n == 1 || time.Now().After(deadline) {
+			break
+		}
+	}
+	emitEvent(fx.Users["other"].UserUUID, EventOrderFilled, map[string]int{"order": 1})
+	emitEvent(watcher.UserUUID, EventFleetArrival, map[string]int{"fleet_id": 7})
+	broadcastTick(42)
+	if op, env := readMsg(); op != wsOpText || env.Event != EventFleetArrival {
+		t.Errorf("Expected the watcher's fleet arrival first, got %d %+v", op, env)
+	}
+	if _, env := readMsg(); env.Event != EventTick || env.Tick != 42 {
+		t.Errorf("Expected a tick message, got %+v", env)
+	}
+
+	// A masked close from the client is answered in kind
+	conn.Write([]byte{0x88, 0x80, 1, 2, 3, 4})
+	if op, _ := readMsg(); op != wsOpClose {
+		t.Errorf("Expected a close frame back, got opcode %d", op)
+	}
+
+	s, _ := subscribeEvents("slow-reader")
+	for i := 0; i <= EventStreamBuffer; i++ {
+		pushEvent("slow-reader", []byte("{}"))
+	}
+	if !s.dropped {
+		t.Error("Expected a stream with a full buffer dropped")
+	}
+	unsubscribeEvents(s)
+}
+
+// Test 74: Federation bodies round-trip as protobuf or JSON, and handshakes fall back to JSON for older nodes
+func TestProtobufWire(t *testing.T) {
+	setupTestEnv(t)
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	PrivateKey, PublicKey = priv, pub
+	setFeatureFlag(FeatureProtobufWire, true)
+
+	hb := HeartbeatRequest{
+		UUID: "node-a", Tick: 42, PeerCount: 3, GenHash: "gen", Signature: "sig",
+		MarketOrders: []MarketOrder{{ID: "o1", SellerUUID: "s", Item: "iron", Quantity: 5, Price: 7, IsBuy: true, OriginSystem: "sys-1-2-3", ExpiresTick: 99, RelayCount: 1, Node: "node-b"}},
+		Neighbors:    []string{"http://b"},
+		SystemNames:  []SystemName{{SystemID: "sys-1-2-3", Name: "Vega", Discoverer: "u", NamedTick: 4}},
+		Tolls:        TollSchedule{Transit: 2, TradePct: 0.05},
+		Economy:      &EconomyControls{BurnRate: 1, MarketFee: 0.02, Upkeep: 1.5},
+		Vision:       [][]int{{1, 2, 3}},
+		Beacons:      []Beacon{{ID: 1, Name: "Gate", X: 1, Y: 2, Z: 3, Shared: true, OwnerUUID: "u", Node: "node-a"}},
+		Supply:       map[string]SupplyVolume{"iron": {Recent: 10, Baseline: 20}},
+	}
+	for _, asProto := range []bool{true, false} {
+		body, ct := encodeFederation(hb, asProto)
+		if (ct == FedContentProto) != asProto {
+			t.Fatalf("Expected protobuf=%v, got content type %s", asProto, ct)
+		}
+		r := httptest.NewRequest("POST", "/federation/heartbeat", nil)
+		r.Header.Set("Content-Type", ct)
+		var got HeartbeatRequest
+		if err := decodeFederation(r, body, &got); err != nil || !reflect.DeepEqual(got, hb) {
+			t.Errorf("Expected the heartbeat back over %s, got %+v (%v)", ct, got, err)
+		}
+	}
+
+	if !speaksProto(Peer{Features: []string{FeatureProtobufWire}}) || speaksProto(Peer{}) {
+		t.Error("Expected protobuf only for peers advertising it")
+	}
+	setFeatureFlag(FeatureProtobufWire, false)
+	if speaksProto(Peer{Features: []string{FeatureProtobufWire}}) {
+		t.Error("Expected JSON only with the feature switched off")
+	}
+	setFeatureFlag(FeatureProtobufWire, true)
+
+	// An older node can't read protobuf and rejects it; the handshake is sent again as JSON
+	var seen []string
+	old := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, r.Header.Get("Content-Type"))
+		body, _ := io.ReadAll(r.Body)
+		var hs HandshakeRequest
+		if json.Unmarshal(decompressLZ4(body), &hs) != nil || hs.UUID == "" {
+			http.Error(w, "Unauthorized: handshake does not match sender", 401)
+			return
+		}
+		json.NewEncoder(w).Encode(HandshakeResponse{Status: HandshakeAccepted})
+	}))
+	defer old.Close()
+	resp, err := postHandshake(old.Client(), old.URL+"/federation/handshake", HandshakeRequest{UUID: "node-a", Location: []int{1, 2, 3}})
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("Expected the JSON retry accepted, got %v %v", resp, err)
+	}
+	resp.Body.Close()
+	if len(seen) != 2 || seen[0] != FedContentProto || seen[1] != FedContentJSON {
+		t.Errorf("Expected protobuf then JSON, got %v", seen)
+	}
+}
+
+// Test 75: Preferences are stored per user and namespace, versioned, and held to their quotas
+func TestPreferences(t *testing.T) {
+	setupTestEnv(t)
+	fx := seed(t, Seed{Users: []SeedUser{{Username: "web"}, {Username: "other"}}})
+	user := fx.Users["web"]
+	set := func(body map[string]interface{}, s SeedSession) (int, Preference) {
+		rr := executeAuthedRequest(handlePreferences, "POST", "/api/preferences", body, s)
+		var p Preference
+		json.Unmarshal(rr.Body.Bytes(), &p)
+		return rr.Code, p
+	}
+
+	code, p := set(map[string]interface{}{"namespace": "ui", "value": map[string]interface{}{"theme": "dark", "panels": []string{"map", "fleet"}}}, user)
+	if code != 200 || p.Version != 1 || string(p.Value) != `{"panels":["map","fleet"],"theme":"dark"}` {
+		t.Fatalf("Expected ui stored at version 1, got %d %+v", code, p)
+	}
+	// Another client read version 1; a write based on version 0 loses and gets the current value
+	if code, p = set(map[string]interface{}{"namespace": "ui", "value": "light", "version": 0}, user); code != 409 || p.Version != 1 {
+		t.Errorf("Expected a stale write refused with the current value, got %d %+v", code, p)
+	}
+	if code, p = set(map[string]interface{}{"namespace": "ui", "value": "light", "version": 1}, user); code != 200 || p.Version != 2 {
+		t.Errorf("Expected a current write to bump the version, got %d %+v", code, p)
+	}
+
+	rr := executeAuthedRequest(handlePreferences, "GET", "/api/preferences?namespace=ui", nil, fx.Users["other"])
+	if rr.Code != 404 {
+		t.Errorf("Expected another user's namespace hidden, got %d", rr.Code)
+	}
+	for _, bad := range []map[string]interface{}{
+		{"namespace": "UI Layout", "value": 1},
+		{"namespace": "ui"},
+		{"namespace": "ui", "value": nil},
+	} {
+		if code, _ := set(bad, user); code != 400 {
+			t.Errorf("Expected %v refused, got %d", bad, code)
+		}
+	}
+	if code, _ := set(map[string]interface{}{"namespace": "big", "value": strings.Repeat("x", MaxPreferenceBytes)}, user); code != 413 {
+		t.Errorf("Expected an oversized value refused, got %d", code)
+	}
+	chunk := strings.Repeat("x", MaxPreferenceBytes-10)
+	for i := 0; i < MaxPreferenceTotal/MaxPreferenceBytes; i++ {
+		if code, _ := set(map[string]interface{}{"namespace": fmt.Sprintf("loadout.%d", i), "value": chunk}, user); code != 200 {
+			t.Fatalf("Expected loadout %d within quota, got %d", i, code)
+		}
+	}
+	if code, _ := set(map[string]interface{}{"namespace": "loadout.last", "value": chunk}, user); code != 413 {
+		t.Errorf("Expected the user's quota enforced, got %d", code)
+	}
+
+	rr = executeAuthedRequest(handlePreferences, "POST", "/api/preferences", map[string]interface{}{"namespace": "ui", "remove": true}, user)
+	var list PreferenceList
+	json.Unmarshal(rr.Body.Bytes(), &list)
+	if rr.Code != 200 || len(list.Preferences) != MaxPreferenceTotal/MaxPreferenceBytes || list.UsedBytes > list.QuotaBytes {
+		t.Errorf("Expected ui removed and the loadouts listed, got %d with %d namespaces in %d bytes", rr.Code, len(list.Preferences), list.UsedBytes)
+	}
+}
+
+// Test 76: Battles and hazards wear modules; worn engines and weapons underperform until repaired
+func TestModuleDamage(t *testing.T) {
+	setupTestEnv(t)
+	fx := seed(t, Seed{
+		Users:   []SeedUser{{Username: "captain"}},
+		Systems: []SeedSystem{{ID: "sys-7-0-0"}},
+		Colonies: []SeedColony{{SystemID: "sys-7-0-0", Owner: "captain", Name: "Drydock",
+			Resources: map[string]int{"steel": 100}, Buildings: map[string]int{"shipyard": 1}, Modules: map[string]int{"laser": 1}}},
+		Fleets: []SeedFleet{{Owner: "captain", System: "sys-7-0-0", HullClass: "Fighter", Modules: []string{"warp_drive", "laser", "laser"}, Fuel: 100}},
+	})
+	captain, fleetID := fx.Users["captain"], fx.Fleets[0]
+
+	if fast, worn := travelTicks(100, []string{"warp_drive"}, nil), travelTicks(100, []string{"warp_drive"}, []float64{0.5}); fast != 80 || worn != 90 {
+		t.Errorf("Expected a half-worn warp drive to give half its speedup, got %d and %d ticks", fast, worn)
+	}
+	laser := Fleet{ID: 1, OwnerUUID: "a", HullClass: "Frigate", Modules: []string{"laser", "laser", "laser"}}
+	target := Fleet{ID: 2, OwnerUUID: "b", HullClass: "Colonizer"}
+	wrecked := laser
+	wrecked.Condition = []float64{0, 0, 0}
+	if r := resolveBattle("sys-7-0-0", []Fleet{laser, target}, 5); r.Participants[1].EndHP == r.Participants[1].StartHP {
+		t.Fatal("Expected working lasers to hit")
+	}
+	if r := resolveBattle("sys-7-0-0", []Fleet{wrecked, target}, 5); r.Participants[1].EndHP != r.Participants[1].StartHP {
+		t.Errorf("Expected wrecked lasers never to hit, got %d/%d", r.Participants[1].EndHP, r.Participants[1].StartHP)
+	}
+
+	// A survivor that lost half its structure comes out with every module at half condition
+	f := Fleet{ID: fleetID, OwnerUUID: captain.UserUUID, Modules: []string{"warp_drive", "laser", "laser"}}
+	applyBattleReport(BattleReport{SystemID: "sys-7-0-0", Tick: 5, Participants: []BattleParticipant{
+		{FleetID: fleetID, OwnerUUID: captain.UserUUID, StartHP: 200, EndHP: 100, Outcome: "held"},
+	}}, []Fleet{f})
+	wearModules(fleetID, 0.25)
+
+	manifest := func() FleetManifest {
+		rr := executeAuthedRequest(handleFleetManifest, "GET", fmt.Sprintf("/api/fleet/%d", fleetID), nil, captain)
+		var m FleetManifest
+		json.Unmarshal(rr.Body.Bytes(), &m)
+		return m
+	}
+	m := manifest()
+	if len(m.Modules) != 3 || m.Modules[0].Condition != 0.25 || m.RepairCost != 45 {
+		t.Fatalf("Expected modules at 0.25 costing 45 steel, got %+v (%d)", m.Modules, m.RepairCost)
+	}
+
+	// Refitting keeps the worn lasers' wear and scraps the worn warp drive
+	rr := executeAuthedRequest(handleFleetRefit, "POST", "/api/fleet/refit", map[string]interface{}{"fleet_id": fleetID, "modules": []string{"laser", "laser", "laser"}}, captain)
+	if rr.Code != 200 {
+		t.Fatalf("Expected refit, got %d %s", rr.Code, rr.Body.String())
+	}
+	var stockJson string
+	db.QueryRow("SELECT module_stock_json FROM colonies WHERE id=?", fx.Colonies[0]).Scan(&stockJson)
+	if m = manifest(); m.Modules[0].Condition != 0.25 || m.Modules[2].Condition != 1 || strings.Contains(stockJson, "warp_drive") {
+		t.Errorf("Expected worn lasers kept and the worn drive scrapped, got %+v, stock %s", m.Modules, stockJson)
+	}
+
+	rr = executeAuthedRequest(handleFleetRepair, "POST", "/api/fleet/repair", map[string]interface{}{"fleet_id": fleetID}, captain)
+	var steel int
+	db.QueryRow("SELECT steel FROM colonies WHERE id=?", fx.Colonies[0]).Scan(&steel)
+	if rr.Code != 200 || steel != 70 {
+		t.Errorf("Expected a 30-steel repair, got %d %s with %d steel left", rr.Code, rr.Body.String(), steel)
+	}
+	if m = manifest(); m.RepairCost != 0 || m.Modules[0].Condition != 1 {
+		t.Errorf("Expected a repaired fleet, got %+v", m.Modules)
+	}
+}
+
+// Test 77: Staffed labs earn research points; technologies are bought in order and gate modules and buildings
+func TestResearch(t *testing.T) {
+	setupTestEnv(t)
+	fx := seed(t, Seed{
+		Users: []SeedUser{{Username: "Curie", Credits: 1000}},
+		Colonies: []SeedColony{{
+			SystemID: "sys-1-0-0", Owner: "Curie", Name: "Lab", Laborers: 500,
+			Resources: map[string]int{"iron": 10000, "steel": 10000, "food": 10000},
+			Modules:   map[string]int{"warp_drive": 1},
+			Buildings: map[string]int{"shipyard": 1, "pilot_academy": 1, "rd_lab": 3},
+		}},
+	})
+	curie := fx.Users["Curie"]
+	colID := fx.Colonies[0]
+
+	if pts := colonyResearch(&Colony{Buildings: map[string]int{"rd_lab": 3}, PopSpecialists: 25}); pts != 2*ResearchPerLab {
+		t.Errorf("Expected two staffed labs' worth of research, got %d", pts)
+	}
+
+	construct := func() *httptest.ResponseRecorder {
+		return executeAuthedRequest(handleConstruct, "POST", "/api/construct",
+			map[string]interface{}{"colony_id": colID, "hull_class": "Fighter", "modules": []string{"warp_drive"}}, curie)
+	}
+	if rr := construct(); rr.Code != 400 || !strings.Contains(rr.Body.String(), "FTL Theory") {
+		t.Errorf("Expected a warp drive locked behind FTL Theory, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	research := func(tech string) *httptest.ResponseRecorder {
+		return executeAuthedRequest(handleResearch, "POST", "/api/research", map[string]string{"tech": tech}, curie)
+	}
+	db.Exec("UPDATE users SET research_points=250 WHERE global_uuid=?", curie.UserUUID)
+	if rr := research("gravitics"); rr.Code != 400 {
+		t.Errorf("Expected Gravitics refused before FTL Theory, got %d", rr.Code)
+	}
+	rr := research("ftl_theory")
+	if rr.Code != 200 {
+		t.Fatalf("Expected FTL Theory researched, got %d %s", rr.Code, rr.Body.String())
+	}
+	var st ResearchState
+	json.Unmarshal(rr.Body.Bytes(), &st)
+	avail := make(map[string]bool)
+	for _, tech := range st.Technologies {
+		avail[tech.ID] = tech.Available
+	}
+	if st.Points != 50 || !avail["gravitics"] || avail["ftl_theory"] {
+		t.Errorf("Expected 50 points left and Gravitics open, got %d %v", st.Points, avail)
+	}
+	if rr := research("ftl_theory"); rr.Code != 409 {
+		t.Errorf("Expected a second FTL Theory refused, got %d", rr.Code)
+	}
+	if rr := research("ballistics"); rr.Code != 402 {
+		t.Errorf("Expected Ballistics unaffordable, got %d", rr.Code)
+	}
+	if rr := construct(); rr.Code != 200 {
+		t.Errorf("Expected a warp drive fitted after FTL Theory, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr = executeAuthedRequest(handleBuild, "POST", "/api/build", map[string]interface{}{"colony_id": colID, "structure": "terraformer", "amount": 1}, curie)
+	if rr.Code != 400 || !strings.Contains(rr.Body.String(), "Terraforming") {
+		t.Errorf("Expected a terraformer locked behind Terraforming, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+// Test 78: The leader's council proposals pass on reputation-weighted signed ballots and are enacted at quorum
+func TestGalacticCouncil(t *testing.T) {
+	setupTestEnv(t)
+	defer func(old map[string]*Peer, leader bool, leaderID string) {
+		Peers, IsLeader, LeaderUUID = old, leader, leaderID
+	}(Peers, IsLeader, LeaderUUID)
+	defer setTolls(TollSchedule{})
+	defer setTollCap(nil)
+	Peers = map[string]*Peer{}
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	PrivateKey, PublicKey = priv, pub
+	IsLeader, LeaderUUID = true, ServerUUID
+
+	keys := make(map[string]ed25519.PrivateKey)
+	for node, rep := range map[string]float64{"node-small": 10, "node-big": 50, "node-rogue": 0} {
+		pub, priv, _ := ed25519.GenerateKey(nil)
+		keys[node] = priv
+		Peers[node] = &Peer{UUID: node, PublicKey: pub, Reputation: rep}
+	}
+	ballot := func(node, id string, approve bool) *CouncilBallot {
+		b := &CouncilBallot{ProposalID: id, Voter: node, Approve: approve}
+		b.Signature = hex.EncodeToString(SignMessage(keys[node], b.signingString()))
+		return b
+	}
+
+	t.Setenv("OWNWORLD_ADMIN_KEY", "k")
+	admin := func(handler http.HandlerFunc, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("X-Admin-Key", "k")
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+	if rr := admin(handleAdminCouncil, "/admin/council", `{"kind":"toll_cap","transit":20000}`); rr.Code != 400 {
+		t.Errorf("Expected an out-of-range cap refused, got %d", rr.Code)
+	}
+	rr := admin(handleAdminCouncil, "/admin/council", `{"kind":"toll_cap","title":"Free trade","transit":10,"trade_pct":0.05}`)
+	var p CouncilProposal
+	json.Unmarshal(rr.Body.Bytes(), &p)
+	if rr.Code != 200 || p.Status != CouncilOpen || p.Proposer != ServerUUID {
+		t.Fatalf("Expected an open proposal, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	// Peers only take proposals from the leader, signed by it
+	forged := p
+	forged.Proposer = "node-rogue"
+	if recordCouncilProposal(&forged, "node-rogue") {
+		t.Error("Expected a proposal from a node that isn't the leader ignored")
+	}
+
+	// Weights 11 (small), 51 (big), 1 (rogue) and ours at their average, 21: 84 in all, 42 for quorum
+	setTolls(TollSchedule{Transit: 50, TradePct: 0.2})
+	if rr := admin(handleAdminCouncilVote, "/admin/council/vote", fmt.Sprintf(`{"proposal_id":%q,"approve":true}`, p.ID)); rr.Code != 200 {
+		t.Fatalf("Expected our ballot cast, got %d %s", rr.Code, rr.Body.String())
+	}
+	if recordCouncilBallot(ballot("node-big", p.ID, true), "node-small") {
+		t.Error("Expected a ballot relayed under another node's name ignored")
+	}
+	forgedBallot := ballot("node-small", p.ID, true)
+	forgedBallot.Approve = false
+	if recordCouncilBallot(forgedBallot, "node-small") {
+		t.Error("Expected a ballot with a bad signature ignored")
+	}
+	processCouncilAnnouncement(&CouncilAnnouncement{Ballot: ballot("node-small", p.ID, true)}, "node-small")
+	if p, _ = loadCouncilProposal(p.ID); p.Status != CouncilOpen || p.Tally.Ballots != 2 || currentTolls().Transit != 50 {
+		t.Fatalf("Expected the vote still short of quorum, got %s %+v", p.Status, p.Tally)
+	}
+	processCouncilAnnouncement(&CouncilAnnouncement{Ballot: ballot("node-big", p.ID, true)}, "node-big")
+	if p, _ = loadCouncilProposal(p.ID); p.Status != CouncilEnacted {
+		t.Fatalf("Expected the cap enacted at quorum, got %s %+v", p.Status, p.Tally)
+	}
+	if got := currentTolls(); got.Transit != 10 || got.TradePct != 0.05 {
+		t.Errorf("Expected tolls held under the cap, got %+v", got)
+	}
+	if rr := admin(handleAdminCouncilVote, "/admin/council/vote", fmt.Sprintf(`{"proposal_id":%q,"approve":false}`, p.ID)); rr.Code != 409 {
+		t.Errorf("Expected voting closed once decided, got %d", rr.Code)
+	}
+
+	// A ban outvoted by the best-reputed node fails; peers see proposals as players do
+	rr = admin(handleAdminCouncil, "/admin/council", `{"kind":"ban_node","node":"node-rogue"}`)
+	json.Unmarshal(rr.Body.Bytes(), &p)
+	admin(handleAdminCouncilVote, "/admin/council/vote", fmt.Sprintf(`{"proposal_id":%q,"approve":true}`, p.ID))
+	recordCouncilBallot(ballot("node-big", p.ID, false), "node-big")
+	if p, _ = loadCouncilProposal(p.ID); p.Status != CouncilRejected || Peers["node-rogue"].Relation == 2 {
+		t.Errorf("Expected the ban rejected, got %s", p.Status)
+	}
+	var list []CouncilProposal
+	json.Unmarshal(executeRequest(handleCouncil, "GET", "/api/council", nil).Body.Bytes(), &list)
+	if len(list) != 2 {
+		t.Errorf("Expected both proposals listed, got %d", len(list))
+	}
+}
+
+// Test 79: Outposts settle a held system's belt or moon, build from a short list and out-mine the planet
+func TestOutposts(t *testing.T) {
+	setupTestEnv(t)
+	kit := []string{"colony_kit"}
+	fx := seed(t, Seed{
+		Users: []SeedUser{{Username: "miner"}, {Username: "squatter"}},
+		Colonies: []SeedColony{{SystemID: "sys-6-0-0", Owner: "miner", Name: "Homeworld",
+			Resources: map[string]int{"iron": 10000, "carbon": 10000}}},
+		Fleets: []SeedFleet{
+			{Owner: "miner", System: "sys-6-0-0", HullClass: "Colonizer", Modules: kit},
+			{Owner: "miner", System: "sys-6-0-0", HullClass: "Colonizer", Modules: kit},
+			{Owner: "squatter", System: "sys-6-0-0", HullClass: "Colonizer", Modules: kit},
+		},
+	})
+	miner, squatter := fx.Users["miner"], fx.Users["squatter"]
+	deploy := func(fleet int, site string, as SeedSession) *httptest.ResponseRecorder {
+		return executeAuthedRequest(handleDeploy, "POST", "/api/deploy", map[string]interface{}{"fleet_id": fleet, "name": "Rockhold", "site_type": site}, as)
+	}
+
+	if rr := deploy(fx.Fleets[2], SiteMoon, squatter); rr.Code != 400 {
+		t.Errorf("Expected an outpost refused without the planet, got %d", rr.Code)
+	}
+	if rr := deploy(fx.Fleets[0], "comet", miner); rr.Code != 400 {
+		t.Errorf("Expected an unknown site refused, got %d", rr.Code)
+	}
+	if rr := deploy(fx.Fleets[0], SiteAsteroidBelt, miner); rr.Code != 200 || rr.Body.String() != "Outpost Established" {
+		t.Fatalf("Expected the belt settled, got %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := deploy(fx.Fleets[1], SiteAsteroidBelt, miner); rr.Code != 409 {
+		t.Errorf("Expected a second belt outpost refused, got %d", rr.Code)
+	}
+
+	var outpost, parent int
+	db.QueryRow("SELECT id, parent_colony_id FROM colonies WHERE site_type=?", SiteAsteroidBelt).Scan(&outpost, &parent)
+	if parent != fx.Colonies[0] {
+		t.Errorf("Expected the outpost parented to the planet colony, got %d", parent)
+	}
+	db.Exec("UPDATE colonies SET iron=10000 WHERE id=?", outpost)
+	build := func(structure string) int {
+		return executeAuthedRequest(handleBuild, "POST", "/api/build", map[string]interface{}{"colony_id": outpost, "structure": structure, "amount": 1}, miner).Code
+	}
+	if code := build("shipyard"); code != 400 {
+		t.Errorf("Expected a shipyard refused on the belt, got %d", code)
+	}
+	if code := build("iron_mine"); code != 200 {
+		t.Errorf("Expected an iron mine allowed on the belt, got %d", code)
+	}
+
+	env := &tickEnv{CultureByID: map[int]float64{}, CultureByOwner: map[string]float64{}, Capitals: map[string]capitalInfo{}}
+	c := Colony{ID: fx.Colonies[0], PopLaborers: 100, Food: 1000, Water: 1000, Oxygen: 1000, StabilityCurrent: 70,
+		Buildings: map[string]int{"iron_mine": 5, "platinum_mine": 5}, Policies: map[string]bool{}}
+	planet := simulateColony(c, 0, []int{6, 0, 0}, "", env)
+	c.SiteType = SiteAsteroidBelt
+	belt := simulateColony(c, 0, []int{6, 0, 0}, "", env)
+	// Ore is truncated after the multiplier, so allow for rounding
+	if belt.Update.Iron != 2*planet.Update.Iron || belt.Update.PlatinumOre < 3*planet.Update.PlatinumOre || belt.Update.PlatinumOre > 3*planet.Update.PlatinumOre+3 || planet.Update.Iron == 0 {
+		t.Errorf("Expected the belt to mine 2x iron and 3x platinum, got %d/%d vs %d/%d",
+			belt.Update.Iron, belt.Update.PlatinumOre, planet.Update.Iron, planet.Update.PlatinumOre)
+	}
+
+	var state struct {
+		Colonies []Colony `json:"colonies"`
+	}
+	json.Unmarshal(executeAuthedRequest(handleState, "GET", "/api/state", nil, miner).Body.Bytes(), &state)
+	sites := map[string]bool{}
+	for _, col := range state.Colonies {
+		sites[col.SiteType] = true
+	}
+	if len(state.Colonies) != 2 || !sites[SitePlanet] || !sites[SiteAsteroidBelt] {
+		t.Errorf("Expected the planet and the belt outpost in the state, got %+v", sites)
+	}
+}
+
+// Test 80: A fleet recalled mid-leg flies back what it has flown and is refunded the rest of its fuel
+func TestFleetRecall(t *testing.T) {
+	setupTestEnv(t)
+	savedTick := atomic.LoadInt64(&CurrentTick)
+	defer atomic.StoreInt64(&CurrentTick, savedTick)
+	atomic.StoreInt64(&CurrentTick, 1000)
+
+	fx := seed(t, Seed{
+		Users: []SeedUser{{Username: "pilot"}, {Username: "stranger"}},
+		Fleets: []SeedFleet{
+			{Owner: "pilot", System: "sys-1-1-1", HullClass: "Fighter", Fuel: 500000},
+			{Owner: "pilot", System: "sys-1-1-1", HullClass: "Fighter", Fuel: 500000},
+		},
+	})
+	pilot := fx.Users["pilot"]
+	recall := func(fleet int, as SeedSession) *httptest.ResponseRecorder {
+		return executeAuthedRequest(handleFleetRecall, "POST", "/api/fleet/recall", map[string]interface{}{"fleet_id": fleet}, as)
+	}
+	for _, id := range fx.Fleets {
+		if rr := executeAuthedRequest(handleFleetLaunch, "POST", "/api/fleet/launch", map[string]interface{}{"fleet_id": id, "target_system": "sys-6-6-6"}, pilot); rr.Code != 200 {
+			t.Fatalf("Launch failed: %d %s", rr.Code, rr.Body.String())
+		}
+	}
+	var routeFuel int
+	var arrival int64
+	db.QueryRow("SELECT route_fuel, arrival_tick FROM fleets WHERE id=?", fx.Fleets[0]).Scan(&routeFuel, &arrival)
+	leg := arrival - 1000
+	if leg < 8 || routeFuel == 0 {
+		t.Fatalf("Expected a long leg with a fuel charge, got %d ticks, %d fuel", leg, routeFuel)
+	}
+
+	if rr := recall(fx.Fleets[0], fx.Users["stranger"]); rr.Code != 403 {
+		t.Errorf("Expected another player's recall refused, got %d", rr.Code)
+	}
+
+	// A quarter of the way out: back in as many ticks, the flown share charged twice
+	flown := leg / 4
+	atomic.StoreInt64(&CurrentTick, 1000+flown)
+	if rr := recall(fx.Fleets[0], pilot); rr.Code != 200 {
+		t.Fatalf("Expected the recall accepted, got %d %s", rr.Code, rr.Body.String())
+	}
+	var fuel, newRoute int
+	var dest string
+	db.QueryRow("SELECT fuel, route_fuel, dest_system, arrival_tick FROM fleets WHERE id=?", fx.Fleets[0]).Scan(&fuel, &newRoute, &dest, &arrival)
+	burn := flownFuel(routeFuel, float64(flown)/float64(leg))
+	if dest != "sys-1-1-1" || arrival != 1000+2*flown {
+		t.Errorf("Expected the fleet back at sys-1-1-1 on tick %d, got %s on %d", 1000+2*flown, dest, arrival)
+	}
+	if fuel != 500000-2*burn || newRoute != burn {
+		t.Errorf("Expected %d fuel left with %d on the return leg, got %d/%d", 500000-2*burn, burn, fuel, newRoute)
+	}
+	if rr := recall(fx.Fleets[0], pilot); rr.Code != 409 {
+		t.Errorf("Expected a returning fleet not recalled twice, got %d", rr.Code)
+	}
+
+	// Past the point of no return
+	atomic.StoreInt64(&CurrentTick, 1000+leg*3/4)
+	if rr := recall(fx.Fleets[1], pilot); rr.Code != 409 {
+		t.Errorf("Expected a recall past the cutoff refused, got %d", rr.Code)
+	}
+	Config.RecallCutoff = 0.9
+	defer func() { Config.RecallCutoff = 0 }()
+	if rr := recall(fx.Fleets[1], pilot); rr.Code != 200 {
+		t.Errorf("Expected a raised cutoff to allow the recall, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+// Test 81: Sellers cancel and list their own orders, and signed cancellations stop gossiped copies
+func TestOrderCancellation(t *testing.T) {
+	setupTestEnv(t)
+	defer func(old map[string]*Peer, tick int64) { Peers = old; atomic.StoreInt64(&CurrentTick, tick) }(Peers, atomic.LoadInt64(&CurrentTick))
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	PrivateKey, PublicKey = priv, pub
+	peerPub, peerPriv, _ := ed25519.GenerateKey(nil)
+	Peers = map[string]*Peer{"node-b": {UUID: "node-b", PublicKey: peerPub}}
+	setFeatureFlag(FeatureMarketMatching, true)
+	defer setFeatureFlag(FeatureMarketMatching, false)
+
+	fx := seed(t, Seed{
+		Users:    []SeedUser{{Username: "trader", Credits: 1000}, {Username: "meddler"}},
+		Colonies: []SeedColony{{SystemID: "sys-6-6-6", Owner: "trader", Buildings: map[string]int{"trading_post": 1}}},
+	})
+	trader, meddler := fx.Users["trader"], fx.Users["meddler"]
+	executeAuthedRequest(handlePlaceOrder, "POST", "/api/market/place", MarketOrder{Item: "iron", Quantity: 10, Price: 10, OriginSystem: "sys-6-6-6"}, trader)
+	mine := func(as SeedSession) []MarketOrder {
+		var orders []MarketOrder
+		json.Unmarshal(executeAuthedRequest(handleMyOrders, "GET", "/api/market/mine", nil, as).Body.Bytes(), &orders)
+		return orders
+	}
+	orders := mine(trader)
+	if len(orders) != 1 || orders[0].Node != ServerUUID || len(mine(meddler)) != 0 {
+		t.Fatalf("Expected one local order for the trader only, got %+v", orders)
+	}
+	id := orders[0].ID
+
+	// A copy gossiped from node-b is held there, so it can't be cancelled here
+	db.Exec("INSERT INTO market_orders (order_id, seller_uuid, item, quantity, price, is_buy, origin_system, expires_tick, origin_node) VALUES ('ord-remote', ?, 'iron', 5, 10, 0, 'sys-9-9-9', 99999, 'node-b')", trader.UserUUID)
+	cancel := func(order string, as SeedSession) int {
+		return executeAuthedRequest(handleCancelOrder, "POST", "/api/market/cancel", map[string]string{"order_id": order}, as).Code
+	}
+	if code := cancel(id, meddler); code != 403 {
+		t.Errorf("Expected another player's cancel refused, got %d", code)
+	}
+	if code := cancel("ord-remote", trader); code != 409 {
+		t.Errorf("Expected a gossiped order's cancel refused, got %d", code)
+	}
+	if code := cancel(id, trader); code != 200 {
+		t.Fatalf("Expected the cancel accepted, got %d", code)
+	}
+	if code := cancel(id, trader); code != 404 {
+		t.Errorf("Expected a cancelled order gone, got %d", code)
+	}
+	sent := recentCancellations(atomic.LoadInt64(&CurrentTick))
+	if len(sent) != 1 || sent[0].OrderID != id || !nodeSignatureValid(ServerUUID, sent[0].signingString(), sent[0].Signature) {
+		t.Errorf("Expected a signed tombstone to gossip, got %+v", sent)
+	}
+
+	// node-b withdraws its order: a forgery is ignored, the signed tombstone drops the copy and
+	// keeps it from being re-listed in the same heartbeat
+	beat := int64(0)
+	heartbeat := func(cancels []OrderCancellation) {
+		beat++
+		hb := HeartbeatRequest{UUID: "node-b", Tick: beat, CancelledOrders: cancels,
+			MarketOrders: []MarketOrder{{ID: "ord-remote", SellerUUID: trader.UserUUID, Item: "iron", Quantity: 5, Price: 10, OriginSystem: "sys-9-9-9", ExpiresTick: 99999}}}
+		hb.Signature = hex.EncodeToString(SignMessage(peerPriv, []byte(fmt.Sprintf("node-b:%d", beat))))
+		body, ctype := encodeFederation(hb, false)
+		req := httptest.NewRequest("POST", "/federation/heartbeat", bytes.NewReader(body))
+		req.Header.Set("Content-Type", ctype)
+		handleHeartbeat(httptest.NewRecorder(), req)
+	}
+	held := func() (n int) {
+		db.QueryRow("SELECT count(*) FROM market_orders WHERE order_id='ord-remote'").Scan(&n)
+		return n
+	}
+	forged := OrderCancellation{OrderID: "ord-remote", Node: "node-b"}
+	forged.Signature = hex.EncodeToString(SignMessage(priv, forged.signingString()))
+	heartbeat([]OrderCancellation{forged})
+	if held() != 1 {
+		t.Errorf("Expected a cancellation not signed by the holder ignored")
+	}
+	signed := OrderCancellation{OrderID: "ord-remote", Node: "node-b"}
+	signed.Signature = hex.EncodeToString(SignMessage(peerPriv, signed.signingString()))
+	heartbeat([]OrderCancellation{signed})
+	if held() != 0 {
+		t.Errorf("Expected the cancelled order not re-listed from gossip")
+	}
+	heartbeat(nil)
+	if held() != 0 {
+		t.Errorf("Expected the tombstone to keep refusing the order")
+	}
+
+	// A cancellation that can't leave its tombstone is undone rather than gossiped as a plain delete
+	executeAuthedRequest(handlePlaceOrder, "POST", "/api/market/place", MarketOrder{Item: "iron", Quantity: 10, Price: 10, OriginSystem: "sys-6-6-6"}, trader)
+	id = mine(trader)[0].ID
+	db.Exec("ALTER TABLE cancelled_orders RENAME TO cancelled_orders_gone")
+	if code := cancel(id, trader); code != 500 || len(mine(trader)) != 1 {
+		t.Errorf("Expected a failed tombstone to keep the order listed, got %d", code)
+	}
+}
+
+type stubCaptcha struct{ good string }
+
+func (s stubCaptcha) Verify(token, remoteIP string) error {
+	if token != s.good {
+		return fmt.Errorf("bad token")
+	}
+	return nil
+}
+
+// Test 82: Registration can require an invite code and a captcha and is capped per address
+func TestRegistrationGates(t *testing.T) {
+	setupTestEnv(t)
+	defer func(saved CaptchaVerifier) { captcha = saved }(captcha)
+	defer func() { Config.RegistrationInvite, Config.RegistrationsPerIP = false, 0 }()
+	t.Setenv("OWNWORLD_ADMIN_KEY", "k")
+
+	register := func(name, ip string, extra map[string]string) *httptest.ResponseRecorder {
+		payload := map[string]string{"username": name, "password": "pw"}
+		for k, v := range extra {
+			payload[k] = v
+		}
+		body, _ := json.Marshal(payload)
+		req := httptest.NewRequest("POST", "/api/register", bytes.NewReader(body))
+		req.RemoteAddr = ip + ":4000"
+		rr := httptest.NewRecorder()
+		handleRegister(rr, req)
+		return rr
+	}
+	mint := func(body string) RegistrationCode {
+		req := httptest.NewRequest("POST", "/admin/registration-codes", strings.NewReader(body))
+		req.Header.Set("X-Admin-Key", "k")
+		rr := httptest.NewRecorder()
+		handleAdminRegistrationCodes(rr, req)
+		var c RegistrationCode
+		json.Unmarshal(rr.Body.Bytes(), &c)
+		return c
+	}
+
+	Config.RegistrationInvite = true
+	if rr := register("nocode", "198.51.100.1", nil); rr.Code != 403 {
+		t.Errorf("Expected a registration without a code refused, got %d", rr.Code)
+	}
+	code := mint(`{"uses": 2}`)
+	if code.Code == "" || code.UsesLeft != 2 {
+		t.Fatalf("Expected a two-use code, got %+v", code)
+	}
+	for i, name := range []string{"friend1", "friend2", "friend3"} {
+		want := 200
+		if i == 2 {
+			want = 403
+		}
+		if rr := register(name, "198.51.100.1", map[string]string{"invite_code": code.Code}); rr.Code != want {
+			t.Errorf("Expected %s to get %d, got %d %s", name, want, rr.Code, rr.Body.String())
+		}
+	}
+	// Logging in through /api/register isn't gated
+	if rr := register("friend1", "198.51.100.1", nil); rr.Code != 200 {
+		t.Errorf("Expected an existing player to log in without a code, got %d", rr.Code)
+	}
+	Config.RegistrationInvite = false
+
+	Config.RegistrationsPerIP = 3
+	if rr := register("third", "198.51.100.1", nil); rr.Code != 200 {
+		t.Errorf("Expected a third account from the address, got %d", rr.Code)
+	}
+	if rr := register("fourth", "198.51.100.1", nil); rr.Code != 429 {
+		t.Errorf("Expected the fourth account from the address refused, got %d", rr.Code)
+	}
+	if rr := register("elsewhere", "203.0.113.50", nil); rr.Code != 200 {
+		t.Errorf("Expected another address unaffected, got %d", rr.Code)
+	}
+	Config.RegistrationsPerIP = 0
+
+	captcha = stubCaptcha{good: "human"}
+	if rr := register("bot", "203.0.113.51", nil); rr.Code != 400 {
+		t.Errorf("Expected a missing captcha refused, got %d", rr.Code)
+	}
+	if rr := register("bot", "203.0.113.51", map[string]string{"captcha": "robot"}); rr.Code != 403 {
+		t.Errorf("Expected a failed captcha refused, got %d", rr.Code)
+	}
+	if rr := register("human", "203.0.113.51", map[string]string{"captcha": "human"}); rr.Code != 200 {
+		t.Errorf("Expected a solved captcha accepted, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+// Test 83: Node locations derive from UUID and genesis, resolve collisions by salt and are checked in handshakes
+func TestDerivedLocation(t *testing.T) {
+	setupTestEnv(t)
+	defer func(g string, loc []int, salt int, peers map[string]*Peer) {
+		GenesisHash, ServerLoc, ServerLocSalt, Peers = g, loc, salt, peers
+	}(GenesisHash, ServerLoc, ServerLocSalt, Peers)
+	GenesisHash, ServerLoc, ServerLocSalt, Peers = "location-test", nil, -1, map[string]*Peer{}
+
+	loc := deriveLocation("node-m", GenesisHash, 0)
+	if !sameLocation(loc, deriveLocation("node-m", GenesisHash, 0)) || sameLocation(loc, deriveLocation("node-m", "other-genesis", 0)) {
+		t.Fatalf("Expected the location fixed by UUID and genesis, got %v", loc)
+	}
+	for _, c := range loc {
+		if c < -NodeRegion || c > NodeRegion {
+			t.Errorf("Expected %v inside the core region", loc)
+		}
+	}
+
+	// An earlier claim on the spot (lower salt, or the lower UUID on a tie) pushes us to salt 1
+	if got, salt := resolveLocation("node-m", GenesisHash, []locationClaim{{UUID: "node-a", Location: loc, Salt: 0}}); salt != 1 || !sameLocation(got, deriveLocation("node-m", GenesisHash, 1)) {
+		t.Errorf("Expected node-m to yield to node-a, got %v salt %d", got, salt)
+	}
+	if _, salt := resolveLocation("node-m", GenesisHash, []locationClaim{{UUID: "node-z", Location: loc, Salt: 0}}); salt != 0 {
+		t.Errorf("Expected node-m to keep its spot over node-z, got salt %d", salt)
+	}
+	if _, salt := resolveLocation("node-m", GenesisHash, []locationClaim{{UUID: "node-z", Location: []int{loc[0] + 5, loc[1], loc[2]}, Salt: -1}}); salt == 0 {
+		t.Errorf("Expected a legacy node's location to win")
+	}
+
+	zero, seven := 0, 7
+	if verifyLocation("node-m", loc, &zero) != nil || verifyLocation("node-m", loc, &seven) == nil || verifyLocation("node-m", []int{1, 2, 3}, nil) != nil {
+		t.Errorf("Expected only matching salts verified and legacy locations let through")
+	}
+
+	// Unsettled, the node moves out of a stronger claim's way; once it has colonies it stays
+	ServerUUID = "node-m"
+	defer func() { ServerUUID = "test-server-uuid" }()
+	settleLocation()
+	if ServerLocSalt != 0 || !sameLocation(ServerLoc, loc) {
+		t.Fatalf("Expected node-m at its salt 0 location, got %v salt %d", ServerLoc, ServerLocSalt)
+	}
+	Peers["node-a"] = &Peer{UUID: "node-a", Location: loc, LocationSalt: 0}
+	settleLocation()
+	if ServerLocSalt != 1 {
+		t.Errorf("Expected node-m to move to salt 1, got %d", ServerLocSalt)
+	}
+	moved := ServerLoc
+	seed(t, Seed{Users: []SeedUser{{Username: "settler"}}, Colonies: []SeedColony{{SystemID: "sys-1-1-1", Owner: "settler"}}})
+	Peers["node-b"] = &Peer{UUID: "node-b", Location: moved, LocationSalt: 0}
+	settleLocation()
+	if ServerLocSalt != 1 || !sameLocation(ServerLoc, moved) {
+		t.Errorf("Expected a settled node to stay put, got %v salt %d", ServerLoc, ServerLocSalt)
+	}
+	if stored, salt, ok := storedLocation(); !ok || salt != 1 || !sameLocation(stored, moved) {
+		t.Errorf("Expected the location persisted, got %v salt %d", stored, salt)
+	}
+
+	shake := func(req HandshakeRequest) int {
+		body, _ := json.Marshal(req)
+		rr := httptest.NewRecorder()
+		handleHandshake(rr, httptest.NewRequest("POST", "/federation/handshake", bytes.NewReader(compressLZ4(body))))
+		return rr.Code
+	}
+	if code := shake(HandshakeRequest{UUID: "liar", GenesisHash: GenesisHash, Location: []int{0, 0, 0}, LocationSalt: &zero}); code != 403 {
+		t.Errorf("Expected a location that doesn't derive from its salt refused, got %d", code)
+	}
+	if code := shake(HandshakeRequest{UUID: "honest", GenesisHash: GenesisHash, Location: deriveLocation("honest", GenesisHash, 0), LocationSalt: &zero}); code != 202 {
+		t.Errorf("Expected a derived location queued, got %d", code)
+	}
+}
+
+// Test 84: Crossing local buy and sell orders in the same system trades without a freighter
+func TestOrderMatching(t *testing.T) {
+	setupTestEnv(t)
+	setFeatureFlag(FeatureMarketMatching, true)
+	defer setFeatureFlag(FeatureMarketMatching, false)
+
+	post := map[string]int{"trading_post": 1}
+	fx := seed(t, Seed{
+		Users: []SeedUser{{Username: "miner", Credits: 1000}, {Username: "smith", Credits: 1000}},
+		Colonies: []SeedColony{
+			{SystemID: "sys-6-6-6", Owner: "miner", Resources: map[string]int{"iron": 100}, Buildings: post},
+			{SystemID: "sys-6-6-6", Owner: "smith", Buildings: post},
+		},
+	})
+	miner, smith := fx.Users["miner"], fx.Users["smith"]
+	place := func(o MarketOrder, as SeedSession) {
+		o.OriginSystem = "sys-6-6-6"
+		if code := executeAuthedRequest(handlePlaceOrder, "POST", "/api/market/place", o, as).Code; code != 200 {
+			t.Fatalf("Expected order %+v placed, got %d", o, code)
+		}
+	}
+	credits := func(s SeedSession) (c int) {
+		db.QueryRow("SELECT credits FROM users WHERE global_uuid=?", s.UserUUID).Scan(&c)
+		return c
+	}
+	iron := func(col int) (n int) {
+		db.QueryRow("SELECT iron FROM colonies WHERE id=?", col).Scan(&n)
+		return n
+	}
+
+	place(MarketOrder{Item: "iron", Quantity: 30, Price: 8}, miner)
+	place(MarketOrder{Item: "iron", Quantity: 40, Price: 12}, miner)
+	place(MarketOrder{Item: "iron", Quantity: 50, Price: 10, IsBuy: true}, smith)
+	minerBefore, smithBefore := credits(miner), credits(smith)
+
+	// The buy takes the cheaper sell at its (older) price; the 12 doesn't cross
+	if n := matchOrders(atomic.LoadInt64(&CurrentTick)); n != 1 {
+		t.Fatalf("Expected one fill, got %d", n)
+	}
+	if iron(fx.Colonies[0]) != 70 || iron(fx.Colonies[1]) != 30 {
+		t.Errorf("Expected 30 iron moved, got %d/%d", iron(fx.Colonies[0]), iron(fx.Colonies[1]))
+	}
+	if credits(miner) != minerBefore+240 || credits(smith) != smithBefore-240 {
+		t.Errorf("Expected 240 credits paid, got %d/%d", credits(miner)-minerBefore, credits(smith)-smithBefore)
+	}
+	var left, sells int
+	db.QueryRow("SELECT quantity FROM market_orders WHERE is_buy=1").Scan(&left)
+	db.QueryRow("SELECT count(*) FROM market_orders WHERE is_buy=0").Scan(&sells)
+	if left != 20 || sells != 1 {
+		t.Errorf("Expected the buy partly filled and the filled sell gone, got %d left and %d sells", left, sells)
+	}
+	if n := matchOrders(atomic.LoadInt64(&CurrentTick)); n != 0 {
+		t.Errorf("Expected nothing left to cross, got %d fills", n)
+	}
+
+	// Without the stock to deliver nothing changes hands
+	db.Exec("UPDATE colonies SET iron=0 WHERE id=?", fx.Colonies[0])
+	place(MarketOrder{Item: "iron", Quantity: 20, Price: 9}, miner)
+	if n := matchOrders(atomic.LoadInt64(&CurrentTick)); n != 0 || credits(smith) != smithBefore-240 {
+		t.Errorf("Expected an unbacked sell left alone, got %d fills", n)
+	}
+}
+
+// Test 85: Reparations settle local grievances, and only countersigned receipts for a recorded
+// grievance restore a peer's standing, once and up to the penalty it cost
+func TestReparations(t *testing.T) {
+	setupTestEnv(t)
+	quietLogs(t)
+	defer func(old map[string]*Peer) { Peers = old }(Peers)
+
+	fx := seed(t, Seed{Users: []SeedUser{{Username: "raider", Credits: 5000}, {Username: "farmer"}}})
+	raider, farmer := fx.Users["raider"], fx.Users["farmer"]
+	reportGrievance(raider.UserUUID, farmer.UserUUID, 100) // 1000 owed
+	var gid int
+	db.QueryRow("SELECT id FROM grievances WHERE offender_uuid=?", raider.UserUUID).Scan(&gid)
+	settle := func(id, amount int, as SeedSession) int {
+		return executeAuthedRequest(handleSettleGrievance, "POST", "/api/grievances/settle", map[string]int{"grievance_id": id, "amount": amount}, as).Code
+	}
+	credits := func(s SeedSession) (c int) {
+		db.QueryRow("SELECT credits FROM users WHERE global_uuid=?", s.UserUUID).Scan(&c)
+		return c
+	}
+	if code := settle(gid, 100, farmer); code != 403 {
+		t.Errorf("Expected the victim unable to settle, got %d", code)
+	}
+	if code := settle(gid, 400, raider); code != 200 || credits(farmer) != 400 {
+		t.Fatalf("Expected a 400 payment, got %d and %d credits", code, credits(farmer))
+	}
+	if code := settle(gid, 5000, raider); code != 200 || credits(farmer) != 1000 || credits(raider) != 4000 {
+		t.Fatalf("Expected the payment capped at what's owed, got %d and %d/%d credits", code, credits(raider), credits(farmer))
+	}
+	if code := settle(gid, 100, raider); code != 404 {
+		t.Errorf("Expected a settled grievance cleared, got %d", code)
+	}
+	db.Exec("INSERT INTO grievances (offender_uuid, victim_uuid, damage_amount, tick, reparations_paid) VALUES (?, ?, 10, 0, 100)", raider.UserUUID, farmer.UserUUID)
+	db.Exec("INSERT INTO grievances (offender_uuid, victim_uuid, damage_amount, tick) VALUES (?, 'NPC-FREE-1', 10, 0)", raider.UserUUID)
+	var paidUp, faction int
+	db.QueryRow("SELECT id FROM grievances WHERE reparations_paid=100").Scan(&paidUp)
+	db.QueryRow("SELECT id FROM grievances WHERE victim_uuid='NPC-FREE-1'").Scan(&faction)
+	if code := settle(paidUp, 100, raider); code != 409 {
+		t.Errorf("Expected a paid-up grievance refused, got %d", code)
+	}
+	if code := settle(faction, 100, raider); code != 409 || credits(raider) != 4000 {
+		t.Errorf("Expected no payment to a victim off this node, got %d and %d credits", code, credits(raider))
+	}
+
+	// Between nodes: node-v reports node-o, then acknowledges reparations
+	oPub, oPriv, _ := ed25519.GenerateKey(nil)
+	vPub, vPriv, _ := ed25519.GenerateKey(nil)
+	offender := &Peer{UUID: "node-o", PublicKey: oPub, Reputation: 10}
+	Peers = map[string]*Peer{"node-o": offender, "node-v": {UUID: "node-v", PublicKey: vPub, Reputation: 20}}
+	processGrievance(&GrievanceReport{OffenderUUID: "node-o", Damage: 100, ID: 7}, "node-v")
+	processGrievance(&GrievanceReport{OffenderUUID: "node-o", Damage: 100, ID: 7}, "node-v")
+	if offender.Reputation != 8 {
+		t.Fatalf("Expected one 2 point penalty, got reputation %.2f", offender.Reputation)
+	}
+	receipt := func(id, paid int, signers ...ed25519.PrivateKey) *ReparationReceipt {
+		rc := &ReparationReceipt{GrievanceID: id, OffenderNode: "node-o", VictimNode: "node-v", Paid: paid}
+		rc.OffenderSig = hex.EncodeToString(SignMessage(signers[0], rc.signingString()))
+		rc.VictimSig = hex.EncodeToString(SignMessage(signers[len(signers)-1], rc.signingString()))
+		return rc
+	}
+	processReparation(receipt(7, 1000, oPriv), "node-o")
+	processReparation(receipt(8, 1000, oPriv, vPriv), "node-o")
+	if offender.Reputation != 8 {
+		t.Errorf("Expected self-signed or unrecorded receipts ignored, got reputation %.2f", offender.Reputation)
+	}
+	processReparation(receipt(7, 500, oPriv, vPriv), "node-o")
+	processReparation(receipt(7, 500, oPriv, vPriv), "node-v")
+	if offender.Reputation != 9 {
+		t.Errorf("Expected half the penalty restored once, got reputation %.2f", offender.Reputation)
+	}
+	processReparation(receipt(7, 99999, oPriv, vPriv), "node-v")
+	if offender.Reputation != 10 {
+		t.Errorf("Expected the restoration capped at the recorded penalty, got reputation %.2f", offender.Reputation)
+	}
+}
+
+// Test 86: Sessions are served from the cache until they expire or are replaced
+func TestSessionCache(t *testing.T) {
+	setupTestEnv(t)
+	defer func(saved map[string]sessionEntry) { sessionCache = saved }(sessionCache)
+	sessionCache = make(map[string]sessionEntry)
+
+	fx := seed(t, Seed{Users: []SeedUser{{Username: "regular"}, {Username: "lapsed"}}})
+	regular, lapsed := fx.Users["regular"], fx.Users["lapsed"]
+	h := middlewareAPI(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := authenticate(r)
+		if err != nil {
+			http.Error(w, err.Error(), 401)
+			return
+		}
+		w.Write([]byte(userID))
+	}))
+	call := func(as SeedSession) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/state", nil)
+		req.Header.Set("X-User-UUID", as.UserUUID)
+		req.Header.Set("X-Session-Token", as.Token)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := call(regular); rr.Code != 200 || rr.Body.String() != regular.UserUUID {
+		t.Fatalf("Expected the session accepted, got %d %s", rr.Code, rr.Body.String())
+	}
+	// A hit doesn't go back to the database
+	db.Exec("UPDATE users SET session_token='elsewhere' WHERE global_uuid=?", regular.UserUUID)
+	if rr := call(regular); rr.Code != 200 {
+		t.Errorf("Expected the cached session accepted, got %d", rr.Code)
+	}
+	// Replacing the session drops the cached one at once
+	newSession(regular.UserUUID)
+	if rr := call(regular); rr.Code != 401 {
+		t.Errorf("Expected a replaced session refused, got %d", rr.Code)
+	}
+
+	db.Exec("UPDATE users SET expires_at=? WHERE global_uuid=?", time.Now().Add(-time.Minute).Unix(), lapsed.UserUUID)
+	if rr := call(lapsed); rr.Code != 401 || !strings.Contains(rr.Body.String(), "Expired") {
+		t.Errorf("Expected an expired session refused, got %d %s", rr.Code, rr.Body.String())
+	}
+	// A session about to lapse is only cached until it does
+	end := time.Now().Add(2 * time.Second).Unix()
+	db.Exec("UPDATE users SET expires_at=? WHERE global_uuid=?", end, lapsed.UserUUID)
+	if rr := call(lapsed); rr.Code != 200 {
+		t.Fatalf("Expected the renewed session accepted, got %d", rr.Code)
+	}
+	if e := sessionCache[lapsed.UserUUID+"|"+lapsed.Token]; e.Expires.After(time.Unix(end, 0)) {
+		t.Errorf("Expected the cache entry to end with the session, got %v past %d", e.Expires, end)
+	}
+}
+
+// Test 87: Idempotent replays belong to the authenticated caller and the cache stays bounded
+func TestIdempotencyReplay(t *testing.T) {
+	setupTestEnv(t)
+	defer func(saved map[string]*idempotentResponse) { idempotencyCache = saved }(idempotencyCache)
+	idempotencyCache = make(map[string]*idempotentResponse)
+
+	fx := seed(t, Seed{Users: []SeedUser{{Username: "payer"}}})
+	payer := fx.Users["payer"]
+	var runs int
+	h := middlewareAPI(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		runs++
+		if _, err := authenticate(r); err != nil {
+			http.Error(w, "Unauthorized", 401)
+			return
+		}
+		w.Write([]byte("Paid"))
+	}))
+	post := func(uuid, token, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/pay", nil)
+		req.Header.Set("X-User-UUID", uuid)
+		req.Header.Set("X-Session-Token", token)
+		req.Header.Set("Idempotency-Key", key)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	post(payer.UserUUID, payer.Token, "k1")
+	if rr := post(payer.UserUUID, payer.Token, "k1"); runs != 1 || rr.Header().Get("Idempotent-Replay") != "true" || rr.Body.String() != "Paid" {
+		t.Fatalf("Expected the retry replayed, got %d runs and %q", runs, rr.Body.String())
+	}
+	// Naming the payer without their token gets no replay, and anonymous calls are never cached
+	if rr := post(payer.UserUUID, "forged", "k1"); rr.Code != 401 || rr.Header().Get("Idempotent-Replay") != "" {
+		t.Errorf("Expected a forged caller refused rather than replayed, got %d %q", rr.Code, rr.Body.String())
+	}
+	post("", "", "k2")
+	post("", "", "k2")
+	if runs != 4 {
+		t.Errorf("Expected anonymous retries to reach the handler, got %d runs", runs)
+	}
+
+	now := time.Now()
+	for i := 0; i < IdempotencyCacheSize; i++ {
+		idempotencyCache[fmt.Sprint("filler|", i)] = &idempotentResponse{Done: true, Expires: now.Add(IdempotencyTTL + time.Duration(i)*time.Millisecond)}
+	}
+	post(payer.UserUUID, payer.Token, "k3")
+	if _, ok := idempotencyCache[payer.UserUUID+"|/api/pay|k3"]; !ok || len(idempotencyCache) > IdempotencyCacheSize {
+		t.Errorf("Expected the new entry kept within %d entries, got %d", IdempotencyCacheSize, len(idempotencyCache))
+	}
+	if _, ok := idempotencyCache["filler|0"]; ok {
+		t.Error("Expected the oldest entry evicted")
+	}
+}
+
+// Test 88: Password checks behind a session count towards the account's login throttle
+func TestKeyUnlockThrottle(t *testing.T) {
+	setupTestEnv(t)
+	fx := seed(t, Seed{Users: []SeedUser{{Username: "signer", Password: "right"}}})
+	signer := fx.Users["signer"]
+	unlock := func(password string) *httptest.ResponseRecorder {
+		return executeAuthedRequest(handleUnlockKey, "POST", "/api/keys/unlock", map[string]string{"password": password}, signer)
+	}
+	sign := func(password string) *httptest.ResponseRecorder {
+		return executeAuthedRequest(handleSignAction, "POST", "/api/keys/sign", map[string]string{"payload": "x", "password": password}, signer)
+	}
+
+	if rr := unlock("right"); rr.Code != 200 {
+		t.Fatalf("Expected the right password to unlock, got %d", rr.Code)
+	}
+	for i := 0; i < LoginFreeAttempts; i++ {
+		if rr := sign("wrong"); rr.Code != 403 {
+			t.Fatalf("Expected wrong password %d refused, got %d", i, rr.Code)
+		}
+	}
+	if s := loadLoginStatus("signer"); s.Failures != LoginFreeAttempts {
+		t.Errorf("Expected %d failures recorded, got %d", LoginFreeAttempts, s.Failures)
+	}
+	if rr := unlock("right"); rr.Code != 429 || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected the throttle to hold even the right password back, got %d", rr.Code)
+	}
+
+	db.Exec("UPDATE login_failures SET last_failure=0 WHERE username='signer'")
+	if rr := sign("right"); rr.Code != 200 || loadLoginStatus("signer").Failures != 0 {
+		t.Errorf("Expected a good password after the wait to sign and clear the count, got %d", rr.Code)
+	}
+}
+
+// Test 89: Governors build and ferry cargo but can't launch, construct, burn, set policy or
+// deploy, and lose access once revoked
+func TestColonyGovernors(t *testing.T) {
+	setupTestEnv(t)
+	fx := seed(t, Seed{
+		Users: []SeedUser{{Username: "lord"}, {Username: "steward"}},
+		Colonies: []SeedColony{{SystemID: "sys-3-3-3", Owner: "lord", Name: "Keep",
+			Resources: map[string]int{"food": 5000, "iron": 5000, "carbon": 5000}}},
+		Fleets: []SeedFleet{
+			{Owner: "steward", System: "sys-3-3-3", HullClass: "Freighter", Modules: []string{"cargo_hold"}},
+			{Owner: "lord", System: "sys-3-3-3", HullClass: "Colonizer", Modules: []string{"colony_kit"}, Fuel: 1000},
+		},
+	})
+	lord, steward := fx.Users["lord"], fx.Users["steward"]
+	colony, freighter, colonizer := fx.Colonies[0], fx.Fleets[0], fx.Fleets[1]
+	grant := func(revoke bool) {
+		body := map[string]interface{}{"colony_id": colony, "governor_uuid": steward.UserUUID, "revoke": revoke}
+		if rr := executeAuthedRequest(handleColonyGovernors, "POST", "/api/colony/governors", body, lord); rr.Code != 200 {
+			t.Fatalf("Expected the owner to change governors, got %d %s", rr.Code, rr.Body.String())
+		}
+	}
+	build := func() int {
+		return executeAuthedRequest(handleBuild, "POST", "/api/build", map[string]interface{}{"colony_id": colony, "structure": "iron_mine", "amount": 1}, steward).Code
+	}
+	ferry := func() int {
+		return executeAuthedRequest(handleCargoTransfer, "POST", "/api/fleet/transfer", map[string]interface{}{"fleet_id": freighter, "colony_id": colony, "transfers": map[string]int{"iron": 10}}, steward).Code
+	}
+
+	if build() != 403 || ferry() != 403 {
+		t.Fatal("Expected no access before a grant")
+	}
+	grant(false)
+	if code := build(); code != 200 {
+		t.Errorf("Expected the governor to build, got %d", code)
+	}
+	if code := ferry(); code != 200 {
+		t.Errorf("Expected the governor to ferry cargo, got %d", code)
+	}
+
+	ownerOnly := []struct {
+		name    string
+		handler http.HandlerFunc
+		body    map[string]interface{}
+	}{
+		{"launch", handleFleetLaunch, map[string]interface{}{"fleet_id": colonizer, "target_system": "sys-4-4-4"}},
+		{"construct", handleConstruct, map[string]interface{}{"colony_id": colony, "hull_class": "Fighter", "modules": []string{"laser"}}},
+		{"burn", handleBankBurn, map[string]interface{}{"colony_id": colony, "item": "iron", "amount": 10}},
+		{"policy", handleSetPolicy, map[string]interface{}{"colony_id": colony, "policies": map[string]bool{"martial_law": true}}},
+		{"deploy", handleDeploy, map[string]interface{}{"fleet_id": colonizer, "name": "Annex"}},
+	}
+	for _, c := range ownerOnly {
+		if rr := executeAuthedRequest(c.handler, "POST", "/api/"+c.name, c.body, steward); rr.Code != 403 {
+			t.Errorf("Expected %s kept from the governor, got %d %s", c.name, rr.Code, rr.Body.String())
+		}
+	}
+
+	grant(true)
+	if build() != 403 || ferry() != 403 {
+		t.Error("Expected a revoked governor shut out again")
+	}
+}
+
+// Test 90: Battle damage carries into the next fight until repaired, and fleets that withdraw head home
+func TestBattleAftermath(t *testing.T) {
+	setupTestEnv(t)
+	fx := seed(t, Seed{
+		Users:   []SeedUser{{Username: "captain"}},
+		Systems: []SeedSystem{{ID: "sys-1-0-0"}, {ID: "sys-2-0-0"}},
+		Colonies: []SeedColony{{SystemID: "sys-1-0-0", Owner: "captain", Name: "Drydock",
+			Resources: map[string]int{"steel": 100}, Buildings: map[string]int{"shipyard": 1}}},
+		Fleets: []SeedFleet{
+			{Owner: "captain", System: "sys-2-0-0", HullClass: "Frigate", Modules: []string{"laser"}, Fuel: 100000},
+			{Owner: "captain", System: "sys-2-0-0", HullClass: "Frigate", Modules: []string{"laser"}, Fuel: 100000},
+		},
+	})
+	captain := fx.Users["captain"]
+	held, fled := fx.Fleets[0], fx.Fleets[1]
+	db.Exec("UPDATE fleets SET home_system='sys-1-0-0'")
+
+	fleets := []Fleet{
+		{ID: held, OwnerUUID: captain.UserUUID, HullClass: "Frigate", Modules: []string{"laser"}, HomeSystem: "sys-1-0-0"},
+		{ID: fled, OwnerUUID: captain.UserUUID, HullClass: "Frigate", Modules: []string{"laser"}, HomeSystem: "sys-1-0-0"},
+	}
+	applyBattleReport(BattleReport{SystemID: "sys-2-0-0", Tick: 5, Participants: []BattleParticipant{
+		{FleetID: held, OwnerUUID: captain.UserUUID, StartHP: 200, EndHP: 150, Outcome: "held"},
+		{FleetID: fled, OwnerUUID: captain.UserUUID, StartHP: 200, EndHP: 40, Outcome: "withdrew"},
+	}}, fleets)
+
+	var status, dest string
+	var damage int
+	db.QueryRow("SELECT status, COALESCE(dest_system, ''), hull_damage FROM fleets WHERE id=?", fled).Scan(&status, &dest, &damage)
+	if status != "TRANSIT" || dest != "sys-1-0-0" || damage != 160 {
+		t.Errorf("Expected the withdrawn fleet heading home with 160 damage, got %s to %s with %d", status, dest, damage)
+	}
+	db.QueryRow("SELECT status, hull_damage FROM fleets WHERE id=?", held).Scan(&status, &damage)
+	if status != "ORBIT" || damage != 50 {
+		t.Fatalf("Expected the fleet that held to stay in orbit with 50 damage, got %s with %d", status, damage)
+	}
+
+	// The next battle starts from what is left of the hull
+	fleets[0].HullDamage = damage
+	r := resolveBattle("sys-2-0-0", []Fleet{fleets[0], {ID: 99, OwnerUUID: "pirate", HullClass: "Fighter"}}, 6)
+	if r.Participants[0].StartHP != 150 {
+		t.Errorf("Expected the damaged fleet to start at 150, got %d", r.Participants[0].StartHP)
+	}
+
+	// Repairs restore the hull (10 steel) and the laser's battle wear (5) once it's back over a shipyard
+	db.Exec("UPDATE fleets SET origin_system='sys-1-0-0' WHERE id=?", held)
+	rr := executeAuthedRequest(handleFleetManifest, "GET", fmt.Sprintf("/api/fleet/%d", held), nil, captain)
+	var m FleetManifest
+	json.Unmarshal(rr.Body.Bytes(), &m)
+	if m.Integrity != 150 || m.RepairCost != 15 {
+		t.Errorf("Expected 150 integrity costing 15 steel to repair, got %d (%d)", m.Integrity, m.RepairCost)
+	}
+	rr = executeAuthedRequest(handleFleetRepair, "POST", "/api/fleet/repair", map[string]interface{}{"fleet_id": held}, captain)
+	var steel int
+	db.QueryRow("SELECT steel FROM colonies WHERE id=?", fx.Colonies[0]).Scan(&steel)
+	db.QueryRow("SELECT hull_damage FROM fleets WHERE id=?", held).Scan(&damage)
+	if rr.Code != 200 || steel != 85 || damage != 0 {
+		t.Errorf("Expected a 15-steel repair, got %d %s with %d steel and %d damage left", rr.Code, rr.Body.String(), steel, damage)
+	}
+}
+
+// Test 91: Federation invites are signed by this node, redeem once and expire
+func TestFederationInvites(t *testing.T) {
+	setupTestEnv(t)
+	defer func(priv ed25519.PrivateKey, pub ed25519.PublicKey) { PrivateKey, PublicKey = priv, pub }(PrivateKey, PublicKey)
+	PublicKey, PrivateKey, _ = ed25519.GenerateKey(nil)
+	t.Setenv("OWNWORLD_ADMIN_KEY", "k")
+
+	admin := func(method, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/admin/invite", strings.NewReader(body))
+		req.Header.Set("X-Admin-Key", "k")
+		rr := httptest.NewRecorder()
+		handleAdminInvite(rr, req)
+		return rr
+	}
+	rr := admin("POST", `{"ttl_hours": 2}`)
+	var minted struct {
+		Token     string `json:"token"`
+		ID        string `json:"id"`
+		ExpiresAt int64  `json:"expires_at"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &minted)
+	if rr.Code != 200 || minted.Token == "" || minted.ExpiresAt < time.Now().Add(time.Hour).Unix() {
+		t.Fatalf("Expected a two-hour invite, got %d %s", rr.Code, rr.Body.String())
+	}
+	if claims, err := parseInvite(minted.Token); err != nil || claims.ID != minted.ID || claims.Issuer != ServerUUID {
+		t.Fatalf("Expected the minted invite to parse, got %+v %v", claims, err)
+	}
+
+	// Single use: the first node in gets it, the next is turned away
+	if err := redeemInvite(minted.Token, "node-x"); err != nil {
+		t.Fatalf("Expected the invite redeemed, got %v", err)
+	}
+	if err := redeemInvite(minted.Token, "node-y"); err == nil {
+		t.Error("Expected a used invite refused")
+	}
+	var listed []struct {
+		ID     string `json:"id"`
+		UsedBy string `json:"used_by"`
+	}
+	json.Unmarshal(admin("GET", "").Body.Bytes(), &listed)
+	if len(listed) != 1 || listed[0].ID != minted.ID || listed[0].UsedBy != "node-x" {
+		t.Errorf("Expected the invite listed as used by node-x, got %+v", listed)
+	}
+
+	expired, _, _ := mintInvite(-time.Minute)
+	if err := redeemInvite(expired, "node-x"); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("Expected an expired invite refused, got %v", err)
+	}
+
+	// Tokens that this node didn't sign, or that were altered, are refused
+	fresh, _, _ := mintInvite(time.Hour)
+	_, otherKey, _ := ed25519.GenerateKey(nil)
+	body := strings.Split(fresh, ".")[0]
+	claimsJson, _ := base64.RawURLEncoding.DecodeString(body)
+	foreign := body + "." + base64.RawURLEncoding.EncodeToString(ed25519.Sign(otherKey, claimsJson))
+	if err := redeemInvite(foreign, "node-x"); err == nil {
+		t.Error("Expected an invite signed by another key refused")
+	}
+	var claims InviteClaims
+	json.Unmarshal(claimsJson, &claims)
+	claims.ExpiresAt += 3600
+	stretched, _ := json.Marshal(claims)
+	if err := redeemInvite(base64.RawURLEncoding.EncodeToString(stretched)+"."+strings.Split(fresh, ".")[1], "node-x"); err == nil {
+		t.Error("Expected a tampered invite refused")
+	}
+	if err := redeemInvite(fresh, "node-z"); err != nil {
+		t.Errorf("Expected the untouched invite still redeemable, got %v", err)
+	}
+	rr = httptest.NewRecorder()
+	handleAdminInvite(rr, httptest.NewRequest("POST", "/admin/invite", nil))
+	if rr.Code != 401 {
+		t.Errorf("Expected minting without the admin key refused, got %d", rr.Code)
+	}
+}
+
+// Test 92: Fleets get a home among their owner's colonies and fly back to it when they can
+func TestFleetAutoReturn(t *testing.T) {
+	setupTestEnv(t)
+	fx := seed(t, Seed{
+		Users:    []SeedUser{{Username: "admiral"}, {Username: "rival"}},
+		Systems:  []SeedSystem{{ID: "sys-1-0-0"}, {ID: "sys-4-0-0"}, {ID: "sys-9-0-0"}},
+		Colonies: []SeedColony{{SystemID: "sys-1-0-0", Owner: "admiral"}, {SystemID: "sys-9-0-0", Owner: "rival"}},
+		Fleets: []SeedFleet{
+			{Owner: "admiral", System: "sys-4-0-0", HullClass: "Fighter", Fuel: 100000},
+			{Owner: "admiral", System: "sys-4-0-0", HullClass: "Fighter", Fuel: 1},
+		},
+	})
+	admiral, rival := fx.Users["admiral"], fx.Users["rival"]
+	fueled, dry := fx.Fleets[0], fx.Fleets[1]
+
+	home := func(fleetID int, sys string, as SeedSession) int {
+		return executeAuthedRequest(handleFleetHome, "POST", "/api/fleet/home",
+			map[string]interface{}{"fleet_id": fleetID, "home_system": sys, "auto_return": true}, as).Code
+	}
+	if code := home(fueled, "sys-1-0-0", rival); code != 403 {
+		t.Errorf("Expected another player's fleet refused, got %d", code)
+	}
+	if code := home(fueled, "sys-9-0-0", admiral); code != 400 {
+		t.Errorf("Expected a home without a colony of ours refused, got %d", code)
+	}
+	for _, id := range []int{fueled, dry} {
+		if code := home(id, "sys-1-0-0", admiral); code != 200 {
+			t.Fatalf("Expected the home set, got %d", code)
+		}
+	}
+
+	load := func(id int) (f Fleet) {
+		db.QueryRow("SELECT status, origin_system, COALESCE(dest_system, ''), arrival_tick, fuel, hull_class, home_system, auto_return FROM fleets WHERE id=?", id).
+			Scan(&f.Status, &f.OriginSystem, &f.DestSystem, &f.ArrivalTick, &f.Fuel, &f.HullClass, &f.HomeSystem, &f.AutoReturn)
+		f.ID = id
+		return
+	}
+	f := load(fueled)
+	if f.HomeSystem != "sys-1-0-0" || !f.AutoReturn {
+		t.Fatalf("Expected home and auto-return stored, got %+v", f)
+	}
+
+	// Routed home: the fuel for the hop is burned and the fleet arrives when the route says
+	cost, ticks := computeRoute("sys-4-0-0", "sys-1-0-0", "Fighter", nil)
+	if cost <= 0 || ticks <= 0 {
+		t.Fatalf("Expected a route home, got %d fuel over %d ticks", cost, ticks)
+	}
+	now := atomic.LoadInt64(&CurrentTick)
+	if !sendFleetHome(f, "sys-4-0-0") {
+		t.Fatal("Expected the fleet sent home")
+	}
+	if g := load(fueled); g.Status != "TRANSIT" || g.DestSystem != "sys-1-0-0" || g.Fuel != 100000-cost || g.ArrivalTick != now+ticks {
+		t.Errorf("Expected the fleet in transit home (fuel %d, arrival %d), got %+v", 100000-cost, now+ticks, g)
+	}
+
+	// No way home: too little fuel for the hop, no home set, or already there
+	if sendFleetHome(load(dry), "sys-4-0-0") {
+		t.Error("Expected a fleet without the fuel to stay put")
+	}
+	if g := load(dry); g.Status != "ORBIT" || g.Fuel != 1 {
+		t.Errorf("Expected the dry fleet left in orbit with its fuel, got %+v", g)
+	}
+	homeless := load(dry)
+	homeless.HomeSystem = ""
+	if sendFleetHome(homeless, "sys-4-0-0") || sendFleetHome(load(dry), "sys-1-0-0") {
+		t.Error("Expected no trip for a fleet without a home or already at it")
+	}
+}
+
+// Test 93: Mirrors replay delta snapshots between checkpoints and check them against the hash chain
+func TestDeltaSnapshotSync(t *testing.T) {
+	setupTestEnv(t)
+	defer atomic.StoreInt64(&CurrentTick, atomic.LoadInt64(&CurrentTick))
+	defer func(priv ed25519.PrivateKey, pub ed25519.PublicKey) { PrivateKey, PublicKey = priv, pub }(PrivateKey, PublicKey)
+	PublicKey, PrivateKey, _ = ed25519.GenerateKey(nil)
+	t.Setenv("FEDERATION_KEY", "fk")
+	fx := seed(t, Seed{
+		Users:    []SeedUser{{Username: "settler"}},
+		Systems:  []SeedSystem{{ID: "sys-1-0-0"}, {ID: "sys-2-0-0"}, {ID: "sys-3-0-0"}},
+		Colonies: []SeedColony{{SystemID: "sys-1-0-0", Owner: "settler", Laborers: 100}, {SystemID: "sys-2-0-0", Owner: "settler", Laborers: 200}},
+	})
+
+	// Day 0 is a checkpoint; the mirror starts from day 1 and replays days 2-3, which add and remove colonies
+	day := func(d int64, change string, args ...interface{}) {
+		if change != "" {
+			db.Exec(change, args...)
+		}
+		atomic.StoreInt64(&CurrentTick, d*TicksPerDay)
+		snapshotWorld()
+	}
+	day(0, "")
+	day(1, "UPDATE colonies SET pop_laborers=150 WHERE id=?", fx.Colonies[0])
+	day(2, "INSERT INTO colonies (system_id, owner_uuid, name, buildings_json, pop_laborers) VALUES ('sys-3-0-0', ?, 'Third', '{}', 50)", fx.Users["settler"].UserUUID)
+	day(3, "DELETE FROM colonies WHERE id=?", fx.Colonies[1])
+
+	tamper := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rr := httptest.NewRecorder()
+		handleSyncLedger(rr, r)
+		var items []map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &items)
+		for i, it := range items {
+			if i > 0 && it["blob"] != nil {
+				t.Errorf("Expected day %v sent as a delta, got a full blob", it["day_id"])
+			}
+		}
+		if tamper {
+			items[2]["hash"] = hashBLAKE3([]byte("forged"))
+		}
+		json.NewEncoder(w).Encode(items)
+	}))
+	defer srv.Close()
+
+	last, colonies, err := pullSnapshotChain(srv.Client(), srv.URL, 10)
+	if err != nil || last != 3 {
+		t.Fatalf("Expected the chain replayed to day 3, got %d %v", last, err)
+	}
+	var blob []byte
+	db.QueryRow("SELECT state_blob FROM daily_snapshots WHERE day_id=3").Scan(&blob)
+	got, _ := json.Marshal(colonies)
+	if !bytes.Equal(got, decompressLZ4(blob)) {
+		t.Errorf("Rebuilt day 3 differs from the published snapshot:\n%s\n%s", got, decompressLZ4(blob))
+	}
+
+	tamper = true
+	if _, _, err := pullSnapshotChain(srv.Client(), srv.URL, 10); err == nil || !strings.Contains(err.Error(), "hash mismatch") {
+		t.Errorf("Expected a broken chain refused, got %v", err)
+	}
+}
+
+// Test 94: A grievance one node files is paid off by the offender node through a receipt both
+// sign, which also restores the offender's standing on a third node that heard the grievance
+func TestNodeReparations(t *testing.T) {
+	setupTestEnv(t)
+	quietLogs(t)
+	t.Setenv("OWNWORLD_ADMIN_KEY", "k")
+	defer func(old map[string]*Peer, priv ed25519.PrivateKey, pub ed25519.PublicKey, id string) {
+		Peers, PrivateKey, PublicKey, ServerUUID = old, priv, pub, id
+	}(Peers, PrivateKey, PublicKey, ServerUUID)
+
+	// One key pair per node, and each node's own view of the others
+	nodes := []string{"node-a", "node-b", "node-c"}
+	keys := map[string]ed25519.PrivateKey{}
+	pubs := map[string]ed25519.PublicKey{}
+	for _, n := range nodes {
+		pubs[n], keys[n], _ = ed25519.GenerateKey(nil)
+	}
+	views := map[string]map[string]*Peer{}
+	for _, n := range nodes {
+		views[n] = map[string]*Peer{}
+		for _, other := range nodes {
+			if other != n {
+				views[n][other] = &Peer{UUID: other, PublicKey: pubs[other], Reputation: 10}
+			}
+		}
+	}
+	become := func(n string) {
+		ServerUUID, PrivateKey, PublicKey, Peers = n, keys[n], pubs[n], views[n]
+	}
+	admin := func(handler http.HandlerFunc, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("X-Admin-Key", "k")
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+	lastSent := func(to string) (payload []byte) {
+		db.QueryRow("SELECT payload FROM federation_outbox WHERE peer_uuid=? ORDER BY id DESC LIMIT 1", to).Scan(&payload)
+		return payload
+	}
+	treasury := func(n string) (c int) {
+		db.QueryRow("SELECT credits FROM users WHERE global_uuid=?", n).Scan(&c)
+		return c
+	}
+
+	// node-a files a numbered grievance against node-b; node-c hears it too
+	become("node-a")
+	if rr := admin(handleAdminGrievances, "/admin/grievances", `{"offender_node":"node-b","damage":100}`); rr.Code != 200 {
+		t.Fatalf("Expected the grievance filed, got %d %s", rr.Code, rr.Body.String())
+	}
+	var g GrievanceReport
+	json.Unmarshal(lastSent("node-b"), &g)
+	if g.ID <= 0 || g.OffenderUUID != "node-b" || !bytes.Equal(lastSent("node-b"), lastSent("node-c")) {
+		t.Fatalf("Expected a numbered report sent to both peers, got %+v", g)
+	}
+	become("node-c")
+	processGrievance(&g, "node-a")
+	if rep := views["node-c"]["node-b"].Reputation; rep != 9 {
+		t.Fatalf("Expected node-b penalized on node-c, got reputation %.2f", rep)
+	}
+
+	// node-b records what it owes and pays half from its treasury
+	become("node-b")
+	processGrievance(&g, "node-a")
+	if rep := views["node-b"]["node-a"].Reputation; rep != 10 {
+		t.Errorf("Expected a grievance against us to penalize no one, got reputation %.2f", rep)
+	}
+	settle := fmt.Sprintf(`{"victim_node":"node-a","grievance_id":%d,"amount":500}`, g.ID)
+	if rr := admin(handleAdminSettleGrievance, "/admin/grievances/settle", settle); rr.Code != 402 {
+		t.Errorf("Expected an empty treasury refused, got %d", rr.Code)
+	}
+	db.Exec("INSERT INTO users (global_uuid, username, credits) VALUES ('node-b', ?, 2000)", TreasuryName)
+	if rr := admin(handleAdminSettleGrievance, "/admin/grievances/settle", settle); rr.Code != 200 || treasury("node-b") != 1500 {
+		t.Fatalf("Expected 500 credits paid, got %d and a %d treasury", rr.Code, treasury("node-b"))
+	}
+	var rc ReparationReceipt
+	json.Unmarshal(lastSent("node-a"), &rc)
+	if rc.GrievanceID != g.ID || rc.Paid != 500 || rc.OffenderSig == "" || rc.VictimSig != "" {
+		t.Fatalf("Expected a receipt signed by node-b alone, got %+v", rc)
+	}
+
+	// node-a countersigns, credits its treasury once and tells everyone
+	become("node-a")
+	forged := rc
+	forged.Paid = 1000
+	processReparation(&forged, "node-b")
+	processReparation(&rc, "node-c")
+	if treasury("node-a") != 0 {
+		t.Fatalf("Expected forged or relayed receipts ignored, got a %d treasury", treasury("node-a"))
+	}
+	processReparation(&rc, "node-b")
+	processReparation(&rc, "node-b")
+	if treasury("node-a") != 500 {
+		t.Fatalf("Expected 500 credits received once, got a %d treasury", treasury("node-a"))
+	}
+	var signed ReparationReceipt
+	json.Unmarshal(lastSent("node-c"), &signed)
+	if signed.VictimSig == "" || !bytes.Equal(lastSent("node-b"), lastSent("node-c")) {
+		t.Fatalf("Expected the countersigned receipt broadcast, got %+v", signed)
+	}
+
+	// node-c gives back half the penalty
+	become("node-c")
+	processReparation(&signed, "node-a")
+	if rep := views["node-c"]["node-b"].Reputation; rep != 9.5 {
+		t.Errorf("Expected half the penalty restored on node-c, got reputation %.2f", rep)
+	}
+
+	// Paying off the rest is capped at what is owed
+	become("node-b")
+	settle = fmt.Sprintf(`{"victim_node":"node-a","grievance_id":%d,"amount":5000}`, g.ID)
+	if rr := admin(handleAdminSettleGrievance, "/admin/grievances/settle", settle); rr.Code != 200 || treasury("node-b") != 1000 {
+		t.Fatalf("Expected the rest paid, got %d and a %d treasury", rr.Code, treasury("node-b"))
+	}
+	if rr := admin(handleAdminSettleGrievance, "/admin/grievances/settle", settle); rr.Code != 409 {
+		t.Errorf("Expected a settled grievance refused, got %d", rr.Code)
+	}
+}
+
+// Test 95: An outpost in the same system doesn't stand in for the planet colony's trading post,
+// shipyard and module stock
+func TestOutpostBesidePlanet(t *testing.T) {
+	setupTestEnv(t)
+	// The outpost comes first in the table, as it does once a lost planet is resettled
+	fx := seed(t, Seed{
+		Users:   []SeedUser{{Username: "settler", Credits: 1000}},
+		Systems: []SeedSystem{{ID: "sys-8-1-0"}},
+		Colonies: []SeedColony{
+			{SystemID: "sys-8-1-0", Owner: "settler", Name: "Belt Camp", SiteType: SiteAsteroidBelt},
+			{SystemID: "sys-8-1-0", Owner: "settler", Name: "Homeport", Resources: map[string]int{"iron": 100},
+				Buildings: map[string]int{"trading_post": 1, "shipyard": 1}, Modules: map[string]int{"laser": 1}},
+		},
+		Fleets: []SeedFleet{{Owner: "settler", System: "sys-8-1-0", HullClass: "Fighter", Modules: []string{"laser"}, Fuel: 100}},
+	})
+	settler, outpost, planet := fx.Users["settler"], fx.Colonies[0], fx.Colonies[1]
+
+	if rr := executeAuthedRequest(handlePlaceOrder, "POST", "/api/market/place", MarketOrder{Item: "iron", Quantity: 10, Price: 10, OriginSystem: "sys-8-1-0"}, settler); rr.Code != 200 {
+		t.Errorf("Expected the planet's trading post to list the order, got %d %s", rr.Code, rr.Body.String())
+	}
+	rr := executeAuthedRequest(handleFleetRefit, "POST", "/api/fleet/refit", map[string]interface{}{"fleet_id": fx.Fleets[0], "modules": []string{"laser", "laser"}}, settler)
+	if rr.Code != 200 {
+		t.Fatalf("Expected the planet's shipyard to refit the fleet, got %d %s", rr.Code, rr.Body.String())
+	}
+	var planetStock, outpostStock string
+	db.QueryRow("SELECT COALESCE(module_stock_json, '') FROM colonies WHERE id=?", planet).Scan(&planetStock)
+	db.QueryRow("SELECT COALESCE(module_stock_json, '') FROM colonies WHERE id=?", outpost).Scan(&outpostStock)
+	if strings.Contains(planetStock, "laser") || strings.Contains(outpostStock, "laser") {
+		t.Errorf("Expected the laser taken from the planet's stock, got planet %s, outpost %s", planetStock, outpostStock)
+	}
+}
+
+// Test 96: The consistency check refunds market escrow left with a vanished peer or seller and
+// lists what each repair dropped
+func TestConsistencyEscrow(t *testing.T) {
+	setupTestEnv(t)
+	defer func(old map[string]*Peer) { Peers = old }(Peers)
+	Peers = map[string]*Peer{}
+	fx := seed(t, Seed{
+		Users:    []SeedUser{{Username: "trader"}},
+		Colonies: []SeedColony{{SystemID: "sys-6-6-6", Owner: "trader", Buildings: map[string]int{"trading_post": 1}}},
+		Fleets: []SeedFleet{
+			{Owner: "trader", System: "sys-6-6-6", HullClass: "Fighter"},
+			{Owner: "trader", Status: "TRANSIT", System: "sys-6-6-6", Dest: "sys-9-9-9", HullClass: "Fighter", ArrivalTick: 99},
+			{Owner: "trader", Status: "TRANSIT", System: "sys-6-6-6", Dest: "sys-9-9-9", HullClass: "Fighter", ArrivalTick: 99},
+		},
+		Peers: []SeedPeer{{UUID: "node-live"}},
+	})
+	trader, colony := fx.Users["trader"], fx.Colonies[0]
+	holder, stray, headed := fx.Fleets[0], fx.Fleets[1], fx.Fleets[2]
+
+	settlement := func(id, role, peer string) {
+		db.Exec(`INSERT INTO settlements (id, role, peer_uuid, order_id, item, quantity, price, is_buy, system_id, order_expires,
+		         fleet_id, fleet_owner, colony_id, order_owner, status, deadline_tick, created_tick)
+		         VALUES (?, ?, ?, ?, 'iron', 5, 10, 0, 'sys-6-6-6', 99999, ?, ?, ?, ?, 'prepared', 99, 0)`,
+			id, role, peer, "ord-"+id, holder, trader.UserUUID, colony, trader.UserUUID)
+	}
+	settlement("coord", RoleCoordinator, "node-gone")
+	settlement("part", RoleParticipant, "node-gone")
+	settlement("live", RoleParticipant, "node-live")
+	order := func(id, seller string, qty int, node string) {
+		db.Exec("INSERT INTO market_orders (order_id, seller_uuid, item, quantity, price, is_buy, origin_system, expires_tick, origin_node) VALUES (?, ?, 'iron', ?, 10, 0, 'sys-6-6-6', 99999, ?)",
+			id, seller, qty, node)
+	}
+	order("ord-ghost", "nobody", 5, "")
+	order("ord-remote", "nobody", 5, "node-live")
+	order("ord-empty", trader.UserUUID, 0, "")
+	db.Exec("UPDATE fleets SET target_order_id='ord-ghost' WHERE id=?", stray)
+	db.Exec("UPDATE fleets SET target_order_id='ord-part' WHERE id=?", headed)
+
+	report := runConsistencyCheck()
+	dropped := map[string]string{}
+	for _, issue := range report.Issues {
+		dropped[issue.Check] = strings.Join(issue.Dropped, ",")
+	}
+	want := map[string]string{
+		"invalid_market_orders": "ord-empty",
+		"orphan_settlements":    "coord,part",
+		"orphan_market_orders":  "ord-ghost",
+		"orphan_order_targets":  fmt.Sprint(stray),
+	}
+	for check, ids := range want {
+		if dropped[check] != ids {
+			t.Errorf("Expected %s to drop %q, got %q", check, ids, dropped[check])
+		}
+	}
+
+	// The coordinator refunds the fleet's hold, the participant the seller's goods and order
+	var plJson string
+	var iron int
+	var restored, remote, target string
+	db.QueryRow("SELECT payload_json FROM fleets WHERE id=?", holder).Scan(&plJson)
+	db.QueryRow("SELECT iron FROM colonies WHERE id=?", colony).Scan(&iron)
+	db.QueryRow("SELECT order_id FROM market_orders WHERE order_id='ord-part'").Scan(&restored)
+	db.QueryRow("SELECT order_id FROM market_orders WHERE order_id='ord-remote'").Scan(&remote)
+	db.QueryRow("SELECT COALESCE(target_order_id, '') FROM fleets WHERE id=?", headed).Scan(&target)
+	var pl FleetPayload
+	json.Unmarshal([]byte(plJson), &pl)
+	if pl.Credits != 50 || iron != 5 || restored == "" {
+		t.Errorf("Expected both sides refunded, got %d credits in the hold, %d iron, order %q", pl.Credits, iron, restored)
+	}
+	if remote == "" || target != "ord-part" {
+		t.Errorf("Expected another node's order and a live reservation kept, got %q and %q", remote, target)
+	}
+	if s, _ := loadSettlement("live"); s.Status != SettlementPrepared {
+		t.Errorf("Expected a settlement with a known peer left alone, got %s", s.Status)
+	}
 }
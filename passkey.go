@@ -0,0 +1,493 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Passkeys ---
+// Players can log in with a WebAuthn passkey instead of a password. A logged-in player asks for
+// a registration challenge, has the browser create a credential for it and sends back the
+// clientDataJSON, the authenticator data and the credential's public key as the browser hands
+// it out (AuthenticatorAttestationResponse.getPublicKey(), DER SubjectPublicKeyInfo), so no
+// attestation parsing is needed. Logging in is the same dance with navigator.credentials.get:
+// the assertion signature over authenticatorData || SHA-256(clientDataJSON) is checked against
+// the stored key and a normal session is issued. Passkey logins count towards the same
+// throttling as passwords.
+//
+// The relying party ID is OWNWORLD_PASSKEY_RP_ID, or the host this node advertises to peers.
+// Origins must be https on that host or a subdomain (plain http is allowed for localhost).
+//
+// The account's ed25519 key stays encrypted with the password: a passkey session can play but
+// signing an action (/api/keys/unlock, /api/keys/sign) still asks for the password.
+
+const (
+	PasskeyChallengeTTL    = 5 * time.Minute
+	MaxPasskeysPerUser     = 10
+	MaxPasskeyChallenges   = 10000
+	PasskeyAlgES256        = -7
+	PasskeyAlgEdDSA        = -8
+	PasskeyAlgRS256        = -257
+	passkeyFlagUserPresent = 0x01
+	passkeyFlagAttested    = 0x40
+)
+
+type Passkey struct {
+	CredentialID string `json:"credential_id"`
+	Name         string `json:"name"`
+	Algorithm    int    `json:"algorithm"`
+	CreatedAt    int64  `json:"created_at"`
+	LastUsed     int64  `json:"last_used"`
+}
+
+// Options for navigator.credentials.create/get; binary fields are base64url
+type PasskeyChallenge struct {
+	Challenge   string   `json:"challenge"`
+	RPID        string   `json:"rp_id"`
+	UserID      string   `json:"user_id,omitempty"`   // registration: the user handle
+	UserName    string   `json:"user_name,omitempty"` // registration
+	Credentials []string `json:"credentials"`         // exclude (registration) or allow (login) list
+}
+
+type passkeyChallenge struct {
+	UserID   string // who registers; who may log in (empty = anyone)
+	Register bool
+	Expires  time.Time
+}
+
+var (
+	passkeyChallenges = make(map[string]passkeyChallenge)
+	passkeyLock       sync.Mutex
+)
+
+// Logins are a user API, off on headless resource nodes like /api/register
+func commandControlOnly(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !Config.CommandControl {
+			http.Error(w, "Logins Disabled on this Node", 403)
+			return
+		}
+		h(w, r)
+	}
+}
+
+func passkeyRPID() string {
+	if id := os.Getenv("OWNWORLD_PASSKEY_RP_ID"); id != "" {
+		return id
+	}
+	if u, err := parseAddr(AdvertisedAddr()); err == nil && u.Hostname() != "" {
+		return u.Hostname()
+	}
+	return "localhost"
+}
+
+func b64url(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Browsers send unpadded base64url; tolerate padding
+func unb64url(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+func newPasskeyChallenge(userID string, register bool) string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	challenge := b64url(b)
+
+	now := time.Now()
+	passkeyLock.Lock()
+	defer passkeyLock.Unlock()
+	if len(passkeyChallenges) >= MaxPasskeyChallenges {
+		for k, c := range passkeyChallenges {
+			if now.After(c.Expires) {
+				delete(passkeyChallenges, k)
+			}
+		}
+	}
+	passkeyChallenges[challenge] = passkeyChallenge{UserID: userID, Register: register, Expires: now.Add(PasskeyChallengeTTL)}
+	return challenge
+}
+
+// Consumes a challenge; each one answers a single ceremony
+func takePasskeyChallenge(challenge string, register bool) (passkeyChallenge, bool) {
+	passkeyLock.Lock()
+	defer passkeyLock.Unlock()
+	c, ok := passkeyChallenges[challenge]
+	if !ok {
+		return c, false
+	}
+	delete(passkeyChallenges, challenge)
+	return c, c.Register == register && time.Now().Before(c.Expires)
+}
+
+// Checks clientDataJSON is for this ceremony and origin and returns the challenge it answers
+func verifyClientData(raw []byte, ceremony string) (string, error) {
+	var cd struct {
+		Type      string `json:"type"`
+		Challenge string `json:"challenge"`
+		Origin    string `json:"origin"`
+	}
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return "", fmt.Errorf("malformed client data")
+	}
+	if cd.Type != ceremony {
+		return "", fmt.Errorf("client data is for %q", cd.Type)
+	}
+	rpID := passkeyRPID()
+	u, err := url.Parse(cd.Origin)
+	if err != nil {
+		return "", fmt.Errorf("bad origin")
+	}
+	host := u.Hostname()
+	if host != rpID && !strings.HasSuffix(host, "."+rpID) {
+		return "", fmt.Errorf("origin %s is not under %s", cd.Origin, rpID)
+	}
+	if u.Scheme != "https" && !(u.Scheme == "http" && rpID == "localhost") {
+		return "", fmt.Errorf("origin must be https")
+	}
+	return strings.TrimRight(cd.Challenge, "="), nil
+}
+
+// Checks authenticator data is for our RP with the user present; returns the flags and counter
+func verifyAuthData(authData []byte) (flags byte, signCount uint32, err error) {
+	if len(authData) < 37 {
+		return 0, 0, fmt.Errorf("authenticator data too short")
+	}
+	rpHash := sha256.Sum256([]byte(passkeyRPID()))
+	if !bytes.Equal(authData[:32], rpHash[:]) {
+		return 0, 0, fmt.Errorf("credential is for another relying party")
+	}
+	flags = authData[32]
+	if flags&passkeyFlagUserPresent == 0 {
+		return 0, 0, fmt.Errorf("user not present")
+	}
+	return flags, binary.BigEndian.Uint32(authData[33:37]), nil
+}
+
+// Parses a DER public key and checks it is of the claimed COSE algorithm
+func parsePasskeyKey(der []byte, alg int) (crypto.PublicKey, error) {
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("bad public key")
+	}
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		if alg == PasskeyAlgES256 && k.Curve == elliptic.P256() {
+			return k, nil
+		}
+	case ed25519.PublicKey:
+		if alg == PasskeyAlgEdDSA {
+			return k, nil
+		}
+	case *rsa.PublicKey:
+		if alg == PasskeyAlgRS256 && k.N.BitLen() >= 2048 {
+			return k, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported key for algorithm %d", alg)
+}
+
+func verifyPasskeySignature(pub crypto.PublicKey, authData, clientData, sig []byte) bool {
+	cdHash := sha256.Sum256(clientData)
+	signed := append(append([]byte{}, authData...), cdHash[:]...)
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(signed)
+		return ecdsa.VerifyASN1(k, digest[:], sig)
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, signed, sig)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(signed)
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig) == nil
+	}
+	return false
+}
+
+func userPasskeys(userID string) []Passkey {
+	keys := []Passkey{}
+	rows, err := db.Query("SELECT credential_id, name, algorithm, created_at, last_used FROM passkeys WHERE user_uuid=? ORDER BY id", userID)
+	if err != nil {
+		return keys
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var k Passkey
+		rows.Scan(&k.CredentialID, &k.Name, &k.Algorithm, &k.CreatedAt, &k.LastUsed)
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func passkeyIDs(keys []Passkey) []string {
+	ids := make([]string, len(keys))
+	for i, k := range keys {
+		ids[i] = k.CredentialID
+	}
+	return ids
+}
+
+// GET lists your passkeys; POST {"credential_id", "remove": true} deletes one
+func handlePasskeys(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var req struct {
+			CredentialID string `json:"credential_id" validate:"required"`
+			Remove       bool   `json:"remove"`
+		}
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		if !req.Remove {
+			http.Error(w, "Bad Request: nothing to do", 400)
+			return
+		}
+		res, _ := db.Exec("DELETE FROM passkeys WHERE user_uuid=? AND credential_id=?", userID, req.CredentialID)
+		if n, _ := res.RowsAffected(); n == 0 {
+			http.Error(w, "Passkey Not Found", 404)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(userPasskeys(userID))
+}
+
+// POST -> options for navigator.credentials.create
+func handlePasskeyRegisterBegin(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+	var username string
+	db.QueryRow("SELECT username FROM users WHERE global_uuid=?", userID).Scan(&username)
+
+	keys := userPasskeys(userID)
+	if len(keys) >= MaxPasskeysPerUser {
+		http.Error(w, fmt.Sprintf("Passkey limit reached (%d)", MaxPasskeysPerUser), 400)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PasskeyChallenge{
+		Challenge: newPasskeyChallenge(userID, true), RPID: passkeyRPID(),
+		UserID: b64url([]byte(userID)), UserName: username, Credentials: passkeyIDs(keys),
+	})
+}
+
+// POST {"credential_id", "client_data_json", "authenticator_data", "public_key", "algorithm", "name"}
+// stores the new credential; binary fields are base64url
+func handlePasskeyRegisterFinish(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	var req struct {
+		CredentialID      string `json:"credential_id" validate:"required"`
+		ClientDataJSON    string `json:"client_data_json" validate:"required"`
+		AuthenticatorData string `json:"authenticator_data" validate:"required"`
+		PublicKey         string `json:"public_key" validate:"required"`
+		Algorithm         int    `json:"algorithm" validate:"required"`
+		Name              string `json:"name"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	credID, err1 := unb64url(req.CredentialID)
+	clientData, err2 := unb64url(req.ClientDataJSON)
+	authData, err3 := unb64url(req.AuthenticatorData)
+	der, err4 := unb64url(req.PublicKey)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil || len(credID) == 0 {
+		http.Error(w, "Bad Request: fields must be base64url", 400)
+		return
+	}
+
+	challenge, err := verifyClientData(clientData, "webauthn.create")
+	if err != nil {
+		http.Error(w, "Registration Failed: "+err.Error(), 400)
+		return
+	}
+	if c, ok := takePasskeyChallenge(challenge, true); !ok || c.UserID != userID {
+		http.Error(w, "Registration Failed: unknown or expired challenge", 400)
+		return
+	}
+	flags, signCount, err := verifyAuthData(authData)
+	if err != nil {
+		http.Error(w, "Registration Failed: "+err.Error(), 400)
+		return
+	}
+	// Attested credential data: aaguid(16) | id length(2) | id | COSE key
+	if flags&passkeyFlagAttested == 0 || len(authData) < 55 {
+		http.Error(w, "Registration Failed: no attested credential", 400)
+		return
+	}
+	idLen := int(binary.BigEndian.Uint16(authData[53:55]))
+	if len(authData) < 55+idLen || !bytes.Equal(authData[55:55+idLen], credID) {
+		http.Error(w, "Registration Failed: credential id mismatch", 400)
+		return
+	}
+	if _, err := parsePasskeyKey(der, req.Algorithm); err != nil {
+		http.Error(w, "Registration Failed: "+err.Error(), 400)
+		return
+	}
+
+	defer lockRows(userRow(userID))()
+
+	var count int
+	db.QueryRow("SELECT count(*) FROM passkeys WHERE user_uuid=?", userID).Scan(&count)
+	if count >= MaxPasskeysPerUser {
+		http.Error(w, fmt.Sprintf("Passkey limit reached (%d)", MaxPasskeysPerUser), 400)
+		return
+	}
+	if req.Name == "" {
+		req.Name = fmt.Sprintf("Passkey %d", count+1)
+	}
+	_, err = db.Exec(`INSERT INTO passkeys (user_uuid, credential_id, public_key, algorithm, sign_count, name, created_at)
+	                   VALUES (?, ?, ?, ?, ?, ?, ?)`, userID, b64url(credID), der, req.Algorithm, signCount, req.Name, time.Now().Unix())
+	if err != nil {
+		http.Error(w, "Credential Already Registered", 409)
+		return
+	}
+	InfoLog.Printf("🔑 Passkey %q registered for %s", req.Name, userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(userPasskeys(userID))
+}
+
+// POST {"username"} -> options for navigator.credentials.get. Without a username the browser
+// offers any discoverable passkey it holds for this node.
+func handlePasskeyLoginBegin(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	var req struct {
+		Username string `json:"username"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	var userID string
+	ids := []string{}
+	if req.Username != "" {
+		if rejectThrottledLogin(w, req.Username) {
+			return
+		}
+		// An unknown name gets a challenge no credential can answer, like a name without passkeys
+		if db.QueryRow("SELECT global_uuid FROM users WHERE username=?", req.Username).Scan(&userID) == nil {
+			ids = passkeyIDs(userPasskeys(userID))
+		} else {
+			userID = "-"
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PasskeyChallenge{
+		Challenge: newPasskeyChallenge(userID, false), RPID: passkeyRPID(), Credentials: ids,
+	})
+}
+
+// POST {"credential_id", "client_data_json", "authenticator_data", "signature"} -> a session, as
+// a password login returns
+func handlePasskeyLoginFinish(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	var req struct {
+		CredentialID      string `json:"credential_id" validate:"required"`
+		ClientDataJSON    string `json:"client_data_json" validate:"required"`
+		AuthenticatorData string `json:"authenticator_data" validate:"required"`
+		Signature         string `json:"signature" validate:"required"`
+		UserHandle        string `json:"user_handle"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	credID, err1 := unb64url(req.CredentialID)
+	clientData, err2 := unb64url(req.ClientDataJSON)
+	authData, err3 := unb64url(req.AuthenticatorData)
+	sig, err4 := unb64url(req.Signature)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		http.Error(w, "Bad Request: fields must be base64url", 400)
+		return
+	}
+
+	var userID, username string
+	var der []byte
+	var alg int
+	var storedCount uint32
+	err := db.QueryRow(`SELECT p.user_uuid, u.username, p.public_key, p.algorithm, p.sign_count FROM passkeys p
+	                    JOIN users u ON u.global_uuid = p.user_uuid WHERE p.credential_id=?`, b64url(credID)).
+		Scan(&userID, &username, &der, &alg, &storedCount)
+	if err != nil {
+		http.Error(w, "Invalid Credentials", 401)
+		return
+	}
+	if rejectThrottledLogin(w, username) {
+		return
+	}
+
+	fail := func(reason string) {
+		recordLoginFailure(username, userID)
+		http.Error(w, "Invalid Credentials: "+reason, 401)
+	}
+	challenge, err := verifyClientData(clientData, "webauthn.get")
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	if c, ok := takePasskeyChallenge(challenge, false); !ok || (c.UserID != "" && c.UserID != userID) {
+		fail("unknown or expired challenge")
+		return
+	}
+	if req.UserHandle != "" {
+		if handle, err := unb64url(req.UserHandle); err != nil || string(handle) != userID {
+			fail("user handle mismatch")
+			return
+		}
+	}
+	_, signCount, err := verifyAuthData(authData)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	pub, err := parsePasskeyKey(der, alg)
+	if err != nil || !verifyPasskeySignature(pub, authData, clientData, sig) {
+		fail("bad signature")
+		return
+	}
+	// Counters only go up; a step back means the authenticator was cloned
+	if (signCount != 0 || storedCount != 0) && signCount <= storedCount {
+		InfoLog.Printf("⚠️ Passkey %s for %s replayed its counter (%d <= %d)", req.CredentialID, username, signCount, storedCount)
+		fail("signature counter went backwards")
+		return
+	}
+
+	db.Exec("UPDATE passkeys SET sign_count=?, last_used=? WHERE credential_id=?", signCount, time.Now().Unix(), b64url(credID))
+	startLoginSession(w, userID, clearLoginFailures(username))
+}
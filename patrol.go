@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+)
+
+// --- Patrols ---
+// A fleet on PATROL cycles through waypoints in its owner's systems. At each one it goes on
+// station (origin_system = dest_system) for its dwell time, where it counts as in orbit: the
+// combat pass engages any hostile found there. Arriving on station it also files a sighting
+// for every foreign fleet in orbit, kept as intel (GET /api/fleet/patrol) and sent to the
+// patrol_sighting webhook. Each leg burns fuel like a launch; a fleet that can't pay for the
+// next leg ends its patrol in orbit where it is.
+
+const (
+	FleetPatrol        = "PATROL"
+	MaxPatrolWaypoints = 10
+	DefaultPatrolDwell = 10 // ticks on station at each waypoint
+	MaxPatrolDwell     = 500
+	PatrolIntelShown   = 100
+)
+
+type PatrolRoute struct {
+	Waypoints []string `json:"waypoints"`
+	Next      int      `json:"next"` // index of the waypoint being flown to or held
+	Dwell     int64    `json:"dwell"`
+}
+
+type PatrolSighting struct {
+	FleetID       int    `json:"fleet_id"`
+	SystemID      string `json:"system_id"`
+	Tick          int64  `json:"tick"`
+	HostileOwner  string `json:"hostile_owner"`
+	HostileFleets int    `json:"hostile_fleets"`
+}
+
+// Files a sighting for each foreign owner orbiting the system
+func recordSightings(fleetID int, owner, sysID string, tick int64) {
+	rows, err := db.Query(`SELECT owner_uuid, count(*) FROM fleets WHERE origin_system=? AND owner_uuid != ?
+	                       AND (status='ORBIT' OR (status=? AND origin_system=dest_system)) GROUP BY owner_uuid`, sysID, owner, FleetPatrol)
+	if err != nil {
+		return
+	}
+	var seen []PatrolSighting
+	for rows.Next() {
+		s := PatrolSighting{FleetID: fleetID, SystemID: sysID, Tick: tick}
+		rows.Scan(&s.HostileOwner, &s.HostileFleets)
+		seen = append(seen, s)
+	}
+	rows.Close()
+
+	for _, s := range seen {
+		db.Exec("INSERT INTO patrol_sightings (owner_uuid, fleet_id, system_id, tick, hostile_owner, hostile_fleets) VALUES (?, ?, ?, ?, ?, ?)",
+			owner, s.FleetID, s.SystemID, s.Tick, s.HostileOwner, s.HostileFleets)
+		emitEvent(owner, EventPatrolSighting, s)
+	}
+}
+
+// Sends a patrolling fleet on to its next waypoint; false (and back in orbit) if it can't
+func departPatrol(f Fleet, route PatrolRoute, current int64) bool {
+	route.Next = (route.Next + 1) % len(route.Waypoints)
+	target := route.Waypoints[route.Next]
+	cost, travel := computeWornRoute(f.OriginSystem, target, f.HullClass, f.Modules, f.Condition)
+	if cost < 0 || f.Fuel < cost {
+		db.Exec("UPDATE fleets SET status='ORBIT', dest_system=origin_system, patrol_json='' WHERE id=?", f.ID)
+		InfoLog.Printf("🛰️ Fleet %d ended its patrol at %s: not enough fuel for %s", f.ID, f.OriginSystem, target)
+		return false
+	}
+	rJson, _ := json.Marshal(route)
+	db.Exec(`UPDATE fleets SET fuel=fuel-?, route_fuel=?, dest_system=?, departure_tick=?, arrival_tick=?, patrol_json=? WHERE id=?`,
+		cost, cost, target, current, current+travel, string(rJson), f.ID)
+	return true
+}
+
+// Moves patrols along: arrivals go on station and report, those done dwelling depart
+func processPatrols(current int64) {
+	rows, err := db.Query(`SELECT id, owner_uuid, origin_system, dest_system, arrival_tick, fuel, hull_class, modules_json, COALESCE(module_condition_json, ''), COALESCE(patrol_json, '')
+	                       FROM fleets WHERE status=? AND arrival_tick <= ?`, FleetPatrol, current)
+	if err != nil {
+		return
+	}
+	type patrol struct {
+		Fleet
+		Route PatrolRoute
+	}
+	var patrols []patrol
+	for rows.Next() {
+		var p patrol
+		var modJson, condJson, rJson string
+		rows.Scan(&p.ID, &p.OwnerUUID, &p.OriginSystem, &p.DestSystem, &p.ArrivalTick, &p.Fuel, &p.HullClass, &modJson, &condJson, &rJson)
+		json.Unmarshal([]byte(modJson), &p.Modules)
+		p.Condition = parseCondition(condJson)
+		json.Unmarshal([]byte(rJson), &p.Route)
+		patrols = append(patrols, p)
+	}
+	rows.Close()
+
+	for _, p := range patrols {
+		if len(p.Route.Waypoints) == 0 {
+			db.Exec("UPDATE fleets SET status='ORBIT', dest_system=origin_system WHERE id=?", p.ID)
+			continue
+		}
+		if p.OriginSystem != p.DestSystem {
+			db.Exec("UPDATE fleets SET origin_system=dest_system WHERE id=?", p.ID)
+			recordSightings(p.ID, p.OwnerUUID, p.DestSystem, current)
+			continue
+		}
+		if current-p.ArrivalTick >= p.Route.Dwell {
+			departPatrol(p.Fleet, p.Route, current)
+		}
+	}
+}
+
+func patrolIntel(owner string, limit int) []PatrolSighting {
+	list := []PatrolSighting{}
+	rows, err := db.Query("SELECT fleet_id, system_id, tick, hostile_owner, hostile_fleets FROM patrol_sightings WHERE owner_uuid=? ORDER BY id DESC LIMIT ?", owner, limit)
+	if err != nil {
+		return list
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s PatrolSighting
+		rows.Scan(&s.FleetID, &s.SystemID, &s.Tick, &s.HostileOwner, &s.HostileFleets)
+		list = append(list, s)
+	}
+	return list
+}
+
+// GET: sightings reported by your patrols, newest first.
+// POST {"fleet_id", "waypoints": [system ids], "dwell"}: put an orbiting fleet on patrol
+// through systems where you have a colony; empty waypoints end a patrol where the fleet is.
+func handlePatrol(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(patrolIntel(userID, PatrolIntelShown))
+		return
+	}
+
+	var req struct {
+		FleetID   int      `json:"fleet_id" validate:"required"`
+		Waypoints []string `json:"waypoints"`
+		Dwell     int64    `json:"dwell"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	defer lockRows(userRow(userID))()
+
+	var f Fleet
+	var modJson, condJson string
+	err = db.QueryRow("SELECT owner_uuid, status, origin_system, dest_system, fuel, hull_class, modules_json, COALESCE(module_condition_json, '') FROM fleets WHERE id=?", req.FleetID).
+		Scan(&f.OwnerUUID, &f.Status, &f.OriginSystem, &f.DestSystem, &f.Fuel, &f.HullClass, &modJson, &condJson)
+	if err != nil || f.OwnerUUID != userID {
+		http.Error(w, "Fleet Not Found", 404)
+		return
+	}
+	json.Unmarshal([]byte(modJson), &f.Modules)
+	f.Condition = parseCondition(condJson)
+
+	if len(req.Waypoints) == 0 {
+		if f.Status != FleetPatrol {
+			http.Error(w, "Fleet is not on patrol", 400)
+			return
+		}
+		if f.OriginSystem != f.DestSystem {
+			http.Error(w, "Fleet is between waypoints; stand down once it arrives", 409)
+			return
+		}
+		db.Exec("UPDATE fleets SET status='ORBIT', patrol_json='' WHERE id=?", req.FleetID)
+		w.Write([]byte("Patrol Ended at " + f.OriginSystem))
+		return
+	}
+
+	if f.Status != "ORBIT" {
+		http.Error(w, "Fleet must be in orbit", 400)
+		return
+	}
+	if len(req.Waypoints) > MaxPatrolWaypoints {
+		http.Error(w, "At most "+strconv.Itoa(MaxPatrolWaypoints)+" waypoints", 400)
+		return
+	}
+	if req.Dwell == 0 {
+		req.Dwell = DefaultPatrolDwell
+	}
+	if req.Dwell < 1 || req.Dwell > MaxPatrolDwell {
+		http.Error(w, fmt.Sprintf("Dwell must be 1-%d ticks", MaxPatrolDwell), 400)
+		return
+	}
+	for _, sys := range req.Waypoints {
+		var count int
+		db.QueryRow("SELECT count(*) FROM colonies WHERE system_id=? AND owner_uuid=?", sys, userID).Scan(&count)
+		if count == 0 {
+			http.Error(w, "Waypoints must be systems where you have a colony: "+sys, 400)
+			return
+		}
+	}
+
+	// Start "on station" at the last waypoint, so the first departure heads for waypoint 0
+	now := atomic.LoadInt64(&CurrentTick)
+	route := PatrolRoute{Waypoints: req.Waypoints, Next: len(req.Waypoints) - 1, Dwell: req.Dwell}
+	db.Exec("UPDATE fleets SET status=?, dest_system=origin_system, arrival_tick=? WHERE id=?", FleetPatrol, now-req.Dwell, req.FleetID)
+	f.ID = req.FleetID
+	if !departPatrol(f, route, now) {
+		http.Error(w, "Insufficient Fuel for the first leg", 402)
+		return
+	}
+	w.Write([]byte(fmt.Sprintf("Patrol Started: %d waypoints, %d ticks on station", len(req.Waypoints), req.Dwell)))
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// --- Peer Registry Persistence ---
+// The in-memory Peers map is the working set; the peers table is its memory across restarts.
+// Relation changes are written through immediately, reputation drift is flushed every few
+// heartbeat rounds. Rows outlive pruning, so a banned or allied node keeps its standing
+// (and its pinned key) when it handshakes again later.
+
+const PeerPersistEvery = 6 // heartbeat rounds between reputation flushes
+
+func savePeer(p *Peer) {
+	loc, _ := json.Marshal(p.Location)
+	features, _ := json.Marshal(p.Features)
+	recordRelationChange(p)
+	_, err := db.Exec(`INSERT INTO peers (uuid, url, public_key, genesis_hash, location_json, location_salt, features_json, relation, reputation, grudge, first_seen, last_seen)
+	                   VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	                   ON CONFLICT(uuid) DO UPDATE SET url=excluded.url, public_key=excluded.public_key, genesis_hash=excluded.genesis_hash,
+	                       location_json=excluded.location_json, location_salt=excluded.location_salt, features_json=excluded.features_json, relation=excluded.relation,
+	                       reputation=excluded.reputation, grudge=excluded.grudge, last_seen=excluded.last_seen`,
+		p.UUID, p.Url, hex.EncodeToString(p.PublicKey), p.GenesisHash, string(loc), p.LocationSalt, string(features),
+		p.Relation, p.Reputation, p.Grudge, p.FirstSeen.Unix(), p.LastSeen.Unix())
+	if err != nil {
+		ErrorLog.Printf("Failed to persist peer %s: %v", p.UUID, err)
+	}
+}
+
+func scanPeer(scan func(...interface{}) error) (*Peer, error) {
+	var p Peer
+	var key, loc, features string
+	var firstSeen, lastSeen int64
+	if err := scan(&p.UUID, &p.Url, &key, &p.GenesisHash, &loc, &p.LocationSalt, &features, &p.Relation, &p.Reputation, &p.Grudge, &firstSeen, &lastSeen); err != nil {
+		return nil, err
+	}
+	p.PublicKey, _ = hex.DecodeString(key)
+	json.Unmarshal([]byte(loc), &p.Location)
+	json.Unmarshal([]byte(features), &p.Features)
+	p.FirstSeen, p.LastSeen = time.Unix(firstSeen, 0), time.Unix(lastSeen, 0)
+	return &p, nil
+}
+
+const peerColumns = "uuid, url, public_key, genesis_hash, COALESCE(location_json, 'null'), COALESCE(location_salt, -1), COALESCE(features_json, 'null'), relation, reputation, COALESCE(grudge, 0), first_seen, last_seen"
+
+// Stored record for a node that may no longer be in the working set
+func storedPeer(uuid string) (*Peer, bool) {
+	p, err := scanPeer(db.QueryRow("SELECT "+peerColumns+" FROM peers WHERE uuid=?", uuid).Scan)
+	return p, err == nil
+}
+
+// Restores the registry at boot. Every peer gets a fresh prune window to reconnect in;
+// uptime tracking restarts since heartbeat counts aren't kept.
+func loadPeers() {
+	rows, err := db.Query("SELECT " + peerColumns + " FROM peers")
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	loaded := 0
+	peerLock.Lock()
+	defer peerLock.Unlock()
+	for rows.Next() {
+		p, err := scanPeer(rows.Scan)
+		if err != nil || p.UUID == ServerUUID || len(p.PublicKey) == 0 {
+			continue
+		}
+		p.LastSeen, p.FirstSeen = now, now
+		Peers[p.UUID] = p
+		loaded++
+	}
+	if loaded > 0 {
+		InfoLog.Printf("📇 Restored %d peers from the registry", loaded)
+	}
+}
+
+// Writes every live peer's reputation and last contact back to the table
+func persistPeers() {
+	peerLock.RLock()
+	snapshot := make([]Peer, 0, len(Peers))
+	for _, p := range Peers {
+		// Restored peers that haven't checked in yet keep their stored last contact
+		if p.HeartbeatCount > 0 {
+			snapshot = append(snapshot, *p)
+		}
+	}
+	peerLock.RUnlock()
+
+	for i := range snapshot {
+		savePeer(&snapshot[i])
+	}
+}
+
+// Screens a returning node's handshake: hostile nodes stay out, and a different key for a
+// known UUID is refused rather than silently re-pinned.
+func checkStoredPeer(uuid string, key ed25519.PublicKey) error {
+	stored, ok := storedPeer(uuid)
+	if !ok {
+		return nil
+	}
+	if len(stored.PublicKey) > 0 && !stored.PublicKey.Equal(key) {
+		return fmt.Errorf("key does not match registry")
+	}
+	if stored.Relation == 2 {
+		return fmt.Errorf("banned")
+	}
+	return nil
+}
+
+// Carries a returning node's alliance and reputation over to its new session
+func restoreStanding(p *Peer) {
+	if stored, ok := storedPeer(p.UUID); ok {
+		p.Relation, p.Reputation = stored.Relation, stored.Reputation
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// --- Perishables ---
+// Food, vegetation and wine spoil by a fraction each tick. Warehouses shelter a fixed amount of
+// every perishable from decay; cold storage slows what is left. Rates can be overridden with
+// OWNWORLD_DECAY, e.g. "food=0.002,wine=0".
+
+const (
+	WarehouseShelter     = 2000 // units per perishable, per warehouse
+	ColdStorageReduction = 0.2  // decay rate cut per cold_storage
+	MaxColdStorageCut    = 0.8
+)
+
+var DecayRates = map[string]float64{
+	"food":       0.002,
+	"vegetation": 0.003,
+	"wine":       0.0005, // wine keeps
+}
+
+// Applies OWNWORLD_DECAY overrides; unknown items and bad numbers are ignored
+func loadDecayRates() {
+	spec := os.Getenv("OWNWORLD_DECAY")
+	if spec == "" {
+		return
+	}
+	for _, kv := range strings.Split(spec, ",") {
+		parts := strings.SplitN(strings.TrimSpace(kv), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if _, known := DecayRates[parts[0]]; !known {
+			continue
+		}
+		if rate, err := strconv.ParseFloat(parts[1], 64); err == nil && rate >= 0 && rate <= 1 {
+			DecayRates[parts[0]] = rate
+		}
+	}
+}
+
+// Units lost this tick from a stock of the given size
+func spoilage(stock int, rate float64, warehouses, coldStorage int) int {
+	exposed := stock - warehouses*WarehouseShelter
+	if exposed <= 0 || rate <= 0 {
+		return 0
+	}
+	cut := ColdStorageReduction * float64(coldStorage)
+	if cut > MaxColdStorageCut {
+		cut = MaxColdStorageCut
+	}
+	return int(math.Round(float64(exposed) * rate * (1 - cut)))
+}
+
+func applyDecay(c *Colony) {
+	wh, cold := c.Buildings["warehouse"], c.Buildings["cold_storage"]
+	c.Food -= spoilage(c.Food, DecayRates["food"], wh, cold)
+	c.Vegetation -= spoilage(c.Vegetation, DecayRates["vegetation"], wh, cold)
+	c.Wine -= spoilage(c.Wine, DecayRates["wine"], wh, cold)
+}
@@ -0,0 +1,1235 @@
+// Package client is a typed Go client for an OwnWorld node's HTTP API.
+//
+// It covers authentication, colony/fleet state, construction, fleet movement,
+// the market and federation status. POSTs carry an Idempotency-Key that is
+// reused across retries, so a retried action is applied at most once.
+package client
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type Client struct {
+	BaseURL    string
+	HTTP       *http.Client
+	MaxRetries int
+	Backoff    time.Duration
+
+	// Session (set by Register/Login or manually)
+	UserUUID string
+	Token    string
+
+	// Signing session (set by UnlockKey)
+	SigningToken string
+}
+
+// APIError is returned for any non-2xx answer the server gave.
+type APIError struct {
+	Status  int
+	Message string
+	Code    string // from structured errors ({"error": {"code"}}), e.g. "wrong_password"
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("ownworld: %d %s", e.Status, e.Message)
+}
+
+func New(baseURL string) *Client {
+	if !strings.HasPrefix(baseURL, "http") {
+		baseURL = "http://" + baseURL
+	}
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTP:       &http.Client{Timeout: 10 * time.Second},
+		MaxRetries: 3,
+		Backoff:    500 * time.Millisecond,
+	}
+}
+
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Retryable: transport errors, 429 and 5xx. Everything else is final.
+func retryable(status int) bool {
+	return status == 429 || status >= 500
+}
+
+func (c *Client) do(method, path string, in interface{}, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	key := ""
+	if method == "POST" {
+		key = newIdempotencyKey()
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= c.MaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(c.Backoff * time.Duration(1<<(attempt-1)))
+		}
+
+		req, err := http.NewRequest(method, c.BaseURL+path, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		if c.UserUUID != "" {
+			req.Header.Set("X-User-UUID", c.UserUUID)
+			req.Header.Set("X-Session-Token", c.Token)
+		}
+		if c.SigningToken != "" {
+			req.Header.Set("X-Signing-Token", c.SigningToken)
+		}
+
+		resp, err := c.HTTP.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			apiErr := &APIError{Status: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+			var structured struct {
+				Error struct {
+					Code    string `json:"code"`
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			if json.Unmarshal(data, &structured) == nil && structured.Error.Code != "" {
+				apiErr.Code, apiErr.Message = structured.Error.Code, structured.Error.Message
+			}
+			lastErr = apiErr
+			if retryable(resp.StatusCode) {
+				continue
+			}
+			return lastErr
+		}
+
+		switch o := out.(type) {
+		case nil:
+		case *string:
+			*o = strings.TrimSpace(string(data))
+		default:
+			if err := json.Unmarshal(data, out); err != nil {
+				return fmt.Errorf("ownworld: bad response: %w", err)
+			}
+		}
+		return nil
+	}
+	return lastErr
+}
+
+// --- Auth ---
+
+type Session struct {
+	Status   string `json:"status"`
+	UserUUID string `json:"user_uuid"`
+	Token    string `json:"session_token"`
+	SystemID string `json:"system_id"`
+	Location []int  `json:"location"`
+	Message  string `json:"message"`
+
+	// Failed login attempts since the previous successful one
+	FailedLogins int `json:"failed_logins,omitempty"`
+
+	// Unix time the token lapses; renew before then with RefreshSession
+	ExpiresAt int64 `json:"expires_at"`
+}
+
+// Login logs into an existing account and stores the session on the client. Failures are
+// *APIError with Code "user_not_found", "wrong_password", "account_throttled" or "rate_limited".
+func (c *Client) Login(username, password string) (*Session, error) {
+	var s Session
+	err := c.do("POST", "/api/login", map[string]string{"username": username, "password": password}, &s)
+	if err != nil {
+		return nil, err
+	}
+	c.UserUUID, c.Token = s.UserUUID, s.Token
+	return &s, nil
+}
+
+// Register creates an account (or logs into an existing one) and stores the session on the client.
+func (c *Client) Register(username, password string) (*Session, error) {
+	return c.RegisterWith(username, password, "", "")
+}
+
+// RegisterWith is Register for nodes that want an invite code or a captcha token (empty = none).
+func (c *Client) RegisterWith(username, password, inviteCode, captcha string) (*Session, error) {
+	var s Session
+	body := map[string]string{"username": username, "password": password}
+	if inviteCode != "" {
+		body["invite_code"] = inviteCode
+	}
+	if captcha != "" {
+		body["captcha"] = captcha
+	}
+	err := c.do("POST", "/api/register", body, &s)
+	if err != nil {
+		return nil, err
+	}
+	c.UserUUID, c.Token = s.UserUUID, s.Token
+	return &s, nil
+}
+
+// RefreshSession swaps the live session token for a fresh one and stores it on the client.
+// It returns the new expiry (Unix seconds); the old token stops working.
+func (c *Client) RefreshSession() (int64, error) {
+	var out struct {
+		Token     string `json:"session_token"`
+		ExpiresAt int64  `json:"expires_at"`
+	}
+	if err := c.do("POST", "/api/session/refresh", nil, &out); err != nil {
+		return 0, err
+	}
+	c.Token = out.Token
+	return out.ExpiresAt, nil
+}
+
+type Passkey struct {
+	CredentialID string `json:"credential_id"`
+	Name         string `json:"name"`
+	Algorithm    int    `json:"algorithm"` // COSE: -7 ES256, -8 EdDSA, -257 RS256
+	CreatedAt    int64  `json:"created_at"`
+	LastUsed     int64  `json:"last_used"`
+}
+
+// Options to hand to the authenticator; binary fields are base64url
+type PasskeyChallenge struct {
+	Challenge   string   `json:"challenge"`
+	RPID        string   `json:"rp_id"`
+	UserID      string   `json:"user_id,omitempty"`
+	UserName    string   `json:"user_name,omitempty"`
+	Credentials []string `json:"credentials"`
+}
+
+// What navigator.credentials.create returned, base64url encoded
+type PasskeyAttestation struct {
+	CredentialID      string `json:"credential_id"`
+	ClientDataJSON    string `json:"client_data_json"`
+	AuthenticatorData string `json:"authenticator_data"`
+	PublicKey         string `json:"public_key"` // DER SubjectPublicKeyInfo
+	Algorithm         int    `json:"algorithm"`
+	Name              string `json:"name,omitempty"`
+}
+
+// What navigator.credentials.get returned, base64url encoded
+type PasskeyAssertion struct {
+	CredentialID      string `json:"credential_id"`
+	ClientDataJSON    string `json:"client_data_json"`
+	AuthenticatorData string `json:"authenticator_data"`
+	Signature         string `json:"signature"`
+	UserHandle        string `json:"user_handle,omitempty"`
+}
+
+func (c *Client) Passkeys() ([]Passkey, error) {
+	var keys []Passkey
+	return keys, c.do("GET", "/api/passkeys", nil, &keys)
+}
+
+func (c *Client) RemovePasskey(credentialID string) ([]Passkey, error) {
+	var keys []Passkey
+	return keys, c.do("POST", "/api/passkeys", map[string]interface{}{"credential_id": credentialID, "remove": true}, &keys)
+}
+
+func (c *Client) BeginPasskeyRegistration() (*PasskeyChallenge, error) {
+	var ch PasskeyChallenge
+	return &ch, c.do("POST", "/api/passkeys/register/begin", nil, &ch)
+}
+
+func (c *Client) FinishPasskeyRegistration(att PasskeyAttestation) ([]Passkey, error) {
+	var keys []Passkey
+	return keys, c.do("POST", "/api/passkeys/register/finish", att, &keys)
+}
+
+// An empty username asks for a challenge any discoverable passkey can answer
+func (c *Client) BeginPasskeyLogin(username string) (*PasskeyChallenge, error) {
+	var ch PasskeyChallenge
+	return &ch, c.do("POST", "/api/passkeys/login/begin", map[string]string{"username": username}, &ch)
+}
+
+// FinishPasskeyLogin logs in with an assertion and stores the session on the client.
+func (c *Client) FinishPasskeyLogin(a PasskeyAssertion) (*Session, error) {
+	var s Session
+	if err := c.do("POST", "/api/passkeys/login/finish", a, &s); err != nil {
+		return nil, err
+	}
+	c.UserUUID, c.Token = s.UserUUID, s.Token
+	return &s, nil
+}
+
+// --- Status & State ---
+
+type Status struct {
+	UUID     string `json:"uuid"`
+	Tick     int64  `json:"tick"`
+	Leader   string `json:"leader"`
+	Location []int  `json:"location"`
+	Genesis  string `json:"genesis"`
+
+	// Current tick length; nominally 60s, nudged by clock sync with peers
+	TickDurationMS int64 `json:"tick_duration_ms"`
+
+	// Versions the node serves; this client speaks v1 (the unversioned /api/ paths)
+	APIVersions []string `json:"api_versions"`
+
+	// Operator notice: message of the day, rules and contact (empty when unset)
+	MOTD    string `json:"motd"`
+	Rules   string `json:"rules"`
+	Contact string `json:"contact"`
+}
+
+func (c *Client) Status() (*Status, error) {
+	var s Status
+	return &s, c.do("GET", "/api/status", nil, &s)
+}
+
+// Operator-run live event (resource_rush, double_production or armada)
+type WorldEvent struct {
+	ID         int     `json:"id"` // 0 for events run by other nodes
+	Origin     string  `json:"origin_uuid"`
+	Kind       string  `json:"kind"`
+	Title      string  `json:"title"`
+	Multiplier float64 `json:"multiplier,omitempty"`
+	X          int     `json:"x,omitempty"`
+	Y          int     `json:"y,omitempty"`
+	Z          int     `json:"z,omitempty"`
+	Radius     int     `json:"radius,omitempty"`
+	SystemID   string  `json:"system_id,omitempty"`
+	Fleets     int     `json:"fleets,omitempty"`
+	StartTick  int64   `json:"start_tick"`
+	EndTick    int64   `json:"end_tick"`
+	Status     string  `json:"status"`
+}
+
+// Upcoming and running world events across the federation
+func (c *Client) Events() ([]WorldEvent, error) {
+	var out []WorldEvent
+	return out, c.do("GET", "/api/events", nil, &out)
+}
+
+type CouncilTally struct {
+	For        float64 `json:"for"`
+	Against    float64 `json:"against"`
+	Electorate float64 `json:"electorate"`
+	Ballots    int     `json:"ballots"`
+}
+
+// A federation-wide question put to the vote by the leader node
+type CouncilProposal struct {
+	ID           string        `json:"id"`
+	Proposer     string        `json:"proposer"`
+	Kind         string        `json:"kind"` // toll_cap, rule or ban_node
+	Title        string        `json:"title"`
+	Transit      int           `json:"transit,omitempty"`
+	TradePct     float64       `json:"trade_pct,omitempty"`
+	Feature      string        `json:"feature,omitempty"`
+	Enabled      bool          `json:"enabled,omitempty"`
+	Node         string        `json:"node,omitempty"`
+	CreatedTick  int64         `json:"created_tick"`
+	DeadlineTick int64         `json:"deadline_tick"`
+	Status       string        `json:"status"` // open, enacted, rejected or expired
+	Tally        *CouncilTally `json:"tally,omitempty"`
+}
+
+func (c *Client) Council() ([]CouncilProposal, error) {
+	var out []CouncilProposal
+	return out, c.do("GET", "/api/council", nil, &out)
+}
+
+// Public summary of an empire; needs no session
+type PlayerProfile struct {
+	UUID      string   `json:"uuid"`
+	Name      string   `json:"name"`
+	Node      string   `json:"node"`
+	FoundedAt int64    `json:"founded_at,omitempty"`
+	Score     int      `json:"score"`
+	Colonies  int      `json:"colonies"`
+	Systems   int      `json:"systems"`
+	Alliances []string `json:"alliances"`
+	War       struct {
+		Battles         int `json:"battles"`
+		FleetsDestroyed int `json:"fleets_destroyed"`
+		FleetsLost      int `json:"fleets_lost"`
+		Bombardments    int `json:"bombardments"`
+		TimesBombarded  int `json:"times_bombarded"`
+	} `json:"war"`
+}
+
+func (c *Client) Profile(uuid string) (*PlayerProfile, error) {
+	var p PlayerProfile
+	return &p, c.do("GET", "/public/player/"+url.PathEscape(uuid), nil, &p)
+}
+
+type Colony struct {
+	ID               int            `json:"id"`
+	SystemID         string         `json:"system_id"`
+	OwnerUUID        string         `json:"owner_uuid"`
+	Name             string         `json:"name"`
+	SiteType         string         `json:"site_type,omitempty"` // planet, asteroid_belt or moon
+	ParentID         int            `json:"parent_id"`
+	Buildings        map[string]int `json:"buildings"`
+	PopLaborers      int            `json:"pop_laborers"`
+	PopSpecialists   int            `json:"pop_specialists"`
+	PopElites        int            `json:"pop_elites"`
+	Food             int            `json:"food"`
+	Water            int            `json:"water"`
+	Iron             int            `json:"iron"`
+	Carbon           int            `json:"carbon"`
+	Gold             int            `json:"gold"`
+	Steel            int            `json:"steel"`
+	Wine             int            `json:"wine"`
+	StabilityCurrent float64        `json:"stability_current"`
+	StabilityTarget  float64        `json:"stability_target"`
+	ModuleStock      map[string]int `json:"module_stock"`
+}
+
+type FleetPayload struct {
+	PopLaborers    int            `json:"laborers"`
+	PopSpecialists int            `json:"specialists"`
+	Resources      map[string]int `json:"resources"`
+	CultureBonus   float64        `json:"culture"`
+	Credits        int            `json:"credits"`
+}
+
+type Fleet struct {
+	ID             int          `json:"id"`
+	Status         string       `json:"status"`
+	OriginSystem   string       `json:"origin_system"`
+	DestSystem     string       `json:"dest_system"`
+	ArrivalTick    int64        `json:"arrival_tick"`
+	Fuel           int          `json:"fuel"`
+	HullClass      string       `json:"hull_class"`
+	Modules        []string     `json:"modules"`
+	Condition      []float64    `json:"module_condition,omitempty"` // per module; absent means intact
+	Payload        FleetPayload `json:"payload"`
+	TargetOrderID  string       `json:"target_order_id"`
+	HomeSystem     string       `json:"home_system"`
+	AutoReturn     bool         `json:"auto_return"`
+	Experience     int          `json:"experience"`
+	Veterancy      int          `json:"veterancy"`
+	BombardTarget  string       `json:"bombard_target"`
+	BuildRemaining int          `json:"build_remaining,omitempty"`
+}
+
+type State struct {
+	Colonies []Colony `json:"colonies"`
+	Fleets   []Fleet  `json:"fleets"`
+	Credits  int      `json:"credits"`
+}
+
+func (c *Client) State() (*State, error) {
+	var s State
+	return &s, c.do("GET", "/api/state", nil, &s)
+}
+
+type FleetRoute struct {
+	Origin        string  `json:"origin"`
+	OriginName    string  `json:"origin_name,omitempty"`
+	Destination   string  `json:"destination,omitempty"`
+	DestName      string  `json:"destination_name,omitempty"`
+	DepartureTick int64   `json:"departure_tick,omitempty"`
+	ArrivalTick   int64   `json:"arrival_tick,omitempty"`
+	ETATicks      int64   `json:"eta_ticks"`
+	ETASeconds    int64   `json:"eta_seconds"`
+	Progress      float64 `json:"progress"`
+}
+
+type ModuleCondition struct {
+	Module    string  `json:"module"`
+	Slot      string  `json:"slot"`
+	Condition float64 `json:"condition"`
+}
+
+type FleetManifest struct {
+	ID            int               `json:"id"`
+	Status        string            `json:"status"`
+	HullClass     string            `json:"hull_class"`
+	Integrity     int               `json:"integrity"`
+	Payload       FleetPayload      `json:"payload"`
+	Route         FleetRoute        `json:"route"`
+	Fuel          int               `json:"fuel"`
+	FuelBurned    int               `json:"fuel_burned"`
+	Modules       []ModuleCondition `json:"modules"`
+	RepairCost    int               `json:"repair_cost"` // steel to restore every module
+	Experience    int               `json:"experience"`
+	Veterancy     int               `json:"veterancy"`
+	TargetOrderID string            `json:"target_order_id,omitempty"`
+	HomeSystem    string            `json:"home_system,omitempty"`
+}
+
+// Full manifest, route and ETA of one of the caller's fleets
+func (c *Client) Fleet(fleetID int) (*FleetManifest, error) {
+	var m FleetManifest
+	return &m, c.do("GET", fmt.Sprintf("/api/fleet/%d", fleetID), nil, &m)
+}
+
+// --- Economy ---
+
+func (c *Client) Build(colonyID int, structure string, amount int) (string, error) {
+	var msg string
+	err := c.do("POST", "/api/build", map[string]interface{}{
+		"colony_id": colonyID, "structure": structure, "amount": amount,
+	}, &msg)
+	return msg, err
+}
+
+func (c *Client) Burn(colonyID int, item string, amount int) (string, error) {
+	var msg string
+	err := c.do("POST", "/api/bank/burn", map[string]interface{}{
+		"colony_id": colonyID, "item": item, "amount": amount,
+	}, &msg)
+	return msg, err
+}
+
+type ColonyCorruption struct {
+	ColonyID   int     `json:"colony_id"`
+	Name       string  `json:"name"`
+	Distance   float64 `json:"distance"`
+	Corruption float64 `json:"corruption"` // share of output lost, 0-0.6
+}
+
+type CapitalReport struct {
+	CapitalColonyID int                `json:"capital_colony_id"`
+	Colonies        []ColonyCorruption `json:"colonies"`
+}
+
+func (c *Client) Capital() (*CapitalReport, error) {
+	var out CapitalReport
+	return &out, c.do("GET", "/api/colony/capital", nil, &out)
+}
+
+// Moves the capital; the server allows this once per 500 ticks
+func (c *Client) SetCapital(colonyID int) (*CapitalReport, error) {
+	var out CapitalReport
+	return &out, c.do("POST", "/api/colony/capital", map[string]int{"colony_id": colonyID}, &out)
+}
+
+// Percent of a colony's laborers in each sector; the rest are idle
+type Workforce struct {
+	Mining       int `json:"mining"`
+	Farming      int `json:"farming"`
+	Construction int `json:"construction"`
+}
+
+type WorkforceReport struct {
+	ColonyID    int                `json:"colony_id"`
+	Laborers    int                `json:"laborers"`
+	Specialists int                `json:"specialists"`
+	Elites      int                `json:"elites"`
+	Allocation  *Workforce         `json:"allocation"` // nil: every building staffed
+	Wanted      map[string]int     `json:"wanted"`
+	Assigned    map[string]int     `json:"assigned"`
+	Staffing    map[string]float64 `json:"staffing"` // output multiplier per sector
+	Idle        int                `json:"idle"`
+}
+
+func (c *Client) Workforce(colonyID int) (*WorkforceReport, error) {
+	var out WorkforceReport
+	return &out, c.do("GET", fmt.Sprintf("/api/colony/workforce?colony_id=%d", colonyID), nil, &out)
+}
+
+func (c *Client) SetWorkforce(colonyID int, wf Workforce) (*WorkforceReport, error) {
+	var out WorkforceReport
+	return &out, c.do("POST", "/api/colony/workforce", map[string]int{
+		"colony_id": colonyID, "mining": wf.Mining, "farming": wf.Farming, "construction": wf.Construction,
+	}, &out)
+}
+
+// Back to every building staffed and nobody idle
+func (c *Client) ResetWorkforce(colonyID int) (*WorkforceReport, error) {
+	var out WorkforceReport
+	return &out, c.do("POST", "/api/colony/workforce", map[string]interface{}{"colony_id": colonyID, "reset": true}, &out)
+}
+
+// --- Fleets ---
+
+// Queues modules at a colony's module factory; Construct and Refit draw from the finished stock
+func (c *Client) QueueModules(colonyID int, module string, amount int) (string, error) {
+	var msg string
+	err := c.do("POST", "/api/colony/modules", map[string]interface{}{
+		"colony_id": colonyID, "module": module, "amount": amount,
+	}, &msg)
+	return msg, err
+}
+
+type Unlock struct {
+	Tier     int    `json:"tier"`
+	Building string `json:"building,omitempty"` // needed in the building colony, at Level
+	Level    int    `json:"level,omitempty"`
+	Tech     string `json:"tech,omitempty"` // researched by the colony's owner
+}
+
+type Hull struct {
+	Class        string
+	EngineSlots  int
+	WeaponSlots  int
+	SpecialSlots int
+}
+
+type CatalogEntry struct {
+	Name     string         `json:"name"`
+	Unlock   Unlock         `json:"unlock"`
+	Unlocked *bool          `json:"unlocked,omitempty"` // only when asked about a colony
+	Hull     *Hull          `json:"hull,omitempty"`
+	Tons     int            `json:"tons"`
+	Recipe   map[string]int `json:"recipe,omitempty"`
+}
+
+type Catalog struct {
+	Hulls   []CatalogEntry `json:"hulls"`
+	Modules []CatalogEntry `json:"modules"`
+}
+
+// Hulls and modules with their unlock requirements; a non-zero colonyID also marks what that colony has unlocked
+func (c *Client) Catalog(colonyID int) (*Catalog, error) {
+	path := "/api/catalog"
+	if colonyID != 0 {
+		path += fmt.Sprintf("?colony_id=%d", colonyID)
+	}
+	var out Catalog
+	return &out, c.do("GET", path, nil, &out)
+}
+
+type Technology struct {
+	ID             string   `json:"id"`
+	Name           string   `json:"name"`
+	Cost           int      `json:"cost"`
+	Requires       []string `json:"requires,omitempty"`
+	Unlocks        []string `json:"unlocks"`
+	Researched     bool     `json:"researched"`
+	ResearchedTick int64    `json:"researched_tick,omitempty"`
+	Available      bool     `json:"available"`
+}
+
+type ResearchState struct {
+	Points       int          `json:"points"`
+	PerTick      int          `json:"per_tick"` // from staffed rd_labs
+	Technologies []Technology `json:"technologies"`
+}
+
+func (c *Client) Research() (*ResearchState, error) {
+	var out ResearchState
+	return &out, c.do("GET", "/api/research", nil, &out)
+}
+
+// Spends research points on a technology whose prerequisites are researched
+func (c *Client) ResearchTech(tech string) (*ResearchState, error) {
+	var out ResearchState
+	return &out, c.do("POST", "/api/research", map[string]string{"tech": tech}, &out)
+}
+
+func (c *Client) Construct(colonyID int, hullClass string, modules []string, payload *FleetPayload) (string, error) {
+	req := map[string]interface{}{"colony_id": colonyID, "hull_class": hullClass, "modules": modules}
+	if payload != nil {
+		req["payload"] = payload
+	}
+	var msg string
+	err := c.do("POST", "/api/construct", req, &msg)
+	return msg, err
+}
+
+func (c *Client) Launch(fleetID int, targetSystem, targetOrderID string) (string, error) {
+	var msg string
+	err := c.do("POST", "/api/fleet/launch", map[string]interface{}{
+		"fleet_id": fleetID, "target_system": targetSystem, "target_order_id": targetOrderID,
+	}, &msg)
+	return msg, err
+}
+
+type RouteEstimate struct {
+	Origin         string  `json:"origin"`
+	Target         string  `json:"target"`
+	HullClass      string  `json:"hull_class"`
+	Mass           int     `json:"mass"`
+	BurnFactor     float64 `json:"burn_factor"` // hull efficiency x engine thirst
+	FuelCost       int     `json:"fuel_cost"`
+	TravelTicks    int64   `json:"travel_ticks"`
+	UnpoweredFuel  int     `json:"unpowered_fuel"` // the same ship with its engines stripped
+	UnpoweredTicks int64   `json:"unpowered_ticks"`
+	FuelOnBoard    int     `json:"fuel_on_board,omitempty"`
+	Affordable     *bool   `json:"affordable,omitempty"` // set for fleets only
+}
+
+// Prices a trip for one of your fleets
+func (c *Client) EstimateRoute(fleetID int, targetSystem string) (*RouteEstimate, error) {
+	var out RouteEstimate
+	return &out, c.do("POST", "/api/fleet/estimate", map[string]interface{}{"fleet_id": fleetID, "target_system": targetSystem}, &out)
+}
+
+// Prices a trip for a ship design that hasn't been built
+func (c *Client) EstimateDesign(hullClass string, modules []string, originSystem, targetSystem string) (*RouteEstimate, error) {
+	var out RouteEstimate
+	return &out, c.do("POST", "/api/fleet/estimate", map[string]interface{}{
+		"hull_class": hullClass, "modules": modules, "origin_system": originSystem, "target_system": targetSystem,
+	}, &out)
+}
+
+// Launches a fleet to a beacon by name instead of a system id
+// Turns a fleet in transit back to the system it left, before the point of no return
+func (c *Client) Recall(fleetID int) (string, error) {
+	var msg string
+	err := c.do("POST", "/api/fleet/recall", map[string]interface{}{"fleet_id": fleetID}, &msg)
+	return msg, err
+}
+
+func (c *Client) LaunchToBeacon(fleetID int, beacon string) (string, error) {
+	var msg string
+	err := c.do("POST", "/api/fleet/launch", map[string]interface{}{"fleet_id": fleetID, "beacon": beacon}, &msg)
+	return msg, err
+}
+
+func (c *Client) Refit(fleetID int, modules []string) (string, error) {
+	var msg string
+	err := c.do("POST", "/api/fleet/refit", map[string]interface{}{"fleet_id": fleetID, "modules": modules}, &msg)
+	return msg, err
+}
+
+// Restores a worn fleet's modules at a colony with a shipyard in its system, for steel
+func (c *Client) Repair(fleetID int) (string, error) {
+	var msg string
+	err := c.do("POST", "/api/fleet/repair", map[string]int{"fleet_id": fleetID}, &msg)
+	return msg, err
+}
+
+// Sends an orbiting fleet round the given systems, dwell ticks at each; no waypoints ends the patrol
+func (c *Client) Patrol(fleetID int, waypoints []string, dwell int) (string, error) {
+	var msg string
+	err := c.do("POST", "/api/fleet/patrol", map[string]interface{}{"fleet_id": fleetID, "waypoints": waypoints, "dwell": dwell}, &msg)
+	return msg, err
+}
+
+type PatrolSighting struct {
+	FleetID       int    `json:"fleet_id"`
+	SystemID      string `json:"system_id"`
+	Tick          int64  `json:"tick"`
+	HostileOwner  string `json:"hostile_owner"`
+	HostileFleets int    `json:"hostile_fleets"`
+}
+
+// Foreign fleets your patrols have seen, newest first
+func (c *Client) PatrolIntel() ([]PatrolSighting, error) {
+	var out []PatrolSighting
+	return out, c.do("GET", "/api/fleet/patrol", nil, &out)
+}
+
+// Target is "industry", "defenses" or "housing"
+func (c *Client) SetBombardTarget(fleetID int, target string) error {
+	return c.do("POST", "/api/fleet/bombard", map[string]interface{}{"fleet_id": fleetID, "target": target}, nil)
+}
+
+func (c *Client) Deploy(fleetID int, name string) (string, error) {
+	var msg string
+	err := c.do("POST", "/api/deploy", map[string]interface{}{"fleet_id": fleetID, "name": name}, &msg)
+	return msg, err
+}
+
+// Founds an outpost (site "asteroid_belt" or "moon") in a system whose planet you hold
+func (c *Client) DeployOutpost(fleetID int, name, site string) (string, error) {
+	var msg string
+	err := c.do("POST", "/api/deploy", map[string]interface{}{"fleet_id": fleetID, "name": name, "site_type": site}, &msg)
+	return msg, err
+}
+
+// Transfer moves cargo: positive amounts load onto the fleet, negative amounts unload.
+func (c *Client) Transfer(fleetID, colonyID int, transfers map[string]int) (string, error) {
+	var msg string
+	err := c.do("POST", "/api/fleet/transfer", map[string]interface{}{
+		"fleet_id": fleetID, "colony_id": colonyID, "transfers": transfers,
+	}, &msg)
+	return msg, err
+}
+
+type SectorPotential struct {
+	Result     string             `json:"result,omitempty"`
+	Message    string             `json:"message,omitempty"`
+	HasSystem  bool               `json:"has_system"`
+	SystemType string             `json:"system_type"`
+	Name       string             `json:"name,omitempty"`
+	Resources  map[string]float64 `json:"resources"`
+	Hazards    float64            `json:"hazards"`
+	Survey     string             `json:"survey"`          // "basic" (resources to the nearest 0.5) or "detailed"
+	Proof      *ScanProof         `json:"proof,omitempty"` // set when a node holds the system
+}
+
+// The owning node's signed claim about a system's colonies in its latest daily snapshot.
+// StateHash is BLAKE3 over the JSON of those colonies as they appear in the snapshot blob.
+type ScanProof struct {
+	SystemID     string `json:"system_id"`
+	NodeUUID     string `json:"node_uuid"`
+	SnapshotDay  int    `json:"snapshot_day"`
+	SnapshotHash string `json:"snapshot_hash"`
+	ColonyIDs    []int  `json:"colony_ids"`
+	StateHash    string `json:"state_hash"`
+	Signature    string `json:"signature"`
+}
+
+// Checks the proof was signed by the node holding publicKey
+func (p *ScanProof) Verify(publicKey ed25519.PublicKey) bool {
+	sig, err := hex.DecodeString(p.Signature)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return false
+	}
+	ids := make([]string, len(p.ColonyIDs))
+	for i, id := range p.ColonyIDs {
+		ids[i] = fmt.Sprint(id)
+	}
+	msg := fmt.Sprintf("ownworld-scan:%s:%s:%d:%s:%s:%s",
+		p.SystemID, p.NodeUUID, p.SnapshotDay, p.SnapshotHash, strings.Join(ids, ","), p.StateHash)
+	return ed25519.Verify(publicKey, []byte(msg), sig)
+}
+
+func (c *Client) Scan(x, y, z int) (*SectorPotential, error) {
+	var s SectorPotential
+	return &s, c.do("POST", "/api/scan", map[string]int{"x": x, "y": y, "z": z}, &s)
+}
+
+type SurveyReport struct {
+	SystemID     string                     `json:"system_id"`
+	Tick         int64                      `json:"tick"`
+	Sector       SectorPotential            `json:"sector"`
+	Efficiencies map[int]map[string]float64 `json:"efficiencies"` // colony id -> resource -> multiplier
+	FuelLeft     int                        `json:"fuel_left"`
+}
+
+// Detailed survey of the system an orbiting fleet with a probe_scanner is in (costs fuel and credits)
+func (c *Client) Survey(fleetID int) (*SurveyReport, error) {
+	var s SurveyReport
+	return &s, c.do("POST", "/api/fleet/survey", map[string]int{"fleet_id": fleetID}, &s)
+}
+
+// What a destroyed fleet left behind; salvageable until ExpiresTick
+type Wreck struct {
+	ID          int            `json:"id"`
+	SystemID    string         `json:"system_id"`
+	HullClass   string         `json:"hull_class"`
+	OwnerUUID   string         `json:"owner_uuid"`
+	Resources   map[string]int `json:"resources"`
+	CreatedTick int64          `json:"created_tick"`
+	ExpiresTick int64          `json:"expires_tick"`
+}
+
+type SalvageResult struct {
+	Salvaged map[string]int `json:"salvaged"`
+	Wreck    Wreck          `json:"wreck"` // what is left
+	FuelLeft int            `json:"fuel_left"`
+}
+
+// Wrecks in systems where you have a fleet or colony
+func (c *Client) Wrecks() ([]Wreck, error) {
+	var wrecks []Wreck
+	return wrecks, c.do("GET", "/api/wrecks", nil, &wrecks)
+}
+
+func (c *Client) Salvage(fleetID, wreckID int) (*SalvageResult, error) {
+	var res SalvageResult
+	return &res, c.do("POST", "/api/fleet/salvage", map[string]int{"fleet_id": fleetID, "wreck_id": wreckID}, &res)
+}
+
+type RegionSystem struct {
+	X          int      `json:"x"`
+	Y          int      `json:"y"`
+	Z          int      `json:"z"`
+	Distance   float64  `json:"distance"`
+	SystemID   string   `json:"system_id,omitempty"`
+	Name       string   `json:"name,omitempty"`
+	SystemType string   `json:"system_type"`
+	OwnerUUID  string   `json:"owner_uuid,omitempty"`
+	Hazards    float64  `json:"hazards"`
+	Charted    bool     `json:"charted"`
+	Beacons    []string `json:"beacons,omitempty"`
+}
+
+// Systems within radius (max 10) of a point that the caller's sensors cover, plus the
+// caller's visible beacons in that radius
+func (c *Client) ScanRegion(x, y, z, radius int) ([]RegionSystem, error) {
+	var systems []RegionSystem
+	return systems, c.do("POST", "/api/scan/region", map[string]int{"x": x, "y": y, "z": z, "radius": radius}, &systems)
+}
+
+type Beacon struct {
+	ID        int    `json:"id,omitempty"`
+	Name      string `json:"name"`
+	X         int    `json:"x"`
+	Y         int    `json:"y"`
+	Z         int    `json:"z"`
+	Shared    bool   `json:"shared"`
+	OwnerUUID string `json:"owner_uuid"`
+	Node      string `json:"node,omitempty"` // set on beacons an allied node shares
+}
+
+// Your beacons, those shared on the node, then allies'
+func (c *Client) Beacons() ([]Beacon, error) {
+	var out []Beacon
+	return out, c.do("GET", "/api/beacons", nil, &out)
+}
+
+// Places or moves one of your beacons; shared ones are visible to the node and its allies
+func (c *Client) PlaceBeacon(name string, x, y, z int, shared bool) ([]Beacon, error) {
+	var out []Beacon
+	return out, c.do("POST", "/api/beacons", map[string]interface{}{
+		"name": name, "x": x, "y": y, "z": z, "shared": shared,
+	}, &out)
+}
+
+func (c *Client) RemoveBeacon(name string) ([]Beacon, error) {
+	var out []Beacon
+	return out, c.do("POST", "/api/beacons", map[string]interface{}{"name": name, "remove": true}, &out)
+}
+
+// Names a system the caller discovered; each system can be named once
+func (c *Client) NameSystem(systemID, name string) (string, error) {
+	var msg string
+	err := c.do("POST", "/api/systems/name", map[string]string{"system_id": systemID, "name": name}, &msg)
+	return msg, err
+}
+
+// --- Market ---
+
+type Order struct {
+	ID           string `json:"id,omitempty"`
+	SellerUUID   string `json:"seller_uuid,omitempty"`
+	Item         string `json:"item"`
+	Quantity     int    `json:"quantity"`
+	Price        int    `json:"price"`
+	IsBuy        bool   `json:"is_buy"`
+	OriginSystem string `json:"origin_system"`
+	ExpiresTick  int64  `json:"expires_tick,omitempty"`
+}
+
+func (c *Client) PlaceOrder(o Order) (string, error) {
+	var msg string
+	err := c.do("POST", "/api/market/place", o, &msg)
+	return msg, err
+}
+
+type BulkOrderResult struct {
+	OrderIDs []string `json:"order_ids"`
+	Fee      int      `json:"fee"`
+}
+
+// Lists up to 100 orders at once; if any order is rejected none are placed
+func (c *Client) PlaceOrders(orders []Order) (*BulkOrderResult, error) {
+	var out BulkOrderResult
+	return &out, c.do("POST", "/api/market/bulk", map[string]interface{}{"orders": orders}, &out)
+}
+
+func (c *Client) ListOrders() ([]Order, error) {
+	var orders []Order
+	return orders, c.do("GET", "/api/market/list", nil, &orders)
+}
+
+// The caller's own orders, newest expiry first
+func (c *Client) MyOrders() ([]Order, error) {
+	var orders []Order
+	return orders, c.do("GET", "/api/market/mine", nil, &orders)
+}
+
+func (c *Client) CancelOrder(orderID string) (string, error) {
+	var msg string
+	err := c.do("POST", "/api/market/cancel", map[string]string{"order_id": orderID}, &msg)
+	return msg, err
+}
+
+type Embargo struct {
+	ID         int    `json:"id"`
+	OwnerUUID  string `json:"owner_uuid"`
+	OwnerName  string `json:"owner_name,omitempty"`
+	ColonyID   int    `json:"colony_id"` // 0 = all of the owner's colonies
+	TargetUUID string `json:"target_uuid"`
+	Reason     string `json:"reason,omitempty"`
+	Tick       int64  `json:"tick"`
+}
+
+type Embargoes struct {
+	Placed     []Embargo `json:"placed"`
+	AgainstYou []Embargo `json:"against_you"`
+}
+
+func (c *Client) Embargoes() (*Embargoes, error) {
+	var out Embargoes
+	return &out, c.do("GET", "/api/embargoes", nil, &out)
+}
+
+// Embargoes a user or node from one colony, or from all of them with colonyID 0
+func (c *Client) Embargo(target string, colonyID int, reason string) (*Embargoes, error) {
+	var out Embargoes
+	return &out, c.do("POST", "/api/embargoes", map[string]interface{}{"target_uuid": target, "colony_id": colonyID, "reason": reason}, &out)
+}
+
+func (c *Client) LiftEmbargo(target string, colonyID int) (*Embargoes, error) {
+	var out Embargoes
+	return &out, c.do("POST", "/api/embargoes", map[string]interface{}{"target_uuid": target, "colony_id": colonyID, "lift": true}, &out)
+}
+
+// --- Federation ---
+
+type Peer struct {
+	UUID        string
+	Url         string
+	GenesisHash string
+	PeerCount   int
+	LastTick    int64
+	LastSeen    time.Time
+	Reputation  float64
+	Relation    int
+	Location    []int
+	Tolls       Tolls
+	Grudge      float64
+	CleanStreak int
+}
+
+// Charged by a node on fleets visiting its systems without a colony there
+type Tolls struct {
+	Transit  int     `json:"transit"`
+	TradePct float64 `json:"trade_pct"`
+}
+
+func (c *Client) Peers() ([]Peer, error) {
+	var peers []Peer
+	return peers, c.do("GET", "/api/federation/peers", nil, &peers)
+}
+
+type ReputationPoint struct {
+	At         int64   `json:"at"`
+	Reputation float64 `json:"reputation"`
+	Grudge     float64 `json:"grudge"`
+	Reason     string  `json:"reason"`
+}
+
+type PeerReputation struct {
+	UUID        string            `json:"uuid"`
+	Relation    int               `json:"relation"`
+	Reputation  float64           `json:"reputation"`
+	Grudge      float64           `json:"grudge"`
+	CleanStreak int               `json:"clean_streak"`
+	History     []ReputationPoint `json:"history"` // newest first
+}
+
+func (c *Client) PeerReputation(uuid string) (*PeerReputation, error) {
+	var out PeerReputation
+	return &out, c.do("GET", "/api/federation/reputation?uuid="+url.QueryEscape(uuid), nil, &out)
+}
+
+// --- Webhooks ---
+
+type Webhook struct {
+	ID     int      `json:"id,omitempty"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret,omitempty"`
+}
+
+// Registers a hook; the returned Secret is only shown once
+func (c *Client) AddWebhook(url string, events ...string) (*Webhook, error) {
+	var hook Webhook
+	return &hook, c.do("POST", "/api/webhooks", Webhook{URL: url, Events: events}, &hook)
+}
+
+func (c *Client) Webhooks() ([]Webhook, error) {
+	var hooks []Webhook
+	return hooks, c.do("GET", "/api/webhooks", nil, &hooks)
+}
+
+func (c *Client) DeleteWebhook(id int) error {
+	return c.do("POST", "/api/webhooks/delete", map[string]int{"id": id}, nil)
+}
+
+// --- Preferences ---
+
+// A client setting shared by every client the player signs in with
+type Preference struct {
+	Namespace string          `json:"namespace"`
+	Value     json.RawMessage `json:"value"`
+	Version   int64           `json:"version"`
+	UpdatedAt int64           `json:"updated_at"`
+}
+
+type PreferenceList struct {
+	Preferences   []Preference `json:"preferences"`
+	UsedBytes     int          `json:"used_bytes"`
+	QuotaBytes    int          `json:"quota_bytes"`
+	MaxValueBytes int          `json:"max_value_bytes"`
+	MaxNamespaces int          `json:"max_namespaces"`
+}
+
+func (c *Client) Preferences() (*PreferenceList, error) {
+	var out PreferenceList
+	return &out, c.do("GET", "/api/preferences", nil, &out)
+}
+
+func (c *Client) Preference(namespace string) (*Preference, error) {
+	var out Preference
+	return &out, c.do("GET", "/api/preferences?namespace="+url.QueryEscape(namespace), nil, &out)
+}
+
+// Stores value (marshalled to JSON) under namespace, whatever another client wrote meanwhile
+func (c *Client) SetPreference(namespace string, value interface{}) (*Preference, error) {
+	var out Preference
+	return &out, c.do("POST", "/api/preferences", map[string]interface{}{"namespace": namespace, "value": value}, &out)
+}
+
+// Stores value only if the namespace is still at version (0 for one not yet written). If another
+// client wrote first the error is an *APIError with Status 409; fetch the newer value and merge.
+func (c *Client) UpdatePreference(namespace string, value interface{}, version int64) (*Preference, error) {
+	var out Preference
+	return &out, c.do("POST", "/api/preferences", map[string]interface{}{"namespace": namespace, "value": value, "version": version}, &out)
+}
+
+func (c *Client) RemovePreference(namespace string) (*PreferenceList, error) {
+	var out PreferenceList
+	return &out, c.do("POST", "/api/preferences", map[string]interface{}{"namespace": namespace, "remove": true}, &out)
+}
+
+// --- Signing ---
+
+type SignedAction struct {
+	Signature string `json:"signature"`
+	PublicKey string `json:"public_key"`
+}
+
+// Unlocks the account key server-side for ttlSeconds; later Sign calls use the session
+func (c *Client) UnlockKey(password string, ttlSeconds int) error {
+	var out struct {
+		Token string `json:"signing_token"`
+	}
+	if err := c.do("POST", "/api/keys/unlock", map[string]interface{}{"password": password, "ttl_seconds": ttlSeconds}, &out); err != nil {
+		return err
+	}
+	c.SigningToken = out.Token
+	return nil
+}
+
+func (c *Client) LockKey() error {
+	c.SigningToken = ""
+	return c.do("POST", "/api/keys/lock", nil, nil)
+}
+
+func (c *Client) Sign(payload string) (*SignedAction, error) {
+	var out SignedAction
+	return &out, c.do("POST", "/api/keys/sign", map[string]string{"payload": payload}, &out)
+}
+
+// Signs payload with a one-off password (no signing session needed)
+func (c *Client) SignWithPassword(payload, password string) (*SignedAction, error) {
+	var out SignedAction
+	return &out, c.do("POST", "/api/keys/sign", map[string]string{"payload": payload, "password": password}, &out)
+}
+
+// --- Contracts ---
+
+type Contract struct {
+	ID           string         `json:"id"`
+	IssuerUUID   string         `json:"issuer_uuid"`
+	Contractor   string         `json:"contractor_uuid,omitempty"`
+	DestSystem   string         `json:"dest_system"`
+	Items        map[string]int `json:"items"`
+	Delivered    map[string]int `json:"delivered"`
+	Reward       int            `json:"reward"`
+	Collateral   int            `json:"collateral"`
+	Status       string         `json:"status"`
+	CreatedTick  int64          `json:"created_tick"`
+	DeadlineTick int64          `json:"deadline_tick"`
+}
+
+// Posts a delivery contract; the reward is escrowed immediately
+func (c *Client) CreateContract(destSystem string, items map[string]int, reward, collateral, ticks int) (*Contract, error) {
+	var out Contract
+	return &out, c.do("POST", "/api/contracts", map[string]interface{}{
+		"dest_system": destSystem, "items": items, "reward": reward, "collateral": collateral, "ticks": ticks,
+	}, &out)
+}
+
+func (c *Client) Contracts() ([]Contract, error) {
+	var list []Contract
+	return list, c.do("GET", "/api/contracts", nil, &list)
+}
+
+func (c *Client) AcceptContract(id string) error {
+	return c.do("POST", "/api/contracts/accept", map[string]string{"id": id}, nil)
+}
+
+func (c *Client) DeliverContract(id string, fleetID int) (string, error) {
+	var msg string
+	err := c.do("POST", "/api/contracts/deliver", map[string]interface{}{"id": id, "fleet_id": fleetID}, &msg)
+	return msg, err
+}
+
+func (c *Client) CancelContract(id string) error {
+	return c.do("POST", "/api/contracts/cancel", map[string]string{"id": id}, nil)
+}
+
+// Refinery lines offered as a service; see the server's conversion.go
+type ConversionContract struct {
+	ID           string `json:"id"`
+	RefinerUUID  string `json:"refiner_uuid"`
+	Customer     string `json:"customer_uuid,omitempty"`
+	ColonyID     int    `json:"colony_id"`
+	SystemID     string `json:"system_id"`
+	Building     string `json:"building"`
+	Input        string `json:"input"`
+	Output       string `json:"output"`
+	Lines        int    `json:"lines"`
+	Fee          int    `json:"fee"`
+	Hopper       int    `json:"hopper"`
+	Refined      int    `json:"refined"`
+	Status       string `json:"status"`
+	CreatedTick  int64  `json:"created_tick"`
+	DeadlineTick int64  `json:"deadline_tick"`
+}
+
+type ConversionDelivery struct {
+	Contract  ConversionContract `json:"contract"`
+	Delivered int                `json:"delivered"`
+	Fee       int                `json:"fee"`
+	ETATicks  int                `json:"eta_ticks"`
+}
+
+// Offers lines of a refinery building at one of your colonies for fee credits per unit of ore
+func (c *Client) OfferConversion(colonyID int, building string, lines, fee, ticks int) (*ConversionContract, error) {
+	var out ConversionContract
+	return &out, c.do("POST", "/api/contracts/conversion", map[string]interface{}{
+		"colony_id": colonyID, "building": building, "lines": lines, "fee": fee, "ticks": ticks,
+	}, &out)
+}
+
+func (c *Client) Conversions() ([]ConversionContract, error) {
+	var list []ConversionContract
+	return list, c.do("GET", "/api/contracts/conversion", nil, &list)
+}
+
+// Unloads ore from a fleet in orbit into the contract's hopper; quantity 0 unloads all of it
+func (c *Client) DeliverConversion(id string, fleetID, quantity int) (*ConversionDelivery, error) {
+	var out ConversionDelivery
+	return &out, c.do("POST", "/api/contracts/conversion/deliver", map[string]interface{}{
+		"id": id, "fleet_id": fleetID, "quantity": quantity,
+	}, &out)
+}
+
+// Loads refined goods onto a fleet in orbit; returns what was loaded
+func (c *Client) CollectConversion(id string, fleetID int) (map[string]int, error) {
+	var out map[string]int
+	return out, c.do("POST", "/api/contracts/conversion/collect", map[string]interface{}{"id": id, "fleet_id": fleetID}, &out)
+}
@@ -0,0 +1,215 @@
+package client
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Retries reuse the same Idempotency-Key and carry the session headers
+func TestRetryReusesIdempotencyKey(t *testing.T) {
+	var keys []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		if r.Header.Get("X-Session-Token") != "tok" {
+			t.Errorf("Missing session header")
+		}
+		if len(keys) < 3 {
+			http.Error(w, "Busy", 503)
+			return
+		}
+		w.Write([]byte("Build Complete"))
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL)
+	c.Backoff = time.Millisecond
+	c.UserUUID, c.Token = "user", "tok"
+
+	msg, err := c.Build(1, "farm", 2)
+	if err != nil || msg != "Build Complete" {
+		t.Fatalf("Build: %q %v", msg, err)
+	}
+	if len(keys) != 3 || keys[0] == "" || keys[0] != keys[1] || keys[1] != keys[2] {
+		t.Errorf("Idempotency keys not reused across retries: %v", keys)
+	}
+}
+
+// Client errors are final and surfaced as *APIError
+func TestClientErrorNotRetried(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Error(w, "Insufficient Resources", 402)
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL)
+	_, err := c.Build(1, "farm", 2)
+	apiErr, ok := err.(*APIError)
+	if !ok || apiErr.Status != 402 || calls != 1 {
+		t.Errorf("Expected single 402 APIError, got %v after %d calls", err, calls)
+	}
+}
+
+func TestRegisterStoresSession(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": "registered", "user_uuid": "abc", "session_token": "xyz", "system_id": "sys-1-2-3",
+		})
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL)
+	s, err := c.Register("pilot", "secret")
+	if err != nil || s.SystemID != "sys-1-2-3" || c.UserUUID != "abc" || c.Token != "xyz" {
+		t.Errorf("Register did not store session: %+v %v", s, err)
+	}
+}
+
+// A node that answers one canned response and remembers the request it got
+type recorded struct {
+	Method, Path string
+	Body         map[string]interface{}
+}
+
+func fakeNode(t *testing.T, response string) (*Client, *recorded) {
+	t.Helper()
+	got := &recorded{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.Method, got.Path, got.Body = r.Method, r.URL.RequestURI(), nil
+		if data, _ := io.ReadAll(r.Body); len(data) > 0 {
+			if err := json.Unmarshal(data, &got.Body); err != nil {
+				t.Errorf("Body is not JSON: %s", data)
+			}
+		}
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(srv.Close)
+	c := New(srv.URL)
+	c.UserUUID, c.Token = "user", "tok"
+	return c, got
+}
+
+func expectRequest(t *testing.T, got *recorded, method, path string, body map[string]interface{}) {
+	t.Helper()
+	if got.Method != method || got.Path != path {
+		t.Errorf("Expected %s %s, got %s %s", method, path, got.Method, got.Path)
+	}
+	if !reflect.DeepEqual(got.Body, body) {
+		t.Errorf("Expected body %v, got %v", body, got.Body)
+	}
+}
+
+func TestState(t *testing.T) {
+	c, got := fakeNode(t, `{"credits":250,"colonies":[{"id":3,"system_id":"sys-1-2-3","buildings":{"farm":2},"food":40}],
+		"fleets":[{"id":7,"status":"TRANSIT","dest_system":"sys-4-5-6","payload":{"credits":90,"resources":{"iron":5}}}]}`)
+	s, err := c.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectRequest(t, got, "GET", "/api/state", nil)
+	if s.Credits != 250 || len(s.Colonies) != 1 || s.Colonies[0].Buildings["farm"] != 2 || s.Colonies[0].Food != 40 {
+		t.Errorf("Colonies decoded wrong: %+v", s)
+	}
+	if len(s.Fleets) != 1 || s.Fleets[0].DestSystem != "sys-4-5-6" || s.Fleets[0].Payload.Credits != 90 || s.Fleets[0].Payload.Resources["iron"] != 5 {
+		t.Errorf("Fleets decoded wrong: %+v", s.Fleets)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	c, got := fakeNode(t, "Build Complete\n")
+	msg, err := c.Build(3, "farm", 2)
+	if err != nil || msg != "Build Complete" {
+		t.Fatalf("Build: %q %v", msg, err)
+	}
+	expectRequest(t, got, "POST", "/api/build", map[string]interface{}{"colony_id": 3.0, "structure": "farm", "amount": 2.0})
+}
+
+func TestConstruct(t *testing.T) {
+	c, got := fakeNode(t, "Fleet Constructed: 12")
+	msg, err := c.Construct(3, "Fighter", []string{"laser"}, &FleetPayload{Credits: 100})
+	if err != nil || msg != "Fleet Constructed: 12" {
+		t.Fatalf("Construct: %q %v", msg, err)
+	}
+	expectRequest(t, got, "POST", "/api/construct", map[string]interface{}{
+		"colony_id": 3.0, "hull_class": "Fighter", "modules": []interface{}{"laser"},
+		"payload": map[string]interface{}{"laborers": 0.0, "specialists": 0.0, "resources": nil, "culture": 0.0, "credits": 100.0},
+	})
+
+	// Without a payload the field is left out
+	c.Construct(3, "Fighter", nil, nil)
+	if _, ok := got.Body["payload"]; ok {
+		t.Errorf("Expected no payload, got %v", got.Body)
+	}
+}
+
+func TestFleet(t *testing.T) {
+	c, got := fakeNode(t, `{"id":7,"status":"ORBIT","hull_class":"Fighter","integrity":80,"repair_cost":15,
+		"modules":[{"module":"laser","slot":"weapon","condition":0.5}],"route":{"origin":"sys-1-2-3","eta_ticks":0}}`)
+	m, err := c.Fleet(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectRequest(t, got, "GET", "/api/fleet/7", nil)
+	if m.ID != 7 || m.Integrity != 80 || m.RepairCost != 15 || m.Route.Origin != "sys-1-2-3" || len(m.Modules) != 1 || m.Modules[0].Condition != 0.5 {
+		t.Errorf("Manifest decoded wrong: %+v", m)
+	}
+}
+
+func TestMarket(t *testing.T) {
+	c, got := fakeNode(t, "Order Placed: ord-1 (fee 2)")
+	msg, err := c.PlaceOrder(Order{Item: "iron", Quantity: 10, Price: 5, OriginSystem: "sys-1-2-3"})
+	if err != nil || msg != "Order Placed: ord-1 (fee 2)" {
+		t.Fatalf("PlaceOrder: %q %v", msg, err)
+	}
+	expectRequest(t, got, "POST", "/api/market/place", map[string]interface{}{
+		"item": "iron", "quantity": 10.0, "price": 5.0, "is_buy": false, "origin_system": "sys-1-2-3",
+	})
+
+	c, got = fakeNode(t, `[{"id":"ord-1","seller_uuid":"abc","item":"iron","quantity":10,"price":5,"is_buy":true,"origin_system":"sys-1-2-3","expires_tick":99}]`)
+	orders, err := c.ListOrders()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectRequest(t, got, "GET", "/api/market/list", nil)
+	if len(orders) != 1 || orders[0].ID != "ord-1" || !orders[0].IsBuy || orders[0].ExpiresTick != 99 {
+		t.Errorf("Orders decoded wrong: %+v", orders)
+	}
+}
+
+func TestFederationStatus(t *testing.T) {
+	c, got := fakeNode(t, `{"uuid":"node-a","tick":42,"leader":"node-b","location":[1,2,3],"genesis":"g","tick_duration_ms":60000,"api_versions":["v1"]}`)
+	s, err := c.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectRequest(t, got, "GET", "/api/status", nil)
+	if s.UUID != "node-a" || s.Tick != 42 || s.Leader != "node-b" || len(s.Location) != 3 || s.TickDurationMS != 60000 || len(s.APIVersions) != 1 {
+		t.Errorf("Status decoded wrong: %+v", s)
+	}
+
+	c, got = fakeNode(t, `[{"UUID":"node-b","Url":"http://b","Reputation":12.5,"Relation":1,"Tolls":{"transit":5,"trade_pct":0.02}}]`)
+	peers, err := c.Peers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectRequest(t, got, "GET", "/api/federation/peers", nil)
+	if len(peers) != 1 || peers[0].UUID != "node-b" || peers[0].Relation != 1 || peers[0].Tolls.Transit != 5 {
+		t.Errorf("Peers decoded wrong: %+v", peers)
+	}
+
+	c, got = fakeNode(t, `{"uuid":"node-b","reputation":8,"grudge":2,"history":[{"at":1,"reputation":8,"reason":"grievance"}]}`)
+	rep, err := c.PeerReputation("node b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectRequest(t, got, "GET", "/api/federation/reputation?uuid=node+b", nil)
+	if rep.Grudge != 2 || len(rep.History) != 1 || rep.History[0].Reason != "grievance" {
+		t.Errorf("Reputation decoded wrong: %+v", rep)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+// --- Power Grid ---
+// Industry runs on power. Every colony's own generators supply GridBasePower, enough for a
+// couple of early refineries; solar plants add SolarPlantPower each, scaled by the star like
+// farms; fission reactors add the rest but burn a unit of fuel per tick while they run,
+// plutonium first (ReactorPlutoniumPower) and uranium otherwise. Reactors only come online as
+// demand needs them, so an idle grid burns nothing. Refineries and module factories draw
+// PowerDemand per building; when demand outruns supply, industry is throttled by the
+// supply/demand ratio. Extraction and farming are unaffected.
+
+const (
+	GridBasePower         = 10
+	SolarPlantPower       = 8
+	ReactorUraniumPower   = 30
+	ReactorPlutoniumPower = 60
+)
+
+// Power drawn per building of each kind
+var PowerDemand = map[string]int{
+	"steel_mill":        2,
+	"fuel_synthesizer":  3,
+	"winery":            1,
+	"oxygen_plant":      2,
+	"platinum_refinery": 4,
+	"uranium_enricher":  6,
+	"diamond_cutter":    4,
+	"breeder_reactor":   10,
+	"module_factory":    5,
+}
+
+type PowerGrid struct {
+	Supply int     `json:"supply"`
+	Demand int     `json:"demand"`
+	Factor float64 `json:"factor"` // share of industry the grid can run
+}
+
+func powerDemand(buildings map[string]int) int {
+	demand := 0
+	for b, draw := range PowerDemand {
+		demand += buildings[b] * draw
+	}
+	return demand
+}
+
+// Balances a colony's grid for this tick. With burn set the reactor fuel it takes is spent
+// from the colony; otherwise the grid is only reported as it would run.
+func colonyPower(c *Colony, star string, burn bool) PowerGrid {
+	g := PowerGrid{
+		Supply: GridBasePower + int(float64(c.Buildings["solar_plant"]*SolarPlantPower)*solarFactor(star)),
+		Demand: powerDemand(c.Buildings),
+		Factor: 1.0,
+	}
+
+	plutonium, uranium := c.Plutonium, c.Uranium
+	for i := 0; i < c.Buildings["fission_reactor"] && g.Supply < g.Demand; i++ {
+		if plutonium > 0 {
+			plutonium--
+			g.Supply += ReactorPlutoniumPower
+		} else if uranium > 0 {
+			uranium--
+			g.Supply += ReactorUraniumPower
+		} else {
+			break
+		}
+	}
+	if burn {
+		c.Plutonium, c.Uranium = plutonium, uranium
+	}
+
+	if g.Demand > g.Supply {
+		g.Factor = float64(g.Supply) / float64(g.Demand)
+	}
+	return g
+}
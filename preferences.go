@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// --- User Preferences ---
+// Clients keep their settings on the server so the web client, the CLI and anything else a
+// player signs in with share them: UI layout, notification choices, default fleet loadouts. The
+// server doesn't read them. Each is a JSON value stored under a namespace the client picks
+// ("ui", "cli.colors", "loadouts"), up to MaxPreferenceBytes each and MaxPreferenceTotal and
+// MaxPreferenceNamespaces per user. Every write bumps the namespace's version; a client that
+// sends the version it last read has the write refused with 409 if another client got there
+// first, and gets the newer value back to merge.
+
+const (
+	MaxPreferenceBytes      = 16 * 1024
+	MaxPreferenceTotal      = 48 * 1024
+	MaxPreferenceNamespaces = 32
+)
+
+var preferenceNamespace = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+type Preference struct {
+	Namespace string          `json:"namespace"`
+	Value     json.RawMessage `json:"value"`
+	Version   int64           `json:"version"`
+	UpdatedAt int64           `json:"updated_at"`
+}
+
+type PreferenceList struct {
+	Preferences   []Preference `json:"preferences"`
+	UsedBytes     int          `json:"used_bytes"`
+	QuotaBytes    int          `json:"quota_bytes"`
+	MaxValueBytes int          `json:"max_value_bytes"`
+	MaxNamespaces int          `json:"max_namespaces"`
+}
+
+func userPreferences(userID string) PreferenceList {
+	list := PreferenceList{
+		Preferences: []Preference{}, QuotaBytes: MaxPreferenceTotal, MaxValueBytes: MaxPreferenceBytes, MaxNamespaces: MaxPreferenceNamespaces,
+	}
+	rows, err := db.Query("SELECT namespace, value_json, version, updated_at FROM user_preferences WHERE user_uuid=? ORDER BY namespace", userID)
+	if err != nil {
+		return list
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p Preference
+		var value string
+		rows.Scan(&p.Namespace, &value, &p.Version, &p.UpdatedAt)
+		p.Value = json.RawMessage(value)
+		list.Preferences = append(list.Preferences, p)
+		list.UsedBytes += len(value)
+	}
+	return list
+}
+
+func userPreference(userID, namespace string) (Preference, bool) {
+	p := Preference{Namespace: namespace}
+	var value string
+	err := db.QueryRow("SELECT value_json, version, updated_at FROM user_preferences WHERE user_uuid=? AND namespace=?", userID, namespace).
+		Scan(&value, &p.Version, &p.UpdatedAt)
+	if err != nil {
+		return p, false
+	}
+	p.Value = json.RawMessage(value)
+	return p, true
+}
+
+func writePreference(w http.ResponseWriter, code int, p Preference) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(p)
+}
+
+// GET lists every namespace with its value, version and the quota used, or one with ?namespace=.
+// POST {"namespace", "value", "version" (optional: the version last read)} stores a value;
+// {"namespace", "remove": true} deletes it and returns the list.
+func handlePreferences(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		if ns := r.URL.Query().Get("namespace"); ns != "" {
+			p, ok := userPreference(userID, ns)
+			if !ok {
+				http.Error(w, "Preference Not Found", 404)
+				return
+			}
+			writePreference(w, 200, p)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(userPreferences(userID))
+		return
+	}
+
+	var req struct {
+		Namespace string          `json:"namespace" validate:"required"`
+		Value     json.RawMessage `json:"value"`
+		Version   *int64          `json:"version"`
+		Remove    bool            `json:"remove"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if !preferenceNamespace.MatchString(req.Namespace) {
+		http.Error(w, "Bad Request: namespace must be 1-64 of a-z, 0-9, '_', '.', '-'", 400)
+		return
+	}
+
+	defer lockRows(userRow(userID))()
+	current, exists := userPreference(userID, req.Namespace)
+	if req.Version != nil && *req.Version != current.Version {
+		// Someone else wrote first; hand back what they wrote
+		writePreference(w, http.StatusConflict, current)
+		return
+	}
+
+	if req.Remove {
+		if !exists {
+			http.Error(w, "Preference Not Found", 404)
+			return
+		}
+		db.Exec("DELETE FROM user_preferences WHERE user_uuid=? AND namespace=?", userID, req.Namespace)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(userPreferences(userID))
+		return
+	}
+
+	var value bytes.Buffer
+	if len(req.Value) == 0 || json.Compact(&value, req.Value) != nil || value.String() == "null" {
+		http.Error(w, "Bad Request: missing field 'value'", 400)
+		return
+	}
+	if value.Len() > MaxPreferenceBytes {
+		http.Error(w, "Preference Too Large", 413)
+		return
+	}
+	var count, others int
+	db.QueryRow("SELECT count(*), COALESCE(SUM(length(CAST(value_json AS BLOB))), 0) FROM user_preferences WHERE user_uuid=? AND namespace != ?", userID, req.Namespace).
+		Scan(&count, &others)
+	if !exists && count >= MaxPreferenceNamespaces {
+		http.Error(w, "Preference Limit Reached", 400)
+		return
+	}
+	if others+value.Len() > MaxPreferenceTotal {
+		http.Error(w, "Preference Quota Exceeded", 413)
+		return
+	}
+
+	p := Preference{Namespace: req.Namespace, Value: json.RawMessage(value.String()), Version: current.Version + 1, UpdatedAt: time.Now().Unix()}
+	if exists {
+		_, err = db.Exec("UPDATE user_preferences SET value_json=?, version=?, updated_at=? WHERE user_uuid=? AND namespace=?",
+			value.String(), p.Version, p.UpdatedAt, userID, req.Namespace)
+	} else {
+		_, err = db.Exec("INSERT INTO user_preferences (user_uuid, namespace, value_json, version, updated_at) VALUES (?, ?, ?, ?, ?)",
+			userID, req.Namespace, value.String(), p.Version, p.UpdatedAt)
+	}
+	if err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+	writePreference(w, 200, p)
+}
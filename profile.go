@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// --- Public Profiles ---
+// GET /public/player/{uuid} is an unauthenticated summary of one of this node's empires, so
+// communities can link to each other: name, founding date, score, colonies and claimed systems,
+// the node's alliances and a war record. Nothing a rival could plan an attack with is shown: no
+// stockpiles, credits, fleet positions or colony locations. Profiles are rebuilt at most once
+// per tick and may be cached publicly for ProfileMaxAge seconds.
+//
+// Score is population plus ScorePerBuilding per building level and ScorePerSystem per claimed
+// system (a system holding at least one of the empire's colonies).
+
+const (
+	ProfileMaxAge    = 60
+	ScorePerBuilding = 50
+	ScorePerSystem   = 500
+)
+
+type WarRecord struct {
+	Battles         int `json:"battles"`
+	FleetsDestroyed int `json:"fleets_destroyed"`
+	FleetsLost      int `json:"fleets_lost"`
+	Bombardments    int `json:"bombardments"`    // strikes the empire flew
+	TimesBombarded  int `json:"times_bombarded"` // strikes on its colonies
+}
+
+type PlayerProfile struct {
+	UUID      string    `json:"uuid"`
+	Name      string    `json:"name"`
+	Node      string    `json:"node"`
+	FoundedAt int64     `json:"founded_at,omitempty"` // unix seconds; unknown for accounts older than profiles
+	Score     int       `json:"score"`
+	Colonies  int       `json:"colonies"`
+	Systems   int       `json:"systems"`
+	Alliances []string  `json:"alliances"` // nodes allied with this empire's node
+	War       WarRecord `json:"war"`
+}
+
+var profileCaches sync.Map // uuid -> *tickCache
+
+func empireScore(uuid string) (score, colonies, systems int) {
+	rows, err := db.Query("SELECT system_id, pop_laborers + pop_specialists + pop_elites, buildings_json FROM colonies WHERE owner_uuid=?", uuid)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	claimed := make(map[string]bool)
+	for rows.Next() {
+		var sysID, bJson string
+		var pop int
+		rows.Scan(&sysID, &pop, &bJson)
+		var buildings map[string]int
+		json.Unmarshal([]byte(bJson), &buildings)
+		score += pop
+		for _, level := range buildings {
+			score += level * ScorePerBuilding
+		}
+		colonies++
+		claimed[sysID] = true
+	}
+	systems = len(claimed)
+	score += systems * ScorePerSystem
+	return
+}
+
+func warRecord(uuid string) WarRecord {
+	var rec WarRecord
+	rows, err := db.Query(`SELECT b.report_json FROM battle_reports b
+	                       JOIN battle_participants p ON p.battle_id = b.id WHERE p.owner_uuid=?`, uuid)
+	if err == nil {
+		for rows.Next() {
+			var rJson string
+			rows.Scan(&rJson)
+			var br BattleReport
+			json.Unmarshal([]byte(rJson), &br)
+			rec.Battles++
+			for _, p := range br.Participants {
+				if p.KilledBy == uuid && p.OwnerUUID != uuid {
+					rec.FleetsDestroyed++
+				}
+				if p.OwnerUUID == uuid && p.Outcome == "destroyed" {
+					rec.FleetsLost++
+				}
+			}
+		}
+		rows.Close()
+	}
+	db.QueryRow("SELECT COUNT(*) FROM bombardment_reports WHERE attacker_uuid=?", uuid).Scan(&rec.Bombardments)
+	db.QueryRow("SELECT COUNT(*) FROM bombardment_reports WHERE defender_uuid=?", uuid).Scan(&rec.TimesBombarded)
+	return rec
+}
+
+func nodeAlliances() []string {
+	peerLock.RLock()
+	defer peerLock.RUnlock()
+	allies := []string{}
+	for _, p := range Peers {
+		if p.Relation == 1 {
+			allies = append(allies, p.UUID)
+		}
+	}
+	sort.Strings(allies)
+	return allies
+}
+
+// Nil when uuid isn't one of this node's players
+func buildProfile(uuid string) *PlayerProfile {
+	p := &PlayerProfile{UUID: uuid, Node: ServerUUID}
+	if uuid == ServerUUID || db.QueryRow("SELECT username, COALESCE(created_at, 0) FROM users WHERE global_uuid=? AND is_local=1", uuid).Scan(&p.Name, &p.FoundedAt) != nil {
+		return nil
+	}
+	p.Score, p.Colonies, p.Systems = empireScore(uuid)
+	p.Alliances = nodeAlliances()
+	p.War = warRecord(uuid)
+	return p
+}
+
+func handlePublicPlayer(w http.ResponseWriter, r *http.Request) {
+	uuid := strings.TrimPrefix(r.URL.Path, "/public/player/")
+	if uuid == "" || strings.Contains(uuid, "/") {
+		http.Error(w, "Player Not Found", 404)
+		return
+	}
+
+	tick := atomic.LoadInt64(&CurrentTick)
+	c, _ := profileCaches.LoadOrStore(uuid, &tickCache{})
+	var missing bool
+	cb := c.(*tickCache).get(strconv.FormatInt(tick, 10), func() []byte {
+		p := buildProfile(uuid)
+		if p == nil {
+			missing = true
+			return nil
+		}
+		data, _ := json.Marshal(p)
+		return data
+	})
+	if missing || cb.Body == nil {
+		profileCaches.Delete(uuid)
+		http.Error(w, "Player Not Found", 404)
+		return
+	}
+	serveCachedBodyWith(w, r, cb, "public, max-age="+strconv.Itoa(ProfileMaxAge))
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// --- Fleet Recall ---
+// A fleet in transit can be turned around and sent back to the system it left. The return leg
+// takes as long as the fleet has already flown, and fuel is settled against the distance covered:
+// the launch charged route_fuel for the whole leg, of which the flown share is spent, the same
+// share again pays for the way back, and the rest is refunded. Past the point of no return (a
+// fraction of the leg, OWNWORLD_RECALL_CUTOFF, default half) the fleet must carry on.
+
+const DefaultRecallCutoff = 0.5
+
+// Fraction of a leg after which a fleet can no longer be recalled
+func recallCutoff() float64 {
+	if Config.RecallCutoff > 0 {
+		return Config.RecallCutoff
+	}
+	return DefaultRecallCutoff
+}
+
+// Fuel charged for the flown share of a leg, rounded up so a recall never comes out ahead
+func flownFuel(routeFuel int, progress float64) int {
+	f := float64(routeFuel) * progress
+	n := int(f)
+	if float64(n) < f {
+		n++
+	}
+	return n
+}
+
+func handleFleetRecall(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	var req struct {
+		FleetID int `json:"fleet_id" validate:"required"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	defer lockRows(userRow(userID))()
+
+	var owner, status, origin, dest string
+	var fuel, routeFuel int
+	var departure, arrival int64
+	err = db.QueryRow(`SELECT owner_uuid, status, origin_system, dest_system, fuel, COALESCE(route_fuel, 0),
+	                   COALESCE(departure_tick, 0), arrival_tick FROM fleets WHERE id=?`, req.FleetID).
+		Scan(&owner, &status, &origin, &dest, &fuel, &routeFuel, &departure, &arrival)
+	if err != nil {
+		http.Error(w, "Fleet Not Found", 404)
+		return
+	}
+	if owner != userID {
+		http.Error(w, "Not your fleet", 403)
+		return
+	}
+	if status != "TRANSIT" {
+		http.Error(w, "Fleet not in transit", 400)
+		return
+	}
+	if origin == dest {
+		http.Error(w, "Fleet already returning", 409)
+		return
+	}
+
+	now := atomic.LoadInt64(&CurrentTick)
+	progress := legProgress(departure, arrival, now)
+	if progress >= recallCutoff() {
+		http.Error(w, "Past the point of no return", 409)
+		return
+	}
+
+	// Flown share is spent, the return burns as much again; a negative refund is a top-up
+	flown := flownFuel(routeFuel, progress)
+	refund := routeFuel - 2*flown
+	if fuel+refund < 0 {
+		http.Error(w, fmt.Sprintf("Insufficient Fuel. Need %d", -refund), 402)
+		return
+	}
+	returnTick := now + (now - departure)
+
+	db.Exec(`UPDATE fleets SET fuel=fuel+?, route_fuel=?, dest_system=?, departure_tick=?, arrival_tick=?,
+	         target_order_id=NULL WHERE id=?`,
+		refund, flown, origin, now, returnTick, req.FleetID)
+
+	InfoLog.Printf("↩️ Fleet %d recalled to %s at %.0f%% of its leg (Arrival Tick %d)", req.FleetID, origin, progress*100, returnTick)
+	w.Write([]byte(fmt.Sprintf("Fleet Recalled. Refund: %d. Arrival Tick: %d", refund, returnTick)))
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// --- Account Recovery ---
+// A password is also the key to the account's encrypted ed25519 key, so forgetting it used to
+// lose both. Two optional ways back, each set up while the password is still known:
+//
+//	email          POST /api/account/email stores an address and mails a verification token.
+//	               The key is escrowed under a secret derived from the node's own identity key,
+//	               so once the address is verified a reset token mailed to it can unlock it.
+//	recovery code  POST /api/account/recovery-code returns a one-time code, shown once. The
+//	               key is encrypted under the code; the node keeps only its hash.
+//
+// POST /api/account/reset takes the username, a reset token or recovery code and a new password,
+// re-encrypts the key under the new password and starts a fresh session (other sessions and
+// signing sessions end). Codes and tokens are single-use; failed resets count towards the login
+// throttle. Mail goes out through the mailer configured by OWNWORLD_SMTP_ADDR (host:port, with
+// OWNWORLD_SMTP_USER / _PASS / _FROM); "log" writes messages to the info log for development,
+// and with nothing set email recovery is off while recovery codes still work.
+
+const (
+	VerifyTokenTTL    = 24 * time.Hour
+	ResetTokenTTL     = time.Hour
+	ResetMailInterval = 5 * time.Minute // per account, so the reset form can't be used to spam
+	MaxEmailLength    = 254
+
+	TokenVerify = "verify"
+	TokenReset  = "reset"
+
+	escrowContext = "ownworld-recovery-escrow:"
+)
+
+// Delivers account mail; swapped out by configuration (and tests)
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+type smtpMailer struct {
+	Addr, From string
+	Auth       smtp.Auth
+}
+
+func (m smtpMailer) Send(to, subject, body string) error {
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n",
+		m.From, to, subject, strings.ReplaceAll(body, "\n", "\r\n"))
+	return smtp.SendMail(m.Addr, m.Auth, m.From, []string{to}, []byte(msg))
+}
+
+type logMailer struct{}
+
+func (logMailer) Send(to, subject, body string) error {
+	InfoLog.Printf("✉️ Mail to %s: %s\n%s", to, subject, body)
+	return nil
+}
+
+// nil = email recovery disabled
+var mailer Mailer
+
+func mailerFromEnv() Mailer {
+	addr := os.Getenv("OWNWORLD_SMTP_ADDR")
+	switch addr {
+	case "":
+		return nil
+	case "log":
+		return logMailer{}
+	}
+	m := smtpMailer{Addr: addr, From: os.Getenv("OWNWORLD_SMTP_FROM")}
+	if m.From == "" {
+		m.From = "ownworld@" + strings.Split(addr, ":")[0]
+	}
+	if user := os.Getenv("OWNWORLD_SMTP_USER"); user != "" {
+		m.Auth = smtp.PlainAuth("", user, os.Getenv("OWNWORLD_SMTP_PASS"), strings.Split(addr, ":")[0])
+	}
+	return m
+}
+
+type RecoveryStatus struct {
+	Email         string `json:"email,omitempty"`
+	EmailVerified bool   `json:"email_verified"`
+	RecoveryCode  bool   `json:"recovery_code"`
+	EmailEnabled  bool   `json:"email_enabled"`
+}
+
+type accountRecovery struct {
+	Email         string
+	EmailVerified bool
+	KeyEscrow     string
+	CodeHash      string
+	KeyByCode     string
+}
+
+func loadRecovery(userID string) (accountRecovery, error) {
+	var rec accountRecovery
+	err := db.QueryRow(`SELECT COALESCE(email, ''), email_verified, COALESCE(key_escrow, ''), COALESCE(code_hash, ''), COALESCE(key_by_code, '')
+	                    FROM account_recovery WHERE user_uuid=?`, userID).
+		Scan(&rec.Email, &rec.EmailVerified, &rec.KeyEscrow, &rec.CodeHash, &rec.KeyByCode)
+	if err == sql.ErrNoRows {
+		return rec, nil
+	}
+	return rec, err
+}
+
+// The node-held secret a user's key is escrowed under for email resets
+func escrowSecret(userID string) string {
+	return hashBLAKE3([]byte(escrowContext + hex.EncodeToString(PrivateKey) + ":" + userID))
+}
+
+// 160 random bits as eight groups of four base32 characters
+func generateRecoveryCode() string {
+	b := make([]byte, 20)
+	rand.Read(b)
+	s := base32.StdEncoding.EncodeToString(b)
+	groups := make([]string, 0, len(s)/4)
+	for i := 0; i < len(s); i += 4 {
+		groups = append(groups, s[i:i+4])
+	}
+	return strings.Join(groups, "-")
+}
+
+// Codes are accepted with or without dashes, spaces and in any case
+func normalizeRecoveryCode(code string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+func validEmail(addr string) bool {
+	if len(addr) > MaxEmailLength {
+		return false
+	}
+	parsed, err := mail.ParseAddress(addr)
+	return err == nil && parsed.Address == addr
+}
+
+// Stores an unverified address with the key escrowed, and mails the verification token
+func setRecoveryEmail(userID, email string, key ed25519.PrivateKey) error {
+	_, err := db.Exec(`INSERT INTO account_recovery (user_uuid, email, email_verified, key_escrow) VALUES (?, ?, 0, ?)
+	                   ON CONFLICT(user_uuid) DO UPDATE SET email=excluded.email, email_verified=0, key_escrow=excluded.key_escrow`,
+		userID, email, encryptKey(key, escrowSecret(userID)))
+	if err != nil {
+		return err
+	}
+	db.Exec("DELETE FROM account_tokens WHERE user_uuid=? AND purpose=?", userID, TokenVerify)
+	token := issueAccountToken(userID, TokenVerify, email, VerifyTokenTTL)
+	return mailer.Send(email, "Verify your OwnWorld recovery address",
+		fmt.Sprintf("Your verification token is:\n\n    %s\n\nPOST it to /api/account/verify as {\"token\"} within %s.\n", token, VerifyTokenTTL))
+}
+
+// Returns a fresh code; the key is stored encrypted under it, the code itself only as a hash
+func setRecoveryCode(userID string, key ed25519.PrivateKey) (string, error) {
+	code := generateRecoveryCode()
+	norm := normalizeRecoveryCode(code)
+	_, err := db.Exec(`INSERT INTO account_recovery (user_uuid, code_hash, key_by_code) VALUES (?, ?, ?)
+	                   ON CONFLICT(user_uuid) DO UPDATE SET code_hash=excluded.code_hash, key_by_code=excluded.key_by_code`,
+		userID, hashBLAKE3([]byte(norm)), encryptKey(key, norm))
+	return code, err
+}
+
+func issueAccountToken(userID, purpose, email string, ttl time.Duration) string {
+	token := generateSessionToken()
+	db.Exec("INSERT INTO account_tokens (token_hash, user_uuid, purpose, email, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)",
+		hashBLAKE3([]byte(token)), userID, purpose, email, time.Now().Unix(), time.Now().Add(ttl).Unix())
+	return token
+}
+
+// Consumes a token; returns who it was for and the address it was sent to
+func redeemAccountToken(token, purpose string) (userID, email string, ok bool) {
+	h := hashBLAKE3([]byte(token))
+	var expires int64
+	err := db.QueryRow("SELECT user_uuid, email, expires_at FROM account_tokens WHERE token_hash=? AND purpose=?", h, purpose).
+		Scan(&userID, &email, &expires)
+	if err != nil {
+		return "", "", false
+	}
+	db.Exec("DELETE FROM account_tokens WHERE token_hash=?", h)
+	return userID, email, time.Now().Unix() < expires
+}
+
+func pruneAccountTokens() {
+	db.Exec("DELETE FROM account_tokens WHERE expires_at < ?", time.Now().Unix())
+}
+
+// GET the account's recovery setup
+func handleAccountRecovery(w http.ResponseWriter, r *http.Request) {
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+	rec, err := loadRecovery(userID)
+	if err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RecoveryStatus{
+		Email: rec.Email, EmailVerified: rec.EmailVerified, RecoveryCode: rec.CodeHash != "", EmailEnabled: mailer != nil,
+	})
+}
+
+// POST {"password", "email"}; an empty email removes the address and the escrowed key
+func handleAccountEmail(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	var req struct {
+		Password string `json:"password" validate:"required"`
+		Email    string `json:"email"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+	if req.Email != "" && !validEmail(req.Email) {
+		http.Error(w, "Invalid Email", 400)
+		return
+	}
+	if req.Email != "" && mailer == nil {
+		http.Error(w, "Email Not Configured on this Node", 503)
+		return
+	}
+	key, ok := unlockUserKeyFor(w, userID, req.Password)
+	if !ok {
+		return
+	}
+	defer wipeKey(key)
+
+	if req.Email == "" {
+		db.Exec("UPDATE account_recovery SET email=NULL, email_verified=0, key_escrow=NULL WHERE user_uuid=?", userID)
+		db.Exec("DELETE FROM account_tokens WHERE user_uuid=?", userID)
+		w.Write([]byte("Email Removed"))
+		return
+	}
+	if err := setRecoveryEmail(userID, req.Email, key); err != nil {
+		ErrorLog.Printf("Recovery mail to %s failed: %v", req.Email, err)
+		http.Error(w, "Mail Delivery Failed", 502)
+		return
+	}
+	w.Write([]byte("Verification Sent"))
+}
+
+// POST {"token"} from the verification mail; no session needed
+func handleAccountVerify(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	var req struct {
+		Token string `json:"token" validate:"required"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	userID, email, ok := redeemAccountToken(req.Token, TokenVerify)
+	if !ok {
+		http.Error(w, "Invalid or Expired Token", 400)
+		return
+	}
+	res, err := db.Exec("UPDATE account_recovery SET email_verified=1 WHERE user_uuid=? AND email=?", userID, email)
+	if err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Address Changed Since", 409)
+		return
+	}
+	w.Write([]byte("Email Verified"))
+}
+
+// POST {"password"} -> {"recovery_code"}; replaces any earlier code
+func handleAccountRecoveryCode(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Password string `json:"password" validate:"required"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+	key, ok := unlockUserKeyFor(w, userID, req.Password)
+	if !ok {
+		return
+	}
+	defer wipeKey(key)
+
+	code, err := setRecoveryCode(userID, key)
+	if err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"recovery_code": code})
+}
+
+// POST {"username"}: mails a reset token if the account has a verified address. The answer is
+// the same either way, so the form can't be used to find out who has one.
+func handleAccountResetRequest(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	var req struct {
+		Username string `json:"username" validate:"required"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if mailer == nil {
+		http.Error(w, "Email Not Configured on this Node", 503)
+		return
+	}
+
+	var userID string
+	db.QueryRow("SELECT global_uuid FROM users WHERE username=? AND is_local=1", req.Username).Scan(&userID)
+	rec, _ := loadRecovery(userID)
+	if userID != "" && rec.EmailVerified && rec.KeyEscrow != "" {
+		var recent int
+		db.QueryRow("SELECT count(*) FROM account_tokens WHERE user_uuid=? AND purpose=? AND created_at > ?",
+			userID, TokenReset, time.Now().Add(-ResetMailInterval).Unix()).Scan(&recent)
+		if recent == 0 {
+			token := issueAccountToken(userID, TokenReset, rec.Email, ResetTokenTTL)
+			err := mailer.Send(rec.Email, "Reset your OwnWorld password",
+				fmt.Sprintf("A password reset was requested for %s. Your reset token is:\n\n    %s\n\nPOST it to /api/account/reset as {\"username\", \"token\", \"new_password\"} within %s. If this wasn't you, ignore this mail.\n",
+					req.Username, token, ResetTokenTTL))
+			if err != nil {
+				ErrorLog.Printf("Reset mail for %s failed: %v", req.Username, err)
+			}
+		}
+	}
+	w.WriteHeader(202)
+	w.Write([]byte("If the account has a verified address, a reset token is on its way"))
+}
+
+// POST {"username", "token" | "recovery_code", "new_password"} -> a new session, like a login
+func handleAccountReset(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	var req struct {
+		Username     string `json:"username" validate:"required"`
+		Token        string `json:"token"`
+		RecoveryCode string `json:"recovery_code"`
+		NewPassword  string `json:"new_password" validate:"required"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if (req.Token == "") == (req.RecoveryCode == "") {
+		http.Error(w, "Send a token or a recovery_code", 400)
+		return
+	}
+	if rejectThrottledLogin(w, req.Username) {
+		return
+	}
+
+	var userID string
+	db.QueryRow("SELECT global_uuid FROM users WHERE username=? AND is_local=1", req.Username).Scan(&userID)
+	defer lockRows(userRow(userID))()
+	rec, _ := loadRecovery(userID)
+
+	var key ed25519.PrivateKey
+	var err error = fmt.Errorf("no recovery set up")
+	if req.Token != "" {
+		if owner, email, ok := redeemAccountToken(req.Token, TokenReset); ok && userID != "" && owner == userID && rec.EmailVerified && email == rec.Email {
+			key, err = decryptKey(rec.KeyEscrow, escrowSecret(userID))
+		}
+	} else {
+		norm := normalizeRecoveryCode(req.RecoveryCode)
+		if userID != "" && rec.CodeHash != "" && hashBLAKE3([]byte(norm)) == rec.CodeHash {
+			if key, err = decryptKey(rec.KeyByCode, norm); err == nil {
+				db.Exec("UPDATE account_recovery SET code_hash=NULL, key_by_code=NULL WHERE user_uuid=?", userID)
+			}
+		}
+	}
+	if err != nil {
+		recordLoginFailure(req.Username, userID)
+		http.Error(w, "Reset Failed", 403)
+		return
+	}
+	defer wipeKey(key)
+
+	_, err = db.Exec("UPDATE users SET password_hash=?, ed25519_priv_enc=? WHERE global_uuid=?",
+		hashBLAKE3([]byte(req.NewPassword)), encryptKey(key, req.NewPassword), userID)
+	if err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+	db.Exec("DELETE FROM account_tokens WHERE user_uuid=? AND purpose=?", userID, TokenReset)
+	lockSigningSessions(userID)
+	InfoLog.Printf("🔑 Password reset for %s", req.Username)
+	startLoginSession(w, userID, clearLoginFailures(req.Username))
+}
@@ -0,0 +1,166 @@
+package main
+
+import "math"
+
+// --- War Shock & Refugees ---
+// War that reaches a colony shakes it. A battle in its system knocks BattleShock off its current
+// stability; a bombardment knocks off BombardmentShock, and more when civilians die. Stability
+// still recovers towards its target at the usual pace, so the shock is felt for a while rather
+// than forever. Each shock also drives a share of the laborers out: they leave at once and make
+// for the owner's nearest colony that is still stable (RefugeeHavenStability or better), arriving
+// in waves over RefugeeWaveTicks ticks. The haven pays RefugeeRations food for each one it takes
+// in, and they join its laborers afterwards. An owner with no stable colony elsewhere has nowhere
+// to send them, so they stay and ride out the shock at home.
+
+const (
+	BattleShock             = 10.0
+	BombardmentShock        = 20.0
+	CasualtyShock           = 10.0 // extra when a bombardment kills civilians
+	BattleRefugeeShare      = 0.02
+	BombardmentRefugeeShare = 0.05
+	RefugeeHavenStability   = 60.0
+	RefugeeWaveTicks        = 10
+	RefugeeRations          = 2 // food per refugee taken in
+)
+
+type RefugeeFlow struct {
+	ID        int    `json:"id"`
+	From      int    `json:"from_colony_id"`
+	To        int    `json:"to_colony_id"`
+	Remaining int    `json:"remaining"`
+	PerTick   int    `json:"per_tick"`
+	Cause     string `json:"cause"` // battle or bombardment
+	Started   int64  `json:"started_tick"`
+}
+
+// Shocks a colony and sends share of its laborers fleeing; returns how many left
+func warShock(colonyID int, shock, share float64, cause string, tick int64) int {
+	var owner, sysID string
+	var laborers int
+	err := db.QueryRow("SELECT owner_uuid, system_id, pop_laborers FROM colonies WHERE id=?", colonyID).Scan(&owner, &sysID, &laborers)
+	if err != nil {
+		return 0
+	}
+	db.Exec("UPDATE colonies SET stability_current = MAX(0, stability_current - ?) WHERE id=?", shock, colonyID)
+
+	fleeing := int(float64(laborers) * share)
+	if fleeing <= 0 {
+		return 0
+	}
+	haven, ok := nearestHaven(owner, colonyID, sysID)
+	if !ok {
+		return 0
+	}
+	perTick := int(math.Ceil(float64(fleeing) / RefugeeWaveTicks))
+	res, err := db.Exec("UPDATE colonies SET pop_laborers = pop_laborers - ? WHERE id=? AND pop_laborers >= ?", fleeing, colonyID, fleeing)
+	if err != nil {
+		return 0
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return 0
+	}
+	db.Exec("INSERT INTO refugee_flows (owner_uuid, from_colony, to_colony, remaining, per_tick, cause, started_tick) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		owner, colonyID, haven, fleeing, perTick, cause, tick)
+	InfoLog.Printf("🚶 %d refugees flee colony %d (%s) for colony %d", fleeing, colonyID, cause, haven)
+	return fleeing
+}
+
+// Shocks every colony in a system where a battle was fought
+func shockSystem(sysID string, tick int64) {
+	rows, err := db.Query("SELECT id FROM colonies WHERE system_id=?", sysID)
+	if err != nil {
+		return
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+	rows.Close()
+	for _, id := range ids {
+		warShock(id, BattleShock, BattleRefugeeShare, "battle", tick)
+	}
+}
+
+// The owner's closest other colony that is stable enough to take people in
+func nearestHaven(owner string, fromID int, fromSys string) (int, bool) {
+	from := systemCoords(fromSys)
+	rows, err := db.Query(`SELECT c.id, COALESCE(s.x, 0), COALESCE(s.y, 0), COALESCE(s.z, 0) FROM colonies c
+	                       LEFT JOIN solar_systems s ON c.system_id = s.id
+	                       WHERE c.owner_uuid=? AND c.id != ? AND c.system_id != ? AND c.stability_current >= ?
+	                       ORDER BY c.id`, owner, fromID, fromSys, RefugeeHavenStability)
+	if err != nil {
+		return 0, false
+	}
+	defer rows.Close()
+
+	best, bestDist := 0, math.MaxFloat64
+	for rows.Next() {
+		var id, x, y, z int
+		rows.Scan(&id, &x, &y, &z)
+		if d := distance3(from, []int{x, y, z}); d < bestDist {
+			best, bestDist = id, d
+		}
+	}
+	return best, best != 0
+}
+
+func systemCoords(sysID string) []int {
+	var x, y, z int
+	db.QueryRow("SELECT x, y, z FROM solar_systems WHERE id=?", sysID).Scan(&x, &y, &z)
+	return []int{x, y, z}
+}
+
+// Lands this tick's wave of each flow; runs before colonies are simulated
+func moveRefugees() {
+	rows, err := db.Query("SELECT id, owner_uuid, to_colony, remaining, per_tick FROM refugee_flows")
+	if err != nil {
+		return
+	}
+	type flow struct {
+		RefugeeFlow
+		owner string
+	}
+	var flows []flow
+	for rows.Next() {
+		var f flow
+		rows.Scan(&f.ID, &f.owner, &f.To, &f.Remaining, &f.PerTick)
+		flows = append(flows, f)
+	}
+	rows.Close()
+
+	for _, f := range flows {
+		wave := f.PerTick
+		if wave > f.Remaining {
+			wave = f.Remaining
+		}
+		// A haven lost on the way (conquered, seceded) takes nobody; the flow ends
+		res, err := db.Exec("UPDATE colonies SET pop_laborers = pop_laborers + ?, food = MAX(0, food - ?) WHERE id=? AND owner_uuid=?",
+			wave, wave*RefugeeRations, f.To, f.owner)
+		if err != nil {
+			continue
+		}
+		if n, _ := res.RowsAffected(); n == 0 || wave >= f.Remaining {
+			db.Exec("DELETE FROM refugee_flows WHERE id=?", f.ID)
+			continue
+		}
+		db.Exec("UPDATE refugee_flows SET remaining = remaining - ? WHERE id=?", wave, f.ID)
+	}
+}
+
+// Flows still under way for the user's colonies
+func refugeeFlows(userID string) []RefugeeFlow {
+	rows, err := db.Query("SELECT id, from_colony, to_colony, remaining, per_tick, cause, started_tick FROM refugee_flows WHERE owner_uuid=? ORDER BY id", userID)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	var list []RefugeeFlow
+	for rows.Next() {
+		var f RefugeeFlow
+		rows.Scan(&f.ID, &f.From, &f.To, &f.Remaining, &f.PerTick, &f.Cause, &f.Started)
+		list = append(list, f)
+	}
+	return list
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// --- Registration Defences ---
+// Three independent gates in front of /api/register, each off unless configured, so a private
+// node stays open to friends while a public one can defend itself:
+//   - invite codes: with OWNWORLD_REGISTRATION=invite new accounts need a code minted by the
+//     operator on /admin/registration-codes. A code has a number of uses and an expiry.
+//   - a daily cap per address: OWNWORLD_REGISTRATIONS_PER_IP accounts per IP in 24h.
+//   - a captcha: with OWNWORLD_CAPTCHA_URL set, the client's "captcha" token is checked by a
+//     CaptchaVerifier. The built-in one speaks the siteverify protocol shared by hCaptcha,
+//     reCAPTCHA and Turnstile (form secret/response/remoteip, JSON "success").
+// Logging in through /api/register is never gated.
+
+const (
+	DefaultCodeUses = 1
+	MaxCodeUses     = 1000
+	DefaultCodeTTL  = 7 * 24 * time.Hour
+	RegistrationDay = 24 * time.Hour
+)
+
+type CaptchaVerifier interface {
+	Verify(token, remoteIP string) error
+}
+
+type siteVerifyCaptcha struct {
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+func (c siteVerifyCaptcha) Verify(token, remoteIP string) error {
+	resp, err := c.Client.PostForm(c.URL, url.Values{"secret": {c.Secret}, "response": {token}, "remoteip": {remoteIP}})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var out struct {
+		Success bool     `json:"success"`
+		Errors  []string `json:"error-codes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return err
+	}
+	if !out.Success {
+		return fmt.Errorf("captcha rejected: %s", strings.Join(out.Errors, ", "))
+	}
+	return nil
+}
+
+// nil = no captcha
+var captcha CaptchaVerifier
+
+func captchaFromEnv() CaptchaVerifier {
+	u := os.Getenv("OWNWORLD_CAPTCHA_URL")
+	if u == "" {
+		return nil
+	}
+	return siteVerifyCaptcha{URL: u, Secret: os.Getenv("OWNWORLD_CAPTCHA_SECRET"), Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+type RegistrationCode struct {
+	Code      string `json:"code"`
+	UsesLeft  int    `json:"uses_left"`
+	ExpiresAt int64  `json:"expires_at"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// Takes one use of a code; refundRegistrationCode gives it back if the account isn't created
+func claimRegistrationCode(code string) bool {
+	res, err := db.Exec("UPDATE registration_codes SET uses_left = uses_left - 1 WHERE code=? AND uses_left > 0 AND expires_at > ?",
+		code, time.Now().Unix())
+	if err != nil {
+		return false
+	}
+	n, _ := res.RowsAffected()
+	return n > 0
+}
+
+func refundRegistrationCode(code string) {
+	db.Exec("UPDATE registration_codes SET uses_left = uses_left + 1 WHERE code=?", code)
+}
+
+func registrationsFrom(ip string) int {
+	var n int
+	db.QueryRow("SELECT count(*) FROM registrations WHERE ip=? AND created_at > ?", ip, time.Now().Add(-RegistrationDay).Unix()).Scan(&n)
+	return n
+}
+
+func recordRegistration(ip string) {
+	now := time.Now()
+	db.Exec("DELETE FROM registrations WHERE created_at <= ?", now.Add(-RegistrationDay).Unix())
+	db.Exec("INSERT INTO registrations (ip, created_at) VALUES (?, ?)", ip, now.Unix())
+}
+
+// Runs the configured gates for a new account. On success the caller must create the account or
+// hand back the claimed code (returned, "" if none).
+func checkRegistration(w http.ResponseWriter, r *http.Request, code, captchaToken string) (claimed string, ok bool) {
+	ip := observedHost(r)
+	if Config.RegistrationsPerIP > 0 && registrationsFrom(ip) >= Config.RegistrationsPerIP {
+		http.Error(w, "Registration Limit Reached for this Address", 429)
+		return "", false
+	}
+	if captcha != nil {
+		if captchaToken == "" {
+			http.Error(w, "Captcha Required", 400)
+			return "", false
+		}
+		if err := captcha.Verify(captchaToken, ip); err != nil {
+			InfoLog.Printf("Captcha failed for %s: %v", ip, err)
+			http.Error(w, "Captcha Failed", 403)
+			return "", false
+		}
+	}
+	if Config.RegistrationInvite {
+		if code == "" {
+			http.Error(w, "Invite Code Required", 403)
+			return "", false
+		}
+		if !claimRegistrationCode(code) {
+			http.Error(w, "Invalid or Used Invite Code", 403)
+			return "", false
+		}
+		return code, true
+	}
+	return "", true
+}
+
+// GET lists live codes; POST {"uses", "ttl_hours"} mints one, {"code", "revoke": true} deletes it
+func handleAdminRegistrationCodes(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	if !authenticateAdmin(r) {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == "GET" {
+		rows, err := db.Query("SELECT code, uses_left, expires_at, created_at FROM registration_codes WHERE uses_left > 0 AND expires_at > ? ORDER BY created_at DESC",
+			time.Now().Unix())
+		if err != nil {
+			http.Error(w, "DB Error", 500)
+			return
+		}
+		defer rows.Close()
+		codes := []RegistrationCode{}
+		for rows.Next() {
+			var c RegistrationCode
+			rows.Scan(&c.Code, &c.UsesLeft, &c.ExpiresAt, &c.CreatedAt)
+			codes = append(codes, c)
+		}
+		json.NewEncoder(w).Encode(codes)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "Method Not Allowed", 405)
+		return
+	}
+
+	var req struct {
+		Uses     int    `json:"uses"`
+		TTLHours int    `json:"ttl_hours"`
+		Code     string `json:"code"`
+		Revoke   bool   `json:"revoke"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Revoke {
+		res, _ := db.Exec("DELETE FROM registration_codes WHERE code=?", req.Code)
+		if n, _ := res.RowsAffected(); n == 0 {
+			http.Error(w, "Code Not Found", 404)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"status": "revoked"})
+		return
+	}
+
+	if req.Uses == 0 {
+		req.Uses = DefaultCodeUses
+	}
+	if req.Uses < 0 || req.Uses > MaxCodeUses {
+		http.Error(w, fmt.Sprintf("Uses must be 1-%d", MaxCodeUses), 400)
+		return
+	}
+	ttl := DefaultCodeTTL
+	if req.TTLHours < 0 {
+		http.Error(w, "Invalid TTL", 400)
+		return
+	}
+	if req.TTLHours > 0 {
+		ttl = time.Duration(req.TTLHours) * time.Hour
+	}
+
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	now := time.Now()
+	c := RegistrationCode{Code: hex.EncodeToString(buf), UsesLeft: req.Uses, ExpiresAt: now.Add(ttl).Unix(), CreatedAt: now.Unix()}
+	if _, err := db.Exec("INSERT INTO registration_codes (code, uses_left, expires_at, created_at) VALUES (?, ?, ?, ?)",
+		c.Code, c.UsesLeft, c.ExpiresAt, c.CreatedAt); err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+	json.NewEncoder(w).Encode(c)
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// --- Node Reparations ---
+// Grievances between nodes are numbered by the node that files them (filed_grievances) and
+// recorded by the node they're filed against (owed_grievances). The offender's operator pays
+// from its treasury with POST /admin/grievances/settle: the payment goes out to the victim node
+// as a ReparationReceipt signed by the offender. The victim checks it against its own record,
+// credits its treasury with what is newly paid, countersigns the receipt and broadcasts it. Every
+// node that holds the grievance (peer_grievances, see processGrievance) then gives back the
+// offender the share of the penalty the payment covers. Receipts carry the running total paid,
+// so a replayed or stale receipt adds nothing.
+
+var (
+	errNothingOwed          = fmt.Errorf("grievance already settled")
+	errInsufficientTreasury = fmt.Errorf("insufficient treasury")
+)
+
+// Numbers a grievance against another node and returns the report to broadcast
+func fileGrievance(offender string, damage int, proof, defending string) ([]byte, error) {
+	res, err := db.Exec("INSERT INTO filed_grievances (offender_node, damage, defending, tick) VALUES (?, ?, ?, ?)",
+		offender, damage, defending, atomic.LoadInt64(&CurrentTick))
+	if err != nil {
+		return nil, err
+	}
+	id, _ := res.LastInsertId()
+	return json.Marshal(GrievanceReport{ID: int(id), OffenderUUID: offender, Damage: damage, Proof: proof, Defending: defending})
+}
+
+// Remembers a numbered grievance another node filed against us, so it can be paid off
+func recordOwedGrievance(g *GrievanceReport, reporterID string) {
+	if g.ID <= 0 || g.Damage <= 0 {
+		return
+	}
+	db.Exec("INSERT OR IGNORE INTO owed_grievances (victim_node, grievance_id, damage, tick) VALUES (?, ?, ?, ?)",
+		reporterID, g.ID, g.Damage, atomic.LoadInt64(&CurrentTick))
+	InfoLog.Printf("📜 %s filed grievance %d against this node (%d damage)", reporterID, g.ID, g.Damage)
+}
+
+// Pays up to amount from the treasury towards a grievance filed against us and sends the victim
+// node a receipt signed by this node. Returns the receipt.
+func settleNodeGrievance(victim string, grievanceID, amount int) (*ReparationReceipt, error) {
+	var damage, paid int
+	if err := db.QueryRow("SELECT damage, paid FROM owed_grievances WHERE victim_node=? AND grievance_id=?", victim, grievanceID).
+		Scan(&damage, &paid); err != nil {
+		return nil, err
+	}
+	owed := damage * ReparationCreditsPerDamage
+	if owed-paid <= 0 {
+		return nil, errNothingOwed
+	}
+	if amount > owed-paid {
+		amount = owed - paid
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec("UPDATE users SET credits = credits - ? WHERE global_uuid=? AND credits >= ?", amount, ServerUUID, amount)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, errInsufficientTreasury
+	}
+	if _, err := tx.Exec("UPDATE owed_grievances SET paid = paid + ? WHERE victim_node=? AND grievance_id=?", amount, victim, grievanceID); err != nil {
+		return nil, err
+	}
+
+	rc := &ReparationReceipt{GrievanceID: grievanceID, OffenderNode: ServerUUID, VictimNode: victim, Paid: paid + amount}
+	rc.OffenderSig = hex.EncodeToString(SignMessage(PrivateKey, rc.signingString()))
+	payload, _ := json.Marshal(rc)
+	if !enqueueTransactionTo(tx, victim, payload) {
+		return nil, fmt.Errorf("unknown victim node")
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	kickOutbox()
+	InfoLog.Printf("💸 Paid %d credits towards grievance %d from %s (%d of %d)", amount, grievanceID, victim, rc.Paid, owed)
+	return rc, nil
+}
+
+// A hostile offender is exactly the one paying its way back, so its key is checked whatever
+// our relation to it (nodeSignatureValid refuses hostile nodes)
+func offenderSignatureValid(rc *ReparationReceipt) bool {
+	peerLock.RLock()
+	offender, known := Peers[rc.OffenderNode]
+	var key ed25519.PublicKey
+	if known {
+		key = offender.PublicKey
+	}
+	peerLock.RUnlock()
+	sig, err := hex.DecodeString(rc.OffenderSig)
+	return known && err == nil && VerifySignature(key, rc.signingString(), sig)
+}
+
+// A receipt for one of our own grievances, signed by the offender: credit what is newly paid,
+// countersign and tell everyone. Returns the countersigned receipt, or nil if there's nothing new.
+func countersignReparation(rc *ReparationReceipt, senderID string) *ReparationReceipt {
+	if senderID != rc.OffenderNode || rc.Paid <= 0 {
+		return nil
+	}
+	if !offenderSignatureValid(rc) {
+		InfoLog.Printf("Ignoring unsigned reparation receipt from %s", senderID)
+		return nil
+	}
+
+	var damage, paid int
+	if db.QueryRow("SELECT damage, paid FROM filed_grievances WHERE id=? AND offender_node=?", rc.GrievanceID, rc.OffenderNode).
+		Scan(&damage, &paid) != nil {
+		return nil
+	}
+	total := rc.Paid
+	if owed := damage * ReparationCreditsPerDamage; total > owed {
+		total = owed
+	}
+	if total <= paid {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec("UPDATE filed_grievances SET paid=? WHERE id=? AND paid=?", total, rc.GrievanceID, paid)
+	if err != nil {
+		return nil
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+	if _, err := tx.Exec(`INSERT INTO users (global_uuid, username, credits) VALUES (?, ?, ?)
+	                      ON CONFLICT(global_uuid) DO UPDATE SET credits = credits + excluded.credits`, ServerUUID, TreasuryName, total-paid); err != nil {
+		return nil
+	}
+	if tx.Commit() != nil {
+		return nil
+	}
+
+	// Signed over the offender's total as it stands; other nodes cap it at what is owed too
+	signed := *rc
+	signed.VictimSig = hex.EncodeToString(SignMessage(PrivateKey, signed.signingString()))
+	InfoLog.Printf("🤝 %s paid %d credits towards grievance %d (%d in total)", rc.OffenderNode, total-paid, rc.GrievanceID, total)
+	return &signed
+}
+
+// GET: grievances this node filed and those filed against it.
+// POST {"offender_node", "damage", "proof"}: file one against a peer and broadcast it.
+func handleAdminGrievances(w http.ResponseWriter, r *http.Request) {
+	if !authenticateAdmin(r) {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var req struct {
+			OffenderNode string `json:"offender_node" validate:"required"`
+			Damage       int    `json:"damage" validate:"required"`
+			Proof        string `json:"proof"`
+		}
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		peerLock.RLock()
+		_, known := Peers[req.OffenderNode]
+		peerLock.RUnlock()
+		if !known || req.Damage <= 0 {
+			http.Error(w, "Unknown Node or Invalid Damage", 400)
+			return
+		}
+		report, err := fileGrievance(req.OffenderNode, req.Damage, req.Proof, "")
+		if err != nil {
+			http.Error(w, "DB Error", 500)
+			return
+		}
+		broadcastTransaction(report)
+		InfoLog.Printf("📜 Filed a grievance against %s (%d damage)", req.OffenderNode, req.Damage)
+	}
+
+	type grievanceRow struct {
+		ID     int    `json:"grievance_id"`
+		Node   string `json:"node"`
+		Damage int    `json:"damage"`
+		Owed   int    `json:"owed"`
+		Paid   int    `json:"paid"`
+	}
+	list := func(query string) []grievanceRow {
+		out := []grievanceRow{}
+		rows, err := db.Query(query)
+		if err != nil {
+			return out
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var g grievanceRow
+			rows.Scan(&g.ID, &g.Node, &g.Damage, &g.Paid)
+			g.Owed = g.Damage * ReparationCreditsPerDamage
+			out = append(out, g)
+		}
+		return out
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"filed":    list("SELECT id, offender_node, damage, paid FROM filed_grievances ORDER BY id DESC LIMIT 100"),
+		"against":  list("SELECT grievance_id, victim_node, damage, paid FROM owed_grievances ORDER BY tick DESC LIMIT 100"),
+		"treasury": treasuryBalance(),
+	})
+}
+
+// POST {"victim_node", "grievance_id", "amount"}: pay reparations from the treasury
+func handleAdminSettleGrievance(w http.ResponseWriter, r *http.Request) {
+	if !authenticateAdmin(r) {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+	var req struct {
+		VictimNode  string `json:"victim_node" validate:"required"`
+		GrievanceID int    `json:"grievance_id" validate:"required"`
+		Amount      int    `json:"amount" validate:"required"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Amount <= 0 {
+		http.Error(w, "Invalid Amount", 400)
+		return
+	}
+
+	rc, err := settleNodeGrievance(req.VictimNode, req.GrievanceID, req.Amount)
+	switch {
+	case err == errNothingOwed:
+		http.Error(w, "Grievance Already Settled", 409)
+		return
+	case err == errInsufficientTreasury:
+		http.Error(w, "Insufficient Treasury", 402)
+		return
+	case err != nil:
+		http.Error(w, "Grievance Not Found", 404)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rc)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Reputation Dynamics ---
+// Grievances cost a peer reputation immediately, but the penalty is also remembered as a
+// grudge that is forgiven a fraction at a time every heartbeat round, so old grievances fade
+// instead of counting forever. Clean heartbeats earn reputation, and a growing streak of them
+// (reset by any grievance) earns it faster. Falling below the hostile line is still a cliff:
+// hostile peers neither heal nor earn. Override the model with OWNWORLD_REPUTATION, e.g.
+// "gain=0.1,forgive=0.01,streak=100,max_mult=5,hostile=-50".
+
+const (
+	MaxReputation        = 100.0
+	MaxReputationHistory = 200 // rows kept per peer
+	ReputationSampleStep = 1.0 // drift that earns a history row at a flush
+)
+
+type ReputationModel struct {
+	Gain         float64 // reputation per clean heartbeat
+	Forgive      float64 // share of a grudge forgiven per heartbeat round
+	StreakRounds int     // clean heartbeats per extra multiple of Gain
+	MaxMult      float64 // cap on the streak multiplier
+	HostileBelow float64
+}
+
+var RepModel = ReputationModel{Gain: 0.1, Forgive: 0.01, StreakRounds: 100, MaxMult: 5, HostileBelow: -50}
+
+type ReputationPoint struct {
+	At         int64   `json:"at"`
+	Reputation float64 `json:"reputation"`
+	Grudge     float64 `json:"grudge"`
+	Reason     string  `json:"reason"`
+}
+
+// Applies OWNWORLD_REPUTATION overrides; unknown keys and bad numbers are ignored
+func loadReputationModel() {
+	spec := os.Getenv("OWNWORLD_REPUTATION")
+	if spec == "" {
+		return
+	}
+	for _, kv := range strings.Split(spec, ",") {
+		parts := strings.SplitN(strings.TrimSpace(kv), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		v, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			continue
+		}
+		switch parts[0] {
+		case "gain":
+			if v >= 0 && v <= 10 {
+				RepModel.Gain = v
+			}
+		case "forgive":
+			if v >= 0 && v <= 1 {
+				RepModel.Forgive = v
+			}
+		case "streak":
+			if v >= 1 {
+				RepModel.StreakRounds = int(v)
+			}
+		case "max_mult":
+			if v >= 1 {
+				RepModel.MaxMult = v
+			}
+		case "hostile":
+			if v < 0 && v > -MaxReputation {
+				RepModel.HostileBelow = v
+			}
+		}
+	}
+}
+
+// Reputation a clean heartbeat earns after streak clean heartbeats in a row
+func heartbeatGain(streak int) float64 {
+	mult := 1 + float64(streak)/float64(RepModel.StreakRounds)
+	if mult > RepModel.MaxMult {
+		mult = RepModel.MaxMult
+	}
+	return RepModel.Gain * mult
+}
+
+// Caller holds peerLock
+func creditHeartbeat(p *Peer) {
+	if p.Relation == 2 {
+		return
+	}
+	p.CleanStreak++
+	p.Reputation = math.Min(MaxReputation, p.Reputation+heartbeatGain(p.CleanStreak))
+}
+
+// Caller holds peerLock. Returns true if this pushed the peer over the hostile line.
+func penalizePeer(p *Peer, impact float64, reason string) bool {
+	p.Reputation -= impact
+	p.Grudge += impact
+	p.CleanStreak = 0
+	recordReputation(p, reason)
+	return p.Relation != 2 && p.Reputation < RepModel.HostileBelow
+}
+
+// Caller holds peerLock. Reparations pay the grudge down first.
+func restorePeer(p *Peer, amount float64, reason string) {
+	p.Reputation = math.Min(MaxReputation, p.Reputation+amount)
+	p.Grudge = math.Max(0, p.Grudge-amount)
+	recordReputation(p, reason)
+}
+
+// One heartbeat round of forgiveness for every peer still holding a grudge
+func forgiveGrievances() {
+	peerLock.Lock()
+	defer peerLock.Unlock()
+	for _, p := range Peers {
+		if p.Grudge <= 0 || p.Relation == 2 {
+			continue
+		}
+		f := p.Grudge * RepModel.Forgive
+		if p.Grudge < 0.01 {
+			f = p.Grudge
+		}
+		p.Grudge -= f
+		p.Reputation = math.Min(MaxReputation, p.Reputation+f)
+	}
+}
+
+func recordReputation(p *Peer, reason string) {
+	p.recordedRep = p.Reputation
+	db.Exec("INSERT INTO peer_reputation (peer_uuid, at, reputation, grudge, reason) VALUES (?, ?, ?, ?, ?)",
+		p.UUID, time.Now().Unix(), p.Reputation, p.Grudge, reason)
+	db.Exec(`DELETE FROM peer_reputation WHERE peer_uuid=? AND rowid NOT IN
+	         (SELECT rowid FROM peer_reputation WHERE peer_uuid=? ORDER BY rowid DESC LIMIT ?)`,
+		p.UUID, p.UUID, MaxReputationHistory)
+}
+
+// Samples peers whose reputation drifted since their last history row; run at each flush
+func sampleReputation() {
+	peerLock.Lock()
+	defer peerLock.Unlock()
+	for _, p := range Peers {
+		if math.Abs(p.Reputation-p.recordedRep) >= ReputationSampleStep {
+			recordReputation(p, "drift")
+		}
+	}
+}
+
+func reputationHistory(uuid string) []ReputationPoint {
+	history := []ReputationPoint{}
+	rows, err := db.Query(`SELECT at, reputation, grudge, reason FROM peer_reputation
+	                       WHERE peer_uuid=? ORDER BY rowid DESC LIMIT ?`, uuid, MaxReputationHistory)
+	if err != nil {
+		return history
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var h ReputationPoint
+		rows.Scan(&h.At, &h.Reputation, &h.Grudge, &h.Reason)
+		history = append(history, h)
+	}
+	return history
+}
+
+// GET ?uuid=: a peer's current standing and its history, newest first
+func handlePeerReputation(w http.ResponseWriter, r *http.Request) {
+	uuid := r.URL.Query().Get("uuid")
+	if uuid == "" {
+		http.Error(w, "Missing 'uuid' param", 400)
+		return
+	}
+
+	peerLock.RLock()
+	p, known := Peers[uuid]
+	var current Peer
+	if known {
+		current = *p
+	}
+	peerLock.RUnlock()
+	if !known {
+		stored, ok := storedPeer(uuid)
+		if !ok {
+			http.Error(w, "Peer Not Found", 404)
+			return
+		}
+		current = *stored
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"uuid":         uuid,
+		"relation":     current.Relation,
+		"reputation":   current.Reputation,
+		"grudge":       current.Grudge,
+		"clean_streak": current.CleanStreak,
+		"history":      reputationHistory(uuid),
+	})
+}
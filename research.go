@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync/atomic"
+)
+
+// --- Research ---
+// Each staffed rd_lab adds ResearchPerLab points a tick to its owner's pool (users.research_points);
+// a lab needs RDLabStaff specialists, so labs beyond what the colony can staff sit idle.
+// Points are spent on the technologies in TechTree, each once its prerequisites are researched;
+// what has been researched is kept per user in the technologies table. Technologies gate hulls and
+// modules (the Tech on their Unlock, see unlocks.go) and buildings (BuildingTechs) on top of any
+// building requirement. GET /api/research shows the pool and the tree; POST {"tech"} researches.
+
+const (
+	ResearchPerLab = 1
+	RDLabStaff     = 10 // specialists per working lab
+)
+
+type Technology struct {
+	Name     string   `json:"name"`
+	Cost     int      `json:"cost"`
+	Requires []string `json:"requires,omitempty"`
+}
+
+var TechTree = map[string]Technology{
+	"ballistics":      {Name: "Ballistics", Cost: 100},
+	"ftl_theory":      {Name: "FTL Theory", Cost: 200},
+	"nuclear_fission": {Name: "Nuclear Fission", Cost: 300},
+	"heavy_ordnance":  {Name: "Heavy Ordnance", Cost: 400, Requires: []string{"ballistics"}},
+	"terraforming":    {Name: "Terraforming", Cost: 500, Requires: []string{"nuclear_fission"}},
+	"gravitics":       {Name: "Gravitics", Cost: 600, Requires: []string{"ftl_theory"}},
+}
+
+// Buildings that need a technology before they can be built
+var BuildingTechs = map[string]string{
+	"fission_reactor": "nuclear_fission",
+	"breeder_reactor": "nuclear_fission",
+	"terraformer":     "terraforming",
+}
+
+// Points a colony's labs produce in a tick
+func colonyResearch(c *Colony) int {
+	labs := c.Buildings["rd_lab"]
+	if staffed := c.PopSpecialists / RDLabStaff; staffed < labs {
+		labs = staffed
+	}
+	return labs * ResearchPerLab
+}
+
+// Technologies the user has researched
+func userTechs(userID string) map[string]bool {
+	techs := make(map[string]bool)
+	rows, err := db.Query("SELECT tech FROM technologies WHERE user_uuid=?", userID)
+	if err != nil {
+		return techs
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t string
+		rows.Scan(&t)
+		techs[t] = true
+	}
+	return techs
+}
+
+func techName(id string) string {
+	if t, ok := TechTree[id]; ok {
+		return t.Name
+	}
+	return id
+}
+
+// Hulls, modules and buildings a technology opens up
+func techUnlocks(id string) []string {
+	var out []string
+	for name, u := range HullUnlocks {
+		if u.Tech == id {
+			out = append(out, name)
+		}
+	}
+	for name, u := range ModuleUnlocks {
+		if u.Tech == id {
+			out = append(out, name)
+		}
+	}
+	for name, t := range BuildingTechs {
+		if t == id {
+			out = append(out, name)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+type TechStatus struct {
+	ID string `json:"id"`
+	Technology
+	Unlocks        []string `json:"unlocks"`
+	Researched     bool     `json:"researched"`
+	ResearchedTick int64    `json:"researched_tick,omitempty"`
+	Available      bool     `json:"available"` // prerequisites met, not yet researched
+}
+
+type ResearchState struct {
+	Points       int          `json:"points"`
+	PerTick      int          `json:"per_tick"`
+	Technologies []TechStatus `json:"technologies"`
+}
+
+func researchState(userID string) ResearchState {
+	var st ResearchState
+	db.QueryRow("SELECT COALESCE(research_points, 0) FROM users WHERE global_uuid=?", userID).Scan(&st.Points)
+
+	if rows, err := db.Query("SELECT buildings_json, pop_specialists FROM colonies WHERE owner_uuid=?", userID); err == nil {
+		for rows.Next() {
+			var c Colony
+			var bJson string
+			rows.Scan(&bJson, &c.PopSpecialists)
+			json.Unmarshal([]byte(bJson), &c.Buildings)
+			st.PerTick += colonyResearch(&c)
+		}
+		rows.Close()
+	}
+
+	researched := make(map[string]int64)
+	if rows, err := db.Query("SELECT tech, researched_tick FROM technologies WHERE user_uuid=?", userID); err == nil {
+		for rows.Next() {
+			var t string
+			var tick int64
+			rows.Scan(&t, &tick)
+			researched[t] = tick
+		}
+		rows.Close()
+	}
+
+	st.Technologies = make([]TechStatus, 0, len(TechTree))
+	for id, t := range TechTree {
+		s := TechStatus{ID: id, Technology: t, Unlocks: techUnlocks(id)}
+		s.ResearchedTick, s.Researched = researched[id]
+		s.Available = !s.Researched
+		for _, req := range t.Requires {
+			if _, ok := researched[req]; !ok {
+				s.Available = false
+			}
+		}
+		st.Technologies = append(st.Technologies, s)
+	}
+	sort.Slice(st.Technologies, func(i, j int) bool {
+		a, b := st.Technologies[i], st.Technologies[j]
+		if a.Cost != b.Cost {
+			return a.Cost < b.Cost
+		}
+		return a.ID < b.ID
+	})
+	return st
+}
+
+// GET: research points and the technology tree. POST {"tech"}: researches a technology whose
+// prerequisites are met, paying its cost from the pool, and returns the new state.
+func handleResearch(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	if r.Method == "GET" {
+		userID, err := authenticate(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", 401)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(researchState(userID))
+		return
+	}
+
+	var req struct {
+		Tech string `json:"tech" validate:"required"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	tech, ok := TechTree[req.Tech]
+	if !ok {
+		http.Error(w, "Unknown Technology", 404)
+		return
+	}
+
+	defer lockRows(userRow(userID))()
+
+	known := userTechs(userID)
+	if known[req.Tech] {
+		http.Error(w, "Already Researched", 409)
+		return
+	}
+	for _, need := range tech.Requires {
+		if !known[need] {
+			http.Error(w, fmt.Sprintf("Requires %s", techName(need)), 400)
+			return
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec("UPDATE users SET research_points = research_points - ? WHERE global_uuid=? AND research_points >= ?", tech.Cost, userID, tech.Cost)
+	if err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, fmt.Sprintf("Insufficient Research Points (need %d)", tech.Cost), 402)
+		return
+	}
+	if _, err := tx.Exec("INSERT INTO technologies (user_uuid, tech, researched_tick) VALUES (?, ?, ?)",
+		userID, req.Tech, atomic.LoadInt64(&CurrentTick)); err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(researchState(userID))
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// --- Federation Roster ---
+// The peers table remembers each node's current standing; peer_membership remembers how it got
+// there. A row is written when a node is admitted (or comes back after being pruned), when its
+// relation changes, and when it is pruned for silence. The admission row also says who vouched
+// for the node: this node, through a signed invite or the operator approving it from the
+// immigration queue, or nobody when the door was open and a matching genesis was enough.
+// GET /federation/roster lists every node we have ever admitted with that history, oldest
+// first, for signed peers (not hostile ones) or the operator's admin key. Nodes admitted before
+// the roster existed have no admission row; their join date is the registry's first sighting.
+
+const MaxMembershipHistory = 100 // rows kept per peer
+
+const (
+	MembershipJoined   = "joined"
+	MembershipRejoined = "rejoined"
+	MembershipRelation = "relation"
+	MembershipPruned   = "pruned"
+
+	VouchInvite   = "invite"
+	VouchOperator = "operator"
+	VouchOpen     = "open"
+)
+
+type MembershipEvent struct {
+	At        int64  `json:"at"`
+	Event     string `json:"event"`
+	Detail    string `json:"detail,omitempty"`
+	Via       string `json:"via,omitempty"` // admissions: invite, operator or open
+	VouchedBy string `json:"vouched_by,omitempty"`
+}
+
+type RosterEntry struct {
+	UUID        string            `json:"uuid"`
+	Url         string            `json:"url"`
+	GenesisHash string            `json:"genesis_hash"`
+	Relation    string            `json:"relation"`
+	Reputation  float64           `json:"reputation"`
+	Status      string            `json:"status"` // online while in the working set, else offline
+	JoinedAt    int64             `json:"joined_at"`
+	LastSeen    int64             `json:"last_seen"`
+	Via         string            `json:"via,omitempty"`
+	VouchedBy   string            `json:"vouched_by,omitempty"`
+	History     []MembershipEvent `json:"history"`
+}
+
+func recordMembership(uuid string, e MembershipEvent) {
+	db.Exec("INSERT INTO peer_membership (peer_uuid, at, event, detail, via, vouched_by) VALUES (?, ?, ?, ?, ?, ?)",
+		uuid, time.Now().Unix(), e.Event, e.Detail, e.Via, e.VouchedBy)
+	// The first admission is kept for good: it holds the join date and the sponsor
+	db.Exec(`DELETE FROM peer_membership WHERE peer_uuid=? AND event != 'joined' AND rowid NOT IN
+	         (SELECT rowid FROM peer_membership WHERE peer_uuid=? ORDER BY rowid DESC LIMIT ?)`,
+		uuid, uuid, MaxMembershipHistory)
+}
+
+// How a joiner got in, and who answers for it
+func sponsorOf(req HandshakeRequest) (via, vouchedBy, detail string) {
+	if req.InviteToken != "" {
+		if claims, err := parseInvite(req.InviteToken); err == nil {
+			return VouchInvite, claims.Issuer, "invite " + claims.ID
+		}
+	}
+	var priority int
+	db.QueryRow("SELECT priority FROM immigration_queue WHERE uuid=?", req.UUID).Scan(&priority)
+	if priority >= ImmigrationInvited {
+		return VouchOperator, ServerUUID, "approved by operator"
+	}
+	return VouchOpen, "", "open admission"
+}
+
+// Called by admitPeer before the peer is saved, so a stored row means it has been here before
+func recordAdmission(req HandshakeRequest) {
+	via, vouchedBy, detail := sponsorOf(req)
+	event := MembershipJoined
+	var known int
+	db.QueryRow("SELECT count(*) FROM peers WHERE uuid=?", req.UUID).Scan(&known)
+	if known > 0 {
+		event = MembershipRejoined
+	}
+	recordMembership(req.UUID, MembershipEvent{Event: event, Detail: detail, Via: via, VouchedBy: vouchedBy})
+}
+
+// Called by savePeer before it writes, to catch relation changes wherever they come from
+func recordRelationChange(p *Peer) {
+	var stored int
+	if db.QueryRow("SELECT relation FROM peers WHERE uuid=?", p.UUID).Scan(&stored) != nil || stored == p.Relation {
+		return
+	}
+	recordMembership(p.UUID, MembershipEvent{Event: MembershipRelation, Detail: relationLabels[stored] + " -> " + relationLabels[p.Relation]})
+}
+
+func membershipHistory(uuid string) []MembershipEvent {
+	history := []MembershipEvent{}
+	rows, err := db.Query("SELECT at, event, detail, via, vouched_by FROM peer_membership WHERE peer_uuid=? ORDER BY rowid", uuid)
+	if err != nil {
+		return history
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e MembershipEvent
+		rows.Scan(&e.At, &e.Event, &e.Detail, &e.Via, &e.VouchedBy)
+		history = append(history, e)
+	}
+	return history
+}
+
+// Every node in the registry, oldest member first
+func buildRoster() ([]RosterEntry, error) {
+	rows, err := db.Query("SELECT " + peerColumns + " FROM peers")
+	if err != nil {
+		return nil, err
+	}
+	var stored []*Peer
+	for rows.Next() {
+		if p, err := scanPeer(rows.Scan); err == nil {
+			stored = append(stored, p)
+		}
+	}
+	rows.Close()
+
+	peerLock.RLock()
+	online := make(map[string]Peer, len(Peers))
+	for id, p := range Peers {
+		online[id] = *p
+	}
+	peerLock.RUnlock()
+
+	roster := make([]RosterEntry, 0, len(stored))
+	for _, p := range stored {
+		e := RosterEntry{
+			UUID: p.UUID, Url: p.Url, GenesisHash: p.GenesisHash, Relation: relationLabels[p.Relation], Reputation: p.Reputation,
+			Status: "offline", JoinedAt: p.FirstSeen.Unix(), LastSeen: p.LastSeen.Unix(), History: membershipHistory(p.UUID),
+		}
+		// The working set is fresher than the last flush
+		if live, ok := online[p.UUID]; ok {
+			e.Status, e.Relation, e.Reputation, e.LastSeen = "online", relationLabels[live.Relation], live.Reputation, live.LastSeen.Unix()
+		}
+		for _, h := range e.History {
+			if h.Event == MembershipJoined {
+				e.JoinedAt, e.Via, e.VouchedBy = h.At, h.Via, h.VouchedBy
+				break
+			}
+		}
+		roster = append(roster, e)
+	}
+	sort.Slice(roster, func(i, j int) bool {
+		if roster[i].JoinedAt != roster[j].JoinedAt {
+			return roster[i].JoinedAt < roster[j].JoinedAt
+		}
+		return roster[i].UUID < roster[j].UUID
+	})
+	return roster, nil
+}
+
+// GET returns {"node", "genesis_hash", "members"}
+func handleFederationRoster(w http.ResponseWriter, r *http.Request) {
+	if sender := r.Header.Get(HeaderFedNode); sender != "" {
+		peerLock.RLock()
+		peer, known := Peers[sender]
+		hostile := known && peer.Relation == 2
+		peerLock.RUnlock()
+		if hostile {
+			http.Error(w, "Forbidden", 403)
+			return
+		}
+	}
+
+	roster, err := buildRoster()
+	if err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"node": ServerUUID, "genesis_hash": GenesisHash, "members": roster,
+	})
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Scan Proofs ---
+// Scanning a system held by a node (ours or a peer's) returns a proof alongside the sector
+// data: the owning node's signature over the system's colony state as it stands in that node's
+// latest published daily snapshot. StateHash is BLAKE3 over the JSON of those colonies, taken
+// from the snapshot blob in blob order, so anyone holding the snapshot (GET /federation/sync)
+// can check the hash against the snapshot's final hash and recompute the state hash instead of
+// trusting the scan. Peers serve their proofs from GET /federation/proof?system_id=.
+
+const ScanProofTimeout = 3 * time.Second
+
+type ScanProof struct {
+	SystemID     string `json:"system_id"`
+	NodeUUID     string `json:"node_uuid"`
+	SnapshotDay  int    `json:"snapshot_day"`
+	SnapshotHash string `json:"snapshot_hash"` // final hash of that day's snapshot
+	ColonyIDs    []int  `json:"colony_ids"`
+	StateHash    string `json:"state_hash"`
+	Signature    string `json:"signature"` // ed25519 by NodeUUID's key over signingString
+}
+
+func (p *ScanProof) signingString() []byte {
+	ids := make([]string, len(p.ColonyIDs))
+	for i, id := range p.ColonyIDs {
+		ids[i] = strconv.Itoa(id)
+	}
+	return []byte(fmt.Sprintf("ownworld-scan:%s:%s:%d:%s:%s:%s",
+		p.SystemID, p.NodeUUID, p.SnapshotDay, p.SnapshotHash, strings.Join(ids, ","), p.StateHash))
+}
+
+// Hash of a system's colonies as they appear in a snapshot blob
+func snapshotStateHash(colonies []Colony) string {
+	if colonies == nil {
+		colonies = []Colony{}
+	}
+	data, _ := json.Marshal(colonies)
+	return hashBLAKE3(data)
+}
+
+// Signs the state of one of our systems as of our latest snapshot
+func buildScanProof(sysID string) (*ScanProof, error) {
+	var day int
+	var blob []byte
+	var hash string
+	if err := db.QueryRow("SELECT day_id, state_blob, final_hash FROM daily_snapshots ORDER BY day_id DESC LIMIT 1").Scan(&day, &blob, &hash); err != nil {
+		return nil, fmt.Errorf("no snapshot published yet")
+	}
+
+	inSystem := make(map[int]bool)
+	rows, err := db.Query("SELECT id FROM colonies WHERE system_id=?", sysID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id int
+		rows.Scan(&id)
+		inSystem[id] = true
+	}
+	rows.Close()
+
+	var all, state []Colony
+	json.Unmarshal(decompressLZ4(blob), &all)
+	p := &ScanProof{SystemID: sysID, NodeUUID: ServerUUID, SnapshotDay: day, SnapshotHash: hash, ColonyIDs: []int{}}
+	for _, c := range all {
+		if inSystem[c.ID] {
+			state = append(state, c)
+			p.ColonyIDs = append(p.ColonyIDs, c.ID)
+		}
+	}
+	p.StateHash = snapshotStateHash(state)
+	p.Signature = hex.EncodeToString(SignMessage(PrivateKey, p.signingString()))
+	return p, nil
+}
+
+func verifyScanProof(p *ScanProof, nodeUUID, sysID string) bool {
+	if p == nil || p.NodeUUID != nodeUUID || p.SystemID != sysID {
+		return false
+	}
+	sig, err := hex.DecodeString(p.Signature)
+	if err != nil {
+		return false
+	}
+	peerLock.RLock()
+	peer, known := Peers[nodeUUID]
+	peerLock.RUnlock()
+	if !known {
+		return false
+	}
+	return VerifySignature(peer.PublicKey, p.signingString(), sig)
+}
+
+// Asks the owning peer for a proof; nil if it can't or won't give a valid one
+func fetchScanProof(nodeUUID, sysID string) *ScanProof {
+	peerLock.RLock()
+	peer, known := Peers[nodeUUID]
+	var addr string
+	if known {
+		addr = peer.Url
+	}
+	peerLock.RUnlock()
+	if !known {
+		return nil
+	}
+
+	req, err := newFederationRequest("GET", addr+"/federation/proof?system_id="+url.QueryEscape(sysID), nil)
+	if err != nil {
+		return nil
+	}
+	resp, err := (&http.Client{Timeout: ScanProofTimeout}).Do(req)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	var p ScanProof
+	if resp.StatusCode != 200 || json.NewDecoder(resp.Body).Decode(&p) != nil || !verifyScanProof(&p, nodeUUID, sysID) {
+		InfoLog.Printf("⚠️ No valid scan proof for %s from %s", sysID, nodeUUID)
+		return nil
+	}
+	return &p
+}
+
+// Proof for the system at x,y,z when a node owns it
+func scanProofAt(x, y, z int) *ScanProof {
+	s, ok := systemAt(x, y, z)
+	if !ok {
+		return nil
+	}
+	sysID, owner := s.ID, s.Owner
+	if owner == "" {
+		return nil
+	}
+	if owner == ServerUUID {
+		p, _ := buildScanProof(sysID)
+		return p
+	}
+	return fetchScanProof(owner, sysID)
+}
+
+func handleFederationProof(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	sysID := r.URL.Query().Get("system_id")
+	var owner string
+	db.QueryRow("SELECT COALESCE(owner_uuid, '') FROM solar_systems WHERE id=?", sysID).Scan(&owner)
+	if owner != ServerUUID {
+		http.Error(w, "System Not Ours", 404)
+		return
+	}
+	p, err := buildScanProof(sysID)
+	if err != nil {
+		http.Error(w, err.Error(), 503)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// --- Fixtures ---
+// applySeed builds game state through the real schema in one call: users (with live session
+// tokens), systems, colonies, fleets and peers. Tests use it directly; binaries built with
+// -tags testseed also expose it as POST /test/seed (see seed_http.go). Zero values fall back
+// to the column defaults, so fixtures only spell out what a test cares about.
+
+type SeedUser struct {
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	Credits  int      `json:"credits"`
+	Techs    []string `json:"techs"` // already researched
+}
+
+type SeedSystem struct {
+	ID       string `json:"id"` // sys-x-y-z; coordinates are taken from it
+	Owner    string `json:"owner"`
+	StarType string `json:"star_type"`
+}
+
+type SeedColony struct {
+	SystemID  string         `json:"system_id"`
+	Owner     string         `json:"owner"` // username from this seed, or a UUID
+	Name      string         `json:"name"`
+	Laborers  int            `json:"laborers"`
+	Resources map[string]int `json:"resources"` // keys from validResources
+	Buildings map[string]int `json:"buildings"`
+	Modules   map[string]int `json:"module_stock"`
+	SiteType  string         `json:"site_type"` // default planet
+}
+
+type SeedFleet struct {
+	Owner       string       `json:"owner"`
+	Status      string       `json:"status"` // default ORBIT
+	System      string       `json:"system"`
+	Dest        string       `json:"dest"`
+	HullClass   string       `json:"hull_class"`
+	Modules     []string     `json:"modules"`
+	Fuel        int          `json:"fuel"`
+	Payload     FleetPayload `json:"payload"`
+	ArrivalTick int64        `json:"arrival_tick"`
+}
+
+type SeedPeer struct {
+	UUID       string  `json:"uuid"`
+	Url        string  `json:"url"`
+	Relation   int     `json:"relation"`
+	Reputation float64 `json:"reputation"`
+}
+
+type Seed struct {
+	Users    []SeedUser   `json:"users"`
+	Systems  []SeedSystem `json:"systems"`
+	Colonies []SeedColony `json:"colonies"`
+	Fleets   []SeedFleet  `json:"fleets"`
+	Peers    []SeedPeer   `json:"peers"`
+}
+
+type SeedSession struct {
+	UserUUID string `json:"user_uuid"`
+	Token    string `json:"session_token"`
+}
+
+type SeedResult struct {
+	Users    map[string]SeedSession `json:"users"` // by username
+	Colonies []int                  `json:"colonies"`
+	Fleets   []int                  `json:"fleets"`
+	Peers    []string               `json:"peers"`
+}
+
+// Owner references may name a seeded user or be a raw UUID
+func (res *SeedResult) owner(ref string) string {
+	if s, ok := res.Users[ref]; ok {
+		return s.UserUUID
+	}
+	return ref
+}
+
+func seedSystem(id, owner, starType string) error {
+	var x, y, z int
+	fmt.Sscanf(id, "sys-%d-%d-%d", &x, &y, &z)
+	if starType == "" {
+		starType = "G2V"
+	}
+	_, err := db.Exec("INSERT OR IGNORE INTO solar_systems (id, x, y, z, star_type, owner_uuid) VALUES (?, ?, ?, ?, ?, ?)",
+		id, x, y, z, starType, owner)
+	if err == nil {
+		reindexSystem(id)
+	}
+	return err
+}
+
+func applySeed(s Seed) (*SeedResult, error) {
+	res := &SeedResult{Users: make(map[string]SeedSession)}
+
+	for _, u := range s.Users {
+		if u.Password == "" {
+			u.Password = "password"
+		}
+		pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+		uuid := hashBLAKE3(pub)
+		token := generateSessionToken()
+		_, err := db.Exec(`INSERT INTO users (global_uuid, username, password_hash, credits, is_local, ed25519_pubkey, ed25519_priv_enc, session_token, expires_at)
+		                   VALUES (?, ?, ?, ?, 1, ?, ?, ?, ?)`,
+			uuid, u.Username, hashBLAKE3([]byte(u.Password)), u.Credits, hex.EncodeToString(pub), encryptKey(priv, u.Password), token, time.Now().Add(SessionTTL).Unix())
+		if err != nil {
+			return nil, fmt.Errorf("user %s: %v", u.Username, err)
+		}
+		for _, tech := range u.Techs {
+			db.Exec("INSERT INTO technologies (user_uuid, tech, researched_tick) VALUES (?, ?, 0)", uuid, tech)
+		}
+		res.Users[u.Username] = SeedSession{UserUUID: uuid, Token: token}
+	}
+
+	for _, sys := range s.Systems {
+		if err := seedSystem(sys.ID, res.owner(sys.Owner), sys.StarType); err != nil {
+			return nil, fmt.Errorf("system %s: %v", sys.ID, err)
+		}
+	}
+
+	for _, c := range s.Colonies {
+		if err := seedSystem(c.SystemID, "", ""); err != nil {
+			return nil, fmt.Errorf("colony system %s: %v", c.SystemID, err)
+		}
+		if c.Laborers == 0 {
+			c.Laborers = 1000
+		}
+		if c.Buildings == nil {
+			c.Buildings = map[string]int{}
+		}
+		if c.Modules == nil {
+			c.Modules = map[string]int{}
+		}
+		if c.SiteType == "" {
+			c.SiteType = SitePlanet
+		}
+		bJson, _ := json.Marshal(c.Buildings)
+		mJson, _ := json.Marshal(c.Modules)
+		r, err := db.Exec("INSERT INTO colonies (system_id, owner_uuid, name, pop_laborers, buildings_json, module_stock_json, site_type) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			c.SystemID, res.owner(c.Owner), c.Name, c.Laborers, string(bJson), string(mJson), c.SiteType)
+		if err != nil {
+			return nil, fmt.Errorf("colony %s: %v", c.Name, err)
+		}
+		id, _ := r.LastInsertId()
+		for item, amt := range c.Resources {
+			if !validResources[item] {
+				return nil, fmt.Errorf("colony %s: unknown resource %s", c.Name, item)
+			}
+			db.Exec(fmt.Sprintf("UPDATE colonies SET %s=? WHERE id=?", item), amt, id)
+		}
+		res.Colonies = append(res.Colonies, int(id))
+	}
+
+	for _, f := range s.Fleets {
+		if f.Status == "" {
+			f.Status = "ORBIT"
+		}
+		if f.Dest == "" {
+			f.Dest = f.System
+		}
+		if f.HullClass == "" {
+			f.HullClass = "Frigate"
+		}
+		if f.Modules == nil {
+			f.Modules = []string{}
+		}
+		mJson, _ := json.Marshal(f.Modules)
+		pJson, _ := json.Marshal(f.Payload)
+		r, err := db.Exec(`INSERT INTO fleets (owner_uuid, status, origin_system, dest_system, hull_class, modules_json, payload_json, fuel, arrival_tick, home_system)
+		                   VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			res.owner(f.Owner), f.Status, f.System, f.Dest, f.HullClass, string(mJson), string(pJson), f.Fuel, f.ArrivalTick, f.System)
+		if err != nil {
+			return nil, fmt.Errorf("fleet: %v", err)
+		}
+		id, _ := r.LastInsertId()
+		res.Fleets = append(res.Fleets, int(id))
+	}
+
+	for _, sp := range s.Peers {
+		pub, _, _ := ed25519.GenerateKey(rand.Reader)
+		if sp.UUID == "" {
+			sp.UUID = hashBLAKE3(pub)
+		}
+		p := &Peer{
+			UUID: sp.UUID, Url: sp.Url, PublicKey: pub, GenesisHash: GenesisHash,
+			Relation: sp.Relation, Reputation: sp.Reputation,
+			FirstSeen: time.Now(), LastSeen: time.Now(),
+		}
+		savePeer(p)
+		peerLock.Lock()
+		Peers[p.UUID] = p
+		peerLock.Unlock()
+		res.Peers = append(res.Peers, p.UUID)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,39 @@
+//go:build testseed
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// POST /test/seed: applySeed over HTTP for integration harnesses. Only compiled with
+// -tags testseed, and still behind the admin key in case such a binary escapes a test rig.
+
+func init() {
+	extraRoutes = append(extraRoutes, func(mux *http.ServeMux) {
+		mux.HandleFunc("/test/seed", handleTestSeed)
+	})
+}
+
+func handleTestSeed(w http.ResponseWriter, r *http.Request) {
+	if !authenticateAdmin(r) {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+	var s Seed
+	if !decodeJSON(w, r, &s) {
+		return
+	}
+
+	stateLock.Lock()
+	res, err := applySeed(s)
+	stateLock.Unlock()
+	if err != nil {
+		http.Error(w, "Seed Failed: "+err.Error(), 400)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
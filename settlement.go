@@ -0,0 +1,534 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// --- Cross-Node Settlement ---
+// A fleet sent to fill an order gossiped from another node can't trade against a colony this
+// node doesn't hold, so the two nodes settle in two phases over /federation/transaction. The
+// fleet's node coordinates, the order's node participates:
+//
+//  1. On arrival the coordinator takes its side out of the fleet's hold (credits to buy, goods
+//     to sell) into a prepared settlement and drops its copy of the order.
+//  2. The worker sends PREPARE. The participant checks the order and the terms, takes its side
+//     out of the colony or the account, pulls the order off the market and votes yes; or no.
+//  3. On yes the coordinator commits: the fleet gets the goods or its owner the credits. It then
+//     sends COMMIT until the participant pays out its side and acknowledges. On no, or with no
+//     vote by the deadline, it aborts, refunds the fleet and sends ABORT until acknowledged.
+//
+// Every answer is a receipt signed by the answering node and kept with the settlement. The
+// participant never gives up on a yes vote by itself: once SettlementGrace ticks past the
+// coordinator's deadline it asks (QUERY), and the coordinator answers with its decision,
+// aborting first if it still has none. A settlement the coordinator has no record of was never
+// committed (presumed abort). So either both sides pay out or both are refunded; retries are
+// idempotent by settlement ID. Tolls are not charged on cross-node fills.
+
+const (
+	SettlementTimeout    = 60 // ticks the coordinator waits for a vote
+	SettlementGrace      = 30 // further ticks before a participant asks for the decision
+	SettlementPollEvery  = 3 * time.Second
+	SettlementRPCTimeout = 5 * time.Second
+
+	SettlePrepare = "prepare"
+	SettleCommit  = "commit"
+	SettleAbort   = "abort"
+	SettleQuery   = "query"
+
+	SettlementPrepared  = "prepared"
+	SettlementCommitted = "committed"
+	SettlementAborted   = "aborted"
+
+	// Receipt outcomes besides committed/aborted
+	SettleYes     = "yes"
+	SettleNo      = "no"
+	SettlePending = "pending"
+	SettleUnknown = "unknown"
+
+	RoleCoordinator = "coordinator"
+	RoleParticipant = "participant"
+)
+
+// Sent as the payload of a TransactionRequest
+type SettlementMessage struct {
+	ID    string `json:"id"`
+	Phase string `json:"phase"`
+
+	// Prepare: the terms as the coordinator saw the order
+	OrderID    string `json:"order_id,omitempty"`
+	Item       string `json:"item,omitempty"`
+	Quantity   int    `json:"quantity,omitempty"`
+	Price      int    `json:"price,omitempty"`
+	IsBuy      bool   `json:"is_buy,omitempty"`
+	SystemID   string `json:"system_id,omitempty"`
+	FleetOwner string `json:"fleet_owner,omitempty"`
+	Deadline   int64  `json:"deadline,omitempty"`
+
+	Sent int64 `json:"sent"` // unix nanos; a retry is a new transaction, not a replay
+}
+
+type SettlementEnvelope struct {
+	Settlement *SettlementMessage `json:"settlement"`
+}
+
+type SettlementReceipt struct {
+	ID        string `json:"id"`
+	Phase     string `json:"phase"`
+	Outcome   string `json:"outcome"`
+	Reason    string `json:"reason,omitempty"`
+	Node      string `json:"node"`
+	Tick      int64  `json:"tick"`
+	Signature string `json:"signature"`
+}
+
+func (r SettlementReceipt) signingString() []byte {
+	return []byte(fmt.Sprintf("settlement:%s:%s:%s:%s:%d", r.ID, r.Phase, r.Outcome, r.Node, r.Tick))
+}
+
+type Settlement struct {
+	ID           string
+	Role         string
+	PeerUUID     string
+	OrderID      string
+	Item         string
+	Quantity     int
+	Price        int
+	IsBuy        bool
+	SystemID     string
+	OrderExpires int64
+	FleetID      int
+	FleetOwner   string
+	ColonyID     int
+	OrderOwner   string
+	Status       string
+	Acked        bool
+	Deadline     int64
+}
+
+func (s Settlement) cost() int { return s.Price * s.Quantity }
+
+const settlementColumns = `id, role, peer_uuid, order_id, item, quantity, price, is_buy, system_id, order_expires,
+	fleet_id, fleet_owner, colony_id, order_owner, status, acked, deadline_tick`
+
+func scanSettlement(row interface{ Scan(...interface{}) error }) (Settlement, error) {
+	var s Settlement
+	err := row.Scan(&s.ID, &s.Role, &s.PeerUUID, &s.OrderID, &s.Item, &s.Quantity, &s.Price, &s.IsBuy, &s.SystemID, &s.OrderExpires,
+		&s.FleetID, &s.FleetOwner, &s.ColonyID, &s.OrderOwner, &s.Status, &s.Acked, &s.Deadline)
+	return s, err
+}
+
+func loadSettlement(id string) (Settlement, error) {
+	return scanSettlement(db.QueryRow("SELECT "+settlementColumns+" FROM settlements WHERE id=?", id))
+}
+
+func querySettlements(where string, args ...interface{}) []Settlement {
+	var list []Settlement
+	rows, err := db.Query("SELECT "+settlementColumns+" FROM settlements WHERE "+where+" ORDER BY created_tick", args...)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if s, err := scanSettlement(rows); err == nil {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// Terms a node may settle: a real resource, and a value that fits
+func validSettlementTerms(item string, qty, price int) bool {
+	return validResources[item] && qty > 0 && price >= 0 && (price == 0 || qty <= MaxResource/price)
+}
+
+// colonyID is the local colony on the order's side, 0 when the order was another node's
+func logTradeFill(item string, qty, price, colonyID int) {
+	fillJson, _ := json.Marshal(TradeRecord{Item: item, Quantity: qty, Price: price, ColonyID: colonyID})
+	db.Exec("INSERT INTO transaction_log (tick, action_type, payload_blob) VALUES (?, 'TRADE_FILL', ?)", atomic.LoadInt64(&CurrentTick), fillJson)
+}
+
+func (s Settlement) filledEvent() map[string]interface{} {
+	return map[string]interface{}{
+		"order_id": s.OrderID, "item": s.Item, "quantity": s.Quantity, "price": s.Price,
+		"is_buy": s.IsBuy, "fleet_id": s.FleetID, "system_id": s.SystemID, "settlement_id": s.ID,
+	}
+}
+
+// --- Coordinator ---
+
+// Called on arrival, in the tick, for an order held by another node. Takes the fleet's side
+// into escrow; the worker does the talking.
+func prepareSettlement(fleet *Fleet, o MarketOrder, node string) {
+	if !validSettlementTerms(o.Item, o.Quantity, o.Price) {
+		return
+	}
+	cost := o.Price * o.Quantity
+	if o.IsBuy {
+		// The order's owner buys: the fleet sells goods
+		if fleet.Payload.Resources[o.Item] < o.Quantity {
+			InfoLog.Printf("⚠️ Trade Failed for Fleet %d (Goods missing)", fleet.ID)
+			return
+		}
+		fleet.Payload.Resources[o.Item] -= o.Quantity
+	} else {
+		if fleet.Payload.Credits < cost {
+			InfoLog.Printf("⚠️ Trade Failed for Fleet %d (Funds missing)", fleet.ID)
+			return
+		}
+		fleet.Payload.Credits -= cost
+	}
+
+	// The hold is only debited if the escrow is written
+	restore := func() {
+		if o.IsBuy {
+			fleet.Payload.Resources[o.Item] += o.Quantity
+		} else {
+			fleet.Payload.Credits += cost
+		}
+	}
+
+	tick := atomic.LoadInt64(&CurrentTick)
+	id := hashBLAKE3([]byte(fmt.Sprintf("%s|%s|%d|%d", ServerUUID, o.ID, fleet.ID, tick)))
+	tx, err := db.Begin()
+	if err != nil {
+		restore()
+		return
+	}
+	defer tx.Rollback()
+	plJson, _ := json.Marshal(fleet.Payload)
+	if _, err = tx.Exec("UPDATE fleets SET payload_json=? WHERE id=?", string(plJson), fleet.ID); err == nil {
+		_, err = tx.Exec("DELETE FROM market_orders WHERE order_id=?", o.ID)
+	}
+	if err != nil {
+		InfoLog.Printf("⚠️ Trade Failed for Fleet %d (%v)", fleet.ID, err)
+		restore()
+		return
+	}
+	_, err = tx.Exec(`INSERT INTO settlements (id, role, peer_uuid, order_id, item, quantity, price, is_buy, system_id, order_expires,
+	                  fleet_id, fleet_owner, order_owner, status, deadline_tick, created_tick) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, RoleCoordinator, node, o.ID, o.Item, o.Quantity, o.Price, o.IsBuy, fleet.DestSystem, o.ExpiresTick,
+		fleet.ID, fleet.OwnerUUID, o.SellerUUID, SettlementPrepared, tick+SettlementTimeout, tick)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		InfoLog.Printf("⚠️ Trade Failed for Fleet %d (%v)", fleet.ID, err)
+		restore()
+		return
+	}
+	InfoLog.Printf("🤝 Fleet %d settling order %s with %s (settlement %.12s)", fleet.ID, o.ID, node, id)
+}
+
+// Moves escrow out of a fleet's hold and back in; a fleet that is gone refunds credits to its owner
+func creditFleet(s Settlement, credits int, item string, qty int) {
+	var plJson string
+	if db.QueryRow("SELECT COALESCE(payload_json, '') FROM fleets WHERE id=? AND owner_uuid=?", s.FleetID, s.FleetOwner).Scan(&plJson) != nil {
+		if credits > 0 {
+			db.Exec("UPDATE users SET credits = credits + ? WHERE global_uuid=?", credits, s.FleetOwner)
+		}
+		if qty > 0 {
+			InfoLog.Printf("⚠️ Settlement %.12s: fleet %d is gone, %d %s lost", s.ID, s.FleetID, qty, item)
+		}
+		return
+	}
+	var pl FleetPayload
+	json.Unmarshal([]byte(plJson), &pl)
+	if pl.Resources == nil {
+		pl.Resources = make(map[string]int)
+	}
+	pl.Credits = safeAdd(pl.Credits, credits)
+	if qty > 0 {
+		pl.Resources[item] = safeAdd(pl.Resources[item], qty)
+	}
+	newPl, _ := json.Marshal(pl)
+	db.Exec("UPDATE fleets SET payload_json=? WHERE id=?", string(newPl), s.FleetID)
+}
+
+// Decides a prepared settlement; returns false if it was already decided
+func decideCoordinator(s Settlement, outcome string, acked bool) bool {
+	defer lockRows(userRow(s.FleetOwner))()
+	res, _ := db.Exec("UPDATE settlements SET status=?, acked=? WHERE id=? AND status=?", outcome, acked, s.ID, SettlementPrepared)
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false
+	}
+	switch {
+	case outcome == SettlementCommitted && s.IsBuy:
+		db.Exec("UPDATE users SET credits = credits + ? WHERE global_uuid=?", s.cost(), s.FleetOwner)
+	case outcome == SettlementCommitted:
+		creditFleet(s, 0, s.Item, s.Quantity)
+	case s.IsBuy:
+		creditFleet(s, 0, s.Item, s.Quantity)
+	default:
+		creditFleet(s, s.cost(), "", 0)
+	}
+	if outcome == SettlementCommitted {
+		logTradeFill(s.Item, s.Quantity, s.Price, 0)
+		emitEvent(s.FleetOwner, EventOrderFilled, s.filledEvent())
+		InfoLog.Printf("💰 Trade Settled: Fleet %d filled order %s with %s", s.FleetID, s.OrderID, s.PeerUUID)
+	} else {
+		InfoLog.Printf("↩️ Settlement %.12s for fleet %d aborted; escrow refunded", s.ID, s.FleetID)
+	}
+	return true
+}
+
+// --- Participant ---
+
+func participantPrepare(m *SettlementMessage, from string) (string, string) {
+	if s, err := loadSettlement(m.ID); err == nil {
+		if s.Role != RoleParticipant || s.PeerUUID != from {
+			return SettleNo, "settlement id in use"
+		}
+		switch s.Status {
+		case SettlementPrepared:
+			return SettleYes, ""
+		case SettlementCommitted:
+			return SettlementCommitted, ""
+		}
+		return SettleNo, "aborted"
+	}
+
+	var o MarketOrder
+	var node string
+	err := db.QueryRow("SELECT seller_uuid, item, quantity, price, is_buy, origin_system, expires_tick, COALESCE(origin_node, '') FROM market_orders WHERE order_id=?", m.OrderID).
+		Scan(&o.SellerUUID, &o.Item, &o.Quantity, &o.Price, &o.IsBuy, &o.OriginSystem, &o.ExpiresTick, &node)
+	tick := atomic.LoadInt64(&CurrentTick)
+	switch {
+	case err != nil || node != "":
+		return SettleNo, "no such order here"
+	case o.ExpiresTick <= tick:
+		return SettleNo, "order expired"
+	case m.Deadline < tick:
+		return SettleNo, "past the deadline"
+	case o.Item != m.Item || o.Quantity != m.Quantity || o.Price != m.Price || o.IsBuy != m.IsBuy || o.OriginSystem != m.SystemID:
+		return SettleNo, "terms differ"
+	case !validSettlementTerms(o.Item, o.Quantity, o.Price):
+		return SettleNo, "invalid terms"
+	}
+
+	defer lockRows(userRow(o.SellerUUID))()
+
+	var colID int
+	if db.QueryRow("SELECT id FROM colonies WHERE system_id=? AND owner_uuid=? AND COALESCE(site_type, 'planet')='planet'", o.OriginSystem, o.SellerUUID).Scan(&colID) != nil {
+		return SettleNo, "no colony to trade with"
+	}
+	if err := checkEmbargo(o.SellerUUID, colID, m.FleetOwner, o.OriginSystem); err != nil {
+		return SettleNo, err.Error()
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return SettleNo, "db error"
+	}
+	var res sql.Result
+	if o.IsBuy {
+		res, err = tx.Exec("UPDATE users SET credits = credits - ? WHERE global_uuid=? AND credits >= ?", o.Price*o.Quantity, o.SellerUUID, o.Price*o.Quantity)
+	} else {
+		res, err = tx.Exec(fmt.Sprintf("UPDATE colonies SET %s = %s - ? WHERE id=? AND %s >= ?", o.Item, o.Item, o.Item), o.Quantity, colID, o.Quantity)
+	}
+	if err != nil {
+		tx.Rollback()
+		return SettleNo, "db error"
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return SettleNo, "funds or goods missing"
+	}
+	tx.Exec("DELETE FROM market_orders WHERE order_id=?", m.OrderID)
+	_, err = tx.Exec(`INSERT INTO settlements (id, role, peer_uuid, order_id, item, quantity, price, is_buy, system_id, order_expires,
+	                  fleet_owner, colony_id, order_owner, status, deadline_tick, created_tick) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		m.ID, RoleParticipant, from, m.OrderID, o.Item, o.Quantity, o.Price, o.IsBuy, o.OriginSystem, o.ExpiresTick,
+		m.FleetOwner, colID, o.SellerUUID, SettlementPrepared, m.Deadline+SettlementGrace, tick)
+	if err != nil || tx.Commit() != nil {
+		tx.Rollback()
+		return SettleNo, "db error"
+	}
+	InfoLog.Printf("🤝 Order %s reserved for settlement %.12s with %s", m.OrderID, m.ID, from)
+	return SettleYes, ""
+}
+
+// Applies the coordinator's decision to a participant settlement and reports where it stands
+func decideParticipant(id, from, outcome string) string {
+	s, err := loadSettlement(id)
+	if err != nil || s.Role != RoleParticipant || s.PeerUUID != from {
+		return SettleUnknown
+	}
+
+	defer lockRows(userRow(s.OrderOwner))()
+	res, _ := db.Exec("UPDATE settlements SET status=? WHERE id=? AND status=?", outcome, id, SettlementPrepared)
+	if n, _ := res.RowsAffected(); n == 0 {
+		db.QueryRow("SELECT status FROM settlements WHERE id=?", id).Scan(&s.Status)
+		return s.Status
+	}
+
+	// Commit pays out the escrow's counterpart; abort puts the escrow back
+	payCredits := (outcome == SettlementCommitted) != s.IsBuy
+	if payCredits {
+		db.Exec("UPDATE users SET credits = credits + ? WHERE global_uuid=?", s.cost(), s.OrderOwner)
+	} else {
+		db.Exec(fmt.Sprintf("UPDATE colonies SET %s = %s + ? WHERE id=?", s.Item, s.Item), s.Quantity, s.ColonyID)
+	}
+
+	if outcome == SettlementCommitted {
+		logTradeFill(s.Item, s.Quantity, s.Price, s.ColonyID)
+		emitEvent(s.OrderOwner, EventOrderFilled, s.filledEvent())
+		InfoLog.Printf("💰 Trade Settled: order %s filled by a fleet from %s", s.OrderID, from)
+	} else {
+		db.Exec("INSERT OR IGNORE INTO market_orders (order_id, seller_uuid, item, quantity, price, is_buy, origin_system, expires_tick) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			s.OrderID, s.OrderOwner, s.Item, s.Quantity, s.Price, s.IsBuy, s.SystemID, s.OrderExpires)
+		InfoLog.Printf("↩️ Settlement %.12s aborted by %s; order %s back on the market", id, from, s.OrderID)
+	}
+	return outcome
+}
+
+// The coordinator's answer to a participant asking for its decision
+func coordinatorDecision(id, from string) string {
+	s, err := loadSettlement(id)
+	if err != nil || s.Role != RoleCoordinator || s.PeerUUID != from {
+		return SettlementAborted // presumed abort
+	}
+	if s.Status == SettlementPrepared {
+		if atomic.LoadInt64(&CurrentTick) <= s.Deadline {
+			return SettlePending
+		}
+		decideCoordinator(s, SettlementAborted, true)
+		s, _ = loadSettlement(id)
+	}
+	if s.Status == SettlementAborted {
+		db.Exec("UPDATE settlements SET acked=1 WHERE id=?", id) // the asker aborts on hearing it
+	}
+	return s.Status
+}
+
+// Answers a settlement message from a peer with a signed receipt
+func handleSettlementMessage(w http.ResponseWriter, m *SettlementMessage, from string) {
+	r := SettlementReceipt{ID: m.ID, Phase: m.Phase, Node: ServerUUID, Tick: atomic.LoadInt64(&CurrentTick)}
+	switch m.Phase {
+	case SettlePrepare:
+		r.Outcome, r.Reason = participantPrepare(m, from)
+	case SettleCommit:
+		r.Outcome = decideParticipant(m.ID, from, SettlementCommitted)
+	case SettleAbort:
+		r.Outcome = decideParticipant(m.ID, from, SettlementAborted)
+	case SettleQuery:
+		r.Outcome = coordinatorDecision(m.ID, from)
+	default:
+		http.Error(w, "Unknown Settlement Phase", 400)
+		return
+	}
+	r.Signature = hex.EncodeToString(SignMessage(PrivateKey, r.signingString()))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(r)
+}
+
+// --- Worker ---
+
+func sendSettlement(client *http.Client, peerUUID string, m SettlementMessage) (SettlementReceipt, error) {
+	var r SettlementReceipt
+	peerLock.RLock()
+	p, known := Peers[peerUUID]
+	var url string
+	var key []byte
+	var asProto bool
+	if known {
+		url, key, asProto = p.Url, p.PublicKey, speaksProto(*p)
+	}
+	peerLock.RUnlock()
+	if !known {
+		return r, fmt.Errorf("unknown peer")
+	}
+
+	m.Sent = time.Now().UnixNano()
+	payload, _ := json.Marshal(SettlementEnvelope{Settlement: &m})
+	body, ct := encodeFederation(TransactionRequest{
+		UUID:      ServerUUID,
+		Tick:      atomic.LoadInt64(&CurrentTick),
+		Payload:   payload,
+		Signature: SignMessage(PrivateKey, payload),
+	}, asProto)
+	resp, err := postFederationAs(client, url+"/federation/transaction", ct, body)
+	if err != nil {
+		return r, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return r, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return r, fmt.Errorf("bad receipt")
+	}
+	sig, _ := hex.DecodeString(r.Signature)
+	if r.ID != m.ID || r.Phase != m.Phase || r.Node != peerUUID || !VerifySignature(key, r.signingString(), sig) {
+		return r, fmt.Errorf("receipt not signed by %s", peerUUID)
+	}
+	receiptJson, _ := json.Marshal(r)
+	db.Exec("UPDATE settlements SET receipt_json=? WHERE id=?", string(receiptJson), m.ID)
+	return r, nil
+}
+
+func runSettlementWorker() {
+	ticker := time.NewTicker(SettlementPollEvery)
+	defer ticker.Stop()
+	client := &http.Client{Timeout: SettlementRPCTimeout}
+	for range ticker.C {
+		advanceSettlements(client)
+	}
+}
+
+// One pass over the settlements waiting on a peer
+func advanceSettlements(client *http.Client) {
+	tick := atomic.LoadInt64(&CurrentTick)
+
+	for _, s := range querySettlements("role=? AND status=?", RoleCoordinator, SettlementPrepared) {
+		if tick > s.Deadline {
+			decideCoordinator(s, SettlementAborted, false)
+			continue
+		}
+		r, err := sendSettlement(client, s.PeerUUID, SettlementMessage{
+			ID: s.ID, Phase: SettlePrepare, OrderID: s.OrderID, Item: s.Item, Quantity: s.Quantity, Price: s.Price,
+			IsBuy: s.IsBuy, SystemID: s.SystemID, FleetOwner: s.FleetOwner, Deadline: s.Deadline,
+		})
+		if err != nil {
+			continue // retried until the deadline
+		}
+		switch r.Outcome {
+		case SettleYes, SettlementCommitted:
+			decideCoordinator(s, SettlementCommitted, r.Outcome == SettlementCommitted)
+		case SettleNo:
+			InfoLog.Printf("⚠️ %s refused settlement %.12s: %s", s.PeerUUID, s.ID, r.Reason)
+			decideCoordinator(s, SettlementAborted, true)
+		}
+	}
+
+	// Decisions the participant hasn't acknowledged yet
+	for _, s := range querySettlements("role=? AND status!=? AND acked=0", RoleCoordinator, SettlementPrepared) {
+		phase := SettleCommit
+		if s.Status == SettlementAborted {
+			phase = SettleAbort
+		}
+		r, err := sendSettlement(client, s.PeerUUID, SettlementMessage{ID: s.ID, Phase: phase})
+		if err != nil {
+			continue
+		}
+		if r.Outcome != s.Status && !(s.Status == SettlementAborted && r.Outcome == SettleUnknown) {
+			ErrorLog.Printf("❗ Settlement %.12s: we %s but %s answers %s", s.ID, s.Status, s.PeerUUID, r.Outcome)
+		}
+		db.Exec("UPDATE settlements SET acked=1 WHERE id=?", s.ID)
+	}
+
+	// Yes votes the coordinator has gone quiet on
+	for _, s := range querySettlements("role=? AND status=? AND deadline_tick < ?", RoleParticipant, SettlementPrepared, tick) {
+		r, err := sendSettlement(client, s.PeerUUID, SettlementMessage{ID: s.ID, Phase: SettleQuery})
+		if err != nil {
+			continue
+		}
+		if r.Outcome == SettlementCommitted || r.Outcome == SettlementAborted {
+			decideParticipant(s.ID, s.PeerUUID, r.Outcome)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import "encoding/json"
+
+// --- Shipyards ---
+// Hulls are laid down rather than spawned: each shipyard at a colony is one construction slot
+// that works ShipyardThroughput tons per tick. Ships wait in the CONSTRUCTING state, so a
+// ten-yard industrial world turns out ten hulls in parallel while an outpost builds one. Slots
+// follow the colony's construction crews: an understaffed yard works fewer (see workforce.go).
+
+const (
+	ShipyardThroughput = 50 // tons per slot per tick
+	ModuleTonnage      = 25
+)
+
+var HullTonnage = map[string]int{
+	"Fighter":       100,
+	"SpeedyFighter": 80,
+	"Bomber":        150,
+	"Frigate":       200,
+	"Colonizer":     300,
+}
+
+func shipTonnage(hullClass string, modules []string) int {
+	return HullTonnage[hullClass] + ModuleTonnage*len(modules)
+}
+
+// Ticks until a hull is done when it gets a slot of its own
+func buildTicks(tons int) int {
+	return (tons + ShipyardThroughput - 1) / ShipyardThroughput
+}
+
+type shipBuild struct {
+	FleetID   int
+	Remaining int
+}
+
+// Works the first `shipyards` builds in queue order; returns the IDs that finished
+func advanceShipyard(queue []shipBuild, shipyards int) []int {
+	var done []int
+	for i := range queue {
+		if i >= shipyards {
+			break
+		}
+		queue[i].Remaining -= ShipyardThroughput
+		if queue[i].Remaining <= 0 {
+			queue[i].Remaining = 0
+			done = append(done, queue[i].FleetID)
+		}
+	}
+	return done
+}
+
+func processShipyards() {
+	rows, err := db.Query(`SELECT id, origin_system, owner_uuid, COALESCE(build_remaining, 0) FROM fleets
+	                       WHERE status='CONSTRUCTING' ORDER BY id`)
+	if err != nil {
+		return
+	}
+	type yardKey struct{ System, Owner string }
+	queues := make(map[yardKey][]shipBuild)
+	var order []yardKey
+	for rows.Next() {
+		var b shipBuild
+		var k yardKey
+		rows.Scan(&b.FleetID, &k.System, &k.Owner, &b.Remaining)
+		if _, ok := queues[k]; !ok {
+			order = append(order, k)
+		}
+		queues[k] = append(queues[k], b)
+	}
+	rows.Close()
+
+	for _, k := range order {
+		// Slots come from the builder's colony; a bombed-out yard stalls its queue
+		// and its construction crews
+		var c Colony
+		var bJson, wfJson string
+		if db.QueryRow("SELECT buildings_json, pop_laborers, COALESCE(workforce_json, '') FROM colonies WHERE system_id=? AND owner_uuid=? AND COALESCE(site_type, 'planet')='planet'", k.System, k.Owner).
+			Scan(&bJson, &c.PopLaborers, &wfJson) != nil {
+			continue
+		}
+		c.Buildings = make(map[string]int)
+		json.Unmarshal([]byte(bJson), &c.Buildings)
+		c.Workforce = parseWorkforce(wfJson)
+		slots := int(float64(c.Buildings["shipyard"])*colonyWorkforce(&c).Staffing[SectorConstruction] + 0.5)
+
+		queue := queues[k]
+		done := advanceShipyard(queue, slots)
+		for i := 0; i < len(queue) && i < slots; i++ {
+			db.Exec("UPDATE fleets SET build_remaining=? WHERE id=?", queue[i].Remaining, queue[i].FleetID)
+		}
+		for _, id := range done {
+			db.Exec("UPDATE fleets SET status='ORBIT' WHERE id=?", id)
+			InfoLog.Printf("🚀 Fleet %d launched from the shipyard at %s", id, k.System)
+		}
+	}
+}
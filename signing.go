@@ -0,0 +1,204 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// --- User Key Custody ---
+// Each account's ed25519 key is stored encrypted with its password. To sign a client action the
+// user either sends the password with the request or unlocks a short-lived signing session; the
+// decrypted key only ever lives in memory here and is never returned.
+
+const (
+	SigningSessionTTL    = 5 * time.Minute
+	MaxSigningSessionTTL = 30 * time.Minute
+	ActionSigContext     = "ownworld-action:" // keeps user signatures out of other protocols
+	HeaderSigningToken   = "X-Signing-Token"
+)
+
+type signingSession struct {
+	UserID  string
+	Key     ed25519.PrivateKey
+	Expires time.Time
+}
+
+var (
+	signingSessions = make(map[string]*signingSession)
+	signingLock     sync.Mutex
+)
+
+func wipeKey(k ed25519.PrivateKey) {
+	for i := range k {
+		k[i] = 0
+	}
+}
+
+var errInvalidPassword = fmt.Errorf("invalid password")
+
+// Checks the password and decrypts the user's private key
+func unlockUserKey(userID, password string) (ed25519.PrivateKey, error) {
+	var passHash, privEnc string
+	err := db.QueryRow("SELECT password_hash, ed25519_priv_enc FROM users WHERE global_uuid=?", userID).Scan(&passHash, &privEnc)
+	if err != nil || privEnc == "" {
+		return nil, fmt.Errorf("no key on file")
+	}
+	if hashBLAKE3([]byte(password)) != passHash {
+		return nil, errInvalidPassword
+	}
+	return decryptKey(privEnc, password)
+}
+
+// unlockUserKey for handlers: a session alone must not allow unlimited password guesses, so
+// wrong passwords count towards the account's login throttle and a throttled account gets a 429
+func unlockUserKeyFor(w http.ResponseWriter, userID, password string) (ed25519.PrivateKey, bool) {
+	var username string
+	db.QueryRow("SELECT username FROM users WHERE global_uuid=?", userID).Scan(&username)
+	if rejectThrottledLogin(w, username) {
+		return nil, false
+	}
+	key, err := unlockUserKey(userID, password)
+	if err == errInvalidPassword {
+		recordLoginFailure(username, userID)
+	}
+	if err != nil {
+		http.Error(w, "Unlock Failed: "+err.Error(), 403)
+		return nil, false
+	}
+	clearLoginFailures(username)
+	return key, true
+}
+
+// Signs with an unlocked session's key; the key never leaves the lock
+func signWithSession(userID, token string, payload []byte) (sig []byte, pub ed25519.PublicKey, ok bool) {
+	signingLock.Lock()
+	defer signingLock.Unlock()
+	s, exists := signingSessions[token]
+	if !exists || s.UserID != userID {
+		return nil, nil, false
+	}
+	if time.Now().After(s.Expires) {
+		wipeKey(s.Key)
+		delete(signingSessions, token)
+		return nil, nil, false
+	}
+	return signAction(s.Key, payload), s.Key.Public().(ed25519.PublicKey), true
+}
+
+func lockSigningSessions(userID string) {
+	signingLock.Lock()
+	defer signingLock.Unlock()
+	now := time.Now()
+	for token, s := range signingSessions {
+		if s.UserID == userID || now.After(s.Expires) {
+			wipeKey(s.Key)
+			delete(signingSessions, token)
+		}
+	}
+}
+
+func signAction(key ed25519.PrivateKey, payload []byte) []byte {
+	return SignMessage(key, append([]byte(ActionSigContext), payload...))
+}
+
+// Verifies a client-action signature; the key must hash to the claimed user UUID
+func verifyActionSignature(userID string, pubKey ed25519.PublicKey, payload, sig []byte) bool {
+	if hashBLAKE3(pubKey) != userID {
+		return false
+	}
+	return VerifySignature(pubKey, append([]byte(ActionSigContext), payload...), sig)
+}
+
+// POST {"password", "ttl_seconds"} -> a signing token valid for the TTL
+func handleUnlockKey(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Password   string `json:"password" validate:"required"`
+		TTLSeconds int    `json:"ttl_seconds"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	key, ok := unlockUserKeyFor(w, userID, req.Password)
+	if !ok {
+		return
+	}
+
+	ttl := SigningSessionTTL
+	if req.TTLSeconds > 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+	if ttl > MaxSigningSessionTTL {
+		ttl = MaxSigningSessionTTL
+	}
+
+	token := generateSessionToken()
+	expires := time.Now().Add(ttl)
+	lockSigningSessions(userID)
+	signingLock.Lock()
+	signingSessions[token] = &signingSession{UserID: userID, Key: key, Expires: expires}
+	signingLock.Unlock()
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"signing_token": token,
+		"expires":       expires.Unix(),
+	})
+}
+
+func handleLockKey(w http.ResponseWriter, r *http.Request) {
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+	lockSigningSessions(userID)
+	w.Write([]byte("Key Locked"))
+}
+
+// POST {"payload"} with X-Signing-Token, or {"payload", "password"} for a one-off signature
+func handleSignAction(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Payload  string `json:"payload" validate:"required"`
+		Password string `json:"password"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	var sig []byte
+	var pub ed25519.PublicKey
+	if req.Password != "" {
+		key, ok := unlockUserKeyFor(w, userID, req.Password)
+		if !ok {
+			return
+		}
+		sig, pub = signAction(key, []byte(req.Payload)), key.Public().(ed25519.PublicKey)
+		wipeKey(key)
+	} else {
+		var ok bool
+		if sig, pub, ok = signWithSession(userID, r.Header.Get(HeaderSigningToken), []byte(req.Payload)); !ok {
+			http.Error(w, "Key Locked", 403)
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"signature":  hex.EncodeToString(sig),
+		"public_key": hex.EncodeToString(pub),
+	})
+}
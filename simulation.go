@@ -7,15 +7,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"math"
-	mrand "math/rand"
 	"sync/atomic"
 	"time"
 )
 
 // --- Constants ---
 const (
-	UniverseSize = 1000000 
-	MaxResource  = 2000000000 
+	MaxResource = 2000000000
 )
 
 func safeAdd(current, amount int) int {
@@ -38,12 +36,13 @@ func GetEfficiency(planetID int, resource string) float64 {
 type SectorPotential struct {
 	HasSystem  bool               `json:"has_system"`
 	SystemType string             `json:"system_type"`
+	Name       string             `json:"name,omitempty"` // given by the discoverer (see naming.go)
 	Resources  map[string]float64 `json:"resources"`
 	Hazards    float64            `json:"hazards"`
 }
 
 func GetSectorData(x, y, z int) SectorPotential {
-	if x > UniverseSize || x < -UniverseSize || y > UniverseSize || y < -UniverseSize || z > UniverseSize || z < -UniverseSize {
+	if !inUniverse(x, y, z) {
 		return SectorPotential{HasSystem: false}
 	}
 
@@ -51,7 +50,7 @@ func GetSectorData(x, y, z int) SectorPotential {
 	hash := hashBLAKE3([]byte(input))
 	hashBytes, _ := hex.DecodeString(hash)
 
-	exists := hashBytes[0] < 13
+	exists := int(hashBytes[0]) < SystemDensity
 
 	if !exists {
 		return SectorPotential{HasSystem: false}
@@ -68,14 +67,14 @@ func GetSectorData(x, y, z int) SectorPotential {
 	}
 
 	res := make(map[string]float64)
-	res["iron"] = (float64(hashBytes[2]) / 255.0) * 2.4 + 0.1
-	res["gold"] = (float64(hashBytes[3]) / 255.0) * 2.4 + 0.1
-	res["vegetation"] = (float64(hashBytes[4]) / 255.0) * 2.4 + 0.1
-	res["water"] = (float64(hashBytes[5]) / 255.0) * 2.4 + 0.1
-	
-    res["uranium_ore"] = (float64(hashBytes[6]) / 255.0) * 1.5 + 0.05
-    res["platinum_ore"] = (float64(hashBytes[8]) / 255.0) * 1.5 + 0.05
-    res["diamond_ore"] = (float64(hashBytes[9]) / 255.0) * 1.2 + 0.01
+	res["iron"] = (float64(hashBytes[2])/255.0)*2.4 + 0.1
+	res["gold"] = (float64(hashBytes[3])/255.0)*2.4 + 0.1
+	res["vegetation"] = (float64(hashBytes[4])/255.0)*2.4 + 0.1
+	res["water"] = (float64(hashBytes[5])/255.0)*2.4 + 0.1
+
+	res["uranium_ore"] = (float64(hashBytes[6])/255.0)*1.5 + 0.05
+	res["platinum_ore"] = (float64(hashBytes[8])/255.0)*1.5 + 0.05
+	res["diamond_ore"] = (float64(hashBytes[9])/255.0)*1.2 + 0.01
 
 	hazards := float64(hashBytes[7]) / 255.0
 
@@ -90,10 +89,8 @@ func GetSectorData(x, y, z int) SectorPotential {
 // --- Physics & Fleet Logic ---
 
 func GetSystemCoords(sysID string) []int {
-	var x, y, z int
-	err := db.QueryRow("SELECT x, y, z FROM solar_systems WHERE id=?", sysID).Scan(&x, &y, &z)
-	if err == nil {
-		return []int{x, y, z}
+	if s, ok := lookupSystem(sysID); ok {
+		return []int{s.X, s.Y, s.Z}
 	}
 	return []int{0, 0, 0}
 }
@@ -119,8 +116,71 @@ func CalculateFuelCost(origin, target []int, mass int, targetUUID string) int {
 	return int(distance * float64(mass) * multiplier)
 }
 
+// Fuel cost and travel ticks for a hop between two systems (shared by launches and auto-return)
+func computeRoute(originSys, targetSys, hullClass string, modules []string) (int, int64) {
+	return computeWornRoute(originSys, targetSys, hullClass, modules, nil)
+}
+
+// computeRoute for a fleet whose engines may be worn (see damage.go)
+func computeWornRoute(originSys, targetSys, hullClass string, modules []string, condition []float64) (int, int64) {
+	originCoords := GetSystemCoords(originSys)
+	targetCoords := []int{0, 0, 0}
+	if len(targetSys) > 4 && targetSys[:4] == "sys-" {
+		targetCoords = GetSystemCoords(targetSys)
+		if targetCoords[0] == 0 && targetCoords[1] == 0 && targetCoords[2] == 0 {
+			fmt.Sscanf(targetSys, "sys-%d-%d-%d", &targetCoords[0], &targetCoords[1], &targetCoords[2])
+		}
+	} else {
+		targetCoords = originCoords
+	}
+
+	// Hull and engines shape both the burn and the speed (see fuel.go)
+	mass := fleetMass(hullClass, modules)
+
+	target, _ := lookupSystem(targetSys)
+	targetOwner := target.Owner
+
+	cost := CalculateFuelCost(originCoords, targetCoords, mass, targetOwner)
+	if cost >= 0 {
+		cost = int(float64(cost) * fuelBurnFactor(hullClass, modules))
+	}
+
+	dist := 0.0
+	for i := 0; i < 3; i++ {
+		dist += math.Pow(float64(originCoords[i]-targetCoords[i]), 2)
+	}
+	return cost, travelTicks(math.Sqrt(dist), modules, condition)
+}
+
+// Sends an orbiting fleet back to its home system. Returns false if it can't (no home, no fuel).
+func sendFleetHome(f Fleet, fromSys string) bool {
+	if f.HomeSystem == "" || f.HomeSystem == fromSys {
+		return false
+	}
+
+	cost, travelTime := computeWornRoute(fromSys, f.HomeSystem, f.HullClass, f.Modules, f.Condition)
+	if cost < 0 {
+		return false
+	}
+
+	now := atomic.LoadInt64(&CurrentTick)
+	res, err := db.Exec(`UPDATE fleets SET status='TRANSIT', fuel=fuel-?, route_fuel=?, origin_system=?, dest_system=?,
+	         departure_tick=?, arrival_tick=?, target_order_id=NULL WHERE id=? AND fuel >= ?`,
+		cost, cost, fromSys, f.HomeSystem, now, now+travelTime, f.ID, cost)
+	if err != nil {
+		return false
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		InfoLog.Printf("⛽ Fleet %d cannot auto-return to %s (Need %d fuel)", f.ID, f.HomeSystem, cost)
+		return false
+	}
+
+	InfoLog.Printf("🏠 Fleet %d auto-returning to %s (Arrival Tick %d)", f.ID, f.HomeSystem, now+travelTime)
+	return true
+}
+
 func resolveDeepSpaceArrival(fleet Fleet) {
-    // 1. Discovery Logic
+	// 1. Discovery Logic
 	var x, y, z int
 	n, _ := fmt.Sscanf(fleet.DestSystem, "sys-%d-%d-%d", &x, &y, &z)
 
@@ -129,161 +189,280 @@ func resolveDeepSpaceArrival(fleet Fleet) {
 		x, y, z = coords[0], coords[1], coords[2]
 	}
 
-	if x > UniverseSize || x < -UniverseSize || y > UniverseSize || y < -UniverseSize || z > UniverseSize || z < -UniverseSize {
+	if !inUniverse(x, y, z) {
 		return
 	}
 
-	var exists int
-	db.QueryRow("SELECT count(*) FROM solar_systems WHERE x=? AND y=? AND z=?", x, y, z).Scan(&exists)
-	if exists == 0 {
+	if _, exists := systemAt(x, y, z); !exists {
 		potential := GetSectorData(x, y, z)
 		if potential.HasSystem {
 			sysID := fmt.Sprintf("sys-%d-%d-%d", x, y, z)
-			db.Exec("INSERT OR IGNORE INTO solar_systems (id, type, x, y, z, owner_uuid) VALUES (?, ?, ?, ?, ?, ?)",
-				sysID, potential.SystemType, x, y, z, "")
+			db.Exec("INSERT OR IGNORE INTO solar_systems (id, type, x, y, z, owner_uuid, discoverer_uuid) VALUES (?, ?, ?, ?, ?, ?, ?)",
+				sysID, potential.SystemType, x, y, z, "", fleet.OwnerUUID)
+			reindexSystem(sysID)
 			InfoLog.Printf("🚀 Fleet %d discovered %s!", fleet.ID, sysID)
 		}
 	}
 
-    // Feature C: Detect Probe Scanner
-    // If it has probe_scanner, set status to SCANNING instead of ORBIT
-    // But only if there is no colony there or if explicitly commanded. 
-    // For MVP, if it has a probe, it scans.
-    hasProbe := false
-    for _, m := range fleet.Modules {
-        if m == "probe_scanner" { hasProbe = true; break }
-    }
-    
-    // 2. ATOMIC SWAP LOGIC (Market Fulfillment)
-    if fleet.TargetOrderID != "" {
-        row := db.QueryRow("SELECT item, quantity, price, is_buy, seller_uuid FROM market_orders WHERE order_id=?", fleet.TargetOrderID)
-        
-        var item, sellerUUID string
-        var qty, price int
-        var isBuy bool
-        
-        if err := row.Scan(&item, &qty, &price, &isBuy, &sellerUUID); err == nil {
-            // Fetch Colony at destination (The Trading Partner)
-            var colID int
-            var colOwner string
-            // Dynamic query to find the colony in the system matching the order owner
-            errCol := db.QueryRow("SELECT id, owner_uuid FROM colonies WHERE system_id=? AND owner_uuid=?", fleet.DestSystem, sellerUUID).Scan(&colID, &colOwner)
-            
-            if errCol == nil {
-                // Execute Trade
-                tx, _ := db.Begin()
-                success := false
-                
-                if !isBuy { 
-                    // This was a SELL order (Partner is Selling, Fleet is Buying)
-                    // Fleet needs Credits, Partner needs Goods.
-                    // WAIT: Fleet sent to BUY means Fleet must carry CREDITS.
-                    cost := price * qty
-                    
-                    if fleet.Payload.Credits >= cost {
-                        // Check if colony has goods
-                        res, _ := tx.Exec(fmt.Sprintf("UPDATE colonies SET %s = %s - ? WHERE id=? AND %s >= ?", item, item, item), qty, colID, qty)
-                        if n, _ := res.RowsAffected(); n > 0 {
-                            // Transfer Goods to Fleet
-                            if fleet.Payload.Resources == nil { fleet.Payload.Resources = make(map[string]int) }
-                            fleet.Payload.Resources[item] += qty
-                            fleet.Payload.Credits -= cost
-                            
-                            // Pay the Colony Owner (User)
-                            tx.Exec("UPDATE users SET credits = credits + ? WHERE global_uuid=?", cost, colOwner)
-                            
-                            // Update Fleet
-                            fJson, _ := json.Marshal(fleet.Payload)
-                            tx.Exec("UPDATE fleets SET payload_json=? WHERE id=?", string(fJson), fleet.ID)
-                            
-                            success = true
-                            InfoLog.Printf("💰 Trade Executed: Fleet %d bought %d %s from %s", fleet.ID, qty, item, colOwner)
-                        }
-                    }
-                } else {
-                    // This was a BUY order (Partner wants to Buy, Fleet is Selling)
-                    // Fleet needs Goods, Partner needs Credits (User credits usually, or Colony credits? Let's use User credits for simplicity)
-                    // Actually, "Does the colony have credits?" usually refers to the User balance.
-                    
-                    payout := price * qty
-                    // Check if fleet has goods
-                    if fleet.Payload.Resources[item] >= qty {
-                        // Check if Buyer (Colony Owner) has credits
-                        var buyerCreds int
-                        tx.QueryRow("SELECT credits FROM users WHERE global_uuid=?", colOwner).Scan(&buyerCreds)
-                        
-                        if buyerCreds >= payout {
-                            // Deduct Item from Fleet
-                            fleet.Payload.Resources[item] -= qty
-                            
-                            // Add Item to Colony
-                            tx.Exec(fmt.Sprintf("UPDATE colonies SET %s = %s + ? WHERE id=?", item, item), qty, colID)
-                            
-                            // Transfer Credits: Buyer -> Fleet Owner
-                            tx.Exec("UPDATE users SET credits = credits - ? WHERE global_uuid=?", payout, colOwner)
-                            tx.Exec("UPDATE users SET credits = credits + ? WHERE global_uuid=?", payout, fleet.OwnerUUID)
-                            
-                            // Update Fleet
-                            fJson, _ := json.Marshal(fleet.Payload)
-                            tx.Exec("UPDATE fleets SET payload_json=? WHERE id=?", string(fJson), fleet.ID)
-                            
-                            success = true
-                            InfoLog.Printf("💰 Trade Executed: Fleet %d sold %d %s to %s", fleet.ID, qty, item, colOwner)
-                        }
-                    }
-                }
-                
-                if success {
-                    // Delete the order as fulfilled
-                    tx.Exec("DELETE FROM market_orders WHERE order_id=?", fleet.TargetOrderID)
-                    tx.Commit()
-                } else {
-                    tx.Rollback()
-                    InfoLog.Printf("⚠️ Trade Failed for Fleet %d (Funds/Goods missing)", fleet.ID)
-                }
-            }
-        }
-    }
-    
-    if hasProbe {
-        db.Exec("UPDATE fleets SET status='SCANNING' WHERE id=?", fleet.ID)
-    } else {
-        db.Exec("UPDATE fleets SET status='ORBIT' WHERE id=?", fleet.ID)
-    }
+	// Feature C: Detect Probe Scanner
+	// If it has probe_scanner, set status to SCANNING instead of ORBIT
+	// But only if there is no colony there or if explicitly commanded.
+	// For MVP, if it has a probe, it scans.
+	hasProbe := false
+	for _, m := range fleet.Modules {
+		if m == "probe_scanner" {
+			hasProbe = true
+			break
+		}
+	}
+
+	// Stellar hazards strike before anything else happens on arrival
+	if !applyStellarHazards(&fleet) {
+		return
+	}
+
+	chargeTransitToll(fleet, fleet.DestSystem)
+
+	// 2. ATOMIC SWAP LOGIC (Market Fulfillment)
+	tradeDone := false
+	if fleet.TargetOrderID != "" && featureEnabled(FeatureMarketMatching) {
+		row := db.QueryRow("SELECT item, quantity, price, is_buy, seller_uuid, expires_tick, COALESCE(origin_node, '') FROM market_orders WHERE order_id=?", fleet.TargetOrderID)
+
+		var item, sellerUUID, originNode string
+		var qty, price int
+		var isBuy bool
+		var expires int64
+
+		err := row.Scan(&item, &qty, &price, &isBuy, &sellerUUID, &expires, &originNode)
+		if err == nil && originNode != "" {
+			// Another node holds the order: settle with it in two phases (see settlement.go)
+			prepareSettlement(&fleet, MarketOrder{ID: fleet.TargetOrderID, SellerUUID: sellerUUID, Item: item, Quantity: qty,
+				Price: price, IsBuy: isBuy, ExpiresTick: expires}, originNode)
+		} else if err == nil {
+			// Fetch Colony at destination (The Trading Partner)
+			var colID int
+			var colOwner string
+			// Dynamic query to find the colony in the system matching the order owner
+			errCol := db.QueryRow("SELECT id, owner_uuid FROM colonies WHERE system_id=? AND owner_uuid=? AND COALESCE(site_type, 'planet')='planet'", fleet.DestSystem, sellerUUID).Scan(&colID, &colOwner)
+
+			if errCol == nil {
+				if err := checkEmbargo(colOwner, colID, fleet.OwnerUUID, fleet.DestSystem); err != nil {
+					InfoLog.Printf("⛔ Trade refused for Fleet %d at colony %d: %v", fleet.ID, colID, err)
+					errCol = err
+				}
+			}
+
+			if errCol == nil {
+				// Visitors pay the node's trade toll on the fill value
+				tollPct := 0.0
+				if tollable(fleet.OwnerUUID, fleet.DestSystem) {
+					tollPct = currentTolls().TradePct
+				}
+
+				// Execute Trade
+				tx, _ := db.Begin()
+				success := false
+
+				if !isBuy {
+					// This was a SELL order (Partner is Selling, Fleet is Buying)
+					// Fleet needs Credits, Partner needs Goods.
+					// WAIT: Fleet sent to BUY means Fleet must carry CREDITS.
+					cost := price * qty
+
+					if fleet.Payload.Credits >= cost {
+						// Check if colony has goods
+						res, _ := tx.Exec(fmt.Sprintf("UPDATE colonies SET %s = %s - ? WHERE id=? AND %s >= ?", item, item, item), qty, colID, qty)
+						if n, _ := res.RowsAffected(); n > 0 {
+							// Transfer Goods to Fleet
+							if fleet.Payload.Resources == nil {
+								fleet.Payload.Resources = make(map[string]int)
+							}
+							fleet.Payload.Resources[item] += qty
+							fleet.Payload.Credits -= cost
+
+							// Pay the Colony Owner (User)
+							tx.Exec("UPDATE users SET credits = credits + ? WHERE global_uuid=?", cost, colOwner)
+
+							// Update Fleet
+							fJson, _ := json.Marshal(fleet.Payload)
+							tx.Exec("UPDATE fleets SET payload_json=? WHERE id=?", string(fJson), fleet.ID)
+
+							collectToll(tx, fleet.OwnerUUID, tradeToll(cost, tollPct))
+							success = true
+							InfoLog.Printf("💰 Trade Executed: Fleet %d bought %d %s from %s", fleet.ID, qty, item, colOwner)
+						}
+					}
+				} else {
+					// This was a BUY order (Partner wants to Buy, Fleet is Selling)
+					// Fleet needs Goods, Partner needs Credits (User credits usually, or Colony credits? Let's use User credits for simplicity)
+					// Actually, "Does the colony have credits?" usually refers to the User balance.
+
+					payout := price * qty
+					// Check if fleet has goods
+					if fleet.Payload.Resources[item] >= qty {
+						// Check if Buyer (Colony Owner) has credits
+						var buyerCreds int
+						tx.QueryRow("SELECT credits FROM users WHERE global_uuid=?", colOwner).Scan(&buyerCreds)
+
+						if buyerCreds >= payout {
+							// Deduct Item from Fleet
+							fleet.Payload.Resources[item] -= qty
+
+							// Add Item to Colony
+							tx.Exec(fmt.Sprintf("UPDATE colonies SET %s = %s + ? WHERE id=?", item, item), qty, colID)
+
+							// Transfer Credits: Buyer -> Fleet Owner
+							tx.Exec("UPDATE users SET credits = credits - ? WHERE global_uuid=?", payout, colOwner)
+							tx.Exec("UPDATE users SET credits = credits + ? WHERE global_uuid=?", payout, fleet.OwnerUUID)
+
+							// Update Fleet
+							fJson, _ := json.Marshal(fleet.Payload)
+							tx.Exec("UPDATE fleets SET payload_json=? WHERE id=?", string(fJson), fleet.ID)
+
+							collectToll(tx, fleet.OwnerUUID, tradeToll(payout, tollPct))
+							success = true
+							InfoLog.Printf("💰 Trade Executed: Fleet %d sold %d %s to %s", fleet.ID, qty, item, colOwner)
+						}
+					}
+				}
+
+				if success {
+					// Delete the order as fulfilled
+					tx.Exec("DELETE FROM market_orders WHERE order_id=?", fleet.TargetOrderID)
+					fillJson, _ := json.Marshal(TradeRecord{Item: item, Quantity: qty, Price: price, ColonyID: colID})
+					tx.Exec("INSERT INTO transaction_log (tick, action_type, payload_blob) VALUES (?, 'TRADE_FILL', ?)", atomic.LoadInt64(&CurrentTick), fillJson)
+					tx.Commit()
+					tradeDone = true
+
+					filled := map[string]interface{}{
+						"order_id": fleet.TargetOrderID, "item": item, "quantity": qty, "price": price,
+						"is_buy": isBuy, "fleet_id": fleet.ID, "system_id": fleet.DestSystem,
+					}
+					emitEvent(sellerUUID, EventOrderFilled, filled)
+					emitEvent(fleet.OwnerUUID, EventOrderFilled, filled)
+				} else {
+					tx.Rollback()
+					InfoLog.Printf("⚠️ Trade Failed for Fleet %d (Funds/Goods missing)", fleet.ID)
+				}
+			}
+		}
+	}
+
+	// The fleet is now physically at its destination
+	db.Exec("UPDATE fleets SET origin_system=? WHERE id=?", fleet.DestSystem, fleet.ID)
+	emitEvent(fleet.OwnerUUID, EventFleetArrival, map[string]interface{}{"fleet_id": fleet.ID, "system_id": fleet.DestSystem})
+
+	// 3. Auto-Return after a completed delivery
+	if tradeDone && fleet.AutoReturn && sendFleetHome(fleet, fleet.DestSystem) {
+		return
+	}
+
+	if hasProbe {
+		db.Exec("UPDATE fleets SET status='SCANNING' WHERE id=?", fleet.ID)
+	} else {
+		db.Exec("UPDATE fleets SET status='ORBIT' WHERE id=?", fleet.ID)
+	}
 }
 
 // --- Industry & Happiness ---
 
-func processIndustry(c *Colony, efficiencyMult float64) {
-    runRefinery := func(building string, inputName string, inputAmt int, outputName string, outputAmt int, inputStock *int, outputStock *int) {
-        if count, ok := c.Buildings[building]; ok && count > 0 {
-            totalInput := inputAmt * count
-            totalOutput := outputAmt * count
-            
-            eff := GetEfficiency(c.ID, inputName)
-            // Apply Stability Bonus
-            adjustedOutput := int(float64(totalOutput) * eff * efficiencyMult) + 1
-
-            if *inputStock >= totalInput {
-                *inputStock -= totalInput
-                *outputStock = safeAdd(*outputStock, adjustedOutput)
-            }
-        }
-    }
-
-    runRefinery("steel_mill", "iron", 2, "steel", 1, &c.Iron, &c.Steel)
-    runRefinery("fuel_synthesizer", "carbon", 5, "fuel", 2, &c.Carbon, &c.Fuel)
-    runRefinery("winery", "vegetation", 5, "wine", 1, &c.Vegetation, &c.Wine)
-    runRefinery("platinum_refinery", "platinum_ore", 3, "platinum", 1, &c.PlatinumOre, &c.Platinum)
-    runRefinery("uranium_enricher", "uranium_ore", 5, "uranium", 1, &c.UraniumOre, &c.Uranium)
-    runRefinery("diamond_cutter", "diamond_ore", 4, "diamond", 1, &c.DiamondOre, &c.Diamond)
-    runRefinery("breeder_reactor", "uranium", 10, "plutonium", 1, &c.Uranium, &c.Plutonium)
+// One refinery building processes InputAmt of Input into OutputAmt of Output per tick
+type RefineryRecipe struct {
+	Building  string
+	Input     string
+	InputAmt  int
+	Output    string
+	OutputAmt int
+}
+
+// Run in this order: the breeder reactor only sees uranium the enricher has already made
+var RefineryRecipes = []RefineryRecipe{
+	{"steel_mill", "iron", 2, "steel", 1},
+	{"fuel_synthesizer", "carbon", 5, "fuel", 2},
+	{"winery", "vegetation", 5, "wine", 1},
+	{"oxygen_plant", "water", 4, "oxygen", 10},
+	{"platinum_refinery", "platinum_ore", 3, "platinum", 1},
+	{"uranium_enricher", "uranium_ore", 5, "uranium", 1},
+	{"diamond_cutter", "diamond_ore", 4, "diamond", 1},
+	{"breeder_reactor", "uranium", 10, "plutonium", 1},
+}
+
+func refineryRecipe(building string) (RefineryRecipe, bool) {
+	for _, r := range RefineryRecipes {
+		if r.Building == building {
+			return r, true
+		}
+	}
+	return RefineryRecipe{}, false
+}
+
+// Stock fields a refinery reads or writes
+func refineryStock(c *Colony, res string) *int {
+	switch res {
+	case "iron":
+		return &c.Iron
+	case "steel":
+		return &c.Steel
+	case "carbon":
+		return &c.Carbon
+	case "fuel":
+		return &c.Fuel
+	case "vegetation":
+		return &c.Vegetation
+	case "wine":
+		return &c.Wine
+	case "water":
+		return &c.Water
+	case "oxygen":
+		return &c.Oxygen
+	case "platinum_ore":
+		return &c.PlatinumOre
+	case "platinum":
+		return &c.Platinum
+	case "uranium_ore":
+		return &c.UraniumOre
+	case "uranium":
+		return &c.Uranium
+	case "diamond_ore":
+		return &c.DiamondOre
+	case "diamond":
+		return &c.Diamond
+	case "plutonium":
+		return &c.Plutonium
+	}
+	return nil
+}
+
+// busy holds refinery buildings already running conversion contracts this tick (see conversion.go)
+func processIndustry(c *Colony, efficiencyMult float64, busy map[string]int) {
+	for _, r := range RefineryRecipes {
+		count := c.Buildings[r.Building] - busy[r.Building]
+		if count <= 0 {
+			continue
+		}
+		totalInput := r.InputAmt * count
+		totalOutput := r.OutputAmt * count
+
+		eff := GetEfficiency(c.ID, r.Input)
+		// Apply Stability Bonus
+		adjustedOutput := int(float64(totalOutput)*eff*efficiencyMult) + 1
+
+		inputStock, outputStock := refineryStock(c, r.Input), refineryStock(c, r.Output)
+		if *inputStock >= totalInput {
+			*inputStock -= totalInput
+			*outputStock = safeAdd(*outputStock, adjustedOutput)
+		}
+	}
 }
 
 func calculateSatisfaction(supply, demand int) float64 {
-    if demand <= 0 { return 1.0 }
-    if supply >= demand { return 1.0 }
-    return float64(supply) / float64(demand)
+	if demand <= 0 {
+		return 1.0
+	}
+	if supply >= demand {
+		return 1.0
+	}
+	return float64(supply) / float64(demand)
 }
 
 func snapshotWorld() {
@@ -307,7 +486,9 @@ func snapshotWorld() {
 	compressed := compressLZ4(rawJSON)
 
 	var prevHash string
-	err = db.QueryRow("SELECT final_hash FROM daily_snapshots ORDER BY day_id DESC LIMIT 1").Scan(&prevHash)
+	var prevDay int
+	var prevBlob []byte
+	err = db.QueryRow("SELECT day_id, state_blob, final_hash FROM daily_snapshots ORDER BY day_id DESC LIMIT 1").Scan(&prevDay, &prevBlob, &prevHash)
 	if err != nil {
 		prevHash = GenesisHash
 	}
@@ -315,30 +496,105 @@ func snapshotWorld() {
 	combined := append(compressed, []byte(prevHash)...)
 	finalHash := hashBLAKE3(combined)
 
-	dayID := int(CurrentTick / 17280)
+	dayID := int(CurrentTick / TicksPerDay)
+
+	// Delta against the previous day, served in place of the full blob to readers that hold it
+	// (GET /federation/sync?mode=delta). The full blob is still stored for every day.
+	isCheckpoint := err != nil || dayID%SnapshotCheckpointInterval == 0
+	var deltaBlob []byte
+	if !isCheckpoint {
+		var prevColonies []Colony
+		json.Unmarshal(decompressLZ4(prevBlob), &prevColonies)
+		delta := buildSnapshotDelta(prevDay, prevColonies, colonies)
+		deltaJSON, _ := json.Marshal(delta)
+		deltaBlob = compressLZ4(deltaJSON)
+	}
+
+	InfoLog.Printf("📸 Snapshot Day %d. Size: %d bytes (delta %d). Hash: %s", dayID, len(compressed), len(deltaBlob), finalHash)
 
-	InfoLog.Printf("📸 Snapshot Day %d. Size: %d bytes. Hash: %s", dayID, len(compressed), finalHash)
+	db.Exec("INSERT OR REPLACE INTO daily_snapshots (day_id, state_blob, final_hash, delta_blob, is_checkpoint) VALUES (?, ?, ?, ?, ?)",
+		dayID, compressed, finalHash, deltaBlob, isCheckpoint)
+}
 
-	db.Exec("INSERT OR REPLACE INTO daily_snapshots (day_id, state_blob, final_hash) VALUES (?, ?, ?)",
-		dayID, compressed, finalHash)
+// Diffs two colony snapshots by ID. Applying the delta to prev yields curr.
+func buildSnapshotDelta(baseDay int, prev, curr []Colony) SnapshotDelta {
+	delta := SnapshotDelta{BaseDay: baseDay, Changed: []Colony{}, Removed: []int{}}
+
+	prevByID := make(map[int]string, len(prev))
+	for _, c := range prev {
+		enc, _ := json.Marshal(c)
+		prevByID[c.ID] = string(enc)
+	}
+
+	seen := make(map[int]bool, len(curr))
+	for _, c := range curr {
+		seen[c.ID] = true
+		enc, _ := json.Marshal(c)
+		if old, ok := prevByID[c.ID]; !ok || old != string(enc) {
+			delta.Changed = append(delta.Changed, c)
+		}
+	}
+	for _, c := range prev {
+		if !seen[c.ID] {
+			delta.Removed = append(delta.Removed, c.ID)
+		}
+	}
+	return delta
+}
+
+// Reconstructs a day's colony list from the previous day's list and a delta.
+func applySnapshotDelta(prev []Colony, delta SnapshotDelta) []Colony {
+	byID := make(map[int]Colony, len(prev))
+	order := make([]int, 0, len(prev))
+	for _, c := range prev {
+		byID[c.ID] = c
+		order = append(order, c.ID)
+	}
+	for _, id := range delta.Removed {
+		delete(byID, id)
+	}
+	for _, c := range delta.Changed {
+		if _, ok := byID[c.ID]; !ok {
+			order = append(order, c.ID)
+		}
+		byID[c.ID] = c
+	}
+
+	out := make([]Colony, 0, len(byID))
+	for _, id := range order {
+		if c, ok := byID[id]; ok {
+			out = append(out, c)
+			delete(byID, id)
+		}
+	}
+	return out
 }
 
 func reportGrievance(offender, victim string, damage int) {
 	db.Exec("INSERT INTO grievances (offender_uuid, victim_uuid, damage_amount, tick) VALUES (?, ?, ?, ?)",
 		offender, victim, damage, atomic.LoadInt64(&CurrentTick))
+
+	// Free factions remember who attacked them
+	if isFreeFaction(victim) {
+		setFactionStance(victim, offender, StanceHostile)
+	}
+	emitEvent(victim, EventGrievance, map[string]interface{}{"offender_uuid": offender, "damage": damage})
 }
 
 func resolveSectorConflict(currentTick int64) {
-	rows, _ := db.Query("SELECT id, owner_uuid, origin_system, hull_class, modules_json FROM fleets WHERE status='ORBIT'")
+	rows, _ := db.Query(`SELECT id, owner_uuid, origin_system, hull_class, modules_json, COALESCE(module_condition_json, ''), COALESCE(home_system, ''), COALESCE(auto_return, 0), COALESCE(experience, 0), COALESCE(hull_damage, 0), COALESCE(payload_json, '') FROM fleets
+	                     WHERE status='ORBIT' OR (status=? AND origin_system=dest_system)`, FleetPatrol)
 	defer rows.Close()
 
 	systemFleets := make(map[string][]Fleet)
 
 	for rows.Next() {
 		var f Fleet
-		var modJson string
-		rows.Scan(&f.ID, &f.OwnerUUID, &f.OriginSystem, &f.HullClass, &modJson)
+		var modJson, condJson, plJson string
+		rows.Scan(&f.ID, &f.OwnerUUID, &f.OriginSystem, &f.HullClass, &modJson, &condJson, &f.HomeSystem, &f.AutoReturn, &f.Experience, &f.HullDamage, &plJson)
 		json.Unmarshal([]byte(modJson), &f.Modules)
+		f.Condition = parseCondition(condJson)
+		json.Unmarshal([]byte(plJson), &f.Payload)
 		systemFleets[f.OriginSystem] = append(systemFleets[f.OriginSystem], f)
 	}
 
@@ -356,97 +612,38 @@ func resolveSectorConflict(currentTick int64) {
 
 		if len(owners) > 1 {
 			InfoLog.Printf("⚔️ Space Combat initiated in %s", sysID)
-
-			for _, attacker := range combatants {
-				dmg := 0
-				for _, m := range attacker.Modules {
-					if m == "laser" {
-						dmg += 10
-					}
-					if m == "railgun" {
-						dmg += 20
-					}
-				}
-
-				if dmg > 0 {
-					for _, victim := range combatants {
-						if victim.OwnerUUID != attacker.OwnerUUID {
-							chance := float64(dmg) / 100.0
-							if mrand.Float64() < chance {
-								InfoLog.Printf("💥 Fleet %d destroyed by Fleet %d!", victim.ID, attacker.ID)
-								db.Exec("DELETE FROM fleets WHERE id=?", victim.ID)
-								reportGrievance(attacker.OwnerUUID, victim.OwnerUUID, 100)
-							}
-						}
-					}
-				}
-			}
+			report := resolveBattle(sysID, combatants, currentTick)
+			applyBattleReport(report, combatants)
+			shockSystem(sysID, currentTick)
 		}
 	}
 
-	bRows, _ := db.Query(`SELECT f.id, f.owner_uuid, f.origin_system, f.modules_json 
-	                      FROM fleets f 
-	                      WHERE f.status='ORBIT' AND f.modules_json LIKE '%bomb_bay%'`)
-	defer bRows.Close()
-
-	for bRows.Next() {
-		var f Fleet
-		var modJson string
-		bRows.Scan(&f.ID, &f.OwnerUUID, &f.OriginSystem, &modJson)
-
-		var colID int
-		var colOwner, bJson string
-		err := db.QueryRow("SELECT id, owner_uuid, buildings_json FROM colonies WHERE system_id=?", f.OriginSystem).Scan(&colID, &colOwner, &bJson)
-
-		if err == nil && colOwner != f.OwnerUUID {
-			damage := 5
-			buildings := make(map[string]int)
-			json.Unmarshal([]byte(bJson), &buildings)
-
-			destroyed := 0
-			for k, v := range buildings {
-				if v > 0 {
-					take := v
-					if take > damage {
-						take = damage
-					}
-					buildings[k] -= take
-					damage -= take
-					destroyed += take
-					if damage <= 0 {
-						break
-					}
-				}
-			}
-
-			if destroyed > 0 {
-				newBJson, _ := json.Marshal(buildings)
-				db.Exec("UPDATE colonies SET buildings_json=?, stability_target=stability_target-20 WHERE id=?", string(newBJson), colID)
-				InfoLog.Printf("🔥 Colony %d bombarded by Fleet %d. %d structures lost.", colID, f.ID, destroyed)
-
-				reportGrievance(f.OwnerUUID, colOwner, destroyed*10)
-			}
-		}
+	if !featureEnabled(FeatureInvasions) {
+		return
 	}
+
+	resolveBombardment(currentTick)
 }
 
 // Feature C: Deterministic Probes
 func processScanningFleets() {
-    rows, _ := db.Query("SELECT id, dest_system, payload_json FROM fleets WHERE status='SCANNING'")
-    defer rows.Close()
-    
-    for rows.Next() {
-        var f Fleet
-        var plJson string
-        rows.Scan(&f.ID, &f.DestSystem, &plJson)
-        json.Unmarshal([]byte(plJson), &f.Payload)
-        
-        if f.Payload.Resources == nil { f.Payload.Resources = make(map[string]int) }
-        f.Payload.Resources["scan_progress"] += 10
-        
-        newPlJson, _ := json.Marshal(f.Payload)
-        db.Exec("UPDATE fleets SET payload_json=? WHERE id=?", string(newPlJson), f.ID)
-    }
+	rows, _ := db.Query("SELECT id, dest_system, payload_json FROM fleets WHERE status='SCANNING'")
+	defer rows.Close()
+
+	for rows.Next() {
+		var f Fleet
+		var plJson string
+		rows.Scan(&f.ID, &f.DestSystem, &plJson)
+		json.Unmarshal([]byte(plJson), &f.Payload)
+
+		if f.Payload.Resources == nil {
+			f.Payload.Resources = make(map[string]int)
+		}
+		f.Payload.Resources["scan_progress"] += 10
+
+		newPlJson, _ := json.Marshal(f.Payload)
+		db.Exec("UPDATE fleets SET payload_json=? WHERE id=?", string(newPlJson), f.ID)
+	}
 }
 
 func tickWorld() {
@@ -457,228 +654,145 @@ func tickWorld() {
 	current := atomic.AddInt64(&CurrentTick, 1)
 	db.Exec("INSERT INTO transaction_log (tick, action_type) VALUES (?, 'TICK')", current)
 
-    if current % 100 == 0 {
-        db.Exec("DELETE FROM market_orders WHERE expires_tick < ?", current)
-    }
+	if current%100 == 0 {
+		db.Exec("DELETE FROM market_orders WHERE expires_tick < ?", current)
+		expireWrecks(current)
+		pruneChanges(current)
+		pruneAccountTokens()
+		expireCouncilProposals(current)
+		pruneCancellations(current)
+	}
 
-	fRows, _ := db.Query("SELECT id, dest_system, status, hull_class, modules_json, owner_uuid, payload_json, target_order_id FROM fleets WHERE arrival_tick <= ? AND status='TRANSIT'", current)
+	fRows, _ := db.Query("SELECT id, dest_system, status, hull_class, modules_json, owner_uuid, payload_json, target_order_id, COALESCE(home_system, ''), COALESCE(auto_return, 0) FROM fleets WHERE arrival_tick <= ? AND status='TRANSIT'", current)
 	defer fRows.Close()
 
 	for fRows.Next() {
 		var f Fleet
 		var modJson, plJson string
-        var tOrder sql.NullString
-		fRows.Scan(&f.ID, &f.DestSystem, &f.Status, &f.HullClass, &modJson, &f.OwnerUUID, &plJson, &tOrder)
+		var tOrder sql.NullString
+		fRows.Scan(&f.ID, &f.DestSystem, &f.Status, &f.HullClass, &modJson, &f.OwnerUUID, &plJson, &tOrder, &f.HomeSystem, &f.AutoReturn)
 		json.Unmarshal([]byte(modJson), &f.Modules)
-        if plJson != "" { json.Unmarshal([]byte(plJson), &f.Payload) }
-        if tOrder.Valid { f.TargetOrderID = tOrder.String }
+		if plJson != "" {
+			json.Unmarshal([]byte(plJson), &f.Payload)
+		}
+		if tOrder.Valid {
+			f.TargetOrderID = tOrder.String
+		}
 
 		resolveDeepSpaceArrival(f)
 	}
-    
-    processScanningFleets()
+	releaseDilatedFleets(current)
+	processPatrols(current)
+
+	processScanningFleets()
+	processShipyards()
+	processContracts(current)
+	if featureEnabled(FeatureMarketMatching) {
+		matchOrders(current)
+	}
+	refineryBusy := processConversions(current)
+	processFamineRelief(current)
+	events := processWorldEvents(current)
 
 	resolveSectorConflict(current)
+	moveRefugees()
+
+	// Last tick's culture, for parent propagation and empire bonuses
+	cultureByID := make(map[int]float64)
+	cultureByOwner := make(map[string]float64)
+	if cRows, err := db.Query("SELECT id, owner_uuid, COALESCE(culture, 0) FROM colonies"); err == nil {
+		for cRows.Next() {
+			var id int
+			var owner string
+			var cul float64
+			cRows.Scan(&id, &owner, &cul)
+			cultureByID[id] = cul
+			cultureByOwner[owner] += cul
+		}
+		cRows.Close()
+	}
+
+	capitals := loadCapitals()
 
 	rows, err := db.Query(`SELECT c.id, c.buildings_json, c.policies_json, c.pop_laborers, c.pop_specialists, c.pop_elites, 
 	                       c.food, c.water, c.carbon, c.gold, c.fuel, c.steel, c.wine, c.vegetation, c.stability_current, c.stability_target, c.iron,
                            c.uranium, c.uranium_ore, c.platinum, c.platinum_ore, c.diamond, c.diamond_ore, c.plutonium, c.owner_uuid,
-                           c.oxygen, c.martial_law,
-                           COALESCE(s.tax_rate, 0.0) as tax_rate
+                           c.oxygen, c.martial_law, COALESCE(c.collapse_ticks, 0), c.system_id,
+                           COALESCE(c.culture, 0), COALESCE(c.parent_colony_id, 0),
+                           COALESCE(c.terraform, 0), COALESCE(c.airless_ticks, 0),
+                           COALESCE(c.module_stock_json, '{}'), COALESCE(c.module_queue_json, '[]'),
+                           COALESCE(c.unrest_ticks, 0), COALESCE(c.workforce_json, ''), COALESCE(c.site_type, 'planet'),
+                           COALESCE(s.x, 0), COALESCE(s.y, 0), COALESCE(s.z, 0),
+                           COALESCE(s.tax_rate, 0.0) as tax_rate, COALESCE(s.star_type, s.type, '')
 	                       FROM colonies c
                            LEFT JOIN solar_systems s ON c.system_id = s.id`)
-	if err != nil { return }
-	defer rows.Close()
-
-	type ColUpdate struct {
-		ID                                                      int
-		Food, Water, Iron, Carbon, Gold, Fuel, Steel, Wine, Veg int
-        Uranium, UraniumOre, Platinum, PlatinumOre, Diamond, DiamondOre, Plutonium, Oxygen int
-		PopLab, PopSpec, PopElite                               int
-		Stability, Target                                       float64
-	}
-    type UserCreditUpdate struct {
-        UserUUID string
-        Amount   int
-    }
-    
-	var updates []ColUpdate
-    var creditUpdates []UserCreditUpdate
+	if err != nil {
+		return
+	}
 
+	var jobs []colonyJob
 	for rows.Next() {
 		var c Colony
-		var bJson, pJson string
-        var taxRate float64
-        
+		var bJson, pJson, msJson, mqJson, wfJson string
+		var taxRate float64
+		var sx, sy, sz int
+		var star string
+
 		rows.Scan(&c.ID, &bJson, &pJson, &c.PopLaborers, &c.PopSpecialists, &c.PopElites,
 			&c.Food, &c.Water, &c.Carbon, &c.Gold, &c.Fuel, &c.Steel, &c.Wine, &c.Vegetation,
 			&c.StabilityCurrent, &c.StabilityTarget, &c.Iron,
-            &c.Uranium, &c.UraniumOre, &c.Platinum, &c.PlatinumOre, &c.Diamond, &c.DiamondOre, &c.Plutonium, &c.OwnerUUID,
-            &c.Oxygen, &c.MartialLaw, &taxRate)
+			&c.Uranium, &c.UraniumOre, &c.Platinum, &c.PlatinumOre, &c.Diamond, &c.DiamondOre, &c.Plutonium, &c.OwnerUUID,
+			&c.Oxygen, &c.MartialLaw, &c.CollapseTicks, &c.SystemID,
+			&c.Culture, &c.ParentID, &c.Terraform, &c.AirlessTicks, &msJson, &mqJson,
+			&c.UnrestTicks, &wfJson, &c.SiteType,
+			&sx, &sy, &sz, &taxRate, &star)
 		json.Unmarshal([]byte(bJson), &c.Buildings)
-		
+
 		c.Policies = make(map[string]bool)
-		if pJson != "" { json.Unmarshal([]byte(pJson), &c.Policies) }
-
-        // --- 1. Base Extraction (Laborers Work) ---
-        effMult := 1.0
-        if c.StabilityCurrent >= 90.0 { effMult = 1.10 }
-        if c.StabilityCurrent <= 20.0 { effMult = 0.0 } 
-        
-        if c.Policies["forced_labor"] {
-             effMult += 0.5 
-             c.StabilityTarget -= 20.0
-        }
-
-		foodEff := GetEfficiency(c.ID, "food") * effMult
-        
-		c.Food = safeAdd(c.Food, int(float64(c.Buildings["farm"]*5)*foodEff))
-		c.Water = safeAdd(c.Water, int(float64(c.Buildings["well"]*5)*foodEff))
-        c.UraniumOre = safeAdd(c.UraniumOre, int(float64(c.Buildings["uranium_mine"]*2)*GetEfficiency(c.ID, "uranium_ore")*effMult))
-        c.PlatinumOre = safeAdd(c.PlatinumOre, int(float64(c.Buildings["platinum_mine"]*2)*GetEfficiency(c.ID, "platinum_ore")*effMult))
-        c.DiamondOre = safeAdd(c.DiamondOre, int(float64(c.Buildings["diamond_mine"]*2)*GetEfficiency(c.ID, "diamond_ore")*effMult))
-        c.Carbon = safeAdd(c.Carbon, int(float64(c.Buildings["carbon_extractor"]*10)*GetEfficiency(c.ID, "carbon")*effMult))
-        c.Iron = safeAdd(c.Iron, int(float64(c.Buildings["iron_mine"]*10)*GetEfficiency(c.ID, "iron")*effMult))
-
-        // Fix 2: Oxygen Production
-        c.Oxygen = safeAdd(c.Oxygen, c.Vegetation * 10)
-        if c.Oxygen > 10000 { c.Oxygen = 10000 }
-
-        // --- 2. Industry (Specialists Work) ---
-        indMult := 1.0
-        if c.StabilityCurrent < 40 { indMult = 0.5 }
-		processIndustry(&c, indMult)
-
-        // --- 3. Stratified Consumption & Happiness ---
-        
-        // Consumption Variables
-        labNeedFood := c.PopLaborers / 10 
-        labNeedWater := c.PopLaborers / 10
-        labNeedOxygen := c.PopLaborers / 100
-        
-        // --- NEW POLICY LOGIC START ---
-        growthBlocked := false
-
-        // Strict Rationing
-        if c.Policies["strict_rationing"] {
-            labNeedFood /= 2
-            labNeedWater /= 2
-            c.StabilityTarget -= 15.0
-            growthBlocked = true
-        }
-
-        // Propaganda
-        if c.Policies["propaganda"] {
-            if c.Fuel >= 5 {
-                c.Fuel -= 5
-                c.StabilityTarget += 10.0 
-            } else {
-                c.StabilityTarget -= 5.0
-            }
-        }
-
-        // Border Lockdown
-        if c.Policies["border_lockdown"] {
-            if c.Steel >= 2 {
-                c.Steel -= 2
-                c.StabilityTarget += 2.0 // Security Feeling
-            }
-        }
-
-        // Subsidized Housing (Growth Bonus)
-        housingCap := 100 + (c.Buildings["urban_housing"] * 50)
-        if c.Policies["subsidized_housing"] {
-            creditUpdates = append(creditUpdates, UserCreditUpdate{c.OwnerUUID, -50}) 
-            housingCap = int(float64(housingCap) * 1.5)
-        }
-        // --- NEW POLICY LOGIC END ---
-
-        satLabFood := 1.0
-        satLabWater := 1.0
-        satLabAir := 1.0
-        
-        if c.Food >= labNeedFood { c.Food -= labNeedFood } else { satLabFood = calculateSatisfaction(c.Food, labNeedFood); c.Food = 0 }
-        if c.Water >= labNeedWater { c.Water -= labNeedWater } else { satLabWater = calculateSatisfaction(c.Water, labNeedWater); c.Water = 0 }
-        if c.Oxygen >= labNeedOxygen { c.Oxygen -= labNeedOxygen } else { satLabAir = 0.0; c.Oxygen = 0; c.PopLaborers -= 10; c.StabilityTarget -= 5.0 } 
-        
-        satLabor := (satLabFood + satLabWater + satLabAir) / 3.0
-
-        // Specialists
-        specNeedSteel := c.PopSpecialists / 20
-        specNeedFuel := c.PopSpecialists / 20
-        satSpecSteel := 1.0
-        satSpecFuel := 1.0
-        
-        if c.Steel >= specNeedSteel { c.Steel -= specNeedSteel } else { satSpecSteel = calculateSatisfaction(c.Steel, specNeedSteel); c.Steel = 0 }
-        if c.Fuel >= specNeedFuel { c.Fuel -= specNeedFuel } else { satSpecFuel = calculateSatisfaction(c.Fuel, specNeedFuel); c.Fuel = 0 }
-        
-        satSpec := (satSpecSteel + satSpecFuel) / 2.0
-        if c.PopSpecialists == 0 { satSpec = 1.0 }
-
-        // Elites
-        eliteNeedWine := c.PopElites / 5
-        eliteNeedPlat := c.PopElites / 10
-        satEliteWine := 1.0
-        satElitePlat := 1.0
-        
-        if c.Wine >= eliteNeedWine { c.Wine -= eliteNeedWine } else { satEliteWine = calculateSatisfaction(c.Wine, eliteNeedWine); c.Wine = 0 }
-        if c.Platinum >= eliteNeedPlat { c.Platinum -= eliteNeedPlat } else { satElitePlat = calculateSatisfaction(c.Platinum, eliteNeedPlat); c.Platinum = 0 }
-        
-        satElite := (satEliteWine + satElitePlat) / 2.0
-        if c.PopElites == 0 { satElite = 1.0 }
-
-        // --- 4. Weighted Stability ---
-        weightedSat := (satLabor * 0.5) + (satSpec * 0.3) + (satElite * 0.2)
-        c.StabilityTarget = weightedSat * 100.0
-        
-        if satLabor < 0.5 {
-            deathToll := int(float64(c.PopLaborers) * 0.05) 
-            c.PopLaborers -= deathToll
-            c.StabilityTarget -= 20.0 
-        }
-        
-        // Fix 3: Martial Law
-        if c.MartialLaw {
-            if c.StabilityCurrent < 50.0 { c.StabilityCurrent = 50.0 } // Iron Fist
-            satElite = 0.0 // Elites hate martial law
-            // Also disables growth below...
-        }
-        
-        if taxRate > 0 {
-             taxRevenue := int(float64(c.PopLaborers) * taxRate)
-             creditUpdates = append(creditUpdates, UserCreditUpdate{c.OwnerUUID, taxRevenue})
-             c.StabilityTarget -= (taxRate * 100.0) 
-        }
-        
-        // Growth (Uses housingCap calculated in Policy block)
-        if !c.MartialLaw && !growthBlocked && c.StabilityCurrent > 80.0 && satLabor >= 1.0 && c.PopLaborers < housingCap {
-            growth := int(float64(c.PopLaborers) * 0.01) 
-            if growth < 1 { growth = 1 }
-            c.PopLaborers += growth
-        }
-        
-        if c.Buildings["pilot_academy"] > 0 && c.PopLaborers > 10 {
-             c.PopLaborers -= 5
-             c.PopSpecialists += 5
-        }
-
-		diff := c.StabilityTarget - c.StabilityCurrent
-		c.StabilityCurrent += diff * 0.1 
-        if c.StabilityCurrent < 0 { c.StabilityCurrent = 0 }
-        if c.StabilityCurrent > 100 { c.StabilityCurrent = 100 }
-
-		updates = append(updates, ColUpdate{
-			ID: c.ID,
-			Food: c.Food, Water: c.Water, Iron: c.Iron, Carbon: c.Carbon,
-			Gold: c.Gold, Fuel: c.Fuel,
-			Steel: c.Steel, Wine: c.Wine, Veg: c.Vegetation,
-            Uranium: c.Uranium, UraniumOre: c.UraniumOre, 
-            Platinum: c.Platinum, PlatinumOre: c.PlatinumOre, 
-            Diamond: c.Diamond, DiamondOre: c.DiamondOre,
-            Plutonium: c.Plutonium, Oxygen: c.Oxygen,
-			PopLab: c.PopLaborers, PopSpec: c.PopSpecialists, PopElite: c.PopElites,
-			Stability: c.StabilityCurrent, Target: c.StabilityTarget,
-		})
+		if pJson != "" {
+			json.Unmarshal([]byte(pJson), &c.Policies)
+		}
+		json.Unmarshal([]byte(msJson), &c.ModuleStock)
+		json.Unmarshal([]byte(mqJson), &c.ModuleQueue)
+		c.Workforce = parseWorkforce(wfJson)
+
+		jobs = append(jobs, colonyJob{Colony: c, TaxRate: taxRate, Pos: []int{sx, sy, sz}, Star: star})
+	}
+	rows.Close()
+
+	// Colonies are independent until the write, so they are simulated in parallel and
+	// merged back in query order to keep the batch deterministic
+	env := &tickEnv{CultureByID: cultureByID, CultureByOwner: cultureByOwner, Capitals: capitals, RefineryBusy: refineryBusy, Economy: currentEconomy(), Events: events}
+	results := runColonyJobs(jobs, env)
+
+	updates := make([]ColUpdate, 0, len(results))
+	credits := make(map[string]int)
+	var creditOrder []string
+	research := make(map[string]int)
+	var researchOrder []string
+	var rebellions []Colony
+	var secessions []Colony
+	for i, r := range results {
+		updates = append(updates, r.Update)
+		for _, cu := range r.Credits {
+			if _, seen := credits[cu.UserUUID]; !seen {
+				creditOrder = append(creditOrder, cu.UserUUID)
+			}
+			credits[cu.UserUUID] += cu.Amount
+		}
+		if r.Research > 0 {
+			owner := jobs[i].Colony.OwnerUUID
+			if _, seen := research[owner]; !seen {
+				researchOrder = append(researchOrder, owner)
+			}
+			research[owner] += r.Research
+		}
+		if r.Rebel {
+			rebellions = append(rebellions, r.RebelState)
+		}
+		if r.Secede {
+			secessions = append(secessions, r.SecedeState)
+		}
 	}
 
 	if len(updates) > 0 {
@@ -688,39 +802,413 @@ func tickWorld() {
 			steel=?, wine=?, vegetation=?,
             uranium=?, uranium_ore=?, platinum=?, platinum_ore=?, diamond=?, diamond_ore=?, plutonium=?, oxygen=?,
 			pop_laborers=?, pop_specialists=?, pop_elites=?, 
-			stability_current=?, stability_target=? 
+			stability_current=?, stability_target=?, stability_json=?, collapse_ticks=?, culture=?,
+			terraform=?, airless_ticks=?, module_stock_json=?, module_queue_json=?, unrest_ticks=?
 			WHERE id=?`)
 		for _, u := range updates {
 			stmt.Exec(u.Food, u.Water, u.Iron, u.Carbon, u.Gold, u.Fuel,
 				u.Steel, u.Wine, u.Veg,
-                u.Uranium, u.UraniumOre, u.Platinum, u.PlatinumOre, u.Diamond, u.DiamondOre, u.Plutonium, u.Oxygen,
+				u.Uranium, u.UraniumOre, u.Platinum, u.PlatinumOre, u.Diamond, u.DiamondOre, u.Plutonium, u.Oxygen,
 				u.PopLab, u.PopSpec, u.PopElite,
-				u.Stability, u.Target, u.ID)
+				u.Stability, u.Target, u.Factors, u.CollapseTicks, u.Culture,
+				u.Terraform, u.AirlessTicks, u.ModuleStock, u.ModuleQueue, u.UnrestTicks, u.ID)
 		}
 		stmt.Close()
-        
-        credStmt, _ := tx.Prepare("UPDATE users SET credits = credits + ? WHERE global_uuid=?")
-        for _, cu := range creditUpdates {
-            credStmt.Exec(cu.Amount, cu.UserUUID)
-        }
-        credStmt.Close()
-        
+
+		credStmt, _ := tx.Prepare("UPDATE users SET credits = credits + ? WHERE global_uuid=?")
+		for _, user := range creditOrder {
+			credStmt.Exec(credits[user], user)
+		}
+		credStmt.Close()
+
+		resStmt, _ := tx.Prepare("UPDATE users SET research_points = COALESCE(research_points, 0) + ? WHERE global_uuid=?")
+		for _, user := range researchOrder {
+			resStmt.Exec(research[user], user)
+		}
+		resStmt.Close()
+
 		tx.Commit()
 	}
 
-	if current%17280 == 0 {
+	for _, c := range secessions {
+		declareIndependence(c)
+	}
+	runColonyAutomation(current)
+
+	if current%FinanceInterval == 0 {
+		payFinancialCenters(current)
+	}
+
+	if featureEnabled(FeatureNPCPirates) {
+		for _, c := range rebellions {
+			spawnRebelFleet(c)
+		}
+		if current%PirateRoamInterval == 0 {
+			processPirateFleets()
+		}
+	}
+
+	if current%TicksPerDay == 0 {
 		go snapshotWorld()
 	}
+	recordChanges(current)
+	broadcastTick(current)
 
 	recalculateLeader()
 }
 
+type ColUpdate struct {
+	ID                                                                                 int
+	Food, Water, Iron, Carbon, Gold, Fuel, Steel, Wine, Veg                            int
+	Uranium, UraniumOre, Platinum, PlatinumOre, Diamond, DiamondOre, Plutonium, Oxygen int
+	PopLab, PopSpec, PopElite                                                          int
+	Stability, Target                                                                  float64
+	Factors                                                                            string
+	CollapseTicks                                                                      int
+	Culture                                                                            float64
+	Terraform                                                                          float64
+	AirlessTicks                                                                       int
+	ModuleStock, ModuleQueue                                                           string
+	UnrestTicks                                                                        int
+}
+
+type UserCreditUpdate struct {
+	UserUUID string
+	Amount   int
+}
+
+// One colony's tick, computed without touching the DB. Everything it reads besides the
+// colony itself comes from env, which is read-only while workers run.
+func simulateColony(c Colony, taxRate float64, pos []int, star string, env *tickEnv) colonyResult {
+	var res colonyResult
+	sx, sy, sz := pos[0], pos[1], pos[2]
+	capital, hasCapital := env.Capitals[c.OwnerUUID]
+	corrupt := corruption(&c, pos, capital, hasCapital)
+
+	// --- 1. Base Extraction (Laborers Work) ---
+	effMult := 1.0
+	if c.StabilityCurrent >= 90.0 {
+		effMult = 1.10
+	}
+	if c.StabilityCurrent <= 20.0 {
+		effMult = 0.0
+	}
+	effMult *= 1 - corrupt
+	effMult *= eventProduction(env.Events, pos, false)
+
+	if c.Policies["forced_labor"] {
+		effMult += 0.5
+		c.StabilityTarget -= 20.0
+	}
+
+	// Output follows the labor assigned to each sector
+	workforce := colonyWorkforce(&c)
+	farmMult := effMult * workforce.Staffing[SectorFarming]
+	mineMult := effMult * workforce.Staffing[SectorMining]
+
+	foodEff := GetEfficiency(c.ID, "food") * farmMult
+
+	c.Food = safeAdd(c.Food, int(float64(c.Buildings["farm"]*5)*foodEff*solarFactor(star)))
+	c.Water = safeAdd(c.Water, int(float64(c.Buildings["well"]*5)*foodEff*siteYield(c.SiteType, "water")))
+	// Outposts are far richer in what their site holds (see outposts.go)
+	c.UraniumOre = safeAdd(c.UraniumOre, int(float64(c.Buildings["uranium_mine"]*2)*GetEfficiency(c.ID, "uranium_ore")*mineMult*siteYield(c.SiteType, "uranium_ore")))
+	c.PlatinumOre = safeAdd(c.PlatinumOre, int(float64(c.Buildings["platinum_mine"]*2)*GetEfficiency(c.ID, "platinum_ore")*mineMult*siteYield(c.SiteType, "platinum_ore")))
+	c.DiamondOre = safeAdd(c.DiamondOre, int(float64(c.Buildings["diamond_mine"]*2)*GetEfficiency(c.ID, "diamond_ore")*mineMult*siteYield(c.SiteType, "diamond_ore")))
+	c.Carbon = safeAdd(c.Carbon, int(float64(c.Buildings["carbon_extractor"]*10)*GetEfficiency(c.ID, "carbon")*mineMult*siteYield(c.SiteType, "carbon")))
+	c.Iron = safeAdd(c.Iron, int(float64(c.Buildings["iron_mine"]*10)*GetEfficiency(c.ID, "iron")*mineMult*siteYield(c.SiteType, "iron")))
+
+	// Fix 2: Oxygen Production (vegetation, greenhouses) & Terraforming
+	habitability := effectiveHabitability(baseHabitability(sx, sy, sz), c.Terraform)
+	produceOxygen(&c, farmMult*solarFactor(star))
+	runTerraformers(&c)
+
+	// --- 2. Industry (Specialists Work) ---
+	indMult := 1.0
+	if c.StabilityCurrent < 40 {
+		indMult = 0.5
+	}
+	indMult *= 1 - corrupt
+	indMult *= eventProduction(env.Events, pos, true)
+	indMult *= colonyPower(&c, star, true).Factor
+	processIndustry(&c, indMult, env.RefineryBusy[c.ID])
+	processModuleFactories(&c, indMult)
+	if c.Oxygen > MaxOxygen {
+		c.Oxygen = MaxOxygen
+	}
+	applyDecay(&c)
+
+	// --- 3. Stratified Consumption & Happiness ---
+
+	// Consumption Variables
+	labNeedFood := c.PopLaborers / 10
+	labNeedWater := c.PopLaborers / 10
+	needOxygen := oxygenDemand(&c, habitability)
+
+	// --- NEW POLICY LOGIC START ---
+	growthBlocked := false
+
+	// Strict Rationing
+	if c.Policies["strict_rationing"] {
+		labNeedFood /= 2
+		labNeedWater /= 2
+		c.StabilityTarget -= 15.0
+		growthBlocked = true
+	}
+
+	// Propaganda
+	if c.Policies["propaganda"] {
+		if c.Fuel >= 5 {
+			c.Fuel -= 5
+			c.StabilityTarget += 10.0
+		} else {
+			c.StabilityTarget -= 5.0
+		}
+	}
+
+	// Border Lockdown
+	if c.Policies["border_lockdown"] {
+		if c.Steel >= 2 {
+			c.Steel -= 2
+			c.StabilityTarget += 2.0 // Security Feeling
+		}
+	}
+
+	// Subsidized Housing (Growth Bonus)
+	housingCap := 100 + (c.Buildings["urban_housing"] * 50)
+	if c.Policies["subsidized_housing"] {
+		res.Credits = append(res.Credits, UserCreditUpdate{c.OwnerUUID, scaleCredits(-50, env.Economy.Upkeep)})
+		housingCap = int(float64(housingCap) * 1.5)
+	}
+	// --- NEW POLICY LOGIC END ---
+
+	satLabFood := 1.0
+	satLabWater := 1.0
+	satLabAir := 1.0
+
+	if c.Food >= labNeedFood {
+		c.Food -= labNeedFood
+	} else {
+		satLabFood = calculateSatisfaction(c.Food, labNeedFood)
+		c.Food = 0
+	}
+	if c.Water >= labNeedWater {
+		c.Water -= labNeedWater
+	} else {
+		satLabWater = calculateSatisfaction(c.Water, labNeedWater)
+		c.Water = 0
+	}
+	// Life support: every colonist breathes on a hostile world, and failure compounds
+	if c.Oxygen >= needOxygen {
+		c.Oxygen -= needOxygen
+		c.AirlessTicks = 0
+	} else {
+		satLabAir = calculateSatisfaction(c.Oxygen, needOxygen)
+		c.Oxygen = 0
+		c.AirlessTicks++
+		applyLifeSupportFailure(&c)
+	}
+
+	satLabor := (satLabFood + satLabWater + satLabAir) / 3.0
+
+	var shortages []string
+	if satLabFood < 1.0 {
+		shortages = append(shortages, "food")
+	}
+	if satLabWater < 1.0 {
+		shortages = append(shortages, "water")
+	}
+	if satLabAir < 1.0 {
+		shortages = append(shortages, "oxygen")
+	}
+
+	// Specialists
+	specNeedSteel := c.PopSpecialists / 20
+	specNeedFuel := c.PopSpecialists / 20
+	satSpecSteel := 1.0
+	satSpecFuel := 1.0
+
+	if c.Steel >= specNeedSteel {
+		c.Steel -= specNeedSteel
+	} else {
+		satSpecSteel = calculateSatisfaction(c.Steel, specNeedSteel)
+		c.Steel = 0
+	}
+	if c.Fuel >= specNeedFuel {
+		c.Fuel -= specNeedFuel
+	} else {
+		satSpecFuel = calculateSatisfaction(c.Fuel, specNeedFuel)
+		c.Fuel = 0
+	}
+
+	satSpec := (satSpecSteel + satSpecFuel) / 2.0
+	if c.PopSpecialists == 0 {
+		satSpec = 1.0
+	}
+	if satSpecSteel < 1.0 {
+		shortages = append(shortages, "steel")
+	}
+	if satSpecFuel < 1.0 {
+		shortages = append(shortages, "fuel")
+	}
+
+	// Elites
+	eliteNeedWine := c.PopElites / 5
+	eliteNeedPlat := c.PopElites / 10
+	satEliteWine := 1.0
+	satElitePlat := 1.0
+
+	wineConsumed := eliteNeedWine
+	if c.Wine >= eliteNeedWine {
+		c.Wine -= eliteNeedWine
+	} else {
+		satEliteWine = calculateSatisfaction(c.Wine, eliteNeedWine)
+		wineConsumed = c.Wine
+		c.Wine = 0
+	}
+	if c.Platinum >= eliteNeedPlat {
+		c.Platinum -= eliteNeedPlat
+	} else {
+		satElitePlat = calculateSatisfaction(c.Platinum, eliteNeedPlat)
+		c.Platinum = 0
+	}
+
+	satElite := (satEliteWine + satElitePlat) / 2.0
+	if c.PopElites == 0 {
+		satElite = 1.0
+	}
+	if satEliteWine < 1.0 {
+		shortages = append(shortages, "wine")
+	}
+	if satElitePlat < 1.0 {
+		shortages = append(shortages, "platinum")
+	}
+
+	// --- 4. Weighted Stability ---
+	weightedSat := (satLabor * 0.5) + (satSpec * 0.3) + (satElite * 0.2)
+	c.StabilityTarget = weightedSat * 100.0
+	c.StabilityTarget -= idlePenalty(workforce) // idle hands
+
+	if satLabor < 0.5 {
+		deathToll := int(float64(c.PopLaborers) * 0.05)
+		c.PopLaborers -= deathToll
+		c.StabilityTarget -= 20.0
+	}
+
+	// Fix 3: Martial Law
+	if c.MartialLaw {
+		if c.StabilityCurrent < 50.0 {
+			c.StabilityCurrent = 50.0
+		} // Iron Fist
+		satElite = 0.0 // Elites hate martial law
+		// Also disables growth below...
+	}
+
+	if taxRate > 0 {
+		taxRevenue := int(float64(c.PopLaborers) * taxRate * (1 - corrupt))
+		res.Credits = append(res.Credits, UserCreditUpdate{c.OwnerUUID, taxRevenue})
+		c.StabilityTarget -= (taxRate * 100.0)
+	}
+
+	// Growth (Uses housingCap calculated in Policy block)
+	if !c.MartialLaw && !growthBlocked && c.StabilityCurrent > 80.0 && satLabor >= 1.0 && c.PopLaborers < housingCap {
+		growth := int(float64(c.PopLaborers) * 0.01)
+		if growth < 1 {
+			growth = 1
+		}
+		c.PopLaborers += growth
+	}
+
+	if c.Buildings["pilot_academy"] > 0 && c.PopLaborers > 10 {
+		promote := cultureBonuses(env.CultureByOwner[c.OwnerUUID]).PromotionRate
+		if promote > c.PopLaborers-10 {
+			promote = c.PopLaborers - 10
+		}
+		c.PopLaborers -= promote
+		c.PopSpecialists += promote
+	}
+
+	diff := c.StabilityTarget - c.StabilityCurrent
+	c.StabilityCurrent += diff * 0.1
+	if c.StabilityCurrent < 0 {
+		c.StabilityCurrent = 0
+	}
+	if c.StabilityCurrent > 100 {
+		c.StabilityCurrent = 100
+	}
+
+	// Culture & Heritage
+	c.Culture += cultureGrowth(&c, env.CultureByID[c.ParentID], wineConsumed)
+	if c.Culture < 0 {
+		c.Culture = 0
+	}
+
+	// Collapse: a colony stuck at zero stability eventually spawns a rebel fleet
+	if c.StabilityCurrent < 1.0 {
+		c.CollapseTicks++
+	} else {
+		c.CollapseTicks = 0
+	}
+	if c.CollapseTicks >= RebellionCollapseTicks {
+		res.Rebel, res.RebelState = true, c
+		c.CollapseTicks = 0
+	}
+
+	// Independence: remote, long-unhappy colonies secede
+	if independenceUnrest(&c, []int{sx, sy, sz}, capital, hasCapital) {
+		c.UnrestTicks++
+	} else {
+		c.UnrestTicks = 0
+	}
+	if c.UnrestTicks >= IndependenceTicks {
+		res.Secede, res.SecedeState = true, c
+		c.UnrestTicks = 0
+	}
+
+	if shortages == nil {
+		shortages = []string{}
+	}
+	factorsJson, _ := json.Marshal(StabilityBreakdown{
+		Labor: satLabor, Specialists: satSpec, Elites: satElite, Shortages: shortages,
+	})
+
+	res.Research = colonyResearch(&c)
+
+	msOut, _ := json.Marshal(c.ModuleStock)
+	mqOut, _ := json.Marshal(c.ModuleQueue)
+	if c.ModuleQueue == nil {
+		mqOut = []byte("[]")
+	}
+
+	res.Update = ColUpdate{
+		ID:   c.ID,
+		Food: c.Food, Water: c.Water, Iron: c.Iron, Carbon: c.Carbon,
+		Gold: c.Gold, Fuel: c.Fuel,
+		Steel: c.Steel, Wine: c.Wine, Veg: c.Vegetation,
+		Uranium: c.Uranium, UraniumOre: c.UraniumOre,
+		Platinum: c.Platinum, PlatinumOre: c.PlatinumOre,
+		Diamond: c.Diamond, DiamondOre: c.DiamondOre,
+		Plutonium: c.Plutonium, Oxygen: c.Oxygen,
+		PopLab: c.PopLaborers, PopSpec: c.PopSpecialists, PopElite: c.PopElites,
+		Stability: c.StabilityCurrent, Target: c.StabilityTarget,
+		Factors:       string(factorsJson),
+		CollapseTicks: c.CollapseTicks,
+		Culture:       c.Culture,
+		Terraform:     c.Terraform,
+		AirlessTicks:  c.AirlessTicks,
+		ModuleStock:   string(msOut), ModuleQueue: string(mqOut),
+		UnrestTicks: c.UnrestTicks,
+	}
+	return res
+}
+
 func runGameLoop() {
 	ticker := time.NewTicker(60 * time.Second)
 	for {
 		<-ticker.C
 		offset := CalculateOffset()
-		if offset > 0 { time.Sleep(offset) }
+		if offset > 0 {
+			time.Sleep(offset)
+		}
 		tickWorld()
 	}
 }
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+)
+
+// --- Region Scans ---
+// Sweeps a sphere of sectors in one call: procedural systems from the genesis hash plus
+// systems already in the DB (found via the x/y/z index). Fog of war: only sectors within
+// SensorRange of one of the caller's colonies or orbiting fleets, or of an anchor an allied node
+// shares (see alliance.go), are returned. Beacons the caller can see are listed wherever they
+// are in the sphere (see beacons.go).
+
+const (
+	MaxScanRadius = 10
+	SensorRange   = 100
+)
+
+type RegionSystem struct {
+	X          int      `json:"x"`
+	Y          int      `json:"y"`
+	Z          int      `json:"z"`
+	Distance   float64  `json:"distance"`
+	SystemID   string   `json:"system_id,omitempty"`
+	Name       string   `json:"name,omitempty"`
+	SystemType string   `json:"system_type"`
+	OwnerUUID  string   `json:"owner_uuid,omitempty"`
+	Hazards    float64  `json:"hazards"`
+	Charted    bool     `json:"charted"` // present in the DB, not just predicted
+	Beacons    []string `json:"beacons,omitempty"`
+}
+
+func distance3(a, b []int) float64 {
+	dx, dy, dz := float64(a[0]-b[0]), float64(a[1]-b[1]), float64(a[2]-b[2])
+	return math.Sqrt(dx*dx + dy*dy + dz*dz)
+}
+
+// Coordinates the user can see from: colony systems, systems their fleets orbit, and what allied nodes share
+func sensorAnchors(userID string) [][]int {
+	var anchors [][]int
+	rows, err := db.Query(`SELECT s.x, s.y, s.z FROM solar_systems s WHERE s.id IN (
+	                           SELECT system_id FROM colonies WHERE owner_uuid=?
+	                           UNION SELECT origin_system FROM fleets WHERE owner_uuid=? AND status != 'TRANSIT')`, userID, userID)
+	if err != nil {
+		return anchors
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var x, y, z int
+		rows.Scan(&x, &y, &z)
+		anchors = append(anchors, []int{x, y, z})
+	}
+	return append(anchors, alliedVision()...)
+}
+
+func inSensorRange(pos []int, anchors [][]int) bool {
+	for _, a := range anchors {
+		if distance3(pos, a) <= SensorRange {
+			return true
+		}
+	}
+	return false
+}
+
+func handleScanRegion(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		X      int `json:"x"`
+		Y      int `json:"y"`
+		Z      int `json:"z"`
+		Radius int `json:"radius" validate:"required"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	if req.Radius < 1 || req.Radius > MaxScanRadius {
+		http.Error(w, "Radius must be between 1 and 10", 400)
+		return
+	}
+
+	center := []int{req.X, req.Y, req.Z}
+	anchors := sensorAnchors(userID)
+	rad := float64(req.Radius)
+	found := make(map[[3]int]*RegionSystem)
+
+	// Charted systems via the galaxy index
+	box := systemsInBox([3]int{req.X - req.Radius, req.Y - req.Radius, req.Z - req.Radius},
+		[3]int{req.X + req.Radius, req.Y + req.Radius, req.Z + req.Radius})
+	for _, c := range box {
+		found[[3]int{c.X, c.Y, c.Z}] = &RegionSystem{Charted: true, SystemID: c.ID, X: c.X, Y: c.Y, Z: c.Z,
+			SystemType: c.Type, OwnerUUID: c.Owner, Name: c.Name}
+	}
+
+	// Procedural systems predicted from the genesis hash
+	for x := req.X - req.Radius; x <= req.X+req.Radius; x++ {
+		for y := req.Y - req.Radius; y <= req.Y+req.Radius; y++ {
+			for z := req.Z - req.Radius; z <= req.Z+req.Radius; z++ {
+				pos := []int{x, y, z}
+				if distance3(pos, center) > rad || !inSensorRange(pos, anchors) {
+					continue
+				}
+				data := cachedSectorData(x, y, z)
+				s, charted := found[[3]int{x, y, z}]
+				if !data.HasSystem && !charted {
+					continue
+				}
+				if !charted {
+					s = &RegionSystem{X: x, Y: y, Z: z, SystemType: data.SystemType}
+					found[[3]int{x, y, z}] = s
+				}
+				s.Hazards = data.Hazards
+			}
+		}
+	}
+
+	result := []RegionSystem{}
+	for _, s := range found {
+		pos := []int{s.X, s.Y, s.Z}
+		s.Distance = distance3(pos, center)
+		if s.Distance > rad || !inSensorRange(pos, anchors) {
+			continue
+		}
+		result = append(result, *s)
+	}
+
+	// Beacons need no sensor; one out of range shows only its coordinates
+	for _, b := range visibleBeacons(userID) {
+		pos := []int{b.X, b.Y, b.Z}
+		d := distance3(pos, center)
+		if d > rad {
+			continue
+		}
+		i := 0
+		for i < len(result) && (result[i].X != b.X || result[i].Y != b.Y || result[i].Z != b.Z) {
+			i++
+		}
+		if i == len(result) {
+			result = append(result, RegionSystem{X: b.X, Y: b.Y, Z: b.Z, Distance: d})
+		}
+		result[i].Beacons = append(result[i].Beacons, b.Name)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Distance < result[j].Distance })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
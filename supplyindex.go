@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"sync"
+	"sync/atomic"
+)
+
+// --- Supply Index ---
+// Bank burn payouts follow galaxy-wide supply as well as local geology. Every node totals the
+// units of each resource burned at its bank or changing hands in market fills (transaction_log
+// BANK_BURN and TRADE_FILL): over the last day (recent) and as a daily average over the last
+// SupplyBaselineDays (baseline). The totals ride along with heartbeats. Summed over this node
+// and its non-hostile peers, an item moving faster than its baseline is in glut and pays less
+// when burned; one moving slower is short and pays more:
+//
+//	factor = sqrt(baseline / recent), clamped to [MinSupplyFactor, MaxSupplyFactor]
+//
+// An item nobody has moved in the baseline window is priced at 1.
+
+const (
+	SupplyBaselineDays = 7
+	MinSupplyFactor    = 0.5
+	MaxSupplyFactor    = 2.0
+	MaxSupplyVolume    = 1 << 40 // per item in a peer's report; larger is a lie
+)
+
+type SupplyVolume struct {
+	Recent   int64 `json:"recent"`   // units in the last day
+	Baseline int64 `json:"baseline"` // daily average over the baseline window
+}
+
+// Logged per market fill (transaction_log TRADE_FILL) for the supply index
+type TradeRecord struct {
+	Item     string `json:"item"`
+	Quantity int    `json:"quantity"`
+	Price    int    `json:"price"`
+	ColonyID int    `json:"colony_id,omitempty"` // the colony it was filled against
+}
+
+var (
+	supplyCache     map[string]SupplyVolume
+	supplyCacheTick int64 = -1
+	supplyCacheLock sync.Mutex
+)
+
+// This node's burn and trade volumes, computed at most once per tick
+func localSupply() map[string]SupplyVolume {
+	tick := atomic.LoadInt64(&CurrentTick)
+	supplyCacheLock.Lock()
+	defer supplyCacheLock.Unlock()
+	if supplyCacheTick == tick && supplyCache != nil {
+		return supplyCache
+	}
+
+	// Young nodes average over the days they have
+	days := int64(SupplyBaselineDays)
+	if elapsed := tick/TicksPerDay + 1; elapsed < days {
+		days = elapsed
+	}
+
+	recent := make(map[string]int64)
+	total := make(map[string]int64)
+	rows, err := db.Query(`SELECT tick, action_type, payload_blob FROM transaction_log
+	                       WHERE action_type IN ('BANK_BURN', 'TRADE_FILL') AND tick > ?`, tick-days*TicksPerDay)
+	if err == nil {
+		for rows.Next() {
+			var t int64
+			var kind string
+			var blob []byte
+			rows.Scan(&t, &kind, &blob)
+			var item string
+			var units int
+			if kind == "BANK_BURN" {
+				var b BurnRecord
+				json.Unmarshal(blob, &b)
+				item, units = b.Item, b.Amount
+			} else {
+				var tr TradeRecord
+				json.Unmarshal(blob, &tr)
+				item, units = tr.Item, tr.Quantity
+			}
+			if !validResources[item] || units <= 0 {
+				continue
+			}
+			total[item] += int64(units)
+			if t > tick-TicksPerDay {
+				recent[item] += int64(units)
+			}
+		}
+		rows.Close()
+	}
+
+	supply := make(map[string]SupplyVolume, len(total))
+	for item, n := range total {
+		supply[item] = SupplyVolume{Recent: recent[item], Baseline: n / days}
+	}
+	supplyCache, supplyCacheTick = supply, tick
+	return supply
+}
+
+// Keeps a peer's supply report from a heartbeat if it is plausible. Caller holds peerLock.
+func acceptSupply(p *Peer, supply map[string]SupplyVolume) {
+	for item, v := range supply {
+		if !validResources[item] || v.Recent < 0 || v.Baseline < 0 || v.Recent > MaxSupplyVolume || v.Baseline > MaxSupplyVolume {
+			p.Supply = nil
+			return
+		}
+	}
+	p.Supply = supply
+}
+
+// Volumes summed over this node and its non-hostile peers
+func galaxySupply() map[string]SupplyVolume {
+	sum := make(map[string]SupplyVolume)
+	add := func(s map[string]SupplyVolume) {
+		for item, v := range s {
+			acc := sum[item]
+			acc.Recent += v.Recent
+			acc.Baseline += v.Baseline
+			sum[item] = acc
+		}
+	}
+	add(localSupply())
+	peerLock.RLock()
+	for _, p := range Peers {
+		if p.Relation != 2 {
+			add(p.Supply)
+		}
+	}
+	peerLock.RUnlock()
+	return sum
+}
+
+func supplyFactor(v SupplyVolume) float64 {
+	if v.Baseline <= 0 {
+		return 1.0
+	}
+	if v.Recent <= 0 {
+		return MaxSupplyFactor
+	}
+	f := math.Sqrt(float64(v.Baseline) / float64(v.Recent))
+	return math.Max(MinSupplyFactor, math.Min(MaxSupplyFactor, f))
+}
+
+func itemSupplyFactor(item string) float64 {
+	return supplyFactor(galaxySupply()[item])
+}
+
+// Burn payout multiplier per item, for every item the galaxy has moved
+func supplyIndex() map[string]float64 {
+	index := make(map[string]float64)
+	for item, v := range galaxySupply() {
+		index[item] = supplyFactor(v)
+	}
+	return index
+}
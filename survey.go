@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// --- Surveys ---
+// Sector data is a pure function of the genesis hash and coordinates, so it is computed once
+// and kept in sectorCache (dropped wholesale past SectorCacheSize). A point scan's lookups of
+// the charted system and its ownership proof are kept for the rest of the tick, so repeated
+// scans of a sector within a tick touch neither the hash nor the DB.
+//
+// POST /api/scan is a basic scan: resource potentials are given to the nearest
+// BasicScanStep. A fleet carrying a probe_scanner can run a detailed survey of the system it
+// orbits (POST /api/fleet/survey) for SurveyFuel of its fuel and SurveyCredits credits; the
+// survey returns exact potentials and the exact extraction efficiency of every colony there,
+// and from then on the surveying player's scans of that system are exact too.
+
+const (
+	SectorCacheSize = 8192
+	BasicScanStep   = 0.5
+	SurveyFuel      = 500
+	SurveyCredits   = 200
+
+	SurveyBasic    = "basic"
+	SurveyDetailed = "detailed"
+)
+
+// Resources whose colony efficiency a survey reveals (see simulateColony)
+var surveyedResources = []string{"food", "iron", "carbon", "uranium_ore", "platinum_ore", "diamond_ore"}
+
+type sectorKey struct {
+	Genesis string
+	X, Y, Z int
+}
+
+type sectorEntry struct {
+	Sector SectorPotential
+
+	// Point-scan lookups, good for Tick only
+	Tick    int64
+	Looked  bool
+	Charted bool
+	Name    string
+	Proof   *ScanProof
+}
+
+var (
+	sectorCache     = make(map[sectorKey]*sectorEntry)
+	sectorCacheLock sync.Mutex
+)
+
+// Caller holds sectorCacheLock
+func sectorEntryAt(x, y, z int) *sectorEntry {
+	key := sectorKey{GenesisHash, x, y, z}
+	e := sectorCache[key]
+	if e == nil {
+		if len(sectorCache) >= SectorCacheSize {
+			sectorCache = make(map[sectorKey]*sectorEntry)
+		}
+		e = &sectorEntry{Sector: GetSectorData(x, y, z)}
+		sectorCache[key] = e
+	}
+	return e
+}
+
+// GetSectorData through the cache; callers must not modify the returned Resources
+func cachedSectorData(x, y, z int) SectorPotential {
+	sectorCacheLock.Lock()
+	defer sectorCacheLock.Unlock()
+	return sectorEntryAt(x, y, z).Sector
+}
+
+// Sector data plus whether the system is charted, its name and its proof, as of this tick
+func scanSector(x, y, z int) (data SectorPotential, charted bool, proof *ScanProof) {
+	tick := atomic.LoadInt64(&CurrentTick)
+	sectorCacheLock.Lock()
+	e := sectorEntryAt(x, y, z)
+	if e.Looked && e.Tick == tick {
+		data, charted, proof = e.Sector, e.Charted, e.Proof
+		data.Name = e.Name
+		sectorCacheLock.Unlock()
+		return
+	}
+	data = e.Sector
+	sectorCacheLock.Unlock()
+
+	var name string
+	if s, ok := systemAt(x, y, z); ok {
+		charted, name = true, s.Name
+	}
+	if data.HasSystem || charted {
+		proof = scanProofAt(x, y, z)
+	}
+
+	sectorCacheLock.Lock()
+	e.Tick, e.Looked, e.Charted, e.Name, e.Proof = tick, true, charted, name, proof
+	sectorCacheLock.Unlock()
+	data.Name = name
+	return
+}
+
+// Potentials rounded to the basic scan's resolution
+func basicResources(exact map[string]float64) map[string]float64 {
+	coarse := make(map[string]float64, len(exact))
+	for res, v := range exact {
+		coarse[res] = math.Round(v/BasicScanStep) * BasicScanStep
+	}
+	return coarse
+}
+
+func hasSurveyed(userID, sysID string) bool {
+	var n int
+	db.QueryRow("SELECT count(*) FROM surveys WHERE user_uuid=? AND system_id=?", userID, sysID).Scan(&n)
+	return n > 0
+}
+
+type SurveyReport struct {
+	SystemID     string                     `json:"system_id"`
+	Tick         int64                      `json:"tick"`
+	Sector       SectorPotential            `json:"sector"`
+	Efficiencies map[int]map[string]float64 `json:"efficiencies"` // colony id -> resource -> multiplier
+	FuelLeft     int                        `json:"fuel_left"`
+}
+
+// POST {"fleet_id"}: detailed survey of the system an orbiting probe fleet is in
+func handleFleetSurvey(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	var req struct {
+		FleetID int `json:"fleet_id" validate:"required"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	defer lockRows(userRow(userID))()
+
+	var f Fleet
+	var modJson string
+	err = db.QueryRow("SELECT owner_uuid, status, origin_system, dest_system, fuel, modules_json FROM fleets WHERE id=?", req.FleetID).
+		Scan(&f.OwnerUUID, &f.Status, &f.OriginSystem, &f.DestSystem, &f.Fuel, &modJson)
+	if err != nil {
+		http.Error(w, "Fleet Not Found", 404)
+		return
+	}
+	if f.OwnerUUID != userID {
+		http.Error(w, "Not your fleet", 403)
+		return
+	}
+	json.Unmarshal([]byte(modJson), &f.Modules)
+	onStation := f.Status == "ORBIT" || f.Status == "SCANNING" || (f.Status == FleetPatrol && f.OriginSystem == f.DestSystem)
+	if !onStation {
+		http.Error(w, "Fleet must be in orbit", 400)
+		return
+	}
+	if !hasModule(f.Modules, "probe_scanner") {
+		http.Error(w, "Fleet needs a probe_scanner", 400)
+		return
+	}
+	if f.Fuel < SurveyFuel {
+		http.Error(w, fmt.Sprintf("Insufficient Fuel (need %d)", SurveyFuel), 402)
+		return
+	}
+
+	pos := GetSystemCoords(f.OriginSystem)
+	report := SurveyReport{SystemID: f.OriginSystem, Tick: atomic.LoadInt64(&CurrentTick),
+		Sector: cachedSectorData(pos[0], pos[1], pos[2]), Efficiencies: make(map[int]map[string]float64), FuelLeft: f.Fuel - SurveyFuel}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+	if !escrowCredits(tx, userID, SurveyCredits) {
+		tx.Rollback()
+		http.Error(w, fmt.Sprintf("Insufficient Credits (need %d)", SurveyCredits), 402)
+		return
+	}
+	tx.Exec("UPDATE fleets SET fuel = fuel - ? WHERE id=?", SurveyFuel, req.FleetID)
+	tx.Exec("INSERT OR REPLACE INTO surveys (user_uuid, system_id, tick) VALUES (?, ?, ?)", userID, f.OriginSystem, report.Tick)
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+
+	rows, err := db.Query("SELECT id FROM colonies WHERE system_id=?", f.OriginSystem)
+	if err == nil {
+		for rows.Next() {
+			var id int
+			rows.Scan(&id)
+			eff := make(map[string]float64, len(surveyedResources))
+			for _, res := range surveyedResources {
+				eff[res] = GetEfficiency(id, res)
+			}
+			report.Efficiencies[id] = eff
+		}
+		rows.Close()
+	}
+	InfoLog.Printf("🔭 Fleet %d surveyed %s", req.FleetID, f.OriginSystem)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+)
+
+// --- Parallel Colony Tick ---
+// tickWorld loads every colony, fans the pure per-colony simulation out over TickWorkers
+// goroutines in contiguous chunks, and writes the results in one transaction.
+
+var TickWorkers = runtime.NumCPU()
+
+// Below this many colonies the goroutine overhead isn't worth it
+const ParallelTickMin = 64
+
+type tickEnv struct {
+	CultureByID    map[int]float64
+	CultureByOwner map[string]float64
+	Capitals       map[string]capitalInfo
+	RefineryBusy   map[int]map[string]int // colony -> building -> lines on conversion contracts
+	Economy        EconomyControls
+	Events         []WorldEvent // this node's running world events
+}
+
+type colonyJob struct {
+	Colony  Colony
+	TaxRate float64
+	Pos     []int
+	Star    string
+}
+
+type colonyResult struct {
+	Update      ColUpdate
+	Credits     []UserCreditUpdate
+	Research    int
+	Rebel       bool
+	RebelState  Colony
+	Secede      bool
+	SecedeState Colony
+}
+
+// Results come back in job order regardless of which worker ran them
+func runColonyJobs(jobs []colonyJob, env *tickEnv) []colonyResult {
+	results := make([]colonyResult, len(jobs))
+	workers := TickWorkers
+	if len(jobs) < ParallelTickMin || workers < 2 {
+		workers = 1
+	}
+	chunk := (len(jobs) + workers - 1) / workers
+
+	var wg sync.WaitGroup
+	for start := 0; start < len(jobs); start += chunk {
+		end := start + chunk
+		if end > len(jobs) {
+			end = len(jobs)
+		}
+		wg.Add(1)
+		go func(lo, hi int) {
+			defer wg.Done()
+			for i := lo; i < hi; i++ {
+				results[i] = simulateColony(jobs[i].Colony, jobs[i].TaxRate, jobs[i].Pos, jobs[i].Star, env)
+			}
+		}(start, end)
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// --- Peer-Assisted Clock ---
+// Rather than trusting the leader's tick alone, the reference tick is the median of what
+// recently-heard, reputable peers report (projected forward to now). A single broken or
+// malicious node cannot move the median; the leader is only followed alone when too few
+// peers are available to vote.
+
+const (
+	MinClockSamples    = 3
+	ClockSampleWindow  = 3 * HeartbeatInterval
+	MinClockReputation = 10.0
+)
+
+func medianTick(ticks []int64) int64 {
+	sorted := append([]int64(nil), ticks...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// Median projected tick of eligible peers and how many voted
+func clockReference(peers []Peer, now time.Time, tickMs int64) (int64, int) {
+	var ticks []int64
+	for _, p := range peers {
+		if p.Relation == 2 || p.Reputation < MinClockReputation || p.LastTick == 0 {
+			continue
+		}
+		age := now.Sub(p.LastSeen)
+		if age < 0 || age > ClockSampleWindow {
+			continue
+		}
+		projected := p.LastTick
+		if tickMs > 0 {
+			projected += age.Milliseconds() / tickMs
+		}
+		ticks = append(ticks, projected)
+	}
+	if len(ticks) == 0 {
+		return 0, 0
+	}
+	return medianTick(ticks), len(ticks)
+}
+
+// Called for every verified heartbeat
+func syncFromPeers(senderUUID string, senderTick int64) {
+	peerLock.RLock()
+	peers := make([]Peer, 0, len(Peers))
+	for _, p := range Peers {
+		peers = append(peers, *p)
+	}
+	peerLock.RUnlock()
+
+	ref, votes := clockReference(peers, time.Now(), atomic.LoadInt64(&TickDuration))
+	if votes >= MinClockSamples {
+		syncClock(ref)
+		return
+	}
+	// Too small a federation to vote: fall back to the leader
+	if senderUUID == LeaderUUID {
+		syncClock(senderTick)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// --- Tolls ---
+// A node's space is the set of systems it owns (owner_uuid = ServerUUID). Operators may charge
+// fleets that arrive there without a colony of their own in the system: a flat transit toll per
+// arrival, and a share of the value of any market fill they make. Tolls go to the node treasury
+// (a users row keyed by ServerUUID) and are advertised in handshakes and heartbeats so other
+// nodes can route around expensive space. A cap voted by the galactic council (see council.go)
+// holds both below its own values, whatever the operator sets.
+
+const (
+	MaxTransitToll  = 10000
+	MaxTradeTollPct = 0.25
+	TreasuryName    = "@treasury" // outside usernameRegex, so no player can claim it
+)
+
+type TollSchedule struct {
+	Transit  int     `json:"transit"`   // credits per foreign fleet arrival
+	TradePct float64 `json:"trade_pct"` // share of a foreign market fill's value
+}
+
+var (
+	tolls    TollSchedule
+	tollCap  *TollSchedule
+	tollLock sync.RWMutex
+)
+
+func loadTolls() {
+	var transit, pct string
+	db.QueryRow("SELECT value FROM system_meta WHERE key='toll_transit'").Scan(&transit)
+	db.QueryRow("SELECT value FROM system_meta WHERE key='toll_trade_pct'").Scan(&pct)
+
+	var capJson string
+	db.QueryRow("SELECT value FROM system_meta WHERE key='toll_cap'").Scan(&capJson)
+
+	tollLock.Lock()
+	tolls.Transit, _ = strconv.Atoi(transit)
+	tolls.TradePct, _ = strconv.ParseFloat(pct, 64)
+	tollCap = nil
+	if capJson != "" {
+		tollCap = &TollSchedule{}
+		json.Unmarshal([]byte(capJson), tollCap)
+	}
+	tollLock.Unlock()
+}
+
+// The operator's schedule, held under the council's cap
+func currentTolls() TollSchedule {
+	tollLock.RLock()
+	defer tollLock.RUnlock()
+	t := tolls
+	if tollCap != nil {
+		if t.Transit > tollCap.Transit {
+			t.Transit = tollCap.Transit
+		}
+		if t.TradePct > tollCap.TradePct {
+			t.TradePct = tollCap.TradePct
+		}
+	}
+	return t
+}
+
+// nil lifts the cap
+func setTollCap(c *TollSchedule) {
+	if c == nil {
+		db.Exec("DELETE FROM system_meta WHERE key='toll_cap'")
+	} else {
+		capJson, _ := json.Marshal(c)
+		db.Exec("INSERT OR REPLACE INTO system_meta (key, value) VALUES ('toll_cap', ?)", string(capJson))
+	}
+
+	tollLock.Lock()
+	tollCap = c
+	tollLock.Unlock()
+}
+
+func setTolls(t TollSchedule) {
+	db.Exec("INSERT OR REPLACE INTO system_meta (key, value) VALUES ('toll_transit', ?)", strconv.Itoa(t.Transit))
+	db.Exec("INSERT OR REPLACE INTO system_meta (key, value) VALUES ('toll_trade_pct', ?)", strconv.FormatFloat(t.TradePct, 'f', -1, 64))
+
+	tollLock.Lock()
+	tolls = t
+	tollLock.Unlock()
+}
+
+// The fleet owner is a visitor in sysID: the system is ours and they have no colony there
+func tollable(userID, sysID string) bool {
+	if s, _ := lookupSystem(sysID); s.Owner != ServerUUID {
+		return false
+	}
+	var colonies int
+	db.QueryRow("SELECT count(*) FROM colonies WHERE system_id=? AND owner_uuid=?", sysID, userID).Scan(&colonies)
+	return colonies == 0
+}
+
+func tradeToll(value int, pct float64) int {
+	if value <= 0 || pct <= 0 {
+		return 0
+	}
+	return int(float64(value) * pct)
+}
+
+// Moves up to amount credits from the user to the treasury inside tx; returns what was paid
+func collectToll(tx *sql.Tx, userID string, amount int) int {
+	if amount <= 0 {
+		return 0
+	}
+	var credits int
+	tx.QueryRow("SELECT credits FROM users WHERE global_uuid=?", userID).Scan(&credits)
+	if credits < amount {
+		amount = credits // what they can pay; the fleet isn't held in orbit over it
+	}
+	if amount <= 0 {
+		return 0
+	}
+	tx.Exec("UPDATE users SET credits = credits - ? WHERE global_uuid=?", amount, userID)
+	tx.Exec(`INSERT INTO users (global_uuid, username, credits) VALUES (?, ?, ?)
+	         ON CONFLICT(global_uuid) DO UPDATE SET credits = credits + excluded.credits`, ServerUUID, TreasuryName, amount)
+	return amount
+}
+
+// Charges the transit toll for a fleet arriving in sysID
+func chargeTransitToll(f Fleet, sysID string) {
+	t := currentTolls()
+	if t.Transit <= 0 || !tollable(f.OwnerUUID, sysID) {
+		return
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+	paid := collectToll(tx, f.OwnerUUID, t.Transit)
+	tx.Commit()
+	if paid > 0 {
+		InfoLog.Printf("🚧 Fleet %d paid a %d credit toll entering %s", f.ID, paid, sysID)
+	}
+}
+
+func treasuryBalance() int {
+	var credits int
+	db.QueryRow("SELECT credits FROM users WHERE global_uuid=?", ServerUUID).Scan(&credits)
+	return credits
+}
+
+// GET: schedule (after any council cap), the cap and treasury balance. POST {"transit", "trade_pct"}: set the schedule.
+func handleAdminTolls(w http.ResponseWriter, r *http.Request) {
+	if !authenticateAdmin(r) {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var req TollSchedule
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		if req.Transit < 0 || req.Transit > MaxTransitToll || req.TradePct < 0 || req.TradePct > MaxTradeTollPct {
+			http.Error(w, "Tolls out of range (transit 0-10000, trade_pct 0-0.25)", 400)
+			return
+		}
+		setTolls(req)
+		InfoLog.Printf("🚧 Tolls set: transit %d, trade %.1f%%", req.Transit, req.TradePct*100)
+	}
+
+	tollLock.RLock()
+	limit := tollCap
+	tollLock.RUnlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tolls":    currentTolls(),
+		"cap":      limit,
+		"treasury": treasuryBalance(),
+	})
+}
@@ -2,38 +2,31 @@ package main
 
 import (
 	"bufio"
-	"bytes"
-	"encoding/json"
+	"encoding/csv"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"text/tabwriter"
+	"time"
+
+	"ownworld/pkg/client"
 )
 
 var ServerURL = "http://localhost:8080"
 var CurrentUser string
-var CurrentUserID int
 var HomeSystemID string
+var SessionExpires time.Time
 
-// --- Models ---
-type RegisterResponse struct {
-	UserID   int    `json:"user_id"`
-	SystemID string `json:"system_id"`
-	Status   string `json:"status"`
-}
-
-type StatusResponse struct {
-	UUID   string `json:"uuid"`
-	Tick   int    `json:"tick"`
-	Leader string `json:"leader"`
-}
+var api *client.Client
 
 func main() {
 	if url := os.Getenv("OWNWORLD_SERVER"); url != "" {
 		ServerURL = url
 	}
+	api = client.New(ServerURL)
 
 	reader := bufio.NewReader(os.Stdin)
 	fmt.Println("OwnWorld Federation Client v2.3")
@@ -50,7 +43,7 @@ func main() {
 		// --- Main Command Loop ---
 		fmt.Println("\n--- COMMAND LINK ESTABLISHED ---")
 		fmt.Printf("Welcome, Commander %s.\n", CurrentUser)
-		fmt.Println("Commands: status, build, burn, launch, help, logout, quit")
+		fmt.Println("Commands: status, motd, scan, name, build, construct, burn, launch, deploy, transfer, import, help, logout, quit")
 
 		logout := false
 		for !logout {
@@ -65,9 +58,18 @@ func main() {
 
 			cmd := parts[0]
 
+			if !keepSessionAlive() {
+				fmt.Println("Session expired. Please log in again.")
+				CurrentUser = ""
+				api.UserUUID, api.Token = "", ""
+				break
+			}
+
 			switch cmd {
 			case "status":
 				doStatus()
+			case "motd":
+				doNotice()
 			case "build":
 				if len(parts) < 4 {
 					fmt.Println("Usage: build <colony_id> <structure> <amount>")
@@ -85,26 +87,107 @@ func main() {
 				colID, _ := strconv.Atoi(parts[1])
 				doBurn(colID, parts[2], amt)
 			case "launch":
+				if len(parts) < 3 {
+					fmt.Println("Usage: launch <fleet_id> <dest_system> [order_id]")
+					continue
+				}
+				fleetID, _ := strconv.Atoi(parts[1])
+				orderID := ""
+				if len(parts) > 3 {
+					orderID = parts[3]
+				}
+				doLaunch(fleetID, parts[2], orderID)
+			case "scan":
+				if len(parts) < 4 {
+					fmt.Println("Usage: scan <x> <y> <z>")
+					continue
+				}
+				x, errX := strconv.Atoi(parts[1])
+				y, errY := strconv.Atoi(parts[2])
+				z, errZ := strconv.Atoi(parts[3])
+				if errX != nil || errY != nil || errZ != nil {
+					fmt.Println("Coordinates must be integers")
+					continue
+				}
+				doScan(x, y, z)
+			case "name":
+				if len(parts) < 3 {
+					fmt.Println("Usage: name <system_id> <star name>")
+					continue
+				}
+				name := strings.Join(parts[2:], " ")
+				if confirm(reader, fmt.Sprintf("Name %s '%s'? Names are permanent.", parts[1], name)) {
+					doName(parts[1], name)
+				}
+			case "construct":
+				if len(parts) < 3 {
+					fmt.Println("Usage: construct <colony_id> <hull_class> [module,module,...]")
+					continue
+				}
+				colID, _ := strconv.Atoi(parts[1])
+				var modules []string
+				if len(parts) > 3 {
+					modules = strings.Split(parts[3], ",")
+				}
+				if confirm(reader, fmt.Sprintf("Lay down a %s hull at colony %d (1000 iron, 50 crew, modules from stock)?", parts[2], colID)) {
+					doConstruct(colID, parts[2], modules)
+				}
+			case "deploy":
+				if len(parts) < 3 {
+					fmt.Println("Usage: deploy <fleet_id> <colony name>")
+					continue
+				}
+				fleetID, _ := strconv.Atoi(parts[1])
+				name := strings.Join(parts[2:], " ")
+				if confirm(reader, fmt.Sprintf("Consume fleet %d to found colony '%s'?", fleetID, name)) {
+					doDeploy(fleetID, name)
+				}
+			case "transfer":
 				if len(parts) < 4 {
-					fmt.Println("Usage: launch <fleet_id> <dest_system_uuid> <distance>")
+					fmt.Println("Usage: transfer <fleet_id> <colony_id> <item>=<amt> [...]  (positive loads, negative unloads)")
 					continue
 				}
 				fleetID, _ := strconv.Atoi(parts[1])
-				dist, _ := strconv.Atoi(parts[3])
-				doLaunch(fleetID, parts[2], dist)
+				colID, _ := strconv.Atoi(parts[2])
+				transfers, err := parseTransfers(parts[3:])
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					continue
+				}
+				doTransfer(fleetID, colID, transfers)
+			case "import":
+				if len(parts) < 2 {
+					fmt.Println("Usage: import <orders.csv>  (columns: item,quantity,price,side,origin_system)")
+					continue
+				}
+				orders, err := readOrderCSV(parts[1])
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					continue
+				}
+				if confirm(reader, fmt.Sprintf("List %d orders from %s (listing fees apply)?", len(orders), parts[1])) {
+					doImportOrders(orders)
+				}
 			case "help":
 				fmt.Println("Available Commands:")
 				fmt.Println("  status                         - Check server tick and leader")
+				fmt.Println("  motd                           - Show the server's notice and rules")
+				fmt.Println("  scan <x> <y> <z>               - Survey a sector's star, resources and hazards")
+				fmt.Println("  name <sysID> <name>            - Name a system you discovered")
 				fmt.Println("  build <colID> <struct> <amt>   - Construct buildings")
+				fmt.Println("  construct <colID> <hull> [mods]- Lay down a ship (mods comma-separated)")
 				fmt.Println("  burn <colID> <item> <amt>      - Sell resources to the bank")
-				fmt.Println("  launch <fid> <dest> <dist>     - Send fleet to another system")
+				fmt.Println("  launch <fid> <dest> [order]    - Send fleet to another system")
+				fmt.Println("  deploy <fid> <name>            - Found a colony with an ark fleet")
+				fmt.Println("  transfer <fid> <colID> i=n ... - Load (+) or unload (-) cargo")
+				fmt.Println("  import <file.csv>              - List market orders in bulk")
 				fmt.Println("  logout                         - Return to login screen")
 				fmt.Println("  quit                           - Disconnect")
 			case "logout":
 				fmt.Println("Logging out...")
 				logout = true
 				CurrentUser = ""
-				CurrentUserID = 0
+				api.UserUUID, api.Token = "", ""
 			case "quit", "exit":
 				fmt.Println("Disconnecting...")
 				os.Exit(0)
@@ -137,121 +220,295 @@ func loginLoop(reader *bufio.Reader) bool {
 		fmt.Print("Connecting... ")
 		if doRegister(user, pass) {
 			CurrentUser = user
+			doNotice()
 			return true
 		} else {
-			fmt.Println("Login Failed: Invalid credentials or username taken.")
 			fmt.Println("Try again or type 'quit' to exit.")
 		}
 	}
 }
 
+// Renews the session token when it's within a day of lapsing; false once it has
+func keepSessionAlive() bool {
+	if SessionExpires.IsZero() || time.Until(SessionExpires) > 24*time.Hour { // zero: node without expiry
+		return true
+	}
+	expires, err := api.RefreshSession()
+	if err != nil {
+		return time.Now().Before(SessionExpires)
+	}
+	SessionExpires = time.Unix(expires, 0)
+	return true
+}
+
 func doStatus() {
-	resp, err := http.Get(ServerURL + "/api/status")
+	s, err := api.Status()
 	if err != nil {
 		fmt.Printf("Error: %v\n", err)
 		return
 	}
-	defer resp.Body.Close()
-	body, _ := io.ReadAll(resp.Body)
 
-	var s StatusResponse
-	json.Unmarshal(body, &s)
-	
-	if s.Leader == "" { s.Leader = "Unknown" }
-	if s.UUID == "" { s.UUID = "Unknown" }
+	if s.Leader == "" {
+		s.Leader = "Unknown"
+	}
+	if s.UUID == "" {
+		s.UUID = "Unknown"
+	}
 
 	leaderDisp := s.Leader
-	if len(s.Leader) > 8 { leaderDisp = s.Leader[:8] }
+	if len(s.Leader) > 8 {
+		leaderDisp = s.Leader[:8]
+	}
 	uuidDisp := s.UUID
-	if len(s.UUID) > 8 { uuidDisp = s.UUID[:8] }
+	if len(s.UUID) > 8 {
+		uuidDisp = s.UUID[:8]
+	}
 
 	fmt.Printf("Tick: %d | Leader: %s | UUID: %s\n", s.Tick, leaderDisp, uuidDisp)
 }
 
-func doRegister(user, pass string) bool {
-	payload := map[string]string{"username": user, "password": pass}
-	data, _ := json.Marshal(payload)
+// Shows the node's message of the day, rules and contact, if the operator set any
+func doNotice() {
+	s, err := api.Status()
+	if err != nil || (s.MOTD == "" && s.Rules == "" && s.Contact == "") {
+		return
+	}
+	fmt.Println("\n--- SERVER NOTICE ---")
+	if s.MOTD != "" {
+		fmt.Println(s.MOTD)
+	}
+	if s.Rules != "" {
+		fmt.Printf("\nRules:\n%s\n", s.Rules)
+	}
+	if s.Contact != "" {
+		fmt.Printf("\nContact: %s\n", s.Contact)
+	}
+}
 
-	resp, err := http.Post(ServerURL+"/api/register", "application/json", bytes.NewBuffer(data))
+// Logs in, or registers the name if this node has no such account
+func doRegister(user, pass string) bool {
+	s, err := api.Login(user, pass)
+	if apiErr, ok := err.(*client.APIError); ok && (apiErr.Code == "user_not_found" || apiErr.Code == "") && apiErr.Status == 404 {
+		// No such account (or a node from before /api/login): register it
+		s, err = api.Register(user, pass)
+	}
 	if err != nil {
-		fmt.Printf("Connection Error: %v\n", err)
+		apiErr, ok := err.(*client.APIError)
+		switch {
+		case !ok:
+			fmt.Printf("Connection Error: %v\n", err)
+		case apiErr.Code == "wrong_password":
+			fmt.Println("Login Failed: wrong password.")
+		default:
+			fmt.Printf("Login Failed: %s\n", apiErr.Message)
+		}
 		return false
 	}
-	defer resp.Body.Close()
 
-	body, _ := io.ReadAll(resp.Body)
-	
-	// Server returns 400 if user exists/taken/wrong pass (in this MVP logic)
-	if resp.StatusCode != 200 {
-		// Log internal error for debugging if verbose, but return false to loop
-		return false
+	HomeSystemID = s.SystemID
+	SessionExpires = time.Time{}
+	if s.ExpiresAt > 0 {
+		SessionExpires = time.Unix(s.ExpiresAt, 0)
 	}
-
-	var r RegisterResponse
-	if err := json.Unmarshal(body, &r); err != nil {
-		fmt.Printf("Protocol Error: %v\n", err)
-		return false
+	fmt.Printf("Success! %s System: %s\n", s.Message, s.SystemID)
+	if s.FailedLogins > 0 {
+		fmt.Printf("Warning: %d failed login attempts on this account since your last login.\n", s.FailedLogins)
 	}
-	
-	CurrentUserID = r.UserID
-	HomeSystemID = r.SystemID
-	fmt.Printf("Success! User ID: %d, System: %s\n", r.UserID, r.SystemID)
 	return true
 }
 
 func doBuild(colID int, structure string, amount int) {
-	payload := map[string]interface{}{
-		"colony_id": colID,
-		"structure": structure,
-		"amount":    amount,
+	msg, err := api.Build(colID, structure, amount)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
 	}
-	data, _ := json.Marshal(payload)
+	fmt.Printf("Response: %s\n", msg)
+}
 
-	resp, err := http.Post(ServerURL+"/api/build", "application/json", bytes.NewBuffer(data))
+func doBurn(colID int, item string, amount int) {
+	msg, err := api.Burn(colID, item, amount)
 	if err != nil {
 		fmt.Printf("Error: %v\n", err)
 		return
 	}
-	defer resp.Body.Close()
+	fmt.Printf("Bank Receipt: %s\n", msg)
+}
 
-	body, _ := io.ReadAll(resp.Body)
-	fmt.Printf("Response: %s\n", string(body))
+func doLaunch(fleetID int, dest string, orderID string) {
+	msg, err := api.Launch(fleetID, dest, orderID)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Printf("Mission Status: %s\n", msg)
 }
 
-func doBurn(colID int, item string, amount int) {
-	payload := map[string]interface{}{
-		"colony_id": colID,
-		"item":      item,
-		"amount":    amount,
+// Asks before actions that spend a lot or can't be undone
+func confirm(reader *bufio.Reader, prompt string) bool {
+	fmt.Printf("%s [y/N] ", prompt)
+	answer, _ := reader.ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	if answer == "y" || answer == "yes" {
+		return true
 	}
-	data, _ := json.Marshal(payload)
+	fmt.Println("Cancelled.")
+	return false
+}
 
-	resp, err := http.Post(ServerURL+"/api/bank/burn", "application/json", bytes.NewBuffer(data))
+func doScan(x, y, z int) {
+	s, err := api.Scan(x, y, z)
 	if err != nil {
 		fmt.Printf("Error: %v\n", err)
 		return
 	}
-	defer resp.Body.Close()
+	if s.Message != "" {
+		fmt.Printf("Scanner: %s\n", s.Message)
+	}
+	if !s.HasSystem {
+		fmt.Printf("Sector [%d, %d, %d]: empty space.\n", x, y, z)
+		return
+	}
 
-	body, _ := io.ReadAll(resp.Body)
-	fmt.Printf("Bank Receipt: %s\n", string(body))
+	if s.Name != "" {
+		fmt.Printf("Sector [%d, %d, %d]: %s (%s star)\n", x, y, z, s.Name, s.SystemType)
+	} else {
+		fmt.Printf("Sector [%d, %d, %d]: %s star\n", x, y, z, s.SystemType)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "RESOURCE\tYIELD\t")
+	names := make([]string, 0, len(s.Resources))
+	for name := range s.Resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(tw, "%s\t%.2f\t\n", name, s.Resources[name])
+	}
+	fmt.Fprintf(tw, "hazards\t%.2f\t\n", s.Hazards)
+	tw.Flush()
+
+	switch {
+	case s.Hazards >= 0.7:
+		fmt.Println("Warning: extreme hazards, colonists will struggle here.")
+	case s.Hazards >= 0.4:
+		fmt.Println("Note: moderate hazards.")
+	}
 }
 
-func doLaunch(fleetID int, dest string, distance int) {
-	payload := map[string]interface{}{
-		"fleet_id":    fleetID,
-		"dest_system": dest,
-		"distance":    distance,
+func doConstruct(colID int, hull string, modules []string) {
+	msg, err := api.Construct(colID, hull, modules, nil)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
 	}
-	data, _ := json.Marshal(payload)
+	fmt.Printf("Shipyard: %s\n", msg)
+}
 
-	resp, err := http.Post(ServerURL+"/api/fleet/launch", "application/json", bytes.NewBuffer(data))
+func doDeploy(fleetID int, name string) {
+	msg, err := api.Deploy(fleetID, name)
 	if err != nil {
 		fmt.Printf("Error: %v\n", err)
 		return
 	}
-	defer resp.Body.Close()
+	fmt.Printf("Colony Report: %s\n", msg)
+}
 
-	body, _ := io.ReadAll(resp.Body)
-	fmt.Printf("Mission Status: %s\n", string(body))
+// Parses item=amount pairs, e.g. iron=500 laborers=-100
+func parseTransfers(args []string) (map[string]int, error) {
+	out := make(map[string]int)
+	for _, arg := range args {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("expected item=amount, got %q", arg)
+		}
+		amt, err := strconv.Atoi(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("bad amount for %s: %q", kv[0], kv[1])
+		}
+		out[kv[0]] += amt
+	}
+	return out, nil
+}
+
+func doTransfer(fleetID, colID int, transfers map[string]int) {
+	msg, err := api.Transfer(fleetID, colID, transfers)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Printf("Cargo Manifest: %s\n", msg)
+}
+
+func doName(systemID, name string) {
+	msg, err := api.NameSystem(systemID, name)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	fmt.Printf("Star Charts: %s\n", msg)
+}
+
+// Reads market orders from CSV: item,quantity,price,side,origin_system where side is buy or
+// sell. A header row (starting with "item") and blank lines are skipped.
+func readOrderCSV(path string) ([]client.Order, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseOrderCSV(f)
+}
+
+func parseOrderCSV(r io.Reader) ([]client.Order, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 5
+	cr.TrimLeadingSpace = true
+
+	var orders []client.Order
+	for line := 1; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == 1 && strings.EqualFold(rec[0], "item") {
+			continue
+		}
+		qty, errQ := strconv.Atoi(rec[1])
+		price, errP := strconv.Atoi(rec[2])
+		if errQ != nil || errP != nil {
+			return nil, fmt.Errorf("line %d: quantity and price must be integers", line)
+		}
+		side := strings.ToLower(rec[3])
+		if side != "buy" && side != "sell" {
+			return nil, fmt.Errorf("line %d: side must be buy or sell, got %q", line, rec[3])
+		}
+		orders = append(orders, client.Order{
+			Item: rec[0], Quantity: qty, Price: price, IsBuy: side == "buy", OriginSystem: rec[4],
+		})
+	}
+	if len(orders) == 0 {
+		return nil, fmt.Errorf("no orders in file")
+	}
+	return orders, nil
+}
+
+// Sends orders in batches of 100; each batch is placed whole or not at all
+func doImportOrders(orders []client.Order) {
+	const batch = 100
+	for start := 0; start < len(orders); start += batch {
+		end := start + batch
+		if end > len(orders) {
+			end = len(orders)
+		}
+		res, err := api.PlaceOrders(orders[start:end])
+		if err != nil {
+			fmt.Printf("Error in orders %d-%d (none of them were placed): %v\n", start+1, end, err)
+			return
+		}
+		fmt.Printf("Market: listed %d orders (fee %d)\n", len(res.OrderIDs), res.Fee)
+	}
 }
@@ -0,0 +1,50 @@
+package main
+
+// --- Trading Posts ---
+// Market orders are listed through a trading_post in the order's origin system. More posts
+// (levels) raise how many live orders the system may carry and lower the listing fee. If
+// bombardment levels the last post, the system's listings are voided.
+
+const (
+	OrdersPerPostLevel = 5
+	BaseListingFeePct  = 5 // percent of order value at level 1
+	MinListingFeePct   = 1
+	OrderLifetimeTicks = 1440 // 1 day (approx)
+)
+
+func listingFeePct(level int) int {
+	pct := BaseListingFeePct - (level - 1)
+	if pct < MinListingFeePct {
+		pct = MinListingFeePct
+	}
+	return pct
+}
+
+// Fee in credits for listing an order of the given value; never zero for a real order
+func listingFee(level, value int) int {
+	if value <= 0 {
+		return 0
+	}
+	fee := scaleCredits(value*listingFeePct(level)/100, currentEconomy().MarketFee)
+	if fee < 1 {
+		fee = 1
+	}
+	return fee
+}
+
+func orderLimit(level int) int {
+	return level * OrdersPerPostLevel
+}
+
+// Drops every live listing in a system whose trading post was destroyed
+func voidSystemListings(systemID string) int {
+	res, err := db.Exec("DELETE FROM market_orders WHERE origin_system=?", systemID)
+	if err != nil {
+		return 0
+	}
+	n, _ := res.RowsAffected()
+	if n > 0 {
+		InfoLog.Printf("📉 Trading post at %s destroyed; %d listings voided", systemID, n)
+	}
+	return int(n)
+}
@@ -6,43 +6,104 @@ import (
 )
 
 type Peer struct {
-	UUID        string
-	Url         string
-	PublicKey   ed25519.PublicKey
-	GenesisHash string
-	PeerCount   int
-	CurrentTick int64
-	LastTick    int64
-	LastSeen    time.Time
-	Reputation  float64 
-	Relation    int // 0:Neutral, 1:Federated, 2:Hostile
-    Location    []int // [x, y, z]
+	UUID         string
+	Url          string
+	PublicKey    ed25519.PublicKey
+	GenesisHash  string
+	PeerCount    int
+	CurrentTick  int64
+	LastTick     int64
+	LastSeen     time.Time
+	Reputation   float64
+	Relation     int   // 0:Neutral, 1:Federated, 2:Hostile
+	Location     []int // [x, y, z]
+	LocationSalt int   // derivation salt, -1 for a location from before derivation (see location.go)
+
+	// Operational reliability (feeds leader election)
+	FirstSeen       time.Time
+	HeartbeatCount  int
+	SnapshotOK      bool
+	SnapshotChecked time.Time
+
+	// Whether the peer's address answered our last probe; gossip waits on it (see netaddr.go)
+	Reachable bool
+	ProbedAt  time.Time
+
+	// Feature flags advertised in the handshake (see features.go)
+	Features []string
+
+	// The peer's own peer list, from its last heartbeat (see graph.go)
+	Neighbors []string
+
+	// Tolls charged in the peer's space, from its handshake and heartbeats (see tolls.go)
+	Tolls TollSchedule
+
+	// Sensor anchors an ally shares in its heartbeats (see alliance.go)
+	Vision [][]int
+
+	// Beacons an ally shares in its heartbeats (see beacons.go)
+	Beacons []Beacon
+
+	// The peer's burn and trade volumes, from its heartbeats (see supplyindex.go)
+	Supply map[string]SupplyVolume
+
+	// The peer's economy multipliers, from its heartbeats (see econcontrols.go)
+	Economy EconomyControls
+
+	// Unforgiven grievance penalty and clean heartbeats since the last one (see reputation.go)
+	Grudge      float64
+	CleanStreak int
+	recordedRep float64
+}
+
+// Share of expected heartbeats actually received since we first saw the peer
+func (p *Peer) Uptime() float64 {
+	elapsed := time.Since(p.FirstSeen)
+	if p.FirstSeen.IsZero() || elapsed < 3*HeartbeatInterval {
+		return 1.0 // grace period for new peers
+	}
+	expected := float64(elapsed / HeartbeatInterval)
+	up := float64(p.HeartbeatCount) / expected
+	if up > 1.0 {
+		up = 1.0
+	}
+	return up
 }
 
 type MarketOrder struct {
-    ID           string `json:"id"`
-    SellerUUID   string `json:"seller_uuid"`
-    Item         string `json:"item"`
-    Quantity     int    `json:"quantity"`
-    Price        int    `json:"price"` // Per unit
-    IsBuy        bool   `json:"is_buy"` // True = Buy Order, False = Sell Order
-    OriginSystem string `json:"origin_system"` // System ID where the trade happens
-    ExpiresTick  int64  `json:"expires_tick"`
-    Signature    string `json:"signature"`
-    RelayCount   int    `json:"relay_count"` // TTL
+	ID           string `json:"id"`
+	SellerUUID   string `json:"seller_uuid"`
+	Item         string `json:"item" validate:"required"`
+	Quantity     int    `json:"quantity" validate:"required"`
+	Price        int    `json:"price"`         // Per unit
+	IsBuy        bool   `json:"is_buy"`        // True = Buy Order, False = Sell Order
+	OriginSystem string `json:"origin_system"` // System ID where the trade happens
+	ExpiresTick  int64  `json:"expires_tick"`
+	Signature    string `json:"signature"`
+	RelayCount   int    `json:"relay_count"`    // TTL
+	Node         string `json:"node,omitempty"` // node holding the order; empty = the sender
 }
 
 type HandshakeRequest struct {
-	UUID        string `json:"uuid"`
-	GenesisHash string `json:"genesis_hash"`
-	PublicKey   string `json:"public_key"`
-	Address     string `json:"address"`
-    Location    []int  `json:"location"` 
+	UUID         string       `json:"uuid"`
+	GenesisHash  string       `json:"genesis_hash"`
+	PublicKey    string       `json:"public_key"`
+	Address      string       `json:"address"`
+	Location     []int        `json:"location"`
+	LocationSalt *int         `json:"location_salt,omitempty"` // absent for a location from before derivation
+	InviteToken  string       `json:"invite_token,omitempty"`  // see handleAdminInvite
+	Features     []string     `json:"features,omitempty"`
+	Tolls        TollSchedule `json:"tolls"`
 }
 type HandshakeResponse struct {
-    Status   string `json:"status"`
-    UUID     string `json:"uuid"`
-    Location []int  `json:"location"` 
+	Status       string       `json:"status"`
+	UUID         string       `json:"uuid"`
+	Location     []int        `json:"location"`
+	LocationSalt *int         `json:"location_salt,omitempty"`
+	Features     []string     `json:"features,omitempty"`
+	Tolls        TollSchedule `json:"tolls"`
+	Reason       string       `json:"reason,omitempty"`        // why a handshake wasn't queued or accepted
+	ObservedAddr string       `json:"observed_addr,omitempty"` // the host the handshake came from (see netaddr.go)
 }
 
 type TransactionRequest struct {
@@ -53,99 +114,189 @@ type TransactionRequest struct {
 }
 
 type Colony struct {
-	ID            int            `json:"id"`
-	SystemID      string         `json:"system_id"`
-	OwnerUUID     string         `json:"owner_uuid"`
-	ParentID      int            `json:"parent_id"` 
-	Name          string         `json:"name"`
-	Buildings     map[string]int `json:"buildings"`
-	Policies      map[string]bool `json:"policies"` 
-	
-	PopLaborers   int `json:"pop_laborers"`
+	ID        int             `json:"id"`
+	SystemID  string          `json:"system_id"`
+	OwnerUUID string          `json:"owner_uuid"`
+	ParentID  int             `json:"parent_id"`
+	Name      string          `json:"name"`
+	SiteType  string          `json:"site_type,omitempty"` // planet, or an outpost's site (see outposts.go)
+	Buildings map[string]int  `json:"buildings"`
+	Policies  map[string]bool `json:"policies"`
+
+	PopLaborers    int `json:"pop_laborers"`
 	PopSpecialists int `json:"pop_specialists"`
-	PopElites     int `json:"pop_elites"`
+	PopElites      int `json:"pop_elites"`
 
 	Food       int `json:"food"`
 	Water      int `json:"water"`
 	Iron       int `json:"iron"`
 	Carbon     int `json:"carbon"`
 	Gold       int `json:"gold"`
-    Vegetation int `json:"vegetation"`
+	Vegetation int `json:"vegetation"`
 	Oxygen     int `json:"oxygen"`
 	Fuel       int `json:"fuel"`
-	
-    // Advanced/Raw
-	Uranium    int `json:"uranium"`
-    UraniumOre int `json:"uranium_ore"`
-	Platinum   int `json:"platinum"`
-    PlatinumOre int `json:"platinum_ore"`
-	Diamond    int `json:"diamond"`
-    DiamondOre int `json:"diamond_ore"`
-    Plutonium  int `json:"plutonium"`
-	
-    // Manufactured
-	Steel      int `json:"steel"`
-	Wine       int `json:"wine"`
-	
+
+	// Advanced/Raw
+	Uranium     int `json:"uranium"`
+	UraniumOre  int `json:"uranium_ore"`
+	Platinum    int `json:"platinum"`
+	PlatinumOre int `json:"platinum_ore"`
+	Diamond     int `json:"diamond"`
+	DiamondOre  int `json:"diamond_ore"`
+	Plutonium   int `json:"plutonium"`
+
+	// Manufactured
+	Steel int `json:"steel"`
+	Wine  int `json:"wine"`
+
 	StabilityCurrent float64 `json:"stability_current"`
 	StabilityTarget  float64 `json:"stability_target"`
 	MartialLaw       bool    `json:"martial_law"`
+
+	StabilityFactors *StabilityBreakdown `json:"stability_factors,omitempty"`
+	CollapseTicks    int                 `json:"collapse_ticks"`
+	Culture          float64             `json:"culture"`
+	Terraform        float64             `json:"terraform"`
+	AirlessTicks     int                 `json:"airless_ticks"`
+	Habitability     float64             `json:"habitability,omitempty"`
+	ModuleStock      map[string]int      `json:"module_stock"`
+	ModuleQueue      []ModuleOrder       `json:"module_queue"`
+	UnrestTicks      int                 `json:"unrest_ticks"`
+	Power            *PowerGrid          `json:"power,omitempty"`
+	Workforce        *Workforce          `json:"workforce,omitempty"`
+	Automation       *ColonyAutomation   `json:"automation,omitempty"`
+}
+
+// Per-tier satisfaction recorded by the tick so players can see WHY stability moves
+type StabilityBreakdown struct {
+	Labor       float64  `json:"labor"`
+	Specialists float64  `json:"specialists"`
+	Elites      float64  `json:"elites"`
+	Shortages   []string `json:"shortages"`
 }
 
 type FleetPayload struct {
-    PopLaborers   int            `json:"laborers"`
-    PopSpecialists int           `json:"specialists"`
-    Resources     map[string]int `json:"resources"`   
-    CultureBonus  float64        `json:"culture"`
-    Credits       int            `json:"credits"` // New: Fleets can carry cash for trades
+	PopLaborers    int            `json:"laborers"`
+	PopSpecialists int            `json:"specialists"`
+	Resources      map[string]int `json:"resources"`
+	CultureBonus   float64        `json:"culture"`
+	Credits        int            `json:"credits"` // New: Fleets can carry cash for trades
 }
 
 type Fleet struct {
-	ID           int      `json:"id"`
-	OwnerUUID    string   `json:"owner_uuid"`
-	Status       string   `json:"status"`
-	OriginSystem string   `json:"origin_system"`
-	DestSystem   string   `json:"dest_system"`
-	ArrivalTick  int64    `json:"arrival_tick"`
-	Fuel         int      `json:"fuel"`
-	
-	HullClass    string   `json:"hull_class"`
-	Modules      []string `json:"modules"`
-	
-	Payload      FleetPayload `json:"payload"`
-    TargetOrderID string      `json:"target_order_id"` // New: For Atomic Swaps
-	
-	ArkShip    int `json:"ark_ship"`
-	Fighters   int `json:"fighters"`
-	Frigates   int `json:"frigates"`
-	Haulers    int `json:"haulers"`
+	ID           int    `json:"id"`
+	OwnerUUID    string `json:"owner_uuid"`
+	Status       string `json:"status"`
+	OriginSystem string `json:"origin_system"`
+	DestSystem   string `json:"dest_system"`
+	ArrivalTick  int64  `json:"arrival_tick"`
+	Fuel         int    `json:"fuel"`
+
+	HullClass  string    `json:"hull_class"`
+	Modules    []string  `json:"modules"`
+	Condition  []float64 `json:"module_condition,omitempty"` // per module, 1 = intact (see damage.go)
+	HullDamage int       `json:"hull_damage,omitempty"`      // structure lost in battle, until repaired
+
+	Payload        FleetPayload `json:"payload"`
+	TargetOrderID  string       `json:"target_order_id"` // New: For Atomic Swaps
+	HomeSystem     string       `json:"home_system"`
+	AutoReturn     bool         `json:"auto_return"`
+	Experience     int          `json:"experience"`
+	Veterancy      int          `json:"veterancy"`
+	BombardTarget  string       `json:"bombard_target"`
+	BuildRemaining int          `json:"build_remaining,omitempty"` // tons left while CONSTRUCTING
+
+	ArkShip  int `json:"ark_ship"`
+	Fighters int `json:"fighters"`
+	Frigates int `json:"frigates"`
+	Haulers  int `json:"haulers"`
 }
 
 type ShipHull struct {
-    Class        string 
-    EngineSlots  int
-    WeaponSlots  int
-    SpecialSlots int 
+	Class        string
+	EngineSlots  int
+	WeaponSlots  int
+	SpecialSlots int
 }
 
 type HeartbeatRequest struct {
-	UUID      string `json:"uuid"`
-	Tick      int64  `json:"tick"`
-	PeerCount int    `json:"peer_count"`
-	GenHash   string `json:"gen_hash"`
-	Signature string `json:"sig"` 
-    MarketOrders []MarketOrder `json:"market_orders"` // New: Gossip Payload
+	UUID            string                  `json:"uuid"`
+	Tick            int64                   `json:"tick"`
+	PeerCount       int                     `json:"peer_count"`
+	GenHash         string                  `json:"gen_hash"`
+	Signature       string                  `json:"sig"`
+	MarketOrders    []MarketOrder           `json:"market_orders"`          // New: Gossip Payload
+	Neighbors       []string                `json:"neighbors,omitempty"`    // Peer exchange for /federation/graph
+	SystemNames     []SystemName            `json:"system_names,omitempty"` // Star names given recently (see naming.go)
+	Tolls           TollSchedule            `json:"tolls"`
+	Economy         *EconomyControls        `json:"economy,omitempty"`          // absent from nodes without economy controls
+	Vision          [][]int                 `json:"vision,omitempty"`           // sent to allies only
+	Beacons         []Beacon                `json:"beacons,omitempty"`          // shared beacons, sent to allies only
+	Supply          map[string]SupplyVolume `json:"supply,omitempty"`           // burn and trade volumes (see supplyindex.go)
+	CancelledOrders []OrderCancellation     `json:"cancelled_orders,omitempty"` // signed withdrawals (see marketcancel.go)
+}
+
+type BattleParticipant struct {
+	FleetID     int      `json:"fleet_id"`
+	OwnerUUID   string   `json:"owner_uuid"`
+	HullClass   string   `json:"hull_class"`
+	StartHP     int      `json:"start_hp"`
+	EndHP       int      `json:"end_hp"`
+	Outcome     string   `json:"outcome"` // "destroyed", "withdrew", "held", "captured"
+	KilledBy    string   `json:"killed_by,omitempty"`
+	XPGained    int      `json:"xp_gained,omitempty"`
+	CapturedBy  string   `json:"captured_by,omitempty"`
+	Sabotaged   []string `json:"sabotaged,omitempty"` // modules wrecked by a captured crew
+	MarinesLost int      `json:"marines_lost,omitempty"`
+}
+
+// Logged per bank burn (transaction_log BANK_BURN) for the economy indicators
+type BurnRecord struct {
+	UserUUID string `json:"user_uuid"`
+	Item     string `json:"item"`
+	Amount   int    `json:"amount"`
+	Payout   int    `json:"payout"`
+	ColonyID int    `json:"colony_id,omitempty"`
+}
+
+type BattleReport struct {
+	ID           int                 `json:"id"`
+	SystemID     string              `json:"system_id"`
+	Tick         int64               `json:"tick"`
+	Rounds       int                 `json:"rounds"`
+	Participants []BattleParticipant `json:"participants"`
+	Events       []string            `json:"events"`
 }
 
 type GrievanceReport struct {
-    OffenderUUID string `json:"offender"`
-    Damage       int    `json:"damage"`
-    Proof        string `json:"proof"`
+	OffenderUUID string `json:"offender"`
+	Damage       int    `json:"damage"`
+	Proof        string `json:"proof"`
+	Defending    string `json:"defending,omitempty"`    // ally node this report is filed for (see alliance.go)
+	ID           int    `json:"grievance_id,omitempty"` // reporter's own id, quoted by reparation receipts
+}
+
+// Acknowledgement that reparations were paid against a reported grievance, signed by the
+// offending node and countersigned by the victim's (the reporter's) node
+type ReparationReceipt struct {
+	GrievanceID  int    `json:"grievance_id"` // the victim node's GrievanceReport.ID
+	OffenderNode string `json:"reparation_offender"`
+	VictimNode   string `json:"reparation_victim"`
+	Paid         int    `json:"reparation_paid"` // running total, so a stale or replayed receipt adds nothing
+	OffenderSig  string `json:"offender_signature"`
+	VictimSig    string `json:"victim_signature"`
 }
 
 type Grievance struct {
-    OffenderUUID string
-    VictimUUID   string
-    DamageDone   int
-    Signature    []byte 
+	OffenderUUID string
+	VictimUUID   string
+	DamageDone   int
+	Signature    []byte
+}
+
+// Changes between two consecutive daily snapshots (see snapshotWorld)
+type SnapshotDelta struct {
+	BaseDay int      `json:"base_day"`
+	Changed []Colony `json:"changed"`
+	Removed []int    `json:"removed"`
 }
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// --- Unlocks ---
+// Advanced hulls and modules need facilities in the colony that builds or fits them. Each has
+// a tier: tier 1 is open from the start, tier 2 needs a specialist building, tier 3 a developed
+// one (a higher building level). Some also need a technology the owner has researched (see
+// research.go). handleConstruct and handleFleetRefit enforce them, and GET /api/catalog lists
+// every hull and module with its requirement.
+
+type Unlock struct {
+	Tier     int    `json:"tier"`
+	Building string `json:"building,omitempty"`
+	Level    int    `json:"level,omitempty"`
+	Tech     string `json:"tech,omitempty"` // researched by the colony's owner
+}
+
+var HullUnlocks = map[string]Unlock{
+	"Fighter":       {Tier: 1},
+	"Colonizer":     {Tier: 1},
+	"Frigate":       {Tier: 2, Building: "shipyard", Level: 2},
+	"SpeedyFighter": {Tier: 2, Building: "pilot_academy", Level: 1},
+	"Bomber":        {Tier: 3, Building: "shipyard", Level: 3, Tech: "heavy_ordnance"},
+}
+
+var ModuleUnlocks = map[string]Unlock{
+	"booster":          {Tier: 1},
+	"propeller":        {Tier: 1},
+	"laser":            {Tier: 1},
+	"colony_kit":       {Tier: 1},
+	"heat_shield":      {Tier: 1},
+	"probe_scanner":    {Tier: 1},
+	"salvage_rig":      {Tier: 2, Building: "shipyard", Level: 2},
+	"boarding_pod":     {Tier: 2, Building: "pilot_academy", Level: 1},
+	"warp_drive":       {Tier: 2, Building: "pilot_academy", Level: 1, Tech: "ftl_theory"},
+	"railgun":          {Tier: 2, Building: "uranium_enricher", Level: 1, Tech: "ballistics"},
+	"bomb_bay":         {Tier: 3, Building: "uranium_enricher", Level: 2, Tech: "heavy_ordnance"},
+	"gravity_dampener": {Tier: 3, Building: "pilot_academy", Level: 2, Tech: "gravitics"},
+}
+
+func (u Unlock) met(buildings map[string]int, techs map[string]bool) bool {
+	return (u.Building == "" || buildings[u.Building] >= u.Level) && (u.Tech == "" || techs[u.Tech])
+}
+
+func (u Unlock) missing(name string, buildings map[string]int) error {
+	if u.Building != "" && buildings[u.Building] < u.Level {
+		return fmt.Errorf("%s requires %s level %d", name, u.Building, u.Level)
+	}
+	return fmt.Errorf("%s requires %s", name, techName(u.Tech))
+}
+
+// First hull or module the colony's buildings or its owner's research don't unlock yet
+func checkUnlocks(hullClass string, modules []string, buildings map[string]int, techs map[string]bool) error {
+	if u := HullUnlocks[hullClass]; !u.met(buildings, techs) {
+		return u.missing(hullClass, buildings)
+	}
+	for _, m := range modules {
+		if u := ModuleUnlocks[m]; !u.met(buildings, techs) {
+			return u.missing(m, buildings)
+		}
+	}
+	return nil
+}
+
+type CatalogEntry struct {
+	Name     string         `json:"name"`
+	Unlock   Unlock         `json:"unlock"`
+	Unlocked *bool          `json:"unlocked,omitempty"` // with ?colony_id=
+	Hull     *ShipHull      `json:"hull,omitempty"`
+	Tons     int            `json:"tons"`
+	Recipe   map[string]int `json:"recipe,omitempty"` // module factory inputs
+}
+
+func sortCatalog(list []CatalogEntry) {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Unlock.Tier != list[j].Unlock.Tier {
+			return list[i].Unlock.Tier < list[j].Unlock.Tier
+		}
+		return list[i].Name < list[j].Name
+	})
+}
+
+// GET: every hull and module with its tier and requirement. ?colony_id= (yours or governed)
+// also says which that colony has unlocked.
+func handleCatalog(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	var buildings map[string]int
+	var techs map[string]bool
+	if idStr := r.URL.Query().Get("colony_id"); idStr != "" {
+		userID, err := authenticate(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", 401)
+			return
+		}
+		colID, _ := strconv.Atoi(idStr)
+		var owner, bJson string
+		if db.QueryRow("SELECT owner_uuid, buildings_json FROM colonies WHERE id=?", colID).Scan(&owner, &bJson) != nil || !canManageColony(userID, colID, owner) {
+			http.Error(w, "Colony Not Found", 404)
+			return
+		}
+		buildings = make(map[string]int)
+		json.Unmarshal([]byte(bJson), &buildings)
+		techs = userTechs(owner)
+	}
+	mark := func(e *CatalogEntry) {
+		if buildings != nil {
+			ok := e.Unlock.met(buildings, techs)
+			e.Unlocked = &ok
+		}
+	}
+
+	hulls := []CatalogEntry{}
+	for name, hull := range HullRegistry {
+		h := hull
+		e := CatalogEntry{Name: name, Unlock: HullUnlocks[name], Hull: &h, Tons: HullTonnage[name]}
+		mark(&e)
+		hulls = append(hulls, e)
+	}
+	modules := []CatalogEntry{}
+	for name, u := range ModuleUnlocks {
+		e := CatalogEntry{Name: name, Unlock: u, Tons: ModuleTonnage, Recipe: ModuleRecipes[name]}
+		mark(&e)
+		modules = append(modules, e)
+	}
+	sortCatalog(hulls)
+	sortCatalog(modules)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]CatalogEntry{"hulls": hulls, "modules": modules})
+}
@@ -7,13 +7,17 @@ import (
 	"crypto/ed25519"
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"io"
 	"log"
 	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"time"
 
 	"github.com/pierrec/lz4/v4"
 	"golang.org/x/time/rate"
@@ -24,9 +28,9 @@ import (
 // NOTE: ipLimiters and ipLock are defined in globals.go
 
 func setupLogging() {
-	logDir := "./logs"
+	logDir := LogDir
 	if _, err := os.Stat(logDir); os.IsNotExist(err) {
-		os.Mkdir(logDir, 0755)
+		os.MkdirAll(logDir, 0755)
 	}
 
 	// standard logs
@@ -95,6 +99,81 @@ func encryptKey(key ed25519.PrivateKey, password string) string {
 	return hex.EncodeToString(ciphertext)
 }
 
+func decryptKey(enc string, password string) (ed25519.PrivateKey, error) {
+	data, err := hex.DecodeString(enc)
+	if err != nil {
+		return nil, err
+	}
+	passHash := blake3.Sum256([]byte(password))
+	block, _ := aes.NewCipher(passHash[:])
+	gcm, _ := cipher.NewGCM(block)
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	key, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil || len(key) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("decryption failed")
+	}
+	return ed25519.PrivateKey(key), nil
+}
+
+// --- Request Decoding ---
+
+// Upper bound for client JSON bodies (federation endpoints have their own 1MB limit)
+const MaxRequestBody = 64 * 1024
+
+// Decodes a JSON body strictly: size-capped, unknown fields rejected, a single value,
+// and every field tagged validate:"required" must be non-zero. Writes the 400 itself.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, MaxRequestBody)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(dst); err != nil {
+		msg := err.Error()
+		if err == io.EOF {
+			msg = "empty body"
+		}
+		http.Error(w, "Bad Request: "+msg, 400)
+		return false
+	}
+	if dec.More() {
+		http.Error(w, "Bad Request: trailing data after JSON body", 400)
+		return false
+	}
+	if missing := missingRequiredField(dst); missing != "" {
+		http.Error(w, "Bad Request: missing field '"+missing+"'", 400)
+		return false
+	}
+	return true
+}
+
+// Returns the JSON name of the first validate:"required" field left at its zero value
+func missingRequiredField(dst interface{}) string {
+	v := reflect.ValueOf(dst)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Tag.Get("validate") != "required" {
+			continue
+		}
+		if v.Field(i).IsZero() {
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "" {
+				name = field.Name
+			}
+			return name
+		}
+	}
+	return ""
+}
+
 // --- Middleware ---
 
 func getLimiter(ip string) *rate.Limiter {
@@ -119,32 +198,129 @@ func middlewareSecurity(next http.Handler) http.Handler {
 		}
 
 		if r.Method == "OPTIONS" {
-            // FIX CORS: Must include headers here for preflight check
-            w.Header().Set("Access-Control-Allow-Origin", "*")
-            w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS")
-            w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, X-User-ID, X-User-UUID, X-Server-UUID, X-Session-Token")
+			// FIX CORS: Must include headers here for preflight check
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, X-User-ID, X-User-UUID, X-Server-UUID, X-Session-Token, X-Admin-Key, X-Signing-Token, Idempotency-Key")
 			w.WriteHeader(http.StatusOK)
 			return
 		}
 
-		contentType := r.Header.Get("Content-Type")
-		if strings.Contains(contentType, "application/x-protobuf") {
+		next.ServeHTTP(w, r)
+	})
+}
+
+// --- Idempotency ---
+// Clients retrying a POST send the same Idempotency-Key; we replay the first answer
+// instead of applying the action twice. Keys are scoped to the authenticated caller
+// (middlewareAuth runs first), so requests without a resolved session are never cached or
+// replayed. Entries live for IdempotencyTTL; past IdempotencyCacheSize the oldest go first.
+
+const (
+	IdempotencyTTL       = 10 * time.Minute
+	IdempotencyCacheSize = 10000
+)
+
+type idempotentResponse struct {
+	Done    bool
+	Status  int
+	Header  http.Header
+	Body    []byte
+	Expires time.Time
+}
+
+type captureWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (c *captureWriter) WriteHeader(code int) {
+	c.status = code
+	c.ResponseWriter.WriteHeader(code)
+}
+
+func (c *captureWriter) Write(b []byte) (int, error) {
+	c.body.Write(b)
+	return c.ResponseWriter.Write(b)
+}
+
+func middlewareIdempotency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		p, authed := principalFromContext(r.Context())
+		if r.Method != "POST" || key == "" || !authed {
 			next.ServeHTTP(w, r)
 			return
 		}
+		cacheKey := p.UserID + "|" + r.URL.Path + "|" + key
 
-		next.ServeHTTP(w, r)
+		idempotencyLock.Lock()
+		now := time.Now()
+		if prev, ok := idempotencyCache[cacheKey]; ok && now.Before(prev.Expires) {
+			idempotencyLock.Unlock()
+			if !prev.Done {
+				http.Error(w, "Request In Progress", 409)
+				return
+			}
+			for k, v := range prev.Header {
+				w.Header()[k] = v
+			}
+			w.Header().Set("Idempotent-Replay", "true")
+			w.WriteHeader(prev.Status)
+			w.Write(prev.Body)
+			return
+		}
+		if len(idempotencyCache) >= IdempotencyCacheSize {
+			evictIdempotent(now)
+		}
+		idempotencyCache[cacheKey] = &idempotentResponse{Expires: now.Add(IdempotencyTTL)}
+		idempotencyLock.Unlock()
+
+		rec := &captureWriter{ResponseWriter: w, status: 200}
+		next.ServeHTTP(rec, r)
+
+		idempotencyLock.Lock()
+		if rec.status >= 500 {
+			// Server faults are retryable
+			delete(idempotencyCache, cacheKey)
+		} else {
+			idempotencyCache[cacheKey] = &idempotentResponse{
+				Done: true, Status: rec.status, Header: w.Header().Clone(),
+				Body: rec.body.Bytes(), Expires: time.Now().Add(IdempotencyTTL),
+			}
+		}
+		idempotencyLock.Unlock()
 	})
 }
 
+// Caller holds idempotencyLock. Drops expired entries, then the oldest until there is room.
+func evictIdempotent(now time.Time) {
+	for k, v := range idempotencyCache {
+		if now.After(v.Expires) {
+			delete(idempotencyCache, k)
+		}
+	}
+	for len(idempotencyCache) >= IdempotencyCacheSize {
+		var oldest string
+		var at time.Time
+		for k, v := range idempotencyCache {
+			if oldest == "" || v.Expires.Before(at) {
+				oldest, at = k, v.Expires
+			}
+		}
+		delete(idempotencyCache, oldest)
+	}
+}
+
 func middlewareCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS")
-        // FIX CORS: Added X-Session-Token and X-User-UUID explicitly
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, X-User-ID, X-User-UUID, X-Server-UUID, X-Session-Token")
-		
-        if r.Method == "OPTIONS" {
+		// FIX CORS: Added X-Session-Token and X-User-UUID explicitly
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, X-User-ID, X-User-UUID, X-Server-UUID, X-Session-Token, X-Admin-Key, X-Signing-Token, Idempotency-Key")
+
+		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
 			return
 		}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// --- API Versions ---
+// /api/... is v1 and frozen: handlers keep answering exactly as they always have, and
+// /api/v1/... is an alias for clients that want to pin it. /api/v2/... runs the same handlers
+// through an adapter that rewrites their responses: errors become
+// {"error": {"status", "code", "message"}}, plain-text acknowledgements become
+// {"message"}, and JSON lists are paged with ?limit= and ?offset=. New behavior belongs in
+// the adapter, not in the handlers, so v1 can't drift.
+
+var APIVersions = []string{"v1", "v2"}
+
+const (
+	V2DefaultPageSize = 50
+	V2MaxPageSize     = 200
+)
+
+type V2Error struct {
+	Status  int             `json:"status"`
+	Code    string          `json:"code"` // snake_case status text, e.g. "not_found"
+	Message string          `json:"message"`
+	Details json.RawMessage `json:"details,omitempty"` // a handler's own JSON error body
+}
+
+type V2Page struct {
+	Items      []json.RawMessage `json:"items"`
+	Total      int               `json:"total"`
+	Offset     int               `json:"offset"`
+	Limit      int               `json:"limit"`
+	NextOffset *int              `json:"next_offset,omitempty"`
+}
+
+// Holds a v1 response until the adapter has rewritten it
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header         { return b.header }
+func (b *bufferedResponse) WriteHeader(code int)        { b.status = code }
+func (b *bufferedResponse) Write(p []byte) (int, error) { return b.body.Write(p) }
+
+// Serves /api/<version>/... from the v1 routes on mux
+func versionedAPI(mux *http.ServeMux, version string) http.HandlerFunc {
+	prefix := "/api/" + version
+	return func(w http.ResponseWriter, r *http.Request) {
+		inner := r.Clone(r.Context())
+		inner.URL.Path = "/api" + strings.TrimPrefix(r.URL.Path, prefix)
+		inner.URL.RawPath = ""
+		if strings.HasPrefix(inner.URL.Path, "/api/v1/") || strings.HasPrefix(inner.URL.Path, "/api/v2/") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("API-Version", version)
+
+		if version == "v1" {
+			mux.ServeHTTP(w, inner)
+			return
+		}
+
+		// The adapter needs the plain body to rewrite it
+		inner.Header.Del("Accept-Encoding")
+		rec := &bufferedResponse{header: w.Header(), status: 200}
+		mux.ServeHTTP(rec, inner)
+		writeV2(w, r, rec)
+	}
+}
+
+// Some older handlers encode JSON without setting a Content-Type
+func isJSON(h http.Header, body []byte) bool {
+	ct := h.Get("Content-Type")
+	return strings.HasPrefix(ct, "application/json") || (ct == "" && json.Valid(body))
+}
+
+func writeV2(w http.ResponseWriter, r *http.Request, rec *bufferedResponse) {
+	body := bytes.TrimSpace(rec.body.Bytes())
+	jsonBody := isJSON(rec.header, body)
+	var out interface{}
+
+	switch {
+	case rec.status >= 400:
+		e := V2Error{
+			Status:  rec.status,
+			Code:    strings.ToLower(strings.ReplaceAll(http.StatusText(rec.status), " ", "_")),
+			Message: string(body),
+		}
+		if jsonBody {
+			e.Message, e.Details = http.StatusText(rec.status), json.RawMessage(body)
+		}
+		out = map[string]V2Error{"error": e}
+	case len(body) == 0:
+		// 204s, 304s and empty acknowledgements pass through
+	case !jsonBody:
+		out = map[string]string{"message": string(body)}
+	case r.Method == http.MethodGet && body[0] == '[':
+		var items []json.RawMessage
+		if json.Unmarshal(body, &items) == nil {
+			out = pageOf(items, r)
+		}
+	}
+
+	if out == nil {
+		w.WriteHeader(rec.status)
+		w.Write(rec.body.Bytes())
+		return
+	}
+	w.Header().Del("Content-Length")
+	w.Header().Del("X-Content-Type-Options")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(rec.status)
+	json.NewEncoder(w).Encode(out)
+}
+
+// Slices a list with ?limit= (default 50, max 200) and ?offset=
+func pageOf(items []json.RawMessage, r *http.Request) V2Page {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = V2DefaultPageSize
+	}
+	if limit > V2MaxPageSize {
+		limit = V2MaxPageSize
+	}
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > len(items) {
+		offset = len(items)
+	}
+	end := offset + limit
+	if end > len(items) {
+		end = len(items)
+	}
+
+	p := V2Page{Items: items[offset:end], Total: len(items), Offset: offset, Limit: limit}
+	if p.Items == nil {
+		p.Items = []json.RawMessage{}
+	}
+	if end < len(items) {
+		p.NextOffset = &end
+	}
+	return p
+}
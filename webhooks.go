@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// --- Webhooks ---
+// Users register URLs for game events. Events are queued in webhook_deliveries inside the tick
+// and a background worker posts them, signed with the hook's secret (HMAC-SHA256), retrying with
+// exponential backoff.
+
+const (
+	EventFleetArrival   = "fleet_arrival"
+	EventColonyAttacked = "colony_attacked"
+	EventOrderFilled    = "order_filled"
+	EventFleetLost      = "fleet_lost"
+	EventPatrolSighting = "patrol_sighting"
+
+	MaxWebhooksPerUser    = 10
+	MaxWebhookAttempts    = 6
+	WebhookBackoffBase    = 10 * time.Second
+	WebhookPollEvery      = 3 * time.Second
+	WebhookTimeout        = 5 * time.Second
+	WebhookRetention      = 24 * time.Hour
+	HeaderWebhookSig      = "X-OwnWorld-Signature"
+	HeaderWebhookEvent    = "X-OwnWorld-Event"
+	HeaderWebhookDelivery = "X-OwnWorld-Delivery"
+)
+
+var webhookEvents = map[string]bool{EventFleetArrival: true, EventColonyAttacked: true, EventOrderFilled: true, EventAccountLocked: true, EventFleetLost: true, EventPatrolSighting: true,
+	EventBattle: true, EventGrievance: true}
+
+type Webhook struct {
+	ID     int      `json:"id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret,omitempty"` // only returned on creation
+}
+
+type WebhookEnvelope struct {
+	Event string      `json:"event"`
+	Tick  int64       `json:"tick"`
+	Owner string      `json:"owner_uuid"`
+	Data  interface{} `json:"data"`
+}
+
+// Pushes the event to the owner's live streams and queues it for every hook registered for it
+func emitEvent(owner, event string, data interface{}) {
+	if owner == "" || owner == PirateOwnerUUID || isFreeFaction(owner) {
+		return
+	}
+	body, _ := json.Marshal(WebhookEnvelope{Event: event, Tick: atomic.LoadInt64(&CurrentTick), Owner: owner, Data: data})
+	pushEvent(owner, body)
+
+	rows, err := db.Query("SELECT id FROM webhooks WHERE owner_uuid=? AND (',' || events || ',') LIKE ?", owner, "%,"+event+",%")
+	if err != nil {
+		return
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if len(ids) == 0 {
+		return
+	}
+
+	now := time.Now().Unix()
+	for _, id := range ids {
+		db.Exec("INSERT INTO webhook_deliveries (webhook_id, event, payload, attempts, next_attempt, status, created_at) VALUES (?, ?, ?, 0, ?, 'pending', ?)",
+			id, event, body, now, now)
+	}
+}
+
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func runWebhookWorker() {
+	ticker := time.NewTicker(WebhookPollEvery)
+	defer ticker.Stop()
+	client := &http.Client{Timeout: WebhookTimeout}
+	for range ticker.C {
+		deliverWebhooks(client)
+	}
+}
+
+func deliverWebhooks(client *http.Client) {
+	now := time.Now()
+	db.Exec("DELETE FROM webhook_deliveries WHERE status != 'pending' AND created_at < ?", now.Add(-WebhookRetention).Unix())
+
+	type delivery struct {
+		ID, Attempts int
+		Event        string
+		Payload      []byte
+		URL, Secret  string
+	}
+	rows, err := db.Query(`SELECT d.id, d.attempts, d.event, d.payload, w.url, w.secret
+	                       FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+	                       WHERE d.status='pending' AND d.next_attempt <= ? ORDER BY d.id LIMIT 50`, now.Unix())
+	if err != nil {
+		return
+	}
+	var batch []delivery
+	for rows.Next() {
+		var d delivery
+		rows.Scan(&d.ID, &d.Attempts, &d.Event, &d.Payload, &d.URL, &d.Secret)
+		batch = append(batch, d)
+	}
+	rows.Close()
+
+	for _, d := range batch {
+		req, _ := http.NewRequest("POST", d.URL, bytes.NewReader(d.Payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(HeaderWebhookEvent, d.Event)
+		req.Header.Set(HeaderWebhookDelivery, strconv.Itoa(d.ID))
+		req.Header.Set(HeaderWebhookSig, signWebhook(d.Secret, d.Payload))
+
+		resp, err := client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode < 300 {
+				db.Exec("UPDATE webhook_deliveries SET status='delivered', attempts=attempts+1 WHERE id=?", d.ID)
+				continue
+			}
+			err = fmt.Errorf("HTTP %d", resp.StatusCode)
+		}
+
+		attempts := d.Attempts + 1
+		if attempts >= MaxWebhookAttempts {
+			db.Exec("UPDATE webhook_deliveries SET status='failed', attempts=?, last_error=? WHERE id=?", attempts, err.Error(), d.ID)
+			continue
+		}
+		next := now.Add(WebhookBackoffBase * time.Duration(1<<uint(attempts-1))).Unix()
+		db.Exec("UPDATE webhook_deliveries SET attempts=?, next_attempt=?, last_error=? WHERE id=?", attempts, next, err.Error(), d.ID)
+	}
+}
+
+// GET lists your hooks, POST {"url", "events"} registers one (the secret is returned once)
+func handleWebhooks(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		rows, err := db.Query("SELECT id, url, events FROM webhooks WHERE owner_uuid=? ORDER BY id", userID)
+		if err != nil {
+			http.Error(w, "DB Error", 500)
+			return
+		}
+		defer rows.Close()
+		hooks := []Webhook{}
+		for rows.Next() {
+			var h Webhook
+			var events string
+			rows.Scan(&h.ID, &h.URL, &events)
+			h.Events = strings.Split(events, ",")
+			hooks = append(hooks, h)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(hooks)
+		return
+	}
+
+	var req struct {
+		URL    string   `json:"url" validate:"required"`
+		Events []string `json:"events" validate:"required"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, "Invalid URL", 400)
+		return
+	}
+	for _, e := range req.Events {
+		if !webhookEvents[e] {
+			http.Error(w, "Unknown Event: "+e, 400)
+			return
+		}
+	}
+
+	var count int
+	db.QueryRow("SELECT count(*) FROM webhooks WHERE owner_uuid=?", userID).Scan(&count)
+	if count >= MaxWebhooksPerUser {
+		http.Error(w, "Webhook Limit Reached", 400)
+		return
+	}
+
+	secretBytes := make([]byte, 24)
+	rand.Read(secretBytes)
+	secret := hex.EncodeToString(secretBytes)
+	res, err := db.Exec("INSERT INTO webhooks (owner_uuid, url, events, secret) VALUES (?, ?, ?, ?)",
+		userID, req.URL, strings.Join(req.Events, ","), secret)
+	if err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+	id, _ := res.LastInsertId()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Webhook{ID: int(id), URL: req.URL, Events: req.Events, Secret: secret})
+}
+
+func handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	var req struct {
+		ID int `json:"id" validate:"required"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	res, _ := db.Exec("DELETE FROM webhooks WHERE id=? AND owner_uuid=?", req.ID, userID)
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Webhook Not Found", 404)
+		return
+	}
+	db.Exec("DELETE FROM webhook_deliveries WHERE webhook_id=?", req.ID)
+	w.Write([]byte("Webhook Deleted"))
+}
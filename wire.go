@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+
+	fedpb "ownworld/pkg/federation"
+)
+
+// --- Federation Wire Format ---
+// Handshakes, heartbeats (with their market gossip) and transactions travel as protobuf
+// (proto/federation.proto) or as JSON, LZ4-compressed either way. The Content-Type says which:
+// application/x-protobuf for protobuf, anything else is JSON, which is all older nodes send.
+// Receivers take both. Senders use protobuf with peers that advertise the protobuf_wire feature
+// and JSON with the rest; switching the feature off on a node makes it send and advertise JSON
+// only, which is handy when reading federation traffic while debugging. A handshake goes to a
+// seed before we know what it speaks, so it is tried as protobuf first and sent again as JSON if
+// the seed can't read it.
+//
+// The JSON field names stay the wire names for JSON peers; the .proto mirrors the structs field
+// for field, so a message survives a round trip through either encoding.
+
+const (
+	FedContentJSON  = "application/x-ownworld-fed"
+	FedContentProto = "application/x-protobuf"
+)
+
+// Whether to send protobuf to a peer
+func speaksProto(p Peer) bool {
+	return featureEnabled(FeatureProtobufWire) && p.Supports(FeatureProtobufWire)
+}
+
+// Encodes msg (a HandshakeRequest, HeartbeatRequest or TransactionRequest) and compresses it
+func encodeFederation(msg interface{}, asProto bool) (body []byte, contentType string) {
+	if asProto {
+		var pb proto.Message
+		switch m := msg.(type) {
+		case HandshakeRequest:
+			pb = handshakeToPB(m)
+		case HeartbeatRequest:
+			pb = heartbeatToPB(m)
+		case TransactionRequest:
+			pb = &fedpb.TransactionRequest{Uuid: m.UUID, Tick: m.Tick, Payload: m.Payload, Signature: m.Signature}
+		}
+		if pb != nil {
+			if data, err := proto.Marshal(pb); err == nil {
+				return compressLZ4(data), FedContentProto
+			}
+		}
+	}
+	data, _ := json.Marshal(msg)
+	return compressLZ4(data), FedContentJSON
+}
+
+// Sends a handshake to a node whose wire format we don't know yet: protobuf first, then JSON if
+// the node can't read it (older nodes reject what they can't parse with a 400 or 401)
+func postHandshake(client *http.Client, url string, req HandshakeRequest) (*http.Response, error) {
+	if featureEnabled(FeatureProtobufWire) {
+		body, ct := encodeFederation(req, true)
+		resp, err := postFederationAs(client, url, ct, body)
+		if err != nil {
+			return nil, err
+		}
+		switch resp.StatusCode {
+		case 400, 401, http.StatusUnsupportedMediaType:
+			resp.Body.Close()
+		default:
+			return resp, nil
+		}
+	}
+	body, ct := encodeFederation(req, false)
+	return postFederationAs(client, url, ct, body)
+}
+
+func isProtoBody(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), FedContentProto)
+}
+
+// Decompresses a federation body and decodes it into msg (a pointer to one of the request types)
+func decodeFederation(r *http.Request, body []byte, msg interface{}) error {
+	data := decompressLZ4(body)
+	if !isProtoBody(r) {
+		return json.Unmarshal(data, msg)
+	}
+	switch m := msg.(type) {
+	case *HandshakeRequest:
+		var pb fedpb.HandshakeRequest
+		if err := proto.Unmarshal(data, &pb); err != nil {
+			return err
+		}
+		*m = handshakeFromPB(&pb)
+	case *HeartbeatRequest:
+		var pb fedpb.HeartbeatRequest
+		if err := proto.Unmarshal(data, &pb); err != nil {
+			return err
+		}
+		*m = heartbeatFromPB(&pb)
+	case *TransactionRequest:
+		var pb fedpb.TransactionRequest
+		if err := proto.Unmarshal(data, &pb); err != nil {
+			return err
+		}
+		*m = TransactionRequest{UUID: pb.Uuid, Tick: pb.Tick, Payload: pb.Payload, Signature: pb.Signature}
+	default:
+		return fmt.Errorf("no protobuf encoding for %T", msg)
+	}
+	return nil
+}
+
+func intsToPB(v []int) []int32 {
+	if v == nil {
+		return nil
+	}
+	out := make([]int32, len(v))
+	for i, x := range v {
+		out[i] = int32(x)
+	}
+	return out
+}
+
+func intsFromPB(v []int32) []int {
+	if v == nil {
+		return nil
+	}
+	out := make([]int, len(v))
+	for i, x := range v {
+		out[i] = int(x)
+	}
+	return out
+}
+
+func tollsToPB(t TollSchedule) *fedpb.TollSchedule {
+	return &fedpb.TollSchedule{Transit: int32(t.Transit), TradePct: t.TradePct}
+}
+
+func tollsFromPB(t *fedpb.TollSchedule) TollSchedule {
+	return TollSchedule{Transit: int(t.GetTransit()), TradePct: t.GetTradePct()}
+}
+
+func handshakeToPB(h HandshakeRequest) *fedpb.HandshakeRequest {
+	pb := &fedpb.HandshakeRequest{
+		Uuid: h.UUID, GenesisHash: h.GenesisHash, PublicKey: h.PublicKey, Address: h.Address,
+		Location: intsToPB(h.Location), InviteToken: h.InviteToken, Features: h.Features, Tolls: tollsToPB(h.Tolls),
+	}
+	if h.LocationSalt != nil {
+		pb.LocationSalt, pb.LocationDerived = int32(*h.LocationSalt), true
+	}
+	return pb
+}
+
+func handshakeFromPB(pb *fedpb.HandshakeRequest) HandshakeRequest {
+	h := HandshakeRequest{
+		UUID: pb.Uuid, GenesisHash: pb.GenesisHash, PublicKey: pb.PublicKey, Address: pb.Address,
+		Location: intsFromPB(pb.Location), InviteToken: pb.InviteToken, Features: pb.Features, Tolls: tollsFromPB(pb.Tolls),
+	}
+	if pb.LocationDerived {
+		salt := int(pb.LocationSalt)
+		h.LocationSalt = &salt
+	}
+	return h
+}
+
+func heartbeatToPB(h HeartbeatRequest) *fedpb.HeartbeatRequest {
+	pb := &fedpb.HeartbeatRequest{
+		Uuid: h.UUID, Tick: h.Tick, PeerCount: int32(h.PeerCount), GenHash: h.GenHash, Signature: h.Signature,
+		Neighbors: h.Neighbors, Tolls: tollsToPB(h.Tolls),
+	}
+	for _, o := range h.MarketOrders {
+		pb.MarketOrders = append(pb.MarketOrders, &fedpb.GossipOrder{
+			OrderId: o.ID, SellerUuid: o.SellerUUID, Item: o.Item, Quantity: int32(o.Quantity), Price: int32(o.Price),
+			IsBuy: o.IsBuy, OriginSystem: o.OriginSystem, ExpiresTick: o.ExpiresTick, Signature: o.Signature,
+			RelayCount: int32(o.RelayCount), Node: o.Node,
+		})
+	}
+	for _, n := range h.SystemNames {
+		pb.SystemNames = append(pb.SystemNames, &fedpb.SystemName{SystemId: n.SystemID, Name: n.Name, Discoverer: n.Discoverer, NamedTick: n.NamedTick})
+	}
+	if h.Economy != nil {
+		pb.Economy = &fedpb.EconomyControls{BurnRate: h.Economy.BurnRate, MarketFee: h.Economy.MarketFee, Upkeep: h.Economy.Upkeep}
+	}
+	for _, v := range h.Vision {
+		pb.Vision = append(pb.Vision, &fedpb.Point{Xyz: intsToPB(v)})
+	}
+	for _, b := range h.Beacons {
+		pb.Beacons = append(pb.Beacons, &fedpb.Beacon{
+			Id: int32(b.ID), Name: b.Name, X: int32(b.X), Y: int32(b.Y), Z: int32(b.Z), Shared: b.Shared, OwnerUuid: b.OwnerUUID, Node: b.Node,
+		})
+	}
+	if h.Supply != nil {
+		pb.Supply = make(map[string]*fedpb.SupplyVolume, len(h.Supply))
+		for item, s := range h.Supply {
+			pb.Supply[item] = &fedpb.SupplyVolume{Recent: s.Recent, Baseline: s.Baseline}
+		}
+	}
+	for _, c := range h.CancelledOrders {
+		pb.CancelledOrders = append(pb.CancelledOrders, &fedpb.OrderCancellation{OrderId: c.OrderID, Node: c.Node, Signature: c.Signature})
+	}
+	return pb
+}
+
+func heartbeatFromPB(pb *fedpb.HeartbeatRequest) HeartbeatRequest {
+	h := HeartbeatRequest{
+		UUID: pb.Uuid, Tick: pb.Tick, PeerCount: int(pb.PeerCount), GenHash: pb.GenHash, Signature: pb.Signature,
+		Neighbors: pb.Neighbors, Tolls: tollsFromPB(pb.Tolls),
+	}
+	for _, o := range pb.MarketOrders {
+		h.MarketOrders = append(h.MarketOrders, MarketOrder{
+			ID: o.OrderId, SellerUUID: o.SellerUuid, Item: o.Item, Quantity: int(o.Quantity), Price: int(o.Price),
+			IsBuy: o.IsBuy, OriginSystem: o.OriginSystem, ExpiresTick: o.ExpiresTick, Signature: o.Signature,
+			RelayCount: int(o.RelayCount), Node: o.Node,
+		})
+	}
+	for _, n := range pb.SystemNames {
+		h.SystemNames = append(h.SystemNames, SystemName{SystemID: n.SystemId, Name: n.Name, Discoverer: n.Discoverer, NamedTick: n.NamedTick})
+	}
+	if pb.Economy != nil {
+		h.Economy = &EconomyControls{BurnRate: pb.Economy.BurnRate, MarketFee: pb.Economy.MarketFee, Upkeep: pb.Economy.Upkeep}
+	}
+	for _, v := range pb.Vision {
+		h.Vision = append(h.Vision, intsFromPB(v.Xyz))
+	}
+	for _, b := range pb.Beacons {
+		h.Beacons = append(h.Beacons, Beacon{
+			ID: int(b.Id), Name: b.Name, X: int(b.X), Y: int(b.Y), Z: int(b.Z), Shared: b.Shared, OwnerUUID: b.OwnerUuid, Node: b.Node,
+		})
+	}
+	if pb.Supply != nil {
+		h.Supply = make(map[string]SupplyVolume, len(pb.Supply))
+		for item, s := range pb.Supply {
+			h.Supply[item] = SupplyVolume{Recent: s.GetRecent(), Baseline: s.GetBaseline()}
+		}
+	}
+	for _, c := range pb.CancelledOrders {
+		h.CancelledOrders = append(h.CancelledOrders, OrderCancellation{OrderID: c.OrderId, Node: c.Node, Signature: c.Signature})
+	}
+	return h
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// --- Workforce ---
+// Laborers work in three sectors: farming (farms, wells, greenhouses), mining (mines and carbon
+// extractors) and construction (shipyards). Every building in a sector wants
+// WorkersPerBuilding of them. A colony's allocation, set through /api/colony/workforce, gives
+// each sector a percentage of the colony's laborers; the sector's output is then scaled by its
+// staffing (assigned over wanted), up to MaxStaffing for crews larger than the buildings need.
+// Laborers left unassigned, or assigned beyond MaxStaffing, are idle, and idleness costs the
+// colony up to IdleStabilityPenalty of its stability target.
+//
+// A colony that has never set an allocation works as it always has: every building fully
+// staffed, nobody idle.
+
+const (
+	MaxStaffing          = 1.5
+	IdleStabilityPenalty = 25.0 // at a fully idle workforce
+)
+
+const (
+	SectorMining       = "mining"
+	SectorFarming      = "farming"
+	SectorConstruction = "construction"
+)
+
+var SectorBuildings = map[string][]string{
+	SectorMining:       {"iron_mine", "carbon_extractor", "uranium_mine", "platinum_mine", "diamond_mine"},
+	SectorFarming:      {"farm", "well", "greenhouse"},
+	SectorConstruction: {"shipyard"},
+}
+
+var WorkersPerBuilding = map[string]int{
+	SectorMining:       20,
+	SectorFarming:      10,
+	SectorConstruction: 25,
+}
+
+// Percent of the colony's laborers in each sector; the rest are idle
+type Workforce struct {
+	Mining       int `json:"mining"`
+	Farming      int `json:"farming"`
+	Construction int `json:"construction"`
+}
+
+func (wf *Workforce) share(sector string) int {
+	switch sector {
+	case SectorMining:
+		return wf.Mining
+	case SectorFarming:
+		return wf.Farming
+	case SectorConstruction:
+		return wf.Construction
+	}
+	return 0
+}
+
+type WorkforceReport struct {
+	ColonyID    int                `json:"colony_id"`
+	Laborers    int                `json:"laborers"`
+	Specialists int                `json:"specialists"`
+	Elites      int                `json:"elites"`
+	Allocation  *Workforce         `json:"allocation"` // nil: every building staffed
+	Wanted      map[string]int     `json:"wanted"`
+	Assigned    map[string]int     `json:"assigned"`
+	Staffing    map[string]float64 `json:"staffing"`
+	Idle        int                `json:"idle"`
+}
+
+func sectorWanted(buildings map[string]int, sector string) int {
+	n := 0
+	for _, b := range SectorBuildings[sector] {
+		n += buildings[b]
+	}
+	return n * WorkersPerBuilding[sector]
+}
+
+func colonyWorkforce(c *Colony) WorkforceReport {
+	rep := WorkforceReport{ColonyID: c.ID, Laborers: c.PopLaborers, Specialists: c.PopSpecialists, Elites: c.PopElites,
+		Allocation: c.Workforce, Wanted: make(map[string]int), Assigned: make(map[string]int), Staffing: make(map[string]float64)}
+
+	working := 0
+	for sector := range SectorBuildings {
+		wanted := sectorWanted(c.Buildings, sector)
+		rep.Wanted[sector] = wanted
+		if c.Workforce == nil {
+			rep.Assigned[sector] = wanted
+			rep.Staffing[sector] = 1.0
+			continue
+		}
+
+		assigned := c.PopLaborers * c.Workforce.share(sector) / 100
+		rep.Assigned[sector] = assigned
+		staff := MaxStaffing
+		if wanted > 0 && float64(assigned) < float64(wanted)*MaxStaffing {
+			staff = float64(assigned) / float64(wanted)
+		}
+		if wanted == 0 {
+			staff = 0
+		}
+		rep.Staffing[sector] = staff
+		working += int(staff * float64(wanted))
+	}
+	if c.Workforce != nil && c.PopLaborers > working {
+		rep.Idle = c.PopLaborers - working
+	}
+	return rep
+}
+
+// Stability target lost to idle laborers
+func idlePenalty(rep WorkforceReport) float64 {
+	if rep.Laborers <= 0 {
+		return 0
+	}
+	return IdleStabilityPenalty * float64(rep.Idle) / float64(rep.Laborers)
+}
+
+func validWorkforce(wf Workforce) bool {
+	if wf.Mining < 0 || wf.Farming < 0 || wf.Construction < 0 {
+		return false
+	}
+	return wf.Mining+wf.Farming+wf.Construction <= 100
+}
+
+// GET ?colony_id= reports the colony's workforce; POST {"colony_id","mining","farming",
+// "construction"} sets its allocation, or {"colony_id","reset":true} clears it
+func handleColonyWorkforce(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	var colonyID int
+	var req struct {
+		ColonyID int `json:"colony_id" validate:"required"`
+		Workforce
+		Reset bool `json:"reset"`
+	}
+	if r.Method == http.MethodPost {
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		colonyID = req.ColonyID
+	} else {
+		colonyID, _ = strconv.Atoi(r.URL.Query().Get("colony_id"))
+	}
+
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	defer lockRows(colonyOwnerRow(colonyID))()
+
+	var c Colony
+	var bJson, wfJson string
+	err = db.QueryRow(`SELECT id, owner_uuid, buildings_json, pop_laborers, pop_specialists, pop_elites,
+	                   COALESCE(workforce_json, '') FROM colonies WHERE id=?`, colonyID).
+		Scan(&c.ID, &c.OwnerUUID, &bJson, &c.PopLaborers, &c.PopSpecialists, &c.PopElites, &wfJson)
+	if err != nil {
+		http.Error(w, "Colony Not Found", 404)
+		return
+	}
+	if !canManageColony(userID, colonyID, c.OwnerUUID) {
+		http.Error(w, "Access Denied", 403)
+		return
+	}
+	json.Unmarshal([]byte(bJson), &c.Buildings)
+	c.Workforce = parseWorkforce(wfJson)
+
+	if r.Method == http.MethodPost {
+		if req.Reset {
+			c.Workforce = nil
+			wfJson = ""
+		} else {
+			if !validWorkforce(req.Workforce) {
+				http.Error(w, "Shares must be non-negative and total at most 100", 400)
+				return
+			}
+			wf := req.Workforce
+			c.Workforce = &wf
+			data, _ := json.Marshal(wf)
+			wfJson = string(data)
+		}
+		if _, err := db.Exec("UPDATE colonies SET workforce_json=? WHERE id=?", wfJson, colonyID); err != nil {
+			http.Error(w, "DB Error", 500)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(colonyWorkforce(&c))
+}
+
+func parseWorkforce(s string) *Workforce {
+	if s == "" {
+		return nil
+	}
+	var wf Workforce
+	if json.Unmarshal([]byte(s), &wf) != nil {
+		return nil
+	}
+	return &wf
+}
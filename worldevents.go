@@ -0,0 +1,277 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// --- World Events ---
+// Operators schedule live events from /admin/events:
+//   - resource_rush: extraction in a region (x, y, z, radius) is multiplied
+//   - double_production: extraction and industry everywhere are multiplied
+//   - armada: a pirate armada of N fleets appears at a system
+// Events start and end on their ticks inside the world tick. When an event ends (or is
+// cancelled while running) it cleans up after itself: multipliers simply stop applying and
+// armada fleets still alive are withdrawn. Scheduling and cancelling is announced to peers as
+// a signed federation transaction, so every node's players see the event in GET /api/events.
+
+const (
+	WorldEventRush       = "resource_rush"
+	WorldEventDouble     = "double_production"
+	WorldEventArmada     = "armada"
+	MaxWorldEventTicks   = 7 * TicksPerDay
+	MaxWorldEventMult    = 3.0
+	MaxWorldEventRadius  = 100
+	MaxArmadaFleets      = 20
+	MaxEventTitleLen     = 120
+	WorldEventsListLimit = 50
+)
+
+type WorldEvent struct {
+	ID         int     `json:"id"`
+	Origin     string  `json:"origin_uuid"` // node running the event
+	Kind       string  `json:"kind"`
+	Title      string  `json:"title"`
+	Multiplier float64 `json:"multiplier,omitempty"`
+	X          int     `json:"x,omitempty"`
+	Y          int     `json:"y,omitempty"`
+	Z          int     `json:"z,omitempty"`
+	Radius     int     `json:"radius,omitempty"`
+	SystemID   string  `json:"system_id,omitempty"`
+	Fleets     int     `json:"fleets,omitempty"`
+	StartTick  int64   `json:"start_tick"`
+	EndTick    int64   `json:"end_tick"`
+	Status     string  `json:"status"` // scheduled, active, ended, cancelled
+}
+
+// Federation payload announcing one of a node's events (or its cancellation)
+type WorldEventAnnouncement struct {
+	Event *WorldEvent `json:"world_event"`
+}
+
+func checkWorldEvent(e *WorldEvent) error {
+	if e.EndTick <= e.StartTick || e.EndTick-e.StartTick > MaxWorldEventTicks {
+		return fmt.Errorf("Duration must be 1-%d ticks", MaxWorldEventTicks)
+	}
+	switch e.Kind {
+	case WorldEventRush, WorldEventDouble:
+		if e.Multiplier <= 1 || e.Multiplier > MaxWorldEventMult {
+			return fmt.Errorf("Multiplier must be above 1 and at most %.1f", MaxWorldEventMult)
+		}
+		if e.Kind == WorldEventRush && (e.Radius < 1 || e.Radius > MaxWorldEventRadius) {
+			return fmt.Errorf("Radius must be 1-%d", MaxWorldEventRadius)
+		}
+	case WorldEventArmada:
+		if e.Fleets < 1 || e.Fleets > MaxArmadaFleets {
+			return fmt.Errorf("Fleets must be 1-%d", MaxArmadaFleets)
+		}
+		if _, exists := lookupSystem(e.SystemID); !exists {
+			return fmt.Errorf("Unknown System")
+		}
+	default:
+		return fmt.Errorf("Unknown Event Kind")
+	}
+	return nil
+}
+
+const worldEventCols = "id, origin_uuid, kind, title, multiplier, x, y, z, radius, system_id, fleets, start_tick, end_tick, status"
+
+func scanWorldEvents(query string, args ...interface{}) []WorldEvent {
+	list := []WorldEvent{}
+	rows, err := db.Query("SELECT "+worldEventCols+" FROM world_events "+query, args...)
+	if err != nil {
+		return list
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e WorldEvent
+		rows.Scan(&e.ID, &e.Origin, &e.Kind, &e.Title, &e.Multiplier, &e.X, &e.Y, &e.Z, &e.Radius,
+			&e.SystemID, &e.Fleets, &e.StartTick, &e.EndTick, &e.Status)
+		list = append(list, e)
+	}
+	return list
+}
+
+// Production multiplier from this node's running events at a colony's position
+func eventProduction(events []WorldEvent, pos []int, industry bool) float64 {
+	mult := 1.0
+	for _, e := range events {
+		switch e.Kind {
+		case WorldEventDouble:
+			mult *= e.Multiplier
+		case WorldEventRush:
+			if !industry && distance3(pos, []int{e.X, e.Y, e.Z}) <= float64(e.Radius) {
+				mult *= e.Multiplier
+			}
+		}
+	}
+	return mult
+}
+
+func spawnArmada(e WorldEvent) []int {
+	modJson, _ := json.Marshal([]string{"laser", "laser", "laser", "booster"})
+	payloadJson, _ := json.Marshal(FleetPayload{Resources: map[string]int{}})
+	var ids []int
+	for i := 0; i < e.Fleets; i++ {
+		res, err := db.Exec(`INSERT INTO fleets (owner_uuid, status, fuel, origin_system, dest_system, hull_class, modules_json, payload_json, home_system)
+		                     VALUES (?, 'ORBIT', 0, ?, ?, 'Fighter', ?, ?, '')`,
+			PirateOwnerUUID, e.SystemID, e.SystemID, string(modJson), string(payloadJson))
+		if err == nil {
+			id, _ := res.LastInsertId()
+			ids = append(ids, int(id))
+		}
+	}
+	return ids
+}
+
+// Withdraws an event's armada fleets that survived
+func withdrawArmada(eventID int) {
+	var idsJson string
+	db.QueryRow("SELECT COALESCE(fleet_ids_json, '[]') FROM world_events WHERE id=?", eventID).Scan(&idsJson)
+	var ids []int
+	json.Unmarshal([]byte(idsJson), &ids)
+	for _, id := range ids {
+		db.Exec("DELETE FROM fleets WHERE id=? AND owner_uuid=?", id, PirateOwnerUUID)
+	}
+}
+
+// Starts and ends this node's events; returns the ones running this tick
+func processWorldEvents(current int64) []WorldEvent {
+	for _, e := range scanWorldEvents("WHERE origin_uuid=? AND status='active' AND end_tick <= ?", ServerUUID, current) {
+		if e.Kind == WorldEventArmada {
+			withdrawArmada(e.ID)
+		}
+		db.Exec("UPDATE world_events SET status='ended' WHERE id=?", e.ID)
+		InfoLog.Printf("🎪 World event %d (%s) ended", e.ID, e.Title)
+	}
+	for _, e := range scanWorldEvents("WHERE origin_uuid=? AND status='scheduled' AND start_tick <= ?", ServerUUID, current) {
+		if e.Kind == WorldEventArmada {
+			idsJson, _ := json.Marshal(spawnArmada(e))
+			db.Exec("UPDATE world_events SET fleet_ids_json=? WHERE id=?", string(idsJson), e.ID)
+		}
+		db.Exec("UPDATE world_events SET status='active' WHERE id=?", e.ID)
+		InfoLog.Printf("🎪 World event %d (%s) started", e.ID, e.Title)
+	}
+	return scanWorldEvents("WHERE origin_uuid=? AND status='active'", ServerUUID)
+}
+
+func announceWorldEvent(e WorldEvent) {
+	payload, _ := json.Marshal(WorldEventAnnouncement{Event: &e})
+	broadcastTransaction(payload)
+}
+
+// Records a peer's event so our players see it; only the running node applies it
+func processWorldEventAnnouncement(e *WorldEvent, nodeID string) {
+	if e.ID == 0 || len(e.Title) > MaxEventTitleLen {
+		return
+	}
+	db.Exec("DELETE FROM world_events WHERE origin_uuid=? AND remote_id=?", nodeID, e.ID)
+	db.Exec(`INSERT INTO world_events (origin_uuid, remote_id, kind, title, multiplier, x, y, z, radius, system_id, fleets, start_tick, end_tick, status)
+	         VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		nodeID, e.ID, e.Kind, e.Title, e.Multiplier, e.X, e.Y, e.Z, e.Radius, e.SystemID, e.Fleets, e.StartTick, e.EndTick, e.Status)
+	InfoLog.Printf("📣 Node %s announced world event %q", nodeID, e.Title)
+}
+
+// GET: upcoming and running events across the federation (peer events by their own ticks)
+func handleWorldEvents(w http.ResponseWriter, r *http.Request) {
+	now := atomic.LoadInt64(&CurrentTick)
+	events := scanWorldEvents("WHERE status IN ('scheduled', 'active') AND end_tick > ? ORDER BY start_tick LIMIT ?", now, WorldEventsListLimit)
+	for i := range events {
+		if events[i].Origin != ServerUUID {
+			events[i].ID = 0 // our row ids mean nothing to players
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// GET: this node's events, newest first.
+// POST {"kind", "title", "start_tick" (default now), "duration", "multiplier", "x", "y", "z", "radius", "system_id", "fleets"}: schedule one.
+func handleAdminEvents(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	if !authenticateAdmin(r) {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var req struct {
+			WorldEvent
+			Duration int64 `json:"duration"`
+		}
+		if !decodeJSON(w, r, &req) {
+			return
+		}
+		e := req.WorldEvent
+		now := atomic.LoadInt64(&CurrentTick)
+		if e.StartTick <= now {
+			e.StartTick = now + 1
+		}
+		e.EndTick = e.StartTick + req.Duration
+		e.Origin, e.Status = ServerUUID, "scheduled"
+		if e.Title == "" {
+			e.Title = e.Kind
+		}
+		if len(e.Title) > MaxEventTitleLen {
+			http.Error(w, "Title Too Long", 400)
+			return
+		}
+		if err := checkWorldEvent(&e); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		stateLock.Lock()
+		res, err := db.Exec(`INSERT INTO world_events (origin_uuid, remote_id, kind, title, multiplier, x, y, z, radius, system_id, fleets, start_tick, end_tick, status)
+		                     VALUES (?, 0, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			e.Origin, e.Kind, e.Title, e.Multiplier, e.X, e.Y, e.Z, e.Radius, e.SystemID, e.Fleets, e.StartTick, e.EndTick, e.Status)
+		stateLock.Unlock()
+		if err != nil {
+			http.Error(w, "DB Error", 500)
+			return
+		}
+		id, _ := res.LastInsertId()
+		e.ID = int(id)
+		announceWorldEvent(e)
+		InfoLog.Printf("🎪 World event %d (%s) scheduled for ticks %d-%d", e.ID, e.Title, e.StartTick, e.EndTick)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(scanWorldEvents("WHERE origin_uuid=? ORDER BY id DESC LIMIT ?", ServerUUID, WorldEventsListLimit))
+}
+
+// POST {"id"}: cancels a scheduled or running event, cleaning up as if it had ended
+func handleAdminCancelEvent(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	if !authenticateAdmin(r) {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+	var req struct {
+		ID int `json:"id" validate:"required"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	stateLock.Lock()
+	events := scanWorldEvents("WHERE id=? AND origin_uuid=? AND status IN ('scheduled', 'active')", req.ID, ServerUUID)
+	if len(events) == 0 {
+		stateLock.Unlock()
+		http.Error(w, "Event Not Found", 404)
+		return
+	}
+	e := events[0]
+	if e.Status == "active" && e.Kind == WorldEventArmada {
+		withdrawArmada(e.ID)
+	}
+	db.Exec("UPDATE world_events SET status='cancelled' WHERE id=?", e.ID)
+	stateLock.Unlock()
+
+	e.Status = "cancelled"
+	announceWorldEvent(e)
+	InfoLog.Printf("🎪 World event %d (%s) cancelled", e.ID, e.Title)
+	w.Write([]byte("Event Cancelled"))
+}
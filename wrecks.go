@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync/atomic"
+)
+
+// --- Wrecks & Salvage ---
+// A fleet destroyed in battle leaves a wreck in the system for WreckLifetime ticks. The wreck
+// holds what can be recycled: HullScrapIron from the hull, WreckModuleShare of the materials its
+// modules were made from (see ModuleRecipes) and WreckCargoShare of the resources it carried.
+// Crew, colonists and credits are lost with the ship.
+//
+// A fleet in orbit carrying salvage rigs can strip a wreck in its system (POST
+// /api/fleet/salvage) into its cargo hold: SalvagePerRig units per rig per pass, for SalvageFuel
+// fuel a pass, scarcest materials first. Anyone may salvage, the victor or the victim's friends
+// alike, so a battle leaves something to fight over. GET /api/wrecks lists the wrecks in
+// systems where you have a fleet or a colony.
+
+const (
+	WreckLifetime    = 2880 // ticks (4 hours)
+	WreckModuleShare = 0.5
+	WreckCargoShare  = 0.5
+	HullScrapIron    = 300
+	SalvagePerRig    = 500
+	SalvageFuel      = 50
+)
+
+type Wreck struct {
+	ID          int            `json:"id"`
+	SystemID    string         `json:"system_id"`
+	HullClass   string         `json:"hull_class"`
+	OwnerUUID   string         `json:"owner_uuid"` // who lost it
+	Resources   map[string]int `json:"resources"`
+	CreatedTick int64          `json:"created_tick"`
+	ExpiresTick int64          `json:"expires_tick"`
+}
+
+func wreckRow(id int) string { return "wreck:" + strconv.Itoa(id) }
+
+// What survives of a hull, its modules and its cargo
+func wreckContents(modules []string, payload FleetPayload) map[string]int {
+	contents := map[string]int{"iron": HullScrapIron}
+	for _, m := range modules {
+		for res, amt := range ModuleRecipes[m] {
+			contents[res] += int(float64(amt) * WreckModuleShare)
+		}
+	}
+	for res, amt := range payload.Resources {
+		if validResources[res] && amt > 0 {
+			contents[res] += int(float64(amt) * WreckCargoShare)
+		}
+	}
+	for res, amt := range contents {
+		if amt <= 0 {
+			delete(contents, res)
+		}
+	}
+	return contents
+}
+
+// Leaves a wreck where a fleet died; called before the fleet row is deleted
+func leaveWreck(f Fleet, sysID string, tick int64) {
+	var plJson string
+	db.QueryRow("SELECT COALESCE(payload_json, '') FROM fleets WHERE id=?", f.ID).Scan(&plJson)
+	var payload FleetPayload
+	json.Unmarshal([]byte(plJson), &payload)
+
+	resJson, _ := json.Marshal(wreckContents(f.Modules, payload))
+	db.Exec("INSERT INTO wrecks (system_id, fleet_id, owner_uuid, hull_class, resources_json, created_tick, expires_tick) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		sysID, f.ID, f.OwnerUUID, f.HullClass, string(resJson), tick, tick+WreckLifetime)
+}
+
+func expireWrecks(tick int64) {
+	db.Exec("DELETE FROM wrecks WHERE expires_tick <= ?", tick)
+}
+
+func loadWreck(id int) (Wreck, error) {
+	var w Wreck
+	var resJson string
+	err := db.QueryRow("SELECT id, system_id, hull_class, owner_uuid, resources_json, created_tick, expires_tick FROM wrecks WHERE id=? AND expires_tick > ?",
+		id, atomic.LoadInt64(&CurrentTick)).Scan(&w.ID, &w.SystemID, &w.HullClass, &w.OwnerUUID, &resJson, &w.CreatedTick, &w.ExpiresTick)
+	if err != nil {
+		return w, err
+	}
+	json.Unmarshal([]byte(resJson), &w.Resources)
+	return w, nil
+}
+
+// Moves up to capacity units out of a wreck, scarcest first (fewest units, then by name)
+func takeSalvage(wreck map[string]int, capacity int) map[string]int {
+	items := make([]string, 0, len(wreck))
+	for res := range wreck {
+		items = append(items, res)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if wreck[items[i]] != wreck[items[j]] {
+			return wreck[items[i]] < wreck[items[j]]
+		}
+		return items[i] < items[j]
+	})
+
+	taken := make(map[string]int)
+	for _, res := range items {
+		if capacity <= 0 {
+			break
+		}
+		n := wreck[res]
+		if n > capacity {
+			n = capacity
+		}
+		taken[res] = n
+		capacity -= n
+		if wreck[res] -= n; wreck[res] == 0 {
+			delete(wreck, res)
+		}
+	}
+	return taken
+}
+
+func countModule(modules []string, want string) int {
+	n := 0
+	for _, m := range modules {
+		if m == want {
+			n++
+		}
+	}
+	return n
+}
+
+// Wrecks in the systems where the user has a fleet or a colony
+func handleWrecks(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	rows, err := db.Query(`SELECT id, system_id, hull_class, owner_uuid, resources_json, created_tick, expires_tick FROM wrecks
+	                       WHERE expires_tick > ? AND system_id IN (
+	                           SELECT origin_system FROM fleets WHERE owner_uuid=? AND status != 'TRANSIT'
+	                           UNION SELECT system_id FROM colonies WHERE owner_uuid=?)
+	                       ORDER BY id DESC LIMIT 100`, atomic.LoadInt64(&CurrentTick), userID, userID)
+	if err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+	defer rows.Close()
+	wrecks := []Wreck{}
+	for rows.Next() {
+		var wr Wreck
+		var resJson string
+		rows.Scan(&wr.ID, &wr.SystemID, &wr.HullClass, &wr.OwnerUUID, &resJson, &wr.CreatedTick, &wr.ExpiresTick)
+		json.Unmarshal([]byte(resJson), &wr.Resources)
+		wrecks = append(wrecks, wr)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(wrecks)
+}
+
+// POST {"fleet_id", "wreck_id"} strips what the fleet's salvage rigs can carry off a wreck
+func handleFleetSalvage(w http.ResponseWriter, r *http.Request) {
+	db := db.WithContext(r.Context())
+	var req struct {
+		FleetID int `json:"fleet_id" validate:"required"`
+		WreckID int `json:"wreck_id" validate:"required"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	userID, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", 401)
+		return
+	}
+
+	defer lockRows(userRow(userID), wreckRow(req.WreckID))()
+
+	var f Fleet
+	var modJson, plJson string
+	err = db.QueryRow("SELECT owner_uuid, status, origin_system, dest_system, fuel, modules_json, COALESCE(payload_json, '') FROM fleets WHERE id=?", req.FleetID).
+		Scan(&f.OwnerUUID, &f.Status, &f.OriginSystem, &f.DestSystem, &f.Fuel, &modJson, &plJson)
+	if err != nil {
+		http.Error(w, "Fleet Not Found", 404)
+		return
+	}
+	if f.OwnerUUID != userID {
+		http.Error(w, "Not your fleet", 403)
+		return
+	}
+	json.Unmarshal([]byte(modJson), &f.Modules)
+	json.Unmarshal([]byte(plJson), &f.Payload)
+	onStation := f.Status == "ORBIT" || (f.Status == FleetPatrol && f.OriginSystem == f.DestSystem)
+	if !onStation {
+		http.Error(w, "Fleet must be in orbit", 400)
+		return
+	}
+	rigs := countModule(f.Modules, "salvage_rig")
+	if rigs == 0 {
+		http.Error(w, "Fleet needs a salvage_rig", 400)
+		return
+	}
+	if f.Fuel < SalvageFuel {
+		http.Error(w, fmt.Sprintf("Insufficient Fuel (need %d)", SalvageFuel), 402)
+		return
+	}
+
+	wreck, err := loadWreck(req.WreckID)
+	if err != nil {
+		http.Error(w, "Wreck Not Found", 404)
+		return
+	}
+	if wreck.SystemID != f.OriginSystem {
+		http.Error(w, "Wreck is in another system", 400)
+		return
+	}
+
+	taken := takeSalvage(wreck.Resources, rigs*SalvagePerRig)
+	if f.Payload.Resources == nil {
+		f.Payload.Resources = make(map[string]int)
+	}
+	for res, n := range taken {
+		f.Payload.Resources[res] = safeAdd(f.Payload.Resources[res], n)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+	newPl, _ := json.Marshal(f.Payload)
+	tx.Exec("UPDATE fleets SET fuel = fuel - ?, payload_json=? WHERE id=?", SalvageFuel, string(newPl), req.FleetID)
+	if len(wreck.Resources) == 0 {
+		tx.Exec("DELETE FROM wrecks WHERE id=?", wreck.ID)
+	} else {
+		resJson, _ := json.Marshal(wreck.Resources)
+		tx.Exec("UPDATE wrecks SET resources_json=? WHERE id=?", string(resJson), wreck.ID)
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "DB Error", 500)
+		return
+	}
+	InfoLog.Printf("🧲 Fleet %d salvaged %v from wreck %d in %s", req.FleetID, taken, wreck.ID, wreck.SystemID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"salvaged": taken, "wreck": wreck, "fuel_left": f.Fuel - SalvageFuel,
+	})
+}